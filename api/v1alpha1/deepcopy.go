@@ -21,10 +21,112 @@ func (in *MessageQueueConfig) DeepCopy() *MessageQueueConfig {
 	return out
 }
 
+// DeepCopyInto copies all properties of this object into another object of the same type.
+func (in *TransferJobSpec) DeepCopyInto(out *TransferJobSpec) {
+	*out = *in
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]corev1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(corev1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SecurityContext != nil {
+		in, out := &in.SecurityContext, &out.SecurityContext
+		*out = new(corev1.SecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.InsecureRegistry != nil {
+		in, out := &in.InsecureRegistry, &out.InsecureRegistry
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ActiveDeadlineSeconds != nil {
+		in, out := &in.ActiveDeadlineSeconds, &out.ActiveDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.BackoffLimit != nil {
+		in, out := &in.BackoffLimit, &out.BackoffLimit
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TransferJobSpec.
+func (in *TransferJobSpec) DeepCopy() *TransferJobSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TransferJobSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto copies all properties of this object into another object of the same type.
 func (in *StatefulMigrationSpec) DeepCopyInto(out *StatefulMigrationSpec) {
 	*out = *in
+	if in.CheckpointOptions != nil {
+		in, out := &in.CheckpointOptions, &out.CheckpointOptions
+		*out = new(CheckpointOptions)
+		**out = **in
+	}
+	if in.TargetCluster != nil {
+		in, out := &in.TargetCluster, &out.TargetCluster
+		*out = new(TargetCluster)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]corev1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
 	in.MessageQueueConfig.DeepCopyInto(&out.MessageQueueConfig)
+	if in.TransferJob != nil {
+		in, out := &in.TransferJob, &out.TransferJob
+		*out = new(TransferJobSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Timeouts != nil {
+		in, out := &in.Timeouts, &out.Timeouts
+		*out = new(MigrationTimeouts)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RetryPolicy != nil {
+		in, out := &in.RetryPolicy, &out.RetryPolicy
+		*out = new(RetryPolicy)
+		**out = **in
+	}
+	if in.ControlProtocol != nil {
+		in, out := &in.ControlProtocol, &out.ControlProtocol
+		*out = new(ControlProtocol)
+		**out = **in
+	}
+	if in.RestoreReadiness != nil {
+		in, out := &in.RestoreReadiness, &out.RestoreReadiness
+		*out = new(RestoreReadiness)
+		**out = **in
+	}
+	if in.TrafficHandover != nil {
+		in, out := &in.TrafficHandover, &out.TrafficHandover
+		*out = new(TrafficHandover)
+		**out = **in
+	}
+	if in.RestorePodSpec != nil {
+		in, out := &in.RestorePodSpec, &out.RestorePodSpec
+		*out = new(RestorePodSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StatefulMigrationSpec.
@@ -37,6 +139,341 @@ func (in *StatefulMigrationSpec) DeepCopy() *StatefulMigrationSpec {
 	return out
 }
 
+// DeepCopyInto copies all properties of this object into another object of the same type.
+func (in *MigrationPlan) DeepCopyInto(out *MigrationPlan) {
+	*out = *in
+	if in.Checks != nil {
+		in, out := &in.Checks, &out.Checks
+		*out = make([]PlanCheck, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MigrationPlan.
+func (in *MigrationPlan) DeepCopy() *MigrationPlan {
+	if in == nil {
+		return nil
+	}
+	out := new(MigrationPlan)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies all properties of this object into another object of the same type.
+func (in *MigrationTimeouts) DeepCopyInto(out *MigrationTimeouts) {
+	*out = *in
+	if in.SwapSubPhaseSeconds != nil {
+		in, out := &in.SwapSubPhaseSeconds, &out.SwapSubPhaseSeconds
+		*out = make(map[string]int32, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ExchangeFence != nil {
+		in, out := &in.ExchangeFence, &out.ExchangeFence
+		*out = new(ExchangeFenceTuning)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MigrationTimeouts.
+func (in *MigrationTimeouts) DeepCopy() *MigrationTimeouts {
+	if in == nil {
+		return nil
+	}
+	out := new(MigrationTimeouts)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies all properties of this object into another object of the same type.
+func (in *RestorePodSpec) DeepCopyInto(out *RestorePodSpec) {
+	*out = *in
+	if in.Include != nil {
+		in, out := &in.Include, &out.Include
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Exclude != nil {
+		in, out := &in.Exclude, &out.Exclude
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestorePodSpec.
+func (in *RestorePodSpec) DeepCopy() *RestorePodSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RestorePodSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies all properties of this object into another object of the same type.
+func (in *ControlRequestStatus) DeepCopyInto(out *ControlRequestStatus) {
+	*out = *in
+	if in.SentAt != nil {
+		in, out := &in.SentAt, &out.SentAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ControlRequestStatus.
+func (in *ControlRequestStatus) DeepCopy() *ControlRequestStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ControlRequestStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies all properties of this object into another object of the same type.
+func (in *TargetCluster) DeepCopyInto(out *TargetCluster) {
+	*out = *in
+	if in.KubeconfigSecretRef != nil {
+		in, out := &in.KubeconfigSecretRef, &out.KubeconfigSecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TargetCluster.
+func (in *TargetCluster) DeepCopy() *TargetCluster {
+	if in == nil {
+		return nil
+	}
+	out := new(TargetCluster)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies all properties of this object into another object of the same type.
+func (in *CheckpointInspectionStatus) DeepCopyInto(out *CheckpointInspectionStatus) {
+	*out = *in
+	if in.Problems != nil {
+		in, out := &in.Problems, &out.Problems
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.InspectedAt != nil {
+		in, out := &in.InspectedAt, &out.InspectedAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointInspectionStatus.
+func (in *CheckpointInspectionStatus) DeepCopy() *CheckpointInspectionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckpointInspectionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies all properties of this object into another object of the same type.
+func (in *SourceFenceStatus) DeepCopyInto(out *SourceFenceStatus) {
+	*out = *in
+	if in.CheckpointedAt != nil {
+		in, out := &in.CheckpointedAt, &out.CheckpointedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.RequestedAt != nil {
+		in, out := &in.RequestedAt, &out.RequestedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.FencedAt != nil {
+		in, out := &in.FencedAt, &out.FencedAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SourceFenceStatus.
+func (in *SourceFenceStatus) DeepCopy() *SourceFenceStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SourceFenceStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies all properties of this object into another object of the same type.
+func (in *RestoreReadinessStatus) DeepCopyInto(out *RestoreReadinessStatus) {
+	*out = *in
+	if in.RunningAt != nil {
+		in, out := &in.RunningAt, &out.RunningAt
+		*out = (*in).DeepCopy()
+	}
+	if in.ReadyAt != nil {
+		in, out := &in.ReadyAt, &out.ReadyAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreReadinessStatus.
+func (in *RestoreReadinessStatus) DeepCopy() *RestoreReadinessStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreReadinessStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies all properties of this object into another object of the same type.
+func (in *TrafficHandoverStatus) DeepCopyInto(out *TrafficHandoverStatus) {
+	*out = *in
+	if in.Services != nil {
+		in, out := &in.Services, &out.Services
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.HeldLabels != nil {
+		in, out := &in.HeldLabels, &out.HeldLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ShadowAddedAt != nil {
+		in, out := &in.ShadowAddedAt, &out.ShadowAddedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.SourceRemovedAt != nil {
+		in, out := &in.SourceRemovedAt, &out.SourceRemovedAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficHandoverStatus.
+func (in *TrafficHandoverStatus) DeepCopy() *TrafficHandoverStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TrafficHandoverStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies all properties of this object into another object of the same type.
+func (in *OrdinalReservationStatus) DeepCopyInto(out *OrdinalReservationStatus) {
+	*out = *in
+	if in.OriginalStart != nil {
+		in, out := &in.OriginalStart, &out.OriginalStart
+		*out = new(int32)
+		**out = **in
+	}
+	if in.OriginalUpdateStrategy != nil {
+		in, out := &in.OriginalUpdateStrategy, &out.OriginalUpdateStrategy
+		*out = (*in).DeepCopy()
+	}
+	if in.ReservedAt != nil {
+		in, out := &in.ReservedAt, &out.ReservedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.ReleasedAt != nil {
+		in, out := &in.ReleasedAt, &out.ReleasedAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OrdinalReservationStatus.
+func (in *OrdinalReservationStatus) DeepCopy() *OrdinalReservationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(OrdinalReservationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies all properties of this object into another object of the same type.
+func (in *StatefulSetTemplateStatus) DeepCopyInto(out *StatefulSetTemplateStatus) {
+	*out = *in
+	if in.Mutations != nil {
+		in, out := &in.Mutations, &out.Mutations
+		*out = make([]TemplateMutationStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.OriginalUpdateStrategy != nil {
+		in, out := &in.OriginalUpdateStrategy, &out.OriginalUpdateStrategy
+		*out = (*in).DeepCopy()
+	}
+	if in.SettledAt != nil {
+		in, out := &in.SettledAt, &out.SettledAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StatefulSetTemplateStatus.
+func (in *StatefulSetTemplateStatus) DeepCopy() *StatefulSetTemplateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StatefulSetTemplateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies all properties of this object into another object of the same type.
+func (in *ClaimMetadata) DeepCopyInto(out *ClaimMetadata) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.OwnerReferences != nil {
+		in, out := &in.OwnerReferences, &out.OwnerReferences
+		*out = make([]metav1.OwnerReference, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClaimMetadata.
+func (in *ClaimMetadata) DeepCopy() *ClaimMetadata {
+	if in == nil {
+		return nil
+	}
+	out := new(ClaimMetadata)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies all properties of this object into another object of the same type.
+func (in *VolumeStatus) DeepCopyInto(out *VolumeStatus) {
+	*out = *in
+	if in.Claim != nil {
+		in, out := &in.Claim, &out.Claim
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VolumeStatus.
+func (in *VolumeStatus) DeepCopy() *VolumeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VolumeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto copies all properties of this object into another object of the same type.
 func (in *StatefulMigrationStatus) DeepCopyInto(out *StatefulMigrationStatus) {
 	*out = *in
@@ -51,6 +488,11 @@ func (in *StatefulMigrationStatus) DeepCopyInto(out *StatefulMigrationStatus) {
 		in, out := &in.StartTime, &out.StartTime
 		*out = (*in).DeepCopy()
 	}
+	if in.CheckpointInspection != nil {
+		in, out := &in.CheckpointInspection, &out.CheckpointInspection
+		*out = new(CheckpointInspectionStatus)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.PhaseTimings != nil {
 		in, out := &in.PhaseTimings, &out.PhaseTimings
 		*out = make(map[string]string, len(*in))
@@ -72,6 +514,75 @@ func (in *StatefulMigrationStatus) DeepCopyInto(out *StatefulMigrationStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Volumes != nil {
+		in, out := &in.Volumes, &out.Volumes
+		*out = make([]VolumeStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SourcePodSpec != nil {
+		in, out := &in.SourcePodSpec, &out.SourcePodSpec
+		*out = new(corev1.PodSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]corev1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.SourceFence != nil {
+		in, out := &in.SourceFence, &out.SourceFence
+		*out = new(SourceFenceStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RestoreReadiness != nil {
+		in, out := &in.RestoreReadiness, &out.RestoreReadiness
+		*out = new(RestoreReadinessStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TrafficHandover != nil {
+		in, out := &in.TrafficHandover, &out.TrafficHandover
+		*out = new(TrafficHandoverStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OrdinalReservation != nil {
+		in, out := &in.OrdinalReservation, &out.OrdinalReservation
+		*out = new(OrdinalReservationStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StatefulSetTemplate != nil {
+		in, out := &in.StatefulSetTemplate, &out.StatefulSetTemplate
+		*out = new(StatefulSetTemplateStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Plan != nil {
+		in, out := &in.Plan, &out.Plan
+		*out = new(MigrationPlan)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.UndoneSteps != nil {
+		in, out := &in.UndoneSteps, &out.UndoneSteps
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ControlRequest != nil {
+		in, out := &in.ControlRequest, &out.ControlRequest
+		*out = new(ControlRequestStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ControlReplies != nil {
+		in, out := &in.ControlReplies, &out.ControlReplies
+		*out = make([]ControlReplyStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.RetryAttempts != nil {
+		in, out := &in.RetryAttempts, &out.RetryAttempts
+		*out = make(map[string]int32, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StatefulMigrationStatus.
@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -17,6 +18,10 @@ const (
 	PhaseFinalizing    Phase = "Finalizing"
 	PhaseCompleted     Phase = "Completed"
 	PhaseFailed        Phase = "Failed"
+	// PhasePlanned is the terminal phase of a dry-run migration.
+	PhasePlanned Phase = "Planned"
+	// PhaseAborted is the terminal phase of a migration stopped via spec.abort.
+	PhaseAborted Phase = "Aborted"
 )
 
 // MessageQueueConfig defines configuration for the message broker
@@ -31,6 +36,567 @@ type MessageQueueConfig struct {
 	RoutingKey string `json:"routingKey,omitempty"`
 }
 
+// TransferJobSpec customizes the Jobs the controller creates to move a
+// checkpoint when no ms2m-agent is available (checkpoint-transfer) and to load
+// a re-checkpoint during identity swap (ms2m-agent local-load). The same type
+// is used for the controller-wide defaults and the per-migration override;
+// fields set on the migration take precedence.
+type TransferJobSpec struct {
+	// Image is the checkpoint-transfer image.
+	// Defaults to localhost/checkpoint-transfer:latest.
+	Image string `json:"image,omitempty"`
+
+	// AgentImage is the ms2m-agent image used by the identity swap local-load Job.
+	// Defaults to localhost/ms2m-agent:latest.
+	AgentImage string `json:"agentImage,omitempty"`
+
+	// ImagePullPolicy for the Job containers. Defaults to IfNotPresent.
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// ImagePullSecrets for pulling the Job images from a private registry.
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// ServiceAccountName the Job pods run as.
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// PriorityClassName for the Job pods.
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// Resources for the Job containers.
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Tolerations let the Job pods schedule onto tainted nodes. A non-empty
+	// list on the migration replaces the controller default.
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// SecurityContext for the checkpoint-transfer container. Defaults to
+	// running as root, which is needed to read kubelet checkpoint archives.
+	// The local-load container always runs privileged.
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+
+	// CheckpointHostPath is the node directory holding checkpoint archives.
+	// Defaults to /var/lib/kubelet/checkpoints.
+	CheckpointHostPath string `json:"checkpointHostPath,omitempty"`
+
+	// InsecureRegistry pushes over plain HTTP, from the Job or the ms2m-agent.
+	// Defaults to true.
+	InsecureRegistry *bool `json:"insecureRegistry,omitempty"`
+
+	// ActiveDeadlineSeconds bounds the Job runtime; the migration fails when
+	// the Job is terminated for exceeding it.
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+
+	// BackoffLimit is the number of pod retries before the Job is marked Failed.
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+}
+
+// MigrationTimeouts bounds how long a migration may run. All values are in
+// seconds. Unset deadlines mean "no deadline"; unset tuning values fall back
+// to the built-in defaults noted on each field.
+type MigrationTimeouts struct {
+	// MigrationSeconds is the overall deadline, measured from status.startTime
+	// (or creation while still Pending).
+	MigrationSeconds int32 `json:"migrationSeconds,omitempty"`
+
+	// Per-phase deadlines, measured from when the phase was first reconciled.
+	PendingSeconds       int32 `json:"pendingSeconds,omitempty"`
+	CheckpointingSeconds int32 `json:"checkpointingSeconds,omitempty"`
+	TransferringSeconds  int32 `json:"transferringSeconds,omitempty"`
+	RestoringSeconds     int32 `json:"restoringSeconds,omitempty"`
+	ReplayingSeconds     int32 `json:"replayingSeconds,omitempty"`
+	FinalizingSeconds    int32 `json:"finalizingSeconds,omitempty"`
+
+	// SwapSubPhaseSeconds maps an identity swap sub-phase (PrepareSwap,
+	// ReCheckpoint, SwapTransfer, CreateReplacement, MiniReplay,
+	// TrafficSwitch, PreFenceDrain, ExchangeFence, ParallelDrain,
+	// FenceCutover) to its deadline.
+	SwapSubPhaseSeconds map[string]int32 `json:"swapSubPhaseSeconds,omitempty"`
+
+	// OnExpiry is what happens when a deadline passes. At a safe point the
+	// migration is rolled back as if spec.abort were set; past it, it fails
+	// as it stands.
+	// "Fail" (default): the migration moves to Failed.
+	// "Abort": the migration moves to Aborted.
+	OnExpiry string `json:"onExpiry,omitempty"`
+
+	// ReplayStallSeconds fails a Drain-mode replay whose queue depth has not
+	// decreased for this long. Default 30.
+	ReplayStallSeconds int32 `json:"replayStallSeconds,omitempty"`
+
+	// MiniReplayCutoffSeconds is the identity swap MiniReplay cutoff.
+	// Default 15.
+	MiniReplayCutoffSeconds int32 `json:"miniReplayCutoffSeconds,omitempty"`
+
+	// SourceFenceSeconds is how long a ShadowPod source pod has to cancel
+	// its consumer after STOP_CONSUMING. Default 10.
+	SourceFenceSeconds int32 `json:"sourceFenceSeconds,omitempty"`
+
+	// OnSourceFenceTimeout is what happens when the source pod nacks
+	// STOP_CONSUMING or has not stopped consuming within SourceFenceSeconds.
+	// "Fail" (default): the migration moves to Failed and the source is left
+	// running.
+	// "Delete": a standalone source pod is deleted with grace period 0,
+	// closing its connection. A source with an owner would be recreated by
+	// it, so the migration fails instead.
+	OnSourceFenceTimeout string `json:"onSourceFenceTimeout,omitempty"`
+
+	// ExchangeFence tunes the Exchange-Fence Convergence protocol.
+	ExchangeFence *ExchangeFenceTuning `json:"exchangeFence,omitempty"`
+}
+
+// ExchangeFenceTuning holds the Exchange-Fence protocol timings, in seconds.
+type ExchangeFenceTuning struct {
+	// ObservationWindowSeconds is how long PreFenceDrain samples queue rates
+	// before deciding between Exchange-Fence and Cutoff. Default 3.
+	ObservationWindowSeconds int32 `json:"observationWindowSeconds,omitempty"`
+
+	// FenceTimeThresholdSeconds is the largest estimated drain time for
+	// which the fence is attempted; above it PreFenceDrain falls back to
+	// Cutoff. Default 60.
+	FenceTimeThresholdSeconds int32 `json:"fenceTimeThresholdSeconds,omitempty"`
+
+	// ParallelDrainStallSeconds rolls the fence back when queue depths have
+	// not changed for this long. Default 30.
+	ParallelDrainStallSeconds int32 `json:"parallelDrainStallSeconds,omitempty"`
+
+	// ParallelDrainMaxSeconds rolls the fence back when ParallelDrain runs
+	// longer than this. Default 120.
+	ParallelDrainMaxSeconds int32 `json:"parallelDrainMaxSeconds,omitempty"`
+
+	// ParallelDrainPollIntervalSeconds is how often ParallelDrain polls queue
+	// depths. Default 2.
+	ParallelDrainPollIntervalSeconds int32 `json:"parallelDrainPollIntervalSeconds,omitempty"`
+}
+
+// RetryPolicy controls how transient broker, kubelet and agent errors are
+// retried. Errors classified as permanent (missing pod, rejected credentials,
+// runtime without checkpoint support) always fail the migration immediately.
+type RetryPolicy struct {
+	// MaxAttempts is how many times an operation is tried before a transient
+	// error fails the migration. It counts consecutive failures: the count
+	// is cleared once the operation succeeds. 1 disables retries. Default 5.
+	MaxAttempts int32 `json:"maxAttempts,omitempty"`
+
+	// InitialBackoffSeconds is the delay before the first retry; it doubles
+	// for every further retry. Default 1.
+	InitialBackoffSeconds int32 `json:"initialBackoffSeconds,omitempty"`
+
+	// MaxBackoffSeconds caps the delay between retries. Default 30.
+	MaxBackoffSeconds int32 `json:"maxBackoffSeconds,omitempty"`
+}
+
+// CheckpointOptions tunes the CRIU checkpoint of the migrating container.
+// Neither the kubelet checkpoint API nor the CRI checkpoint call the agent
+// uses can pass CRIU options; configure CRIU on the nodes instead (e.g.
+// /etc/criu/runc.conf).
+type CheckpointOptions struct {
+	// TimeoutSeconds bounds the checkpoint. Passed to the kubelet API's
+	// timeout parameter or to the agent's runtime call. Default: the
+	// backend's own default.
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+}
+
+// TargetCluster places the restored pod in another namespace or another
+// cluster than the source pod.
+type TargetCluster struct {
+	// KubeconfigSecretRef selects the key of a Secret in the migration's
+	// namespace that holds a kubeconfig for the target cluster. Unset means
+	// the migration's own cluster.
+	KubeconfigSecretRef *corev1.SecretKeySelector `json:"kubeconfigSecretRef,omitempty"`
+
+	// Namespace is the namespace the restored pod is created in. Default:
+	// the migration's namespace. Within the migration's own cluster, the
+	// namespace must list the migration's namespace in its
+	// migration.ms2m.io/allowed-source-namespaces annotation.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// RestorePodSpec adjusts which fields of the source pod's spec are copied to
+// the restored pod. Field names are the JSON names used in PodSpec and
+// Container (e.g. "resources", "livenessProbe", "nodeSelector").
+type RestorePodSpec struct {
+	// Include adds fields that are not copied by default: nodeSelector,
+	// affinity, topologySpreadConstraints, initContainers, hostname,
+	// subdomain, readinessGates, shareProcessNamespace, hostNetwork, hostPID
+	// and hostIPC.
+	Include []string `json:"include,omitempty"`
+
+	// Exclude removes fields that are copied by default: volumes,
+	// serviceAccountName, automountServiceAccountToken, securityContext,
+	// tolerations, priorityClassName, dnsPolicy, dnsConfig, hostAliases,
+	// runtimeClassName, terminationGracePeriodSeconds, enableServiceLinks,
+	// env, envFrom, resources, volumeMounts, volumeDevices, livenessProbe,
+	// readinessProbe, startupProbe, lifecycle, terminationMessagePath and
+	// terminationMessagePolicy.
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// ControlProtocol tunes the acknowledged control protocol between the
+// controller and the workload pods.
+type ControlProtocol struct {
+	// AckMode selects whether control messages must be acknowledged.
+	// "Required" (default): START_REPLAY, END_REPLAY and STOP_CONSUMING
+	// carry a correlation ID and the migration waits for the pod's ack
+	// before it advances. A nack fails the migration; a missing ack is
+	// retried under spec.retryPolicy.
+	// "None": messages are sent without waiting, for workloads that do not
+	// reply. Source fencing then relies on the broker's consumer count.
+	AckMode string `json:"ackMode,omitempty"`
+
+	// AckTimeoutSeconds is how long to wait for an ack before resending.
+	// Default 10.
+	AckTimeoutSeconds int32 `json:"ackTimeoutSeconds,omitempty"`
+
+	// MessageTTLSeconds expires control messages a pod has not consumed in
+	// time, so they cannot be picked up by a later migration. Default 60.
+	MessageTTLSeconds int32 `json:"messageTTLSeconds,omitempty"`
+}
+
+// RestoreReadiness selects the signal that a restored pod is ready to replay.
+type RestoreReadiness struct {
+	// Type is the readiness signal awaited before START_REPLAY is sent:
+	// "PodReady" (default): the pod's Ready condition is True.
+	// "Running": the pod phase is Running, i.e. its containers have started.
+	// "HTTP": a GET of httpPath on httpPort of the pod IP returns 2xx.
+	// "Ping": the pod acknowledges a PING control message, i.e. it is
+	// reading its control queue. Requires controlProtocol.ackMode Required.
+	Type string `json:"type,omitempty"`
+
+	// HTTPPath is the path probed by the HTTP type. Default "/".
+	HTTPPath string `json:"httpPath,omitempty"`
+
+	// HTTPPort is the container port probed by the HTTP type. Required for
+	// the HTTP type.
+	HTTPPort int32 `json:"httpPort,omitempty"`
+}
+
+// RestoreReadinessStatus records when the restored pod started and when it
+// became ready to replay.
+type RestoreReadinessStatus struct {
+	// Type is the readiness signal that was awaited.
+	Type string `json:"type,omitempty"`
+
+	// RunningAt is when the restored pod was first seen Running.
+	RunningAt *metav1.Time `json:"runningAt,omitempty"`
+
+	// ReadyAt is when the readiness signal was observed.
+	ReadyAt *metav1.Time `json:"readyAt,omitempty"`
+
+	// RestoreToReady is the time from RunningAt to ReadyAt.
+	RestoreToReady string `json:"restoreToReady,omitempty"`
+}
+
+// TrafficHandover controls how Service traffic moves from the source pod to
+// the shadow pod in ShadowPod migrations.
+type TrafficHandover struct {
+	// Mode selects the handover:
+	// "LabelFlip" (default): the shadow pod is created without the labels
+	// selected by the Services that route to the source, so it stays out of
+	// their endpoints while it replays. In Finalizing the labels are added
+	// to the shadow and, once it is listed as a ready endpoint, removed from
+	// the source before the source is deleted.
+	// "None": the shadow pod carries all source labels from the start and
+	// receives Service traffic while it replays.
+	Mode string `json:"mode,omitempty"`
+
+	// EndpointTimeoutSeconds bounds each wait for the endpoints to reflect a
+	// label change: the shadow being added and the source being removed.
+	// The handover continues when it expires. Default 10.
+	EndpointTimeoutSeconds int32 `json:"endpointTimeoutSeconds,omitempty"`
+}
+
+// TrafficHandoverStatus records the Service traffic handover from the source
+// to the shadow pod.
+type TrafficHandoverStatus struct {
+	// Services lists the Services whose selectors matched the source pod.
+	Services []string `json:"services,omitempty"`
+
+	// HeldLabels are the Service-selected labels withheld from the shadow
+	// pod until the handover.
+	HeldLabels map[string]string `json:"heldLabels,omitempty"`
+
+	// ShadowAddedAt is when the held labels were added to the shadow pod.
+	ShadowAddedAt *metav1.Time `json:"shadowAddedAt,omitempty"`
+
+	// SourceRemovedAt is when the held labels were removed from the source
+	// pod.
+	SourceRemovedAt *metav1.Time `json:"sourceRemovedAt,omitempty"`
+
+	// Switchover is the time from ShadowAddedAt until the source had left
+	// the endpoints of every Service.
+	Switchover string `json:"switchover,omitempty"`
+}
+
+// OrdinalReservationStatus records the StatefulSet ordinal held back while
+// the migrating pod is replaced. Only that ordinal is taken out of the
+// StatefulSet; every other pod keeps running.
+type OrdinalReservationStatus struct {
+	// Ordinal is the source pod's ordinal.
+	Ordinal int32 `json:"ordinal"`
+
+	// Method is how the ordinal is held: "ScaleDown" (highest ordinal, one
+	// replica fewer), "ShiftStart" (lowest ordinal, spec.ordinals.start moved
+	// past it) or "Pause" (any other ordinal, OnDelete updates and a
+	// scheduling gate that keeps a recreated pod from starting).
+	Method string `json:"method,omitempty"`
+
+	// OriginalStart is the StatefulSet's spec.ordinals.start before the
+	// hold. Set only by the ShiftStart method.
+	OriginalStart *int32 `json:"originalStart,omitempty"`
+
+	// OriginalUpdateStrategy is the StatefulSet's update strategy before the
+	// hold. Set only by the Pause method.
+	OriginalUpdateStrategy *appsv1.StatefulSetUpdateStrategy `json:"originalUpdateStrategy,omitempty"`
+
+	// ReservedAt is when the StatefulSet stopped managing the ordinal.
+	ReservedAt *metav1.Time `json:"reservedAt,omitempty"`
+
+	// ReleasedAt is when the StatefulSet was restored to manage the ordinal
+	// again, with the target pod in place.
+	ReleasedAt *metav1.Time `json:"releasedAt,omitempty"`
+
+	// FreezeWindow is the time from the source being fenced until the
+	// target pod was ready to replay. No pod consumes messages in between.
+	// Set only by the ReserveOrdinal identity swap mode.
+	FreezeWindow string `json:"freezeWindow,omitempty"`
+}
+
+// TemplateMutationStatus is one change the controller made to a StatefulSet
+// pod template.
+type TemplateMutationStatus struct {
+	// Field is the template field, e.g. "nodeSelector/kubernetes.io/hostname".
+	Field string `json:"field"`
+
+	// Original is the field's value before the change; empty when unset.
+	Original string `json:"original,omitempty"`
+
+	// Applied is the value the controller set.
+	Applied string `json:"applied,omitempty"`
+}
+
+// StatefulSetTemplateStatus records the StatefulSet pod template changes made
+// during an identity swap and how they were settled.
+type StatefulSetTemplateStatus struct {
+	// Mutations lists the template changes.
+	Mutations []TemplateMutationStatus `json:"mutations,omitempty"`
+
+	// OriginalUpdateStrategy is the StatefulSet's update strategy before the
+	// first change. The strategy is OnDelete until the changes are settled,
+	// so no pod is rolled in between.
+	OriginalUpdateStrategy *appsv1.StatefulSetUpdateStrategy `json:"originalUpdateStrategy,omitempty"`
+
+	// Placement is the spec.statefulSetPlacement the changes were settled with.
+	Placement string `json:"placement,omitempty"`
+
+	// SettledAt is when the template and update strategy were settled.
+	SettledAt *metav1.Time `json:"settledAt,omitempty"`
+}
+
+// ControlRequestStatus is a control message awaiting its reply.
+type ControlRequestStatus struct {
+	// Step names the migration step that sent the message (e.g. "Replaying").
+	Step string `json:"step"`
+
+	// Type is the control message type.
+	Type string `json:"type"`
+
+	// Pod is the pod the message was sent to.
+	Pod string `json:"pod"`
+
+	// ID is the correlation ID the reply must carry.
+	ID string `json:"id"`
+
+	// SentAt is when the message was sent.
+	SentAt *metav1.Time `json:"sentAt,omitempty"`
+}
+
+// ControlReplyStatus records a pod's reply to a control message.
+type ControlReplyStatus struct {
+	// Step names the migration step that sent the message.
+	Step string `json:"step"`
+
+	// Type is the control message type.
+	Type string `json:"type"`
+
+	// Pod is the pod that replied.
+	Pod string `json:"pod"`
+
+	// ID is the correlation ID.
+	ID string `json:"id"`
+
+	// Status is "ack" or "nack".
+	Status string `json:"status"`
+
+	// Reason explains a nack.
+	Reason string `json:"reason,omitempty"`
+
+	// RoundTrip is the time from sending the message to receiving the reply.
+	RoundTrip string `json:"roundTrip,omitempty"`
+}
+
+// VolumeStatus tracks how one of the source pod's PersistentVolumeClaims is
+// moved to the target node.
+type VolumeStatus struct {
+	// Name is the pod volume name.
+	Name string `json:"name"`
+
+	// ClaimName is the PersistentVolumeClaim backing the volume.
+	ClaimName string `json:"claimName"`
+
+	// PersistentVolume is the volume the claim was bound to on the source node.
+	PersistentVolume string `json:"persistentVolume"`
+
+	// Handling is how the volume follows the pod:
+	// "Shared": ReadWriteMany or ReadOnlyMany, usable from any node as is.
+	// "Attachable": ReadWriteOnce network or block storage, detached from the
+	// source node before the target pod is created.
+	// "Local": a local or hostPath volume whose data is copied to the target
+	// node through the ms2m-agents and rebound to a new PersistentVolume.
+	Handling string `json:"handling"`
+
+	// Path is the directory on the node backing a Local volume.
+	Path string `json:"path,omitempty"`
+
+	// TargetVolume is the PersistentVolume created on the target node for a
+	// Local volume.
+	TargetVolume string `json:"targetVolume,omitempty"`
+
+	// State is the progress of the volume move: "Detached", "Copying",
+	// "Copied" or "Rebound". Empty until the first step is done.
+	State string `json:"state,omitempty"`
+
+	// Claim is the metadata of the source claim of a Local volume, recorded
+	// before the claim is deleted and copied onto the claim that replaces it.
+	Claim *ClaimMetadata `json:"claim,omitempty"`
+}
+
+// ClaimMetadata is the metadata a rebound claim keeps from the claim it
+// replaces.
+type ClaimMetadata struct {
+	Labels          map[string]string       `json:"labels,omitempty"`
+	Annotations     map[string]string       `json:"annotations,omitempty"`
+	OwnerReferences []metav1.OwnerReference `json:"ownerReferences,omitempty"`
+}
+
+// CheckpointInspectionStatus records what the checkpoint archive says about
+// the checkpointed container and whether the target node can restore it.
+type CheckpointInspectionStatus struct {
+	// Image is the image the checkpointed container was created from.
+	Image string `json:"image,omitempty"`
+
+	// Runtime is the OCI runtime that took the checkpoint, e.g. "crun".
+	Runtime string `json:"runtime,omitempty"`
+
+	// CRIUVersion is the CRIU version that dumped the container.
+	CRIUVersion string `json:"criuVersion,omitempty"`
+
+	// RootfsDiffBytes is the size of the container's root filesystem
+	// changes carried in the checkpoint.
+	RootfsDiffBytes int64 `json:"rootfsDiffBytes,omitempty"`
+
+	// DeletedFiles counts files deleted from the image's root filesystem.
+	DeletedFiles int32 `json:"deletedFiles,omitempty"`
+
+	// SourceKernel and TargetKernel are the kernel releases of the nodes.
+	SourceKernel string `json:"sourceKernel,omitempty"`
+	TargetKernel string `json:"targetKernel,omitempty"`
+
+	// TargetRuntimeVersion is the version of Runtime on the target node, as
+	// reported by its ms2m-agent.
+	TargetRuntimeVersion string `json:"targetRuntimeVersion,omitempty"`
+
+	// TargetCRIUVersion is the CRIU version on the target node, as reported
+	// by its ms2m-agent.
+	TargetCRIUVersion string `json:"targetCRIUVersion,omitempty"`
+
+	// Problems lists why the target node cannot restore the checkpoint.
+	// The migration fails before the target pod is created if any are found.
+	Problems []string `json:"problems,omitempty"`
+
+	// SkippedReason is set when the checkpoint could not be inspected, e.g.
+	// because no ms2m-agent runs on the source node.
+	SkippedReason string `json:"skippedReason,omitempty"`
+
+	// InspectedAt is when the inspection was recorded.
+	InspectedAt *metav1.Time `json:"inspectedAt,omitempty"`
+}
+
+// SourceFenceStatus records how a ShadowPod source pod was stopped from
+// consuming the primary queue, and the window in which messages may have been
+// processed by both the source and the target.
+type SourceFenceStatus struct {
+	// Method is how the source was fenced:
+	// "StopConsuming": the source cancelled its consumer after STOP_CONSUMING.
+	// "Deleted": it did not within spec.timeouts.sourceFenceSeconds and was
+	// deleted with its consumer still attached, as allowed by
+	// spec.timeouts.onSourceFenceTimeout.
+	Method string `json:"method,omitempty"`
+
+	// CheckpointedAt is when the source pod was checkpointed.
+	CheckpointedAt *metav1.Time `json:"checkpointedAt,omitempty"`
+
+	// RequestedAt is when STOP_CONSUMING was sent.
+	RequestedAt *metav1.Time `json:"requestedAt,omitempty"`
+
+	// FencedAt is when the source was seen to have no consumer left on the
+	// primary queue.
+	FencedAt *metav1.Time `json:"fencedAt,omitempty"`
+
+	// DuplicateWindow is the time from the checkpoint to the fence. Messages
+	// the source consumed in this window were also replayed to the target.
+	DuplicateWindow string `json:"duplicateWindow,omitempty"`
+
+	// PrimaryQueueDepthAtFence is the number of messages left on the primary
+	// queue when the source was fenced. The target consumes them after
+	// END_REPLAY, although they were also routed to the replay queue.
+	PrimaryQueueDepthAtFence int32 `json:"primaryQueueDepthAtFence,omitempty"`
+}
+
+// PlanCheck is the outcome of a single dry-run pre-flight check.
+type PlanCheck struct {
+	// Name identifies the check (e.g. "SourcePod", "TargetNode", "Broker").
+	Name string `json:"name"`
+	// Status is "Passed", "Warning", "Failed" or "Skipped".
+	Status string `json:"status"`
+	// Message explains the outcome.
+	Message string `json:"message,omitempty"`
+}
+
+// MigrationPlan describes what a migration would do, as computed by a dry run.
+type MigrationPlan struct {
+	// Feasible is true when no check failed.
+	Feasible bool `json:"feasible"`
+
+	// Strategy is the migration strategy that would be used ("ShadowPod" or "Sequential").
+	Strategy string `json:"strategy,omitempty"`
+
+	// Owner is the source pod's workload controller as Kind/Name, empty for bare pods.
+	Owner string `json:"owner,omitempty"`
+
+	// SourceNode is the node the source pod runs on.
+	SourceNode string `json:"sourceNode,omitempty"`
+
+	// TargetNode is the node the pod would be restored on.
+	TargetNode string `json:"targetNode,omitempty"`
+
+	// TransferPath is how the checkpoint would be moved:
+	// "AgentRegistryPush", "RegistryJob" or "DirectJob".
+	TransferPath string `json:"transferPath,omitempty"`
+
+	// IdentitySwapPath is how pod identity would be settled during Finalizing:
+	// "None", "ExchangeFence", "Cutoff", "ReserveOrdinal", "OrdinalRelease" or
+	// "ReplicaSetAdoption".
+	IdentitySwapPath string `json:"identitySwapPath,omitempty"`
+
+	// PredictedDowntime classifies expected service interruption:
+	// "None" (shadow pod serves throughout), "Brief" (time-based cutoff
+	// during identity swap) or "Full" (source stopped until the restored pod runs).
+	PredictedDowntime string `json:"predictedDowntime,omitempty"`
+
+	// Checks lists the individual pre-flight check results.
+	Checks []PlanCheck `json:"checks,omitempty"`
+}
+
 // StatefulMigrationSpec defines the desired state of StatefulMigration
 type StatefulMigrationSpec struct {
 	// SourcePod is the name of the pod to migrate (must be in the same namespace)
@@ -40,12 +606,35 @@ type StatefulMigrationSpec struct {
 	// If empty, defaults to the first container in the source pod.
 	ContainerName string `json:"containerName,omitempty"`
 
+	// CheckpointOptions tunes the checkpoint.
+	CheckpointOptions *CheckpointOptions `json:"checkpointOptions,omitempty"`
+
 	// TargetNode is the optional node selector for the target
 	TargetNode string `json:"targetNode,omitempty"`
 
+	// TargetCluster restores the pod in another namespace or cluster. The
+	// checkpoint is pushed to a registry both clusters can pull from, and
+	// the broker must be reachable from both. Selects the CrossCluster
+	// strategy, which only moves standalone pods without persistent
+	// volumes.
+	TargetCluster *TargetCluster `json:"targetCluster,omitempty"`
+
 	// CheckpointImageRepository is the registry location to push the checkpoint image
 	CheckpointImageRepository string `json:"checkpointImageRepository,omitempty"`
 
+	// CheckpointImageRetention controls what happens to the checkpoint image
+	// in the registry once the migration completes (Registry transfer mode).
+	// "Retain" (default): leave the image in the registry.
+	// "Delete": delete the image through the registry API. The restored pod
+	// is pinned by digest with IfNotPresent pull policy, so container restarts
+	// on the same node keep working; a reschedule to another node does not.
+	CheckpointImageRetention string `json:"checkpointImageRetention,omitempty"`
+
+	// ImagePullSecrets are attached to restored pods so the checkpoint image
+	// can be pulled from a private registry. If empty, the source pod's
+	// imagePullSecrets are used.
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
 	// ReplayCutoffSeconds is the threshold in seconds to trigger the final cutoff.
 	// Used when ReplayMode is "Cutoff" (the default).
 	ReplayCutoffSeconds int32 `json:"replayCutoffSeconds,omitempty"`
@@ -55,7 +644,8 @@ type StatefulMigrationSpec struct {
 	// The secondary queue remains bound to the exchange during replay.
 	// "Drain": unbind the secondary queue from the exchange so it has a
 	// fixed message set, then wait for full drain. Fails only if the
-	// queue depth stalls (no progress for 30s).
+	// queue depth stalls (no progress for timeouts.replayStallSeconds,
+	// default 30s).
 	ReplayMode string `json:"replayMode,omitempty"`
 
 	// MessageQueueConfig contains details about the messaging system
@@ -64,6 +654,9 @@ type StatefulMigrationSpec struct {
 	// MigrationStrategy determines how to handle pod identity conflicts.
 	// "ShadowPod" creates a shadow pod alongside the source (for individual pods).
 	// "Sequential" deletes source before creating target (required for StatefulSets).
+	// "CrossCluster" restores the pod in spec.targetCluster as a shadow pod
+	// and deletes the source once the target has taken over.
+	// Other values select a strategy registered with the controller.
 	// If empty, auto-detected from ownerReferences.
 	MigrationStrategy string `json:"migrationStrategy,omitempty"`
 
@@ -72,12 +665,85 @@ type StatefulMigrationSpec struct {
 	// "Direct": POST checkpoint tar to ms2m-agent on target node via HTTP.
 	TransferMode string `json:"transferMode,omitempty"`
 
+	// TransferJob overrides the controller's transfer Job settings for this
+	// migration. Only used when the checkpoint is moved by a Job rather than
+	// the ms2m-agent fast path.
+	TransferJob *TransferJobSpec `json:"transferJob,omitempty"`
+
 	// IdentitySwapMode controls how StatefulSet identity is restored during Finalizing.
 	// "None" (default): no identity swap, shadow pod remains orphaned.
 	// "ExchangeFence": full identity swap with Exchange-Fence Convergence for
 	//   zero-gap state synchronization between shadow and replacement pods.
 	// "Cutoff": identity swap with time-based MiniReplay cutoff (15s).
+	// "ReserveOrdinal": no second checkpoint. After the checkpoint is
+	//   transferred the source is fenced, its StatefulSet ordinal is held,
+	//   and the target pod is restored under the source pod's name. The
+	//   StatefulSet adopts it in Finalizing.
 	IdentitySwapMode string `json:"identitySwapMode,omitempty"`
+
+	// DeploymentPlacement controls how a migrated Deployment pod's new node
+	// is reflected in the Deployment. In every mode the shadow pod is handed
+	// to the source pod's ReplicaSet, so the migrated replica keeps running.
+	// "None" (default): the pod template is left unchanged and no rollout
+	//   is triggered.
+	// "Preferred": a preferred node affinity term for the target node is
+	//   added to the pod template.
+	// "Required": the target node is added as a required node affinity
+	//   expression to the pod template.
+	// Preferred and Required keep any affinity already in the template, but
+	// change the template and so roll out the Deployment.
+	DeploymentPlacement string `json:"deploymentPlacement,omitempty"`
+
+	// StatefulSetPlacement controls what happens to the target node pin the
+	// identity swap writes into the StatefulSet's pod template
+	// (nodeSelector kubernetes.io/hostname). It is settled once the
+	// StatefulSet has adopted the replacement pod.
+	// "None" (default): the pin is reverted.
+	// "Preferred": the pin is replaced by a preferred node affinity term
+	//   for the target node.
+	// "Required": the pin is kept, so every ordinal runs on the target node.
+	// The replacement pod is relabelled to the settled revision and is not
+	// restarted. Preferred and Required change the template for every
+	// ordinal, so the StatefulSet rolls its other pods.
+	StatefulSetPlacement string `json:"statefulSetPlacement,omitempty"`
+
+	// DryRun validates the migration and records the plan in status.plan
+	// without checkpointing or changing any resource. The migration ends in
+	// the Planned phase.
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// Abort requests that the migration be stopped. The controller unwinds
+	// at the next safe point (any phase before Finalizing, or an identity
+	// swap sub-phase before the traffic switch) and ends in the Aborted
+	// phase. Once the swap has started switching traffic the request is
+	// deferred and the migration runs to completion.
+	Abort bool `json:"abort,omitempty"`
+
+	// Timeouts sets per-phase, per-swap-sub-phase and overall deadlines and
+	// tunes the replay and Exchange-Fence timings.
+	Timeouts *MigrationTimeouts `json:"timeouts,omitempty"`
+
+	// RetryPolicy sets how transient errors are retried before the
+	// migration fails.
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
+
+	// ControlProtocol tunes how control messages to the workload are
+	// acknowledged.
+	ControlProtocol *ControlProtocol `json:"controlProtocol,omitempty"`
+
+	// RestoreReadiness selects how the restored pod is judged ready before
+	// replay starts.
+	RestoreReadiness *RestoreReadiness `json:"restoreReadiness,omitempty"`
+
+	// TrafficHandover controls how Service traffic moves to the shadow pod
+	// in ShadowPod migrations.
+	TrafficHandover *TrafficHandover `json:"trafficHandover,omitempty"`
+
+	// RestorePodSpec adjusts which source pod fields the restored pod
+	// inherits. By default it gets the source's volumes, env, resources,
+	// probes, security context, service account, tolerations, priority class
+	// and DNS settings, but not its node selection or affinity.
+	RestorePodSpec *RestorePodSpec `json:"restorePodSpec,omitempty"`
 }
 
 // StatefulMigrationStatus defines the observed state of StatefulMigration
@@ -91,6 +757,24 @@ type StatefulMigrationStatus struct {
 	// CheckpointID is the identifier of the created checkpoint
 	CheckpointID string `json:"checkpointID,omitempty"`
 
+	// CheckpointBackend is how the last checkpoint was taken: "Kubelet"
+	// (kubelet checkpoint API) or "Agent" (ms2m-agent through the container
+	// runtime). Chosen per node by the migration.ms2m.io/checkpoint-backend
+	// label, or by the node's container runtime when unlabelled.
+	CheckpointBackend string `json:"checkpointBackend,omitempty"`
+
+	// CheckpointInspection records the inspection of the checkpoint archive
+	// and the target node's compatibility with it, done before transfer.
+	CheckpointInspection *CheckpointInspectionStatus `json:"checkpointInspection,omitempty"`
+
+	// CheckpointImage is the registry reference of the pushed checkpoint image,
+	// pinned by digest (repo@sha256:...) when the push reported one.
+	CheckpointImage string `json:"checkpointImage,omitempty"`
+
+	// ImagePullSecrets are the pull secrets resolved during Pending (from the
+	// spec or the source pod) and attached to restored pods.
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
 	// TargetPod is the name of the restored pod
 	TargetPod string `json:"targetPod,omitempty"`
 
@@ -106,13 +790,14 @@ type StatefulMigrationStatus struct {
 	// PhaseTimings records the duration of each completed phase
 	PhaseTimings map[string]string `json:"phaseTimings,omitempty"`
 
-	// StatefulSetName is the name of the owning StatefulSet (for Sequential strategy scale-down/up)
+	// StatefulSetName is the name of the owning StatefulSet (for holding and releasing the source ordinal)
 	StatefulSetName string `json:"statefulSetName,omitempty"`
 
 	// DeploymentName is the name of the owning Deployment (for ShadowPod Finalizing)
 	DeploymentName string `json:"deploymentName,omitempty"`
 
-	// OriginalReplicas is the StatefulSet's replica count before scale-down
+	// OriginalReplicas is the StatefulSet's replica count before the
+	// ordinal was held
 	OriginalReplicas int32 `json:"originalReplicas,omitempty"`
 
 	// SourcePodLabels stores the source pod's labels, captured during Pending phase
@@ -121,12 +806,70 @@ type StatefulMigrationStatus struct {
 	// SourceContainers stores the source pod's container specs for use during restore
 	SourceContainers []corev1.Container `json:"sourceContainers,omitempty"`
 
+	// Volumes lists the source pod's PersistentVolumeClaims and how each is
+	// moved to the target node.
+	Volumes []VolumeStatus `json:"volumes,omitempty"`
+
+	// VolumeSubPhase tracks the volume steps of a Sequential restore:
+	// DetachVolumes, CopyVolumes, RebindVolumes, then VolumesReady. Empty
+	// when the pod has no volumes to move.
+	VolumeSubPhase string `json:"volumeSubPhase,omitempty"`
+
+	// SourcePodSpec stores the source pod's full spec, captured during
+	// Pending, from which restored pods are built.
+	SourcePodSpec *corev1.PodSpec `json:"sourcePodSpec,omitempty"`
+
 	// SwapSubPhase tracks progress of the local identity swap for ShadowPod+StatefulSet.
 	// Empty when not performing a swap.
 	SwapSubPhase string `json:"swapSubPhase"`
 
 	// ReplacementPod is the name of the correctly-named replacement pod created during identity swap.
 	ReplacementPod string `json:"replacementPod,omitempty"`
+
+	// SourceFence records how the source pod of a ShadowPod migration was
+	// stopped from consuming before it was deleted.
+	SourceFence *SourceFenceStatus `json:"sourceFence,omitempty"`
+
+	// RestoreReadiness records the restore-to-ready latency of the target
+	// pod.
+	RestoreReadiness *RestoreReadinessStatus `json:"restoreReadiness,omitempty"`
+
+	// TrafficHandover records the Service traffic handover to the shadow pod.
+	TrafficHandover *TrafficHandoverStatus `json:"trafficHandover,omitempty"`
+
+	// OrdinalReservation records the StatefulSet ordinal held for the
+	// migrating pod by Sequential, identity swap and ReserveOrdinal.
+	OrdinalReservation *OrdinalReservationStatus `json:"ordinalReservation,omitempty"`
+
+	// StatefulSetTemplate records the StatefulSet pod template changes made
+	// by the identity swap.
+	StatefulSetTemplate *StatefulSetTemplateStatus `json:"statefulSetTemplate,omitempty"`
+
+	// ReplayQueueDepth is the last observed depth of the replay queue during
+	// the Replaying phase.
+	ReplayQueueDepth int32 `json:"replayQueueDepth,omitempty"`
+
+	// Plan is the outcome of a dry run (spec.dryRun).
+	Plan *MigrationPlan `json:"plan,omitempty"`
+
+	// UndoneSteps lists the rollback actions taken when the migration was
+	// aborted, in the order they were performed.
+	UndoneSteps []string `json:"undoneSteps,omitempty"`
+
+	// ControlRequest is the control message currently awaiting a reply.
+	ControlRequest *ControlRequestStatus `json:"controlRequest,omitempty"`
+
+	// ControlReplies lists the replies received to control messages, in
+	// order.
+	ControlReplies []ControlReplyStatus `json:"controlReplies,omitempty"`
+
+	// RetryAttempts counts the failed attempts of each operation (e.g.
+	// "broker connect", "kubelet checkpoint") that hit a transient error
+	// since it last succeeded.
+	RetryAttempts map[string]int32 `json:"retryAttempts,omitempty"`
+
+	// LastRetryError is the most recent transient error that was retried.
+	LastRetryError string `json:"lastRetryError,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -4,6 +4,8 @@ import (
 	"testing"
 	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -182,3 +184,276 @@ func TestDeepCopyNilStartTime(t *testing.T) {
 		t.Error("expected nil StartTime in copy when original is nil")
 	}
 }
+
+func TestDeepCopyTransferJobIndependence(t *testing.T) {
+	insecure := true
+	original := &StatefulMigration{
+		Spec: StatefulMigrationSpec{
+			TransferJob: &TransferJobSpec{
+				Image:            "registry.example.com/checkpoint-transfer:v1",
+				InsecureRegistry: &insecure,
+				Tolerations:      []corev1.Toleration{{Key: "dedicated"}},
+			},
+		},
+	}
+
+	copied := original.DeepCopy()
+	if copied.Spec.TransferJob == original.Spec.TransferJob {
+		t.Fatal("copied TransferJob should not share the same pointer as original")
+	}
+
+	*copied.Spec.TransferJob.InsecureRegistry = false
+	copied.Spec.TransferJob.Tolerations[0].Key = "changed"
+
+	if !*original.Spec.TransferJob.InsecureRegistry {
+		t.Error("original InsecureRegistry was mutated through the copy")
+	}
+	if original.Spec.TransferJob.Tolerations[0].Key != "dedicated" {
+		t.Error("original Tolerations were mutated through the copy")
+	}
+}
+
+func TestDeepCopyTimeoutsIndependence(t *testing.T) {
+	original := &StatefulMigration{
+		Spec: StatefulMigrationSpec{
+			Timeouts: &MigrationTimeouts{
+				SwapSubPhaseSeconds: map[string]int32{"MiniReplay": 10},
+				ExchangeFence:       &ExchangeFenceTuning{ParallelDrainMaxSeconds: 60},
+			},
+		},
+	}
+
+	copied := original.DeepCopy()
+	copied.Spec.Timeouts.SwapSubPhaseSeconds["MiniReplay"] = 20
+	copied.Spec.Timeouts.ExchangeFence.ParallelDrainMaxSeconds = 90
+
+	if original.Spec.Timeouts.SwapSubPhaseSeconds["MiniReplay"] != 10 {
+		t.Error("original SwapSubPhaseSeconds was mutated through the copy")
+	}
+	if original.Spec.Timeouts.ExchangeFence.ParallelDrainMaxSeconds != 60 {
+		t.Error("original ExchangeFence was mutated through the copy")
+	}
+}
+
+func TestDeepCopyRetryIndependence(t *testing.T) {
+	original := &StatefulMigration{
+		Spec:   StatefulMigrationSpec{RetryPolicy: &RetryPolicy{MaxAttempts: 3}},
+		Status: StatefulMigrationStatus{RetryAttempts: map[string]int32{"broker connect": 1}},
+	}
+
+	copied := original.DeepCopy()
+	copied.Spec.RetryPolicy.MaxAttempts = 10
+	copied.Status.RetryAttempts["broker connect"] = 2
+
+	if original.Spec.RetryPolicy.MaxAttempts != 3 {
+		t.Error("original RetryPolicy was mutated through the copy")
+	}
+	if original.Status.RetryAttempts["broker connect"] != 1 {
+		t.Error("original RetryAttempts was mutated through the copy")
+	}
+}
+
+func TestDeepCopySourceFenceIndependence(t *testing.T) {
+	now := metav1.Now()
+	original := &StatefulMigration{
+		Status: StatefulMigrationStatus{SourceFence: &SourceFenceStatus{Method: "StopConsuming", FencedAt: &now}},
+	}
+
+	copied := original.DeepCopy()
+	copied.Status.SourceFence.Method = "Deleted"
+	copied.Status.SourceFence.FencedAt.Time = now.Add(time.Minute)
+
+	if original.Status.SourceFence.Method != "StopConsuming" {
+		t.Error("original SourceFence was mutated through the copy")
+	}
+	if !original.Status.SourceFence.FencedAt.Equal(&now) {
+		t.Error("original SourceFence.FencedAt was mutated through the copy")
+	}
+}
+
+func TestDeepCopyControlProtocolIndependence(t *testing.T) {
+	sent := metav1.Now()
+	original := &StatefulMigration{
+		Spec: StatefulMigrationSpec{ControlProtocol: &ControlProtocol{AckMode: "Required"}},
+		Status: StatefulMigrationStatus{
+			ControlRequest: &ControlRequestStatus{Step: "Replaying", ID: "a", SentAt: &sent},
+			ControlReplies: []ControlReplyStatus{{Step: "Replaying", Status: "ack"}},
+		},
+	}
+
+	copied := original.DeepCopy()
+	copied.Spec.ControlProtocol.AckMode = "None"
+	copied.Status.ControlRequest.SentAt.Time = sent.Add(time.Minute)
+	copied.Status.ControlReplies[0].Status = "nack"
+
+	if original.Spec.ControlProtocol.AckMode != "Required" {
+		t.Error("original ControlProtocol was mutated through the copy")
+	}
+	if !original.Status.ControlRequest.SentAt.Equal(&sent) {
+		t.Error("original ControlRequest.SentAt was mutated through the copy")
+	}
+	if original.Status.ControlReplies[0].Status != "ack" {
+		t.Error("original ControlReplies was mutated through the copy")
+	}
+}
+
+func TestDeepCopyRestoreReadinessIndependence(t *testing.T) {
+	running := metav1.Now()
+	original := &StatefulMigration{
+		Spec:   StatefulMigrationSpec{RestoreReadiness: &RestoreReadiness{Type: "HTTP", HTTPPort: 8080}},
+		Status: StatefulMigrationStatus{RestoreReadiness: &RestoreReadinessStatus{Type: "HTTP", RunningAt: &running}},
+	}
+
+	copied := original.DeepCopy()
+	copied.Spec.RestoreReadiness.HTTPPort = 9090
+	copied.Status.RestoreReadiness.RunningAt.Time = running.Add(time.Minute)
+
+	if original.Spec.RestoreReadiness.HTTPPort != 8080 {
+		t.Error("original RestoreReadiness was mutated through the copy")
+	}
+	if !original.Status.RestoreReadiness.RunningAt.Equal(&running) {
+		t.Error("original RestoreReadiness.RunningAt was mutated through the copy")
+	}
+}
+
+func TestDeepCopyTrafficHandoverIndependence(t *testing.T) {
+	added := metav1.Now()
+	original := &StatefulMigration{
+		Status: StatefulMigrationStatus{TrafficHandover: &TrafficHandoverStatus{
+			Services:      []string{"consumer"},
+			HeldLabels:    map[string]string{"app": "consumer"},
+			ShadowAddedAt: &added,
+		}},
+	}
+
+	copied := original.DeepCopy()
+	copied.Status.TrafficHandover.Services[0] = "other"
+	copied.Status.TrafficHandover.HeldLabels["app"] = "other"
+	copied.Status.TrafficHandover.ShadowAddedAt.Time = added.Add(time.Minute)
+
+	th := original.Status.TrafficHandover
+	if th.Services[0] != "consumer" || th.HeldLabels["app"] != "consumer" {
+		t.Error("original TrafficHandover was mutated through the copy")
+	}
+	if !th.ShadowAddedAt.Equal(&added) {
+		t.Error("original TrafficHandover.ShadowAddedAt was mutated through the copy")
+	}
+}
+
+func TestDeepCopyOrdinalReservationIndependence(t *testing.T) {
+	start := int32(0)
+	reserved := metav1.Now()
+	original := &StatefulMigration{
+		Status: StatefulMigrationStatus{OrdinalReservation: &OrdinalReservationStatus{
+			Ordinal:       0,
+			OriginalStart: &start,
+			OriginalUpdateStrategy: &appsv1.StatefulSetUpdateStrategy{
+				Type: appsv1.RollingUpdateStatefulSetStrategyType,
+			},
+			ReservedAt: &reserved,
+		}},
+	}
+
+	copied := original.DeepCopy()
+	*copied.Status.OrdinalReservation.OriginalStart = 1
+	copied.Status.OrdinalReservation.OriginalUpdateStrategy.Type = appsv1.OnDeleteStatefulSetStrategyType
+	copied.Status.OrdinalReservation.ReservedAt.Time = reserved.Add(time.Minute)
+
+	res := original.Status.OrdinalReservation
+	if *res.OriginalStart != 0 {
+		t.Error("original OrdinalReservation.OriginalStart was mutated through the copy")
+	}
+	if res.OriginalUpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+		t.Error("original OrdinalReservation.OriginalUpdateStrategy was mutated through the copy")
+	}
+	if !res.ReservedAt.Equal(&reserved) {
+		t.Error("original OrdinalReservation.ReservedAt was mutated through the copy")
+	}
+}
+
+func TestDeepCopyStatefulSetTemplateIndependence(t *testing.T) {
+	settled := metav1.Now()
+	original := &StatefulMigration{
+		Status: StatefulMigrationStatus{StatefulSetTemplate: &StatefulSetTemplateStatus{
+			Mutations: []TemplateMutationStatus{{
+				Field:   "nodeSelector/kubernetes.io/hostname",
+				Applied: "node-2",
+			}},
+			OriginalUpdateStrategy: &appsv1.StatefulSetUpdateStrategy{
+				Type: appsv1.RollingUpdateStatefulSetStrategyType,
+			},
+			SettledAt: &settled,
+		}},
+	}
+
+	copied := original.DeepCopy()
+	copied.Status.StatefulSetTemplate.Mutations[0].Applied = "node-3"
+	copied.Status.StatefulSetTemplate.OriginalUpdateStrategy.Type = appsv1.OnDeleteStatefulSetStrategyType
+	copied.Status.StatefulSetTemplate.SettledAt.Time = settled.Add(time.Minute)
+
+	tmpl := original.Status.StatefulSetTemplate
+	if tmpl.Mutations[0].Applied != "node-2" {
+		t.Error("original StatefulSetTemplate.Mutations was mutated through the copy")
+	}
+	if tmpl.OriginalUpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+		t.Error("original StatefulSetTemplate.OriginalUpdateStrategy was mutated through the copy")
+	}
+	if !tmpl.SettledAt.Equal(&settled) {
+		t.Error("original StatefulSetTemplate.SettledAt was mutated through the copy")
+	}
+}
+
+func TestDeepCopyCheckpointOptionsIndependence(t *testing.T) {
+	original := &StatefulMigration{
+		Spec: StatefulMigrationSpec{CheckpointOptions: &CheckpointOptions{TimeoutSeconds: 30}},
+	}
+
+	copied := original.DeepCopy()
+	copied.Spec.CheckpointOptions.TimeoutSeconds = 60
+
+	if original.Spec.CheckpointOptions.TimeoutSeconds != 30 {
+		t.Error("original CheckpointOptions was mutated through the copy")
+	}
+}
+
+func TestDeepCopyCheckpointInspectionIndependence(t *testing.T) {
+	inspected := metav1.Now()
+	original := &StatefulMigration{
+		Status: StatefulMigrationStatus{CheckpointInspection: &CheckpointInspectionStatus{
+			Runtime:     "crun",
+			Problems:    []string{"target kernel is older"},
+			InspectedAt: &inspected,
+		}},
+	}
+
+	copied := original.DeepCopy()
+	copied.Status.CheckpointInspection.Runtime = "runc"
+	copied.Status.CheckpointInspection.Problems[0] = "changed"
+	copied.Status.CheckpointInspection.InspectedAt.Time = inspected.Add(time.Minute)
+
+	got := original.Status.CheckpointInspection
+	if got.Runtime != "crun" || got.Problems[0] != "target kernel is older" || !got.InspectedAt.Equal(&inspected) {
+		t.Error("original CheckpointInspection was mutated through the copy")
+	}
+}
+
+func TestDeepCopyTargetClusterIndependence(t *testing.T) {
+	original := &StatefulMigration{
+		Spec: StatefulMigrationSpec{TargetCluster: &TargetCluster{
+			KubeconfigSecretRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "cluster-b"},
+				Key:                  "kubeconfig",
+			},
+			Namespace: "apps",
+		}},
+	}
+
+	copied := original.DeepCopy()
+	copied.Spec.TargetCluster.Namespace = "other"
+	copied.Spec.TargetCluster.KubeconfigSecretRef.Name = "cluster-c"
+
+	got := original.Spec.TargetCluster
+	if got.Namespace != "apps" || got.KubeconfigSecretRef.Name != "cluster-b" {
+		t.Errorf("original TargetCluster was mutated through the copy: %+v", got)
+	}
+}
@@ -70,9 +70,30 @@ func registryTransfer(checkpointPath, imageRef, containerName string) error {
 	}
 
 	fmt.Printf("Image pushed in %s\n", time.Since(pushStart))
+
+	// Report the manifest digest through the container termination message
+	// so the controller can pin the restored pod to exactly this image.
+	digest, err := img.Digest()
+	if err != nil {
+		return fmt.Errorf("computing image digest: %w", err)
+	}
+	if err := writeTerminationMessage(digest.String()); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: could not write termination message: %v\n", err)
+	}
 	return nil
 }
 
+// writeTerminationMessage writes msg to the container termination log. The
+// path defaults to the Kubernetes default and can be overridden with
+// TERMINATION_LOG for local runs.
+func writeTerminationMessage(msg string) error {
+	path := os.Getenv("TERMINATION_LOG")
+	if path == "" {
+		path = "/dev/termination-log"
+	}
+	return os.WriteFile(path, []byte(msg), 0644)
+}
+
 // directTransfer POSTs the checkpoint tar file directly to an ms2m-agent endpoint via HTTP.
 func directTransfer(checkpointPath, targetURL, containerName string) error {
 	fmt.Printf("Direct transfer: sending %s to %s\n", checkpointPath, targetURL)
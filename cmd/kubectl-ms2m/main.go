@@ -0,0 +1,173 @@
+// kubectl-ms2m is a kubectl plugin for driving StatefulMigrations from the
+// command line. Install it anywhere on PATH and invoke it as `kubectl ms2m`.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+)
+
+const usage = `usage: kubectl ms2m <command> [flags]
+
+Commands:
+  migrate POD --to NODE   create a StatefulMigration for POD
+  status NAME             show phase progress, replay depth and timings
+  abort NAME              stop a running migration
+  history                 list migrations with their durations
+  export [FILE]           write phase timings as CSV (default stdout)
+
+Run 'kubectl ms2m <command> -h' for command flags.
+`
+
+// kubeOptions are the connection flags shared by every command.
+type kubeOptions struct {
+	kubeconfig string
+	context    string
+	namespace  string
+}
+
+func (o *kubeOptions) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file.")
+	fs.StringVar(&o.context, "context", "", "Kubeconfig context to use.")
+	fs.StringVar(&o.namespace, "namespace", "", "Namespace (defaults to the context namespace).")
+	fs.StringVar(&o.namespace, "n", "", "Shorthand for --namespace.")
+}
+
+// cli builds a cli connected to the cluster selected by the options.
+func (o *kubeOptions) cli(out io.Writer) (*cli, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = o.kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: o.context}
+	overrides.Context.Namespace = o.namespace
+	cfg := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+
+	restCfg, err := cfg.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load kubeconfig: %w", err)
+	}
+	ns, _, err := cfg.Namespace()
+	if err != nil {
+		return nil, fmt.Errorf("resolve namespace: %w", err)
+	}
+
+	scheme := runtime.NewScheme()
+	if err := migrationv1alpha1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	c, err := client.New(restCfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("create client: %w", err)
+	}
+	return &cli{client: c, namespace: ns, out: out, now: time.Now, pollInterval: 2 * time.Second}, nil
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "--help" || os.Args[1] == "help" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(1)
+	}
+	if err := run(os.Args[1], os.Args[2:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run parses the flags for cmd, connects to the cluster and executes it.
+func run(cmd string, args []string, out io.Writer) error {
+	var opts kubeOptions
+	fs := flag.NewFlagSet("kubectl ms2m "+cmd, flag.ContinueOnError)
+	opts.bind(fs)
+
+	var exec func(c *cli, positional []string) error
+	switch cmd {
+	case "migrate":
+		var m migrateOptions
+		m.bind(fs)
+		exec = func(c *cli, positional []string) error {
+			if len(positional) != 1 {
+				return fmt.Errorf("migrate takes exactly one POD argument")
+			}
+			return c.migrate(positional[0], m)
+		}
+	case "status":
+		watch := fs.Bool("watch", false, "Keep refreshing until the migration reaches a terminal phase.")
+		exec = func(c *cli, positional []string) error {
+			if len(positional) != 1 {
+				return fmt.Errorf("status takes exactly one NAME argument")
+			}
+			return c.status(positional[0], *watch)
+		}
+	case "abort":
+		exec = func(c *cli, positional []string) error {
+			if len(positional) != 1 {
+				return fmt.Errorf("abort takes exactly one NAME argument")
+			}
+			return c.abort(positional[0])
+		}
+	case "history":
+		limit := fs.Int("limit", 0, "Show at most this many migrations (0 for all).")
+		exec = func(c *cli, positional []string) error {
+			if len(positional) != 0 {
+				return fmt.Errorf("history takes no arguments")
+			}
+			return c.history(*limit)
+		}
+	case "export":
+		exec = func(c *cli, positional []string) error {
+			switch len(positional) {
+			case 0:
+				return c.export(c.out)
+			case 1:
+				f, err := os.Create(positional[0])
+				if err != nil {
+					return err
+				}
+				if err := c.export(f); err != nil {
+					f.Close()
+					return err
+				}
+				return f.Close()
+			default:
+				return fmt.Errorf("export takes at most one FILE argument")
+			}
+		}
+	default:
+		return fmt.Errorf("unknown command %q\n\n%s", cmd, usage)
+	}
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	c, err := opts.cli(out)
+	if err != nil {
+		return err
+	}
+	return exec(c, positional)
+}
+
+// parseInterspersed parses flags that may appear before or after positional
+// arguments (kubectl style), which the standard flag package does not allow.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
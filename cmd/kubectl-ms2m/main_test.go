@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+)
+
+var testNow = time.Date(2026, 1, 15, 10, 5, 0, 0, time.UTC)
+
+func newTestCLI(t *testing.T, objs ...client.Object) (*cli, *bytes.Buffer) {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := migrationv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	var out bytes.Buffer
+	return &cli{client: c, namespace: "default", out: &out, now: func() time.Time { return testNow }}, &out
+}
+
+func migrationAt(name string, phase migrationv1alpha1.Phase, start time.Time, timings map[string]string) *migrationv1alpha1.StatefulMigration {
+	st := metav1.NewTime(start)
+	return &migrationv1alpha1.StatefulMigration{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: migrationv1alpha1.StatefulMigrationSpec{
+			SourcePod:         "consumer-0",
+			TargetNode:        "worker-2",
+			MigrationStrategy: "ShadowPod",
+		},
+		Status: migrationv1alpha1.StatefulMigrationStatus{
+			Phase:        phase,
+			SourceNode:   "worker-1",
+			StartTime:    &st,
+			PhaseTimings: timings,
+		},
+	}
+}
+
+func TestParseInterspersed(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	to := fs.String("to", "", "")
+	watch := fs.Bool("watch", false, "")
+
+	positional, err := parseInterspersed(fs, []string{"consumer-0", "--to", "worker-2", "--watch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positional) != 1 || positional[0] != "consumer-0" {
+		t.Errorf("expected [consumer-0], got %v", positional)
+	}
+	if *to != "worker-2" || !*watch {
+		t.Errorf("expected flags after the positional to be parsed, got to=%q watch=%v", *to, *watch)
+	}
+}
+
+func TestMigrate_CreatesMigration(t *testing.T) {
+	c, out := newTestCLI(t)
+
+	var o migrateOptions
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	o.bind(fs)
+	if _, err := parseInterspersed(fs, []string{"--to", "worker-2", "--strategy", "Sequential", "--name", "mig-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.migrate("consumer-0", o); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "mig-1 created") {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+
+	m := &migrationv1alpha1.StatefulMigration{}
+	if err := c.client.Get(context.Background(), types.NamespacedName{Name: "mig-1", Namespace: "default"}, m); err != nil {
+		t.Fatalf("expected migration to exist: %v", err)
+	}
+	if m.Spec.SourcePod != "consumer-0" || m.Spec.TargetNode != "worker-2" || m.Spec.MigrationStrategy != "Sequential" {
+		t.Errorf("unexpected spec: %+v", m.Spec)
+	}
+	if m.Spec.MessageQueueConfig.QueueName != "app.events" || m.Spec.ReplayCutoffSeconds != 120 {
+		t.Errorf("expected eval defaults for queue and cutoff, got %+v", m.Spec)
+	}
+}
+
+func TestMigrate_CrossClusterFlags(t *testing.T) {
+	c, _ := newTestCLI(t)
+
+	var o migrateOptions
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	o.bind(fs)
+	args := []string{"--to", "worker-2", "--strategy", "CrossCluster", "--target-cluster-secret", "cluster-b", "--target-namespace", "apps", "--name", "mig-cc"}
+	if _, err := parseInterspersed(fs, args); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.migrate("consumer-0", o); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+
+	m := &migrationv1alpha1.StatefulMigration{}
+	if err := c.client.Get(context.Background(), types.NamespacedName{Name: "mig-cc", Namespace: "default"}, m); err != nil {
+		t.Fatalf("expected migration to exist: %v", err)
+	}
+	tc := m.Spec.TargetCluster
+	if tc == nil || tc.Namespace != "apps" || tc.KubeconfigSecretRef == nil ||
+		tc.KubeconfigSecretRef.Name != "cluster-b" || tc.KubeconfigSecretRef.Key != "kubeconfig" {
+		t.Errorf("unexpected targetCluster: %+v", tc)
+	}
+}
+
+func TestMigrate_RequiresTargetNode(t *testing.T) {
+	c, _ := newTestCLI(t)
+	if err := c.migrate("consumer-0", migrateOptions{}); err == nil {
+		t.Error("expected error without --to")
+	}
+}
+
+func TestStatus_RendersProgress(t *testing.T) {
+	m := migrationAt("mig-1", migrationv1alpha1.PhaseReplaying, testNow.Add(-90*time.Second), map[string]string{
+		"Checkpointing": "1.5s",
+		"Transferring":  "3s",
+		"Restoring":     "4.5s",
+	})
+	m.Status.TargetPod = "consumer-0-shadow"
+	m.Status.ReplayQueueDepth = 42
+	c, out := newTestCLI(t, m)
+
+	if err := c.status("mig-1", false); err != nil {
+		t.Fatal(err)
+	}
+	// Compare with whitespace collapsed so tabwriter padding does not matter.
+	got := strings.Join(strings.Fields(out.String()), " ")
+	for _, want := range []string{
+		"Restoring > [Replaying] > Finalizing",
+		"consumer-0-shadow on worker-2",
+		"Replay depth: 42",
+		"(1m30s ago)",
+		"Total 9s",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected status output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestAbort_RequestsAbort(t *testing.T) {
+	c, out := newTestCLI(t,
+		migrationAt("running", migrationv1alpha1.PhaseTransferring, testNow, nil),
+		migrationAt("done", migrationv1alpha1.PhaseCompleted, testNow, nil),
+	)
+
+	if err := c.abort("running"); err != nil {
+		t.Fatalf("abort failed: %v", err)
+	}
+	m := &migrationv1alpha1.StatefulMigration{}
+	if err := c.client.Get(context.Background(), types.NamespacedName{Name: "running", Namespace: "default"}, m); err != nil {
+		t.Fatalf("expected running migration to be kept: %v", err)
+	}
+	if !m.Spec.Abort {
+		t.Error("expected spec.abort to be set")
+	}
+	if !strings.Contains(out.String(), "abort requested") {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+
+	if err := c.abort("done"); err == nil {
+		t.Error("expected error aborting a completed migration")
+	}
+}
+
+func TestStatus_RendersUndoneSteps(t *testing.T) {
+	m := migrationAt("mig-1", migrationv1alpha1.PhaseAborted, testNow, nil)
+	m.Status.UndoneSteps = []string{"deleted target pod consumer-0-shadow"}
+	c, out := newTestCLI(t, m)
+
+	if err := c.status("mig-1", false); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(strings.Fields(out.String()), " ")
+	for _, want := range []string{"| [Aborted]", "Undone: - deleted target pod consumer-0-shadow"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected status output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestStatus_RendersVolumes(t *testing.T) {
+	m := migrationAt("mig-1", migrationv1alpha1.PhaseRestoring, testNow, nil)
+	m.Status.VolumeSubPhase = "CopyVolumes"
+	m.Status.Volumes = []migrationv1alpha1.VolumeStatus{{ClaimName: "data-consumer-0", Handling: "Local", State: "Copied"}}
+	c, out := newTestCLI(t, m)
+
+	if err := c.status("mig-1", false); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(strings.Fields(out.String()), " ")
+	for _, want := range []string{"Restoring (volumes: CopyVolumes)", "data-consumer-0 Local Copied"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected status output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestStatus_RendersSourceFence(t *testing.T) {
+	m := migrationAt("mig-1", migrationv1alpha1.PhaseCompleted, testNow, nil)
+	fenced := metav1.NewTime(testNow)
+	m.Status.SourceFence = &migrationv1alpha1.SourceFenceStatus{
+		Method:                   "StopConsuming",
+		FencedAt:                 &fenced,
+		DuplicateWindow:          "12.5s",
+		PrimaryQueueDepthAtFence: 3,
+	}
+	c, out := newTestCLI(t, m)
+
+	if err := c.status("mig-1", false); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(strings.Fields(out.String()), " ")
+	want := "Source fence: StopConsuming (duplicate window 12.5s, 3 left on primary queue)"
+	if !strings.Contains(got, want) {
+		t.Errorf("expected status output to contain %q, got:\n%s", want, out.String())
+	}
+}
+
+func TestStatus_RendersRestoreReadiness(t *testing.T) {
+	m := migrationAt("mig-1", migrationv1alpha1.PhaseReplaying, testNow, nil)
+	ready := metav1.NewTime(testNow)
+	m.Status.RestoreReadiness = &migrationv1alpha1.RestoreReadinessStatus{
+		Type:           "PodReady",
+		ReadyAt:        &ready,
+		RestoreToReady: "1.2s",
+	}
+	c, out := newTestCLI(t, m)
+
+	if err := c.status("mig-1", false); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(strings.Fields(out.String()), " ")
+	want := "Restore to ready: 1.2s (PodReady)"
+	if !strings.Contains(got, want) {
+		t.Errorf("expected status output to contain %q, got:\n%s", want, out.String())
+	}
+}
+
+func TestStatus_RendersTrafficSwitchover(t *testing.T) {
+	m := migrationAt("mig-1", migrationv1alpha1.PhaseCompleted, testNow, nil)
+	m.Status.TrafficHandover = &migrationv1alpha1.TrafficHandoverStatus{
+		Services:   []string{"consumer", "consumer-http"},
+		Switchover: "850ms",
+	}
+	c, out := newTestCLI(t, m)
+
+	if err := c.status("mig-1", false); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(strings.Fields(out.String()), " ")
+	want := "Traffic switchover: 850ms (consumer, consumer-http)"
+	if !strings.Contains(got, want) {
+		t.Errorf("expected status output to contain %q, got:\n%s", want, out.String())
+	}
+}
+
+func TestStatus_RendersFreezeWindow(t *testing.T) {
+	m := migrationAt("mig-1", migrationv1alpha1.PhaseCompleted, testNow, nil)
+	m.Status.OrdinalReservation = &migrationv1alpha1.OrdinalReservationStatus{
+		Ordinal:      2,
+		FreezeWindow: "4.1s",
+	}
+	c, out := newTestCLI(t, m)
+
+	if err := c.status("mig-1", false); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(strings.Fields(out.String()), " ")
+	want := "Freeze window: 4.1s (ordinal 2 reserved)"
+	if !strings.Contains(got, want) {
+		t.Errorf("expected status output to contain %q, got:\n%s", want, out.String())
+	}
+}
+
+func TestHistory_NewestFirst(t *testing.T) {
+	c, out := newTestCLI(t,
+		migrationAt("older", migrationv1alpha1.PhaseCompleted, testNow.Add(-time.Hour), map[string]string{"Checkpointing": "1s", "Finalizing": "2s"}),
+		migrationAt("newer", migrationv1alpha1.PhaseFailed, testNow, nil),
+	)
+
+	if err := c.history(0); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header + 2 rows, got:\n%s", out.String())
+	}
+	if !strings.HasPrefix(lines[1], "newer") || !strings.HasPrefix(lines[2], "older") {
+		t.Errorf("expected newest first, got:\n%s", out.String())
+	}
+	if !strings.Contains(lines[2], "3s") {
+		t.Errorf("expected summed duration 3s for older, got %q", lines[2])
+	}
+}
+
+func TestExport_MatchesCollectMetricsColumns(t *testing.T) {
+	pending := migrationAt("mig-0", "", testNow, nil)
+	pending.Status.StartTime = nil
+	c, _ := newTestCLI(t,
+		// Newer, but listed after mig-1 like kubectl get lists it.
+		migrationAt("mig-2", migrationv1alpha1.PhaseRestoring, testNow.Add(time.Minute), map[string]string{
+			"Checkpointing": "1s",
+		}),
+		migrationAt("mig-1", migrationv1alpha1.PhaseCompleted, testNow, map[string]string{
+			"Checkpointing": "1.2s",
+			"Transferring":  "3.4s",
+			"Restoring":     "5.6s",
+			"Replaying":     "7.8s",
+			"Finalizing":    "0.9s",
+		}),
+		pending,
+	)
+
+	var buf bytes.Buffer
+	if err := c.export(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "name,phase,checkpoint_s,transfer_s,restore_s,replay_s,finalize_s,start_time\n" +
+		`"mig-0",,"N/A","N/A","N/A","N/A","N/A","N/A"` + "\n" +
+		`"mig-1","Completed","1.2s","3.4s","5.6s","7.8s","0.9s","2026-01-15T10:05:00Z"` + "\n" +
+		`"mig-2","Restoring","1s","N/A","N/A","N/A","N/A","2026-01-15T10:06:00Z"` + "\n"
+	if buf.String() != want {
+		t.Errorf("unexpected CSV:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
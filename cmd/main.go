@@ -8,19 +8,24 @@ import (
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+	"github.com/haidinhtuan/kubernetes-controller/internal/checkpoint"
 	"github.com/haidinhtuan/kubernetes-controller/internal/controller"
 	"github.com/haidinhtuan/kubernetes-controller/internal/kubelet"
 	"github.com/haidinhtuan/kubernetes-controller/internal/messaging"
+	// Strategies registered through pkg/strategy are linked in with a
+	// blank import here.
 	// +kubebuilder:scaffold:imports
 )
 
@@ -40,11 +45,18 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var insecureRegistry bool
+	var transferJobConfig string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&insecureRegistry, "insecure-registry", true,
+		"Talk to the checkpoint image registry over plain HTTP when pushing from transfer Jobs or the ms2m-agent and deleting images.")
+	flag.StringVar(&transferJobConfig, "transfer-job-config", "",
+		"Path to a YAML file (e.g. a mounted ConfigMap) with default transfer Job settings. "+
+			"Uses the spec.transferJob schema; migrations can override individual fields.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -59,12 +71,28 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "a1b2c3d4.ms2m.io",
+		// Kubeconfig Secrets of target clusters and target namespaces are
+		// read directly, so the controller needs no list/watch on them.
+		Client: client.Options{Cache: &client.CacheOptions{
+			DisableFor: []client.Object{&corev1.Secret{}, &corev1.Namespace{}},
+		}},
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	var transferJob migrationv1alpha1.TransferJobSpec
+	if transferJobConfig != "" {
+		if transferJob, err = controller.LoadTransferJobConfig(transferJobConfig); err != nil {
+			setupLog.Error(err, "unable to load transfer job config")
+			os.Exit(1)
+		}
+	}
+	if transferJob.InsecureRegistry == nil {
+		transferJob.InsecureRegistry = &insecureRegistry
+	}
+
 	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
 	if err != nil {
 		setupLog.Error(err, "unable to create kubernetes clientset")
@@ -76,6 +104,8 @@ func main() {
 		Scheme:        mgr.GetScheme(),
 		KubeletClient: kubelet.NewClient(clientset),
 		MsgClient:     messaging.NewRabbitMQClient(),
+		Registry:      checkpoint.NewRegistryClient(insecureRegistry),
+		TransferJob:   transferJob,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "StatefulMigration")
 		os.Exit(1)
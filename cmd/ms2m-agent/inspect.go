@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/haidinhtuan/kubernetes-controller/internal/checkpoint"
+)
+
+// ociRuntimes are the runtimes whose versions the agent reports.
+var ociRuntimes = []string{"crun", "runc"}
+
+// nodeInspector serves checkpoint inspection and the node's restore
+// capabilities to the controller.
+type nodeInspector struct {
+	// procDir is the host's /proc; the agent runs with hostPID.
+	procDir string
+	// run executes a command on the host; replaced in tests.
+	run func(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+func newNodeInspector() *nodeInspector {
+	return &nodeInspector{procDir: "/proc", run: runOnHost}
+}
+
+// nodeInfo collects the kernel, CPU flags and the versions of the OCI
+// runtimes and CRIU installed on the node. Tools that are missing are left
+// out.
+func (n *nodeInspector) nodeInfo(ctx context.Context) checkpoint.NodeInfo {
+	info := checkpoint.NodeInfo{Architecture: runtime.GOARCH}
+	if release, err := os.ReadFile(filepath.Join(n.procDir, "sys/kernel/osrelease")); err == nil {
+		info.Kernel = strings.TrimSpace(string(release))
+	}
+	info.CPUFlags = n.cpuFlags()
+
+	for _, name := range ociRuntimes {
+		if out, err := n.run(ctx, name, "--version"); err == nil {
+			if info.Runtimes == nil {
+				info.Runtimes = map[string]string{}
+			}
+			info.Runtimes[name] = versionAfter(string(out), "version ")
+		}
+	}
+	if out, err := n.run(ctx, "criu", "--version"); err == nil {
+		info.CRIUVersion = versionAfter(string(out), "Version: ")
+	}
+	return info
+}
+
+// cpuFlags returns the flags of the first processor in /proc/cpuinfo
+// ("Features" on arm64).
+func (n *nodeInspector) cpuFlags() []string {
+	f, err := os.Open(filepath.Join(n.procDir, "cpuinfo"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		if key = strings.TrimSpace(key); key == "flags" || key == "Features" {
+			return strings.Fields(value)
+		}
+	}
+	return nil
+}
+
+// versionAfter returns the first word after marker in out, e.g. "1.21"
+// from "crun version 1.21".
+func versionAfter(out, marker string) string {
+	for _, line := range strings.Split(out, "\n") {
+		if i := strings.Index(line, marker); i >= 0 {
+			if fields := strings.Fields(line[i+len(marker):]); len(fields) > 0 {
+				return fields[0]
+			}
+		}
+	}
+	return ""
+}
+
+// handleNodeInfo handles GET /node-info requests from the controller.
+func (n *nodeInspector) handleNodeInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(n.nodeInfo(r.Context()))
+}
+
+// handleInspect handles POST /inspect requests from the controller: it
+// inspects the checkpoint archive and reports this node's NodeInfo with it.
+func (n *nodeInspector) handleInspect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req checkpoint.InspectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("decode request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Path == "" {
+		http.Error(w, "path is required", http.StatusBadRequest)
+		return
+	}
+
+	start := time.Now()
+	ins, err := checkpoint.InspectArchive(req.Path)
+	if err != nil {
+		status := http.StatusUnprocessableEntity
+		if os.IsNotExist(err) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, fmt.Sprintf("inspect: %v", err), status)
+		return
+	}
+
+	fmt.Printf("inspect of %s completed in %s: image=%s runtime=%s criu=%s\n",
+		req.Path, time.Since(start), ins.Image, ins.Runtime, ins.CRIUVersion)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(checkpoint.InspectResponse{Inspection: *ins, Node: n.nodeInfo(r.Context())})
+}
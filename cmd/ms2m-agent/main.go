@@ -14,6 +14,12 @@ import (
 	"github.com/google/go-containerregistry/pkg/crane"
 	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
 	"github.com/haidinhtuan/kubernetes-controller/internal/checkpoint"
 )
 
@@ -142,13 +148,14 @@ func localLoad(tarPath, containerName, imageTag string) error {
 }
 
 // registryPush builds an OCI image from a checkpoint tar and pushes it to a
-// container registry via crane.
-func registryPush(tarPath, containerName, imageRef string, insecure bool) error {
+// container registry via crane. It returns the manifest digest of the pushed
+// image so the caller can pin the restored pod to it.
+func registryPush(tarPath, containerName, imageRef string, insecure bool) (string, error) {
 	fmt.Printf("Registry push: building image from %s\n", tarPath)
 
 	img, err := checkpoint.BuildCheckpointImage(tarPath, containerName)
 	if err != nil {
-		return fmt.Errorf("build image: %w", err)
+		return "", fmt.Errorf("build image: %w", err)
 	}
 
 	opts := []crane.Option{crane.WithAuthFromKeychain(authn.DefaultKeychain)}
@@ -157,11 +164,16 @@ func registryPush(tarPath, containerName, imageRef string, insecure bool) error
 	}
 
 	if err := crane.Push(img, imageRef, opts...); err != nil {
-		return fmt.Errorf("push image: %w", err)
+		return "", fmt.Errorf("push image: %w", err)
 	}
 
-	fmt.Printf("Pushed image to registry: %s\n", imageRef)
-	return nil
+	digest, err := img.Digest()
+	if err != nil {
+		return "", fmt.Errorf("compute image digest: %w", err)
+	}
+
+	fmt.Printf("Pushed image to registry: %s (%s)\n", imageRef, digest)
+	return digest.String(), nil
 }
 
 // handleLocalLoad handles POST /local-load requests from the controller.
@@ -211,14 +223,35 @@ func handleRegistryPush(w http.ResponseWriter, r *http.Request) {
 	}
 
 	start := time.Now()
-	if err := registryPush(req.TarPath, req.ContainerName, req.ImageRef, req.Insecure); err != nil {
+	digest, err := registryPush(req.TarPath, req.ContainerName, req.ImageRef, req.Insecure)
+	if err != nil {
 		http.Error(w, fmt.Sprintf("registry-push: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	fmt.Printf("registry-push completed in %s\n", time.Since(start))
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "registry-push completed successfully")
+	json.NewEncoder(w).Encode(map[string]string{"digest": digest})
+}
+
+// newKubeReader returns a client for the agent's own cluster, or nil if the
+// agent runs without cluster access.
+func newKubeReader() client.Reader {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "no cluster access, volume copy disabled: %v\n", err)
+		return nil
+	}
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = migrationv1alpha1.AddToScheme(scheme)
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "no cluster access, volume copy disabled: %v\n", err)
+		return nil
+	}
+	return c
 }
 
 func main() {
@@ -251,6 +284,20 @@ func main() {
 	mux.HandleFunc("/local-load", handleLocalLoad)
 	mux.HandleFunc("/registry-push", handleRegistryPush)
 
+	// Checkpoint through the container runtime (Agent checkpoint backend)
+	mux.Handle("/runtime-checkpoint", newRuntimeCheckpointer())
+
+	// Checkpoint inspection and restore compatibility checks
+	inspector := newNodeInspector()
+	mux.HandleFunc("/inspect", inspector.handleInspect)
+	mux.HandleFunc("/node-info", inspector.handleNodeInfo)
+
+	// Local PersistentVolume copy between agents (Sequential migrations)
+	volumes := newVolumeServer(newKubeReader())
+	mux.HandleFunc("/volume-send", volumes.handleSend)
+	mux.HandleFunc("/volume-status", volumes.handleStatus)
+	mux.HandleFunc("/volume-receive", volumes.handleReceive)
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "9443"
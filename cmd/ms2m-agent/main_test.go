@@ -1,11 +1,35 @@
 package main
 
 import (
+	"archive/tar"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+	"github.com/haidinhtuan/kubernetes-controller/internal/checkpoint"
 )
 
 func TestHandleCheckpointUpload(t *testing.T) {
@@ -51,3 +75,521 @@ func TestHandleCheckpointUpload_NoFile(t *testing.T) {
 		t.Errorf("expected 400, got %d", rr.Code)
 	}
 }
+
+func TestHandleRegistryPush_ReturnsDigest(t *testing.T) {
+	reg := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer reg.Close()
+
+	tarPath := filepath.Join(t.TempDir(), "checkpoint.tar")
+	if err := os.WriteFile(tarPath, []byte("fake checkpoint data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	imageRef := strings.TrimPrefix(reg.URL, "http://") + "/checkpoints/app:checkpoint-uid"
+	body, _ := json.Marshal(map[string]interface{}{
+		"tarPath":       tarPath,
+		"containerName": "app",
+		"imageRef":      imageRef,
+		"insecure":      true,
+	})
+	req := httptest.NewRequest(http.MethodPost, "/registry-push", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+
+	handleRegistryPush(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Digest string `json:"digest"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("expected JSON response: %v", err)
+	}
+	if !strings.HasPrefix(resp.Digest, "sha256:") {
+		t.Errorf("expected sha256 digest, got %q", resp.Digest)
+	}
+}
+
+// volumeAgent returns a volume server whose volume root is root and which
+// knows migration default/mig with Local volume pv-data at root/data, plus
+// running agent pods at peers.
+func volumeAgent(t *testing.T, root string, peers ...string) *volumeServer {
+	t.Helper()
+	return volumeAgentWith(t, root, nil, peers...)
+}
+
+// volumeAgentWith is volumeAgent with extra objects in the cluster.
+func volumeAgentWith(t *testing.T, root string, extra []client.Object, peers ...string) *volumeServer {
+	t.Helper()
+	scheme := k8sruntime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = migrationv1alpha1.AddToScheme(scheme)
+	objs := []client.Object{
+		&migrationv1alpha1.StatefulMigration{
+			ObjectMeta: metav1.ObjectMeta{Name: "mig", Namespace: "default"},
+			Status: migrationv1alpha1.StatefulMigrationStatus{Volumes: []migrationv1alpha1.VolumeStatus{
+				{Name: "data", ClaimName: "data-myapp-0", PersistentVolume: "pv-data", Handling: "Local"},
+				{Name: "etc", ClaimName: "etc-myapp-0", PersistentVolume: "pv-etc", Handling: "Local"},
+			}},
+		},
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-data"},
+			Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{
+				Local: &corev1.LocalVolumeSource{Path: filepath.Join(root, "data")},
+			}},
+		},
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-etc"},
+			Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{Path: "/etc"},
+			}},
+		},
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-other"},
+			Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{
+				Local: &corev1.LocalVolumeSource{Path: filepath.Join(root, "other")},
+			}},
+		},
+	}
+	objs = append(objs, extra...)
+	for i, ip := range peers {
+		objs = append(objs, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("ms2m-agent-%d", i), Namespace: "ms2m-system", Labels: map[string]string{"app": "ms2m-agent"}},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning, PodIP: ip},
+		})
+	}
+	v := newVolumeServer(fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build())
+	v.token = "s3cret"
+	v.roots = []string{root}
+	return v
+}
+
+func volumeRequest(method, target string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	return req
+}
+
+func TestVolumeSendReceive_CopiesDirectory(t *testing.T) {
+	srcRoot, dstRoot := t.TempDir(), t.TempDir()
+	src, dst := filepath.Join(srcRoot, "data"), filepath.Join(dstRoot, "data")
+	if err := os.MkdirAll(filepath.Join(src, "db"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "db", "wal.log"), []byte("segment-1"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("db/wal.log", filepath.Join(src, "current")); err != nil {
+		t.Fatal(err)
+	}
+
+	receiver := httptest.NewServer(http.HandlerFunc(volumeAgent(t, dstRoot).handleReceive))
+	defer receiver.Close()
+	receiverURL, _ := url.Parse(receiver.URL)
+	sender := volumeAgent(t, srcRoot, receiverURL.Hostname())
+	sender.peerPort, _ = strconv.Atoi(receiverURL.Port())
+
+	body, _ := json.Marshal(map[string]string{"migration": "default/mig", "volume": "pv-data", "target": receiverURL.Hostname()})
+	rr := httptest.NewRecorder()
+	sender.handleSend(rr, volumeRequest(http.MethodPost, "/volume-send", bytes.NewReader(body)))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var status volumeCopy
+	for i := 0; i < 100; i++ {
+		rr = httptest.NewRecorder()
+		sender.handleStatus(rr, volumeRequest(http.MethodGet, "/volume-status?migration=default/mig&volume=pv-data", nil))
+		_ = json.Unmarshal(rr.Body.Bytes(), &status)
+		if status.State != copyRunning {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status.State != copySucceeded {
+		t.Fatalf("expected the copy to succeed, got %+v", status)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dst, "db", "wal.log"))
+	if err != nil || string(data) != "segment-1" {
+		t.Fatalf("expected copied file, got %q (%v)", data, err)
+	}
+	if info, err := os.Stat(filepath.Join(dst, "db", "wal.log")); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("expected mode 0640 to be preserved, got %v (%v)", info.Mode().Perm(), err)
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "current")); err != nil || link != "db/wal.log" {
+		t.Errorf("expected symlink to be preserved, got %q (%v)", link, err)
+	}
+}
+
+func TestVolumeSend_RefusesUnauthorizedRequests(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "data"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "other"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	v := volumeAgent(t, root, "10.0.0.7")
+
+	send := func(token, volume, target string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"migration": "default/mig", "volume": volume, "target": target})
+		req := httptest.NewRequest(http.MethodPost, "/volume-send", bytes.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		v.handleSend(rr, req)
+		return rr
+	}
+
+	for _, tc := range []struct {
+		name, token, volume, target string
+		code                        int
+		reason                      string
+	}{
+		{"no token", "", "pv-data", "10.0.0.7", http.StatusUnauthorized, "unauthorized"},
+		{"wrong token", "guess", "pv-data", "10.0.0.7", http.StatusUnauthorized, "unauthorized"},
+		{"volume outside the roots", "s3cret", "pv-etc", "10.0.0.7", http.StatusForbidden, "not below a volume root"},
+		{"volume of no migration", "s3cret", "pv-other", "10.0.0.7", http.StatusForbidden, "not a local volume"},
+		{"target not an agent", "s3cret", "pv-data", "169.254.169.254", http.StatusForbidden, "not an ms2m-agent pod"},
+		{"target not an IP", "s3cret", "pv-data", "http://10.0.0.7/", http.StatusBadRequest, "not an IP address"},
+	} {
+		rr := send(tc.token, tc.volume, tc.target)
+		if rr.Code != tc.code || !strings.Contains(rr.Body.String(), tc.reason) {
+			t.Errorf("%s: expected %d (%s), got %d: %s", tc.name, tc.code, tc.reason, rr.Code, rr.Body.String())
+		}
+	}
+
+	// Without a token configured the endpoints are disabled.
+	v.token = ""
+	if rr := send("", "pv-data", "10.0.0.7"); rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "disabled") {
+		t.Errorf("expected volume copy to be disabled without a token, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestVolumeReceive_RejectsEscapingEntries(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc", Mode: 0777})
+	tw.WriteHeader(&tar.Header{Name: "link/passwd", Typeflag: tar.TypeReg, Mode: 0644, Size: 1})
+	tw.Write([]byte("x"))
+	tw.Close()
+
+	v := volumeAgent(t, t.TempDir())
+	rr := httptest.NewRecorder()
+	v.handleReceive(rr, volumeRequest(http.MethodPost, "/volume-receive?migration=default/mig&volume=pv-data", &buf))
+	if rr.Code != http.StatusInternalServerError || !strings.Contains(rr.Body.String(), "below symlink") {
+		t.Errorf("expected write through symlink to be rejected, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	v.handleReceive(rr, volumeRequest(http.MethodPost, "/volume-receive?migration=default/mig&volume=pv-etc", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a volume outside the roots, got %d", rr.Code)
+	}
+}
+
+// localPV returns a local PersistentVolume at path, pinned to hostname
+// unless it is empty.
+func localPV(name, path, hostname string) *corev1.PersistentVolume {
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{
+			Local: &corev1.LocalVolumeSource{Path: path},
+		}},
+	}
+	if hostname != "" {
+		pv.Spec.NodeAffinity = &corev1.VolumeNodeAffinity{Required: &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{{
+				Key: corev1.LabelHostname, Operator: corev1.NodeSelectorOpIn, Values: []string{hostname},
+			}}}},
+		}}
+	}
+	return pv
+}
+
+// volumeTar returns a tar stream holding file with content.
+func volumeTar(file, content string) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: file, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))})
+	tw.Write([]byte(content))
+	tw.Close()
+	return &buf
+}
+
+func TestVolumeReceive_RefusesUsedPaths(t *testing.T) {
+	receive := func(v *volumeServer, body io.Reader) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		v.handleReceive(rr, volumeRequest(http.MethodPost, "/volume-receive?migration=default/mig&volume=pv-data", body))
+		return rr
+	}
+
+	// Data left at the path, e.g. by an earlier migration, is not mixed in.
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "data", "old"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if rr := receive(volumeAgent(t, root), volumeTar("new", "new")); rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "not empty") {
+		t.Errorf("expected a non-empty path to be refused, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// A volume of this node below the path, or one on an unknown node.
+	for _, pv := range []*corev1.PersistentVolume{
+		localPV("pv-neighbour", filepath.Join(t.TempDir(), "unused"), ""),
+		localPV("pv-cache", "", "node-1"),
+		localPV("pv-unpinned", "", ""),
+	} {
+		root := t.TempDir()
+		if pv.Spec.Local.Path == "" {
+			pv.Spec.Local.Path = filepath.Join(root, "data", "cache")
+		}
+		v := volumeAgentWith(t, root, []client.Object{pv})
+		v.node = "node-1"
+		rr := receive(v, volumeTar("new", "new"))
+		overlaps := strings.HasPrefix(pv.Spec.Local.Path, root)
+		if overlaps && (rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), pv.Name)) {
+			t.Errorf("%s: expected the path to be refused, got %d: %s", pv.Name, rr.Code, rr.Body.String())
+		}
+		if !overlaps && rr.Code != http.StatusOK {
+			t.Errorf("%s: expected an unrelated volume to be ignored, got %d: %s", pv.Name, rr.Code, rr.Body.String())
+		}
+	}
+
+	// The same path on another node is no conflict.
+	root = t.TempDir()
+	v := volumeAgentWith(t, root, []client.Object{localPV("pv-elsewhere", filepath.Join(root, "data"), "node-9")})
+	v.node = "node-1"
+	if rr := receive(v, volumeTar("new", "new")); rr.Code != http.StatusOK {
+		t.Errorf("expected a volume pinned to another node to be ignored, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestVolumeReceive_FailedReceiveLeavesNothing(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "first", Typeflag: tar.TypeReg, Mode: 0644, Size: 1})
+	tw.Write([]byte("x"))
+	tw.WriteHeader(&tar.Header{Name: "../escape", Typeflag: tar.TypeReg, Mode: 0644, Size: 1})
+	tw.Write([]byte("x"))
+	tw.Close()
+
+	root := t.TempDir()
+	// A directory left by an interrupted receive.
+	if err := os.MkdirAll(filepath.Join(root, ".data.receive-123", "partial"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	v := volumeAgent(t, root)
+	rr := httptest.NewRecorder()
+	v.handleReceive(rr, volumeRequest(http.MethodPost, "/volume-receive?migration=default/mig&volume=pv-data", &buf))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected the receive to fail, got %d: %s", rr.Code, rr.Body.String())
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected nothing left in the volume root, got %v", entries)
+	}
+
+	// A later receive starts from scratch.
+	rr = httptest.NewRecorder()
+	v.handleReceive(rr, volumeRequest(http.MethodPost, "/volume-receive?migration=default/mig&volume=pv-data", volumeTar("db", "fresh")))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the retry to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "data", "db")); err != nil || string(data) != "fresh" {
+		t.Errorf("expected the received file, got %q (%v)", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "data", "first")); !os.IsNotExist(err) {
+		t.Errorf("expected no file from the failed receive, got %v", err)
+	}
+}
+
+func TestVolumeDir_ResolvesSymlinksBeforeCheckingRoots(t *testing.T) {
+	root := t.TempDir()
+	// data is a symlink out of the volume root.
+	if err := os.Symlink(t.TempDir(), filepath.Join(root, "data")); err != nil {
+		t.Fatal(err)
+	}
+	v := volumeAgent(t, root)
+	if _, err := v.volumeDir(context.Background(), "default/mig", "pv-data"); err == nil || !strings.Contains(err.Error(), "not below a volume root") {
+		t.Errorf("expected a symlink out of the root to be refused, got %v", err)
+	}
+}
+
+// fakeRuntime returns a run func that answers crictl ps with id and records
+// the other commands.
+func fakeRuntime(id string, checkpointErr error, calls *[][]string) func(context.Context, string, ...string) ([]byte, error) {
+	return func(_ context.Context, name string, args ...string) ([]byte, error) {
+		*calls = append(*calls, append([]string{name}, args...))
+		if name == "crictl" && args[0] == "ps" {
+			return []byte(id), nil
+		}
+		if checkpointErr != nil {
+			return []byte(checkpointErr.Error()), checkpointErr
+		}
+		return nil, nil
+	}
+}
+
+func postRuntimeCheckpoint(c *runtimeCheckpointer, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/runtime-checkpoint", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	c.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestRuntimeCheckpoint_Crictl(t *testing.T) {
+	var calls [][]string
+	c := &runtimeCheckpointer{method: methodCrictl, dir: t.TempDir(), run: fakeRuntime("abc123\n", nil, &calls)}
+
+	rr := postRuntimeCheckpoint(c, `{"namespace":"default","pod":"myapp-0","container":"app","timeoutSeconds":90}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !strings.HasPrefix(filepath.Base(resp.Path), "checkpoint-myapp-0_default-app-") {
+		t.Errorf("unexpected archive path %q", resp.Path)
+	}
+
+	ps := strings.Join(calls[0], " ")
+	for _, want := range []string{"--name ^app$", "io.kubernetes.pod.namespace=default", "io.kubernetes.pod.name=myapp-0"} {
+		if !strings.Contains(ps, want) {
+			t.Errorf("crictl ps %q does not contain %q", ps, want)
+		}
+	}
+	want := []string{"crictl", "--timeout=90s", "checkpoint", "--export=" + resp.Path, "abc123"}
+	if strings.Join(calls[1], " ") != strings.Join(want, " ") {
+		t.Errorf("checkpoint command = %v, want %v", calls[1], want)
+	}
+}
+
+func TestRuntimeCheckpoint_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		id     string
+		err    error
+		body   string
+		want   int
+	}{
+		{"bad body", methodCrictl, "abc", nil, `{`, http.StatusBadRequest},
+		{"missing container", methodCrictl, "abc", nil, `{"namespace":"default","pod":"p"}`, http.StatusBadRequest},
+		{"no container", methodCrictl, "", nil, `{"namespace":"default","pod":"p","container":"c"}`, http.StatusInternalServerError},
+		{"unimplemented", methodCrictl, "abc", errors.New("rpc error: code = Unimplemented"), `{"namespace":"default","pod":"p","container":"c"}`, http.StatusNotImplemented},
+		{"failed", methodCrictl, "abc", errors.New("criu failed"), `{"namespace":"default","pod":"p","container":"c"}`, http.StatusInternalServerError},
+		{"unknown method", "runc", "abc", nil, `{"namespace":"default","pod":"p","container":"c"}`, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls [][]string
+			c := &runtimeCheckpointer{method: tt.method, dir: t.TempDir(), run: fakeRuntime(tt.id, tt.err, &calls)}
+			if rr := postRuntimeCheckpoint(c, tt.body); rr.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	c := &runtimeCheckpointer{method: methodCrictl}
+	rr := httptest.NewRecorder()
+	c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/runtime-checkpoint", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET, got %d", rr.Code)
+	}
+}
+
+func TestNodeInfo(t *testing.T) {
+	procDir := t.TempDir()
+	os.MkdirAll(filepath.Join(procDir, "sys/kernel"), 0755)
+	os.WriteFile(filepath.Join(procDir, "sys/kernel/osrelease"), []byte("6.8.0-45-generic\n"), 0644)
+	os.WriteFile(filepath.Join(procDir, "cpuinfo"), []byte("processor\t: 0\nflags\t\t: fpu sse4_2 avx2\n\nprocessor\t: 1\nflags\t\t: fpu\n"), 0644)
+
+	n := &nodeInspector{procDir: procDir, run: func(_ context.Context, name string, args ...string) ([]byte, error) {
+		switch name {
+		case "crun":
+			return []byte("crun version 1.21\ncommit: abc\n+SYSTEMD +CRIU"), nil
+		case "criu":
+			return []byte("Version: 4.0\n"), nil
+		}
+		return nil, errors.New("executable file not found")
+	}}
+
+	rr := httptest.NewRecorder()
+	n.handleNodeInfo(rr, httptest.NewRequest(http.MethodGet, "/node-info", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var info checkpoint.NodeInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if info.Kernel != "6.8.0-45-generic" || info.CRIUVersion != "4.0" {
+		t.Errorf("unexpected kernel/CRIU in %+v", info)
+	}
+	if strings.Join(info.CPUFlags, " ") != "fpu sse4_2 avx2" {
+		t.Errorf("expected the first processor's flags, got %v", info.CPUFlags)
+	}
+	if len(info.Runtimes) != 1 || info.Runtimes["crun"] != "1.21" {
+		t.Errorf("expected only crun 1.21, got %v", info.Runtimes)
+	}
+}
+
+func TestHandleInspect(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "checkpoint.tar")
+	f, _ := os.Create(archive)
+	tw := tar.NewWriter(f)
+	for name, content := range map[string]string{
+		"config.dump":         `{"name":"app","rootfsImageName":"redis:7","runtime":"crun"}`,
+		"checkpoint/core.img": "core",
+	} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content))})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	f.Close()
+
+	n := &nodeInspector{procDir: dir, run: func(context.Context, string, ...string) ([]byte, error) {
+		return nil, errors.New("not found")
+	}}
+	post := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		n.handleInspect(rr, httptest.NewRequest(http.MethodPost, "/inspect", strings.NewReader(body)))
+		return rr
+	}
+
+	rr := post(`{"path":"` + archive + `"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp checkpoint.InspectResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Inspection.Image != "redis:7" || resp.Inspection.Runtime != "crun" || resp.Node.Architecture == "" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	if rr := post(`{"path":"` + filepath.Join(dir, "missing.tar") + `"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing archive, got %d", rr.Code)
+	}
+	os.WriteFile(filepath.Join(dir, "empty.tar"), nil, 0644)
+	if rr := post(`{"path":"` + filepath.Join(dir, "empty.tar") + `"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for a non-checkpoint archive, got %d", rr.Code)
+	}
+	if rr := post(`{}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a path, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/haidinhtuan/kubernetes-controller/internal/checkpoint"
+)
+
+// Runtime checkpoint methods, selected with CHECKPOINT_METHOD.
+const (
+	// methodCrictl calls the CRI CheckpointContainer RPC through crictl.
+	// containerd 2.x implements it without the kubelet feature gate.
+	methodCrictl = "crictl"
+)
+
+// unsupportedRuntime are fragments of crictl errors for runtimes that
+// cannot checkpoint at all; the agent answers them with 501.
+var unsupportedRuntime = []string{"Unimplemented", "not implemented", "not supported", "criu: executable file not found"}
+
+// runtimeCheckpointer checkpoints containers through the node's container
+// runtime. Commands run in the host mount namespace, so the archive path is
+// a node path; it is written under a directory the agent mounts at the same
+// path, so /registry-push and /local-load can read it.
+type runtimeCheckpointer struct {
+	method string
+	dir    string
+	// run executes a command on the host; replaced in tests.
+	run func(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+func newRuntimeCheckpointer() *runtimeCheckpointer {
+	c := &runtimeCheckpointer{
+		method: os.Getenv("CHECKPOINT_METHOD"),
+		dir:    os.Getenv("CHECKPOINT_DIR"),
+		run:    runOnHost,
+	}
+	if c.method == "" {
+		c.method = methodCrictl
+	}
+	if c.dir == "" {
+		c.dir = "/var/lib/ms2m/checkpoints"
+	}
+	return c
+}
+
+// runOnHost runs a command in the mount namespace of the host's init
+// process. The agent runs with hostPID and privileged.
+func runOnHost(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "nsenter", append([]string{"-t", "1", "-m", "--", name}, args...)...)
+	return cmd.CombinedOutput()
+}
+
+// containerID finds the running container of namespace/pod by name.
+func (c *runtimeCheckpointer) containerID(ctx context.Context, namespace, pod, container string) (string, error) {
+	out, err := c.run(ctx, "crictl", "ps", "-q", "--state", "Running",
+		"--name", "^"+container+"$",
+		"--label", "io.kubernetes.pod.namespace="+namespace,
+		"--label", "io.kubernetes.pod.name="+pod)
+	if err != nil {
+		return "", fmt.Errorf("crictl ps: %v: %s", err, out)
+	}
+	ids := strings.Fields(string(out))
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("no running container %q in pod %s/%s", container, namespace, pod)
+	case 1:
+		return ids[0], nil
+	default:
+		return "", fmt.Errorf("%d running containers named %q in pod %s/%s", len(ids), container, namespace, pod)
+	}
+}
+
+// checkpoint checkpoints the container of req, leaving it running, and
+// returns the archive path. Archives are named like the kubelet's.
+func (c *runtimeCheckpointer) checkpoint(ctx context.Context, req checkpoint.RuntimeCheckpointRequest) (string, error) {
+	namespace, pod, container := req.Namespace, req.Pod, req.Container
+	if c.method != methodCrictl {
+		return "", fmt.Errorf("CHECKPOINT_METHOD %q must be %s", c.method, methodCrictl)
+	}
+	if req.TimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(req.TimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+
+	id, err := c.containerID(ctx, namespace, pod, container)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return "", fmt.Errorf("mkdir %s: %w", c.dir, err)
+	}
+	archive := filepath.Join(c.dir, fmt.Sprintf("checkpoint-%s_%s-%s-%s.tar",
+		pod, namespace, container, time.Now().UTC().Format(time.RFC3339)))
+
+	// crictl's own request timeout defaults to a few seconds.
+	var args []string
+	if req.TimeoutSeconds > 0 {
+		args = append(args, fmt.Sprintf("--timeout=%ds", req.TimeoutSeconds))
+	}
+	args = append(args, "checkpoint", "--export="+archive, id)
+	if out, err := c.run(ctx, "crictl", args...); err != nil {
+		return "", fmt.Errorf("crictl checkpoint: %v: %s", err, out)
+	}
+	return archive, nil
+}
+
+// unsupported reports whether err means the runtime cannot checkpoint.
+func unsupported(err error) bool {
+	for _, marker := range unsupportedRuntime {
+		if strings.Contains(err.Error(), marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP handles POST /runtime-checkpoint requests from the controller.
+func (c *runtimeCheckpointer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req checkpoint.RuntimeCheckpointRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("decode request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Namespace == "" || req.Pod == "" || req.Container == "" {
+		http.Error(w, "namespace, pod and container are required", http.StatusBadRequest)
+		return
+	}
+
+	start := time.Now()
+	path, err := c.checkpoint(r.Context(), req)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if unsupported(err) {
+			status = http.StatusNotImplemented
+		}
+		http.Error(w, fmt.Sprintf("runtime-checkpoint: %v", err), status)
+		return
+	}
+
+	fmt.Printf("runtime-checkpoint (%s) of %s/%s/%s completed in %s: %s\n",
+		c.method, req.Namespace, req.Pod, req.Container, time.Since(start), path)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(checkpoint.RuntimeCheckpointResponse{Path: path})
+}
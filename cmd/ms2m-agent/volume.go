@@ -0,0 +1,619 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+	"github.com/haidinhtuan/kubernetes-controller/internal/checkpoint"
+)
+
+// volumeCopyTimeout bounds a single volume copy to another agent.
+const volumeCopyTimeout = 30 * time.Minute
+
+// Volume copy states reported by /volume-status.
+const (
+	copyRunning   = "Running"
+	copySucceeded = "Succeeded"
+	copyFailed    = "Failed"
+)
+
+// volumeServer copies the data of local PersistentVolumes between agents
+// for Sequential migrations. Every request must carry the shared agent
+// token. Callers name a migration and one of its volumes rather than a
+// path: the directory is that volume's local path as recorded in the
+// migration's status, and it must lie under one of the volume roots the
+// agent mounts. Data is only sent to the agent pod at the given IP.
+type volumeServer struct {
+	token string
+	// roots are the node directories holding local volumes, mounted into
+	// the agent at the same paths.
+	roots []string
+	// kube reads migrations, PersistentVolumes and agent pods; nil
+	// disables volume copies.
+	kube client.Reader
+	// namespace is where the agent pods run.
+	namespace string
+	// node is the node the agent runs on; when empty, every other
+	// PersistentVolume using a received path is taken to be on this node.
+	node string
+	// peerPort is the port other agents listen on.
+	peerPort int
+	// httpClient sends volumes to other agents.
+	httpClient *http.Client
+
+	mu     sync.Mutex
+	copies map[string]*volumeCopy
+	// receiving holds the paths being received.
+	receiving map[string]bool
+}
+
+// volumeCopy is the progress of one volume-send.
+type volumeCopy struct {
+	State    string    `json:"state"`
+	Error    string    `json:"error,omitempty"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished,omitempty"`
+}
+
+func newVolumeServer(kube client.Reader) *volumeServer {
+	v := &volumeServer{
+		token:      os.Getenv("AGENT_TOKEN"),
+		kube:       kube,
+		namespace:  os.Getenv("POD_NAMESPACE"),
+		node:       os.Getenv("NODE_NAME"),
+		peerPort:   checkpoint.AgentPort,
+		httpClient: &http.Client{},
+		copies:     make(map[string]*volumeCopy),
+		receiving:  make(map[string]bool),
+	}
+	for _, root := range strings.Split(os.Getenv("VOLUME_ROOTS"), ",") {
+		if root = strings.TrimSpace(root); root != "" {
+			v.roots = append(v.roots, filepath.Clean(root))
+		}
+	}
+	if v.namespace == "" {
+		v.namespace = "ms2m-system"
+	}
+	return v
+}
+
+// authorize checks the request's bearer token. Without a configured token
+// the volume endpoints are disabled.
+func (v *volumeServer) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if v.token == "" || v.kube == nil || len(v.roots) == 0 {
+		http.Error(w, "volume copy is disabled: AGENT_TOKEN, VOLUME_ROOTS and cluster access are required", http.StatusForbidden)
+		return false
+	}
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(got), []byte(v.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// volumeDir returns the local path of volume, which must be a Local volume
+// of the migration namespace/name, after checking that it lies under one of
+// the agent's volume roots. The path need not exist yet; symlinks in the
+// part that does are resolved before the check.
+func (v *volumeServer) volumeDir(ctx context.Context, migration, volume string) (string, error) {
+	namespace, name, ok := strings.Cut(migration, "/")
+	if !ok || namespace == "" || name == "" || volume == "" {
+		return "", fmt.Errorf("migration must be namespace/name and volume must be set")
+	}
+	m := &migrationv1alpha1.StatefulMigration{}
+	if err := v.kube.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, m); err != nil {
+		return "", fmt.Errorf("get migration %s: %w", migration, err)
+	}
+	local := false
+	for _, vs := range m.Status.Volumes {
+		if vs.PersistentVolume == volume && vs.Handling == "Local" {
+			local = true
+		}
+	}
+	if !local {
+		return "", fmt.Errorf("volume %s is not a local volume of migration %s", volume, migration)
+	}
+	pv := &corev1.PersistentVolume{}
+	if err := v.kube.Get(ctx, types.NamespacedName{Name: volume}, pv); err != nil {
+		return "", fmt.Errorf("get volume %s: %w", volume, err)
+	}
+	path := volumePath(pv)
+	if path == "" {
+		return "", fmt.Errorf("volume %s is neither local nor hostPath", volume)
+	}
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("volume path %q is not absolute", path)
+	}
+	path = filepath.Clean(path)
+
+	resolved, err := resolveExisting(path)
+	if err != nil {
+		return "", err
+	}
+	for _, root := range v.roots {
+		if rootResolved, err := filepath.EvalSymlinks(root); err == nil && within(resolved, rootResolved) && resolved != rootResolved {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("volume path %s is not below a volume root (%s)", path, strings.Join(v.roots, ", "))
+}
+
+// volumePath returns the node path of a local or hostPath volume, or "".
+func volumePath(pv *corev1.PersistentVolume) string {
+	switch {
+	case pv.Spec.Local != nil:
+		return pv.Spec.Local.Path
+	case pv.Spec.HostPath != nil:
+		return pv.Spec.HostPath.Path
+	}
+	return ""
+}
+
+// pathOwner returns another PersistentVolume that may use path, or a
+// directory above or below it, on this node, or "" if there is none.
+// Volumes pinned by hostname to other nodes are ignored.
+func (v *volumeServer) pathOwner(ctx context.Context, volume, path string) (string, error) {
+	pvs := &corev1.PersistentVolumeList{}
+	if err := v.kube.List(ctx, pvs); err != nil {
+		return "", fmt.Errorf("list volumes: %w", err)
+	}
+	hostname := v.hostname(ctx)
+	for i := range pvs.Items {
+		pv := &pvs.Items[i]
+		other := volumePath(pv)
+		if pv.Name == volume || !filepath.IsAbs(other) {
+			continue
+		}
+		other = filepath.Clean(other)
+		if !within(path, other) && !within(other, path) {
+			continue
+		}
+		if hostname != "" && pinnedElsewhere(pv, hostname) {
+			continue
+		}
+		return pv.Name, nil
+	}
+	return "", nil
+}
+
+// hostname returns the kubernetes.io/hostname label of the agent's node,
+// its name if the node cannot be read, or "" if the node is unknown.
+func (v *volumeServer) hostname(ctx context.Context) string {
+	if v.node == "" {
+		return ""
+	}
+	node := &corev1.Node{}
+	if err := v.kube.Get(ctx, types.NamespacedName{Name: v.node}, node); err == nil {
+		if h := node.Labels[corev1.LabelHostname]; h != "" {
+			return h
+		}
+	}
+	return v.node
+}
+
+// pinnedElsewhere reports whether every node selector term of pv requires
+// a kubernetes.io/hostname other than hostname.
+func pinnedElsewhere(pv *corev1.PersistentVolume, hostname string) bool {
+	if pv.Spec.NodeAffinity == nil || pv.Spec.NodeAffinity.Required == nil {
+		return false
+	}
+	terms := pv.Spec.NodeAffinity.Required.NodeSelectorTerms
+	if len(terms) == 0 {
+		return false
+	}
+	for _, term := range terms {
+		pinned := false
+		for _, req := range term.MatchExpressions {
+			if req.Key == corev1.LabelHostname && req.Operator == corev1.NodeSelectorOpIn && !slices.Contains(req.Values, hostname) {
+				pinned = true
+			}
+		}
+		if !pinned {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveExisting resolves symlinks in the longest existing prefix of path
+// and appends the rest.
+func resolveExisting(path string) (string, error) {
+	rest := ""
+	for dir := path; ; dir = filepath.Dir(dir) {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) || dir == filepath.Dir(dir) {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+	}
+}
+
+// within reports whether path is dir or below it.
+func within(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
+
+// isAgent reports whether ip belongs to a running ms2m-agent pod.
+func (v *volumeServer) isAgent(ctx context.Context, ip string) (bool, error) {
+	pods := &corev1.PodList{}
+	if err := v.kube.List(ctx, pods, client.InNamespace(v.namespace), client.MatchingLabels{"app": "ms2m-agent"}); err != nil {
+		return false, fmt.Errorf("list agent pods: %w", err)
+	}
+	for _, p := range pods.Items {
+		if p.Status.Phase == corev1.PodRunning && p.Status.PodIP == ip {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// writeTar writes the contents of dir to w as a tar stream, with paths
+// relative to dir. Regular files, directories and symlinks are included;
+// sockets, devices and other special files are skipped.
+func writeTar(dir string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		var link string
+		switch {
+		case info.Mode().IsRegular(), info.IsDir():
+		case info.Mode()&os.ModeSymlink != 0:
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// extractTar unpacks a tar stream into dir, preserving modes, ownership and
+// modification times. Entries that would land outside dir, directly or
+// through a symlink unpacked earlier, are rejected.
+func extractTar(r io.Reader, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	links := make(map[string]bool)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if target != dir && !strings.HasPrefix(target, dir+string(os.PathSeparator)) {
+			return fmt.Errorf("tar entry %q escapes %s", hdr.Name, dir)
+		}
+		for parent := filepath.Dir(target); parent != dir && len(parent) > len(dir); parent = filepath.Dir(parent) {
+			if links[parent] {
+				return fmt.Errorf("tar entry %q is below symlink %s", hdr.Name, parent)
+			}
+		}
+
+		mode := os.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, mode); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			os.Remove(target)
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+			links[target] = true
+			continue
+		default:
+			continue
+		}
+		// Ownership needs root; an unprivileged agent (tests) keeps its own.
+		_ = os.Lchown(target, hdr.Uid, hdr.Gid)
+		_ = os.Chmod(target, mode)
+		_ = os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+	}
+}
+
+// receiveInto unpacks a tar stream into a fresh directory next to dir and
+// renames it to dir, which must not exist or be empty. A failed or
+// interrupted receive leaves dir untouched; directories left by earlier
+// ones are removed first.
+func receiveInto(r io.Reader, dir string) error {
+	parent, prefix := filepath.Dir(dir), "."+filepath.Base(dir)+".receive-"
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return err
+	}
+	stale, _ := filepath.Glob(filepath.Join(parent, prefix+"*"))
+	for _, path := range stale {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	tmp, err := os.MkdirTemp(parent, prefix)
+	if err != nil {
+		return err
+	}
+	err = func() error {
+		if err := extractTar(r, tmp); err != nil {
+			return err
+		}
+		if err := os.Chmod(tmp, 0755); err != nil {
+			return err
+		}
+		// Remove fails if dir gained files in the meantime.
+		if err := os.Remove(dir); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return os.Rename(tmp, dir)
+	}()
+	if err != nil {
+		os.RemoveAll(tmp)
+	}
+	return err
+}
+
+// handleSend handles POST /volume-send from the controller. It starts
+// streaming a migration's local volume to the agent at target, which
+// unpacks it at the same path, and answers 202 with the copy's status
+// without waiting for it. A copy already running or done for the volume is
+// reported instead of starting another.
+func (v *volumeServer) handleSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !v.authorize(w, r) {
+		return
+	}
+
+	var req struct {
+		Migration string `json:"migration"`
+		Volume    string `json:"volume"`
+		Target    string `json:"target"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("decode request: %v", err), http.StatusBadRequest)
+		return
+	}
+	dir, err := v.volumeDir(r.Context(), req.Migration, req.Volume)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("volume-send: %v", err), http.StatusForbidden)
+		return
+	}
+	if _, err := os.Stat(dir); err != nil {
+		http.Error(w, fmt.Sprintf("volume-send: %v", err), http.StatusNotFound)
+		return
+	}
+	if net.ParseIP(req.Target) == nil {
+		http.Error(w, fmt.Sprintf("volume-send: target %q is not an IP address", req.Target), http.StatusBadRequest)
+		return
+	}
+	agent, err := v.isAgent(r.Context(), req.Target)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("volume-send: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+	if !agent {
+		http.Error(w, fmt.Sprintf("volume-send: %s is not an ms2m-agent pod", req.Target), http.StatusForbidden)
+		return
+	}
+
+	id := req.Migration + "/" + req.Volume
+	v.mu.Lock()
+	c, exists := v.copies[id]
+	if !exists || c.State == copyFailed {
+		c = &volumeCopy{State: copyRunning, Started: time.Now()}
+		v.copies[id] = c
+		targetURL := (&url.URL{
+			Scheme:   "http",
+			Host:     net.JoinHostPort(req.Target, strconv.Itoa(v.peerPort)),
+			Path:     "/volume-receive",
+			RawQuery: url.Values{"migration": {req.Migration}, "volume": {req.Volume}}.Encode(),
+		}).String()
+		go v.send(id, dir, targetURL)
+	}
+	status := *c
+	v.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(status)
+}
+
+// send streams dir to targetURL and records the outcome of copy id.
+func (v *volumeServer) send(id, dir, targetURL string) {
+	ctx, cancel := context.WithTimeout(context.Background(), volumeCopyTimeout)
+	defer cancel()
+
+	err := func() error {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(writeTar(dir, pw))
+		}()
+		out, err := http.NewRequestWithContext(ctx, http.MethodPost, targetURL, pr)
+		if err != nil {
+			pr.CloseWithError(err)
+			return err
+		}
+		out.Header.Set("Content-Type", "application/x-tar")
+		out.Header.Set("Authorization", "Bearer "+v.token)
+		resp, err := v.httpClient.Do(out)
+		if err != nil {
+			pr.CloseWithError(err)
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			return fmt.Errorf("volume-receive returned %d: %s", resp.StatusCode, body)
+		}
+		return nil
+	}()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c := v.copies[id]
+	c.Finished = time.Now()
+	if err != nil {
+		c.State, c.Error = copyFailed, err.Error()
+		fmt.Printf("volume-send %s failed: %v\n", id, err)
+		return
+	}
+	c.State = copySucceeded
+	fmt.Printf("volume-send %s completed in %s\n", id, c.Finished.Sub(c.Started))
+}
+
+// handleStatus handles GET /volume-status?migration=...&volume=... and
+// reports the copy started by /volume-send, or 404 if this agent has none.
+func (v *volumeServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !v.authorize(w, r) {
+		return
+	}
+	id := r.URL.Query().Get("migration") + "/" + r.URL.Query().Get("volume")
+	v.mu.Lock()
+	c, ok := v.copies[id]
+	var status volumeCopy
+	if ok {
+		status = *c
+	}
+	v.mu.Unlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("no volume copy for %s", id), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleReceive handles POST /volume-receive?migration=...&volume=... from
+// another agent: it unpacks the tar stream in the body into the volume's
+// local path. The path must be empty or missing and no other volume on this
+// node may use it, so a receive never mixes with existing data.
+func (v *volumeServer) handleReceive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !v.authorize(w, r) {
+		return
+	}
+	dir, err := v.volumeDir(r.Context(), r.URL.Query().Get("migration"), r.URL.Query().Get("volume"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("volume-receive: %v", err), http.StatusForbidden)
+		return
+	}
+
+	owner, err := v.pathOwner(r.Context(), r.URL.Query().Get("volume"), dir)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("volume-receive: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+	if owner != "" {
+		http.Error(w, fmt.Sprintf("volume-receive: %s is used by volume %s", dir, owner), http.StatusConflict)
+		return
+	}
+	v.mu.Lock()
+	busy := v.receiving[dir]
+	v.receiving[dir] = true
+	v.mu.Unlock()
+	if busy {
+		http.Error(w, fmt.Sprintf("volume-receive: %s is already being received", dir), http.StatusConflict)
+		return
+	}
+	defer func() {
+		v.mu.Lock()
+		delete(v.receiving, dir)
+		v.mu.Unlock()
+	}()
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		http.Error(w, fmt.Sprintf("volume-receive: %s is not empty", dir), http.StatusConflict)
+		return
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		http.Error(w, fmt.Sprintf("volume-receive: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	start := time.Now()
+	if err := receiveInto(r.Body, dir); err != nil {
+		http.Error(w, fmt.Sprintf("volume-receive: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Printf("volume-receive %s completed in %s\n", dir, time.Since(start))
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "volume-receive completed successfully")
+}
@@ -0,0 +1,130 @@
+package checkpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/haidinhtuan/kubernetes-controller/internal/retry"
+)
+
+// Checkpointer checkpoints a running container on its node.
+type Checkpointer interface {
+	// Checkpoint checkpoints containerName in namespace/podName on nodeName
+	// with opts and returns the path of the checkpoint archive on that
+	// node's filesystem. Options a backend cannot apply are an error.
+	Checkpoint(ctx context.Context, nodeName, namespace, podName, containerName string, opts Options) (string, error)
+}
+
+// AgentPort is the port the ms2m-agent listens on.
+const AgentPort = 9443
+
+// agentCheckpointTimeout bounds a runtime checkpoint through the agent. CRIU
+// dumps of large processes take a while; the kubelet API allows as long.
+// A longer Options.Timeout extends it.
+const agentCheckpointTimeout = 2 * time.Minute
+
+// AgentCheckpointer checkpoints through the ms2m-agent on the node, which
+// talks to the container runtime directly through crictl. It works where
+// the kubelet checkpoint API does not, e.g. on containerd nodes without the
+// ContainerCheckpoint feature gate.
+type AgentCheckpointer struct {
+	// AgentIP returns the IP of the ms2m-agent pod on a node.
+	AgentIP func(ctx context.Context, nodeName string) (string, error)
+	// HTTPClient is used for agent calls; nil means http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// RuntimeCheckpointRequest is the body of the agent's /runtime-checkpoint
+// endpoint.
+type RuntimeCheckpointRequest struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	// TimeoutSeconds bounds the runtime call; zero is the runtime default.
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+}
+
+// RuntimeCheckpointResponse is the reply of the agent's /runtime-checkpoint
+// endpoint.
+type RuntimeCheckpointResponse struct {
+	// Path is the checkpoint archive on the node's filesystem.
+	Path string `json:"path"`
+}
+
+// Checkpoint asks the agent on nodeName to checkpoint the container. Agent
+// replies are classified for retry by status code; 501 means the node's
+// runtime cannot checkpoint and is permanent.
+func (a *AgentCheckpointer) Checkpoint(ctx context.Context, nodeName, namespace, podName, containerName string, opts Options) (string, error) {
+	if nodeName == "" || namespace == "" || podName == "" || containerName == "" {
+		return "", fmt.Errorf("all checkpoint parameters are required (node=%q, ns=%q, pod=%q, container=%q)",
+			nodeName, namespace, podName, containerName)
+	}
+	agentIP, err := a.AgentIP(ctx, nodeName)
+	if err != nil {
+		return "", err
+	}
+
+	body, _ := json.Marshal(RuntimeCheckpointRequest{
+		Namespace:      namespace,
+		Pod:            podName,
+		Container:      containerName,
+		TimeoutSeconds: int32(opts.Timeout / time.Second),
+	})
+	timeout := agentCheckpointTimeout
+	if opts.Timeout >= timeout {
+		timeout = opts.Timeout + 10*time.Second
+	}
+	respBody, err := callAgent(ctx, a.HTTPClient, agentIP, http.MethodPost, "/runtime-checkpoint", body, timeout)
+	if err != nil {
+		return "", fmt.Errorf("runtime checkpoint of %s/%s/%s on node %s: %w", namespace, podName, containerName, nodeName, err)
+	}
+	var out RuntimeCheckpointResponse
+	if err := json.Unmarshal(respBody, &out); err != nil {
+		return "", fmt.Errorf("parsing runtime checkpoint response: %w", err)
+	}
+	if out.Path == "" {
+		return "", fmt.Errorf("runtime checkpoint of %s/%s/%s on node %s: agent returned no archive path",
+			namespace, podName, containerName, nodeName)
+	}
+	return out.Path, nil
+}
+
+// callAgent makes a request to the ms2m-agent at agentIP and returns the
+// response body. Non-200 responses are classified for retry by status code.
+func callAgent(ctx context.Context, client *http.Client, agentIP, method, path string, body []byte, timeout time.Duration) ([]byte, error) {
+	httpCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	url := fmt.Sprintf("http://%s:%d%s", agentIP, AgentPort, path)
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(httpCtx, method, url, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, retry.Mark(fmt.Errorf("agent returned %d: %s", resp.StatusCode, bytes.TrimSpace(respBody)),
+			retry.ClassifyStatusCode(resp.StatusCode))
+	}
+	return respBody, nil
+}
@@ -0,0 +1,92 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/haidinhtuan/kubernetes-controller/internal/retry"
+)
+
+// agentServer starts handler and returns an AgentCheckpointer whose calls to
+// any agent IP reach it.
+func agentServer(t *testing.T, handler http.HandlerFunc) *AgentCheckpointer {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	addr := srv.Listener.Addr().String()
+	return &AgentCheckpointer{
+		AgentIP: func(_ context.Context, node string) (string, error) { return "10.0.0.1", nil },
+		HTTPClient: &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		}},
+	}
+}
+
+func TestAgentCheckpointer_Checkpoint(t *testing.T) {
+	var got RuntimeCheckpointRequest
+	a := agentServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/runtime-checkpoint" || r.Method != http.MethodPost {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		json.NewEncoder(w).Encode(RuntimeCheckpointResponse{Path: "/var/lib/ms2m/checkpoints/checkpoint-myapp-0.tar"})
+	})
+
+	opts := Options{Timeout: 30 * time.Second}
+	path, err := a.Checkpoint(context.Background(), "node-1", "default", "myapp-0", "app", opts)
+	if err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	if path != "/var/lib/ms2m/checkpoints/checkpoint-myapp-0.tar" {
+		t.Errorf("unexpected path %q", path)
+	}
+	want := RuntimeCheckpointRequest{
+		Namespace: "default", Pod: "myapp-0", Container: "app",
+		TimeoutSeconds: 30,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected request body %+v, want %+v", got, want)
+	}
+}
+
+func TestAgentCheckpointer_Errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		transient bool
+	}{
+		{"unsupported runtime", http.StatusNotImplemented, "rpc error: code = Unimplemented", false},
+		{"agent failure", http.StatusInternalServerError, "criu failed", true},
+		{"empty path", http.StatusOK, `{"path":""}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := agentServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+			_, err := a.Checkpoint(context.Background(), "node-1", "default", "myapp-0", "app", Options{})
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if retry.IsTransient(err) != tt.transient {
+				t.Errorf("IsTransient(%v) = %v, want %v", err, !tt.transient, tt.transient)
+			}
+		})
+	}
+
+	a := &AgentCheckpointer{}
+	if _, err := a.Checkpoint(context.Background(), "node-1", "default", "", "app", Options{}); err == nil || !strings.Contains(err.Error(), "required") {
+		t.Errorf("expected parameter error, got %v", err)
+	}
+}
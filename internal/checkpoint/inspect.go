@@ -0,0 +1,292 @@
+package checkpoint
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Files of a CRI checkpoint archive, as written by CRI-O and containerd.
+const (
+	configDumpFile   = "config.dump"
+	specDumpFile     = "spec.dump"
+	rootfsDiffFile   = "rootfs-diff.tar"
+	deletedFilesFile = "deleted.files"
+	dumpLogFile      = "dump.log"
+	criuImageDir     = "checkpoint"
+)
+
+// Inspection is what a checkpoint archive says about the checkpointed
+// container. Fields the archive does not carry are left empty.
+type Inspection struct {
+	// ContainerName is the checkpointed container's name.
+	ContainerName string `json:"containerName,omitempty"`
+	// Image is the image the container was created from.
+	Image string `json:"image,omitempty"`
+	// Runtime is the OCI runtime that took the checkpoint, e.g. "crun".
+	Runtime string `json:"runtime,omitempty"`
+	// CRIUVersion is the CRIU version that dumped the container, from
+	// dump.log.
+	CRIUVersion string `json:"criuVersion,omitempty"`
+	// RootfsDiffBytes is the size of the root filesystem changes.
+	RootfsDiffBytes int64 `json:"rootfsDiffBytes,omitempty"`
+	// DeletedFiles counts files deleted from the image's root filesystem.
+	DeletedFiles int `json:"deletedFiles,omitempty"`
+}
+
+// configDump is the part of config.dump the inspector reads.
+type configDump struct {
+	Name            string `json:"name"`
+	RootfsImageName string `json:"rootfsImageName"`
+	RootfsImageRef  string `json:"rootfsImageRef"`
+	Runtime         string `json:"runtime"`
+}
+
+// specDump is the part of spec.dump, the container's OCI runtime spec,
+// the inspector reads.
+type specDump struct {
+	Annotations map[string]string `json:"annotations"`
+}
+
+// InspectArchive inspects the checkpoint archive at path.
+func InspectArchive(path string) (*Inspection, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Inspect(f)
+}
+
+// Inspect reads a checkpoint archive from r. An archive without CRIU images
+// is an error.
+func Inspect(r io.Reader) (*Inspection, error) {
+	ins := &Inspection{}
+	var config *configDump
+	var spec *specDump
+	images := false
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading checkpoint archive: %w", err)
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		switch {
+		case name == configDumpFile:
+			config = &configDump{}
+			if err := json.NewDecoder(tr).Decode(config); err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", configDumpFile, err)
+			}
+		case name == specDumpFile:
+			spec = &specDump{}
+			if err := json.NewDecoder(tr).Decode(spec); err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", specDumpFile, err)
+			}
+		case name == rootfsDiffFile:
+			ins.RootfsDiffBytes = hdr.Size
+		case name == deletedFilesFile:
+			var deleted []string
+			if err := json.NewDecoder(tr).Decode(&deleted); err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", deletedFilesFile, err)
+			}
+			ins.DeletedFiles = len(deleted)
+		case name == dumpLogFile || name == criuImageDir+"/"+dumpLogFile:
+			ins.CRIUVersion = criuVersion(tr)
+		case name == criuImageDir || strings.HasPrefix(name, criuImageDir+"/"):
+			images = true
+		}
+	}
+	if !images {
+		return nil, errors.New("not a checkpoint archive: no CRIU images under checkpoint/")
+	}
+
+	if config != nil {
+		ins.ContainerName = config.Name
+		ins.Image = config.RootfsImageName
+		if ins.Image == "" {
+			ins.Image = config.RootfsImageRef
+		}
+		ins.Runtime = config.Runtime
+	}
+	if spec != nil {
+		if ins.ContainerName == "" {
+			ins.ContainerName = firstAnnotation(spec.Annotations, "io.kubernetes.container.name", "io.kubernetes.cri.container-name")
+		}
+		if ins.Image == "" {
+			ins.Image = firstAnnotation(spec.Annotations, "io.kubernetes.cri-o.ImageName", "io.kubernetes.cri.image-name")
+		}
+	}
+	return ins, nil
+}
+
+func firstAnnotation(annotations map[string]string, keys ...string) string {
+	for _, k := range keys {
+		if v := annotations[k]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// criuVersion finds the "Version: 3.19 (gitid ...)" line CRIU writes at the
+// top of its log.
+func criuVersion(r io.Reader) string {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.Index(line, "Version: "); i >= 0 {
+			if fields := strings.Fields(line[i+len("Version: "):]); len(fields) > 0 {
+				return fields[0]
+			}
+		}
+	}
+	return ""
+}
+
+// NodeInfo describes a node's ability to restore a checkpoint, as reported
+// by its ms2m-agent. Empty fields were not reported and are not checked.
+type NodeInfo struct {
+	// Kernel is the kernel release, e.g. "6.8.0-45-generic".
+	Kernel string `json:"kernel,omitempty"`
+	// Architecture is the CPU architecture, e.g. "amd64".
+	Architecture string `json:"architecture,omitempty"`
+	// CPUFlags are the CPU feature flags from /proc/cpuinfo. Only the
+	// user-visible ones are compared, see userVisibleCPUFlags.
+	CPUFlags []string `json:"cpuFlags,omitempty"`
+	// Runtimes maps the OCI runtimes installed on the node to their
+	// versions.
+	Runtimes map[string]string `json:"runtimes,omitempty"`
+	// CRIUVersion is the version of the node's CRIU.
+	CRIUVersion string `json:"criuVersion,omitempty"`
+}
+
+// CheckCompatibility reports why the checkpoint ins, taken on source, cannot
+// be restored on target. An empty result means no check failed.
+func CheckCompatibility(ins *Inspection, source, target NodeInfo) []string {
+	var problems []string
+	if source.Architecture != "" && target.Architecture != "" && source.Architecture != target.Architecture {
+		problems = append(problems, fmt.Sprintf("target architecture %s differs from the source's %s",
+			target.Architecture, source.Architecture))
+	}
+	if source.Kernel != "" && target.Kernel != "" && CompareVersions(target.Kernel, source.Kernel) < 0 {
+		problems = append(problems, fmt.Sprintf("target kernel %s is older than the source kernel %s",
+			target.Kernel, source.Kernel))
+	}
+	if len(source.CPUFlags) > 0 && len(target.CPUFlags) > 0 {
+		if missing := missingFlags(userVisibleFlags(source.CPUFlags), target.CPUFlags); len(missing) > 0 {
+			problems = append(problems, fmt.Sprintf("target CPU lacks flags of the source CPU: %s",
+				strings.Join(missing, ", ")))
+		}
+	}
+	if ins.Runtime != "" && target.Runtimes != nil {
+		if _, ok := target.Runtimes[ins.Runtime]; !ok {
+			problems = append(problems, fmt.Sprintf("runtime %s that took the checkpoint is not installed on the target",
+				ins.Runtime))
+		}
+	}
+	if ins.CRIUVersion != "" && target.CRIUVersion != "" && CompareVersions(target.CRIUVersion, ins.CRIUVersion) < 0 {
+		problems = append(problems, fmt.Sprintf("target CRIU %s is older than CRIU %s that took the checkpoint",
+			target.CRIUVersion, ins.CRIUVersion))
+	}
+	return problems
+}
+
+// userVisibleCPUFlags are the instruction set and xsave features that a
+// restored process may use and CRIU's default cpuinfo check compares. Flags
+// such as hypervisor, vmx or constant_tsc describe the host rather than what
+// user space can execute, and differ between otherwise compatible nodes.
+var userVisibleCPUFlags = map[string]bool{
+	"fpu": true, "mmx": true, "sse": true, "sse2": true, "pni": true, "ssse3": true,
+	"sse4_1": true, "sse4_2": true, "sse4a": true, "popcnt": true, "abm": true,
+	"avx": true, "avx2": true, "f16c": true, "fma": true, "fma4": true, "xop": true,
+	"bmi1": true, "bmi2": true, "adx": true, "movbe": true, "aes": true,
+	"pclmulqdq": true, "vaes": true, "vpclmulqdq": true, "gfni": true,
+	"sha_ni": true, "rdrand": true, "rdseed": true, "erms": true, "fsrm": true,
+	"clflushopt": true, "clwb": true, "xsave": true, "xsaveopt": true,
+	"xsavec": true, "xsaves": true, "pku": true, "ospke": true, "cx16": true,
+}
+
+// userVisibleFlags returns the flags of flags that CheckCompatibility
+// compares: userVisibleCPUFlags and the avx512 and amx families.
+func userVisibleFlags(flags []string) []string {
+	var visible []string
+	for _, f := range flags {
+		if userVisibleCPUFlags[f] || strings.HasPrefix(f, "avx512") || strings.HasPrefix(f, "amx") {
+			visible = append(visible, f)
+		}
+	}
+	return visible
+}
+
+// missingFlags returns the flags of want that have does not, sorted.
+func missingFlags(want, have []string) []string {
+	present := make(map[string]bool, len(have))
+	for _, f := range have {
+		present[f] = true
+	}
+	var missing []string
+	for _, f := range want {
+		if !present[f] {
+			missing = append(missing, f)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// CompareVersions compares the leading dotted numbers of two version
+// strings, e.g. "6.8.0-45-generic" and "6.1", returning -1, 0 or 1. A
+// missing component counts as zero.
+func CompareVersions(a, b string) int {
+	pa, pb := versionNumbers(a), versionNumbers(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionNumbers parses the leading "1.2.3" of v, ignoring a "v" prefix.
+func versionNumbers(v string) []int {
+	v = strings.TrimPrefix(v, "v")
+	var nums []int
+	for _, part := range strings.Split(v, ".") {
+		end := 0
+		for end < len(part) && part[end] >= '0' && part[end] <= '9' {
+			end++
+		}
+		if end == 0 {
+			break
+		}
+		n, _ := strconv.Atoi(part[:end])
+		nums = append(nums, n)
+		if end < len(part) {
+			break
+		}
+	}
+	return nums
+}
@@ -0,0 +1,177 @@
+package checkpoint
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// checkpointArchive builds a checkpoint archive from name -> content.
+func checkpointArchive(t *testing.T, files map[string]string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestInspect_CRIArchive(t *testing.T) {
+	archive := checkpointArchive(t, map[string]string{
+		"config.dump":            `{"id":"abc","name":"app","rootfsImageName":"docker.io/library/redis:7","runtime":"crun"}`,
+		"spec.dump":              `{"ociVersion":"1.0.0","annotations":{"io.kubernetes.container.name":"app"}}`,
+		"rootfs-diff.tar":        strings.Repeat("x", 2048),
+		"deleted.files":          `["/tmp/a","/tmp/b"]`,
+		"dump.log":               "(00.000000) Version: 3.19 (gitid v3.19)\n(00.000001) Running on node-1\n",
+		"checkpoint/pages-1.img": "pages",
+	})
+
+	ins, err := Inspect(archive)
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	want := &Inspection{
+		ContainerName:   "app",
+		Image:           "docker.io/library/redis:7",
+		Runtime:         "crun",
+		CRIUVersion:     "3.19",
+		RootfsDiffBytes: 2048,
+		DeletedFiles:    2,
+	}
+	if !reflect.DeepEqual(ins, want) {
+		t.Errorf("Inspect() = %+v, want %+v", ins, want)
+	}
+}
+
+func TestInspect_SpecFallbackAndBareImages(t *testing.T) {
+	// containerd's spec annotations, no config.dump.
+	ins, err := Inspect(checkpointArchive(t, map[string]string{
+		"spec.dump":                 `{"annotations":{"io.kubernetes.cri.container-name":"app","io.kubernetes.cri.image-name":"redis:7"}}`,
+		"checkpoint/inventory.img":  "inv",
+		"checkpoint/dump.log":       "Version: 4.0\n",
+		"checkpoint/core-1.img":     "core",
+		"checkpoint/descriptors.js": "",
+	}))
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if ins.ContainerName != "app" || ins.Image != "redis:7" || ins.CRIUVersion != "4.0" || ins.Runtime != "" {
+		t.Errorf("unexpected inspection %+v", ins)
+	}
+
+	if _, err := Inspect(checkpointArchive(t, map[string]string{"config.dump": `{}`})); err == nil {
+		t.Error("expected error for an archive without CRIU images")
+	}
+	if _, err := Inspect(checkpointArchive(t, map[string]string{"config.dump": `{`, "checkpoint/x": ""})); err == nil {
+		t.Error("expected error for a corrupt config.dump")
+	}
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	ins := &Inspection{Runtime: "crun", CRIUVersion: "3.19"}
+	source := NodeInfo{Kernel: "6.8.0-45-generic", Architecture: "amd64", CPUFlags: []string{"sse4_2", "avx2", "avx512f", "hypervisor", "vmx", "constant_tsc"}}
+	compatible := NodeInfo{
+		Kernel:       "6.8.12",
+		Architecture: "amd64",
+		CPUFlags:     []string{"sse4_2", "avx2", "avx512f", "amx"},
+		Runtimes:     map[string]string{"crun": "1.21", "runc": "1.2.0"},
+		CRIUVersion:  "4.0",
+	}
+
+	if problems := CheckCompatibility(ins, source, compatible); len(problems) != 0 {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+	// Nothing reported by the target: nothing to check.
+	if problems := CheckCompatibility(ins, source, NodeInfo{}); len(problems) != 0 {
+		t.Errorf("expected no problems for an unreported target, got %v", problems)
+	}
+
+	incompatible := NodeInfo{
+		Kernel:       "5.15.0",
+		Architecture: "arm64",
+		CPUFlags:     []string{"sse4_2"},
+		Runtimes:     map[string]string{"runc": "1.2.0"},
+		CRIUVersion:  "3.17.1",
+	}
+	problems := CheckCompatibility(ins, source, incompatible)
+	if len(problems) != 5 {
+		t.Fatalf("expected 5 problems, got %d: %v", len(problems), problems)
+	}
+	for i, want := range []string{"architecture", "kernel 5.15.0", "avx2, avx512f", "runtime crun", "CRIU 3.17.1"} {
+		if !strings.Contains(problems[i], want) {
+			t.Errorf("problem %d %q does not mention %q", i, problems[i], want)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"6.8.0-45-generic", "6.1", 1},
+		{"5.15.0", "5.15", 0},
+		{"3.17.1", "3.19", -1},
+		{"v1.21", "1.21.0", 0},
+		{"1.19", "1.2", 1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestAgentInspector(t *testing.T) {
+	var got InspectRequest
+	a := agentServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/inspect":
+			json.NewDecoder(r.Body).Decode(&got)
+			json.NewEncoder(w).Encode(InspectResponse{
+				Inspection: Inspection{Runtime: "crun"},
+				Node:       NodeInfo{Kernel: "6.8.0"},
+			})
+		case "/node-info":
+			if r.Method != http.MethodGet {
+				t.Errorf("expected GET /node-info, got %s", r.Method)
+			}
+			json.NewEncoder(w).Encode(NodeInfo{Kernel: "6.9.0", CRIUVersion: "4.0"})
+		}
+	})
+	ai := &AgentInspector{AgentIP: a.AgentIP, HTTPClient: a.HTTPClient}
+
+	ins, node, err := ai.Inspect(context.Background(), "node-1", "/var/lib/kubelet/checkpoints/c.tar")
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if got.Path != "/var/lib/kubelet/checkpoints/c.tar" || ins.Runtime != "crun" || node.Kernel != "6.8.0" {
+		t.Errorf("unexpected inspect round trip: request %+v, inspection %+v, node %+v", got, ins, node)
+	}
+
+	info, err := ai.NodeInfo(context.Background(), "node-2")
+	if err != nil {
+		t.Fatalf("NodeInfo failed: %v", err)
+	}
+	if info.Kernel != "6.9.0" || info.CRIUVersion != "4.0" {
+		t.Errorf("unexpected node info %+v", info)
+	}
+
+	noAgent := &AgentInspector{AgentIP: func(context.Context, string) (string, error) { return "", ErrNoAgent }}
+	if _, err := noAgent.NodeInfo(context.Background(), "node-2"); !errors.Is(err, ErrNoAgent) {
+		t.Errorf("expected ErrNoAgent, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrNoAgent is returned, wrapped, by an AgentIP func when no ms2m-agent
+// runs on the node. Callers skip inspection instead of failing.
+var ErrNoAgent = errors.New("no ms2m-agent on node")
+
+// Inspector inspects a checkpoint archive on the node it was taken on and
+// reports what nodes can restore.
+type Inspector interface {
+	// Inspect inspects the archive at archivePath on nodeName and returns
+	// it with nodeName's NodeInfo.
+	Inspect(ctx context.Context, nodeName, archivePath string) (*Inspection, *NodeInfo, error)
+	// NodeInfo returns nodeName's NodeInfo.
+	NodeInfo(ctx context.Context, nodeName string) (*NodeInfo, error)
+}
+
+// agentInspectTimeout bounds an inspection. The agent reads the whole
+// archive, which for large checkpoints is mostly the CRIU pages.
+const agentInspectTimeout = 60 * time.Second
+
+// InspectRequest is the body of the agent's /inspect endpoint.
+type InspectRequest struct {
+	// Path is the checkpoint archive on the node's filesystem.
+	Path string `json:"path"`
+}
+
+// InspectResponse is the reply of the agent's /inspect endpoint.
+type InspectResponse struct {
+	Inspection Inspection `json:"inspection"`
+	Node       NodeInfo   `json:"node"`
+}
+
+// AgentInspector inspects through the ms2m-agents on the nodes.
+type AgentInspector struct {
+	// AgentIP returns the IP of the ms2m-agent pod on a node, or an error
+	// wrapping ErrNoAgent.
+	AgentIP func(ctx context.Context, nodeName string) (string, error)
+	// HTTPClient is used for agent calls; nil means http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Inspect asks the agent on nodeName to inspect the archive.
+func (a *AgentInspector) Inspect(ctx context.Context, nodeName, archivePath string) (*Inspection, *NodeInfo, error) {
+	agentIP, err := a.AgentIP(ctx, nodeName)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, _ := json.Marshal(InspectRequest{Path: archivePath})
+	respBody, err := callAgent(ctx, a.HTTPClient, agentIP, http.MethodPost, "/inspect", body, agentInspectTimeout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("inspect %s on node %s: %w", archivePath, nodeName, err)
+	}
+	var out InspectResponse
+	if err := json.Unmarshal(respBody, &out); err != nil {
+		return nil, nil, fmt.Errorf("parsing inspect response: %w", err)
+	}
+	return &out.Inspection, &out.Node, nil
+}
+
+// NodeInfo asks the agent on nodeName for its NodeInfo.
+func (a *AgentInspector) NodeInfo(ctx context.Context, nodeName string) (*NodeInfo, error) {
+	agentIP, err := a.AgentIP(ctx, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := callAgent(ctx, a.HTTPClient, agentIP, http.MethodGet, "/node-info", nil, agentInspectTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("node info of %s: %w", nodeName, err)
+	}
+	var out NodeInfo
+	if err := json.Unmarshal(respBody, &out); err != nil {
+		return nil, fmt.Errorf("parsing node info response: %w", err)
+	}
+	return &out, nil
+}
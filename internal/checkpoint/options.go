@@ -0,0 +1,9 @@
+package checkpoint
+
+import "time"
+
+// Options tune a checkpoint.
+type Options struct {
+	// Timeout bounds the checkpoint; zero leaves the backend's default.
+	Timeout time.Duration
+}
@@ -0,0 +1,100 @@
+package checkpoint
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// RegistryClient manages the lifecycle of checkpoint images stored in a
+// container registry.
+type RegistryClient interface {
+	// DeleteImage removes the manifest referenced by imageRef from the
+	// registry. imageRef may be a tag or a digest reference.
+	DeleteImage(ctx context.Context, imageRef string) error
+
+	// CheckPushAccess verifies that the caller's credentials may push to
+	// the repository of imageRef, without uploading any content.
+	CheckPushAccess(ctx context.Context, imageRef string) error
+}
+
+// CraneRegistryClient implements RegistryClient with go-containerregistry,
+// authenticating through the default keychain (docker config, credential
+// helpers).
+type CraneRegistryClient struct {
+	Insecure bool
+}
+
+// NewRegistryClient returns a RegistryClient. Set insecure for plain-HTTP
+// in-cluster registries.
+func NewRegistryClient(insecure bool) *CraneRegistryClient {
+	return &CraneRegistryClient{Insecure: insecure}
+}
+
+// DeleteImage deletes the image manifest via the registry API. The registry
+// must have deletion enabled (e.g. REGISTRY_STORAGE_DELETE_ENABLED=true for
+// the reference distribution registry).
+func (c *CraneRegistryClient) DeleteImage(ctx context.Context, imageRef string) error {
+	opts := []crane.Option{
+		crane.WithAuthFromKeychain(authn.DefaultKeychain),
+		crane.WithContext(ctx),
+	}
+	if c.Insecure {
+		opts = append(opts, crane.Insecure)
+	}
+
+	// Registries only accept DELETE on digests, so resolve tags first.
+	ref := imageRef
+	if _, err := name.NewDigest(imageRef); err != nil {
+		digest, err := crane.Digest(imageRef, opts...)
+		if err != nil {
+			return fmt.Errorf("resolve digest for %s: %w", imageRef, err)
+		}
+		if ref, err = PinDigest(imageRef, digest); err != nil {
+			return err
+		}
+	}
+
+	if err := crane.Delete(ref, opts...); err != nil {
+		return fmt.Errorf("delete image %s: %w", ref, err)
+	}
+	return nil
+}
+
+// CheckPushAccess asks the registry for a push-scoped token and opens (then
+// cancels) a blob upload session for the repository of imageRef.
+func (c *CraneRegistryClient) CheckPushAccess(_ context.Context, imageRef string) error {
+	var opts []name.Option
+	if c.Insecure {
+		opts = append(opts, name.Insecure)
+	}
+	ref, err := name.ParseReference(imageRef, opts...)
+	if err != nil {
+		return fmt.Errorf("parse image reference %q: %w", imageRef, err)
+	}
+	if err := remote.CheckPushPermission(ref, authn.DefaultKeychain, remote.DefaultTransport); err != nil {
+		return fmt.Errorf("push access to %s: %w", ref.Context(), err)
+	}
+	return nil
+}
+
+// PinDigest rewrites a tag reference (repo:tag) into a digest reference
+// (repo@sha256:...) so that a puller always gets exactly the pushed image.
+func PinDigest(imageRef, digest string) (string, error) {
+	ref, err := name.ParseReference(imageRef)
+	if err != nil {
+		return "", fmt.Errorf("parse image reference %q: %w", imageRef, err)
+	}
+	pinned, err := name.NewDigest(ref.Context().Name() + "@" + digest)
+	if err != nil {
+		return "", fmt.Errorf("invalid digest %q for %s: %w", digest, imageRef, err)
+	}
+	return pinned.String(), nil
+}
+
+// Compile-time check that CraneRegistryClient satisfies RegistryClient.
+var _ RegistryClient = (*CraneRegistryClient)(nil)
@@ -0,0 +1,86 @@
+package checkpoint
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+)
+
+func TestPinDigest(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+
+	got, err := PinDigest("registry.example.com/checkpoints/myapp-0:checkpoint-abc", digest)
+	if err != nil {
+		t.Fatalf("PinDigest failed: %v", err)
+	}
+	want := "registry.example.com/checkpoints/myapp-0@" + digest
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	if _, err := PinDigest("registry.example.com/checkpoints/myapp-0:tag", "not-a-digest"); err == nil {
+		t.Error("expected error for invalid digest")
+	}
+}
+
+func TestCraneRegistryClient_DeleteImage(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	tarPath := filepath.Join(t.TempDir(), "checkpoint.tar")
+	if err := os.WriteFile(tarPath, []byte("fake checkpoint data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	img, err := BuildCheckpointImage(tarPath, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref := host + "/checkpoints/myapp-0:checkpoint-uid-1"
+	if err := crane.Push(img, ref, crane.Insecure); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	digest, err := crane.Digest(ref, crane.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned, err := PinDigest(ref, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewRegistryClient(true)
+	if err := c.DeleteImage(context.Background(), ref); err != nil {
+		t.Fatalf("DeleteImage failed: %v", err)
+	}
+
+	if _, err := crane.Manifest(pinned, crane.Insecure); err == nil {
+		t.Error("expected image to be gone after DeleteImage")
+	}
+}
+
+func TestCraneRegistryClient_CheckPushAccess(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	c := NewRegistryClient(true)
+	if err := c.CheckPushAccess(context.Background(), host+"/checkpoints/myapp-0:checkpoint-uid-1"); err != nil {
+		t.Errorf("expected push access to in-memory registry, got %v", err)
+	}
+
+	srv.Close()
+	if err := c.CheckPushAccess(context.Background(), host+"/checkpoints/myapp-0:checkpoint-uid-1"); err == nil {
+		t.Error("expected error for unreachable registry")
+	}
+}
@@ -0,0 +1,379 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+	"github.com/haidinhtuan/kubernetes-controller/pkg/protocol"
+)
+
+// abortableSwapSubPhases are the identity swap sub-phases that can be unwound.
+// From TrafficSwitch (Cutoff) or PreFenceDrain (ExchangeFence) onwards the
+// shadow pod is being retired and the replacement is taking over the primary
+// queue, so there is no consistent state to roll back to.
+var abortableSwapSubPhases = map[string]bool{
+	"PrepareSwap":       true,
+	"ReCheckpoint":      true,
+	"SwapTransfer":      true,
+	"CreateReplacement": true,
+	"MiniReplay":        true,
+}
+
+// abortSafe reports whether the migration is at a point where an abort
+// request can be honored. Every phase before Finalizing is safe, except while
+// volume claims are being rebound: a claim deleted but not yet recreated
+// would be re-provisioned empty by a scaled-up StatefulSet, once a
+// ShadowPod source has been told to stop consuming, and once a standalone
+// Sequential source has been deleted. Finalizing is safe before it has
+// started (no source pod deleted, no END_REPLAY sent) and during the early
+// identity swap sub-phases.
+func abortSafe(m *migrationv1alpha1.StatefulMigration) bool {
+	if m.Status.VolumeSubPhase == "RebindVolumes" {
+		return false
+	}
+	if unownedSourceDeleted(m) {
+		return false
+	}
+	if m.Status.SourceFence != nil && m.Status.SourceFence.RequestedAt != nil {
+		return false
+	}
+	switch m.Status.Phase {
+	case "", migrationv1alpha1.PhasePending, migrationv1alpha1.PhaseCheckpointing,
+		migrationv1alpha1.PhaseTransferring, migrationv1alpha1.PhaseRestoring,
+		migrationv1alpha1.PhaseReplaying:
+		return true
+	case migrationv1alpha1.PhaseFinalizing:
+		if m.Status.SwapSubPhase == "" {
+			_, started := m.Status.PhaseTimings["Finalizing.start"]
+			return !started
+		}
+		return abortableSwapSubPhases[m.Status.SwapSubPhase]
+	}
+	return false
+}
+
+// unownedSourceDeleted reports whether the migration of a pod no StatefulSet
+// or Deployment recreates has reached Restoring, where a strategy that
+// deletes the source does so. From then on the target is the only copy of
+// the workload, so it must not be rolled back.
+func unownedSourceDeleted(m *migrationv1alpha1.StatefulMigration) bool {
+	if !strategyCapabilities(m).DeletesSource || m.Status.StatefulSetName != "" || m.Status.DeploymentName != "" {
+		return false
+	}
+	switch m.Status.Phase {
+	case migrationv1alpha1.PhaseRestoring, migrationv1alpha1.PhaseReplaying, migrationv1alpha1.PhaseFinalizing:
+		return true
+	}
+	return false
+}
+
+// deferAbort records that an abort was requested past the point of no
+// return. The migration keeps running; the condition tells the operator why
+// the request was not honored.
+func (r *StatefulMigrationReconciler) deferAbort(ctx context.Context, m *migrationv1alpha1.StatefulMigration) {
+	if meta.IsStatusConditionTrue(m.Status.Conditions, "AbortDeferred") {
+		return
+	}
+	logger := log.FromContext(ctx)
+	logger.Info("Abort requested past the point of no return, finishing migration",
+		"phase", m.Status.Phase, "swapSubPhase", m.Status.SwapSubPhase)
+
+	patch := client.MergeFrom(m.DeepCopy())
+	meta.SetStatusCondition(&m.Status.Conditions, metav1.Condition{
+		Type:               "AbortDeferred",
+		Status:             metav1.ConditionTrue,
+		Reason:             "PastSafePoint",
+		Message:            fmt.Sprintf("abort requested during %s; the migration can no longer be rolled back and will run to completion", abortPoint(m)),
+		LastTransitionTime: metav1.Now(),
+	})
+	if err := r.Status().Patch(ctx, m, patch); err != nil {
+		logger.Error(err, "Failed to record deferred abort")
+	}
+}
+
+// handleAbort honors spec.abort by rolling the migration back.
+func (r *StatefulMigrationReconciler) handleAbort(ctx context.Context, m *migrationv1alpha1.StatefulMigration) (ctrl.Result, error) {
+	return r.rollback(ctx, m, migrationv1alpha1.PhaseAborted, "AbortRequested", "abort requested")
+}
+
+// rollback unwinds an in-flight migration and moves it to phase, Aborted or
+// Failed, with reason and cause recorded in the condition of that name. Every step is
+// best-effort: failures are logged and the remaining steps still run, so a
+// broken broker cannot keep a StatefulSet ordinal held. Steps that took effect
+// are recorded in status.undoneSteps.
+//
+// What is undone depends on how far the migration got:
+//   - transfer Jobs are deleted;
+//   - a running replay is stopped with END_REPLAY and the replay queue is
+//     deleted, which restores normal routing on the exchange;
+//   - the target pod (or, during an identity swap, the replacement pod) is
+//     deleted;
+//   - for Sequential and ReserveOrdinal, the held StatefulSet ordinal is
+//     released.
+//
+// During an identity swap the source pod is already gone and the shadow pod
+// holds the migrated state, so it is left serving and the source ordinal
+// stays held.
+func (r *StatefulMigrationReconciler) rollback(ctx context.Context, m *migrationv1alpha1.StatefulMigration, phase migrationv1alpha1.Phase, reason, cause string) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	base := m.DeepCopy()
+	point := abortPoint(m)
+	inSwap := inIdentitySwap(m)
+
+	logger.Info("Aborting migration", "at", point, "cause", cause)
+
+	var undone []string
+	record := func(format string, args ...interface{}) {
+		step := fmt.Sprintf(format, args...)
+		logger.Info("Abort: " + step)
+		undone = append(undone, step)
+	}
+
+	// Transfer Jobs: stop any in-flight build/push or local-load.
+	for _, jobName := range []string{m.Name + "-transfer", m.Name + "-swap-transfer"} {
+		job := &batchv1.Job{}
+		if err := r.Get(ctx, types.NamespacedName{Name: jobName, Namespace: m.Namespace}, job); err != nil {
+			if !errors.IsNotFound(err) {
+				logger.Error(err, "Abort: failed to look up Job", "job", jobName)
+			}
+			continue
+		}
+		if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Abort: failed to delete Job", "job", jobName)
+			continue
+		}
+		record("deleted Job %s", jobName)
+	}
+
+	// Broker: Checkpointing creates the replay queue and PrepareSwap creates
+	// it again for the identity swap.
+	mqCfg := m.Spec.MessageQueueConfig
+	replayQueue := mqCfg.QueueName + ".ms2m-replay"
+	queueCreated := inSwap
+	switch m.Status.Phase {
+	case migrationv1alpha1.PhaseTransferring, migrationv1alpha1.PhaseRestoring, migrationv1alpha1.PhaseReplaying:
+		queueCreated = true
+	}
+	if queueCreated {
+		if err := r.MsgClient.Connect(ctx, mqCfg.BrokerURL); err != nil {
+			logger.Error(err, "Abort: broker connect failed, replay queue left in place", "queue", replayQueue)
+		} else {
+			// Stop the consumer before its queue disappears.
+			replayingPod := ""
+			if _, ok := m.Status.PhaseTimings["Replaying.start"]; ok && m.Status.Phase == migrationv1alpha1.PhaseReplaying {
+				replayingPod = m.Status.TargetPod
+			}
+			if _, ok := m.Status.PhaseTimings["Swap.MiniReplay.start"]; ok && inSwap {
+				replayingPod = m.Status.ReplacementPod
+			}
+			// START_REPLAY may have been acted on before its ack was read.
+			if req := m.Status.ControlRequest; req != nil && req.Type == string(protocol.ControlStartReplay) {
+				replayingPod = req.Pod
+			}
+			if replayingPod != "" {
+				if err := r.notify(ctx, m, replayingPod, protocol.ControlEndReplay, nil); err != nil {
+					logger.Error(err, "Abort: failed to send END_REPLAY", "pod", replayingPod)
+				} else {
+					record("stopped replay on pod %s", replayingPod)
+				}
+			}
+
+			if err := r.MsgClient.DeleteSecondaryQueue(ctx, replayQueue, mqCfg.QueueName, mqCfg.ExchangeName); err != nil {
+				logger.Error(err, "Abort: failed to delete replay queue", "queue", replayQueue)
+			} else {
+				record("deleted replay queue %s", replayQueue)
+			}
+			if m.Status.ControlRequest != nil || len(m.Status.ControlReplies) > 0 {
+				if err := r.MsgClient.DeleteQueue(ctx, replyQueue(m)); err != nil {
+					logger.Error(err, "Abort: failed to delete reply queue", "queue", replyQueue(m))
+				}
+			}
+		}
+	}
+
+	if strategy, ok := strategyFor(m); ok {
+		strategy.Rollback(ctx, r, m, record)
+	}
+
+	if err := r.MsgClient.Close(); err != nil {
+		logger.Error(err, "Failed to close broker connection")
+	}
+
+	// The checkpoint image is of no further use; honor the retention policy
+	// the same way a completed migration would.
+	if m.Spec.CheckpointImageRetention == "Delete" && m.Status.CheckpointImage != "" && r.Registry != nil {
+		if err := r.Registry.DeleteImage(ctx, m.Status.CheckpointImage); err != nil {
+			logger.Error(err, "Abort: failed to delete checkpoint image", "image", m.Status.CheckpointImage)
+		} else {
+			record("deleted checkpoint image %s", m.Status.CheckpointImage)
+		}
+	}
+
+	message := fmt.Sprintf("%s during %s", cause, point)
+	if len(undone) > 0 {
+		message += "; undone: " + strings.Join(undone, ", ")
+	}
+	if inSwap && m.Status.StatefulSetName != "" {
+		message += fmt.Sprintf("; shadow pod %s keeps serving and StatefulSet %s keeps its ordinal held", m.Status.TargetPod, m.Status.StatefulSetName)
+	}
+
+	m.Status.Phase = phase
+	m.Status.SwapSubPhase = ""
+	m.Status.ReplayQueueDepth = 0
+	m.Status.ControlRequest = nil
+	m.Status.UndoneSteps = undone
+	meta.RemoveStatusCondition(&m.Status.Conditions, "AbortDeferred")
+	meta.SetStatusCondition(&m.Status.Conditions, metav1.Condition{
+		Type:               string(phase),
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: metav1.Now(),
+	})
+	if err := r.Status().Patch(ctx, m, client.MergeFrom(base)); err != nil {
+		return ctrl.Result{}, err
+	}
+	logger.Info("Migration rolled back", "phase", phase, "undoneSteps", len(undone))
+	return ctrl.Result{}, nil
+}
+
+// AbortTargetPod removes the pod restored by this migration as
+// targetPodName and, when it took the source's name (Sequential and
+// ReserveOrdinal), hands the ordinal back to the StatefulSet.
+func (r *StatefulMigrationReconciler) AbortTargetPod(ctx context.Context, m *migrationv1alpha1.StatefulMigration, targetPodName string, record func(string, ...interface{})) {
+	logger := log.FromContext(ctx)
+
+	sameName := targetPodName == m.Spec.SourcePod
+	targetPod := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: targetPodName, Namespace: m.Namespace}, targetPod); err == nil {
+		// Only delete a pod this migration created, or a gated pod the
+		// StatefulSet recreated for the held ordinal; under Sequential and
+		// ReserveOrdinal the name may still belong to the original
+		// StatefulSet pod.
+		if (targetPod.Labels["migration.ms2m.io/migration"] == m.Name || heldPlaceholder(targetPod)) && targetPod.DeletionTimestamp == nil {
+			if err := r.Delete(ctx, targetPod); err != nil && !errors.IsNotFound(err) {
+				logger.Error(err, "Abort: failed to delete target pod", "pod", targetPodName)
+			} else {
+				record("deleted target pod %s", targetPodName)
+			}
+		}
+	} else if !errors.IsNotFound(err) {
+		logger.Error(err, "Abort: failed to look up target pod", "pod", targetPodName)
+	}
+
+	if sameName && m.Status.StatefulSetName != "" && r.unholdOrdinal(ctx, m) {
+		record("released the ordinal of %s in StatefulSet %s", targetPodName, m.Status.StatefulSetName)
+	}
+}
+
+// abortIdentitySwap removes the replacement pod created by an identity swap.
+// The StatefulSet template is reverted, then the source ordinal is held
+// again so the StatefulSet does not recreate it next to the still-serving
+// shadow pod.
+func (r *StatefulMigrationReconciler) abortIdentitySwap(ctx context.Context, m *migrationv1alpha1.StatefulMigration, record func(string, ...interface{})) {
+	logger := log.FromContext(ctx)
+
+	// Revert before holding, so a fresh hold records the original strategy.
+	if m.Status.StatefulSetName != "" && r.revertTemplate(ctx, m) {
+		record("reverted the template of StatefulSet %s", m.Status.StatefulSetName)
+	}
+	if m.Status.SwapSubPhase != "CreateReplacement" && m.Status.SwapSubPhase != "MiniReplay" {
+		return
+	}
+	if m.Status.StatefulSetName != "" {
+		hold := m.Status.OrdinalReservation
+		held := hold != nil && hold.ReservedAt != nil && hold.ReleasedAt == nil
+		if err := r.HoldOrdinal(ctx, m); err != nil {
+			logger.Error(err, "Abort: failed to hold StatefulSet ordinal", "statefulset", m.Status.StatefulSetName)
+		} else if !held {
+			record("held the ordinal of %s in StatefulSet %s", m.Spec.SourcePod, m.Status.StatefulSetName)
+		}
+	}
+
+	replacement := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: m.Spec.SourcePod, Namespace: m.Namespace}, replacement); err == nil {
+		// The original pod lived on the source node; only the pod we placed
+		// on the target node is ours to remove.
+		if replacement.Spec.NodeName == m.Spec.TargetNode && replacement.DeletionTimestamp == nil {
+			gracePeriod := int64(0)
+			if err := r.Delete(ctx, replacement, &client.DeleteOptions{
+				GracePeriodSeconds: &gracePeriod,
+			}); err != nil && !errors.IsNotFound(err) {
+				logger.Error(err, "Abort: failed to delete replacement pod", "pod", m.Spec.SourcePod)
+			} else {
+				record("deleted replacement pod %s", m.Spec.SourcePod)
+			}
+		}
+	} else if !errors.IsNotFound(err) {
+		logger.Error(err, "Abort: failed to look up replacement pod", "pod", m.Spec.SourcePod)
+	}
+}
+
+// unholdOrdinal restores every StatefulSet field changed by the ordinal hold
+// in one patch and reports whether the StatefulSet changed. Unlike
+// ReleaseOrdinal it does not wait for a pod to be adopted: the StatefulSet
+// recreates the ordinal from its own template.
+func (r *StatefulMigrationReconciler) unholdOrdinal(ctx context.Context, m *migrationv1alpha1.StatefulMigration) bool {
+	logger := log.FromContext(ctx)
+
+	hold := m.Status.OrdinalReservation
+	if hold == nil {
+		// Migrations started before ordinal holds scaled to zero.
+		if m.Status.OriginalReplicas == 0 {
+			return false
+		}
+		hold = &migrationv1alpha1.OrdinalReservationStatus{Method: holdScaleDown}
+	}
+	if hold.ReleasedAt != nil {
+		return false
+	}
+
+	sts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: m.Status.StatefulSetName, Namespace: m.Namespace}, sts); err != nil {
+		if !errors.IsNotFound(err) {
+			logger.Error(err, "Abort: failed to look up StatefulSet", "statefulset", m.Status.StatefulSetName)
+		}
+		return false
+	}
+	before := sts.DeepCopy()
+	revertHold(sts, hold, m.Status.OriginalReplicas)
+	if equality.Semantic.DeepEqual(before.Spec, sts.Spec) {
+		return false
+	}
+	if err := r.Patch(ctx, sts, client.MergeFrom(before)); err != nil {
+		logger.Error(err, "Abort: failed to release StatefulSet ordinal", "statefulset", m.Status.StatefulSetName)
+		return false
+	}
+	return true
+}
+
+// inIdentitySwap reports whether m is in an identity swap sub-phase.
+func inIdentitySwap(m *migrationv1alpha1.StatefulMigration) bool {
+	return m.Status.Phase == migrationv1alpha1.PhaseFinalizing && m.Status.SwapSubPhase != ""
+}
+
+// abortPoint describes where the migration was when the abort was handled.
+func abortPoint(m *migrationv1alpha1.StatefulMigration) string {
+	phase := string(m.Status.Phase)
+	if phase == "" {
+		phase = "initialization"
+	}
+	if m.Status.SwapSubPhase != "" {
+		return phase + "/" + m.Status.SwapSubPhase
+	}
+	return phase
+}
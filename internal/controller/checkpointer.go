@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+	"github.com/haidinhtuan/kubernetes-controller/internal/checkpoint"
+)
+
+// Checkpoint backends, for the node label checkpointBackendLabel and
+// status.checkpointBackend.
+const (
+	backendKubelet = "Kubelet"
+	backendAgent   = "Agent"
+)
+
+// checkpointBackendLabel selects a node's checkpoint backend explicitly.
+const checkpointBackendLabel = "migration.ms2m.io/checkpoint-backend"
+
+// agentCheckpointDir is where the ms2m-agent writes checkpoint archives on
+// the node; transfer Jobs mount it for Agent-backend checkpoints.
+const agentCheckpointDir = "/var/lib/ms2m/checkpoints"
+
+// nodeCheckpointBackend picks the checkpoint backend for node: the
+// checkpointBackendLabel if set, otherwise Agent on containerd nodes, whose
+// CRI the kubelet checkpoint API cannot drive, and Kubelet elsewhere.
+func nodeCheckpointBackend(node *corev1.Node) (string, error) {
+	switch backend := node.Labels[checkpointBackendLabel]; backend {
+	case backendKubelet, backendAgent:
+		return backend, nil
+	case "":
+	default:
+		return "", fmt.Errorf("node %s: label %s=%q must be Kubelet or Agent", node.Name, checkpointBackendLabel, backend)
+	}
+	if strings.HasPrefix(node.Status.NodeInfo.ContainerRuntimeVersion, "containerd://") {
+		return backendAgent, nil
+	}
+	return backendKubelet, nil
+}
+
+// checkpointOptions returns spec.checkpointOptions as checkpoint.Options.
+func checkpointOptions(m *migrationv1alpha1.StatefulMigration) checkpoint.Options {
+	o := m.Spec.CheckpointOptions
+	if o == nil {
+		return checkpoint.Options{}
+	}
+	return checkpoint.Options{Timeout: time.Duration(o.TimeoutSeconds) * time.Second}
+}
+
+// validateCheckpointOptions rejects a negative checkpoint timeout.
+func validateCheckpointOptions(m *migrationv1alpha1.StatefulMigration) error {
+	o := m.Spec.CheckpointOptions
+	if o == nil {
+		return nil
+	}
+	if o.TimeoutSeconds < 0 {
+		return fmt.Errorf("spec.checkpointOptions.timeoutSeconds %d must not be negative", o.TimeoutSeconds)
+	}
+	return nil
+}
+
+// checkpointContainer checkpoints the migrating container of podName on
+// nodeName with the node's backend. It returns the archive path on the node
+// and the backend used. A node that cannot be read uses the kubelet API.
+func (r *StatefulMigrationReconciler) checkpointContainer(ctx context.Context, m *migrationv1alpha1.StatefulMigration, nodeName, podName string) (string, string, error) {
+	opts := checkpointOptions(m)
+	backend := backendKubelet
+	node := &corev1.Node{}
+	if err := r.Get(ctx, types.NamespacedName{Name: nodeName}, node); err == nil {
+		if backend, err = nodeCheckpointBackend(node); err != nil {
+			return "", "", err
+		}
+	} else if !errors.IsNotFound(err) {
+		return "", "", err
+	}
+	var cp checkpoint.Checkpointer
+	switch backend {
+	case backendAgent:
+		cp = r.AgentCheckpointer
+		if cp == nil {
+			cp = &checkpoint.AgentCheckpointer{AgentIP: r.findAgentPodIP}
+		}
+	default:
+		cp = r.KubeletClient
+	}
+	if cp == nil {
+		// Fallback for environments without a real kubelet client (e.g., tests)
+		return fmt.Sprintf("/var/lib/kubelet/checkpoints/checkpoint-%s.tar", podName), backend, nil
+	}
+	path, err := cp.Checkpoint(ctx, nodeName, m.Namespace, podName, m.Status.ContainerName, opts)
+	if err != nil {
+		return "", backend, err
+	}
+	return path, backend, nil
+}
@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+	"github.com/haidinhtuan/kubernetes-controller/internal/retry"
+	"github.com/haidinhtuan/kubernetes-controller/pkg/protocol"
+)
+
+// Built-in defaults for spec.controlProtocol.
+const (
+	defaultAckTimeout        = 10 * time.Second
+	defaultControlMessageTTL = 60 * time.Second
+)
+
+// controlReplyPollInterval is how often the reply queue is checked while a
+// control message awaits its ack.
+const controlReplyPollInterval = 500 * time.Millisecond
+
+// controlProtocol returns spec.controlProtocol, or an empty value when unset.
+func controlProtocol(m *migrationv1alpha1.StatefulMigration) migrationv1alpha1.ControlProtocol {
+	if m.Spec.ControlProtocol == nil {
+		return migrationv1alpha1.ControlProtocol{}
+	}
+	return *m.Spec.ControlProtocol
+}
+
+// ackRequired reports whether control messages must be acknowledged.
+func ackRequired(m *migrationv1alpha1.StatefulMigration) bool {
+	return controlProtocol(m).AckMode != "None"
+}
+
+func ackTimeout(m *migrationv1alpha1.StatefulMigration) time.Duration {
+	return seconds(controlProtocol(m).AckTimeoutSeconds, defaultAckTimeout)
+}
+
+func controlMessageTTL(m *migrationv1alpha1.StatefulMigration) time.Duration {
+	return seconds(controlProtocol(m).MessageTTLSeconds, defaultControlMessageTTL)
+}
+
+// validateControlProtocol rejects spec.controlProtocol values the controller
+// cannot act on.
+func validateControlProtocol(m *migrationv1alpha1.StatefulMigration) error {
+	switch mode := controlProtocol(m).AckMode; mode {
+	case "", "Required", "None":
+		return nil
+	default:
+		return fmt.Errorf("spec.controlProtocol.ackMode %q must be Required or None", mode)
+	}
+}
+
+// replyQueue returns the queue pods reply to this migration's control
+// messages on.
+func replyQueue(m *migrationv1alpha1.StatefulMigration) string {
+	return protocol.ReplyQueueName(m.Namespace, m.Name)
+}
+
+// controlMessage builds a control message from this migration.
+func controlMessage(m *migrationv1alpha1.StatefulMigration, msgType protocol.ControlMessageType, payload map[string]interface{}) protocol.ControlMessage {
+	return protocol.ControlMessage{
+		Type:      msgType,
+		Migration: m.Namespace + "/" + m.Name,
+		Payload:   payload,
+		TTL:       controlMessageTTL(m),
+	}
+}
+
+// notify sends a control message without waiting for a reply. Used where the
+// migration cannot act on the answer, e.g. stopping replay during an abort.
+func (r *StatefulMigrationReconciler) notify(ctx context.Context, m *migrationv1alpha1.StatefulMigration, pod string, msgType protocol.ControlMessageType, payload map[string]interface{}) error {
+	return r.MsgClient.SendControlMessage(ctx, pod, controlMessage(m, msgType, payload))
+}
+
+// controlReplied returns the recorded reply to the msgType message sent by
+// step, or nil if there is none.
+func controlReplied(m *migrationv1alpha1.StatefulMigration, step string, msgType protocol.ControlMessageType) *migrationv1alpha1.ControlReplyStatus {
+	for i := range m.Status.ControlReplies {
+		reply := &m.Status.ControlReplies[i]
+		if reply.Step == step && reply.Type == string(msgType) {
+			return reply
+		}
+	}
+	return nil
+}
+
+// controlPending reports whether step has sent msgType and is awaiting the
+// reply.
+func controlPending(m *migrationv1alpha1.StatefulMigration, step string, msgType protocol.ControlMessageType) bool {
+	req := m.Status.ControlRequest
+	return req != nil && req.Step == step && req.Type == string(msgType)
+}
+
+// sendControl sends msgType to pod with a fresh correlation ID and records it
+// in status.controlRequest, replacing any earlier request.
+func (r *StatefulMigrationReconciler) sendControl(ctx context.Context, m *migrationv1alpha1.StatefulMigration, step, pod string, msgType protocol.ControlMessageType, payload map[string]interface{}) error {
+	if err := r.MsgClient.DeclareReplyQueue(ctx, replyQueue(m)); err != nil {
+		return err
+	}
+	msg := controlMessage(m, msgType, payload)
+	msg.ID = string(uuid.NewUUID())
+	msg.ReplyTo = replyQueue(m)
+	if err := r.MsgClient.SendControlMessage(ctx, pod, msg); err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(m.DeepCopy())
+	now := metav1.Now()
+	m.Status.ControlRequest = &migrationv1alpha1.ControlRequestStatus{
+		Step:   step,
+		Type:   string(msgType),
+		Pod:    pod,
+		ID:     msg.ID,
+		SentAt: &now,
+	}
+	return r.Status().Patch(ctx, m, patch)
+}
+
+// pollControl checks for the reply to status.controlRequest. Once it has
+// arrived it is appended to status.controlReplies, the request is cleared
+// and the reply is returned; until then it returns nil.
+func (r *StatefulMigrationReconciler) pollControl(ctx context.Context, m *migrationv1alpha1.StatefulMigration) (*migrationv1alpha1.ControlReplyStatus, error) {
+	req := m.Status.ControlRequest
+	if req == nil {
+		return nil, nil
+	}
+	reply, err := r.MsgClient.ReceiveControlReply(ctx, replyQueue(m), req.ID)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+
+	patch := client.MergeFrom(m.DeepCopy())
+	recorded := migrationv1alpha1.ControlReplyStatus{
+		Step:   req.Step,
+		Type:   req.Type,
+		Pod:    req.Pod,
+		ID:     req.ID,
+		Status: string(reply.Status),
+		Reason: reply.Reason,
+	}
+	if req.SentAt != nil {
+		recorded.RoundTrip = time.Since(req.SentAt.Time).Round(time.Millisecond).String()
+	}
+	m.Status.ControlReplies = append(m.Status.ControlReplies, recorded)
+	m.Status.ControlRequest = nil
+	if err := r.Status().Patch(ctx, m, patch); err != nil {
+		return nil, err
+	}
+	log.FromContext(ctx).Info("Control message answered", "type", req.Type, "pod", req.Pod,
+		"status", reply.Status, "roundTrip", recorded.RoundTrip)
+	return &m.Status.ControlReplies[len(m.Status.ControlReplies)-1], nil
+}
+
+// awaitControl sends msgType to pod on behalf of step and waits for the ack.
+// It returns done=true once the pod has acked, immediately on later calls,
+// and right after sending when spec.controlProtocol.ackMode is None. A nack
+// fails the migration. Without a reply within the ack timeout the message is
+// resent with a new correlation ID, counted as a transient "<TYPE> ack" error
+// under spec.retryPolicy.
+func (r *StatefulMigrationReconciler) awaitControl(ctx context.Context, m *migrationv1alpha1.StatefulMigration, step, pod string, msgType protocol.ControlMessageType, payload map[string]interface{}) (ctrl.Result, bool, error) {
+	if !ackRequired(m) {
+		if err := r.notify(ctx, m, pod, msgType, payload); err != nil {
+			result, err := r.RetryOrFail(ctx, m, fmt.Sprintf("send %s", msgType), err)
+			return result, false, err
+		}
+		return ctrl.Result{}, true, nil
+	}
+	if controlReplied(m, step, msgType) != nil {
+		return ctrl.Result{}, true, nil
+	}
+
+	if !controlPending(m, step, msgType) {
+		if err := r.sendControl(ctx, m, step, pod, msgType, payload); err != nil {
+			result, err := r.RetryOrFail(ctx, m, fmt.Sprintf("send %s", msgType), err)
+			return result, false, err
+		}
+	}
+
+	reply, err := r.pollControl(ctx, m)
+	if err != nil {
+		result, err := r.RetryOrFail(ctx, m, fmt.Sprintf("receive %s reply", msgType), err)
+		return result, false, err
+	}
+	if err := r.retrySucceeded(ctx, m, fmt.Sprintf("receive %s reply", msgType)); err != nil {
+		return ctrl.Result{}, false, err
+	}
+	if reply == nil {
+		req := m.Status.ControlRequest
+		waited := time.Since(req.SentAt.Time)
+		if waited <= ackTimeout(m) {
+			return ctrl.Result{RequeueAfter: controlReplyPollInterval}, false, nil
+		}
+		// Drop the request so the retry resends under a new correlation ID;
+		// a late reply to the old one is then discarded as stale.
+		patch := client.MergeFrom(m.DeepCopy())
+		m.Status.ControlRequest = nil
+		if err := r.Status().Patch(ctx, m, patch); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		err := retry.MarkTransient(fmt.Errorf("no reply from pod %s within %s", pod, ackTimeout(m)))
+		result, err := r.RetryOrFail(ctx, m, fmt.Sprintf("%s ack", msgType), err)
+		return result, false, err
+	}
+	if reply.Status != string(protocol.ReplyAck) {
+		reason := reply.Reason
+		if reason == "" {
+			reason = "no reason given"
+		}
+		result, err := r.failMigration(ctx, m, fmt.Sprintf("%s rejected by pod %s: %s", msgType, pod, reason))
+		return result, false, err
+	}
+	return ctrl.Result{}, true, nil
+}
@@ -0,0 +1,318 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+	"github.com/haidinhtuan/kubernetes-controller/internal/retry"
+)
+
+// sourcePodAnnotation records "<namespace>/<pod>" of the source on a pod
+// restored in another namespace or cluster, where it has no owner reference
+// back to the migration.
+const sourcePodAnnotation = "migration.ms2m.io/source-pod"
+
+// allowedSourceNamespacesAnnotation on a Namespace lists, comma-separated,
+// the namespaces whose migrations may restore pods into it within the same
+// cluster. Without it no other namespace may use it as a target.
+const allowedSourceNamespacesAnnotation = "migration.ms2m.io/allowed-source-namespaces"
+
+// crossClusterStrategy restores the target pod through a client for
+// spec.targetCluster, next to the still-running source. The checkpoint
+// travels through the registry; replay and the source fence run over the
+// broker, which both clusters reach. Finalizing deletes the source pod.
+type crossClusterStrategy struct{}
+
+// Capabilities: the source serves until it is fenced, and the target's
+// cluster has none of its claims.
+func (crossClusterStrategy) Capabilities(*migrationv1alpha1.StatefulMigration) Capabilities {
+	return Capabilities{SourceRunsAlongside: true, Volumes: VolumesNone, TargetCluster: true}
+}
+
+// Validate rejects owned source pods: the owner would recreate the pod once
+// Finalize deletes it, leaving two consumers. A target namespace in the
+// same cluster must also opt in.
+func (crossClusterStrategy) Validate(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, sourcePod *corev1.Pod) error {
+	if ref := podOwner(sourcePod); ref != nil {
+		return fmt.Errorf("the %s strategy needs a standalone source pod: %s %q would recreate it in the source cluster", m.Spec.MigrationStrategy, ref.Kind, ref.Name)
+	}
+	return r.checkTargetNamespace(ctx, m)
+}
+
+func (crossClusterStrategy) PredictFinalization(*migrationv1alpha1.StatefulMigration, string) (string, string) {
+	return "None", "None"
+}
+
+// TargetPodName names the target as a shadow pod. Source and target share
+// the broker while both run, and a pod's control queue is named after the
+// pod, so under the source's name the target would take the source's
+// control messages.
+func (crossClusterStrategy) TargetPodName(m *migrationv1alpha1.StatefulMigration) string {
+	return m.Spec.SourcePod + "-shadow"
+}
+
+// Restore creates the target pod in the target namespace from the spec
+// captured in Pending. Owner references cannot cross namespaces or
+// clusters, so the pod is a bare pod that Rollback removes explicitly.
+func (s crossClusterStrategy) Restore(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration) (ctrl.Result, *corev1.Pod, error) {
+	logger := log.FromContext(ctx)
+	name := s.TargetPodName(m)
+
+	c, namespace, err := r.targetClient(ctx, m)
+	if err != nil {
+		result, err := r.RetryOrFail(ctx, m, "target cluster client", err)
+		return result, nil, err
+	}
+	targetPod := &corev1.Pod{}
+	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, targetPod); err == nil {
+		return r.RunningTarget(ctx, m, targetPod)
+	} else if !errors.IsNotFound(err) {
+		result, err := r.RetryOrFail(ctx, m, "target pod lookup", err)
+		return result, nil, err
+	}
+
+	checkpointImage, pullPolicy := registryCheckpointImage(m)
+	labels := map[string]string{
+		"migration.ms2m.io/migration": m.Name,
+		"migration.ms2m.io/role":      "target",
+	}
+	for k, v := range m.Status.SourcePodLabels {
+		if _, exists := labels[k]; !exists {
+			labels[k] = v
+		}
+	}
+	newPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+			Annotations: map[string]string{
+				"migration.ms2m.io/checkpoint-image": checkpointImage,
+				sourcePodAnnotation:                  m.Namespace + "/" + m.Spec.SourcePod,
+			},
+		},
+		Spec: restoredPodSpec(m, sourcePodSpec(m), checkpointImage, pullPolicy, false),
+	}
+	if err := c.Create(ctx, newPod); err != nil {
+		if errors.IsAlreadyExists(err) {
+			return ctrl.Result{RequeueAfter: 1 * time.Second}, nil, nil
+		}
+		result, err := r.RetryOrFail(ctx, m, "create target pod", err)
+		return result, nil, err
+	}
+
+	logger.Info("Created target pod", "pod", name, "namespace", namespace, "node", m.Spec.TargetNode,
+		"remote", m.Spec.TargetCluster.KubeconfigSecretRef != nil)
+	return ctrl.Result{RequeueAfter: 1 * time.Second}, nil, nil
+}
+
+// Finalize deletes the source pod; the target has been serving since the
+// source was fenced in Replaying. Pending only admits standalone sources,
+// so no owner recreates it.
+func (crossClusterStrategy) Finalize(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, _ client.Object) (ctrl.Result, bool, error) {
+	sourcePod := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{Name: m.Spec.SourcePod, Namespace: m.Namespace}, sourcePod)
+	if err == nil {
+		if delErr := r.Delete(ctx, sourcePod); delErr != nil && !errors.IsNotFound(delErr) {
+			log.FromContext(ctx).Error(delErr, "Failed to delete source pod", "pod", m.Spec.SourcePod)
+		}
+	} else if !errors.IsNotFound(err) {
+		return ctrl.Result{}, false, err
+	}
+	return ctrl.Result{}, true, nil
+}
+
+// Rollback deletes the target pod in the target namespace if this
+// migration created it.
+func (s crossClusterStrategy) Rollback(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, record func(string, ...interface{})) {
+	logger := log.FromContext(ctx)
+	name := s.TargetPodName(m)
+
+	c, namespace, err := r.targetClient(ctx, m)
+	if err != nil {
+		logger.Error(err, "Abort: no client for the target cluster", "pod", name)
+		return
+	}
+	targetPod := &corev1.Pod{}
+	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, targetPod); err != nil {
+		if !errors.IsNotFound(err) {
+			logger.Error(err, "Abort: failed to look up target pod", "pod", name, "namespace", namespace)
+		}
+		return
+	}
+	if targetPod.Labels["migration.ms2m.io/migration"] != m.Name || targetPod.DeletionTimestamp != nil {
+		return
+	}
+	if err := c.Delete(ctx, targetPod); err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Abort: failed to delete target pod", "pod", name, "namespace", namespace)
+		return
+	}
+	record("deleted target pod %s/%s", namespace, name)
+}
+
+// validateTargetCluster rejects spec.targetCluster settings the strategies
+// with the TargetCluster capability cannot act on. Identity swaps, owner
+// placement and Direct transfer all assume the target node is in the
+// source's cluster. An unknown strategy is left to validateMigrationStrategy.
+func validateTargetCluster(m *migrationv1alpha1.StatefulMigration) error {
+	tc := m.Spec.TargetCluster
+	s := m.Spec.MigrationStrategy
+	_, known := lookupStrategy(s)
+	if tc == nil {
+		if known && capabilitiesOf(s, m).TargetCluster {
+			return fmt.Errorf("the %s strategy needs spec.targetCluster", s)
+		}
+		return nil
+	}
+	if known && !capabilitiesOf(s, m).TargetCluster {
+		return fmt.Errorf("spec.targetCluster needs the %s strategy, not %q", strings.Join(targetClusterStrategies(m), " or "), s)
+	}
+	if ref := tc.KubeconfigSecretRef; ref != nil {
+		if ref.Name == "" || ref.Key == "" {
+			return fmt.Errorf("spec.targetCluster.kubeconfigSecretRef needs a name and a key")
+		}
+	} else if tc.Namespace == "" || tc.Namespace == m.Namespace {
+		return fmt.Errorf("spec.targetCluster needs a kubeconfigSecretRef or a namespace other than %q", m.Namespace)
+	}
+	if m.Spec.TransferMode == "Direct" {
+		return fmt.Errorf("spec.targetCluster needs the Registry transfer mode; Direct transfer loads the checkpoint on a node of the source cluster")
+	}
+	for _, f := range []struct{ field, value string }{
+		{"identitySwapMode", m.Spec.IdentitySwapMode},
+		{"deploymentPlacement", m.Spec.DeploymentPlacement},
+		{"statefulSetPlacement", m.Spec.StatefulSetPlacement},
+	} {
+		if f.value != "" && f.value != "None" {
+			return fmt.Errorf("spec.%s %q is not supported with spec.targetCluster", f.field, f.value)
+		}
+	}
+	return nil
+}
+
+// targetClusterStrategies returns the names of the registered strategies
+// that restore through spec.targetCluster.
+func targetClusterStrategies(m *migrationv1alpha1.StatefulMigration) []string {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+	var names []string
+	for name, s := range strategies {
+		if s.Capabilities(m).TargetCluster {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkTargetNamespace verifies that a target namespace in the migration's
+// own cluster has opted in to receiving pods from the migration's namespace
+// through allowedSourceNamespacesAnnotation. Access to another cluster is
+// governed by the kubeconfig instead.
+func (r *StatefulMigrationReconciler) checkTargetNamespace(ctx context.Context, m *migrationv1alpha1.StatefulMigration) error {
+	tc := m.Spec.TargetCluster
+	if tc == nil || tc.KubeconfigSecretRef != nil {
+		return nil
+	}
+	ns := &corev1.Namespace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: tc.Namespace}, ns); err != nil {
+		if errors.IsNotFound(err) {
+			return retry.MarkPermanent(fmt.Errorf("target namespace %q not found", tc.Namespace))
+		}
+		return err
+	}
+	for _, allowed := range strings.Split(ns.Annotations[allowedSourceNamespacesAnnotation], ",") {
+		if strings.TrimSpace(allowed) == m.Namespace {
+			return nil
+		}
+	}
+	return retry.MarkPermanent(fmt.Errorf("target namespace %q does not allow migrations from %q: add it to the %s annotation of the namespace",
+		tc.Namespace, m.Namespace, allowedSourceNamespacesAnnotation))
+}
+
+// podOwner returns the controller of pod, or its first owner if none is
+// marked as controller.
+func podOwner(pod *corev1.Pod) *metav1.OwnerReference {
+	if ref := metav1.GetControllerOf(pod); ref != nil {
+		return ref
+	}
+	if len(pod.OwnerReferences) > 0 {
+		return &pod.OwnerReferences[0]
+	}
+	return nil
+}
+
+// targetClient returns the client for the cluster the target pod is
+// restored in and the target namespace. Without spec.targetCluster, or
+// without a kubeconfig Secret, that is the controller's own cluster.
+// Clients are cached per Secret key, and rebuilt when the Secret changes.
+func (r *StatefulMigrationReconciler) targetClient(ctx context.Context, m *migrationv1alpha1.StatefulMigration) (client.Client, string, error) {
+	tc := m.Spec.TargetCluster
+	if tc == nil {
+		return r.Client, m.Namespace, nil
+	}
+	namespace := tc.Namespace
+	if namespace == "" {
+		namespace = m.Namespace
+	}
+	ref := tc.KubeconfigSecretRef
+	if ref == nil {
+		return r.Client, namespace, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: m.Namespace}, secret); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, "", fmt.Errorf("kubeconfig Secret %q not found", ref.Name)
+		}
+		return nil, "", err
+	}
+	kubeconfig, ok := secret.Data[ref.Key]
+	if !ok {
+		return nil, "", fmt.Errorf("kubeconfig Secret %q has no key %q", ref.Name, ref.Key)
+	}
+
+	key := fmt.Sprintf("%s/%s/%s", m.Namespace, ref.Name, ref.Key)
+	if cached, ok := r.targetClients.Load(key); ok && cached.(targetClientEntry).revision == secret.ResourceVersion {
+		return cached.(targetClientEntry).client, namespace, nil
+	}
+	newClient := r.TargetClient
+	if newClient == nil {
+		newClient = r.newTargetClient
+	}
+	c, err := newClient(kubeconfig)
+	if err != nil {
+		return nil, "", fmt.Errorf("kubeconfig Secret %q: %w", ref.Name, err)
+	}
+	r.targetClients.Store(key, targetClientEntry{revision: secret.ResourceVersion, client: c})
+	return c, namespace, nil
+}
+
+// targetClientEntry is a cached target cluster client and the kubeconfig
+// Secret revision it was built from.
+type targetClientEntry struct {
+	revision string
+	client   client.Client
+}
+
+// newTargetClient builds a client for the cluster of kubeconfig with the
+// reconciler's scheme.
+func (r *StatefulMigrationReconciler) newTargetClient(kubeconfig []byte) (client.Client, error) {
+	cfg, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return client.New(cfg, client.Options{Scheme: r.Scheme})
+}
@@ -0,0 +1,196 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+	"github.com/haidinhtuan/kubernetes-controller/internal/retry"
+)
+
+// Placement modes, for spec.deploymentPlacement and spec.statefulSetPlacement.
+const (
+	placementNone      = "None"
+	placementPreferred = "Preferred"
+	placementRequired  = "Required"
+)
+
+// podDeletionCostAnnotation ranks pods for removal when a ReplicaSet scales
+// down; the pod with the lowest cost goes first.
+const podDeletionCostAnnotation = "controller.kubernetes.io/pod-deletion-cost"
+
+const (
+	// shadowAdoptTimeout bounds the wait for the ReplicaSet to adopt the
+	// released shadow pod. Past it, adoption is retried under
+	// spec.retryPolicy before the migration fails.
+	shadowAdoptTimeout = 10 * time.Second
+
+	// shadowAdoptPollInterval is how often adoption is checked.
+	shadowAdoptPollInterval = time.Second
+)
+
+// validateDeploymentPlacement rejects spec.deploymentPlacement values the
+// controller cannot act on.
+func validateDeploymentPlacement(m *migrationv1alpha1.StatefulMigration) error {
+	switch mode := m.Spec.DeploymentPlacement; mode {
+	case "", placementNone, placementPreferred, placementRequired:
+		return nil
+	default:
+		return fmt.Errorf("spec.deploymentPlacement %q must be None, Preferred or Required", mode)
+	}
+}
+
+// adoptShadow hands the shadow pod of a Deployment migration to the source
+// pod's ReplicaSet. The source is given the lowest deletion cost, so if the
+// ReplicaSet scales down after adopting the shadow it removes the source.
+// The shadow is then released from the migration's ownership, and the
+// ReplicaSet controller adopts it because it carries the source's labels.
+// Returns done=true once the shadow is adopted. The source is only deleted
+// after that: deleting it next to an orphaned shadow would leave the
+// ReplicaSet to replace it while the shadow keeps consuming.
+func (r *StatefulMigrationReconciler) adoptShadow(ctx context.Context, m *migrationv1alpha1.StatefulMigration) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+
+	shadow := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: m.Status.TargetPod, Namespace: m.Namespace}, shadow); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, true, nil
+		}
+		return ctrl.Result{}, false, err
+	}
+	if owner := metav1.GetControllerOf(shadow); owner != nil && owner.Kind == "ReplicaSet" {
+		return ctrl.Result{}, true, nil
+	}
+
+	releasedStr, released := m.Status.PhaseTimings["Finalizing.shadowReleased"]
+	if !released {
+		sourcePod := &corev1.Pod{}
+		err := r.Get(ctx, types.NamespacedName{Name: m.Spec.SourcePod, Namespace: m.Namespace}, sourcePod)
+		if err == nil {
+			podPatch := client.MergeFrom(sourcePod.DeepCopy())
+			if sourcePod.Annotations == nil {
+				sourcePod.Annotations = map[string]string{}
+			}
+			sourcePod.Annotations[podDeletionCostAnnotation] = strconv.Itoa(math.MinInt32)
+			if err := r.Patch(ctx, sourcePod, podPatch); err != nil && !errors.IsNotFound(err) {
+				return ctrl.Result{}, false, err
+			}
+		} else if !errors.IsNotFound(err) {
+			return ctrl.Result{}, false, err
+		}
+
+		filtered := make([]metav1.OwnerReference, 0, len(shadow.OwnerReferences))
+		for _, ref := range shadow.OwnerReferences {
+			if ref.Kind != "StatefulMigration" {
+				filtered = append(filtered, ref)
+			}
+		}
+		podPatch := client.MergeFrom(shadow.DeepCopy())
+		shadow.OwnerReferences = filtered
+		if err := r.Patch(ctx, shadow, podPatch); err != nil {
+			return ctrl.Result{}, false, err
+		}
+
+		patch := client.MergeFrom(m.DeepCopy())
+		ensurePhaseTimings(m)
+		releasedStr = time.Now().Format(time.RFC3339)
+		m.Status.PhaseTimings["Finalizing.shadowReleased"] = releasedStr
+		if err := r.Status().Patch(ctx, m, patch); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		logger.Info("Released shadow pod for adoption by the ReplicaSet", "pod", shadow.Name, "deployment", m.Status.DeploymentName)
+	}
+
+	if releasedAt, err := time.Parse(time.RFC3339, releasedStr); err == nil && time.Since(releasedAt) <= shadowAdoptTimeout {
+		logger.Info("Waiting for ReplicaSet to adopt shadow pod", "pod", shadow.Name)
+		return ctrl.Result{RequeueAfter: shadowAdoptPollInterval}, false, nil
+	}
+	err := retry.MarkTransient(fmt.Errorf("shadow pod %s was not adopted by a ReplicaSet of Deployment %s within %s; source pod %s is kept",
+		shadow.Name, m.Status.DeploymentName, shadowAdoptTimeout, m.Spec.SourcePod))
+	result, err := r.RetryOrFail(ctx, m, "adopt shadow pod", err)
+	return result, false, err
+}
+
+// placeDeployment records the target node in the Deployment's pod template
+// according to spec.deploymentPlacement. Existing affinity is kept: a
+// preferred term is appended, and a required expression is added to every
+// existing node selector term. Returns false when nothing changed, including
+// when the node is already recorded.
+func placeDeployment(deploy *appsv1.Deployment, mode, node string) bool {
+	return placePodSpec(&deploy.Spec.Template.Spec, mode, node)
+}
+
+// placePodSpec adds the node affinity placeDeployment describes to a pod
+// template spec.
+func placePodSpec(spec *corev1.PodSpec, mode, node string) bool {
+	if mode != placementPreferred && mode != placementRequired {
+		return false
+	}
+	expr := corev1.NodeSelectorRequirement{
+		Key:      hostnameLabel,
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   []string{node},
+	}
+
+	if spec.Affinity == nil {
+		spec.Affinity = &corev1.Affinity{}
+	}
+	if spec.Affinity.NodeAffinity == nil {
+		spec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	na := spec.Affinity.NodeAffinity
+
+	if mode == placementPreferred {
+		for _, term := range na.PreferredDuringSchedulingIgnoredDuringExecution {
+			if hasRequirement(term.Preference.MatchExpressions, expr) {
+				return false
+			}
+		}
+		na.PreferredDuringSchedulingIgnoredDuringExecution = append(na.PreferredDuringSchedulingIgnoredDuringExecution,
+			corev1.PreferredSchedulingTerm{
+				Weight:     100,
+				Preference: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{expr}},
+			})
+		return true
+	}
+
+	// Required terms are ORed, so the node is ANDed into each of them.
+	if na.RequiredDuringSchedulingIgnoredDuringExecution == nil ||
+		len(na.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms) == 0 {
+		na.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{}},
+		}
+	}
+	changed := false
+	terms := na.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	for i := range terms {
+		if !hasRequirement(terms[i].MatchExpressions, expr) {
+			terms[i].MatchExpressions = append(terms[i].MatchExpressions, expr)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// hasRequirement reports whether exprs already contains want.
+func hasRequirement(exprs []corev1.NodeSelectorRequirement, want corev1.NodeSelectorRequirement) bool {
+	for _, e := range exprs {
+		if e.Key == want.Key && e.Operator == want.Operator &&
+			len(e.Values) == len(want.Values) && (len(e.Values) == 0 || e.Values[0] == want.Values[0]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,1156 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+	"github.com/haidinhtuan/kubernetes-controller/pkg/protocol"
+)
+
+// ---------------------------------------------------------------------------
+// Identity swap sub-phases (ShadowPod + StatefulSet)
+// ---------------------------------------------------------------------------
+
+// identitySwap runs the identity swap of shadowPodStrategy.Finalize: the
+// shadow pod is checkpointed again and restored under the source's name as
+// the replacement pod, which the StatefulSet then adopts. Progress is kept
+// in status.swapSubPhase and spec.identitySwapMode picks the sub-phases. It
+// returns done once the replacement pod is the target and the sub-phase is
+// cleared.
+func (s shadowPodStrategy) identitySwap(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, base client.Object) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+
+	// Sub-phase chaining loop: when a sub-phase completes synchronously
+	// (Requeue: true, no delay), re-fetch and immediately dispatch the next
+	// sub-phase instead of going back through the main reconcile loop.
+	for {
+		var result ctrl.Result
+		var done bool
+		var err error
+
+		if m.Spec.Abort && m.Status.SwapSubPhase != "" {
+			if abortSafe(m) {
+				result, err = r.handleAbort(ctx, m)
+				return result, false, err
+			}
+			r.deferAbort(ctx, m)
+		}
+		if m.Status.SwapSubPhase != "" {
+			if expired := r.checkDeadlines(ctx, m); expired != "" {
+				result, err = r.handleDeadlineExceeded(ctx, m, expired)
+				return result, false, err
+			}
+		}
+
+		switch m.Status.SwapSubPhase {
+		case "":
+			if m.Status.ReplacementPod != "" {
+				return ctrl.Result{}, true, nil
+			}
+			result, done, err = s.swapPrepare(ctx, r, m, base)
+		case "PrepareSwap":
+			result, done, err = s.swapPrepare(ctx, r, m, base)
+		case "ReCheckpoint":
+			result, done, err = s.swapReCheckpoint(ctx, r, m, base)
+		case "SwapTransfer":
+			result, done, err = s.swapTransfer(ctx, r, m, base)
+		case "CreateReplacement":
+			result, done, err = s.swapCreateReplacement(ctx, r, m, base)
+		case "MiniReplay":
+			result, done, err = s.swapMiniReplay(ctx, r, m, base)
+		case "TrafficSwitch":
+			result, done, err = s.swapTrafficSwitch(ctx, r, m, base)
+		// Exchange-Fence sub-phases
+		case "PreFenceDrain":
+			result, done, err = s.swapPreFenceDrain(ctx, r, m, base)
+		case "ExchangeFence":
+			result, done, err = s.swapExchangeFence(ctx, r, m, base)
+		case "ParallelDrain":
+			result, done, err = s.swapParallelDrain(ctx, r, m, base)
+		case "FenceCutover":
+			result, done, err = s.swapFenceCutover(ctx, r, m, base)
+		default:
+			logger.Error(nil, "Unknown swap sub-phase", "subPhase", m.Status.SwapSubPhase)
+			return ctrl.Result{}, true, nil
+		}
+
+		// Return immediately on error, completion, delayed requeue, or no requeue
+		if err != nil || done || result.RequeueAfter > 0 || !result.Requeue {
+			return result, done, err
+		}
+
+		// Requeue: true means sub-phase completed synchronously.
+		// Re-fetch and continue to the next sub-phase.
+		key := client.ObjectKeyFromObject(m)
+		if fetchErr := r.Get(ctx, key, m); fetchErr != nil {
+			return ctrl.Result{}, false, fetchErr
+		}
+		base = m.DeepCopy()
+	}
+}
+
+// swapPrepare creates a secondary queue to buffer messages during the swap.
+func (s shadowPodStrategy) swapPrepare(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, base client.Object) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+
+	mqCfg := m.Spec.MessageQueueConfig
+
+	// Reconnect to broker if needed (Finalizing may have closed it in a previous attempt)
+	if err := r.MsgClient.Connect(ctx, mqCfg.BrokerURL); err != nil {
+		return ctrl.Result{}, false, fmt.Errorf("broker connect for swap: %w", err)
+	}
+
+	// Create a swap-specific secondary queue for buffering during the identity swap
+	if _, err := r.MsgClient.CreateSecondaryQueue(ctx, mqCfg.QueueName, mqCfg.ExchangeName, mqCfg.RoutingKey); err != nil {
+		return ctrl.Result{}, false, fmt.Errorf("create swap queue: %w", err)
+	}
+
+	logger.Info("PrepareSwap complete, swap queue created")
+
+	// Hold the source ordinal early so its removal overlaps with
+	// re-checkpoint + transfer. This saves ~7-15s from the accumulation
+	// window (less time for messages to accumulate in the swap queue).
+	if m.Status.StatefulSetName != "" {
+		if holdErr := r.HoldOrdinal(ctx, m); holdErr != nil {
+			logger.Error(holdErr, "Failed to hold StatefulSet ordinal early, will retry in CreateReplacement")
+		} else {
+			// Pin the template so STS generates correct ControllerRevision
+			if pinErr := r.pinTemplate(ctx, m); pinErr != nil {
+				logger.Error(pinErr, "Failed to pin StatefulSet template, will retry in CreateReplacement")
+			}
+			logger.Info("Held StatefulSet ordinal early in PrepareSwap",
+				"statefulset", m.Status.StatefulSetName, "targetNode", m.Spec.TargetNode)
+
+			// Force-delete the source pod immediately with 0s grace to
+			// avoid the default 30s graceful termination.
+			// Remove Service labels first (traffic bridge) so traffic
+			// shifts to shadow pod before the pod disappears.
+			sourcePod := &corev1.Pod{}
+			if getErr := r.Get(ctx, types.NamespacedName{Name: m.Spec.SourcePod, Namespace: m.Namespace}, sourcePod); getErr == nil {
+				if sourcePod.Labels != nil {
+					podPatch := client.MergeFrom(sourcePod.DeepCopy())
+					changed := false
+					for k := range m.Status.SourcePodLabels {
+						if _, has := sourcePod.Labels[k]; has {
+							if k == "controller-revision-hash" ||
+								k == "statefulset.kubernetes.io/pod-name" ||
+								k == "apps.kubernetes.io/pod-index" {
+								continue
+							}
+							delete(sourcePod.Labels, k)
+							changed = true
+						}
+					}
+					if changed {
+						if labelErr := r.Patch(ctx, sourcePod, podPatch); labelErr != nil {
+							logger.Error(labelErr, "Failed to remove Service labels in PrepareSwap")
+						} else {
+							logger.Info("Removed Service labels from source pod in PrepareSwap", "pod", m.Spec.SourcePod)
+						}
+					}
+				}
+
+				gracePeriod := int64(0)
+				if delErr := r.Delete(ctx, sourcePod, &client.DeleteOptions{
+					GracePeriodSeconds: &gracePeriod,
+				}); delErr != nil && !errors.IsNotFound(delErr) {
+					logger.Error(delErr, "Failed to force-delete source pod in PrepareSwap")
+				} else {
+					logger.Info("Force-deleted source pod in PrepareSwap", "pod", m.Spec.SourcePod)
+				}
+			}
+		}
+	}
+
+	// Transition to ReCheckpoint
+	patch := client.MergeFrom(m.DeepCopy())
+	m.Status.SwapSubPhase = "ReCheckpoint"
+	if err := r.Status().Patch(ctx, m, patch); err != nil {
+		return ctrl.Result{}, false, err
+	}
+
+	return ctrl.Result{Requeue: true}, false, nil
+}
+
+// swapReCheckpoint triggers a CRIU checkpoint on the shadow pod (same node, no transfer).
+func (s shadowPodStrategy) swapReCheckpoint(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, base client.Object) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+
+	// The shadow pod is on the target node (where it was restored to during migration)
+	targetNode := m.Spec.TargetNode
+
+	checkpointID, backend, err := r.checkpointContainer(ctx, m, targetNode, m.Status.TargetPod)
+	if err != nil {
+		// Re-checkpoint of CRIU-restored containers fails with CRIU error -52
+		// due to reconstructed TCP socket states after restore. This is a known
+		// CRIU limitation: checkpointing a process that was itself restored from
+		// a CRIU checkpoint produces socket states that CRIU cannot serialize again.
+		// Fall back to the original checkpoint image — the replacement pod will
+		// replay from the pre-migration state via the swap queue.
+		logger.Info("Re-checkpoint failed, falling back to original checkpoint image",
+			"error", err.Error())
+		patch := client.MergeFrom(m.DeepCopy())
+		m.Status.SwapSubPhase = "CreateReplacement"
+		m.Status.PhaseTimings["Swap.ReCheckpoint.fallback"] = "true"
+		if err := r.Status().Patch(ctx, m, patch); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		logger.Info("Skipping SwapTransfer (using original checkpoint image)")
+		return ctrl.Result{Requeue: true}, false, nil
+	}
+	patch := client.MergeFrom(m.DeepCopy())
+	m.Status.CheckpointID = checkpointID
+	m.Status.CheckpointBackend = backend
+	m.Status.SwapSubPhase = "SwapTransfer"
+	if err := r.Status().Patch(ctx, m, patch); err != nil {
+		return ctrl.Result{}, false, err
+	}
+
+	logger.Info("ReCheckpoint complete", "shadowPod", m.Status.TargetPod, "checkpointID", m.Status.CheckpointID)
+	return ctrl.Result{Requeue: true}, false, nil
+}
+
+// swapTransfer loads the re-checkpoint into the target node's local
+// containers-storage. It first tries a direct HTTP call to the ms2m-agent
+// DaemonSet on the target node (fast path). Falls back to a Job if no agent
+// is available.
+func (s shadowPodStrategy) swapTransfer(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, base client.Object) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+
+	imageTag := fmt.Sprintf("localhost/checkpoint/%s:recheckpoint", m.Status.ContainerName)
+
+	// Fast path: direct HTTP call to ms2m-agent on target node
+	agentIP, agentErr := r.findAgentPodIP(ctx, m.Spec.TargetNode)
+	if agentErr == nil {
+		if err := r.callAgentLocalLoad(ctx, agentIP, m.Status.CheckpointID, m.Status.ContainerName, imageTag); err != nil {
+			return ctrl.Result{}, false, fmt.Errorf("agent local-load: %w", err)
+		}
+
+		logger.Info("Swap local-load complete via agent", "imageTag", imageTag)
+		patch := client.MergeFrom(m.DeepCopy())
+		m.Status.SwapSubPhase = "CreateReplacement"
+		if err := r.Status().Patch(ctx, m, patch); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		return ctrl.Result{Requeue: true}, false, nil
+	}
+
+	logger.Info("No ms2m-agent found, falling back to swap transfer Job", "node", m.Spec.TargetNode, "err", agentErr)
+	return s.swapTransferViaJob(ctx, r, m, base, imageTag)
+}
+
+// swapTransferViaJob creates a Job to load the re-checkpoint into
+// containers-storage. Used when the ms2m-agent DaemonSet is not available.
+func (s shadowPodStrategy) swapTransferViaJob(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, base client.Object, imageTag string) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+
+	jobName := m.Name + "-swap-transfer"
+
+	existingJob := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Name: jobName, Namespace: m.Namespace}, existingJob)
+
+	if errors.IsNotFound(err) {
+		jobSpec := r.effectiveTransferJob(m)
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      jobName,
+				Namespace: m.Namespace,
+				Labels: map[string]string{
+					"migration.ms2m.io/migration": m.Name,
+					"migration.ms2m.io/phase":     "swap-transfer",
+				},
+				OwnerReferences: []metav1.OwnerReference{
+					*metav1.NewControllerRef(m, migrationv1alpha1.GroupVersion.WithKind("StatefulMigration")),
+				},
+			},
+			Spec: batchv1.JobSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						RestartPolicy: corev1.RestartPolicyNever,
+						NodeSelector: map[string]string{
+							"kubernetes.io/hostname": m.Spec.TargetNode,
+						},
+						Containers: []corev1.Container{
+							{
+								Name:  "local-load",
+								Image: jobSpec.AgentImage,
+								Args:  []string{"local-load", m.Status.CheckpointID, m.Status.ContainerName, imageTag},
+								SecurityContext: &corev1.SecurityContext{
+									Privileged: func() *bool { b := true; return &b }(),
+									RunAsUser:  func() *int64 { uid := int64(0); return &uid }(),
+									RunAsGroup: func() *int64 { gid := int64(0); return &gid }(),
+								},
+								VolumeMounts: []corev1.VolumeMount{
+									{
+										Name:      "checkpoints",
+										MountPath: "/var/lib/kubelet/checkpoints",
+										ReadOnly:  true,
+									},
+									{
+										Name:      "containers-storage",
+										MountPath: "/var/lib/containers/storage",
+									},
+								},
+							},
+						},
+						Volumes: []corev1.Volume{
+							{
+								Name: "checkpoints",
+								VolumeSource: corev1.VolumeSource{
+									HostPath: &corev1.HostPathVolumeSource{
+										Path: jobSpec.CheckpointHostPath,
+									},
+								},
+							},
+							{
+								Name: "containers-storage",
+								VolumeSource: corev1.VolumeSource{
+									HostPath: &corev1.HostPathVolumeSource{
+										Path: "/var/lib/containers/storage",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		applyTransferJobSpec(job, jobSpec)
+
+		if err := r.Create(ctx, job); err != nil {
+			if errors.IsAlreadyExists(err) {
+				return ctrl.Result{RequeueAfter: 2 * time.Second}, false, nil
+			}
+			return ctrl.Result{}, false, fmt.Errorf("create swap transfer job: %w", err)
+		}
+
+		logger.Info("Created swap local-load job", "job", jobName, "imageTag", imageTag)
+		return ctrl.Result{RequeueAfter: 2 * time.Second}, false, nil
+	} else if err != nil {
+		return ctrl.Result{}, false, err
+	}
+
+	if existingJob.Status.Succeeded >= 1 {
+		logger.Info("Swap local-load job completed", "job", jobName)
+		patch := client.MergeFrom(m.DeepCopy())
+		m.Status.SwapSubPhase = "CreateReplacement"
+		if err := r.Status().Patch(ctx, m, patch); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		return ctrl.Result{Requeue: true}, false, nil
+	}
+
+	if failed, reason := jobFailed(existingJob); failed {
+		res, err := r.failMigration(ctx, m, fmt.Sprintf("swap local-load job %q failed: %s", jobName, reason))
+		return res, false, err
+	}
+
+	logger.Info("Waiting for swap local-load job", "job", jobName)
+	return ctrl.Result{RequeueAfter: 2 * time.Second}, false, nil
+}
+
+// swapCreateReplacement creates a pod with the correct StatefulSet name
+// (e.g., consumer-0) from the re-checkpoint image. The pod is owned by the
+// migration until the held ordinal is released, then the StatefulSet adopts it.
+//
+// For ShadowPod+StatefulSet, the original pod may still be running on the
+// source node. Its ordinal is held so it can be removed before the
+// replacement is created on the target node.
+func (s shadowPodStrategy) swapCreateReplacement(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, base client.Object) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+
+	// The replacement pod gets the original StatefulSet pod name
+	replacementName := m.Spec.SourcePod // e.g., "consumer-0"
+
+	// Check if a pod with the replacement name already exists
+	existing := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{Name: replacementName, Namespace: m.Namespace}, existing)
+	if err == nil && heldPlaceholder(existing) {
+		// The StatefulSet recreated the held ordinal behind its scheduling
+		// gate. Free the name and create the replacement in this pass.
+		if delErr := r.deletePlaceholder(ctx, existing); delErr != nil {
+			return ctrl.Result{}, false, delErr
+		}
+		err = errors.NewNotFound(corev1.Resource("pods"), replacementName)
+	}
+	if err == nil {
+		// Pod exists — distinguish between the original (source node) and a replacement we created (target node)
+		if existing.Spec.NodeName == m.Spec.TargetNode {
+			// This is the replacement pod we created. Hand the ordinal back
+			// so the StatefulSet adopts it, then wait for it to be Running.
+			if result, done, err := r.ReleaseOrdinal(ctx, m, replacementName); !done {
+				return result, false, err
+			}
+			if existing.Status.Phase == corev1.PodRunning {
+				patch := client.MergeFrom(m.DeepCopy())
+				m.Status.ReplacementPod = replacementName
+				// Route based on identity swap mode
+				if m.Spec.IdentitySwapMode == "ExchangeFence" {
+					m.Status.SwapSubPhase = "PreFenceDrain"
+				} else {
+					m.Status.SwapSubPhase = "MiniReplay"
+				}
+				if err := r.Status().Patch(ctx, m, patch); err != nil {
+					return ctrl.Result{}, false, err
+				}
+				return ctrl.Result{Requeue: true}, false, nil
+			}
+			// Still starting up
+			logger.Info("Waiting for replacement pod to become Running", "pod", replacementName, "phase", existing.Status.Phase)
+			return ctrl.Result{RequeueAfter: 1 * time.Second}, false, nil
+		}
+
+		// This is the original pod on the source node. Hold its ordinal so
+		// the StatefulSet does not bring it back, and update the nodeSelector NOW
+		// so that the STS creates its ControllerRevision for the target node
+		// before we create the replacement pod. This prevents a revision hash
+		// mismatch that would trigger a rolling update after adoption.
+		if m.Status.StatefulSetName != "" {
+			if err := r.HoldOrdinal(ctx, m); err != nil {
+				return ctrl.Result{}, false, fmt.Errorf("hold StatefulSet ordinal for identity swap: %w", err)
+			}
+			if err := r.pinTemplate(ctx, m); err != nil && !errors.IsNotFound(err) {
+				return ctrl.Result{}, false, err
+			}
+		}
+
+		// Remove Service-matching labels from the original pod BEFORE
+		// deleting it. This removes the pod from the Service endpoints,
+		// so DNS resolves only to the shadow pod's IP. Traffic seamlessly
+		// shifts to the shadow pod with no gap.
+		if existing.Labels != nil {
+			podPatch := client.MergeFrom(existing.DeepCopy())
+			changed := false
+			for k := range m.Status.SourcePodLabels {
+				if _, has := existing.Labels[k]; has {
+					// Keep StatefulSet-internal labels — only remove
+					// labels that could match a Service selector.
+					if k == "controller-revision-hash" ||
+						k == "statefulset.kubernetes.io/pod-name" ||
+						k == "apps.kubernetes.io/pod-index" {
+						continue
+					}
+					delete(existing.Labels, k)
+					changed = true
+				}
+			}
+			if changed {
+				if patchErr := r.Patch(ctx, existing, podPatch); patchErr != nil {
+					logger.Error(patchErr, "Failed to remove Service labels from original pod")
+				} else {
+					logger.Info("Removed Service labels from original pod for traffic drain", "pod", replacementName)
+				}
+			}
+		}
+
+		// Force-delete the original pod with a short grace period.
+		// Its state is already re-checkpointed, so graceful shutdown
+		// adds no value and the default 30s grace period dominates
+		// the identity swap duration.
+		gracePeriod := int64(0)
+		if delErr := r.Delete(ctx, existing, &client.DeleteOptions{
+			GracePeriodSeconds: &gracePeriod,
+		}); delErr != nil && !errors.IsNotFound(delErr) {
+			logger.Error(delErr, "Failed to force-delete original pod", "pod", replacementName)
+		}
+
+		logger.Info("Waiting for original pod to terminate", "pod", replacementName, "node", existing.Spec.NodeName)
+		return ctrl.Result{RequeueAfter: 2 * time.Second}, false, nil
+	}
+	if !errors.IsNotFound(err) {
+		return ctrl.Result{}, false, err
+	}
+
+	// Use the re-checkpoint image if SwapTransfer ran, otherwise fall back
+	// to the original checkpoint image from the registry.
+	var checkpointImage string
+	var pullPolicy corev1.PullPolicy
+	if m.Status.PhaseTimings["Swap.ReCheckpoint.fallback"] == "true" {
+		checkpointImage, pullPolicy = registryCheckpointImage(m)
+	} else {
+		checkpointImage = fmt.Sprintf("localhost/checkpoint/%s:recheckpoint", m.Status.ContainerName)
+		pullPolicy = corev1.PullNever
+	}
+
+	// Build the spec from the source pod spec captured during Pending.
+	// Set MS2M_RESTORE_MODE=true so the CRIU-restored process blocks on the
+	// primary queue until START_REPLAY arrives. Without this, the replacement
+	// pod immediately reconnects to primary after restore, racing with the
+	// shadow pod and causing duplicate consumption.
+	restoreModeEnv := corev1.EnvVar{Name: "MS2M_RESTORE_MODE", Value: "true"}
+
+	// Build labels from source pod labels (for Service routing + StatefulSet adoption)
+	// Do NOT include migration labels — this pod should look like a normal StatefulSet pod
+	labels := make(map[string]string)
+	for k, v := range m.Status.SourcePodLabels {
+		labels[k] = v
+	}
+
+	// Use the STS's current updateRevision as the controller-revision-hash so
+	// the StatefulSet doesn't trigger a rolling update after adopting this pod.
+	// The nodeSelector was already updated when the ordinal was held, so
+	// updateRevision reflects the target-node template.
+	if m.Status.StatefulSetName != "" {
+		sts := &appsv1.StatefulSet{}
+		if stsErr := r.Get(ctx, types.NamespacedName{Name: m.Status.StatefulSetName, Namespace: m.Namespace}, sts); stsErr == nil {
+			if sts.Status.UpdateRevision != "" {
+				labels["controller-revision-hash"] = sts.Status.UpdateRevision
+				logger.Info("Set replacement pod revision hash from STS", "revision", sts.Status.UpdateRevision)
+			}
+		}
+	}
+
+	newPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      replacementName,
+			Namespace: m.Namespace,
+			Labels:    labels,
+			// Owned by the migration while the ordinal is held; released
+			// for StatefulSet adoption once the pod exists.
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(m, migrationv1alpha1.GroupVersion.WithKind("StatefulMigration")),
+			},
+		},
+		Spec: restoredPodSpec(m, sourcePodSpec(m), checkpointImage, pullPolicy, true, restoreModeEnv),
+	}
+
+	if err := r.Create(ctx, newPod); err != nil {
+		if errors.IsAlreadyExists(err) {
+			return ctrl.Result{RequeueAfter: 1 * time.Second}, false, nil
+		}
+		return ctrl.Result{}, false, fmt.Errorf("create replacement pod: %w", err)
+	}
+
+	// Record the replacement pod name
+	patch := client.MergeFrom(m.DeepCopy())
+	m.Status.ReplacementPod = replacementName
+	if err := r.Status().Patch(ctx, m, patch); err != nil {
+		return ctrl.Result{}, false, err
+	}
+
+	logger.Info("Created replacement pod", "pod", replacementName, "node", m.Spec.TargetNode)
+	return ctrl.Result{RequeueAfter: 1 * time.Second}, false, nil
+}
+
+// swapMiniReplay sends START_REPLAY to the replacement pod and monitors
+// the swap queue depth. Once drained, transitions to TrafficSwitch.
+func (s shadowPodStrategy) swapMiniReplay(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, base client.Object) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+	ensurePhaseTimings(m)
+
+	swapQueue := m.Spec.MessageQueueConfig.QueueName + ".ms2m-replay"
+
+	// Send START_REPLAY on first entry (track with a phase timing key)
+	if _, ok := m.Status.PhaseTimings["Swap.MiniReplay.start"]; !ok {
+		// Unbind the swap queue from the exchange BEFORE starting replay.
+		// This stops new messages from arriving so the queue has a fixed
+		// set of messages to drain (only those buffered during re-checkpoint
+		// + transfer + create replacement). Without this, the queue grows
+		// indefinitely at high message rates and hits the cutoff timer.
+		if !controlPending(m, "Swap.MiniReplay", protocol.ControlStartReplay) {
+			if err := r.MsgClient.UnbindQueue(ctx, swapQueue, m.Spec.MessageQueueConfig.ExchangeName); err != nil {
+				logger.Error(err, "Failed to unbind swap queue, continuing anyway")
+			}
+		}
+
+		payload := map[string]interface{}{
+			"queue": swapQueue,
+		}
+		result, acked, err := r.awaitControl(ctx, m, "Swap.MiniReplay", m.Status.ReplacementPod, protocol.ControlStartReplay, payload)
+		if err != nil || !acked {
+			return result, false, err
+		}
+
+		patch := client.MergeFrom(m.DeepCopy())
+		ensurePhaseTimings(m) // the ack patches may have dropped an empty map
+		m.Status.PhaseTimings["Swap.MiniReplay.start"] = time.Now().Format(time.RFC3339)
+		_ = r.Status().Patch(ctx, m, patch)
+	}
+
+	// Poll the swap queue depth
+	depth, err := r.MsgClient.GetQueueDepth(ctx, swapQueue)
+	if err != nil {
+		return ctrl.Result{}, false, fmt.Errorf("get swap queue depth: %w", err)
+	}
+
+	// Short cutoff for MiniReplay: the queue is already unbound (fixed
+	// message set), so this only guards against consumer stalls. The 15s
+	// default is enough to drain the ~10s of buffered messages; if the
+	// consumer can't keep up, the main Replay cutoff already accepted that.
+	cutoff := miniReplayCutoff(m)
+	var elapsed time.Duration
+	if startStr, ok := m.Status.PhaseTimings["Swap.MiniReplay.start"]; ok {
+		if startTime, parseErr := time.Parse(time.RFC3339, startStr); parseErr == nil {
+			elapsed = time.Since(startTime)
+		}
+	}
+
+	logger.Info("Swap replay queue depth", "queue", swapQueue, "depth", depth, "elapsed", elapsed.Round(time.Millisecond))
+
+	if depth == 0 || elapsed > cutoff {
+		if depth > 0 {
+			logger.Info("MiniReplay cutoff reached, proceeding with remaining messages", "depth", depth, "elapsed", elapsed)
+		}
+		// Queue drained or cutoff — transition to TrafficSwitch
+		patch := client.MergeFrom(m.DeepCopy())
+		delete(m.Status.PhaseTimings, "Swap.MiniReplay.start")
+		m.Status.SwapSubPhase = "TrafficSwitch"
+		if err := r.Status().Patch(ctx, m, patch); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		return ctrl.Result{Requeue: true}, false, nil
+	}
+
+	// Still draining
+	return ctrl.Result{RequeueAfter: 1 * time.Second}, false, nil
+}
+
+// swapTrafficSwitch deletes the shadow pod, sends END_REPLAY to the
+// replacement, scales up the StatefulSet for adoption, and cleans up the swap queue.
+func (s shadowPodStrategy) swapTrafficSwitch(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, base client.Object) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+
+	// Send END_REPLAY to the replacement pod
+	if err := r.notify(ctx, m, m.Status.ReplacementPod, protocol.ControlEndReplay, nil); err != nil {
+		logger.Error(err, "Failed to send END_REPLAY to replacement pod, continuing anyway")
+	}
+
+	// Delete the swap secondary queue
+	swapQueue := m.Spec.MessageQueueConfig.QueueName + ".ms2m-replay"
+	if err := r.MsgClient.DeleteSecondaryQueue(ctx, swapQueue, m.Spec.MessageQueueConfig.QueueName, m.Spec.MessageQueueConfig.ExchangeName); err != nil {
+		logger.Error(err, "Failed to delete swap queue, continuing anyway")
+	}
+
+	// Force-delete the shadow pod with a short grace period so that a
+	// subsequent migration doesn't wait for the default 30s termination.
+	shadowPod := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: m.Status.TargetPod, Namespace: m.Namespace}, shadowPod); err == nil {
+		gracePeriod := int64(0)
+		if err := r.Delete(ctx, shadowPod, &client.DeleteOptions{
+			GracePeriodSeconds: &gracePeriod,
+		}); err != nil {
+			logger.Error(err, "Failed to delete shadow pod", "pod", m.Status.TargetPod)
+		} else {
+			logger.Info("Deleted shadow pod", "pod", m.Status.TargetPod)
+		}
+	} else if !errors.IsNotFound(err) {
+		return ctrl.Result{}, false, err
+	}
+
+	// The ordinal was released when the replacement was created; this only
+	// finishes a release that was interrupted.
+	if result, done, err := r.ReleaseOrdinal(ctx, m, m.Status.ReplacementPod); !done {
+		return result, false, err
+	}
+	if result, done, err := r.settleTemplate(ctx, m, m.Status.ReplacementPod); !done {
+		return result, false, err
+	}
+
+	// Update the TargetPod to point to the replacement (it's the final pod)
+	patch := client.MergeFrom(m.DeepCopy())
+	m.Status.TargetPod = m.Status.ReplacementPod
+	m.Status.SwapSubPhase = ""
+	if err := r.Status().Patch(ctx, m, patch); err != nil {
+		return ctrl.Result{}, false, err
+	}
+
+	logger.Info("TrafficSwitch complete, identity swap finished", "replacementPod", m.Status.ReplacementPod)
+	return ctrl.Result{}, true, nil
+}
+
+// ---------------------------------------------------------------------------
+// Exchange-Fence Convergence sub-phases
+// ---------------------------------------------------------------------------
+
+// swapPreFenceDrain starts pre-fence consumption of the swap queue by
+// the replacement pod. It monitors queue depth to measure R_in (publish rate)
+// and R_out (consumption rate), then uses the adaptive decision function to
+// choose Exchange-Fence or fall back to Cutoff (MiniReplay).
+//
+// Adaptive strategy: estimate fence drain time as
+//
+//	T_fence ≈ max(D_swap, D_primary) / R_net   where R_net = R_out - R_in
+//
+// If R_in ≥ R_out (ρ ≥ 1) or T_fence exceeds the fence time threshold
+// (timeouts.exchangeFence.fenceTimeThresholdSeconds, default 60s), fall back
+// to Cutoff.
+func (s shadowPodStrategy) swapPreFenceDrain(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, base client.Object) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+	ensurePhaseTimings(m)
+
+	mqCfg := m.Spec.MessageQueueConfig
+	swapQueue := mqCfg.QueueName + ".ms2m-replay"
+
+	// Send START_REPLAY and record initial depth on first entry
+	if _, ok := m.Status.PhaseTimings["Swap.PreFence.start"]; !ok {
+		// Get initial swap queue depth before consumption starts
+		initialDepth, err := r.MsgClient.GetQueueDepth(ctx, swapQueue)
+		if err != nil {
+			return ctrl.Result{}, false, fmt.Errorf("get initial swap depth: %w", err)
+		}
+
+		payload := map[string]interface{}{
+			"queue": swapQueue,
+		}
+		result, acked, err := r.awaitControl(ctx, m, "Swap.PreFenceDrain", m.Status.ReplacementPod, protocol.ControlStartReplay, payload)
+		if err != nil || !acked {
+			return result, false, err
+		}
+
+		patch := client.MergeFrom(m.DeepCopy())
+		ensurePhaseTimings(m) // the ack patches may have dropped an empty map
+		m.Status.PhaseTimings["Swap.PreFence.start"] = time.Now().Format(time.RFC3339)
+		m.Status.PhaseTimings["Swap.PreFence.initialDepth"] = fmt.Sprintf("%d", initialDepth)
+		_ = r.Status().Patch(ctx, m, patch)
+	}
+
+	// Measure current swap queue depth
+	currentDepth, err := r.MsgClient.GetQueueDepth(ctx, swapQueue)
+	if err != nil {
+		return ctrl.Result{}, false, fmt.Errorf("get swap queue depth for pre-fence: %w", err)
+	}
+
+	var elapsed time.Duration
+	if startStr, ok := m.Status.PhaseTimings["Swap.PreFence.start"]; ok {
+		if startTime, parseErr := time.Parse(time.RFC3339, startStr); parseErr == nil {
+			elapsed = time.Since(startTime)
+		}
+	}
+
+	logger.Info("PreFenceDrain status", "queue", swapQueue, "depth", currentDepth, "elapsed", elapsed.Round(time.Millisecond))
+
+	// Wait at least the observation window to collect meaningful rate samples
+	if elapsed < preFenceObservationWindow(m) {
+		return ctrl.Result{RequeueAfter: 1 * time.Second}, false, nil
+	}
+
+	// Adaptive decision: estimate R_in and R_out from depth change.
+	//
+	// Over the observation window:
+	//   - Consumer removed some messages (R_out × t)
+	//   - Producer added some messages (R_in × t)
+	//   - Net change: currentDepth - initialDepth = (R_in - R_out) × t
+	//   - If depth decreased: R_out > R_in (good for fence)
+	//   - If depth increased: R_in > R_out (fence would take too long)
+	initialDepth := 0
+	if depthStr, ok := m.Status.PhaseTimings["Swap.PreFence.initialDepth"]; ok {
+		fmt.Sscanf(depthStr, "%d", &initialDepth)
+	}
+
+	elapsedSec := elapsed.Seconds()
+	useFence := true
+	var reason string
+
+	if elapsedSec > 0 {
+		// Net drain rate: positive means queue is shrinking
+		netDrainRate := float64(initialDepth-currentDepth) / elapsedSec
+
+		// Also get primary queue depth for fence time estimation
+		primaryDepth, _ := r.MsgClient.GetQueueDepth(ctx, mqCfg.QueueName)
+
+		maxDepth := primaryDepth
+		if currentDepth > maxDepth {
+			maxDepth = currentDepth
+		}
+
+		if netDrainRate <= 0 {
+			// Queue growing or flat: R_in ≥ R_out (ρ ≥ 1)
+			useFence = false
+			reason = fmt.Sprintf("queue not draining (net rate %.1f msg/s)", netDrainRate)
+		} else if maxDepth > 0 {
+			// Estimate fence drain time
+			estimatedFenceTime := float64(maxDepth) / netDrainRate
+			threshold := fenceTimeThreshold(m).Seconds()
+			if estimatedFenceTime > threshold {
+				useFence = false
+				reason = fmt.Sprintf("estimated fence time %.0fs > %.0fs threshold", estimatedFenceTime, threshold)
+			} else {
+				reason = fmt.Sprintf("estimated fence time %.1fs (net drain %.1f msg/s)", estimatedFenceTime, netDrainRate)
+			}
+		}
+
+		logger.Info("Adaptive decision",
+			"initialDepth", initialDepth, "currentDepth", currentDepth,
+			"primaryDepth", primaryDepth, "netDrainRate", netDrainRate,
+			"useFence", useFence, "reason", reason)
+	}
+
+	patch := client.MergeFrom(m.DeepCopy())
+	delete(m.Status.PhaseTimings, "Swap.PreFence.start")
+	delete(m.Status.PhaseTimings, "Swap.PreFence.initialDepth")
+
+	if useFence {
+		m.Status.SwapSubPhase = "ExchangeFence"
+		logger.Info("Adaptive: proceeding with Exchange-Fence", "reason", reason)
+	} else {
+		// Fall back to Cutoff: unbind swap queue and use MiniReplay.
+		// Set MiniReplay.start so swapMiniReplay skips its init block
+		// (START_REPLAY was already sent and swap queue will be unbound here).
+		if unbindErr := r.MsgClient.UnbindQueue(ctx, swapQueue, mqCfg.ExchangeName); unbindErr != nil {
+			logger.Error(unbindErr, "Failed to unbind swap queue for Cutoff fallback")
+		}
+		m.Status.PhaseTimings["Swap.MiniReplay.start"] = time.Now().Format(time.RFC3339)
+		m.Status.SwapSubPhase = "MiniReplay"
+		logger.Info("Adaptive: falling back to MiniReplay (Cutoff)", "reason", reason)
+	}
+
+	if err := r.Status().Patch(ctx, m, patch); err != nil {
+		return ctrl.Result{}, false, err
+	}
+
+	return ctrl.Result{Requeue: true}, false, nil
+}
+
+// swapExchangeFence performs the atomic topology change:
+// 1. Create and bind a buffer queue to catch post-fence messages
+// 2. Unbind primary queue from exchange (shadow gets no new messages)
+// 3. Unbind swap queue from exchange (replacement gets no new messages)
+// Both queues now have a finite message set to drain.
+func (s shadowPodStrategy) swapExchangeFence(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, base client.Object) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+	ensurePhaseTimings(m)
+
+	mqCfg := m.Spec.MessageQueueConfig
+	swapQueue := mqCfg.QueueName + ".ms2m-replay"
+	bufferQueue := mqCfg.QueueName + ".ms2m-fence-buffer"
+
+	// Guard: if fence was already applied (e.g. controller restarted mid-fence),
+	// skip straight to recording depths and transitioning to ParallelDrain.
+	if _, alreadyFenced := m.Status.PhaseTimings["Swap.Fence.time"]; alreadyFenced {
+		logger.Info("Exchange-Fence: fence already applied, skipping to ParallelDrain")
+		patch := client.MergeFrom(m.DeepCopy())
+		m.Status.SwapSubPhase = "ParallelDrain"
+		if err := r.Status().Patch(ctx, m, patch); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		return ctrl.Result{Requeue: true}, false, nil
+	}
+
+	// Get current depths before fence for timeout estimation
+	primaryDepth, err := r.MsgClient.GetQueueDepth(ctx, mqCfg.QueueName)
+	if err != nil {
+		return ctrl.Result{}, false, fmt.Errorf("get primary depth before fence: %w", err)
+	}
+	swapDepth, err := r.MsgClient.GetQueueDepth(ctx, swapQueue)
+	if err != nil {
+		return ctrl.Result{}, false, fmt.Errorf("get swap depth before fence: %w", err)
+	}
+
+	logger.Info("Exchange-Fence: pre-fence depths", "primaryDepth", primaryDepth, "swapDepth", swapDepth)
+
+	// Step 1: Create buffer queue and bind to exchange.
+	// The buffer catches all messages published after the fence.
+	// DeclareAndBindQueue is idempotent in RabbitMQ (safe to re-call).
+	if err := r.MsgClient.DeclareAndBindQueue(ctx, bufferQueue, mqCfg.ExchangeName); err != nil {
+		return ctrl.Result{}, false, fmt.Errorf("create buffer queue: %w", err)
+	}
+
+	// Step 2: Unbind primary queue from exchange.
+	// UnbindQueue on an already-unbound queue is a no-op in RabbitMQ.
+	if err := r.MsgClient.UnbindQueue(ctx, mqCfg.QueueName, mqCfg.ExchangeName); err != nil {
+		return ctrl.Result{}, false, fmt.Errorf("unbind primary queue for fence: %w", err)
+	}
+
+	// Step 3: Unbind swap queue from exchange
+	if err := r.MsgClient.UnbindQueue(ctx, swapQueue, mqCfg.ExchangeName); err != nil {
+		return ctrl.Result{}, false, fmt.Errorf("unbind swap queue for fence: %w", err)
+	}
+
+	logger.Info("Exchange-Fence: topology change complete",
+		"primaryUnbound", mqCfg.QueueName,
+		"swapUnbound", swapQueue,
+		"bufferBound", bufferQueue)
+
+	// Record fence time and depths for parallel drain timeout
+	patch := client.MergeFrom(m.DeepCopy())
+	m.Status.PhaseTimings["Swap.Fence.time"] = time.Now().Format(time.RFC3339)
+	m.Status.PhaseTimings["Swap.Fence.primaryDepth"] = fmt.Sprintf("%d", primaryDepth)
+	m.Status.PhaseTimings["Swap.Fence.swapDepth"] = fmt.Sprintf("%d", swapDepth)
+	m.Status.SwapSubPhase = "ParallelDrain"
+	if err := r.Status().Patch(ctx, m, patch); err != nil {
+		return ctrl.Result{}, false, err
+	}
+
+	return ctrl.Result{Requeue: true}, false, nil
+}
+
+// swapParallelDrain waits for both the shadow (primary queue) and
+// replacement (swap queue) to drain their finite message sets to zero.
+// Uses timeout and stall detection to handle failures.
+func (s shadowPodStrategy) swapParallelDrain(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, base client.Object) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+	ensurePhaseTimings(m)
+
+	mqCfg := m.Spec.MessageQueueConfig
+	swapQueue := mqCfg.QueueName + ".ms2m-replay"
+
+	// Get both queue depths (ready + unacked for correctness)
+	primaryReady, primaryUnacked, err := r.MsgClient.GetQueueStats(ctx, mqCfg.QueueName)
+	if err != nil {
+		return ctrl.Result{}, false, fmt.Errorf("get primary queue stats: %w", err)
+	}
+	swapReady, swapUnacked, err := r.MsgClient.GetQueueStats(ctx, swapQueue)
+	if err != nil {
+		return ctrl.Result{}, false, fmt.Errorf("get swap queue stats: %w", err)
+	}
+
+	primaryTotal := primaryReady + primaryUnacked
+	swapTotal := swapReady + swapUnacked
+
+	// Elapsed time since fence
+	var elapsed time.Duration
+	if fenceStr, ok := m.Status.PhaseTimings["Swap.Fence.time"]; ok {
+		if fenceTime, parseErr := time.Parse(time.RFC3339, fenceStr); parseErr == nil {
+			elapsed = time.Since(fenceTime)
+		}
+	}
+
+	logger.Info("ParallelDrain status",
+		"primaryTotal", primaryTotal, "swapTotal", swapTotal,
+		"elapsed", elapsed.Round(time.Millisecond))
+
+	// Swap queue must be fully drained before deletion; primary queue is
+	// never deleted so the replacement pod will consume it naturally.
+	if swapTotal == 0 {
+		logger.Info("ParallelDrain complete — swap queue drained",
+			"primaryRemaining", primaryTotal)
+		patch := client.MergeFrom(m.DeepCopy())
+		delete(m.Status.PhaseTimings, "Swap.Fence.time")
+		delete(m.Status.PhaseTimings, "Swap.Fence.primaryDepth")
+		delete(m.Status.PhaseTimings, "Swap.Fence.swapDepth")
+		m.Status.SwapSubPhase = "FenceCutover"
+		if err := r.Status().Patch(ctx, m, patch); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		return ctrl.Result{Requeue: true}, false, nil
+	}
+
+	// Stall detection: if depth hasn't changed for the stall timeout, fail the drain
+	lastDepthKey := "Swap.ParallelDrain.lastDepth"
+	lastCheckKey := "Swap.ParallelDrain.lastCheck"
+	currentDepthStr := fmt.Sprintf("%d,%d", primaryTotal, swapTotal)
+
+	if lastDepth, ok := m.Status.PhaseTimings[lastDepthKey]; ok {
+		if lastDepth == currentDepthStr {
+			// Depth hasn't changed — check how long
+			if lastCheckStr, ok2 := m.Status.PhaseTimings[lastCheckKey]; ok2 {
+				if lastCheck, parseErr := time.Parse(time.RFC3339, lastCheckStr); parseErr == nil {
+					if time.Since(lastCheck) > parallelDrainStallTimeout(m) {
+						logger.Error(nil, "ParallelDrain stalled — depth unchanged",
+							"primaryTotal", primaryTotal, "swapTotal", swapTotal)
+						// Clean up stall tracking
+						delete(m.Status.PhaseTimings, lastDepthKey)
+						delete(m.Status.PhaseTimings, lastCheckKey)
+						return s.swapFenceRollback(ctx, r, m, base, "parallel drain stalled")
+					}
+				}
+			}
+		} else {
+			// Depth changed — reset stall timer
+			patch := client.MergeFrom(m.DeepCopy())
+			m.Status.PhaseTimings[lastDepthKey] = currentDepthStr
+			m.Status.PhaseTimings[lastCheckKey] = time.Now().Format(time.RFC3339)
+			_ = r.Status().Patch(ctx, m, patch)
+		}
+	} else {
+		// First check — initialize stall tracking
+		patch := client.MergeFrom(m.DeepCopy())
+		m.Status.PhaseTimings[lastDepthKey] = currentDepthStr
+		m.Status.PhaseTimings[lastCheckKey] = time.Now().Format(time.RFC3339)
+		_ = r.Status().Patch(ctx, m, patch)
+	}
+
+	// Timeout: max duration for parallel drain
+	if elapsed > parallelDrainMaxTimeout(m) {
+		logger.Error(nil, "ParallelDrain timeout", "elapsed", elapsed)
+		return s.swapFenceRollback(ctx, r, m, base, "parallel drain timeout")
+	}
+
+	return ctrl.Result{RequeueAfter: parallelDrainPollInterval(m)}, false, nil
+}
+
+// swapFenceCutover completes the Exchange-Fence protocol:
+// 1. Kill shadow pod (it has drained its primary queue)
+// 2. Rebind primary queue to exchange (restore normal routing)
+// 3. Replacement drains buffer queue (post-fence messages)
+// 4. Delete buffer + swap queues, send END_REPLAY
+func (s shadowPodStrategy) swapFenceCutover(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, base client.Object) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+	ensurePhaseTimings(m)
+
+	mqCfg := m.Spec.MessageQueueConfig
+	swapQueue := mqCfg.QueueName + ".ms2m-replay"
+	bufferQueue := mqCfg.QueueName + ".ms2m-fence-buffer"
+
+	// Step 1: Kill the shadow pod (it has fully drained primary)
+	shadowPod := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: m.Status.TargetPod, Namespace: m.Namespace}, shadowPod); err == nil {
+		gracePeriod := int64(0)
+		if err := r.Delete(ctx, shadowPod, &client.DeleteOptions{
+			GracePeriodSeconds: &gracePeriod,
+		}); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete shadow pod during fence cutover", "pod", m.Status.TargetPod)
+		} else {
+			logger.Info("Deleted shadow pod (drained primary)", "pod", m.Status.TargetPod)
+		}
+	}
+
+	// Step 2: Rebind primary queue to exchange (restore normal message flow).
+	// Step 3: Then unbind buffer queue from exchange.
+	// Order matters: rebind-then-unbind means both are briefly bound (possible
+	// duplicates in buffer), but avoids message loss. Unbind-then-rebind would
+	// lose messages published in the gap. At-least-once is preferable.
+	if err := r.MsgClient.BindQueue(ctx, mqCfg.QueueName, mqCfg.ExchangeName, ""); err != nil {
+		return ctrl.Result{}, false, fmt.Errorf("rebind primary queue: %w", err)
+	}
+
+	if err := r.MsgClient.UnbindQueue(ctx, bufferQueue, mqCfg.ExchangeName); err != nil {
+		logger.Error(err, "Failed to unbind buffer queue, continuing anyway")
+	}
+
+	// Step 4: Check if buffer queue has messages to drain
+	bufferReady, bufferUnacked, err := r.MsgClient.GetQueueStats(ctx, bufferQueue)
+	if err != nil {
+		// Buffer queue may not exist if fence was fast — not an error
+		logger.Info("Buffer queue not accessible, treating as empty", "err", err)
+		bufferReady, bufferUnacked = 0, 0
+	}
+
+	if bufferReady+bufferUnacked > 0 {
+		// Tell replacement to drain buffer queue before switching to primary
+		if _, ok := m.Status.PhaseTimings["Swap.BufferDrain.start"]; !ok {
+			payload := map[string]interface{}{
+				"queue": bufferQueue,
+			}
+			if err := r.notify(ctx, m, m.Status.ReplacementPod, protocol.ControlStartReplay, payload); err != nil {
+				logger.Error(err, "Failed to send START_REPLAY for buffer drain")
+			}
+			patch := client.MergeFrom(m.DeepCopy())
+			m.Status.PhaseTimings["Swap.BufferDrain.start"] = time.Now().Format(time.RFC3339)
+			_ = r.Status().Patch(ctx, m, patch)
+		}
+
+		// Timeout: buffer queue should be small; give up waiting after the
+		// parallel drain stall timeout (default 30s)
+		if startStr, ok := m.Status.PhaseTimings["Swap.BufferDrain.start"]; ok {
+			if startTime, err := time.Parse(time.RFC3339, startStr); err == nil {
+				if time.Since(startTime) > parallelDrainStallTimeout(m) {
+					logger.Error(nil, "Buffer drain timeout — proceeding without full drain",
+						"bufferReady", bufferReady, "bufferUnacked", bufferUnacked)
+					// Don't block forever; proceed to END_REPLAY. Buffer messages
+					// will be lost but the migration can complete.
+				} else {
+					logger.Info("Draining buffer queue", "bufferReady", bufferReady, "bufferUnacked", bufferUnacked)
+					return ctrl.Result{RequeueAfter: 1 * time.Second}, false, nil
+				}
+			}
+		} else {
+			logger.Info("Draining buffer queue", "bufferReady", bufferReady, "bufferUnacked", bufferUnacked)
+			return ctrl.Result{RequeueAfter: 1 * time.Second}, false, nil
+		}
+	}
+
+	// Buffer drained — send END_REPLAY and clean up
+	if err := r.notify(ctx, m, m.Status.ReplacementPod, protocol.ControlEndReplay, nil); err != nil {
+		logger.Error(err, "Failed to send END_REPLAY to replacement pod")
+	}
+
+	// Delete swap and buffer queues
+	if err := r.MsgClient.DeleteSecondaryQueue(ctx, swapQueue, mqCfg.QueueName, mqCfg.ExchangeName); err != nil {
+		logger.Error(err, "Failed to delete swap queue during fence cleanup")
+	}
+	if err := r.MsgClient.DeleteQueue(ctx, bufferQueue); err != nil {
+		logger.Error(err, "Failed to delete buffer queue during fence cleanup")
+	}
+
+	// The ordinal was released when the replacement was created; this only
+	// finishes a release that was interrupted.
+	if result, done, err := r.ReleaseOrdinal(ctx, m, m.Status.ReplacementPod); !done {
+		return result, false, err
+	}
+	if result, done, err := r.settleTemplate(ctx, m, m.Status.ReplacementPod); !done {
+		return result, false, err
+	}
+
+	// Update TargetPod and clear swap state
+	patch := client.MergeFrom(m.DeepCopy())
+	m.Status.TargetPod = m.Status.ReplacementPod
+	m.Status.SwapSubPhase = ""
+	delete(m.Status.PhaseTimings, "Swap.BufferDrain.start")
+	if err := r.Status().Patch(ctx, m, patch); err != nil {
+		return ctrl.Result{}, false, err
+	}
+
+	logger.Info("FenceCutover complete — Exchange-Fence identity swap finished", "replacementPod", m.Status.ReplacementPod)
+	return ctrl.Result{}, true, nil
+}
+
+// swapFenceRollback is called when the Exchange-Fence fails (stall or
+// timeout during ParallelDrain). It restores normal message routing and falls
+// back to the Cutoff path.
+func (s shadowPodStrategy) swapFenceRollback(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, base client.Object, reason string) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+
+	mqCfg := m.Spec.MessageQueueConfig
+	bufferQueue := mqCfg.QueueName + ".ms2m-fence-buffer"
+	swapQueue := mqCfg.QueueName + ".ms2m-replay"
+
+	logger.Info("Exchange-Fence rollback", "reason", reason)
+
+	// Rebind primary queue to restore live service
+	if err := r.MsgClient.BindQueue(ctx, mqCfg.QueueName, mqCfg.ExchangeName, ""); err != nil {
+		logger.Error(err, "Rollback: failed to rebind primary queue")
+	}
+
+	// Rebind swap queue so replacement can continue receiving
+	if err := r.MsgClient.BindQueue(ctx, swapQueue, mqCfg.ExchangeName, ""); err != nil {
+		logger.Error(err, "Rollback: failed to rebind swap queue")
+	}
+
+	// Clean up buffer queue. Warn if messages accumulated during the fence
+	// window — these will be lost when the buffer is deleted. The primary
+	// queue is now rebound, so new messages flow normally after rollback.
+	if depth, depthErr := r.MsgClient.GetQueueDepth(ctx, bufferQueue); depthErr == nil && depth > 0 {
+		logger.Error(nil, "Rollback: buffer queue has messages that will be lost",
+			"bufferQueue", bufferQueue, "depth", depth)
+	}
+	if err := r.MsgClient.UnbindQueue(ctx, bufferQueue, mqCfg.ExchangeName); err != nil {
+		logger.Error(err, "Rollback: failed to unbind buffer queue")
+	}
+	if err := r.MsgClient.DeleteQueue(ctx, bufferQueue); err != nil {
+		logger.Error(err, "Rollback: failed to delete buffer queue")
+	}
+
+	// Fall back to Cutoff-style MiniReplay. The swap queue was rebound above;
+	// MiniReplay will unbind it again for its drain approach.
+	// Set MiniReplay.start so that swapMiniReplay skips sending a
+	// duplicate START_REPLAY (one was already sent in PreFenceDrain).
+	patch := client.MergeFrom(m.DeepCopy())
+	// Clean up fence tracking state
+	delete(m.Status.PhaseTimings, "Swap.Fence.time")
+	delete(m.Status.PhaseTimings, "Swap.Fence.primaryDepth")
+	delete(m.Status.PhaseTimings, "Swap.Fence.swapDepth")
+	delete(m.Status.PhaseTimings, "Swap.ParallelDrain.lastDepth")
+	delete(m.Status.PhaseTimings, "Swap.ParallelDrain.lastCheck")
+	m.Status.PhaseTimings["Swap.MiniReplay.start"] = time.Now().Format(time.RFC3339)
+	m.Status.SwapSubPhase = "MiniReplay"
+	if err := r.Status().Patch(ctx, m, patch); err != nil {
+		return ctrl.Result{}, false, err
+	}
+
+	logger.Info("Exchange-Fence rolled back, falling back to MiniReplay (Cutoff)")
+	return ctrl.Result{Requeue: true}, false, nil
+}
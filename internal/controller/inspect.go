@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+	"github.com/haidinhtuan/kubernetes-controller/internal/checkpoint"
+)
+
+// inspector returns r.Inspector, defaulting to the ms2m-agents on the nodes.
+func (r *StatefulMigrationReconciler) inspector() checkpoint.Inspector {
+	if r.Inspector != nil {
+		return r.Inspector
+	}
+	return &checkpoint.AgentInspector{AgentIP: func(ctx context.Context, nodeName string) (string, error) {
+		ip, err := r.findAgentPodIP(ctx, nodeName)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", checkpoint.ErrNoAgent, err)
+		}
+		return ip, nil
+	}}
+}
+
+// inspectCheckpoint inspects the checkpoint archive on the source node and
+// checks that the target node can restore it, recording the result in
+// status.checkpointInspection. It runs once, before the checkpoint is
+// transferred, so an incompatible target fails the migration before the
+// target pod is created. Without an ms2m-agent on the source node the
+// archive cannot be read and the inspection is skipped; without one on the
+// target, or for a target in another cluster, only the kernel and
+// architecture from its Node object are checked.
+// Returns done=true to proceed with the transfer.
+func (r *StatefulMigrationReconciler) inspectCheckpoint(ctx context.Context, m *migrationv1alpha1.StatefulMigration) (ctrl.Result, bool, error) {
+	if m.Status.CheckpointInspection != nil {
+		return ctrl.Result{}, true, nil
+	}
+	logger := log.FromContext(ctx)
+	insp := r.inspector()
+	status := &migrationv1alpha1.CheckpointInspectionStatus{}
+
+	ins, source, err := insp.Inspect(ctx, m.Status.SourceNode, m.Status.CheckpointID)
+	switch {
+	case goerrors.Is(err, checkpoint.ErrNoAgent):
+		status.SkippedReason = fmt.Sprintf("no ms2m-agent on source node %s", m.Status.SourceNode)
+	case err != nil:
+		result, err := r.RetryOrFail(ctx, m, "checkpoint inspection", err)
+		return result, false, err
+	default:
+		// The agents of another cluster are out of reach; its Node object
+		// still gives the kernel and architecture.
+		target := &checkpoint.NodeInfo{}
+		if tc := m.Spec.TargetCluster; tc == nil || tc.KubeconfigSecretRef == nil {
+			info, err := insp.NodeInfo(ctx, m.Spec.TargetNode)
+			switch {
+			case err == nil:
+				target = info
+			case !goerrors.Is(err, checkpoint.ErrNoAgent):
+				result, err := r.RetryOrFail(ctx, m, "checkpoint inspection", err)
+				return result, false, err
+			}
+		}
+		targetClient, _, err := r.targetClient(ctx, m)
+		if err != nil {
+			result, err := r.RetryOrFail(ctx, m, "target cluster client", err)
+			return result, false, err
+		}
+		if err := fillNodeInfo(ctx, r.Client, m.Status.SourceNode, source); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		if err := fillNodeInfo(ctx, targetClient, m.Spec.TargetNode, target); err != nil {
+			return ctrl.Result{}, false, err
+		}
+
+		status.Image = ins.Image
+		status.Runtime = ins.Runtime
+		status.CRIUVersion = ins.CRIUVersion
+		status.RootfsDiffBytes = ins.RootfsDiffBytes
+		status.DeletedFiles = int32(ins.DeletedFiles)
+		status.SourceKernel = source.Kernel
+		status.TargetKernel = target.Kernel
+		status.TargetRuntimeVersion = target.Runtimes[ins.Runtime]
+		status.TargetCRIUVersion = target.CRIUVersion
+		status.Problems = checkpoint.CheckCompatibility(ins, *source, *target)
+	}
+
+	patch := client.MergeFrom(m.DeepCopy())
+	now := metav1.Now()
+	status.InspectedAt = &now
+	m.Status.CheckpointInspection = status
+	if err := r.Status().Patch(ctx, m, patch); err != nil {
+		return ctrl.Result{}, false, err
+	}
+
+	if problems := m.Status.CheckpointInspection.Problems; len(problems) > 0 {
+		result, err := r.failMigration(ctx, m, fmt.Sprintf("checkpoint cannot be restored on node %s: %s",
+			m.Spec.TargetNode, strings.Join(problems, "; ")))
+		return result, false, err
+	}
+	if reason := m.Status.CheckpointInspection.SkippedReason; reason != "" {
+		logger.Info("Skipped checkpoint inspection", "reason", reason)
+	} else {
+		logger.Info("Checkpoint inspected", "image", status.Image, "runtime", status.Runtime, "criu", status.CRIUVersion)
+	}
+	return ctrl.Result{}, true, nil
+}
+
+// fillNodeInfo fills the kernel and architecture of info the agent did not
+// report from the Node object read through c. A missing node leaves them
+// empty.
+func fillNodeInfo(ctx context.Context, c client.Reader, nodeName string, info *checkpoint.NodeInfo) error {
+	if info.Kernel != "" && info.Architecture != "" {
+		return nil
+	}
+	node := &corev1.Node{}
+	if err := c.Get(ctx, types.NamespacedName{Name: nodeName}, node); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if info.Kernel == "" {
+		info.Kernel = node.Status.NodeInfo.KernelVersion
+	}
+	if info.Architecture == "" {
+		info.Architecture = node.Status.NodeInfo.Architecture
+	}
+	return nil
+}
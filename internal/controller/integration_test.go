@@ -0,0 +1,1572 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/config"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+	"github.com/haidinhtuan/kubernetes-controller/internal/checkpoint"
+	"github.com/haidinhtuan/kubernetes-controller/internal/messaging"
+	"github.com/haidinhtuan/kubernetes-controller/pkg/protocol"
+)
+
+// ---------------------------------------------------------------------------
+// envtest harness
+//
+// envtest runs a real API server but none of the controllers that act on
+// what the migration controller writes. clusterSim stands in for them: the
+// scheduler and kubelet (binding, Running/Ready status, finishing graceful
+// deletes), the Job controller (transfer Jobs succeed), and the StatefulSet
+// and ReplicaSet controllers (ordinal ranges, adoption, deletion cost,
+// update revisions and rolling updates). agentStandIn answers the
+// ms2m-agent HTTP API on the agent port. The controller itself runs in a
+// real manager, so reads go through the informer cache.
+// ---------------------------------------------------------------------------
+
+const (
+	// integrationTimeout bounds a full migration driven through envtest.
+	integrationTimeout = 90 * time.Second
+	// integrationPoll is how often the tests check on the migration.
+	integrationPoll = 200 * time.Millisecond
+	// simTick is how often clusterSim acts on the cluster.
+	simTick = 200 * time.Millisecond
+	// simDefaultNode is where clusterSim schedules pods without a
+	// hostname nodeSelector.
+	simDefaultNode = "node-1"
+	// simPodIP is the IP every simulated pod gets, so HTTP readiness
+	// probes and agent calls reach servers on the test host.
+	simPodIP = "127.0.0.1"
+)
+
+// simNodeInfo is what the simulated nodes and agents report; source and
+// target are always compatible.
+var simNodeInfo = checkpoint.NodeInfo{
+	Kernel:       "6.8.0-45-generic",
+	Architecture: "amd64",
+	Runtimes:     map[string]string{"crun": "1.17"},
+	CRIUVersion:  "4.0",
+}
+
+// requireEnvtest skips the test when the envtest binaries are missing.
+func requireEnvtest(t *testing.T) {
+	t.Helper()
+	if cfg == nil {
+		t.Skip("envtest not available, skipping integration test")
+	}
+}
+
+// eventually polls cond until it returns true or timeout passes.
+func eventually(t *testing.T, timeout time.Duration, what string, cond func() (bool, error)) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+	for time.Now().Before(deadline) {
+		ok, err := cond()
+		if ok {
+			return
+		}
+		lastErr = err
+		time.Sleep(integrationPoll)
+	}
+	t.Fatalf("timed out after %s waiting for %s (last: %v)", timeout, what, lastErr)
+}
+
+// integrationClient returns an uncached client for cfg.
+func integrationClient(t *testing.T, c *rest.Config) client.Client {
+	t.Helper()
+	k8sClient, err := client.New(c, client.Options{Scheme: testScheme()})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	return k8sClient
+}
+
+// testNamespace creates a namespace for one test. envtest runs no namespace
+// controller, so it is left Terminating afterwards; the generated name keeps
+// tests apart.
+func testNamespace(t *testing.T, c client.Client) string {
+	t.Helper()
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "ms2m-it-"}}
+	if err := c.Create(context.Background(), ns); err != nil {
+		t.Fatalf("failed to create namespace: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Delete(context.Background(), ns) })
+	return ns.Name
+}
+
+// ensureNodes creates Ready nodes reporting simNodeInfo. Nodes are shared by
+// all tests and never deleted.
+func ensureNodes(t *testing.T, c client.Client, names ...string) {
+	t.Helper()
+	ctx := context.Background()
+	for _, name := range names {
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{hostnameLabel: name},
+		}}
+		if err := c.Create(ctx, node); err != nil && !errors.IsAlreadyExists(err) {
+			t.Fatalf("failed to create node %s: %v", name, err)
+		}
+		if err := c.Get(ctx, types.NamespacedName{Name: name}, node); err != nil {
+			t.Fatalf("failed to get node %s: %v", name, err)
+		}
+		node.Status.Conditions = []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}
+		node.Status.NodeInfo.KernelVersion = simNodeInfo.Kernel
+		node.Status.NodeInfo.Architecture = simNodeInfo.Architecture
+		node.Status.Allocatable = corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("8"),
+			corev1.ResourceMemory: resource.MustParse("16Gi"),
+		}
+		if err := c.Status().Update(ctx, node); err != nil {
+			t.Fatalf("failed to set status of node %s: %v", name, err)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// clusterSim
+// ---------------------------------------------------------------------------
+
+// clusterSim simulates the node and workload controllers for one namespace.
+// Parts of it can be held to freeze the cluster at a point of interest:
+// "kubelet" stops pods from starting and terminating, "job/<name>" keeps a
+// Job from succeeding.
+type clusterSim struct {
+	c         client.Client
+	namespace string
+
+	mu     sync.Mutex
+	held   map[string]bool
+	rolled []string // pods deleted by a simulated rolling update
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// startClusterSim runs a clusterSim until the test ends.
+func startClusterSim(t *testing.T, c client.Client, namespace string) *clusterSim {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &clusterSim{
+		c:         c,
+		namespace: namespace,
+		held:      make(map[string]bool),
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(simTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.step(ctx)
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		s.cancel()
+		<-s.done
+	})
+	return s
+}
+
+// hold freezes part of the simulation; release resumes it.
+func (s *clusterSim) hold(part string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.held[part] = true
+}
+
+func (s *clusterSim) release(part string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.held, part)
+}
+
+func (s *clusterSim) isHeld(part string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.held[part]
+}
+
+// rolledPods returns the pods a simulated rolling update replaced.
+func (s *clusterSim) rolledPods() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.rolled...)
+}
+
+// step runs one pass of every simulated controller. Errors, mostly
+// conflicts with the migration controller, are left to the next pass.
+func (s *clusterSim) step(ctx context.Context) {
+	s.syncStatefulSets(ctx)
+	s.syncReplicaSets(ctx)
+	s.syncJobs(ctx)
+	s.syncPods(ctx)
+}
+
+// syncPods plays scheduler and kubelet: pods are bound to the node in their
+// hostname nodeSelector, bound pods become Running and Ready, and graceful
+// deletes complete at once. Gated pods are left Pending.
+func (s *clusterSim) syncPods(ctx context.Context) {
+	if s.isHeld("kubelet") {
+		return
+	}
+	pods := &corev1.PodList{}
+	if err := s.c.List(ctx, pods, client.InNamespace(s.namespace)); err != nil {
+		return
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		switch {
+		case pod.DeletionTimestamp != nil:
+			gracePeriod := int64(0)
+			_ = s.c.Delete(ctx, pod, &client.DeleteOptions{GracePeriodSeconds: &gracePeriod})
+		case len(pod.Spec.SchedulingGates) > 0:
+		case pod.Spec.NodeName == "":
+			node := pod.Spec.NodeSelector[hostnameLabel]
+			if node == "" {
+				node = simDefaultNode
+			}
+			binding := &corev1.Binding{
+				ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+				Target:     corev1.ObjectReference{Kind: "Node", Name: node},
+			}
+			_ = s.c.SubResource("binding").Create(ctx, pod, binding)
+		case pod.Status.Phase != corev1.PodRunning:
+			markPodRunning(pod)
+			_ = s.c.Status().Update(ctx, pod)
+		}
+	}
+}
+
+// markPodRunning sets the status a kubelet reports for a started pod.
+func markPodRunning(pod *corev1.Pod) {
+	now := metav1.Now()
+	pod.Status.Phase = corev1.PodRunning
+	pod.Status.PodIP = simPodIP
+	pod.Status.PodIPs = []corev1.PodIP{{IP: simPodIP}}
+	pod.Status.StartTime = &now
+	pod.Status.Conditions = []corev1.PodCondition{
+		{Type: corev1.PodScheduled, Status: corev1.ConditionTrue, LastTransitionTime: now},
+		{Type: corev1.PodReady, Status: corev1.ConditionTrue, LastTransitionTime: now},
+	}
+}
+
+// syncJobs lets every Job succeed that is not held.
+func (s *clusterSim) syncJobs(ctx context.Context) {
+	jobs := &batchv1.JobList{}
+	if err := s.c.List(ctx, jobs, client.InNamespace(s.namespace)); err != nil {
+		return
+	}
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if job.Status.Succeeded > 0 || s.isHeld("job/"+job.Name) {
+			continue
+		}
+		now := metav1.Now()
+		job.Status.StartTime = &now
+		job.Status.Succeeded = 1
+		_ = s.c.Status().Update(ctx, job)
+	}
+}
+
+// templateRevision names the revision of a StatefulSet's pod template, as
+// the StatefulSet controller's ControllerRevisions do.
+func templateRevision(sts *appsv1.StatefulSet) string {
+	data, _ := json.Marshal(sts.Spec.Template)
+	h := fnv.New32a()
+	h.Write(data)
+	return fmt.Sprintf("%s-%x", sts.Name, h.Sum32())
+}
+
+// syncStatefulSets keeps one pod per ordinal of each StatefulSet's range,
+// adopts orphans in range, deletes owned pods out of range, rolls pods whose
+// revision is stale unless the update strategy is OnDelete, and reports the
+// status the migration controller waits on.
+func (s *clusterSim) syncStatefulSets(ctx context.Context) {
+	list := &appsv1.StatefulSetList{}
+	if err := s.c.List(ctx, list, client.InNamespace(s.namespace)); err != nil {
+		return
+	}
+	pods := &corev1.PodList{}
+	if err := s.c.List(ctx, pods, client.InNamespace(s.namespace)); err != nil {
+		return
+	}
+	for i := range list.Items {
+		sts := &list.Items[i]
+		revision := templateRevision(sts)
+		replicas, start := statefulSetRange(sts)
+		inRange := func(name string) bool {
+			prefix := sts.Name + "-"
+			if !strings.HasPrefix(name, prefix) {
+				return false
+			}
+			ordinal, ok := podOrdinal(name)
+			return ok && strconv.Itoa(int(ordinal)) == name[len(prefix):] && ordinal >= start && ordinal < start+replicas
+		}
+
+		byName := make(map[string]*corev1.Pod)
+		var owned []*corev1.Pod
+		for j := range pods.Items {
+			pod := &pods.Items[j]
+			byName[pod.Name] = pod
+			if ref := metav1.GetControllerOf(pod); ref != nil && ref.UID == sts.UID {
+				owned = append(owned, pod)
+			}
+		}
+
+		for ordinal := start; ordinal < start+replicas; ordinal++ {
+			name := fmt.Sprintf("%s-%d", sts.Name, ordinal)
+			pod, exists := byName[name]
+			if !exists {
+				_ = s.c.Create(ctx, statefulSetPod(sts, ordinal, revision))
+				continue
+			}
+			if metav1.GetControllerOf(pod) == nil && pod.DeletionTimestamp == nil {
+				patch := client.MergeFrom(pod.DeepCopy())
+				pod.OwnerReferences = append(pod.OwnerReferences,
+					*metav1.NewControllerRef(sts, appsv1.SchemeGroupVersion.WithKind("StatefulSet")))
+				if s.c.Patch(ctx, pod, patch) == nil {
+					owned = append(owned, pod)
+				}
+			}
+		}
+
+		var current []*corev1.Pod
+		for _, pod := range owned {
+			if pod.DeletionTimestamp != nil {
+				continue
+			}
+			if !inRange(pod.Name) {
+				_ = s.c.Delete(ctx, pod)
+				continue
+			}
+			current = append(current, pod)
+		}
+
+		if sts.Spec.UpdateStrategy.Type != appsv1.OnDeleteStatefulSetStrategyType &&
+			sts.Status.ObservedGeneration == sts.Generation {
+			for _, pod := range current {
+				if pod.Labels["controller-revision-hash"] != revision && pod.Status.Phase == corev1.PodRunning {
+					if s.c.Delete(ctx, pod) == nil {
+						s.mu.Lock()
+						s.rolled = append(s.rolled, pod.Name)
+						s.mu.Unlock()
+					}
+					break
+				}
+			}
+		}
+
+		var ready, updated int32
+		for _, pod := range current {
+			if podReady(pod) {
+				ready++
+			}
+			if pod.Labels["controller-revision-hash"] == revision {
+				updated++
+			}
+		}
+		status := appsv1.StatefulSetStatus{
+			ObservedGeneration: sts.Generation,
+			Replicas:           int32(len(current)),
+			ReadyReplicas:      ready,
+			AvailableReplicas:  ready,
+			CurrentReplicas:    updated,
+			UpdatedReplicas:    updated,
+			CurrentRevision:    revision,
+			UpdateRevision:     revision,
+		}
+		if !equality.Semantic.DeepEqual(status, sts.Status) {
+			sts.Status = status
+			_ = s.c.Status().Update(ctx, sts)
+		}
+	}
+}
+
+// statefulSetPod builds the pod the StatefulSet controller creates for
+// ordinal.
+func statefulSetPod(sts *appsv1.StatefulSet, ordinal int32, revision string) *corev1.Pod {
+	name := fmt.Sprintf("%s-%d", sts.Name, ordinal)
+	labels := map[string]string{
+		"controller-revision-hash":           revision,
+		"statefulset.kubernetes.io/pod-name": name,
+		"apps.kubernetes.io/pod-index":       strconv.Itoa(int(ordinal)),
+	}
+	for k, v := range sts.Spec.Template.Labels {
+		labels[k] = v
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: sts.Namespace,
+			Labels:    labels,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(sts, appsv1.SchemeGroupVersion.WithKind("StatefulSet")),
+			},
+		},
+		Spec: *sts.Spec.Template.Spec.DeepCopy(),
+	}
+	pod.Spec.Hostname = name
+	pod.Spec.Subdomain = sts.Spec.ServiceName
+	return pod
+}
+
+// syncReplicaSets keeps each ReplicaSet at its replica count: orphans that
+// match the selector are adopted, missing pods are created, and surplus
+// pods are deleted lowest pod-deletion-cost first.
+func (s *clusterSim) syncReplicaSets(ctx context.Context) {
+	list := &appsv1.ReplicaSetList{}
+	if err := s.c.List(ctx, list, client.InNamespace(s.namespace)); err != nil {
+		return
+	}
+	pods := &corev1.PodList{}
+	if err := s.c.List(ctx, pods, client.InNamespace(s.namespace)); err != nil {
+		return
+	}
+	for i := range list.Items {
+		rs := &list.Items[i]
+		selector, err := metav1.LabelSelectorAsSelector(rs.Spec.Selector)
+		if err != nil {
+			continue
+		}
+		var owned []*corev1.Pod
+		for j := range pods.Items {
+			pod := &pods.Items[j]
+			if pod.DeletionTimestamp != nil {
+				continue
+			}
+			ref := metav1.GetControllerOf(pod)
+			if ref == nil && selector.Matches(labels.Set(pod.Labels)) {
+				patch := client.MergeFrom(pod.DeepCopy())
+				pod.OwnerReferences = append(pod.OwnerReferences,
+					*metav1.NewControllerRef(rs, appsv1.SchemeGroupVersion.WithKind("ReplicaSet")))
+				if s.c.Patch(ctx, pod, patch) != nil {
+					continue
+				}
+				ref = metav1.GetControllerOf(pod)
+			}
+			if ref != nil && ref.UID == rs.UID {
+				owned = append(owned, pod)
+			}
+		}
+
+		want := int32(1)
+		if rs.Spec.Replicas != nil {
+			want = *rs.Spec.Replicas
+		}
+		switch {
+		case int32(len(owned)) < want:
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: rs.Name + "-",
+					Namespace:    rs.Namespace,
+					Labels:       rs.Spec.Template.Labels,
+					OwnerReferences: []metav1.OwnerReference{
+						*metav1.NewControllerRef(rs, appsv1.SchemeGroupVersion.WithKind("ReplicaSet")),
+					},
+				},
+				Spec: *rs.Spec.Template.Spec.DeepCopy(),
+			}
+			_ = s.c.Create(ctx, pod)
+		case int32(len(owned)) > want:
+			sort.SliceStable(owned, func(a, b int) bool {
+				return deletionCost(owned[a]) < deletionCost(owned[b])
+			})
+			for _, pod := range owned[:int32(len(owned))-want] {
+				_ = s.c.Delete(ctx, pod)
+			}
+			owned = owned[int32(len(owned))-want:]
+		}
+
+		var ready int32
+		for _, pod := range owned {
+			if podReady(pod) {
+				ready++
+			}
+		}
+		status := appsv1.ReplicaSetStatus{
+			ObservedGeneration:   rs.Generation,
+			Replicas:             int32(len(owned)),
+			FullyLabeledReplicas: int32(len(owned)),
+			ReadyReplicas:        ready,
+			AvailableReplicas:    ready,
+		}
+		if !equality.Semantic.DeepEqual(status, rs.Status) {
+			rs.Status = status
+			_ = s.c.Status().Update(ctx, rs)
+		}
+	}
+}
+
+// deletionCost returns pod's pod-deletion-cost annotation, zero if unset.
+func deletionCost(pod *corev1.Pod) int {
+	cost, _ := strconv.Atoi(pod.Annotations[podDeletionCostAnnotation])
+	return cost
+}
+
+// ---------------------------------------------------------------------------
+// agentStandIn
+// ---------------------------------------------------------------------------
+
+// agentStandIn serves the ms2m-agent HTTP API on checkpoint.AgentPort of the
+// test host, and registers a Running agent pod for each node pointing at it.
+type agentStandIn struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+// agentDigest is the digest the stand-in reports for pushed images.
+var agentDigest = "sha256:" + strings.Repeat("ab", 32)
+
+// startAgent starts the stand-in. The port is fixed by the controller, so
+// the test is skipped when something else holds it.
+func startAgent(t *testing.T, c client.Client, nodes ...string) *agentStandIn {
+	t.Helper()
+	ln, err := net.Listen("tcp", net.JoinHostPort(simPodIP, strconv.Itoa(checkpoint.AgentPort)))
+	if err != nil {
+		t.Skipf("agent port %d unavailable: %v", checkpoint.AgentPort, err)
+	}
+	a := &agentStandIn{}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(a.serve))
+	srv.Listener.Close()
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ms2m-system"}}
+	if err := c.Create(ctx, ns); err != nil && !errors.IsAlreadyExists(err) {
+		t.Fatalf("failed to create agent namespace: %v", err)
+	}
+	for _, node := range nodes {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ms2m-agent-" + node,
+				Namespace: "ms2m-system",
+				Labels:    map[string]string{"app": "ms2m-agent"},
+			},
+			Spec: corev1.PodSpec{
+				NodeName:   node,
+				Containers: []corev1.Container{{Name: "agent", Image: "ms2m-agent:latest"}},
+			},
+		}
+		if err := c.Create(ctx, pod); err != nil {
+			t.Fatalf("failed to create agent pod: %v", err)
+		}
+		markPodRunning(pod)
+		if err := c.Status().Update(ctx, pod); err != nil {
+			t.Fatalf("failed to start agent pod: %v", err)
+		}
+		t.Cleanup(func() {
+			gracePeriod := int64(0)
+			_ = c.Delete(ctx, pod, &client.DeleteOptions{GracePeriodSeconds: &gracePeriod})
+		})
+	}
+	return a
+}
+
+func (a *agentStandIn) serve(w http.ResponseWriter, req *http.Request) {
+	a.mu.Lock()
+	a.calls = append(a.calls, req.URL.Path)
+	a.mu.Unlock()
+
+	var resp interface{}
+	switch req.URL.Path {
+	case "/runtime-checkpoint":
+		var body checkpoint.RuntimeCheckpointRequest
+		_ = json.NewDecoder(req.Body).Decode(&body)
+		resp = checkpoint.RuntimeCheckpointResponse{Path: fmt.Sprintf("%s/%s_%s.tar", agentCheckpointDir, body.Namespace, body.Pod)}
+	case "/registry-push":
+		resp = map[string]string{"digest": agentDigest}
+	case "/local-load":
+		resp = map[string]string{}
+	case "/inspect":
+		resp = checkpoint.InspectResponse{
+			Inspection: checkpoint.Inspection{ContainerName: "app", Image: "myapp:latest", Runtime: "crun", CRIUVersion: "4.0"},
+			Node:       simNodeInfo,
+		}
+	case "/node-info":
+		resp = simNodeInfo
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// called reports how often the stand-in served path.
+func (a *agentStandIn) called(path string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := 0
+	for _, p := range a.calls {
+		if p == path {
+			n++
+		}
+	}
+	return n
+}
+
+// ---------------------------------------------------------------------------
+// workloadSim
+// ---------------------------------------------------------------------------
+
+// Traffic of the simulated workload: every simTick the producer publishes
+// up to workloadPublish messages and each pod consumes up to
+// workloadConsume, so the pods keep up with the queues.
+const (
+	workloadPublish = 2
+	workloadConsume = 5
+)
+
+// workloadSim runs the migrated workload on a messaging.FakeBroker that the
+// controller reaches through a FakeBrokerClient: a producer publishing
+// through the migration's exchange and an idempotent messaging.SimConsumer
+// per pod that follows the control protocol. As the controller's Kubelet
+// checkpoint backend it checkpoints a pod's consumer, and it starts the
+// consumer restored from the latest checkpoint once a pod running a
+// checkpoint image is Running. A consumer is killed when its pod is
+// deleted.
+type workloadSim struct {
+	client *workloadBroker
+
+	mu          sync.Mutex
+	sim         *messaging.Sim
+	rng         *rand.Rand
+	clusters    []workloadCluster
+	pods        map[workloadPodRef]types.UID
+	restored    map[types.UID]bool
+	checkpoints int
+	checkpoint  string // Sim name of the latest checkpoint
+	err         error
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// workloadCluster is a namespace whose pods workloadSim follows.
+type workloadCluster struct {
+	c         client.Client
+	namespace string
+}
+
+// workloadPodRef identifies a pod of the workload by cluster and name.
+type workloadPodRef struct {
+	cluster int
+	name    string
+}
+
+// workloadBroker is the controller's FakeBrokerClient. It records the
+// control message types sent.
+type workloadBroker struct {
+	*messaging.FakeBrokerClient
+
+	mu   sync.Mutex
+	sent map[protocol.ControlMessageType]int
+}
+
+func (b *workloadBroker) SendControlMessage(ctx context.Context, targetPod string, msg protocol.ControlMessage) error {
+	b.mu.Lock()
+	b.sent[msg.Type]++
+	b.mu.Unlock()
+	return b.FakeBrokerClient.SendControlMessage(ctx, targetPod, msg)
+}
+
+// startWorkload starts the workload with a consumer for the running pod
+// source in namespace, publishing to the exchange and queue of
+// integrationMigration.
+func startWorkload(t *testing.T, c client.Client, namespace, source string) *workloadSim {
+	t.Helper()
+	sim, err := messaging.NewSim("orders.fanout", "orders")
+	if err != nil {
+		t.Fatalf("failed to create broker simulation: %v", err)
+	}
+	if _, err := sim.Start(source, true); err != nil {
+		t.Fatalf("failed to start consumer %s: %v", source, err)
+	}
+	w := &workloadSim{
+		client: &workloadBroker{
+			FakeBrokerClient: messaging.NewFakeBrokerClient(sim.Broker),
+			sent:             make(map[protocol.ControlMessageType]int),
+		},
+		sim:      sim,
+		rng:      rand.New(rand.NewPCG(1, 2)),
+		pods:     make(map[workloadPodRef]types.UID),
+		restored: make(map[types.UID]bool),
+		done:     make(chan struct{}),
+	}
+	w.watch(c, namespace)
+	w.pods[workloadPodRef{name: source}] = getPod(t, c, namespace, source).UID
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(simTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				w.step(ctx)
+			}
+		}
+	}()
+	t.Cleanup(w.stop)
+	return w
+}
+
+// watch follows the pods of namespace in c as well, for a target cluster.
+func (w *workloadSim) watch(c client.Client, namespace string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.clusters = append(w.clusters, workloadCluster{c: c, namespace: namespace})
+}
+
+// configure makes w the reconciler's Kubelet checkpoint backend.
+func (w *workloadSim) configure(r *StatefulMigrationReconciler) {
+	r.KubeletClient = w
+}
+
+// Checkpoint lets the pod's consumer catch up with its queue and captures
+// its state. Catching up keeps the protocol's precondition that nothing
+// published before the replay queue was bound is left for the pod to apply
+// after its checkpoint.
+func (w *workloadSim) Checkpoint(_ context.Context, _, _, podName, _ string, _ checkpoint.Options) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.sim.Consumer(podName) == nil {
+		return "", fmt.Errorf("pod %s runs no workload consumer", podName)
+	}
+	w.checkpoints++
+	name := fmt.Sprintf("%s@checkpoint-%d", podName, w.checkpoints)
+	if err := w.sim.Run(messaging.SimDrain(podName), messaging.SimRestore(podName, name)); err != nil {
+		return "", err
+	}
+	w.checkpoint = name
+	return fmt.Sprintf("/var/lib/kubelet/checkpoints/checkpoint-%s.tar", podName), nil
+}
+
+// step publishes, follows pod starts and deletions, and lets every running
+// consumer handle its control messages and consume. The first error stops
+// the workload and is reported by finish.
+func (w *workloadSim) step(ctx context.Context) {
+	w.mu.Lock()
+	clusters := append([]workloadCluster(nil), w.clusters...)
+	w.mu.Unlock()
+	lists := make([][]corev1.Pod, len(clusters))
+	for i, cl := range clusters {
+		pods := &corev1.PodList{}
+		if err := cl.c.List(ctx, pods, client.InNamespace(cl.namespace)); err != nil {
+			return
+		}
+		lists[i] = pods.Items
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return
+	}
+	w.err = w.sync(lists)
+	if w.err == nil {
+		w.err = w.sim.Producer.Publish(w.rng.IntN(workloadPublish + 1))
+	}
+	refs := make([]workloadPodRef, 0, len(w.pods))
+	for ref := range w.pods {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].name < refs[j].name })
+	for _, ref := range refs {
+		if w.err != nil {
+			return
+		}
+		w.err = messaging.SimConsume(ref.name, w.rng.IntN(workloadConsume+1)).Run(w.sim)
+	}
+}
+
+// sync kills the consumers of deleted pods and starts the restored
+// consumer of a pod running a checkpoint image. w.mu must be held.
+func (w *workloadSim) sync(lists [][]corev1.Pod) error {
+	running := make(map[workloadPodRef]*corev1.Pod)
+	for cluster, pods := range lists {
+		for i := range pods {
+			pod := &pods[i]
+			if pod.DeletionTimestamp == nil && pod.Status.Phase == corev1.PodRunning {
+				running[workloadPodRef{cluster: cluster, name: pod.Name}] = pod
+			}
+		}
+	}
+	for ref, uid := range w.pods {
+		if pod := running[ref]; pod == nil || pod.UID != uid {
+			delete(w.pods, ref)
+			if err := messaging.SimKill(ref.name).Run(w.sim); err != nil {
+				return err
+			}
+		}
+	}
+	for ref, pod := range running {
+		if _, ok := w.pods[ref]; ok || w.restored[pod.UID] || w.checkpoint == "" ||
+			!strings.Contains(pod.Spec.Containers[0].Image, "checkpoint") {
+			continue
+		}
+		if err := messaging.SimRestore(w.checkpoint, ref.name).Run(w.sim); err != nil {
+			return err
+		}
+		w.pods[ref] = pod.UID
+		w.restored[pod.UID] = true
+	}
+	return nil
+}
+
+// stop stops the workload. It is safe to call more than once.
+func (w *workloadSim) stop() {
+	if w.cancel == nil {
+		return
+	}
+	w.cancel()
+	w.cancel = nil
+	<-w.done
+}
+
+// finish stops the workload, lets pod drain the primary queue and
+// reports pod's state against every message published.
+func (w *workloadSim) finish(t *testing.T, pod string) messaging.DeliveryReport {
+	t.Helper()
+	w.stop()
+	if w.err != nil {
+		t.Fatalf("workload failed: %v", w.err)
+	}
+	if err := w.sim.Run(messaging.SimDrain(pod)); err != nil {
+		t.Fatalf("pod %s failed to drain: %v", pod, err)
+	}
+	report := w.sim.Report(pod)
+	if report.Published == 0 {
+		t.Fatal("expected the workload to publish during the migration")
+	}
+	return report
+}
+
+// expectDelivered checks that pod's state holds every message the workload
+// published exactly once and in order.
+func expectDelivered(t *testing.T, w *workloadSim, pod string) {
+	t.Helper()
+	if err := w.finish(t, pod).Err(); err != nil {
+		t.Errorf("pod %s: %v", pod, err)
+	}
+}
+
+// expectNotDuplicated checks that pod's state holds no message twice. The
+// Cutoff identity swap unbinds the replay queue while the shadow still
+// consumes, so it may lose messages (see TestSim_DetectsCutoffSwapStateGap).
+func expectNotDuplicated(t *testing.T, w *workloadSim, pod string) {
+	t.Helper()
+	if r := w.finish(t, pod); len(r.Duplicated) > 0 {
+		t.Errorf("pod %s: %d of %d messages applied twice: %v", pod, len(r.Duplicated), r.Published, r.Duplicated)
+	}
+}
+
+// expectControlTypes checks that the controller sent each control message
+// type at least once.
+func expectControlTypes(t *testing.T, w *workloadSim, types ...protocol.ControlMessageType) {
+	t.Helper()
+	w.client.mu.Lock()
+	defer w.client.mu.Unlock()
+	for _, typ := range types {
+		if w.client.sent[typ] == 0 {
+			t.Errorf("expected a %s control message, got %v", typ, w.client.sent)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Manager and fixtures
+// ---------------------------------------------------------------------------
+
+var setLoggerOnce sync.Once
+
+// testManager runs the StatefulMigration controller in a manager, as
+// cmd/main.go does, with its cache scoped to the test namespace.
+type testManager struct {
+	cancel context.CancelFunc
+	done   chan error
+}
+
+// startManager starts a manager for namespace. configure adjusts the
+// reconciler before it is registered.
+func startManager(t *testing.T, restCfg *rest.Config, namespace string, broker messaging.BrokerClient, configure func(*StatefulMigrationReconciler)) *testManager {
+	t.Helper()
+	setLoggerOnce.Do(func() {
+		var w io.Writer = io.Discard
+		if testing.Verbose() {
+			w = os.Stderr
+		}
+		ctrl.SetLogger(zap.New(zap.UseDevMode(true), zap.WriteTo(w)))
+	})
+
+	skipNameValidation := true
+	mgr, err := ctrl.NewManager(restCfg, ctrl.Options{
+		Scheme:                 testScheme(),
+		Metrics:                server.Options{BindAddress: "0"},
+		HealthProbeBindAddress: "0",
+		Controller:             config.Controller{SkipNameValidation: &skipNameValidation},
+		Cache: cache.Options{DefaultNamespaces: map[string]cache.Config{
+			namespace:     {},
+			"ms2m-system": {},
+		}},
+		Client: client.Options{Cache: &client.CacheOptions{
+			DisableFor: []client.Object{&corev1.Secret{}, &corev1.Namespace{}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	r := &StatefulMigrationReconciler{
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		MsgClient: broker,
+	}
+	if configure != nil {
+		configure(r)
+	}
+	if err := r.SetupWithManager(mgr); err != nil {
+		t.Fatalf("failed to set up controller: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &testManager{cancel: cancel, done: make(chan error, 1)}
+	go func() { m.done <- mgr.Start(ctx) }()
+	t.Cleanup(func() { m.stop(t) })
+	return m
+}
+
+// stop shuts the manager down, as a controller restart or crash would. It
+// is safe to call more than once.
+func (m *testManager) stop(t *testing.T) {
+	t.Helper()
+	if m.cancel == nil {
+		return
+	}
+	m.cancel()
+	m.cancel = nil
+	if err := <-m.done; err != nil {
+		t.Errorf("manager exited with error: %v", err)
+	}
+}
+
+// integrationMigration returns a migration of sourcePod to node-2.
+func integrationMigration(namespace, name, sourcePod string) *migrationv1alpha1.StatefulMigration {
+	return &migrationv1alpha1.StatefulMigration{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: migrationv1alpha1.StatefulMigrationSpec{
+			SourcePod:                 sourcePod,
+			TargetNode:                "node-2",
+			CheckpointImageRepository: "registry.example.com/checkpoints",
+			ReplayCutoffSeconds:       5,
+			MessageQueueConfig: migrationv1alpha1.MessageQueueConfig{
+				QueueName:    "orders",
+				BrokerURL:    "amqp://localhost:5672",
+				ExchangeName: "orders.fanout",
+				RoutingKey:   "orders.new",
+			},
+		},
+	}
+}
+
+// createStandalonePod creates a pod on node-1 without an owner.
+func createStandalonePod(t *testing.T, c client.Client, namespace, name string) {
+	t.Helper()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: map[string]string{"app": name}},
+		Spec: corev1.PodSpec{
+			NodeName:   simDefaultNode,
+			Containers: []corev1.Container{{Name: "app", Image: "myapp:latest"}},
+		},
+	}
+	if err := c.Create(context.Background(), pod); err != nil {
+		t.Fatalf("failed to create pod %s: %v", name, err)
+	}
+}
+
+// createStatefulSet creates a StatefulSet whose pods clusterSim starts on
+// node-1, and waits for all of them to run.
+func createStatefulSet(t *testing.T, c client.Client, namespace, name string, replicas int32) *appsv1.StatefulSet {
+	t.Helper()
+	labels := map[string]string{"app": name}
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: name,
+			Selector:    &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app", Image: "myapp:latest"}},
+				},
+			},
+		},
+	}
+	if err := c.Create(context.Background(), sts); err != nil {
+		t.Fatalf("failed to create StatefulSet: %v", err)
+	}
+	waitForRunningPods(t, c, namespace, labels, int(replicas))
+	return sts
+}
+
+// createDeployment creates a Deployment with one replica and the
+// ReplicaSet its controller would create, and returns the pod clusterSim
+// starts for it.
+func createDeployment(t *testing.T, c client.Client, namespace, name string) *corev1.Pod {
+	t.Helper()
+	ctx := context.Background()
+	replicas := int32(1)
+	labels := map[string]string{"app": name, "pod-template-hash": "5d8f7c"}
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: labels},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app", Image: "myapp:latest"}},
+		},
+	}
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}},
+			Template: template,
+		},
+	}
+	if err := c.Create(ctx, deploy); err != nil {
+		t.Fatalf("failed to create Deployment: %v", err)
+	}
+	rs := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name + "-5d8f7c",
+			Namespace: namespace,
+			Labels:    labels,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(deploy, appsv1.SchemeGroupVersion.WithKind("Deployment")),
+			},
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: template,
+		},
+	}
+	if err := c.Create(ctx, rs); err != nil {
+		t.Fatalf("failed to create ReplicaSet: %v", err)
+	}
+	return &waitForRunningPods(t, c, namespace, labels, 1)[0]
+}
+
+// waitForRunningPods waits until n pods matching labels are Running and
+// returns them.
+func waitForRunningPods(t *testing.T, c client.Client, namespace string, labels map[string]string, n int) []corev1.Pod {
+	t.Helper()
+	var running []corev1.Pod
+	eventually(t, integrationTimeout, fmt.Sprintf("%d running pods with labels %v", n, labels), func() (bool, error) {
+		pods := &corev1.PodList{}
+		if err := c.List(context.Background(), pods, client.InNamespace(namespace), client.MatchingLabels(labels)); err != nil {
+			return false, err
+		}
+		running = running[:0]
+		for _, pod := range pods.Items {
+			if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil {
+				running = append(running, pod)
+			}
+		}
+		return len(running) == n, fmt.Errorf("%d running", len(running))
+	})
+	return running
+}
+
+// waitForMigration waits for the migration to satisfy cond, failing at
+// once if it ends in another terminal phase.
+func waitForMigration(t *testing.T, c client.Client, m *migrationv1alpha1.StatefulMigration, what string, cond func(*migrationv1alpha1.StatefulMigration) bool) *migrationv1alpha1.StatefulMigration {
+	t.Helper()
+	got := &migrationv1alpha1.StatefulMigration{}
+	eventually(t, integrationTimeout, fmt.Sprintf("migration %s %s", m.Name, what), func() (bool, error) {
+		if err := c.Get(context.Background(), client.ObjectKeyFromObject(m), got); err != nil {
+			return false, err
+		}
+		if cond(got) {
+			return true, nil
+		}
+		if isTerminalPhase(got.Status.Phase) {
+			t.Fatalf("migration %s ended in %s: %+v", m.Name, got.Status.Phase, got.Status.Conditions)
+		}
+		return false, fmt.Errorf("phase %s, swap sub-phase %q", got.Status.Phase, got.Status.SwapSubPhase)
+	})
+	return got
+}
+
+// waitForPhase waits for the migration to reach phase.
+func waitForPhase(t *testing.T, c client.Client, m *migrationv1alpha1.StatefulMigration, phase migrationv1alpha1.Phase) *migrationv1alpha1.StatefulMigration {
+	t.Helper()
+	return waitForMigration(t, c, m, "to reach "+string(phase), func(got *migrationv1alpha1.StatefulMigration) bool {
+		return got.Status.Phase == phase
+	})
+}
+
+// getPod returns the named pod, failing the test if it does not exist.
+func getPod(t *testing.T, c client.Client, namespace, name string) *corev1.Pod {
+	t.Helper()
+	pod := &corev1.Pod{}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: name, Namespace: namespace}, pod); err != nil {
+		t.Fatalf("failed to get pod %s: %v", name, err)
+	}
+	return pod
+}
+
+// expectPodGone waits for the named pod to be deleted.
+func expectPodGone(t *testing.T, c client.Client, namespace, name string) {
+	t.Helper()
+	eventually(t, integrationTimeout, "pod "+name+" to be deleted", func() (bool, error) {
+		err := c.Get(context.Background(), types.NamespacedName{Name: name, Namespace: namespace}, &corev1.Pod{})
+		return errors.IsNotFound(err), err
+	})
+}
+
+// expectStatefulSetRestored checks that the StatefulSet runs its original
+// replica range and update strategy again, with podName on node adopted
+// and the other pods untouched since before the migration.
+func expectStatefulSetRestored(t *testing.T, c client.Client, sim *clusterSim, sts *appsv1.StatefulSet, podName, node string, before map[string]types.UID) {
+	t.Helper()
+	ctx := context.Background()
+	eventually(t, integrationTimeout, podName+" to be adopted by StatefulSet "+sts.Name, func() (bool, error) {
+		pod := &corev1.Pod{}
+		if err := c.Get(ctx, types.NamespacedName{Name: podName, Namespace: sts.Namespace}, pod); err != nil {
+			return false, err
+		}
+		ref := metav1.GetControllerOf(pod)
+		return ref != nil && ref.UID == sts.UID, fmt.Errorf("controller %v", ref)
+	})
+	pod := getPod(t, c, sts.Namespace, podName)
+	if pod.Spec.NodeName != node {
+		t.Errorf("expected %s on %s, got %s", podName, node, pod.Spec.NodeName)
+	}
+
+	got := &appsv1.StatefulSet{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(sts), got); err != nil {
+		t.Fatalf("failed to get StatefulSet: %v", err)
+	}
+	if replicas, start := statefulSetRange(got); replicas != *sts.Spec.Replicas || start != 0 {
+		t.Errorf("expected %d replicas from ordinal 0, got %d from %d", *sts.Spec.Replicas, replicas, start)
+	}
+	if got.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+		t.Errorf("expected update strategy RollingUpdate, got %q", got.Spec.UpdateStrategy.Type)
+	}
+	if hasHoldGate(got.Spec.Template.Spec.SchedulingGates) {
+		t.Error("expected the ordinal hold gate to be removed from the template")
+	}
+	if pin := got.Spec.Template.Spec.NodeSelector[hostnameLabel]; pin != "" {
+		t.Errorf("expected no hostname pin in the template, got %q", pin)
+	}
+	for name, uid := range before {
+		if name == podName {
+			continue
+		}
+		if other := getPod(t, c, sts.Namespace, name); other.UID != uid {
+			t.Errorf("expected %s to be left alone, it was recreated", name)
+		}
+	}
+	if rolled := sim.rolledPods(); len(rolled) > 0 {
+		t.Errorf("expected no rolling update, StatefulSet rolled %v", rolled)
+	}
+}
+
+// podUIDs returns the UIDs of the StatefulSet's pods by name.
+func podUIDs(t *testing.T, c client.Client, sts *appsv1.StatefulSet) map[string]types.UID {
+	t.Helper()
+	pods := &corev1.PodList{}
+	if err := c.List(context.Background(), pods, client.InNamespace(sts.Namespace), client.MatchingLabels(sts.Spec.Selector.MatchLabels)); err != nil {
+		t.Fatalf("failed to list pods: %v", err)
+	}
+	uids := make(map[string]types.UID)
+	for _, pod := range pods.Items {
+		uids[pod.Name] = pod.UID
+	}
+	return uids
+}
+
+// ---------------------------------------------------------------------------
+// End-to-end tests
+// ---------------------------------------------------------------------------
+
+func TestIntegration_ShadowPod_TransferModes(t *testing.T) {
+	requireEnvtest(t)
+	tests := []struct {
+		name      string
+		mode      string
+		withAgent bool
+	}{
+		{name: "RegistryJob", mode: "Registry"},
+		{name: "RegistryAgent", mode: "Registry", withAgent: true},
+		{name: "Direct", mode: "Direct"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := integrationClient(t, cfg)
+			ensureNodes(t, c, "node-1", "node-2")
+			ns := testNamespace(t, c)
+			startClusterSim(t, c, ns)
+			var agent *agentStandIn
+			if tt.withAgent {
+				agent = startAgent(t, c, "node-1", "node-2")
+			}
+
+			createStandalonePod(t, c, ns, "myapp")
+			waitForRunningPods(t, c, ns, map[string]string{"app": "myapp"}, 1)
+			migration := integrationMigration(ns, "mig", "myapp")
+			migration.Spec.TransferMode = tt.mode
+			if err := c.Create(context.Background(), migration); err != nil {
+				t.Fatalf("failed to create migration: %v", err)
+			}
+
+			workload := startWorkload(t, c, ns, "myapp")
+			mgr := startManager(t, cfg, ns, workload.client, workload.configure)
+			got := waitForPhase(t, c, migration, migrationv1alpha1.PhaseCompleted)
+			mgr.stop(t)
+
+			if got.Spec.MigrationStrategy != "ShadowPod" {
+				t.Errorf("expected ShadowPod strategy, got %q", got.Spec.MigrationStrategy)
+			}
+			target := getPod(t, c, ns, "myapp-shadow")
+			if target.Spec.NodeName != "node-2" {
+				t.Errorf("expected target pod on node-2, got %s", target.Spec.NodeName)
+			}
+			expectPodGone(t, c, ns, "myapp")
+			expectControlTypes(t, workload, protocol.ControlStartReplay, protocol.ControlStopConsuming, protocol.ControlEndReplay)
+			expectDelivered(t, workload, "myapp-shadow")
+			if got.Status.SourceFence == nil || got.Status.SourceFence.FencedAt == nil {
+				t.Error("expected the source to be fenced")
+			}
+
+			job := &batchv1.Job{}
+			jobErr := c.Get(context.Background(), types.NamespacedName{Name: "mig-transfer", Namespace: ns}, job)
+			image := target.Spec.Containers[0].Image
+			switch {
+			case tt.withAgent:
+				if !errors.IsNotFound(jobErr) {
+					t.Errorf("expected no transfer Job with an agent, got err=%v", jobErr)
+				}
+				if agent.called("/registry-push") == 0 || agent.called("/inspect") == 0 {
+					t.Errorf("expected the agent to inspect and push the checkpoint, got %v", agent.calls)
+				}
+				if !strings.HasSuffix(image, "@"+agentDigest) {
+					t.Errorf("expected the target image pinned to the pushed digest, got %q", image)
+				}
+			case tt.mode == "Direct":
+				if jobErr != nil {
+					t.Fatalf("expected a transfer Job: %v", jobErr)
+				}
+				if args := job.Spec.Template.Spec.Containers[0].Args; len(args) < 2 || !strings.Contains(args[1], "ms2m-agent") {
+					t.Errorf("expected the Direct Job to post to the agent, got args %v", args)
+				}
+				if image != "localhost/checkpoint/app:latest" {
+					t.Errorf("expected the locally loaded checkpoint image, got %q", image)
+				}
+			default:
+				if jobErr != nil {
+					t.Fatalf("expected a transfer Job: %v", jobErr)
+				}
+				if !strings.HasPrefix(image, "registry.example.com/checkpoints/myapp:checkpoint-") {
+					t.Errorf("expected the registry checkpoint image, got %q", image)
+				}
+			}
+		})
+	}
+}
+
+func TestIntegration_ShadowPod_DeploymentAdoptsShadow(t *testing.T) {
+	requireEnvtest(t)
+	c := integrationClient(t, cfg)
+	ensureNodes(t, c, "node-1", "node-2")
+	ns := testNamespace(t, c)
+	startClusterSim(t, c, ns)
+
+	source := createDeployment(t, c, ns, "web")
+	migration := integrationMigration(ns, "mig", source.Name)
+	if err := c.Create(context.Background(), migration); err != nil {
+		t.Fatalf("failed to create migration: %v", err)
+	}
+
+	workload := startWorkload(t, c, ns, source.Name)
+	mgr := startManager(t, cfg, ns, workload.client, workload.configure)
+	got := waitForPhase(t, c, migration, migrationv1alpha1.PhaseCompleted)
+	mgr.stop(t)
+
+	if got.Status.DeploymentName != "web" {
+		t.Errorf("expected Deployment web to be recorded, got %q", got.Status.DeploymentName)
+	}
+	expectPodGone(t, c, ns, source.Name)
+	pods := waitForRunningPods(t, c, ns, map[string]string{"app": "web"}, 1)
+	if pods[0].Name != source.Name+"-shadow" || pods[0].Spec.NodeName != "node-2" {
+		t.Errorf("expected the shadow pod on node-2 to be the only replica, got %s on %s", pods[0].Name, pods[0].Spec.NodeName)
+	}
+	if ref := metav1.GetControllerOf(&pods[0]); ref == nil || ref.Kind != "ReplicaSet" {
+		t.Errorf("expected the ReplicaSet to own the shadow pod, got %v", ref)
+	}
+	expectDelivered(t, workload, source.Name+"-shadow")
+}
+
+func TestIntegration_Sequential_StatefulSetOrdinals(t *testing.T) {
+	requireEnvtest(t)
+	// Each ordinal is held a different way: the last by scaling down, the
+	// first by shifting spec.ordinals.start, the middle one by pausing.
+	for _, source := range []string{"db-2", "db-0", "db-1"} {
+		t.Run(source, func(t *testing.T) {
+			c := integrationClient(t, cfg)
+			ensureNodes(t, c, "node-1", "node-2")
+			ns := testNamespace(t, c)
+			sim := startClusterSim(t, c, ns)
+
+			sts := createStatefulSet(t, c, ns, "db", 3)
+			before := podUIDs(t, c, sts)
+			migration := integrationMigration(ns, "mig", source)
+			if err := c.Create(context.Background(), migration); err != nil {
+				t.Fatalf("failed to create migration: %v", err)
+			}
+
+			workload := startWorkload(t, c, ns, source)
+			mgr := startManager(t, cfg, ns, workload.client, workload.configure)
+			got := waitForPhase(t, c, migration, migrationv1alpha1.PhaseCompleted)
+			mgr.stop(t)
+
+			if got.Spec.MigrationStrategy != "Sequential" {
+				t.Errorf("expected Sequential strategy, got %q", got.Spec.MigrationStrategy)
+			}
+			if hold := got.Status.OrdinalReservation; hold == nil || hold.ReleasedAt == nil {
+				t.Errorf("expected a released ordinal hold, got %+v", hold)
+			}
+			expectStatefulSetRestored(t, c, sim, sts, source, "node-2", before)
+			expectDelivered(t, workload, source)
+		})
+	}
+}
+
+func TestIntegration_ShadowPod_IdentitySwapModes(t *testing.T) {
+	requireEnvtest(t)
+	for _, mode := range []string{"Cutoff", "ExchangeFence", "ReserveOrdinal"} {
+		t.Run(mode, func(t *testing.T) {
+			c := integrationClient(t, cfg)
+			ensureNodes(t, c, "node-1", "node-2")
+			ns := testNamespace(t, c)
+			sim := startClusterSim(t, c, ns)
+
+			sts := createStatefulSet(t, c, ns, "db", 3)
+			before := podUIDs(t, c, sts)
+			migration := integrationMigration(ns, "mig", "db-1")
+			migration.Spec.MigrationStrategy = "ShadowPod"
+			migration.Spec.IdentitySwapMode = mode
+			migration.Spec.Timeouts = &migrationv1alpha1.MigrationTimeouts{
+				ExchangeFence: &migrationv1alpha1.ExchangeFenceTuning{ObservationWindowSeconds: 1},
+			}
+			if err := c.Create(context.Background(), migration); err != nil {
+				t.Fatalf("failed to create migration: %v", err)
+			}
+
+			workload := startWorkload(t, c, ns, "db-1")
+			mgr := startManager(t, cfg, ns, workload.client, workload.configure)
+			got := waitForPhase(t, c, migration, migrationv1alpha1.PhaseCompleted)
+			mgr.stop(t)
+
+			if got.Status.TargetPod != "db-1" {
+				t.Errorf("expected db-1 to be the final target pod, got %q", got.Status.TargetPod)
+			}
+			if mode == "ReserveOrdinal" {
+				if got.Status.SourceFence == nil || got.Status.SourceFence.FencedAt == nil {
+					t.Error("expected the source to be fenced before its ordinal was reserved")
+				}
+			} else {
+				expectPodGone(t, c, ns, "db-1-shadow")
+				if got.Status.ReplacementPod != "db-1" {
+					t.Errorf("expected replacement pod db-1, got %q", got.Status.ReplacementPod)
+				}
+			}
+			expectStatefulSetRestored(t, c, sim, sts, "db-1", "node-2", before)
+			if mode == "Cutoff" {
+				expectNotDuplicated(t, workload, "db-1")
+			} else {
+				expectDelivered(t, workload, "db-1")
+			}
+		})
+	}
+}
+
+func TestIntegration_ControllerRestart(t *testing.T) {
+	requireEnvtest(t)
+	tests := []struct {
+		name string
+		// swapMode selects a ShadowPod identity swap; empty runs a
+		// Sequential migration.
+		swapMode string
+		// hold is the part of clusterSim held while the first controller
+		// runs; it is released once the migration reaches stopAt.
+		hold   string
+		stopAt func(*migrationv1alpha1.StatefulMigration) bool
+	}{
+		{
+			name: "Restoring",
+			hold: "kubelet",
+			stopAt: func(m *migrationv1alpha1.StatefulMigration) bool {
+				return m.Status.Phase == migrationv1alpha1.PhaseRestoring &&
+					m.Status.OrdinalReservation != nil && m.Status.OrdinalReservation.ReservedAt != nil
+			},
+		},
+		{
+			name:     "SwapTransfer",
+			swapMode: "Cutoff",
+			hold:     "job/mig-swap-transfer",
+			stopAt: func(m *migrationv1alpha1.StatefulMigration) bool {
+				return m.Status.SwapSubPhase == "SwapTransfer"
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := integrationClient(t, cfg)
+			ensureNodes(t, c, "node-1", "node-2")
+			ns := testNamespace(t, c)
+			sim := startClusterSim(t, c, ns)
+
+			sts := createStatefulSet(t, c, ns, "db", 3)
+			before := podUIDs(t, c, sts)
+			migration := integrationMigration(ns, "mig", "db-1")
+			if tt.swapMode != "" {
+				migration.Spec.MigrationStrategy = "ShadowPod"
+				migration.Spec.IdentitySwapMode = tt.swapMode
+			}
+			if err := c.Create(context.Background(), migration); err != nil {
+				t.Fatalf("failed to create migration: %v", err)
+			}
+
+			// The broker and the workload outlive the controller.
+			workload := startWorkload(t, c, ns, "db-1")
+			sim.hold(tt.hold)
+			first := startManager(t, cfg, ns, workload.client, workload.configure)
+			waitForMigration(t, c, migration, "to reach the restart point", tt.stopAt)
+			first.stop(t)
+			sim.release(tt.hold)
+
+			second := startManager(t, cfg, ns, workload.client, workload.configure)
+			got := waitForPhase(t, c, migration, migrationv1alpha1.PhaseCompleted)
+			second.stop(t)
+
+			if got.Status.TargetPod != "db-1" {
+				t.Errorf("expected db-1 to be the final target pod, got %q", got.Status.TargetPod)
+			}
+			expectStatefulSetRestored(t, c, sim, sts, "db-1", "node-2", before)
+			if tt.swapMode == "Cutoff" {
+				expectNotDuplicated(t, workload, "db-1")
+			} else {
+				expectDelivered(t, workload, "db-1")
+			}
+		})
+	}
+}
+
+func TestIntegration_CrossCluster_EndToEnd(t *testing.T) {
+	requireEnvtest(t)
+	targetEnv := &envtest.Environment{}
+	if _, err := targetEnv.Start(); err != nil {
+		t.Fatalf("failed to start target cluster: %v", err)
+	}
+	// Registered first so it runs after the cleanups below.
+	t.Cleanup(func() { _ = targetEnv.Stop() })
+	user, err := targetEnv.AddUser(envtest.User{Name: "ms2m", Groups: []string{"system:masters"}}, nil)
+	if err != nil {
+		t.Fatalf("failed to add target cluster user: %v", err)
+	}
+	kubeconfig, err := user.KubeConfig()
+	if err != nil {
+		t.Fatalf("failed to build target kubeconfig: %v", err)
+	}
+
+	ctx := context.Background()
+	c := integrationClient(t, cfg)
+	remote := integrationClient(t, user.Config())
+	ensureNodes(t, c, "node-1")
+	ensureNodes(t, remote, "node-2")
+	ns := testNamespace(t, c)
+	remoteNS := testNamespace(t, remote)
+	startClusterSim(t, c, ns)
+	startClusterSim(t, remote, remoteNS)
+
+	createStandalonePod(t, c, ns, "myapp")
+	waitForRunningPods(t, c, ns, map[string]string{"app": "myapp"}, 1)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-b", Namespace: ns},
+		Data:       map[string][]byte{"kubeconfig": kubeconfig},
+	}
+	if err := c.Create(ctx, secret); err != nil {
+		t.Fatalf("failed to create kubeconfig Secret: %v", err)
+	}
+	migration := integrationMigration(ns, "mig", "myapp")
+	migration.Spec.TargetCluster = &migrationv1alpha1.TargetCluster{
+		KubeconfigSecretRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "cluster-b"},
+			Key:                  "kubeconfig",
+		},
+		Namespace: remoteNS,
+	}
+	if err := c.Create(ctx, migration); err != nil {
+		t.Fatalf("failed to create migration: %v", err)
+	}
+
+	workload := startWorkload(t, c, ns, "myapp")
+	workload.watch(remote, remoteNS)
+	mgr := startManager(t, cfg, ns, workload.client, workload.configure)
+	got := waitForPhase(t, c, migration, migrationv1alpha1.PhaseCompleted)
+	mgr.stop(t)
+
+	if got.Spec.MigrationStrategy != "CrossCluster" {
+		t.Errorf("expected CrossCluster strategy, got %q", got.Spec.MigrationStrategy)
+	}
+	target := getPod(t, remote, remoteNS, "myapp-shadow")
+	if target.Annotations[sourcePodAnnotation] != ns+"/myapp" {
+		t.Errorf("expected the target to record its source, got %v", target.Annotations)
+	}
+	expectPodGone(t, c, ns, "myapp")
+	expectControlTypes(t, workload, protocol.ControlStartReplay, protocol.ControlStopConsuming, protocol.ControlEndReplay)
+	expectDelivered(t, workload, "myapp-shadow")
+}
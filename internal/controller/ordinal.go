@@ -0,0 +1,420 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+)
+
+// swapReserveOrdinal is the identity swap mode that restores the target pod
+// under the source pod's name instead of re-checkpointing the shadow.
+const swapReserveOrdinal = "ReserveOrdinal"
+
+// Ordinal hold methods. Each takes exactly one ordinal out of the
+// StatefulSet; the other pods keep running untouched.
+const (
+	// holdScaleDown holds the highest ordinal by lowering replicas by one.
+	holdScaleDown = "ScaleDown"
+	// holdShiftStart holds the lowest ordinal by moving spec.ordinals.start
+	// past it and lowering replicas by one.
+	holdShiftStart = "ShiftStart"
+	// holdPause holds any other ordinal. The update strategy is switched to
+	// OnDelete so the template change below rolls no pod, and the template
+	// gets a scheduling gate so a pod the StatefulSet recreates for the
+	// ordinal never starts; the controller deletes it to free the name.
+	holdPause = "Pause"
+)
+
+// ordinalHoldGate is the scheduling gate added to the pod template while an
+// ordinal is held with holdPause.
+const ordinalHoldGate = "migration.ms2m.io/ordinal-hold"
+
+// reserveOrdinal reports whether a ShadowPod migration restores the target
+// pod into the source's StatefulSet ordinal. The source is fenced and
+// removed before the target is created, so the two never run side by side.
+func reserveOrdinal(m *migrationv1alpha1.StatefulMigration) bool {
+	return m.Spec.IdentitySwapMode == swapReserveOrdinal && m.Status.StatefulSetName != ""
+}
+
+// podOrdinal parses the ordinal from a StatefulSet pod name.
+func podOrdinal(name string) (int32, bool) {
+	i := strings.LastIndex(name, "-")
+	if i < 0 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(name[i+1:], 10, 32)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return int32(n), true
+}
+
+// statefulSetRange returns the StatefulSet's replica count and first ordinal.
+func statefulSetRange(sts *appsv1.StatefulSet) (int32, int32) {
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+	start := int32(0)
+	if sts.Spec.Ordinals != nil {
+		start = sts.Spec.Ordinals.Start
+	}
+	return replicas, start
+}
+
+// holdMethod picks how ordinal is taken out of sts: scaling handles the two
+// ends of the ordinal range, any ordinal in between is paused. A StatefulSet
+// that deletes its claims when scaled down is always paused: scaling would
+// delete the volumes of the pod being migrated.
+func holdMethod(sts *appsv1.StatefulSet, ordinal int32) (string, error) {
+	replicas, start := statefulSetRange(sts)
+	if ordinal < start || ordinal >= start+replicas {
+		return "", fmt.Errorf("ordinal %d is outside StatefulSet %q (ordinals %d to %d)",
+			ordinal, sts.Name, start, start+replicas-1)
+	}
+	if policy := sts.Spec.PersistentVolumeClaimRetentionPolicy; policy != nil &&
+		policy.WhenScaled == appsv1.DeletePersistentVolumeClaimRetentionPolicyType {
+		return holdPause, nil
+	}
+	switch ordinal {
+	case start + replicas - 1:
+		return holdScaleDown, nil
+	case start:
+		return holdShiftStart, nil
+	default:
+		return holdPause, nil
+	}
+}
+
+// applyHold sets the StatefulSet fields that hold the ordinal. The values
+// are derived from the recorded originals, so applying a hold twice leaves
+// the StatefulSet as applying it once.
+func applyHold(sts *appsv1.StatefulSet, hold *migrationv1alpha1.OrdinalReservationStatus, originalReplicas int32) {
+	switch hold.Method {
+	case holdPause:
+		sts.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType}
+		if !hasHoldGate(sts.Spec.Template.Spec.SchedulingGates) {
+			sts.Spec.Template.Spec.SchedulingGates = append(sts.Spec.Template.Spec.SchedulingGates,
+				corev1.PodSchedulingGate{Name: ordinalHoldGate})
+		}
+	case holdShiftStart:
+		sts.Spec.Ordinals = &appsv1.StatefulSetOrdinals{Start: hold.Ordinal + 1}
+		fallthrough
+	default:
+		replicas := originalReplicas - 1
+		sts.Spec.Replicas = &replicas
+	}
+}
+
+// revertHold restores the StatefulSet fields changed by applyHold.
+func revertHold(sts *appsv1.StatefulSet, hold *migrationv1alpha1.OrdinalReservationStatus, originalReplicas int32) {
+	switch hold.Method {
+	case holdPause:
+		sts.Spec.Template.Spec.SchedulingGates = withoutHoldGate(sts.Spec.Template.Spec.SchedulingGates)
+		if hold.OriginalUpdateStrategy != nil {
+			sts.Spec.UpdateStrategy = *hold.OriginalUpdateStrategy
+		}
+	default:
+		sts.Spec.Replicas = &originalReplicas
+		if hold.OriginalStart != nil {
+			if *hold.OriginalStart == 0 {
+				sts.Spec.Ordinals = nil
+			} else {
+				sts.Spec.Ordinals = &appsv1.StatefulSetOrdinals{Start: *hold.OriginalStart}
+			}
+		}
+	}
+}
+
+// hasHoldGate reports whether gates include ordinalHoldGate.
+func hasHoldGate(gates []corev1.PodSchedulingGate) bool {
+	for _, g := range gates {
+		if g.Name == ordinalHoldGate {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutHoldGate returns gates without ordinalHoldGate, or nil when none
+// are left so the template matches its pre-hold revision.
+func withoutHoldGate(gates []corev1.PodSchedulingGate) []corev1.PodSchedulingGate {
+	var kept []corev1.PodSchedulingGate
+	for _, g := range gates {
+		if g.Name != ordinalHoldGate {
+			kept = append(kept, g)
+		}
+	}
+	return kept
+}
+
+// pausedOrdinal reports whether the migration holds an ordinal with
+// holdPause, which keeps the StatefulSet at OnDelete.
+func pausedOrdinal(m *migrationv1alpha1.StatefulMigration) bool {
+	hold := m.Status.OrdinalReservation
+	return hold != nil && hold.Method == holdPause && hold.ReservedAt != nil && hold.ReleasedAt == nil
+}
+
+// heldPlaceholder reports whether pod was recreated by the StatefulSet for a
+// paused ordinal. It never starts and only blocks the name.
+func heldPlaceholder(pod *corev1.Pod) bool {
+	return hasHoldGate(pod.Spec.SchedulingGates)
+}
+
+// deletePlaceholder removes a held placeholder without a grace period. The
+// caller creates its own pod under the name right away, before the
+// StatefulSet recreates the placeholder; losing that race costs one more
+// attempt.
+func (r *StatefulMigrationReconciler) deletePlaceholder(ctx context.Context, pod *corev1.Pod) error {
+	gracePeriod := int64(0)
+	if err := r.Delete(ctx, pod, &client.DeleteOptions{
+		GracePeriodSeconds: &gracePeriod,
+	}); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	log.FromContext(ctx).Info("Deleted placeholder pod of held ordinal", "pod", pod.Name)
+	return nil
+}
+
+// HoldOrdinal takes the source pod's ordinal out of its StatefulSet so the
+// source can be removed without the StatefulSet recreating it, and without
+// touching any other ordinal. The hold is recorded in status before the
+// StatefulSet is changed, so an interrupted hold is completed rather than
+// applied twice. It is a no-op while the hold is in place; a released hold
+// is taken again.
+func (r *StatefulMigrationReconciler) HoldOrdinal(ctx context.Context, m *migrationv1alpha1.StatefulMigration) error {
+	logger := log.FromContext(ctx)
+	if hold := m.Status.OrdinalReservation; hold != nil && hold.ReservedAt != nil && hold.ReleasedAt == nil {
+		return nil
+	}
+
+	sts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: m.Status.StatefulSetName, Namespace: m.Namespace}, sts); err != nil {
+		return fmt.Errorf("get StatefulSet %q: %w", m.Status.StatefulSetName, err)
+	}
+
+	if hold := m.Status.OrdinalReservation; hold == nil || hold.ReleasedAt != nil {
+		ordinal, ok := podOrdinal(m.Spec.SourcePod)
+		if !ok {
+			return fmt.Errorf("source pod %q has no StatefulSet ordinal", m.Spec.SourcePod)
+		}
+		method, err := holdMethod(sts, ordinal)
+		if err != nil {
+			return err
+		}
+		replicas, start := statefulSetRange(sts)
+		hold = &migrationv1alpha1.OrdinalReservationStatus{Ordinal: ordinal, Method: method}
+		switch method {
+		case holdShiftStart:
+			hold.OriginalStart = &start
+		case holdPause:
+			hold.OriginalUpdateStrategy = sts.Spec.UpdateStrategy.DeepCopy()
+		}
+
+		patch := client.MergeFrom(m.DeepCopy())
+		m.Status.OrdinalReservation = hold
+		m.Status.OriginalReplicas = replicas
+		if err := r.Status().Patch(ctx, m, patch); err != nil {
+			return err
+		}
+	}
+
+	stsPatch := client.MergeFrom(sts.DeepCopy())
+	applyHold(sts, m.Status.OrdinalReservation, m.Status.OriginalReplicas)
+	if err := r.Patch(ctx, sts, stsPatch); err != nil {
+		return fmt.Errorf("hold ordinal in StatefulSet %q: %w", m.Status.StatefulSetName, err)
+	}
+
+	patch := client.MergeFrom(m.DeepCopy())
+	now := metav1.Now()
+	m.Status.OrdinalReservation.ReservedAt = &now
+	if err := r.Status().Patch(ctx, m, patch); err != nil {
+		return err
+	}
+	logger.Info("Held StatefulSet ordinal", "statefulset", m.Status.StatefulSetName,
+		"ordinal", m.Status.OrdinalReservation.Ordinal, "method", m.Status.OrdinalReservation.Method)
+	return nil
+}
+
+// checkOrdinalReservable returns an error when the source pod's ordinal
+// cannot be taken out of its StatefulSet.
+func (r *StatefulMigrationReconciler) checkOrdinalReservable(ctx context.Context, m *migrationv1alpha1.StatefulMigration) error {
+	ordinal, ok := podOrdinal(m.Spec.SourcePod)
+	if !ok {
+		return fmt.Errorf("source pod %q has no StatefulSet ordinal", m.Spec.SourcePod)
+	}
+	sts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: m.Status.StatefulSetName, Namespace: m.Namespace}, sts); err != nil {
+		return fmt.Errorf("owning StatefulSet %q: %w", m.Status.StatefulSetName, err)
+	}
+	_, err := holdMethod(sts, ordinal)
+	return err
+}
+
+// reserveSourceOrdinal frees the source pod's name for the target pod. It
+// fences the source, holds its ordinal so the StatefulSet does not bring it
+// back, and deletes the source without a grace period; a fenced source has
+// nothing left to finish. Returns done=true once the name is free or already
+// taken by this migration's target pod.
+func (r *StatefulMigrationReconciler) reserveSourceOrdinal(ctx context.Context, m *migrationv1alpha1.StatefulMigration) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+
+	source := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{Name: m.Spec.SourcePod, Namespace: m.Namespace}, source)
+	if errors.IsNotFound(err) && m.Status.OrdinalReservation != nil && m.Status.OrdinalReservation.ReservedAt != nil {
+		return ctrl.Result{}, true, nil
+	}
+	if err == nil && (source.Labels["migration.ms2m.io/migration"] == m.Name || heldPlaceholder(source)) {
+		return ctrl.Result{}, true, nil
+	}
+	if err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, false, err
+	}
+
+	if needsSourceFence(m) {
+		if result, done, err := r.fenceSource(ctx, m); !done {
+			return result, false, err
+		}
+	}
+
+	if err := r.HoldOrdinal(ctx, m); err != nil {
+		result, err := r.RetryOrFail(ctx, m, "hold StatefulSet ordinal", err)
+		return result, false, err
+	}
+
+	if err == nil && source.DeletionTimestamp == nil {
+		gracePeriod := int64(0)
+		if err := r.Delete(ctx, source, &client.DeleteOptions{
+			GracePeriodSeconds: &gracePeriod,
+		}); err != nil && !errors.IsNotFound(err) {
+			return ctrl.Result{}, false, err
+		}
+		logger.Info("Deleted fenced source pod", "pod", m.Spec.SourcePod)
+	}
+	if err == nil {
+		return ctrl.Result{RequeueAfter: time.Second}, false, nil
+	}
+	return ctrl.Result{}, true, nil
+}
+
+// markOrdinalRestored records the freeze window once the target pod that
+// took over the reserved ordinal is ready.
+func markOrdinalRestored(m *migrationv1alpha1.StatefulMigration) {
+	res := m.Status.OrdinalReservation
+	fence := m.Status.SourceFence
+	if res == nil || fence == nil || fence.FencedAt == nil || res.FreezeWindow != "" {
+		return
+	}
+	res.FreezeWindow = time.Since(fence.FencedAt.Time).Round(time.Millisecond).String()
+}
+
+// ReleaseOrdinal hands the held ordinal back to the StatefulSet with podName
+// in place. The StatefulSet is restored first and the pod drops its
+// StatefulMigration ownerReference last: a pod adopted while its ordinal is
+// still out of range would be deleted by the StatefulSet controller.
+//
+// A paused ordinal is released in steps. The scheduling gate is removed and
+// the StatefulSet has to observe that before the pod's
+// controller-revision-hash is set to the restored revision; only then does
+// the original update strategy come back, so adopting the pod rolls nothing.
+// Returns done=true once the ordinal is released.
+func (r *StatefulMigrationReconciler) ReleaseOrdinal(ctx context.Context, m *migrationv1alpha1.StatefulMigration, podName string) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+	hold := m.Status.OrdinalReservation
+	if hold != nil && hold.ReleasedAt != nil {
+		return ctrl.Result{}, true, nil
+	}
+	if hold == nil && m.Status.OriginalReplicas > 0 {
+		// Migrations started before ordinal holds scaled the whole
+		// StatefulSet to zero; scale it back.
+		hold = &migrationv1alpha1.OrdinalReservationStatus{Method: holdScaleDown}
+	}
+
+	pod := &corev1.Pod{}
+	var podErr error = errors.NewNotFound(corev1.Resource("pods"), podName)
+	if podName != "" {
+		podErr = r.Get(ctx, types.NamespacedName{Name: podName, Namespace: m.Namespace}, pod)
+		if podErr != nil && !errors.IsNotFound(podErr) {
+			return ctrl.Result{}, false, podErr
+		}
+	}
+
+	sts := &appsv1.StatefulSet{}
+	if hold == nil {
+		// Nothing was held; the pod only has to be handed over.
+	} else if err := r.Get(ctx, types.NamespacedName{Name: m.Status.StatefulSetName, Namespace: m.Namespace}, sts); err == nil {
+		if hold.Method == holdPause {
+			if hasHoldGate(sts.Spec.Template.Spec.SchedulingGates) {
+				stsPatch := client.MergeFrom(sts.DeepCopy())
+				sts.Spec.Template.Spec.SchedulingGates = withoutHoldGate(sts.Spec.Template.Spec.SchedulingGates)
+				if err := r.Patch(ctx, sts, stsPatch); err != nil {
+					return ctrl.Result{}, false, err
+				}
+				logger.Info("Removed ordinal hold gate from StatefulSet template", "statefulset", m.Status.StatefulSetName)
+				return ctrl.Result{RequeueAfter: time.Second}, false, nil
+			}
+			if sts.Status.ObservedGeneration < sts.Generation {
+				logger.Info("Waiting for StatefulSet to observe the restored template", "statefulset", m.Status.StatefulSetName)
+				return ctrl.Result{RequeueAfter: time.Second}, false, nil
+			}
+			if podErr == nil {
+				if err := r.matchUpdateRevision(ctx, pod, sts); err != nil {
+					return ctrl.Result{}, false, err
+				}
+			}
+		}
+		stsPatch := client.MergeFrom(sts.DeepCopy())
+		revertHold(sts, hold, m.Status.OriginalReplicas)
+		if templatePending(m) {
+			// The pinned template is still in place; settleTemplate
+			// restores the update strategy once it is settled.
+			sts.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType}
+		}
+		if err := r.Patch(ctx, sts, stsPatch); err != nil {
+			return ctrl.Result{}, false, err
+		}
+	} else if !errors.IsNotFound(err) {
+		return ctrl.Result{}, false, err
+	}
+
+	if podErr == nil {
+		filtered := make([]metav1.OwnerReference, 0, len(pod.OwnerReferences))
+		for _, ref := range pod.OwnerReferences {
+			if ref.Kind != "StatefulMigration" {
+				filtered = append(filtered, ref)
+			}
+		}
+		if len(filtered) != len(pod.OwnerReferences) {
+			podPatch := client.MergeFrom(pod.DeepCopy())
+			pod.OwnerReferences = filtered
+			if err := r.Patch(ctx, pod, podPatch); err != nil {
+				return ctrl.Result{}, false, err
+			}
+		}
+	}
+
+	if m.Status.OrdinalReservation != nil {
+		patch := client.MergeFrom(m.DeepCopy())
+		now := metav1.Now()
+		m.Status.OrdinalReservation.ReleasedAt = &now
+		if err := r.Status().Patch(ctx, m, patch); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		logger.Info("Released StatefulSet ordinal", "statefulset", m.Status.StatefulSetName,
+			"pod", podName, "method", m.Status.OrdinalReservation.Method, "replicas", m.Status.OriginalReplicas)
+	}
+	return ctrl.Result{}, true, nil
+}
@@ -0,0 +1,484 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+	"github.com/haidinhtuan/kubernetes-controller/internal/messaging"
+)
+
+// Plan check outcomes recorded in status.plan.checks.
+const (
+	checkPassed  = "Passed"
+	checkWarning = "Warning"
+	checkFailed  = "Failed"
+	checkSkipped = "Skipped"
+)
+
+// handlePlanning runs the pre-flight checks for a dry-run migration and
+// records the resulting plan in status. It never checkpoints, creates pods or
+// Jobs, or mutates the source workload; the only side effect outside the
+// StatefulMigration is a short-lived probe queue on the broker.
+func (r *StatefulMigrationReconciler) handlePlanning(ctx context.Context, m *migrationv1alpha1.StatefulMigration) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	base := m.DeepCopy()
+
+	plan := &migrationv1alpha1.MigrationPlan{
+		Strategy:   m.Spec.MigrationStrategy,
+		TargetNode: m.Spec.TargetNode,
+	}
+	// Spec: the checks handlePending fails the migration on.
+	specErr := validateSpec(m)
+	if specErr == nil && m.Spec.MigrationStrategy != "" {
+		specErr = validateMigrationStrategy(m)
+	}
+	if specErr != nil {
+		addPlanCheck(plan, "Spec", checkFailed, "%v", specErr)
+	} else {
+		addPlanCheck(plan, "Spec", checkPassed, "spec is valid")
+	}
+
+	// Source pod: same validation as handlePending, reported instead of
+	// waited on or failed.
+	sourcePod := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{Name: m.Spec.SourcePod, Namespace: m.Namespace}, sourcePod)
+	switch {
+	case errors.IsNotFound(err):
+		addPlanCheck(plan, "SourcePod", checkFailed, "source pod %q not found", m.Spec.SourcePod)
+		sourcePod = nil
+	case err != nil:
+		return ctrl.Result{}, err
+	case sourcePod.DeletionTimestamp != nil:
+		addPlanCheck(plan, "SourcePod", checkFailed, "source pod %q is terminating", m.Spec.SourcePod)
+	case sourcePod.Status.Phase != corev1.PodRunning:
+		addPlanCheck(plan, "SourcePod", checkFailed, "source pod %q is %s, not Running", m.Spec.SourcePod, sourcePod.Status.Phase)
+	default:
+		containerName := m.Spec.ContainerName
+		if containerName == "" && len(sourcePod.Spec.Containers) > 0 {
+			containerName = sourcePod.Spec.Containers[0].Name
+		}
+		if containerName == "" {
+			addPlanCheck(plan, "SourcePod", checkFailed, "could not determine container name for source pod")
+		} else {
+			addPlanCheck(plan, "SourcePod", checkPassed, "container %q running on node %s", containerName, sourcePod.Spec.NodeName)
+		}
+	}
+
+	if plan.Strategy == "" {
+		plan.Strategy = detectStrategy(m, sourcePod)
+	}
+	if sourcePod != nil {
+		plan.SourceNode = sourcePod.Spec.NodeName
+		r.planOwnership(ctx, m, sourcePod, plan)
+	}
+
+	if m.Spec.TargetCluster != nil {
+		r.planTargetCluster(ctx, m, plan)
+	}
+	r.planTargetNode(ctx, m, sourcePod, plan)
+	if sourcePod != nil {
+		r.planVolumes(ctx, m, sourcePod, plan)
+	}
+	r.planAgents(ctx, m, plan)
+	r.planBroker(ctx, m, plan)
+	r.planRegistry(ctx, m, plan)
+
+	plan.IdentitySwapPath, plan.PredictedDowntime = predictFinalization(m, plan)
+
+	var failed []string
+	for _, c := range plan.Checks {
+		if c.Status == checkFailed {
+			failed = append(failed, c.Name)
+		}
+	}
+	plan.Feasible = len(failed) == 0
+
+	cond := metav1.Condition{
+		Type:               "Planned",
+		Status:             metav1.ConditionTrue,
+		Reason:             "Feasible",
+		Message:            "all pre-flight checks passed",
+		LastTransitionTime: metav1.Now(),
+	}
+	if !plan.Feasible {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "ChecksFailed"
+		cond.Message = "failed checks: " + strings.Join(failed, ", ")
+	}
+	meta.SetStatusCondition(&m.Status.Conditions, cond)
+
+	m.Status.Plan = plan
+	m.Status.SourceNode = plan.SourceNode
+	m.Status.Phase = migrationv1alpha1.PhasePlanned
+	if err := r.Status().Patch(ctx, m, client.MergeFrom(base)); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	logger.Info("Dry run complete", "feasible", plan.Feasible, "strategy", plan.Strategy,
+		"transferPath", plan.TransferPath, "identitySwapPath", plan.IdentitySwapPath)
+	return ctrl.Result{}, nil
+}
+
+// addPlanCheck appends a check result to the plan.
+func addPlanCheck(plan *migrationv1alpha1.MigrationPlan, name, status, format string, args ...interface{}) {
+	plan.Checks = append(plan.Checks, migrationv1alpha1.PlanCheck{
+		Name:    name,
+		Status:  status,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// planOwnership resolves the source pod's owning StatefulSet or Deployment
+// and checks that the planned strategy can handle it.
+func (r *StatefulMigrationReconciler) planOwnership(ctx context.Context, m *migrationv1alpha1.StatefulMigration, sourcePod *corev1.Pod, plan *migrationv1alpha1.MigrationPlan) {
+	caps := capabilitiesOf(plan.Strategy, m)
+	if caps.TargetCluster {
+		// The source's owner stays behind in the source cluster.
+		if ref := podOwner(sourcePod); ref != nil {
+			plan.Owner = ref.Kind + "/" + ref.Name
+			addPlanCheck(plan, "Ownership", checkFailed, "owned by %s %q, which would recreate the source pod in the source cluster; only standalone pods can move across clusters", ref.Kind, ref.Name)
+			return
+		}
+		addPlanCheck(plan, "Ownership", checkPassed, "standalone pod")
+		return
+	}
+	for _, ref := range sourcePod.OwnerReferences {
+		switch ref.Kind {
+		case "StatefulSet":
+			plan.Owner = "StatefulSet/" + ref.Name
+			sts := &appsv1.StatefulSet{}
+			if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: m.Namespace}, sts); err != nil {
+				addPlanCheck(plan, "Ownership", checkFailed, "owning StatefulSet %q: %v", ref.Name, err)
+				return
+			}
+			if !caps.HoldsOrdinal {
+				addPlanCheck(plan, "Ownership", checkWarning, "StatefulSet %q owns the pod but the %s migration does not hold its ordinal (identitySwapMode None); the target pod will stay outside the StatefulSet", ref.Name, plan.Strategy)
+				return
+			}
+			ordinal, ok := podOrdinal(sourcePod.Name)
+			if !ok {
+				addPlanCheck(plan, "Ownership", checkFailed, "source pod %q has no StatefulSet ordinal", sourcePod.Name)
+				return
+			}
+			method, err := holdMethod(sts, ordinal)
+			if err != nil {
+				addPlanCheck(plan, "Ownership", checkFailed, "%v", err)
+				return
+			}
+			addPlanCheck(plan, "Ownership", checkPassed, "owned by StatefulSet %q; ordinal %d is held with %s", ref.Name, ordinal, method)
+			return
+
+		case "ReplicaSet":
+			rs := &appsv1.ReplicaSet{}
+			if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: m.Namespace}, rs); err != nil {
+				addPlanCheck(plan, "Ownership", checkFailed, "owning ReplicaSet %q: %v", ref.Name, err)
+				return
+			}
+			for _, rsRef := range rs.OwnerReferences {
+				if rsRef.Kind != "Deployment" {
+					continue
+				}
+				plan.Owner = "Deployment/" + rsRef.Name
+				deploy := &appsv1.Deployment{}
+				if err := r.Get(ctx, types.NamespacedName{Name: rsRef.Name, Namespace: m.Namespace}, deploy); err != nil {
+					addPlanCheck(plan, "Ownership", checkFailed, "owning Deployment %q: %v", rsRef.Name, err)
+					return
+				}
+				addPlanCheck(plan, "Ownership", checkPassed, "owned by Deployment %q", rsRef.Name)
+				return
+			}
+			plan.Owner = "ReplicaSet/" + ref.Name
+			addPlanCheck(plan, "Ownership", checkWarning, "owned by bare ReplicaSet %q; it will replace the source pod on its own", ref.Name)
+			return
+
+		default:
+			if ref.Controller != nil && *ref.Controller {
+				plan.Owner = ref.Kind + "/" + ref.Name
+				addPlanCheck(plan, "Ownership", checkWarning, "owned by unsupported controller %s %q", ref.Kind, ref.Name)
+				return
+			}
+		}
+	}
+	addPlanCheck(plan, "Ownership", checkPassed, "standalone pod")
+}
+
+// planVolumes checks that the source pod's claims can follow it: the planned
+// strategy must handle them (see checkVolumeHandling), and Local volumes are
+// copied through the ms2m-agents on both nodes.
+func (r *StatefulMigrationReconciler) planVolumes(ctx context.Context, m *migrationv1alpha1.StatefulMigration, sourcePod *corev1.Pod, plan *migrationv1alpha1.MigrationPlan) {
+	volumes, err := r.inspectVolumes(ctx, sourcePod)
+	if err != nil {
+		addPlanCheck(plan, "Volumes", checkFailed, "%v", err)
+		return
+	}
+	if len(volumes) == 0 {
+		addPlanCheck(plan, "Volumes", checkPassed, "no persistent volumes")
+		return
+	}
+	if err := checkVolumeHandling(plan.Strategy, capabilitiesOf(plan.Strategy, m), volumes); err != nil {
+		addPlanCheck(plan, "Volumes", checkFailed, "%v", err)
+		return
+	}
+	counts := make(map[string]int)
+	for _, v := range volumes {
+		counts[v.Handling]++
+	}
+	if counts[volumeLocal] > 0 {
+		_, sourceErr := r.findAgentPodIP(ctx, sourcePod.Spec.NodeName)
+		_, targetErr := r.findAgentPodIP(ctx, m.Spec.TargetNode)
+		if sourceErr != nil || targetErr != nil {
+			addPlanCheck(plan, "Volumes", checkFailed, "%d local volume(s) need an ms2m-agent on both nodes to copy their data", counts[volumeLocal])
+			return
+		}
+	}
+	addPlanCheck(plan, "Volumes", checkPassed, "%d shared, %d attachable, %d local", counts[volumeShared], counts[volumeAttachable], counts[volumeLocal])
+}
+
+// planTargetCluster checks spec.targetCluster and that the target namespace
+// exists in the target cluster and, within the same cluster, accepts pods
+// from the migration's namespace.
+func (r *StatefulMigrationReconciler) planTargetCluster(ctx context.Context, m *migrationv1alpha1.StatefulMigration, plan *migrationv1alpha1.MigrationPlan) {
+	if err := validateTargetCluster(m); err != nil {
+		addPlanCheck(plan, "TargetCluster", checkSkipped, "spec.targetCluster is invalid (see the Spec check)")
+		return
+	}
+	c, namespace, err := r.targetClient(ctx, m)
+	if err != nil {
+		addPlanCheck(plan, "TargetCluster", checkFailed, "%v", err)
+		return
+	}
+	if err := c.Get(ctx, types.NamespacedName{Name: namespace}, &corev1.Namespace{}); err != nil {
+		addPlanCheck(plan, "TargetCluster", checkFailed, "target namespace %s: %v", namespace, err)
+		return
+	}
+	if err := r.checkTargetNamespace(ctx, m); err != nil {
+		addPlanCheck(plan, "TargetCluster", checkFailed, "%v", err)
+		return
+	}
+	addPlanCheck(plan, "TargetCluster", checkPassed, "target namespace %s is reachable", namespace)
+}
+
+// planTargetNode checks that the target node exists, is schedulable and Ready,
+// and has room for the source pod's CPU and memory requests. A node of
+// another cluster is read through the target cluster's client.
+func (r *StatefulMigrationReconciler) planTargetNode(ctx context.Context, m *migrationv1alpha1.StatefulMigration, sourcePod *corev1.Pod, plan *migrationv1alpha1.MigrationPlan) {
+	target := m.Spec.TargetNode
+	if target == "" {
+		addPlanCheck(plan, "TargetNode", checkFailed, "spec.targetNode is not set")
+		return
+	}
+	remote := m.Spec.TargetCluster != nil && m.Spec.TargetCluster.KubeconfigSecretRef != nil
+	if sourcePod != nil && sourcePod.Spec.NodeName == target && !remote {
+		addPlanCheck(plan, "TargetNode", checkFailed, "target node %s is the source node", target)
+		return
+	}
+	c, _, err := r.targetClient(ctx, m)
+	if err != nil {
+		addPlanCheck(plan, "TargetNode", checkFailed, "target cluster: %v", err)
+		return
+	}
+
+	node := &corev1.Node{}
+	if err := c.Get(ctx, types.NamespacedName{Name: target}, node); err != nil {
+		if errors.IsNotFound(err) {
+			addPlanCheck(plan, "TargetNode", checkFailed, "target node %s not found", target)
+		} else {
+			addPlanCheck(plan, "TargetNode", checkFailed, "get target node %s: %v", target, err)
+		}
+		return
+	}
+	if node.Spec.Unschedulable {
+		addPlanCheck(plan, "TargetNode", checkFailed, "target node %s is cordoned", target)
+		return
+	}
+	ready := false
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady && c.Status == corev1.ConditionTrue {
+			ready = true
+		}
+	}
+	if !ready {
+		addPlanCheck(plan, "TargetNode", checkFailed, "target node %s is not Ready", target)
+		return
+	}
+	if sourcePod == nil {
+		addPlanCheck(plan, "TargetNode", checkPassed, "target node %s is Ready (capacity not checked without source pod)", target)
+		return
+	}
+
+	podList := &corev1.PodList{}
+	if err := c.List(ctx, podList); err != nil {
+		addPlanCheck(plan, "TargetNode", checkFailed, "list pods: %v", err)
+		return
+	}
+	used := corev1.ResourceList{}
+	for i := range podList.Items {
+		p := &podList.Items[i]
+		if p.Spec.NodeName != target || p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		addRequests(used, p)
+	}
+	needed := corev1.ResourceList{}
+	addRequests(needed, sourcePod)
+
+	var short []string
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		req, ok := needed[name]
+		if !ok || req.IsZero() {
+			continue
+		}
+		free := node.Status.Allocatable[name].DeepCopy()
+		free.Sub(used[name])
+		if free.Cmp(req) < 0 {
+			short = append(short, fmt.Sprintf("%s: requested %s, available %s", name, req.String(), free.String()))
+		}
+	}
+	if len(short) > 0 {
+		addPlanCheck(plan, "TargetNode", checkFailed, "insufficient capacity on %s (%s)", target, strings.Join(short, "; "))
+		return
+	}
+	addPlanCheck(plan, "TargetNode", checkPassed, "target node %s is Ready with capacity for the source pod's requests", target)
+}
+
+// addRequests adds the container resource requests of pod to list.
+func addRequests(list corev1.ResourceList, pod *corev1.Pod) {
+	for _, c := range pod.Spec.Containers {
+		for name, q := range c.Resources.Requests {
+			sum := list[name]
+			sum.Add(q)
+			list[name] = sum
+		}
+	}
+}
+
+// planAgents checks for ms2m-agent pods on the source and target nodes and
+// decides the transfer path handleTransferring would take.
+func (r *StatefulMigrationReconciler) planAgents(ctx context.Context, m *migrationv1alpha1.StatefulMigration, plan *migrationv1alpha1.MigrationPlan) {
+	_, sourceErr := r.findAgentPodIP(ctx, plan.SourceNode)
+	_, targetErr := r.findAgentPodIP(ctx, m.Spec.TargetNode)
+	if capabilitiesOf(plan.Strategy, m).TargetCluster {
+		// Only the source side of a cross-cluster migration uses an agent.
+		targetErr = nil
+	}
+
+	if m.Spec.TransferMode == "Direct" {
+		plan.TransferPath = "DirectJob"
+		if targetErr != nil {
+			addPlanCheck(plan, "Agents", checkFailed, "Direct transfer needs an ms2m-agent on the target node: %v", targetErr)
+			return
+		}
+		addPlanCheck(plan, "Agents", checkPassed, "ms2m-agent running on target node %s", m.Spec.TargetNode)
+		return
+	}
+
+	var warnings []string
+	if sourceErr == nil {
+		plan.TransferPath = "AgentRegistryPush"
+	} else {
+		plan.TransferPath = "RegistryJob"
+		warnings = append(warnings, "no ms2m-agent on source node, checkpoint will be pushed by a transfer Job")
+	}
+	swap := m.Spec.IdentitySwapMode != "" && m.Spec.IdentitySwapMode != "None" && m.Spec.IdentitySwapMode != swapReserveOrdinal
+	if swap && targetErr != nil {
+		warnings = append(warnings, "no ms2m-agent on target node, identity swap will load the re-checkpoint with a Job")
+	}
+	if len(warnings) > 0 {
+		addPlanCheck(plan, "Agents", checkWarning, "%s", strings.Join(warnings, "; "))
+		return
+	}
+	addPlanCheck(plan, "Agents", checkPassed, "ms2m-agent available on the nodes involved")
+}
+
+// planBroker checks broker reachability, that the primary queue exists, and
+// that the controller may declare and bind queues on the exchange, using a
+// temporary probe queue that is deleted again.
+func (r *StatefulMigrationReconciler) planBroker(ctx context.Context, m *migrationv1alpha1.StatefulMigration, plan *migrationv1alpha1.MigrationPlan) {
+	mqCfg := m.Spec.MessageQueueConfig
+	if mqCfg.QueueName == "" || mqCfg.ExchangeName == "" {
+		addPlanCheck(plan, "Broker", checkFailed, "messageQueueConfig.queueName and exchangeName are required")
+		return
+	}
+
+	// A connection of its own: connecting MsgClient would replace the one
+	// running migrations use.
+	broker := r.newBrokerClient()
+	if err := broker.Connect(ctx, mqCfg.BrokerURL); err != nil {
+		addPlanCheck(plan, "Broker", checkFailed, "broker connect: %v", err)
+		return
+	}
+	defer func() {
+		if err := broker.Close(); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to close broker connection after dry run")
+		}
+	}()
+
+	if _, err := broker.GetQueueDepth(ctx, mqCfg.QueueName); err != nil {
+		addPlanCheck(plan, "Broker", checkFailed, "primary queue %q: %v", mqCfg.QueueName, err)
+		return
+	}
+
+	probe := mqCfg.QueueName + ".ms2m-plan"
+	if err := broker.DeclareAndBindQueue(ctx, probe, mqCfg.ExchangeName); err != nil {
+		addPlanCheck(plan, "Broker", checkFailed, "declare/bind probe queue on exchange %q: %v", mqCfg.ExchangeName, err)
+		return
+	}
+	if err := broker.DeleteQueue(ctx, probe); err != nil {
+		addPlanCheck(plan, "Broker", checkWarning, "probe queue %q could not be deleted: %v", probe, err)
+		return
+	}
+	addPlanCheck(plan, "Broker", checkPassed, "broker reachable, queue %q exists, declare/bind permitted on %q", mqCfg.QueueName, mqCfg.ExchangeName)
+}
+
+// newBrokerClient returns an unconnected broker client (see NewBrokerClient).
+func (r *StatefulMigrationReconciler) newBrokerClient() messaging.BrokerClient {
+	if r.NewBrokerClient != nil {
+		return r.NewBrokerClient()
+	}
+	return messaging.NewRabbitMQClient()
+}
+
+// planRegistry checks push access to the checkpoint image repository. The
+// check uses the controller's credentials; the agent or transfer Job that
+// performs the real push authenticates separately.
+func (r *StatefulMigrationReconciler) planRegistry(ctx context.Context, m *migrationv1alpha1.StatefulMigration, plan *migrationv1alpha1.MigrationPlan) {
+	if m.Spec.TransferMode == "Direct" {
+		addPlanCheck(plan, "Registry", checkSkipped, "Direct transfer mode does not use a registry")
+		return
+	}
+	if m.Spec.CheckpointImageRepository == "" {
+		addPlanCheck(plan, "Registry", checkFailed, "spec.checkpointImageRepository is not set")
+		return
+	}
+	if r.Registry == nil {
+		addPlanCheck(plan, "Registry", checkSkipped, "no registry client configured")
+		return
+	}
+	if err := r.Registry.CheckPushAccess(ctx, checkpointImageTag(m)); err != nil {
+		addPlanCheck(plan, "Registry", checkFailed, "%v", err)
+		return
+	}
+	addPlanCheck(plan, "Registry", checkPassed, "push access to %s", m.Spec.CheckpointImageRepository)
+}
+
+// predictFinalization returns how handleFinalizing would settle pod identity
+// and the expected downtime class for the planned strategy.
+func predictFinalization(m *migrationv1alpha1.StatefulMigration, plan *migrationv1alpha1.MigrationPlan) (swapPath, downtime string) {
+	s, ok := lookupStrategy(plan.Strategy)
+	if !ok {
+		return "None", "None"
+	}
+	return s.PredictFinalization(m, plan.Owner)
+}
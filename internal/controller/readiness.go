@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+	"github.com/haidinhtuan/kubernetes-controller/pkg/protocol"
+)
+
+// Readiness signals, for spec.restoreReadiness.type.
+const (
+	readinessPodReady = "PodReady"
+	readinessRunning  = "Running"
+	readinessHTTP     = "HTTP"
+	readinessPing     = "Ping"
+)
+
+const (
+	// readinessPollInterval is how often a restored pod that is Running but
+	// not yet ready is checked again.
+	readinessPollInterval = time.Second
+
+	// readinessProbeTimeout bounds a single HTTP readiness probe.
+	readinessProbeTimeout = 2 * time.Second
+)
+
+// restoreReadiness returns spec.restoreReadiness, or an empty value when unset.
+func restoreReadiness(m *migrationv1alpha1.StatefulMigration) migrationv1alpha1.RestoreReadiness {
+	if m.Spec.RestoreReadiness == nil {
+		return migrationv1alpha1.RestoreReadiness{}
+	}
+	return *m.Spec.RestoreReadiness
+}
+
+// readinessType returns the readiness signal awaited after restore.
+func readinessType(m *migrationv1alpha1.StatefulMigration) string {
+	if t := restoreReadiness(m).Type; t != "" {
+		return t
+	}
+	return readinessPodReady
+}
+
+// validateRestoreReadiness rejects spec.restoreReadiness values the
+// controller cannot act on.
+func validateRestoreReadiness(m *migrationv1alpha1.StatefulMigration) error {
+	rr := restoreReadiness(m)
+	switch t := readinessType(m); t {
+	case readinessPodReady, readinessRunning:
+		return nil
+	case readinessHTTP:
+		if rr.HTTPPort <= 0 || rr.HTTPPort > 65535 {
+			return fmt.Errorf("spec.restoreReadiness.httpPort %d must be between 1 and 65535", rr.HTTPPort)
+		}
+		return nil
+	case readinessPing:
+		if !ackRequired(m) {
+			return fmt.Errorf("spec.restoreReadiness.type Ping requires spec.controlProtocol.ackMode Required")
+		}
+		return nil
+	default:
+		return fmt.Errorf("spec.restoreReadiness.type %q must be PodReady, Running, HTTP or Ping", t)
+	}
+}
+
+// awaitRestoreReady waits for the Running target pod to give the readiness
+// signal selected by spec.restoreReadiness, so START_REPLAY is not sent to a
+// process that has not reconnected to the broker yet. The first call records
+// status.restoreReadiness.runningAt. Returns done=true once the pod is ready;
+// the caller then records the latency with markRestoreReady.
+func (r *StatefulMigrationReconciler) awaitRestoreReady(ctx context.Context, m *migrationv1alpha1.StatefulMigration, pod *corev1.Pod) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+	gate := readinessType(m)
+
+	if m.Status.RestoreReadiness == nil || m.Status.RestoreReadiness.RunningAt == nil {
+		patch := client.MergeFrom(m.DeepCopy())
+		now := metav1.Now()
+		m.Status.RestoreReadiness = &migrationv1alpha1.RestoreReadinessStatus{Type: gate, RunningAt: &now}
+		if err := r.Status().Patch(ctx, m, patch); err != nil {
+			return ctrl.Result{}, false, err
+		}
+	}
+
+	ready := false
+	switch gate {
+	case readinessRunning:
+		ready = true
+	case readinessPodReady:
+		ready = podReady(pod)
+	case readinessHTTP:
+		if err := probeHTTP(ctx, pod, restoreReadiness(m)); err != nil {
+			logger.Info("Target pod readiness probe failed", "pod", pod.Name, "error", err.Error())
+		} else {
+			ready = true
+		}
+	case readinessPing:
+		result, done, err := r.awaitControl(ctx, m, "Restoring", pod.Name, protocol.ControlPing, nil)
+		if !done {
+			return result, false, err
+		}
+		ready = true
+	}
+	if !ready {
+		logger.Info("Waiting for target pod to become ready", "pod", pod.Name, "readiness", gate)
+		return ctrl.Result{RequeueAfter: readinessPollInterval}, false, nil
+	}
+	return ctrl.Result{}, true, nil
+}
+
+// markRestoreReady records the time the restored pod became ready and the
+// latency since it was first seen Running.
+func markRestoreReady(m *migrationv1alpha1.StatefulMigration) {
+	status := m.Status.RestoreReadiness
+	if status == nil || status.RunningAt == nil {
+		return
+	}
+	now := metav1.Now()
+	status.ReadyAt = &now
+	status.RestoreToReady = now.Sub(status.RunningAt.Time).Round(time.Millisecond).String()
+}
+
+// podReady reports whether pod's Ready condition is True.
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// probeHTTP GETs the readiness endpoint on the pod IP and returns an error
+// unless it answers 2xx.
+func probeHTTP(ctx context.Context, pod *corev1.Pod, rr migrationv1alpha1.RestoreReadiness) error {
+	if pod.Status.PodIP == "" {
+		return fmt.Errorf("pod %s has no IP yet", pod.Name)
+	}
+	path := rr.HTTPPath
+	if path == "" {
+		path = "/"
+	}
+	url := "http://" + net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(rr.HTTPPort))) + path
+
+	ctx, cancel := context.WithTimeout(ctx, readinessProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+)
+
+// defaultRestoreFields are the source PodSpec and Container fields copied to
+// restored pods unless listed in spec.restorePodSpec.exclude. Names are the
+// JSON field names; "securityContext" covers both the pod and the containers.
+var defaultRestoreFields = []string{
+	// Pod level
+	"volumes",
+	"serviceAccountName",
+	"automountServiceAccountToken",
+	"securityContext",
+	"tolerations",
+	"priorityClassName",
+	"dnsPolicy",
+	"dnsConfig",
+	"hostAliases",
+	"runtimeClassName",
+	"terminationGracePeriodSeconds",
+	"enableServiceLinks",
+	// Container level
+	"env",
+	"envFrom",
+	"resources",
+	"volumeMounts",
+	"volumeDevices",
+	"livenessProbe",
+	"readinessProbe",
+	"startupProbe",
+	"lifecycle",
+	"terminationMessagePath",
+	"terminationMessagePolicy",
+}
+
+// optionalRestoreFields are only copied when listed in
+// spec.restorePodSpec.include. Node selection and affinity usually pin the
+// pod to the source node, init containers would run again ahead of the
+// restore, and a shadow pod sharing the source's hostname and subdomain would
+// collide with it in the headless Service's DNS.
+var optionalRestoreFields = []string{
+	"nodeSelector",
+	"affinity",
+	"topologySpreadConstraints",
+	"initContainers",
+	"hostname",
+	"subdomain",
+	"readinessGates",
+	"shareProcessNamespace",
+	"hostNetwork",
+	"hostPID",
+	"hostIPC",
+}
+
+// Fields not named in either list are never copied: nodeName is set to the
+// target node, priority, preemptionPolicy and overhead are filled in by
+// admission, and ephemeral containers cannot be set at creation. The
+// checkpointed container never gets command, args or workingDir from the
+// source; those are part of the restored process.
+
+// serviceAccountVolumePrefix names the projected token volume the
+// ServiceAccount admission plugin injects. It is dropped so admission injects
+// a fresh one for the restored pod.
+const serviceAccountVolumePrefix = "kube-api-access-"
+
+// validateRestorePodSpec rejects unknown field names in spec.restorePodSpec.
+func validateRestorePodSpec(m *migrationv1alpha1.StatefulMigration) error {
+	if m.Spec.RestorePodSpec == nil {
+		return nil
+	}
+	known := make(map[string]bool)
+	for _, f := range defaultRestoreFields {
+		known[f] = true
+	}
+	for _, f := range optionalRestoreFields {
+		known[f] = true
+	}
+	for _, list := range []struct {
+		name   string
+		fields []string
+	}{
+		{"include", m.Spec.RestorePodSpec.Include},
+		{"exclude", m.Spec.RestorePodSpec.Exclude},
+	} {
+		for _, f := range list.fields {
+			if !known[f] {
+				return fmt.Errorf("spec.restorePodSpec.%s has unknown field %q", list.name, f)
+			}
+		}
+	}
+	return nil
+}
+
+// restoreFields returns the set of fields to copy for m.
+func restoreFields(m *migrationv1alpha1.StatefulMigration) map[string]bool {
+	fields := make(map[string]bool)
+	for _, f := range defaultRestoreFields {
+		fields[f] = true
+	}
+	if p := m.Spec.RestorePodSpec; p != nil {
+		for _, f := range p.Include {
+			fields[f] = true
+		}
+		for _, f := range p.Exclude {
+			delete(fields, f)
+		}
+	}
+	return fields
+}
+
+// sourcePodSpec returns the source pod's spec captured during Pending,
+// falling back to just its containers for migrations that predate the full
+// capture.
+func sourcePodSpec(m *migrationv1alpha1.StatefulMigration) *corev1.PodSpec {
+	if m.Status.SourcePodSpec != nil {
+		return m.Status.SourcePodSpec
+	}
+	return &corev1.PodSpec{Containers: m.Status.SourceContainers}
+}
+
+// restoredPodSpec builds the spec of a restored pod from the source pod's
+// spec, copying the fields selected by spec.restorePodSpec. The checkpointed
+// container runs checkpointImage; other containers keep their image, command
+// and args and start fresh. With keepIdentity the source's hostname and
+// subdomain are always kept, for a replacement that takes over the source's
+// name. extraEnv is appended to every container.
+func restoredPodSpec(m *migrationv1alpha1.StatefulMigration, src *corev1.PodSpec, checkpointImage string, pullPolicy corev1.PullPolicy, keepIdentity bool, extraEnv ...corev1.EnvVar) corev1.PodSpec {
+	fields := restoreFields(m)
+	if keepIdentity {
+		fields["hostname"] = true
+		fields["subdomain"] = true
+	}
+
+	spec := corev1.PodSpec{
+		NodeName:         m.Spec.TargetNode,
+		ImagePullSecrets: m.Status.ImagePullSecrets,
+	}
+
+	// Volumes that are not carried over take their mounts with them.
+	kept := make(map[string]bool)
+	if fields["volumes"] {
+		for _, v := range src.Volumes {
+			if strings.HasPrefix(v.Name, serviceAccountVolumePrefix) {
+				continue
+			}
+			spec.Volumes = append(spec.Volumes, *v.DeepCopy())
+			kept[v.Name] = true
+		}
+	}
+
+	for _, c := range src.Containers {
+		restored := restoredContainer(c, fields, kept)
+		if c.Name == m.Status.ContainerName {
+			restored.Image = checkpointImage
+			restored.ImagePullPolicy = pullPolicy
+		} else {
+			restored.Image = c.Image
+			restored.ImagePullPolicy = c.ImagePullPolicy
+			restored.Command = c.Command
+			restored.Args = c.Args
+			restored.WorkingDir = c.WorkingDir
+		}
+		restored.Env = append(restored.Env, extraEnv...)
+		spec.Containers = append(spec.Containers, restored)
+	}
+	if len(spec.Containers) == 0 {
+		spec.Containers = []corev1.Container{{
+			Name:            m.Status.ContainerName,
+			Image:           checkpointImage,
+			ImagePullPolicy: pullPolicy,
+			Env:             extraEnv,
+		}}
+	}
+	if fields["initContainers"] {
+		for _, c := range src.InitContainers {
+			restored := restoredContainer(c, fields, kept)
+			restored.Image = c.Image
+			restored.ImagePullPolicy = c.ImagePullPolicy
+			restored.Command = c.Command
+			restored.Args = c.Args
+			restored.WorkingDir = c.WorkingDir
+			restored.RestartPolicy = c.RestartPolicy
+			spec.InitContainers = append(spec.InitContainers, restored)
+		}
+	}
+
+	if fields["serviceAccountName"] {
+		spec.ServiceAccountName = src.ServiceAccountName
+	}
+	if fields["automountServiceAccountToken"] {
+		spec.AutomountServiceAccountToken = src.AutomountServiceAccountToken
+	}
+	if fields["securityContext"] && src.SecurityContext != nil {
+		spec.SecurityContext = src.SecurityContext.DeepCopy()
+	}
+	if fields["tolerations"] {
+		spec.Tolerations = src.Tolerations
+	}
+	if fields["priorityClassName"] {
+		spec.PriorityClassName = src.PriorityClassName
+	}
+	if fields["dnsPolicy"] {
+		spec.DNSPolicy = src.DNSPolicy
+	}
+	if fields["dnsConfig"] && src.DNSConfig != nil {
+		spec.DNSConfig = src.DNSConfig.DeepCopy()
+	}
+	if fields["hostAliases"] {
+		spec.HostAliases = src.HostAliases
+	}
+	if fields["runtimeClassName"] {
+		spec.RuntimeClassName = src.RuntimeClassName
+	}
+	if fields["terminationGracePeriodSeconds"] {
+		spec.TerminationGracePeriodSeconds = src.TerminationGracePeriodSeconds
+	}
+	if fields["enableServiceLinks"] {
+		spec.EnableServiceLinks = src.EnableServiceLinks
+	}
+	if fields["nodeSelector"] {
+		spec.NodeSelector = src.NodeSelector
+	}
+	if fields["affinity"] && src.Affinity != nil {
+		spec.Affinity = src.Affinity.DeepCopy()
+	}
+	if fields["topologySpreadConstraints"] {
+		spec.TopologySpreadConstraints = src.TopologySpreadConstraints
+	}
+	if fields["hostname"] {
+		spec.Hostname = src.Hostname
+	}
+	if fields["subdomain"] {
+		spec.Subdomain = src.Subdomain
+	}
+	if fields["readinessGates"] {
+		spec.ReadinessGates = src.ReadinessGates
+	}
+	if fields["shareProcessNamespace"] {
+		spec.ShareProcessNamespace = src.ShareProcessNamespace
+	}
+	if fields["hostNetwork"] {
+		spec.HostNetwork = src.HostNetwork
+	}
+	if fields["hostPID"] {
+		spec.HostPID = src.HostPID
+	}
+	if fields["hostIPC"] {
+		spec.HostIPC = src.HostIPC
+	}
+	return spec
+}
+
+// restoredContainer copies the selected container-level fields of c. Image,
+// command and args are left to the caller. Mounts of volumes missing from
+// kept are dropped.
+func restoredContainer(c corev1.Container, fields, kept map[string]bool) corev1.Container {
+	out := corev1.Container{
+		Name:  c.Name,
+		Ports: c.Ports,
+	}
+	if fields["env"] {
+		out.Env = append([]corev1.EnvVar(nil), c.Env...)
+	}
+	if fields["envFrom"] {
+		out.EnvFrom = c.EnvFrom
+	}
+	if fields["resources"] {
+		out.Resources = *c.Resources.DeepCopy()
+	}
+	if fields["volumeMounts"] {
+		for _, vm := range c.VolumeMounts {
+			if kept[vm.Name] {
+				out.VolumeMounts = append(out.VolumeMounts, vm)
+			}
+		}
+	}
+	if fields["volumeDevices"] {
+		for _, vd := range c.VolumeDevices {
+			if kept[vd.Name] {
+				out.VolumeDevices = append(out.VolumeDevices, vd)
+			}
+		}
+	}
+	if fields["livenessProbe"] && c.LivenessProbe != nil {
+		out.LivenessProbe = c.LivenessProbe.DeepCopy()
+	}
+	if fields["readinessProbe"] && c.ReadinessProbe != nil {
+		out.ReadinessProbe = c.ReadinessProbe.DeepCopy()
+	}
+	if fields["startupProbe"] && c.StartupProbe != nil {
+		out.StartupProbe = c.StartupProbe.DeepCopy()
+	}
+	if fields["lifecycle"] && c.Lifecycle != nil {
+		out.Lifecycle = c.Lifecycle.DeepCopy()
+	}
+	if fields["securityContext"] && c.SecurityContext != nil {
+		out.SecurityContext = c.SecurityContext.DeepCopy()
+	}
+	if fields["terminationMessagePath"] {
+		out.TerminationMessagePath = c.TerminationMessagePath
+	}
+	if fields["terminationMessagePolicy"] {
+		out.TerminationMessagePolicy = c.TerminationMessagePolicy
+	}
+	return out
+}
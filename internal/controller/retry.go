@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+	"github.com/haidinhtuan/kubernetes-controller/internal/messaging"
+	"github.com/haidinhtuan/kubernetes-controller/internal/retry"
+)
+
+// Built-in defaults for spec.retryPolicy.
+const (
+	defaultRetryMaxAttempts    = 5
+	defaultRetryInitialBackoff = 1 * time.Second
+	defaultRetryMaxBackoff     = 30 * time.Second
+)
+
+// retryPolicy returns spec.retryPolicy with defaults filled in.
+func retryPolicy(m *migrationv1alpha1.StatefulMigration) (maxAttempts int32, initial, max time.Duration) {
+	var p migrationv1alpha1.RetryPolicy
+	if m.Spec.RetryPolicy != nil {
+		p = *m.Spec.RetryPolicy
+	}
+	maxAttempts = p.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultRetryMaxAttempts
+	}
+	return maxAttempts, seconds(p.InitialBackoffSeconds, defaultRetryInitialBackoff), seconds(p.MaxBackoffSeconds, defaultRetryMaxBackoff)
+}
+
+// RetryOrFail handles an error from a broker, kubelet, agent or API server
+// call made by a phase handler. Permanent errors fail the migration at once.
+// Transient errors are counted in status.retryAttempts under op and the phase
+// is requeued with exponential backoff, until spec.retryPolicy.maxAttempts is
+// reached and the migration fails. The phase handler runs again from the top
+// on retry, so every call routed through here must be idempotent. A broker
+// error meaning the connection is gone reconnects MsgClient first.
+func (r *StatefulMigrationReconciler) RetryOrFail(ctx context.Context, m *migrationv1alpha1.StatefulMigration, op string, err error) (ctrl.Result, error) {
+	reason := fmt.Sprintf("%s: %v", op, err)
+	if !retry.IsTransient(err) {
+		return r.failMigration(ctx, m, reason)
+	}
+
+	maxAttempts, initial, max := retryPolicy(m)
+	attempt := m.Status.RetryAttempts[op] + 1
+	if attempt >= maxAttempts {
+		return r.failMigration(ctx, m, fmt.Sprintf("%s (gave up after %d attempts)", reason, attempt))
+	}
+
+	// A closed connection or channel stays closed; retrying on it would
+	// fail every attempt the same way.
+	if messaging.IsDisconnected(err) {
+		if err := r.MsgClient.Connect(ctx, m.Spec.MessageQueueConfig.BrokerURL); err != nil {
+			log.FromContext(ctx).Error(err, "Broker reconnect failed", "operation", op)
+		}
+	}
+
+	backoff := retry.Backoff(attempt, initial, max)
+	log.FromContext(ctx).Info("Transient error, retrying", "operation", op, "attempt", attempt, "maxAttempts", maxAttempts, "backoff", backoff, "err", err)
+
+	patch := client.MergeFrom(m.DeepCopy())
+	if m.Status.RetryAttempts == nil {
+		m.Status.RetryAttempts = make(map[string]int32)
+	}
+	m.Status.RetryAttempts[op] = attempt
+	m.Status.LastRetryError = reason
+	if err := r.Status().Patch(ctx, m, patch); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: backoff}, nil
+}
+
+// retrySucceeded clears the attempt count of op once it succeeds, so
+// transient errors spread over a long phase are not added up. Operations
+// run once per phase need not call it: transitionPhase clears all counts.
+func (r *StatefulMigrationReconciler) retrySucceeded(ctx context.Context, m *migrationv1alpha1.StatefulMigration, op string) error {
+	if _, ok := m.Status.RetryAttempts[op]; !ok {
+		return nil
+	}
+	patch := client.MergeFrom(m.DeepCopy())
+	delete(m.Status.RetryAttempts, op)
+	return r.Status().Patch(ctx, m, patch)
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+)
+
+// sequentialStrategy deletes the source pod before restoring the target
+// under the same name, holding the source's StatefulSet ordinal in between.
+type sequentialStrategy struct{}
+
+// Capabilities: the source is deleted first, which lets its claims move to
+// the target.
+func (sequentialStrategy) Capabilities(*migrationv1alpha1.StatefulMigration) Capabilities {
+	return Capabilities{DeletesSource: true, HoldsOrdinal: true, Volumes: VolumesMoved}
+}
+
+func (sequentialStrategy) Validate(context.Context, *StatefulMigrationReconciler, *migrationv1alpha1.StatefulMigration, *corev1.Pod) error {
+	return nil
+}
+
+// PredictFinalization: nothing serves from the source's deletion until the
+// target is restored.
+func (sequentialStrategy) PredictFinalization(_ *migrationv1alpha1.StatefulMigration, owner string) (string, string) {
+	if strings.HasPrefix(owner, "StatefulSet/") {
+		return "OrdinalRelease", "Full"
+	}
+	return "None", "Full"
+}
+
+func (sequentialStrategy) TargetPodName(m *migrationv1alpha1.StatefulMigration) string {
+	return m.Spec.SourcePod
+}
+
+// Restore holds the source's ordinal and deletes the source pod, moves its
+// volumes, then restores the target from the spec captured in Pending.
+func (s sequentialStrategy) Restore(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration) (ctrl.Result, *corev1.Pod, error) {
+	logger := log.FromContext(ctx)
+	name := s.TargetPodName(m)
+
+	targetPod, err := r.LookupTarget(ctx, m, name)
+	if err != nil {
+		return ctrl.Result{}, nil, err
+	}
+	if targetPod != nil {
+		// A pod without migration labels was not created by us: it is the
+		// original source pod. Hold its ordinal and delete it; no other
+		// ordinal of the StatefulSet is touched.
+		if targetPod.Labels["migration.ms2m.io/migration"] != m.Name {
+			if m.Status.StatefulSetName != "" {
+				if err := r.HoldOrdinal(ctx, m); err != nil && !errors.IsNotFound(err) {
+					result, err := r.RetryOrFail(ctx, m, "hold StatefulSet ordinal", err)
+					return result, nil, err
+				}
+			}
+			if targetPod.DeletionTimestamp == nil {
+				if err := r.Delete(ctx, targetPod); err != nil && !errors.IsNotFound(err) {
+					return ctrl.Result{}, nil, err
+				}
+				logger.Info("Deleted source pod", "pod", name)
+			}
+			logger.Info("Waiting for source pod to be removed", "pod", name)
+			return ctrl.Result{RequeueAfter: 2 * time.Second}, nil, nil
+		}
+		return r.RunningTarget(ctx, m, targetPod)
+	}
+
+	// The source pod is gone, move its volumes before the target pod
+	// claims them.
+	if unsharedVolume(m.Status.Volumes) != nil {
+		if result, done, err := r.handleVolumes(ctx, m); !done {
+			return result, nil, err
+		}
+	}
+
+	result, err := r.CreateTarget(ctx, m, name, sourcePodSpec(m), m.Status.SourcePodLabels, false)
+	return result, nil, err
+}
+
+// Finalize releases the held ordinal so the StatefulSet adopts the target.
+func (sequentialStrategy) Finalize(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, _ client.Object) (ctrl.Result, bool, error) {
+	if m.Status.StatefulSetName == "" {
+		return ctrl.Result{}, true, nil
+	}
+	return r.ReleaseOrdinal(ctx, m, m.Status.TargetPod)
+}
+
+// Rollback deletes the target pod and releases the held ordinal. The
+// target of a standalone pod is left alone once the source is deleted: no
+// owner would bring the workload back.
+func (s sequentialStrategy) Rollback(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, record func(string, ...interface{})) {
+	if unownedSourceDeleted(m) {
+		log.FromContext(ctx).Info("Abort: leaving the target pod, the only copy of a standalone workload", "pod", s.TargetPodName(m))
+		return
+	}
+	r.AbortTargetPod(ctx, m, s.TargetPodName(m), record)
+}
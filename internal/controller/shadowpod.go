@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+)
+
+// shadowPodStrategy restores a shadow pod next to the still-running source.
+// For StatefulSet pods spec.identitySwapMode decides how the shadow gets the
+// source's name back: by an identity swap in Finalizing, or with
+// ReserveOrdinal by restoring under that name directly.
+type shadowPodStrategy struct{}
+
+// Capabilities: the shadow pod runs next to the source behind its Services
+// and mounts its claims. With ReserveOrdinal it takes over the source's
+// name instead, so no Services are shared.
+func (shadowPodStrategy) Capabilities(m *migrationv1alpha1.StatefulMigration) Capabilities {
+	swapMode := m.Spec.IdentitySwapMode
+	return Capabilities{
+		SourceRunsAlongside: true,
+		SharesServices:      !reserveOrdinal(m),
+		HoldsOrdinal:        swapMode != "" && swapMode != "None",
+		Volumes:             VolumesShared,
+	}
+}
+
+// Validate checks that a ReserveOrdinal migration can hold the source's
+// ordinal.
+func (shadowPodStrategy) Validate(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, _ *corev1.Pod) error {
+	if !reserveOrdinal(m) {
+		return nil
+	}
+	return r.checkOrdinalReservable(ctx, m)
+}
+
+func (shadowPodStrategy) PredictFinalization(m *migrationv1alpha1.StatefulMigration, owner string) (string, string) {
+	isStatefulSet := strings.HasPrefix(owner, "StatefulSet/")
+	swapMode := m.Spec.IdentitySwapMode
+	switch {
+	case isStatefulSet && swapMode == swapReserveOrdinal:
+		// No pod consumes between the source fence and the target restore.
+		return swapMode, "Brief"
+	case isStatefulSet && swapMode != "" && swapMode != "None":
+		if swapMode == "Cutoff" {
+			return swapMode, "Brief"
+		}
+		return swapMode, "None"
+	case strings.HasPrefix(owner, "Deployment/"):
+		return "ReplicaSetAdoption", "None"
+	default:
+		return "None", "None"
+	}
+}
+
+func (shadowPodStrategy) TargetPodName(m *migrationv1alpha1.StatefulMigration) string {
+	if reserveOrdinal(m) {
+		return m.Spec.SourcePod
+	}
+	return m.Spec.SourcePod + "-shadow"
+}
+
+// Restore creates the shadow pod from the live source pod's spec. With
+// ReserveOrdinal the source is fenced and its ordinal held first, and the
+// target is built from the spec captured in Pending.
+func (s shadowPodStrategy) Restore(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration) (ctrl.Result, *corev1.Pod, error) {
+	if reserveOrdinal(m) {
+		if result, done, err := r.reserveSourceOrdinal(ctx, m); !done {
+			return result, nil, err
+		}
+	}
+	name := s.TargetPodName(m)
+
+	targetPod, err := r.LookupTarget(ctx, m, name)
+	if err != nil {
+		return ctrl.Result{}, nil, err
+	}
+	if targetPod != nil {
+		return r.RunningTarget(ctx, m, targetPod)
+	}
+
+	if reserveOrdinal(m) {
+		result, err := r.CreateTarget(ctx, m, name, sourcePodSpec(m), m.Status.SourcePodLabels, true)
+		return result, nil, err
+	}
+	sourcePod := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: m.Spec.SourcePod, Namespace: m.Namespace}, sourcePod); err != nil {
+		result, err := r.RetryOrFail(ctx, m, "source pod lookup for restore", err)
+		return result, nil, err
+	}
+	result, err := r.CreateTarget(ctx, m, name, &sourcePod.Spec, sourcePod.Labels, false)
+	return result, nil, err
+}
+
+// Finalize moves Service traffic to the target, then retires the source:
+// through the identity swap for StatefulSet pods, by releasing the ordinal
+// for ReserveOrdinal, or by handing the shadow to the source's ReplicaSet
+// and deleting the source otherwise.
+func (s shadowPodStrategy) Finalize(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, base client.Object) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+
+	// Move Service traffic to the shadow pod before the source goes away.
+	if result, done, err := r.handoverTraffic(ctx, m); !done {
+		return result, false, err
+	}
+
+	swapMode := m.Spec.IdentitySwapMode
+	switch {
+	case reserveOrdinal(m):
+		// The target already holds the source's name; the StatefulSet
+		// takes it over once the ordinal is released.
+		return r.ReleaseOrdinal(ctx, m, m.Status.TargetPod)
+
+	case m.Status.StatefulSetName != "" && swapMode != "" && swapMode != "None":
+		result, done, err := s.identitySwap(ctx, r, m, base)
+		if err != nil {
+			return result, false, err
+		}
+		return result, done, nil
+	}
+
+	// A Deployment's shadow pod joins the ReplicaSet in place of the
+	// source, so the replica survives without a rollout.
+	if m.Status.DeploymentName != "" {
+		if result, done, err := r.adoptShadow(ctx, m); !done {
+			return result, false, err
+		}
+	}
+	sourcePod := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{Name: m.Spec.SourcePod, Namespace: m.Namespace}, sourcePod)
+	if err == nil {
+		if delErr := r.Delete(ctx, sourcePod); delErr != nil {
+			logger.Error(delErr, "Failed to delete source pod", "pod", m.Spec.SourcePod)
+		}
+	} else if !errors.IsNotFound(err) {
+		return ctrl.Result{}, false, err
+	}
+	return ctrl.Result{}, true, nil
+}
+
+// Rollback deletes the target pod, or during an identity swap the
+// replacement pod, leaving the source or shadow pod serving.
+func (s shadowPodStrategy) Rollback(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, record func(string, ...interface{})) {
+	if inIdentitySwap(m) {
+		r.abortIdentitySwap(ctx, m, record)
+		return
+	}
+	r.AbortTargetPod(ctx, m, s.TargetPodName(m), record)
+}
@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+	"github.com/haidinhtuan/kubernetes-controller/pkg/protocol"
+)
+
+// Source fencing methods, recorded in status.sourceFence.method.
+const (
+	fenceStopConsuming = "StopConsuming"
+	fenceDeleted       = "Deleted"
+)
+
+// sourceFencePollInterval is how often the reply queue or the primary queue's
+// consumer count is checked while waiting for the source to stop consuming.
+const sourceFencePollInterval = time.Second
+
+// sourceRunsAlongside reports whether the source pod keeps running next to
+// the target through Replaying. A migration without a strategy skipped
+// detection in Pending, so nothing is known about its source.
+func sourceRunsAlongside(m *migrationv1alpha1.StatefulMigration) bool {
+	return m.Spec.MigrationStrategy != "" && strategyCapabilities(m).SourceRunsAlongside
+}
+
+// needsSourceFence reports whether the source pod is still running alongside
+// the target and has not been fenced yet.
+func needsSourceFence(m *migrationv1alpha1.StatefulMigration) bool {
+	if !sourceRunsAlongside(m) {
+		return false
+	}
+	return m.Status.SourceFence == nil || m.Status.SourceFence.FencedAt == nil
+}
+
+// fenceSource stops the source pod from consuming the primary queue. It sends
+// STOP_CONSUMING to the source and waits for it to be acknowledged. With
+// spec.controlProtocol.ackMode None it instead waits for the broker to report
+// no consumer on the primary queue; the target only consumes the replay queue
+// until END_REPLAY, so any consumer left is the source's. If the source has
+// not stopped within spec.timeouts.sourceFenceSeconds, or nacks the request,
+// the migration fails, unless spec.timeouts.onSourceFenceTimeout allows a
+// standalone source to be deleted instead. Returns done=true once the source
+// is fenced.
+func (r *StatefulMigrationReconciler) fenceSource(ctx context.Context, m *migrationv1alpha1.StatefulMigration) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+	primaryQueue := m.Spec.MessageQueueConfig.QueueName
+	const step = "SourceFence"
+
+	if m.Status.SourceFence == nil || m.Status.SourceFence.RequestedAt == nil {
+		payload := map[string]interface{}{
+			"queue": primaryQueue,
+		}
+		var err error
+		if ackRequired(m) {
+			err = r.sendControl(ctx, m, step, m.Spec.SourcePod, protocol.ControlStopConsuming, payload)
+		} else {
+			err = r.notify(ctx, m, m.Spec.SourcePod, protocol.ControlStopConsuming, payload)
+		}
+		if err != nil {
+			result, err := r.RetryOrFail(ctx, m, "send STOP_CONSUMING", err)
+			return result, false, err
+		}
+		patch := client.MergeFrom(m.DeepCopy())
+		if m.Status.SourceFence == nil {
+			m.Status.SourceFence = &migrationv1alpha1.SourceFenceStatus{}
+		}
+		now := metav1.Now()
+		m.Status.SourceFence.RequestedAt = &now
+		if err := r.Status().Patch(ctx, m, patch); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		logger.Info("Sent STOP_CONSUMING to source pod", "pod", m.Spec.SourcePod, "queue", primaryQueue)
+	}
+
+	stopped, refused := false, false
+	if ackRequired(m) {
+		reply := controlReplied(m, step, protocol.ControlStopConsuming)
+		if reply == nil {
+			var err error
+			if reply, err = r.pollControl(ctx, m); err != nil {
+				result, err := r.RetryOrFail(ctx, m, "receive STOP_CONSUMING reply", err)
+				return result, false, err
+			}
+		}
+		if reply != nil {
+			stopped = reply.Status == string(protocol.ReplyAck)
+			refused = !stopped
+		}
+	} else {
+		consumers, err := r.MsgClient.GetQueueConsumers(ctx, primaryQueue)
+		if err != nil {
+			result, err := r.RetryOrFail(ctx, m, "get queue consumers", err)
+			return result, false, err
+		}
+		if err := r.retrySucceeded(ctx, m, "get queue consumers"); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		stopped = consumers == 0
+	}
+
+	method := fenceStopConsuming
+	if !stopped {
+		waited := time.Since(m.Status.SourceFence.RequestedAt.Time)
+		if !refused && waited <= sourceFenceTimeout(m) {
+			logger.Info("Waiting for source pod to stop consuming", "pod", m.Spec.SourcePod, "queue", primaryQueue)
+			return ctrl.Result{RequeueAfter: sourceFencePollInterval}, false, nil
+		}
+
+		// The source ignored or refused STOP_CONSUMING. Deleting it closes
+		// its connection and cancels the consumer, but only when asked to
+		// and when no owner would bring it back as a second consumer.
+		sourcePod := &corev1.Pod{}
+		err := r.Get(ctx, types.NamespacedName{Name: m.Spec.SourcePod, Namespace: m.Namespace}, sourcePod)
+		if err != nil && !errors.IsNotFound(err) {
+			return ctrl.Result{}, false, err
+		}
+		reason := fmt.Sprintf("source pod %s did not stop consuming queue %s", m.Spec.SourcePod, primaryQueue)
+		if refused {
+			reason = fmt.Sprintf("source pod %s refused to stop consuming queue %s", m.Spec.SourcePod, primaryQueue)
+		}
+		if timeouts(m).OnSourceFenceTimeout != "Delete" {
+			result, err := r.failMigration(ctx, m, reason+"; set spec.timeouts.onSourceFenceTimeout to Delete to delete an unresponsive standalone source")
+			return result, false, err
+		}
+		if err == nil {
+			if ref := podOwner(sourcePod); ref != nil {
+				result, err := r.failMigration(ctx, m, fmt.Sprintf("%s; not deleting it since %s %q would recreate it", reason, ref.Kind, ref.Name))
+				return result, false, err
+			}
+			logger.Info("Source pod did not stop consuming, deleting it",
+				"pod", m.Spec.SourcePod, "waited", waited.Round(time.Second), "refused", refused)
+			gracePeriod := int64(0)
+			if err := r.Delete(ctx, sourcePod, &client.DeleteOptions{
+				GracePeriodSeconds: &gracePeriod,
+			}); err != nil && !errors.IsNotFound(err) {
+				return ctrl.Result{}, false, err
+			}
+		}
+		method = fenceDeleted
+	}
+
+	// Best-effort: the depth is reported, not acted on.
+	primaryDepth, err := r.MsgClient.GetQueueDepth(ctx, primaryQueue)
+	if err != nil {
+		logger.Error(err, "Failed to read primary queue depth at fence")
+	}
+
+	patch := client.MergeFrom(m.DeepCopy())
+	now := metav1.Now()
+	fence := m.Status.SourceFence
+	fence.Method = method
+	fence.FencedAt = &now
+	fence.PrimaryQueueDepthAtFence = int32(primaryDepth)
+	if fence.CheckpointedAt != nil {
+		fence.DuplicateWindow = now.Sub(fence.CheckpointedAt.Time).Round(time.Millisecond).String()
+	}
+	// A reply that never came is no longer awaited.
+	if controlPending(m, step, protocol.ControlStopConsuming) {
+		m.Status.ControlRequest = nil
+	}
+	if err := r.Status().Patch(ctx, m, patch); err != nil {
+		return ctrl.Result{}, false, err
+	}
+	logger.Info("Source pod fenced", "method", method, "duplicateWindow", fence.DuplicateWindow,
+		"primaryQueueDepth", primaryDepth)
+	return ctrl.Result{}, true, nil
+}
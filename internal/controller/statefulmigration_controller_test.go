@@ -2,26 +2,45 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 
 	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+	"github.com/haidinhtuan/kubernetes-controller/internal/checkpoint"
 	"github.com/haidinhtuan/kubernetes-controller/internal/messaging"
+	"github.com/haidinhtuan/kubernetes-controller/internal/retry"
+	"github.com/haidinhtuan/kubernetes-controller/pkg/protocol"
 )
 
 // testScheme builds a scheme with all types needed by the controller tests.
@@ -76,6 +95,7 @@ func setupTest(objs ...client.Object) (*StatefulMigrationReconciler, *messaging.
 		Scheme:    scheme,
 		MsgClient: mockBroker,
 		// KubeletClient is nil for most tests; set it explicitly where needed
+		NewBrokerClient: func() messaging.BrokerClient { return messaging.NewMockBrokerClient() },
 	}
 
 	return reconciler, mockBroker, context.Background()
@@ -351,10 +371,10 @@ func TestReconcile_Replaying_QueueDrained(t *testing.T) {
 	foundStart := false
 	foundEnd := false
 	for _, msg := range mockBroker.ControlMessages {
-		if msg.Type == messaging.ControlStartReplay {
+		if msg.Type == protocol.ControlStartReplay {
 			foundStart = true
 		}
-		if msg.Type == messaging.ControlEndReplay {
+		if msg.Type == protocol.ControlEndReplay {
 			foundEnd = true
 		}
 	}
@@ -394,6 +414,9 @@ func TestReconcile_Replaying_QueueNotDrained(t *testing.T) {
 	if result.RequeueAfter == 0 {
 		t.Error("expected RequeueAfter to be set when queue is not drained")
 	}
+	if got.Status.ReplayQueueDepth != 100 {
+		t.Errorf("expected ReplayQueueDepth 100, got %d", got.Status.ReplayQueueDepth)
+	}
 }
 
 func TestReconcile_Finalizing_CompletesWithShadowPod(t *testing.T) {
@@ -434,7 +457,7 @@ func TestReconcile_Finalizing_CompletesWithShadowPod(t *testing.T) {
 	// Verify END_REPLAY was sent
 	found := false
 	for _, msg := range mockBroker.ControlMessages {
-		if msg.Type == messaging.ControlEndReplay {
+		if msg.Type == protocol.ControlEndReplay {
 			found = true
 		}
 	}
@@ -657,7 +680,7 @@ func TestReconcile_Restoring_ShadowPod_PodRunning(t *testing.T) {
 		Status: corev1.PodStatus{Phase: corev1.PodRunning},
 	}
 
-	// Shadow pod already exists and is Running
+	// Shadow pod already exists and is Running and Ready
 	shadowPod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "myapp-0-shadow",
@@ -674,7 +697,8 @@ func TestReconcile_Restoring_ShadowPod_PodRunning(t *testing.T) {
 			},
 		},
 		Status: corev1.PodStatus{
-			Phase: corev1.PodRunning,
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
 		},
 	}
 
@@ -958,7 +982,7 @@ func TestReconcile_Transferring_JobPassesContainerName(t *testing.T) {
 	if args[0] != migration.Status.CheckpointID {
 		t.Errorf("expected args[0] (checkpoint path) %q, got %q", migration.Status.CheckpointID, args[0])
 	}
-	expectedImageRef := fmt.Sprintf("%s/%s:checkpoint", migration.Spec.CheckpointImageRepository, migration.Spec.SourcePod)
+	expectedImageRef := checkpointImageTag(migration)
 	if args[1] != expectedImageRef {
 		t.Errorf("expected args[1] (image ref) %q, got %q", expectedImageRef, args[1])
 	}
@@ -1245,10 +1269,10 @@ func TestReconcile_Restoring_Sequential_ScalesDownStatefulSet(t *testing.T) {
 	}
 }
 
-func TestReconcile_Restoring_Sequential_WaitsForPodRemoval(t *testing.T) {
-	// If the target pod name exists but without migration labels (e.g. still
-	// being managed by StatefulSet controller), handleRestoring should requeue
-	// and wait — not delete the pod ourselves.
+func TestReconcile_Restoring_Sequential_DeletesSourcePod(t *testing.T) {
+	// If the target pod name exists but without migration labels (the
+	// original source pod), handleRestoring deletes it and requeues until
+	// the name is free.
 	existingPod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "myapp-0",
@@ -1282,11 +1306,9 @@ func TestReconcile_Restoring_Sequential_WaitsForPodRemoval(t *testing.T) {
 		t.Error("expected RequeueAfter while waiting for pod removal")
 	}
 
-	// Verify the pod was NOT deleted — we wait for StatefulSet controller
 	pod := &corev1.Pod{}
-	podErr := r.Get(ctx, types.NamespacedName{Name: "myapp-0", Namespace: "default"}, pod)
-	if podErr != nil {
-		t.Error("expected pod to still exist — controller should wait, not delete")
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0", Namespace: "default"}, pod); !errors.IsNotFound(err) {
+		t.Errorf("expected the source pod to be deleted, got %v", err)
 	}
 }
 
@@ -1436,6 +1458,10 @@ func TestReconcile_Pending_CapturesSourcePodInfo(t *testing.T) {
 		t.Errorf("expected container name %q, got %q", "app", got.Status.SourceContainers[0].Name)
 	}
 
+	if got.Status.SourcePodSpec == nil || len(got.Status.SourcePodSpec.Containers) != 1 {
+		t.Errorf("expected the full source pod spec to be captured, got %v", got.Status.SourcePodSpec)
+	}
+
 	// Verify StatefulSet name was captured
 	if got.Status.StatefulSetName != "myapp" {
 		t.Errorf("expected StatefulSetName %q, got %q", "myapp", got.Status.StatefulSetName)
@@ -1484,7 +1510,7 @@ func TestReconcile_Restoring_ShadowPod_CopiesFullContainerSpec(t *testing.T) {
 
 	c := targetPod.Spec.Containers[0]
 	// Image should be the checkpoint image
-	expectedImage := fmt.Sprintf("%s/%s:checkpoint", migration.Spec.CheckpointImageRepository, migration.Spec.SourcePod)
+	expectedImage := checkpointImageTag(migration)
 	if c.Image != expectedImage {
 		t.Errorf("expected checkpoint image %q, got %q", expectedImage, c.Image)
 	}
@@ -1492,9 +1518,122 @@ func TestReconcile_Restoring_ShadowPod_CopiesFullContainerSpec(t *testing.T) {
 	if len(c.Ports) != 1 || c.Ports[0].ContainerPort != 8080 {
 		t.Errorf("expected port 8080, got %v", c.Ports)
 	}
-	// Env should NOT be copied — it's baked into the CRIU checkpoint image
-	if len(c.Env) != 0 {
-		t.Errorf("expected no env vars (baked into checkpoint), got %v", c.Env)
+	// Env is copied so the restored pod matches the source spec
+	if len(c.Env) != 1 || c.Env[0].Name != "DB_HOST" {
+		t.Errorf("expected env DB_HOST to be copied, got %v", c.Env)
+	}
+}
+
+func TestReconcile_Restoring_ShadowPod_CopiesPodSpecFields(t *testing.T) {
+	migration := newMigration("mig-fidelity", migrationv1alpha1.PhaseRestoring)
+	migration.Spec.MigrationStrategy = "ShadowPod"
+	migration.Spec.RestorePodSpec = &migrationv1alpha1.RestorePodSpec{
+		Include: []string{"nodeSelector"},
+		Exclude: []string{"livenessProbe"},
+	}
+	migration.Status.SourceNode = "node-1"
+	migration.Status.ContainerName = "app"
+	migration.Status.PhaseTimings = map[string]string{}
+
+	grace := int64(45)
+	probe := &corev1.Probe{ProbeHandler: corev1.ProbeHandler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt32(8080)}}}
+	sourcePod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-0", Namespace: "default"},
+		Spec: corev1.PodSpec{
+			NodeName:                      "node-1",
+			ServiceAccountName:            "myapp",
+			PriorityClassName:             "critical",
+			TerminationGracePeriodSeconds: &grace,
+			NodeSelector:                  map[string]string{"disk": "ssd"},
+			Affinity:                      &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{}},
+			Tolerations:                   []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}},
+			Volumes: []corev1.Volume{
+				{Name: "data", VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data-myapp-0"}}},
+				{Name: "kube-api-access-abcde", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{}}},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:    "app",
+					Image:   "myapp:latest",
+					Command: []string{"/app"},
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+					},
+					LivenessProbe:  probe,
+					ReadinessProbe: probe,
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "data", MountPath: "/data"},
+						{Name: "kube-api-access-abcde", MountPath: "/var/run/secrets/kubernetes.io/serviceaccount"},
+					},
+				},
+				{Name: "sidecar", Image: "proxy:1.0", Args: []string{"--port=9000"}},
+			},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+
+	r, _, ctx := setupTest(migration, sourcePod)
+
+	if _, err := reconcileOnce(r, ctx, "mig-fidelity", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	targetPod := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0-shadow", Namespace: "default"}, targetPod); err != nil {
+		t.Fatalf("expected shadow pod to be created: %v", err)
+	}
+
+	spec := targetPod.Spec
+	if spec.NodeName != "node-2" {
+		t.Errorf("expected pod pinned to node-2, got %q", spec.NodeName)
+	}
+	if spec.ServiceAccountName != "myapp" || spec.PriorityClassName != "critical" || len(spec.Tolerations) != 1 {
+		t.Errorf("expected service account, priority class and tolerations copied, got %+v", spec)
+	}
+	if spec.TerminationGracePeriodSeconds == nil || *spec.TerminationGracePeriodSeconds != 45 {
+		t.Errorf("expected termination grace period copied, got %v", spec.TerminationGracePeriodSeconds)
+	}
+	if spec.NodeSelector["disk"] != "ssd" {
+		t.Errorf("expected included nodeSelector to be copied, got %v", spec.NodeSelector)
+	}
+	if spec.Affinity != nil {
+		t.Errorf("expected affinity to be left out by default, got %+v", spec.Affinity)
+	}
+	if len(spec.Volumes) != 1 || spec.Volumes[0].Name != "data" {
+		t.Errorf("expected only the data volume (service account token is re-injected), got %v", spec.Volumes)
+	}
+
+	app := spec.Containers[0]
+	if len(app.VolumeMounts) != 1 || app.VolumeMounts[0].MountPath != "/data" {
+		t.Errorf("expected only the /data mount, got %v", app.VolumeMounts)
+	}
+	if app.Resources.Requests.Memory().String() != "256Mi" {
+		t.Errorf("expected memory request copied, got %v", app.Resources.Requests)
+	}
+	if app.ReadinessProbe == nil || app.LivenessProbe != nil {
+		t.Errorf("expected readiness probe copied and excluded liveness probe dropped, got readiness=%v liveness=%v", app.ReadinessProbe, app.LivenessProbe)
+	}
+	if len(app.Command) != 0 {
+		t.Errorf("expected no command on the checkpointed container, got %v", app.Command)
+	}
+
+	sidecar := spec.Containers[1]
+	if sidecar.Image != "proxy:1.0" || len(sidecar.Args) != 1 {
+		t.Errorf("expected sidecar to keep its image and args, got %+v", sidecar)
+	}
+}
+
+func TestReconcile_Pending_RejectsUnknownRestoreField(t *testing.T) {
+	migration := newMigration("mig-restore-bad", migrationv1alpha1.PhasePending)
+	migration.Spec.RestorePodSpec = &migrationv1alpha1.RestorePodSpec{Exclude: []string{"nodeName"}}
+
+	r, _, ctx := setupTest(migration)
+
+	if _, err := reconcileOnce(r, ctx, "mig-restore-bad", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-restore-bad", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Errorf("expected Failed for an unknown restore field, got %q", got.Status.Phase)
 	}
 }
 
@@ -1558,10 +1697,6 @@ func TestReconcile_Checkpointing_CreateQueueFails(t *testing.T) {
 	}
 }
 
-// NOTE: KubeletClient checkpoint paths (KubeletClient != nil) cannot be
-// unit-tested because kubelet.Client is a concrete struct with an unexported
-// restClient field. Those paths require integration tests with a real API server.
-
 // -- handleTransferring: Job running uses pollingBackoff --
 func TestReconcile_Transferring_JobRunning_PollingBackoff(t *testing.T) {
 	migration := newMigration("mig-xfer-poll", migrationv1alpha1.PhaseTransferring)
@@ -2134,6 +2269,7 @@ func TestReconcile_Replaying_DrainMode_ProgressResets(t *testing.T) {
 func TestReconcile_Finalizing_EndReplayFails(t *testing.T) {
 	migration := newMigration("mig-final-endfail", migrationv1alpha1.PhaseFinalizing)
 	migration.Spec.MigrationStrategy = "ShadowPod"
+	migration.Spec.ControlProtocol = &migrationv1alpha1.ControlProtocol{AckMode: "None"}
 	migration.Status.TargetPod = "myapp-0-shadow"
 	migration.Status.SourceNode = "node-1"
 	migration.Status.PhaseTimings = map[string]string{}
@@ -2807,8 +2943,15 @@ func TestReconcile_Restoring_Sequential_STSGetError(t *testing.T) {
 	}, migration, existingPod)
 
 	_, err := reconcileOnce(r, ctx, "mig-restore-stserr", "default")
-	if err == nil {
-		t.Fatal("expected error when StatefulSet Get returns non-NotFound error in Restoring")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A permanent StatefulSet error fails the migration before the source
+	// pod is touched.
+	got := fetchMigration(r, ctx, "mig-restore-stserr", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Errorf("expected phase Failed when the StatefulSet cannot be read, got %q", got.Status.Phase)
 	}
 }
 
@@ -2904,7 +3047,7 @@ func TestReconcile_PhaseChaining_RefetchFails(t *testing.T) {
 	// But since it's a plain error (not a StatusError), IgnoreNotFound returns it
 }
 
-// -- handleRestoring: Sequential STS scale-down patch fails --
+// -- handleRestoring: Sequential ordinal hold patch fails --
 func TestReconcile_Restoring_Sequential_STSPatchFails(t *testing.T) {
 	stsReplicas := int32(1)
 	sts := &appsv1.StatefulSet{
@@ -2961,7 +3104,7 @@ func TestReconcile_Restoring_Sequential_STSPatchFails(t *testing.T) {
 
 	got := fetchMigration(r, ctx, "mig-restore-stspatch", "default")
 	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
-		t.Errorf("expected phase Failed when STS scale-down patch fails, got %q", got.Status.Phase)
+		t.Errorf("expected phase Failed when the ordinal hold patch fails, got %q", got.Status.Phase)
 	}
 }
 
@@ -3048,14 +3191,14 @@ func TestReconcile_Finalizing_Sequential_STSPatchFails(t *testing.T) {
 	mockBroker.Connected = true
 
 	_, err := reconcileOnce(r, ctx, "mig-final-stspatch", "default")
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	if err == nil {
+		t.Fatal("expected the STS patch error to be returned")
 	}
 
 	got := fetchMigration(r, ctx, "mig-final-stspatch", "default")
-	// STS patch error is logged but not fatal
-	if got.Status.Phase != migrationv1alpha1.PhaseCompleted {
-		t.Errorf("expected phase Completed despite STS patch error, got %q", got.Status.Phase)
+	// The ordinal must be released before the migration completes.
+	if got.Status.Phase != migrationv1alpha1.PhaseFinalizing {
+		t.Errorf("expected phase Finalizing until the ordinal is released, got %q", got.Status.Phase)
 	}
 }
 
@@ -3210,8 +3353,8 @@ func TestReconcile_Pending_DetectsDeploymentStrategy(t *testing.T) {
 }
 
 func TestReconcile_Finalizing_ShadowPod_PatchesDeployment(t *testing.T) {
-	// When DeploymentName is set, Finalizing should patch the Deployment
-	// with nodeAffinity targeting the migration's TargetNode.
+	// With deploymentPlacement Required, Finalizing should patch the
+	// Deployment with nodeAffinity targeting the migration's TargetNode.
 	sourcePod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "myapp-0",
@@ -3254,6 +3397,7 @@ func TestReconcile_Finalizing_ShadowPod_PatchesDeployment(t *testing.T) {
 	migration.Spec.MigrationStrategy = "ShadowPod"
 	migration.Status.TargetPod = "myapp-0-shadow"
 	migration.Status.SourceNode = "node-1"
+	migration.Spec.DeploymentPlacement = "Required"
 	migration.Status.DeploymentName = "myapp-deploy"
 	migration.Status.PhaseTimings = map[string]string{}
 
@@ -3446,7 +3590,7 @@ func TestReconcile_Transferring_RegistryMode_Unchanged(t *testing.T) {
 			}
 
 			// Registry mode: second arg should be the OCI image ref, not an HTTP URL
-			expectedImageRef := fmt.Sprintf("%s/%s:checkpoint", migration.Spec.CheckpointImageRepository, migration.Spec.SourcePod)
+			expectedImageRef := checkpointImageTag(migration)
 			if args[1] != expectedImageRef {
 				t.Errorf("expected args[1] (image ref) %q, got %q", expectedImageRef, args[1])
 			}
@@ -3702,11 +3846,9 @@ func TestReconcile_Finalizing_Swap_CreateReplacement(t *testing.T) {
 		t.Errorf("expected label app=consumer, got %v", replacementPod.Labels["app"])
 	}
 
-	// Verify it does NOT have a controller ownerRef (so StatefulSet can adopt it)
-	for _, ref := range replacementPod.OwnerReferences {
-		if ref.Controller != nil && *ref.Controller {
-			t.Errorf("replacement pod should not have controller ownerRef, got %v", ref)
-		}
+	// Verify the migration owns it until the ordinal is released
+	if ref := metav1.GetControllerOf(replacementPod); ref == nil || ref.Kind != "StatefulMigration" {
+		t.Errorf("expected the migration to own the replacement pod, got %v", ref)
 	}
 
 	// Verify it's on the target node
@@ -3762,7 +3904,7 @@ func TestReconcile_Finalizing_Swap_MiniReplay_Drained(t *testing.T) {
 	// MiniReplay should have sent START_REPLAY to replacement pod
 	found := false
 	for _, msg := range mockBroker.ControlMessages {
-		if msg.TargetPod == "consumer-0" && msg.Type == messaging.ControlStartReplay {
+		if msg.TargetPod == "consumer-0" && msg.Type == protocol.ControlStartReplay {
 			found = true
 		}
 	}
@@ -3904,7 +4046,7 @@ func TestReconcile_Finalizing_Swap_TrafficSwitch(t *testing.T) {
 	// END_REPLAY should have been sent to replacement pod
 	found := false
 	for _, msg := range mockBroker.ControlMessages {
-		if msg.TargetPod == "consumer-0" && msg.Type == messaging.ControlEndReplay {
+		if msg.TargetPod == "consumer-0" && msg.Type == protocol.ControlEndReplay {
 			found = true
 		}
 	}
@@ -4172,7 +4314,7 @@ func TestReconcile_ExchangeFence_PreFenceDrain(t *testing.T) {
 	if len(mockBroker.ControlMessages) != 1 {
 		t.Fatalf("expected 1 control message, got %d", len(mockBroker.ControlMessages))
 	}
-	if mockBroker.ControlMessages[0].Type != messaging.ControlStartReplay {
+	if mockBroker.ControlMessages[0].Type != protocol.ControlStartReplay {
 		t.Errorf("expected START_REPLAY, got %q", mockBroker.ControlMessages[0].Type)
 	}
 
@@ -4407,7 +4549,7 @@ func TestReconcile_ExchangeFence_FenceCutover(t *testing.T) {
 	// Should have sent END_REPLAY
 	foundEndReplay := false
 	for _, msg := range mockBroker.ControlMessages {
-		if msg.Type == messaging.ControlEndReplay && msg.TargetPod == "consumer-0" {
+		if msg.Type == protocol.ControlEndReplay && msg.TargetPod == "consumer-0" {
 			foundEndReplay = true
 		}
 	}
@@ -4567,7 +4709,7 @@ func TestReconcile_ExchangeFence_FenceCutover_BufferDrain(t *testing.T) {
 	// Should have sent START_REPLAY for buffer queue
 	foundBufferReplay := false
 	for _, msg := range mockBroker.ControlMessages {
-		if msg.Type == messaging.ControlStartReplay && msg.TargetPod == "consumer-0" {
+		if msg.Type == protocol.ControlStartReplay && msg.TargetPod == "consumer-0" {
 			foundBufferReplay = true
 		}
 	}
@@ -4580,3 +4722,4817 @@ func TestReconcile_ExchangeFence_FenceCutover_BufferDrain(t *testing.T) {
 		t.Error("expected Swap.BufferDrain.start to be set")
 	}
 }
+
+// ---------------------------------------------------------------------------
+// Checkpoint image registry lifecycle tests
+// ---------------------------------------------------------------------------
+
+// fakeRegistry records DeleteImage calls for registry lifecycle tests.
+type fakeRegistry struct {
+	deleted []string
+	err     error
+	pushErr error
+}
+
+func (f *fakeRegistry) DeleteImage(_ context.Context, imageRef string) error {
+	f.deleted = append(f.deleted, imageRef)
+	return f.err
+}
+
+func (f *fakeRegistry) CheckPushAccess(_ context.Context, _ string) error {
+	return f.pushErr
+}
+
+func TestCheckpointImageTag_UniquePerMigration(t *testing.T) {
+	a := newMigration("mig-a", migrationv1alpha1.PhaseTransferring)
+	a.UID = "uid-a"
+	b := newMigration("mig-b", migrationv1alpha1.PhaseTransferring)
+	b.UID = "uid-b"
+
+	if checkpointImageTag(a) == checkpointImageTag(b) {
+		t.Fatalf("expected distinct tags for different migrations, both got %q", checkpointImageTag(a))
+	}
+	want := "registry.example.com/checkpoints/myapp-0:checkpoint-uid-a"
+	if got := checkpointImageTag(a); got != want {
+		t.Errorf("expected tag %q, got %q", want, got)
+	}
+
+	// Without a UID (e.g. fake clients), the migration name keeps the tag unique.
+	a.UID = ""
+	if got := checkpointImageTag(a); got != "registry.example.com/checkpoints/myapp-0:checkpoint-mig-a" {
+		t.Errorf("expected name-based tag, got %q", got)
+	}
+}
+
+func TestReconcile_Transferring_JobComplete_PinsDigest(t *testing.T) {
+	migration := newMigration("mig-digest", migrationv1alpha1.PhaseTransferring)
+	migration.Status.SourceNode = "node-1"
+	migration.Status.CheckpointID = "/var/lib/kubelet/checkpoints/checkpoint-myapp-0.tar"
+	migration.Status.ContainerName = "app"
+	migration.Status.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "regcred"}}
+	migration.Status.PhaseTimings = map[string]string{}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "mig-digest-transfer", Namespace: "default"},
+		Status:     batchv1.JobStatus{Succeeded: 1},
+	}
+	digest := "sha256:" + fmt.Sprintf("%064d", 7)
+	jobPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mig-digest-transfer-abcde",
+			Namespace: "default",
+			Labels:    map[string]string{"job-name": "mig-digest-transfer"},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodSucceeded,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name: "checkpoint-transfer",
+				State: corev1.ContainerState{
+					Terminated: &corev1.ContainerStateTerminated{ExitCode: 0, Message: digest + "\n"},
+				},
+			}},
+		},
+	}
+	sourcePod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-0", Namespace: "default"},
+		Spec: corev1.PodSpec{
+			NodeName:   "node-1",
+			Containers: []corev1.Container{{Name: "app", Image: "myapp:latest"}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+
+	r, _, ctx := setupTest(migration, job, jobPod, sourcePod)
+
+	if _, err := reconcileOnce(r, ctx, "mig-digest", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-digest", "default")
+	want := "registry.example.com/checkpoints/myapp-0@" + digest
+	if got.Status.CheckpointImage != want {
+		t.Errorf("expected pinned CheckpointImage %q, got %q", want, got.Status.CheckpointImage)
+	}
+
+	// Phase chaining created the shadow pod; it must use the pinned image.
+	shadow := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0-shadow", Namespace: "default"}, shadow); err != nil {
+		t.Fatalf("expected shadow pod: %v", err)
+	}
+	c := shadow.Spec.Containers[0]
+	if c.Image != want {
+		t.Errorf("expected shadow pod image %q, got %q", want, c.Image)
+	}
+	if c.ImagePullPolicy != corev1.PullIfNotPresent {
+		t.Errorf("expected IfNotPresent for digest-pinned image, got %q", c.ImagePullPolicy)
+	}
+	if len(shadow.Spec.ImagePullSecrets) != 1 || shadow.Spec.ImagePullSecrets[0].Name != "regcred" {
+		t.Errorf("expected imagePullSecrets [regcred], got %v", shadow.Spec.ImagePullSecrets)
+	}
+}
+
+func TestReconcile_Transferring_JobComplete_NoDigestFallsBackToTag(t *testing.T) {
+	migration := newMigration("mig-nodigest", migrationv1alpha1.PhaseTransferring)
+	migration.Status.SourceNode = "node-1"
+	migration.Status.ContainerName = "app"
+	migration.Status.PhaseTimings = map[string]string{}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "mig-nodigest-transfer", Namespace: "default"},
+		Status:     batchv1.JobStatus{Succeeded: 1},
+	}
+	sourcePod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-0", Namespace: "default"},
+		Spec: corev1.PodSpec{
+			NodeName:   "node-1",
+			Containers: []corev1.Container{{Name: "app", Image: "myapp:latest"}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+
+	r, _, ctx := setupTest(migration, job, sourcePod)
+
+	if _, err := reconcileOnce(r, ctx, "mig-nodigest", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-nodigest", "default")
+	if got.Status.CheckpointImage != checkpointImageTag(migration) {
+		t.Errorf("expected tag fallback %q, got %q", checkpointImageTag(migration), got.Status.CheckpointImage)
+	}
+
+	shadow := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0-shadow", Namespace: "default"}, shadow); err != nil {
+		t.Fatalf("expected shadow pod: %v", err)
+	}
+	if shadow.Spec.Containers[0].ImagePullPolicy != corev1.PullAlways {
+		t.Errorf("expected Always for tag reference, got %q", shadow.Spec.Containers[0].ImagePullPolicy)
+	}
+}
+
+func TestReconcile_Pending_InheritsSourcePullSecrets(t *testing.T) {
+	sourcePod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-0", Namespace: "default"},
+		Spec: corev1.PodSpec{
+			NodeName:         "node-1",
+			Containers:       []corev1.Container{{Name: "app", Image: "myapp:latest"}},
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "source-secret"}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+
+	t.Run("from source pod", func(t *testing.T) {
+		migration := newMigration("mig-ps-src", migrationv1alpha1.PhasePending)
+		migration.Spec.MigrationStrategy = "ShadowPod"
+		r, _, ctx := setupTest(migration, sourcePod.DeepCopy())
+
+		if _, err := reconcileOnce(r, ctx, "mig-ps-src", "default"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got := fetchMigration(r, ctx, "mig-ps-src", "default")
+		if len(got.Status.ImagePullSecrets) != 1 || got.Status.ImagePullSecrets[0].Name != "source-secret" {
+			t.Errorf("expected source pod pull secrets, got %v", got.Status.ImagePullSecrets)
+		}
+	})
+
+	t.Run("spec overrides source", func(t *testing.T) {
+		migration := newMigration("mig-ps-spec", migrationv1alpha1.PhasePending)
+		migration.Spec.MigrationStrategy = "ShadowPod"
+		migration.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "spec-secret"}}
+		r, _, ctx := setupTest(migration, sourcePod.DeepCopy())
+
+		if _, err := reconcileOnce(r, ctx, "mig-ps-spec", "default"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got := fetchMigration(r, ctx, "mig-ps-spec", "default")
+		if len(got.Status.ImagePullSecrets) != 1 || got.Status.ImagePullSecrets[0].Name != "spec-secret" {
+			t.Errorf("expected spec pull secrets, got %v", got.Status.ImagePullSecrets)
+		}
+	})
+}
+
+func TestReconcile_Finalizing_CheckpointImageRetention(t *testing.T) {
+	image := "registry.example.com/checkpoints/myapp-0@sha256:" + fmt.Sprintf("%064d", 1)
+
+	for _, tc := range []struct {
+		retention   string
+		wantDeleted bool
+	}{
+		{"", false},
+		{"Retain", false},
+		{"Delete", true},
+	} {
+		name := tc.retention
+		if name == "" {
+			name = "default"
+		}
+		t.Run(name, func(t *testing.T) {
+			migration := newMigration("mig-retain", migrationv1alpha1.PhaseFinalizing)
+			migration.Spec.MigrationStrategy = "Sequential"
+			migration.Spec.CheckpointImageRetention = tc.retention
+			migration.Status.TargetPod = "myapp-0"
+			migration.Status.CheckpointImage = image
+			migration.Status.PhaseTimings = map[string]string{}
+
+			r, _, ctx := setupTest(migration)
+			registry := &fakeRegistry{}
+			r.Registry = registry
+
+			if _, err := reconcileOnce(r, ctx, "mig-retain", "default"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tc.wantDeleted {
+				if len(registry.deleted) != 1 || registry.deleted[0] != image {
+					t.Errorf("expected %q to be deleted, got %v", image, registry.deleted)
+				}
+			} else if len(registry.deleted) != 0 {
+				t.Errorf("expected no deletion, got %v", registry.deleted)
+			}
+		})
+	}
+}
+
+func TestReconcile_Finalizing_ImageDeleteErrorDoesNotFail(t *testing.T) {
+	migration := newMigration("mig-del-err", migrationv1alpha1.PhaseFinalizing)
+	migration.Spec.MigrationStrategy = "Sequential"
+	migration.Spec.CheckpointImageRetention = "Delete"
+	migration.Status.TargetPod = "myapp-0"
+	migration.Status.CheckpointImage = "registry.example.com/checkpoints/myapp-0:checkpoint-mig-del-err"
+	migration.Status.PhaseTimings = map[string]string{}
+
+	r, _, ctx := setupTest(migration)
+	r.Registry = &fakeRegistry{err: fmt.Errorf("UNSUPPORTED: deletion disabled")}
+
+	if _, err := reconcileOnce(r, ctx, "mig-del-err", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-del-err", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseCompleted {
+		t.Errorf("expected phase %q despite delete error, got %q", migrationv1alpha1.PhaseCompleted, got.Status.Phase)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Transfer Job configuration tests
+// ---------------------------------------------------------------------------
+
+func TestReconcile_Transferring_JobUsesBuiltinDefaults(t *testing.T) {
+	migration := newMigration("mig-jobdef", migrationv1alpha1.PhaseTransferring)
+	migration.Status.SourceNode = "node-1"
+	migration.Status.PhaseTimings = map[string]string{}
+
+	r, _, ctx := setupTest(migration)
+
+	if _, err := reconcileOnce(r, ctx, "mig-jobdef", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	job := &batchv1.Job{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "mig-jobdef-transfer", Namespace: "default"}, job); err != nil {
+		t.Fatalf("expected transfer job: %v", err)
+	}
+	c := job.Spec.Template.Spec.Containers[0]
+	if c.Image != "localhost/checkpoint-transfer:latest" {
+		t.Errorf("expected default image, got %q", c.Image)
+	}
+	if c.ImagePullPolicy != corev1.PullIfNotPresent {
+		t.Errorf("expected IfNotPresent, got %q", c.ImagePullPolicy)
+	}
+	if len(c.Env) != 1 || c.Env[0].Name != "INSECURE_REGISTRY" {
+		t.Errorf("expected INSECURE_REGISTRY env by default, got %v", c.Env)
+	}
+	if c.SecurityContext == nil || c.SecurityContext.RunAsUser == nil || *c.SecurityContext.RunAsUser != 0 {
+		t.Errorf("expected default root security context, got %+v", c.SecurityContext)
+	}
+	if hp := job.Spec.Template.Spec.Volumes[0].HostPath; hp == nil || hp.Path != "/var/lib/kubelet/checkpoints" {
+		t.Errorf("expected default checkpoint hostPath, got %+v", hp)
+	}
+}
+
+func TestReconcile_Transferring_JobConfigAndOverride(t *testing.T) {
+	migration := newMigration("mig-jobcfg", migrationv1alpha1.PhaseTransferring)
+	migration.Status.SourceNode = "node-1"
+	migration.Status.PhaseTimings = map[string]string{}
+	secure := false
+	deadline := int64(300)
+	migration.Spec.TransferJob = &migrationv1alpha1.TransferJobSpec{
+		Image:                 "registry.example.com/ms2m/checkpoint-transfer:v2",
+		InsecureRegistry:      &secure,
+		ActiveDeadlineSeconds: &deadline,
+	}
+
+	r, _, ctx := setupTest(migration)
+	backoff := int32(2)
+	r.TransferJob = migrationv1alpha1.TransferJobSpec{
+		Image:              "registry.example.com/ms2m/checkpoint-transfer:v1",
+		ImagePullPolicy:    corev1.PullAlways,
+		ImagePullSecrets:   []corev1.LocalObjectReference{{Name: "ms2m-pull"}},
+		ServiceAccountName: "ms2m-transfer",
+		PriorityClassName:  "system-node-critical",
+		CheckpointHostPath: "/data/checkpoints",
+		BackoffLimit:       &backoff,
+		Resources: &corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+		},
+		Tolerations: []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}},
+	}
+
+	if _, err := reconcileOnce(r, ctx, "mig-jobcfg", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	job := &batchv1.Job{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "mig-jobcfg-transfer", Namespace: "default"}, job); err != nil {
+		t.Fatalf("expected transfer job: %v", err)
+	}
+	podSpec := job.Spec.Template.Spec
+	c := podSpec.Containers[0]
+
+	// Per-migration override wins over the controller config.
+	if c.Image != "registry.example.com/ms2m/checkpoint-transfer:v2" {
+		t.Errorf("expected migration override image, got %q", c.Image)
+	}
+	if len(c.Env) != 0 {
+		t.Errorf("expected no INSECURE_REGISTRY env for secure registry, got %v", c.Env)
+	}
+	if job.Spec.ActiveDeadlineSeconds == nil || *job.Spec.ActiveDeadlineSeconds != 300 {
+		t.Errorf("expected activeDeadlineSeconds 300, got %v", job.Spec.ActiveDeadlineSeconds)
+	}
+
+	// Controller config fills the remaining fields.
+	if c.ImagePullPolicy != corev1.PullAlways {
+		t.Errorf("expected PullAlways from controller config, got %q", c.ImagePullPolicy)
+	}
+	if len(podSpec.ImagePullSecrets) != 1 || podSpec.ImagePullSecrets[0].Name != "ms2m-pull" {
+		t.Errorf("expected pull secret ms2m-pull, got %v", podSpec.ImagePullSecrets)
+	}
+	if podSpec.ServiceAccountName != "ms2m-transfer" || podSpec.PriorityClassName != "system-node-critical" {
+		t.Errorf("expected service account and priority class from config, got %q/%q",
+			podSpec.ServiceAccountName, podSpec.PriorityClassName)
+	}
+	if len(podSpec.Tolerations) != 1 || podSpec.Tolerations[0].Key != "dedicated" {
+		t.Errorf("expected toleration from config, got %v", podSpec.Tolerations)
+	}
+	if job.Spec.BackoffLimit == nil || *job.Spec.BackoffLimit != 2 {
+		t.Errorf("expected backoffLimit 2, got %v", job.Spec.BackoffLimit)
+	}
+	if mem := c.Resources.Limits[corev1.ResourceMemory]; mem.String() != "512Mi" {
+		t.Errorf("expected 512Mi memory limit, got %s", mem.String())
+	}
+	if hp := podSpec.Volumes[0].HostPath; hp == nil || hp.Path != "/data/checkpoints" {
+		t.Errorf("expected configured checkpoint hostPath, got %+v", hp)
+	}
+}
+
+func TestReconcile_Transferring_AgentPushUsesInsecureRegistry(t *testing.T) {
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", fmt.Sprint(checkpoint.AgentPort)))
+	if err != nil {
+		t.Skipf("agent port %d unavailable: %v", checkpoint.AgentPort, err)
+	}
+	var pushed map[string]interface{}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/registry-push" {
+			_ = json.NewDecoder(req.Body).Decode(&pushed)
+		}
+		fmt.Fprint(w, `{}`)
+	}))
+	srv.Listener.Close()
+	srv.Listener = ln
+	srv.Start()
+	defer srv.Close()
+
+	migration := newMigration("mig-agentpush", migrationv1alpha1.PhaseTransferring)
+	migration.Status.SourceNode = "node-1"
+	migration.Status.PhaseTimings = map[string]string{}
+	agent := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "ms2m-agent-node-1", Namespace: "ms2m-system", Labels: map[string]string{"app": "ms2m-agent"}},
+		Spec:       corev1.PodSpec{NodeName: "node-1"},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "127.0.0.1"},
+	}
+	r, _, ctx := setupTest(migration, agent)
+	secure := false
+	r.TransferJob = migrationv1alpha1.TransferJobSpec{InsecureRegistry: &secure}
+
+	if _, err := reconcileOnce(r, ctx, "mig-agentpush", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pushed == nil {
+		t.Fatal("expected a registry-push call to the agent")
+	}
+	if pushed["insecure"] != false {
+		t.Errorf("expected the agent push to honour --insecure-registry=false, got insecure=%v", pushed["insecure"])
+	}
+}
+
+func TestReconcile_Transferring_JobFailed_FailsMigration(t *testing.T) {
+	migration := newMigration("mig-jobfail", migrationv1alpha1.PhaseTransferring)
+	migration.Status.SourceNode = "node-1"
+	migration.Status.PhaseTimings = map[string]string{"Transferring.start": time.Now().Format(time.RFC3339)}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "mig-jobfail-transfer", Namespace: "default"},
+		Status: batchv1.JobStatus{
+			Failed: 7,
+			Conditions: []batchv1.JobCondition{{
+				Type:    batchv1.JobFailed,
+				Status:  corev1.ConditionTrue,
+				Reason:  "BackoffLimitExceeded",
+				Message: "Job has reached the specified backoff limit",
+			}},
+		},
+	}
+
+	r, _, ctx := setupTest(migration, job)
+
+	if _, err := reconcileOnce(r, ctx, "mig-jobfail", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-jobfail", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Fatalf("expected phase %q, got %q", migrationv1alpha1.PhaseFailed, got.Status.Phase)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, "Failed")
+	if cond == nil || !strings.Contains(cond.Message, "BackoffLimitExceeded") {
+		t.Errorf("expected failure condition to mention the Job reason, got %+v", cond)
+	}
+}
+
+func TestReconcile_Transferring_JobPodFailedButRetrying(t *testing.T) {
+	// A failed pod without the Job Failed condition is still within the
+	// backoff limit; keep waiting.
+	migration := newMigration("mig-jobretry", migrationv1alpha1.PhaseTransferring)
+	migration.Status.SourceNode = "node-1"
+	migration.Status.PhaseTimings = map[string]string{"Transferring.start": time.Now().Format(time.RFC3339)}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "mig-jobretry-transfer", Namespace: "default"},
+		Status:     batchv1.JobStatus{Failed: 1},
+	}
+
+	r, _, ctx := setupTest(migration, job)
+
+	result, err := reconcileOnce(r, ctx, "mig-jobretry", "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Error("expected RequeueAfter while the Job retries")
+	}
+	if got := fetchMigration(r, ctx, "mig-jobretry", "default"); got.Status.Phase != migrationv1alpha1.PhaseTransferring {
+		t.Errorf("expected phase to remain Transferring, got %q", got.Status.Phase)
+	}
+}
+
+func TestLoadTransferJobConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transfer-job.yaml")
+	data := []byte(`image: registry.example.com/ms2m/checkpoint-transfer:v1
+imagePullPolicy: Always
+insecureRegistry: false
+tolerations:
+- key: dedicated
+  operator: Exists
+`)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadTransferJobConfig(path)
+	if err != nil {
+		t.Fatalf("LoadTransferJobConfig failed: %v", err)
+	}
+	if cfg.Image != "registry.example.com/ms2m/checkpoint-transfer:v1" || cfg.ImagePullPolicy != corev1.PullAlways {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if cfg.InsecureRegistry == nil || *cfg.InsecureRegistry {
+		t.Errorf("expected insecureRegistry false, got %v", cfg.InsecureRegistry)
+	}
+	if len(cfg.Tolerations) != 1 || cfg.Tolerations[0].Key != "dedicated" {
+		t.Errorf("expected one toleration, got %v", cfg.Tolerations)
+	}
+
+	if err := os.WriteFile(path, []byte("imagee: typo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTransferJobConfig(path); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Dry-run plan tests
+// ---------------------------------------------------------------------------
+
+// planFixtures returns a StatefulSet-owned source pod on node-1 requesting
+// 500m CPU / 256Mi, its StatefulSet, and a Ready target node-2.
+func planFixtures(targetCPU string) (*corev1.Pod, *appsv1.StatefulSet, *corev1.Node) {
+	replicas := int32(3)
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp", Namespace: "default"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+	}
+	isController := true
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-0",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "StatefulSet", Name: "myapp", UID: "sts-uid", Controller: &isController,
+			}},
+		},
+		Spec: corev1.PodSpec{
+			NodeName: "node-1",
+			Containers: []corev1.Container{{
+				Name:  "app",
+				Image: "myapp:latest",
+				Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("500m"),
+					corev1.ResourceMemory: resource.MustParse("256Mi"),
+				}},
+			}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-2"},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(targetCPU),
+				corev1.ResourceMemory: resource.MustParse("4Gi"),
+			},
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+		},
+	}
+	return pod, sts, node
+}
+
+func planCheckStatus(plan *migrationv1alpha1.MigrationPlan, name string) string {
+	for _, c := range plan.Checks {
+		if c.Name == name {
+			return c.Status
+		}
+	}
+	return ""
+}
+
+func TestReconcile_DryRun_FeasiblePlan(t *testing.T) {
+	migration := newMigration("mig-plan", migrationv1alpha1.PhasePending)
+	migration.Spec.DryRun = true
+	sourcePod, sts, node := planFixtures("2")
+	agent := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "ms2m-agent-abc", Namespace: "ms2m-system", Labels: map[string]string{"app": "ms2m-agent"}},
+		Spec:       corev1.PodSpec{NodeName: "node-1"},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "10.0.0.5"},
+	}
+
+	r, mockBroker, ctx := setupTest(migration, sourcePod, sts, node, agent)
+	r.Registry = &fakeRegistry{}
+	// Running migrations share mockBroker's connection; the dry run must
+	// connect a client of its own.
+	mockBroker.Connected = true
+	planBroker := messaging.NewMockBrokerClient()
+	r.NewBrokerClient = func() messaging.BrokerClient { return planBroker }
+
+	result, err := reconcileOnce(r, ctx, "mig-plan", "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Requeue || result.RequeueAfter > 0 {
+		t.Errorf("expected no requeue after planning, got %+v", result)
+	}
+
+	got := fetchMigration(r, ctx, "mig-plan", "default")
+	if got.Status.Phase != migrationv1alpha1.PhasePlanned {
+		t.Fatalf("expected phase %q, got %q", migrationv1alpha1.PhasePlanned, got.Status.Phase)
+	}
+	plan := got.Status.Plan
+	if plan == nil {
+		t.Fatal("expected status.plan to be set")
+	}
+	if !plan.Feasible {
+		t.Errorf("expected feasible plan, got checks %+v", plan.Checks)
+	}
+	if plan.Strategy != "Sequential" || plan.Owner != "StatefulSet/myapp" {
+		t.Errorf("expected Sequential strategy for StatefulSet/myapp, got %q / %q", plan.Strategy, plan.Owner)
+	}
+	if plan.TransferPath != "AgentRegistryPush" {
+		t.Errorf("expected AgentRegistryPush transfer path, got %q", plan.TransferPath)
+	}
+	if plan.IdentitySwapPath != "OrdinalRelease" || plan.PredictedDowntime != "Full" {
+		t.Errorf("expected OrdinalRelease / Full, got %q / %q", plan.IdentitySwapPath, plan.PredictedDowntime)
+	}
+	for _, name := range []string{"Spec", "SourcePod", "Ownership", "TargetNode", "Agents", "Broker", "Registry"} {
+		if s := planCheckStatus(plan, name); s != "Passed" {
+			t.Errorf("expected check %s Passed, got %q", name, s)
+		}
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, "Planned")
+	if cond == nil || cond.Status != metav1.ConditionTrue {
+		t.Errorf("expected Planned=True condition, got %+v", cond)
+	}
+
+	// Nothing was changed: no checkpoint, no strategy written back, no
+	// leftover probe queue, StatefulSet untouched.
+	if got.Status.CheckpointID != "" {
+		t.Errorf("expected no checkpoint, got %q", got.Status.CheckpointID)
+	}
+	if got.Spec.MigrationStrategy != "" {
+		t.Errorf("expected spec.migrationStrategy to stay empty, got %q", got.Spec.MigrationStrategy)
+	}
+	if _, ok := planBroker.Queues["orders.ms2m-plan"]; ok {
+		t.Error("expected broker probe queue to be deleted")
+	}
+	if planBroker.Connected {
+		t.Error("expected the dry run's broker connection to be closed")
+	}
+	if !mockBroker.Connected {
+		t.Error("expected the shared broker connection to stay open")
+	}
+	gotSts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp", Namespace: "default"}, gotSts); err != nil {
+		t.Fatal(err)
+	}
+	if *gotSts.Spec.Replicas != 3 {
+		t.Errorf("expected StatefulSet replicas unchanged at 3, got %d", *gotSts.Spec.Replicas)
+	}
+
+	// Planned is terminal.
+	if _, err := reconcileOnce(r, ctx, "mig-plan", "default"); err != nil {
+		t.Fatalf("unexpected error on second reconcile: %v", err)
+	}
+	if again := fetchMigration(r, ctx, "mig-plan", "default"); again.Status.Phase != migrationv1alpha1.PhasePlanned {
+		t.Errorf("expected phase to stay Planned, got %q", again.Status.Phase)
+	}
+}
+
+func TestReconcile_DryRun_InfeasiblePlan(t *testing.T) {
+	migration := newMigration("mig-plan-bad", migrationv1alpha1.PhasePending)
+	migration.Spec.DryRun = true
+	migration.Spec.MigrationStrategy = "ShadowPod"
+	migration.Spec.IdentitySwapMode = "Cutoff"
+	sourcePod, sts, node := planFixtures("1")
+	// An existing pod on the target already uses 800m of its 1 CPU.
+	busy := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "busy", Namespace: "other"},
+		Spec: corev1.PodSpec{
+			NodeName: "node-2",
+			Containers: []corev1.Container{{
+				Name: "busy",
+				Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+					corev1.ResourceCPU: resource.MustParse("800m"),
+				}},
+			}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+
+	r, _, ctx := setupTest(migration, sourcePod, sts, node, busy)
+	r.Registry = &fakeRegistry{pushErr: fmt.Errorf("UNAUTHORIZED")}
+	planBroker := messaging.NewMockBrokerClient()
+	planBroker.CreateQueueErr = fmt.Errorf("ACCESS_REFUSED")
+	r.NewBrokerClient = func() messaging.BrokerClient { return planBroker }
+
+	if _, err := reconcileOnce(r, ctx, "mig-plan-bad", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-plan-bad", "default")
+	if got.Status.Phase != migrationv1alpha1.PhasePlanned {
+		t.Fatalf("expected phase %q, got %q", migrationv1alpha1.PhasePlanned, got.Status.Phase)
+	}
+	plan := got.Status.Plan
+	if plan.Feasible {
+		t.Error("expected infeasible plan")
+	}
+	want := map[string]string{
+		"SourcePod":  "Passed",
+		"Ownership":  "Passed",
+		"TargetNode": "Failed",
+		"Agents":     "Warning",
+		"Broker":     "Failed",
+		"Registry":   "Failed",
+	}
+	for name, status := range want {
+		if s := planCheckStatus(plan, name); s != status {
+			t.Errorf("expected check %s %s, got %q", name, status, s)
+		}
+	}
+	if plan.TransferPath != "RegistryJob" {
+		t.Errorf("expected RegistryJob without a source agent, got %q", plan.TransferPath)
+	}
+	if plan.IdentitySwapPath != "Cutoff" || plan.PredictedDowntime != "Brief" {
+		t.Errorf("expected Cutoff / Brief, got %q / %q", plan.IdentitySwapPath, plan.PredictedDowntime)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, "Planned")
+	if cond == nil || cond.Status != metav1.ConditionFalse || !strings.Contains(cond.Message, "TargetNode") {
+		t.Errorf("expected Planned=False naming TargetNode, got %+v", cond)
+	}
+}
+
+func TestReconcile_DryRun_InvalidSpec(t *testing.T) {
+	migration := newMigration("mig-plan-spec", migrationv1alpha1.PhasePending)
+	migration.Spec.DryRun = true
+	migration.Spec.MigrationStrategy = "Teleport"
+	sourcePod, sts, node := planFixtures("2")
+
+	r, _, ctx := setupTest(migration, sourcePod, sts, node)
+
+	if _, err := reconcileOnce(r, ctx, "mig-plan-spec", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Pending would fail this migration; the plan reports why.
+	got := fetchMigration(r, ctx, "mig-plan-spec", "default")
+	if got.Status.Phase != migrationv1alpha1.PhasePlanned {
+		t.Fatalf("expected phase %q rather than Failed, got %q", migrationv1alpha1.PhasePlanned, got.Status.Phase)
+	}
+	if got.Status.Plan.Feasible || planCheckStatus(got.Status.Plan, "Spec") != "Failed" {
+		t.Errorf("expected failed Spec check, got %+v", got.Status.Plan.Checks)
+	}
+}
+
+func TestReconcile_DryRun_SourcePodMissing(t *testing.T) {
+	migration := newMigration("mig-plan-nopod", migrationv1alpha1.PhasePending)
+	migration.Spec.DryRun = true
+	_, _, node := planFixtures("2")
+
+	r, _, ctx := setupTest(migration, node)
+
+	if _, err := reconcileOnce(r, ctx, "mig-plan-nopod", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-plan-nopod", "default")
+	if got.Status.Phase != migrationv1alpha1.PhasePlanned {
+		t.Fatalf("expected phase %q rather than Failed, got %q", migrationv1alpha1.PhasePlanned, got.Status.Phase)
+	}
+	if got.Status.Plan.Feasible || planCheckStatus(got.Status.Plan, "SourcePod") != "Failed" {
+		t.Errorf("expected failed SourcePod check, got %+v", got.Status.Plan.Checks)
+	}
+	if s := planCheckStatus(got.Status.Plan, "Registry"); s != "Skipped" {
+		t.Errorf("expected Registry check Skipped without a registry client, got %q", s)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Abort tests
+// ---------------------------------------------------------------------------
+
+func abortStatefulSet(replicas int32) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "consumer", Namespace: "default"},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "consumer"}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "consumer"}},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "consumer:latest"}}},
+			},
+		},
+	}
+}
+
+func TestReconcile_Abort_Pending(t *testing.T) {
+	migration := newMigration("mig-abort", migrationv1alpha1.PhasePending)
+	migration.Spec.Abort = true
+
+	r, mockBroker, ctx := setupTest(migration)
+
+	result, err := reconcileOnce(r, ctx, "mig-abort", "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Requeue || result.RequeueAfter > 0 {
+		t.Errorf("expected no requeue after abort, got %+v", result)
+	}
+
+	got := fetchMigration(r, ctx, "mig-abort", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseAborted {
+		t.Fatalf("expected phase %q, got %q", migrationv1alpha1.PhaseAborted, got.Status.Phase)
+	}
+	if len(got.Status.UndoneSteps) != 0 {
+		t.Errorf("expected nothing to undo, got %v", got.Status.UndoneSteps)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, "Aborted")
+	if cond == nil || cond.Status != metav1.ConditionTrue || !strings.Contains(cond.Message, "Pending") {
+		t.Errorf("expected Aborted=True condition mentioning Pending, got %+v", cond)
+	}
+	if len(mockBroker.Queues) != 0 {
+		t.Errorf("expected no broker queues, got %v", mockBroker.Queues)
+	}
+}
+
+func TestReconcile_Abort_Replaying_ShadowPod(t *testing.T) {
+	migration := newMigration("mig-abort", migrationv1alpha1.PhaseReplaying)
+	migration.Spec.MigrationStrategy = "ShadowPod"
+	migration.Spec.Abort = true
+	migration.Status.SourceNode = "node-1"
+	migration.Status.TargetPod = "myapp-0-shadow"
+	migration.Status.PhaseTimings = map[string]string{
+		"Replaying.start": time.Now().Format(time.RFC3339),
+	}
+
+	sourcePod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-0", Namespace: "default"},
+		Spec:       corev1.PodSpec{NodeName: "node-1"},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	shadowPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-0-shadow",
+			Namespace: "default",
+			Labels:    map[string]string{"migration.ms2m.io/migration": "mig-abort"},
+		},
+		Spec:   corev1.PodSpec{NodeName: "node-2"},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "mig-abort-transfer", Namespace: "default"}}
+
+	r, mockBroker, ctx := setupTest(migration, sourcePod, shadowPod, job)
+	mockBroker.SetQueueDepth("orders.ms2m-replay", 7)
+
+	if _, err := reconcileOnce(r, ctx, "mig-abort", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-abort", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseAborted {
+		t.Fatalf("expected phase %q, got %q", migrationv1alpha1.PhaseAborted, got.Status.Phase)
+	}
+	want := []string{
+		"deleted Job mig-abort-transfer",
+		"stopped replay on pod myapp-0-shadow",
+		"deleted replay queue orders.ms2m-replay",
+		"deleted target pod myapp-0-shadow",
+	}
+	if strings.Join(got.Status.UndoneSteps, "|") != strings.Join(want, "|") {
+		t.Errorf("unexpected undone steps:\n got %v\nwant %v", got.Status.UndoneSteps, want)
+	}
+
+	if len(mockBroker.ControlMessages) != 1 || mockBroker.ControlMessages[0].Type != protocol.ControlEndReplay {
+		t.Errorf("expected a single END_REPLAY, got %+v", mockBroker.ControlMessages)
+	}
+	if _, ok := mockBroker.Queues["orders.ms2m-replay"]; ok {
+		t.Error("expected replay queue to be deleted")
+	}
+	if mockBroker.Connected {
+		t.Error("expected broker connection to be closed")
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0-shadow", Namespace: "default"}, &corev1.Pod{}); !errors.IsNotFound(err) {
+		t.Error("expected shadow pod to be deleted")
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0", Namespace: "default"}, &corev1.Pod{}); err != nil {
+		t.Errorf("expected source pod to be left running: %v", err)
+	}
+}
+
+func TestReconcile_Abort_Sequential_RestoresReplicas(t *testing.T) {
+	migration := newMigration("mig-abort", migrationv1alpha1.PhaseRestoring)
+	migration.Spec.MigrationStrategy = "Sequential"
+	migration.Spec.Abort = true
+	migration.Status.StatefulSetName = "consumer"
+	migration.Status.OriginalReplicas = 2
+
+	targetPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-0",
+			Namespace: "default",
+			Labels:    map[string]string{"migration.ms2m.io/migration": "mig-abort"},
+		},
+		Spec: corev1.PodSpec{NodeName: "node-2"},
+	}
+
+	r, _, ctx := setupTest(migration, targetPod, abortStatefulSet(0))
+
+	if _, err := reconcileOnce(r, ctx, "mig-abort", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-abort", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseAborted {
+		t.Fatalf("expected phase %q, got %q", migrationv1alpha1.PhaseAborted, got.Status.Phase)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0", Namespace: "default"}, &corev1.Pod{}); !errors.IsNotFound(err) {
+		t.Error("expected restored target pod to be deleted")
+	}
+	sts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "consumer", Namespace: "default"}, sts); err != nil {
+		t.Fatal(err)
+	}
+	if *sts.Spec.Replicas != 2 {
+		t.Errorf("expected StatefulSet scaled back to 2 replicas, got %d", *sts.Spec.Replicas)
+	}
+	if last := got.Status.UndoneSteps[len(got.Status.UndoneSteps)-1]; last != "released the ordinal of myapp-0 in StatefulSet consumer" {
+		t.Errorf("expected the ordinal release to be recorded last, got %v", got.Status.UndoneSteps)
+	}
+}
+
+func TestReconcile_Abort_Sequential_LeavesOriginalPod(t *testing.T) {
+	migration := newMigration("mig-abort", migrationv1alpha1.PhaseRestoring)
+	migration.Spec.MigrationStrategy = "Sequential"
+	migration.Spec.Abort = true
+	migration.Status.StatefulSetName = "consumer"
+	migration.Status.OriginalReplicas = 1
+
+	// The original StatefulSet pod has not been removed yet.
+	sourcePod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-0", Namespace: "default"},
+		Spec:       corev1.PodSpec{NodeName: "node-1"},
+	}
+
+	r, _, ctx := setupTest(migration, sourcePod, abortStatefulSet(0))
+
+	if _, err := reconcileOnce(r, ctx, "mig-abort", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0", Namespace: "default"}, &corev1.Pod{}); err != nil {
+		t.Errorf("expected the original pod to be left alone: %v", err)
+	}
+}
+
+func TestReconcile_Abort_Sequential_StandaloneDeferred(t *testing.T) {
+	migration := newMigration("mig-abort", migrationv1alpha1.PhaseRestoring)
+	migration.Spec.MigrationStrategy = "Sequential"
+	migration.Spec.Abort = true
+
+	// The standalone source is gone; the restored target is the only copy.
+	targetPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-0",
+			Namespace: "default",
+			Labels:    map[string]string{"migration.ms2m.io/migration": "mig-abort"},
+		},
+		Spec:   corev1.PodSpec{NodeName: "node-2"},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+
+	r, _, ctx := setupTest(migration, targetPod)
+
+	if _, err := reconcileOnce(r, ctx, "mig-abort", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-abort", "default")
+	if got.Status.Phase == migrationv1alpha1.PhaseAborted {
+		t.Fatal("expected the abort to be deferred")
+	}
+	if cond := meta.FindStatusCondition(got.Status.Conditions, "AbortDeferred"); cond == nil || cond.Status != metav1.ConditionTrue {
+		t.Errorf("expected AbortDeferred condition, got %+v", cond)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0", Namespace: "default"}, &corev1.Pod{}); err != nil {
+		t.Errorf("expected the target pod to survive: %v", err)
+	}
+}
+
+func TestReconcile_Abort_Swap_MiniReplay(t *testing.T) {
+	migration := newMigration("mig-abort", migrationv1alpha1.PhaseFinalizing)
+	migration.Spec.SourcePod = "consumer-0"
+	migration.Spec.MigrationStrategy = "ShadowPod"
+	migration.Spec.IdentitySwapMode = "Cutoff"
+	migration.Spec.Abort = true
+	migration.Status.TargetPod = "consumer-0-shadow"
+	migration.Status.SourceNode = "node-1"
+	migration.Status.StatefulSetName = "consumer"
+	migration.Status.OriginalReplicas = 1
+	migration.Status.SwapSubPhase = "MiniReplay"
+	migration.Status.ReplacementPod = "consumer-0"
+	migration.Status.PhaseTimings = map[string]string{
+		"Finalizing.start":      time.Now().Format(time.RFC3339),
+		"Swap.MiniReplay.start": time.Now().Format(time.RFC3339),
+	}
+
+	shadowPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "consumer-0-shadow", Namespace: "default"},
+		Spec:       corev1.PodSpec{NodeName: "node-2"},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	replacementPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "consumer-0", Namespace: "default", Labels: map[string]string{"app": "consumer"}},
+		Spec:       corev1.PodSpec{NodeName: "node-2"},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+
+	r, mockBroker, ctx := setupTest(migration, shadowPod, replacementPod, abortStatefulSet(1))
+	mockBroker.SetQueueDepth("orders.ms2m-replay", 3)
+
+	if _, err := reconcileOnce(r, ctx, "mig-abort", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-abort", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseAborted {
+		t.Fatalf("expected phase %q, got %q", migrationv1alpha1.PhaseAborted, got.Status.Phase)
+	}
+	if got.Status.SwapSubPhase != "" {
+		t.Errorf("expected SwapSubPhase cleared, got %q", got.Status.SwapSubPhase)
+	}
+	want := []string{
+		"stopped replay on pod consumer-0",
+		"deleted replay queue orders.ms2m-replay",
+		"held the ordinal of consumer-0 in StatefulSet consumer",
+		"deleted replacement pod consumer-0",
+	}
+	if strings.Join(got.Status.UndoneSteps, "|") != strings.Join(want, "|") {
+		t.Errorf("unexpected undone steps:\n got %v\nwant %v", got.Status.UndoneSteps, want)
+	}
+
+	if err := r.Get(ctx, types.NamespacedName{Name: "consumer-0", Namespace: "default"}, &corev1.Pod{}); !errors.IsNotFound(err) {
+		t.Error("expected replacement pod to be deleted")
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "consumer-0-shadow", Namespace: "default"}, &corev1.Pod{}); err != nil {
+		t.Errorf("expected shadow pod to keep serving: %v", err)
+	}
+	sts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "consumer", Namespace: "default"}, sts); err != nil {
+		t.Fatal(err)
+	}
+	if *sts.Spec.Replicas != 0 {
+		t.Errorf("expected StatefulSet held at 0 replicas, got %d", *sts.Spec.Replicas)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, "Aborted")
+	if cond == nil || !strings.Contains(cond.Message, "Finalizing/MiniReplay") || !strings.Contains(cond.Message, "keeps serving") {
+		t.Errorf("expected Aborted condition describing the swap, got %+v", cond)
+	}
+}
+
+func TestReconcile_Abort_DeferredDuringTrafficSwitch(t *testing.T) {
+	migration := newMigration("mig-abort", migrationv1alpha1.PhaseFinalizing)
+	migration.Spec.SourcePod = "consumer-0"
+	migration.Spec.MigrationStrategy = "ShadowPod"
+	migration.Spec.IdentitySwapMode = "Cutoff"
+	migration.Spec.Abort = true
+	migration.Status.TargetPod = "consumer-0-shadow"
+	migration.Status.SourceNode = "node-1"
+	migration.Status.StatefulSetName = "consumer"
+	migration.Status.OriginalReplicas = 1
+	migration.Status.SwapSubPhase = "TrafficSwitch"
+	migration.Status.ReplacementPod = "consumer-0"
+	migration.Status.PhaseTimings = map[string]string{
+		"Finalizing.start": time.Now().Format(time.RFC3339),
+	}
+
+	r, mockBroker, ctx := setupTest(migration, abortStatefulSet(0))
+	mockBroker.Connected = true
+
+	if _, err := reconcileOnce(r, ctx, "mig-abort", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-abort", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseCompleted {
+		t.Fatalf("expected the swap to run to completion, got phase %q", got.Status.Phase)
+	}
+	if len(got.Status.UndoneSteps) != 0 {
+		t.Errorf("expected nothing undone, got %v", got.Status.UndoneSteps)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, "AbortDeferred")
+	if cond == nil || cond.Status != metav1.ConditionTrue || !strings.Contains(cond.Message, "TrafficSwitch") {
+		t.Errorf("expected AbortDeferred condition naming TrafficSwitch, got %+v", cond)
+	}
+}
+
+func TestReconcile_Abort_IgnoredWhenTerminal(t *testing.T) {
+	migration := newMigration("mig-abort", migrationv1alpha1.PhaseCompleted)
+	migration.Spec.Abort = true
+
+	r, _, ctx := setupTest(migration)
+
+	if _, err := reconcileOnce(r, ctx, "mig-abort", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-abort", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseCompleted {
+		t.Errorf("expected Completed to stay, got %q", got.Status.Phase)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Timeout tests
+// ---------------------------------------------------------------------------
+
+func TestReconcile_Timeouts_StampsPhaseStart(t *testing.T) {
+	migration := newMigration("mig-deadline", migrationv1alpha1.PhaseRestoring)
+	migration.Spec.MigrationStrategy = "ShadowPod"
+	migration.Spec.Timeouts = &migrationv1alpha1.MigrationTimeouts{RestoringSeconds: 60}
+	targetPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-0-shadow",
+			Namespace: "default",
+			Labels:    map[string]string{"migration.ms2m.io/migration": "mig-deadline"},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodPending},
+	}
+
+	r, _, ctx := setupTest(migration, targetPod)
+
+	if _, err := reconcileOnce(r, ctx, "mig-deadline", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-deadline", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseRestoring {
+		t.Fatalf("expected to keep waiting in Restoring, got %q", got.Status.Phase)
+	}
+	if _, ok := got.Status.PhaseTimings["Deadline.Restoring"]; !ok {
+		t.Errorf("expected Deadline.Restoring to be recorded, got %v", got.Status.PhaseTimings)
+	}
+}
+
+func TestReconcile_Timeouts_RestoringDeadlineFails(t *testing.T) {
+	migration := newMigration("mig-deadline", migrationv1alpha1.PhaseRestoring)
+	migration.Spec.MigrationStrategy = "ShadowPod"
+	migration.Spec.Timeouts = &migrationv1alpha1.MigrationTimeouts{RestoringSeconds: 60}
+	migration.Status.PhaseTimings = map[string]string{
+		"Deadline.Restoring": time.Now().Add(-2 * time.Minute).Format(time.RFC3339),
+	}
+	targetPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-0-shadow",
+			Namespace: "default",
+			Labels:    map[string]string{"migration.ms2m.io/migration": "mig-deadline"},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodPending},
+	}
+
+	r, mockBroker, ctx := setupTest(migration, targetPod)
+	mockBroker.SetQueueDepth("orders.ms2m-replay", 0)
+
+	if _, err := reconcileOnce(r, ctx, "mig-deadline", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-deadline", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Fatalf("expected phase %q, got %q", migrationv1alpha1.PhaseFailed, got.Status.Phase)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, "Failed")
+	if cond == nil || cond.Reason != "DeadlineExceeded" || !strings.HasPrefix(cond.Message, "Restoring phase deadline of 1m0s exceeded") {
+		t.Errorf("unexpected Failed condition: %+v", cond)
+	}
+
+	// A failed migration is cleaned up like an aborted one.
+	if _, ok := mockBroker.Queues["orders.ms2m-replay"]; ok {
+		t.Error("expected the replay queue to be deleted")
+	}
+	err := r.Get(ctx, types.NamespacedName{Name: "myapp-0-shadow", Namespace: "default"}, &corev1.Pod{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("expected the target pod to be deleted, got %v", err)
+	}
+}
+
+func TestReconcile_Timeouts_MigrationDeadlineAborts(t *testing.T) {
+	start := metav1.NewTime(time.Now().Add(-10 * time.Minute))
+	migration := newMigration("mig-deadline", migrationv1alpha1.PhaseTransferring)
+	migration.Spec.MigrationStrategy = "ShadowPod"
+	migration.Spec.Timeouts = &migrationv1alpha1.MigrationTimeouts{MigrationSeconds: 300, OnExpiry: "Abort"}
+	migration.Status.StartTime = &start
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "mig-deadline-transfer", Namespace: "default"}}
+
+	r, mockBroker, ctx := setupTest(migration, job)
+	mockBroker.SetQueueDepth("orders.ms2m-replay", 0)
+
+	if _, err := reconcileOnce(r, ctx, "mig-deadline", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-deadline", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseAborted {
+		t.Fatalf("expected phase %q, got %q", migrationv1alpha1.PhaseAborted, got.Status.Phase)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, "Aborted")
+	if cond == nil || cond.Reason != "DeadlineExceeded" || !strings.HasPrefix(cond.Message, "migration deadline of 5m0s exceeded") {
+		t.Errorf("unexpected Aborted condition: %+v", cond)
+	}
+	if _, ok := mockBroker.Queues["orders.ms2m-replay"]; ok {
+		t.Error("expected replay queue to be deleted by the rollback")
+	}
+}
+
+func TestReconcile_Timeouts_SwapSubPhaseDeadline(t *testing.T) {
+	migration := newMigration("mig-deadline", migrationv1alpha1.PhaseFinalizing)
+	migration.Spec.SourcePod = "consumer-0"
+	migration.Spec.MigrationStrategy = "ShadowPod"
+	migration.Spec.IdentitySwapMode = "Cutoff"
+	// An unsafe sub-phase: OnExpiry=Abort cannot roll back and fails instead.
+	migration.Spec.Timeouts = &migrationv1alpha1.MigrationTimeouts{
+		SwapSubPhaseSeconds: map[string]int32{"TrafficSwitch": 10},
+		OnExpiry:            "Abort",
+	}
+	migration.Status.TargetPod = "consumer-0-shadow"
+	migration.Status.StatefulSetName = "consumer"
+	migration.Status.SwapSubPhase = "TrafficSwitch"
+	migration.Status.ReplacementPod = "consumer-0"
+	migration.Status.PhaseTimings = map[string]string{
+		"Finalizing.start":            time.Now().Add(-time.Minute).Format(time.RFC3339),
+		"Deadline.Swap.TrafficSwitch": time.Now().Add(-time.Minute).Format(time.RFC3339),
+	}
+
+	r, mockBroker, ctx := setupTest(migration)
+	mockBroker.Connected = true
+
+	if _, err := reconcileOnce(r, ctx, "mig-deadline", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-deadline", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Fatalf("expected phase %q, got %q", migrationv1alpha1.PhaseFailed, got.Status.Phase)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, "Failed")
+	if cond == nil || cond.Message != "TrafficSwitch swap sub-phase deadline of 10s exceeded" {
+		t.Errorf("unexpected Failed condition: %+v", cond)
+	}
+}
+
+func TestReconcile_Timeouts_InvalidSpecFailsInPending(t *testing.T) {
+	for name, timeouts := range map[string]*migrationv1alpha1.MigrationTimeouts{
+		"onExpiry": {OnExpiry: "Retry"},
+		"subPhase": {SwapSubPhaseSeconds: map[string]int32{"Replaying": 10}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			migration := newMigration("mig-deadline", migrationv1alpha1.PhasePending)
+			migration.Spec.Timeouts = timeouts
+
+			r, _, ctx := setupTest(migration)
+			if _, err := reconcileOnce(r, ctx, "mig-deadline", "default"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := fetchMigration(r, ctx, "mig-deadline", "default")
+			if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+				t.Errorf("expected phase %q, got %q", migrationv1alpha1.PhaseFailed, got.Status.Phase)
+			}
+		})
+	}
+}
+
+func TestReconcile_Timeouts_TunableMiniReplayCutoff(t *testing.T) {
+	migration := newMigration("mig-cutoff", migrationv1alpha1.PhaseFinalizing)
+	migration.Spec.SourcePod = "consumer-0"
+	migration.Spec.MigrationStrategy = "ShadowPod"
+	migration.Spec.IdentitySwapMode = "Cutoff"
+	migration.Spec.Timeouts = &migrationv1alpha1.MigrationTimeouts{MiniReplayCutoffSeconds: 2}
+	migration.Status.TargetPod = "consumer-0-shadow"
+	migration.Status.StatefulSetName = "consumer"
+	migration.Status.SwapSubPhase = "MiniReplay"
+	migration.Status.ReplacementPod = "consumer-0"
+	migration.Status.PhaseTimings = map[string]string{
+		// Past the 2s override, well within the 15s default.
+		"Swap.MiniReplay.start": time.Now().Add(-5 * time.Second).Format(time.RFC3339),
+	}
+
+	r, mockBroker, ctx := setupTest(migration)
+	mockBroker.Connected = true
+	mockBroker.SetQueueDepth("orders.ms2m-replay", 5)
+
+	if _, err := reconcileOnce(r, ctx, "mig-cutoff", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-cutoff", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseCompleted {
+		t.Errorf("expected the shortened cutoff to move on to completion, got %q / %q", got.Status.Phase, got.Status.SwapSubPhase)
+	}
+}
+
+func TestReconcile_Timeouts_TunableParallelDrainMax(t *testing.T) {
+	migration := newExchangeFenceMigration("mig-ef-tuned")
+	migration.Spec.Timeouts = &migrationv1alpha1.MigrationTimeouts{
+		ExchangeFence: &migrationv1alpha1.ExchangeFenceTuning{ParallelDrainMaxSeconds: 10},
+	}
+	migration.Status.SwapSubPhase = "ParallelDrain"
+	migration.Status.ReplacementPod = "consumer-0"
+	// 20s is within the 120s default but past the 10s override.
+	migration.Status.PhaseTimings["Swap.Fence.time"] = time.Now().Add(-20 * time.Second).Format(time.RFC3339)
+	migration.Status.PhaseTimings["Swap.ParallelDrain.lastDepth"] = "5,3"
+	migration.Status.PhaseTimings["Swap.ParallelDrain.lastCheck"] = time.Now().Format(time.RFC3339)
+
+	r, mockBroker, ctx := setupTest(migration)
+	mockBroker.Connected = true
+	mockBroker.Queues["orders"] = 5
+	mockBroker.Queues["orders.ms2m-replay"] = 3
+	mockBroker.Queues["orders.ms2m-fence-buffer"] = 0
+
+	if _, err := reconcileOnce(r, ctx, "mig-ef-tuned", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-ef-tuned", "default")
+	if got.Status.SwapSubPhase != "MiniReplay" {
+		t.Errorf("expected rollback to MiniReplay after the tuned max, got %q", got.Status.SwapSubPhase)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Retry tests
+// ---------------------------------------------------------------------------
+
+func TestReconcile_Retry_TransientErrorRetried(t *testing.T) {
+	migration := newMigration("mig-retry", migrationv1alpha1.PhaseCheckpointing)
+	migration.Status.SourceNode = "node-1"
+	migration.Status.ContainerName = "app"
+	migration.Status.PhaseTimings = map[string]string{}
+
+	r, mockBroker, ctx := setupTest(migration)
+	mockBroker.ConnectErr = retry.MarkTransient(fmt.Errorf("connection reset by peer"))
+
+	result, err := reconcileOnce(r, ctx, "mig-retry", "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.RequeueAfter != time.Second {
+		t.Errorf("expected the initial 1s backoff, got %s", result.RequeueAfter)
+	}
+	got := fetchMigration(r, ctx, "mig-retry", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseCheckpointing {
+		t.Fatalf("expected to stay in Checkpointing, got %q", got.Status.Phase)
+	}
+	if got.Status.RetryAttempts["broker connect"] != 1 {
+		t.Errorf("expected 1 recorded attempt, got %v", got.Status.RetryAttempts)
+	}
+	if !strings.Contains(got.Status.LastRetryError, "connection reset by peer") {
+		t.Errorf("expected last retry error to be recorded, got %q", got.Status.LastRetryError)
+	}
+
+	// The broker recovers and the next attempt goes through.
+	mockBroker.ConnectErr = nil
+	if _, err := reconcileOnce(r, ctx, "mig-retry", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got = fetchMigration(r, ctx, "mig-retry", "default")
+	if got.Status.Phase == migrationv1alpha1.PhaseCheckpointing || got.Status.Phase == migrationv1alpha1.PhaseFailed {
+		t.Errorf("expected checkpointing to complete after the retry, got %q", got.Status.Phase)
+	}
+}
+
+func TestReconcile_Retry_GivesUpAfterMaxAttempts(t *testing.T) {
+	migration := newMigration("mig-retry-max", migrationv1alpha1.PhaseReplaying)
+	migration.Spec.RetryPolicy = &migrationv1alpha1.RetryPolicy{MaxAttempts: 2}
+	migration.Status.TargetPod = "myapp-0-shadow"
+	migration.Status.PhaseTimings = map[string]string{
+		"Replaying.start": time.Now().Format(time.RFC3339),
+	}
+	migration.Status.RetryAttempts = map[string]int32{"get queue depth": 1}
+
+	r, mockBroker, ctx := setupTest(migration)
+	mockBroker.Connected = true
+	mockBroker.DepthErr = retry.MarkTransient(fmt.Errorf("channel closed"))
+
+	if _, err := reconcileOnce(r, ctx, "mig-retry-max", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-retry-max", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Fatalf("expected Failed once attempts are used up, got %q", got.Status.Phase)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, "Failed")
+	if cond == nil || !strings.Contains(cond.Message, "gave up after 2 attempts") {
+		t.Errorf("expected the attempt count in the failure message, got %+v", cond)
+	}
+}
+
+func TestReconcile_Retry_CountClearedAfterSuccess(t *testing.T) {
+	migration := newMigration("mig-retry-reset", migrationv1alpha1.PhaseReplaying)
+	migration.Spec.RetryPolicy = &migrationv1alpha1.RetryPolicy{MaxAttempts: 2}
+	migration.Status.TargetPod = "myapp-0-shadow"
+	migration.Status.PhaseTimings = map[string]string{
+		"Replaying.start": time.Now().Format(time.RFC3339),
+	}
+	migration.Status.RetryAttempts = map[string]int32{"get queue depth": 1}
+
+	r, mockBroker, ctx := setupTest(migration)
+	mockBroker.Connected = true
+	mockBroker.SetQueueDepth(migration.Spec.MessageQueueConfig.QueueName+".ms2m-replay", 10)
+
+	if _, err := reconcileOnce(r, ctx, "mig-retry-reset", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-retry-reset", "default")
+	if _, ok := got.Status.RetryAttempts["get queue depth"]; ok {
+		t.Fatalf("expected the attempt count to be cleared after a successful poll, got %v", got.Status.RetryAttempts)
+	}
+
+	// A later, unrelated blip starts counting from the beginning again.
+	mockBroker.DepthErr = retry.MarkTransient(fmt.Errorf("connection reset by peer"))
+	if _, err := reconcileOnce(r, ctx, "mig-retry-reset", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got = fetchMigration(r, ctx, "mig-retry-reset", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseReplaying || got.Status.RetryAttempts["get queue depth"] != 1 {
+		t.Errorf("expected one fresh attempt in Replaying, got %q / %v", got.Status.Phase, got.Status.RetryAttempts)
+	}
+}
+
+func TestReconcile_Retry_ReconnectsClosedBroker(t *testing.T) {
+	migration := newMigration("mig-retry-closed", migrationv1alpha1.PhaseReplaying)
+	migration.Status.TargetPod = "myapp-0-shadow"
+	migration.Status.PhaseTimings = map[string]string{
+		"Replaying.start": time.Now().Format(time.RFC3339),
+	}
+
+	// The broker closed the channel under the shared client.
+	r, mockBroker, ctx := setupTest(migration)
+	mockBroker.DepthErr = fmt.Errorf("inspect queue: %w", messaging.ErrNotConnected)
+
+	result, err := reconcileOnce(r, ctx, "mig-retry-closed", "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Error("expected a retry with backoff")
+	}
+	if !mockBroker.Connected {
+		t.Error("expected the broker client to reconnect before the retry")
+	}
+	if got := fetchMigration(r, ctx, "mig-retry-closed", "default"); got.Status.RetryAttempts["get queue depth"] != 1 {
+		t.Errorf("expected one recorded attempt, got %v", got.Status.RetryAttempts)
+	}
+}
+
+func TestReconcile_Retry_PermanentErrorFailsFast(t *testing.T) {
+	migration := newMigration("mig-retry-perm", migrationv1alpha1.PhaseCheckpointing)
+	migration.Status.SourceNode = "node-1"
+	migration.Status.ContainerName = "app"
+	migration.Status.PhaseTimings = map[string]string{}
+
+	r, mockBroker, ctx := setupTest(migration)
+	mockBroker.CreateQueueErr = retry.MarkPermanent(fmt.Errorf("ACCESS_REFUSED - access to exchange denied"))
+
+	if _, err := reconcileOnce(r, ctx, "mig-retry-perm", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-retry-perm", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Errorf("expected Failed on a permanent error, got %q", got.Status.Phase)
+	}
+	if len(got.Status.RetryAttempts) != 0 {
+		t.Errorf("expected no retries for a permanent error, got %v", got.Status.RetryAttempts)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Volume tests
+// ---------------------------------------------------------------------------
+
+// volumeFixtures returns a running source pod mounting claim "data-myapp-0",
+// the claim (ReadWriteOnce) and its volume. With local set, the volume is a
+// local PV on node-1; otherwise it is a CSI block volume.
+func volumeFixtures(local bool) (*corev1.Pod, *corev1.PersistentVolumeClaim, *corev1.PersistentVolume) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-0", Namespace: "default"},
+		Spec: corev1.PodSpec{
+			NodeName:   "node-1",
+			Containers: []corev1.Container{{Name: "app", Image: "myapp:latest"}},
+			Volumes: []corev1.Volume{{
+				Name:         "data",
+				VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data-myapp-0"}},
+			}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data-myapp-0", Namespace: "default"},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			VolumeName:  "pv-data",
+		},
+	}
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv-data"},
+		Spec: corev1.PersistentVolumeSpec{
+			AccessModes:                   []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Capacity:                      corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+			StorageClassName:              "fast",
+			PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimDelete,
+			ClaimRef:                      &corev1.ObjectReference{Namespace: "default", Name: "data-myapp-0"},
+		},
+	}
+	if local {
+		pv.Spec.Local = &corev1.LocalVolumeSource{Path: "/mnt/disks/data"}
+	} else {
+		pv.Spec.CSI = &corev1.CSIPersistentVolumeSource{Driver: "ebs.csi.aws.com", VolumeHandle: "vol-123"}
+	}
+	return pod, pvc, pv
+}
+
+// sequentialVolumeMigration returns a Sequential migration in Restoring whose
+// source pod is already gone, with the data volume recorded in status.
+func sequentialVolumeMigration(name, handling string) *migrationv1alpha1.StatefulMigration {
+	m := newMigration(name, migrationv1alpha1.PhaseRestoring)
+	m.Spec.MigrationStrategy = "Sequential"
+	m.Status.SourceNode = "node-1"
+	m.Status.ContainerName = "app"
+	m.Status.PhaseTimings = map[string]string{}
+	m.Status.Volumes = []migrationv1alpha1.VolumeStatus{{
+		Name:             "data",
+		ClaimName:        "data-myapp-0",
+		PersistentVolume: "pv-data",
+		Handling:         handling,
+	}}
+	return m
+}
+
+func TestReconcile_Volumes_ShadowPodRefusedForRWO(t *testing.T) {
+	migration := newMigration("mig-vol-shadow", migrationv1alpha1.PhasePending)
+	migration.Spec.MigrationStrategy = "ShadowPod"
+	pod, pvc, pv := volumeFixtures(false)
+
+	r, _, ctx := setupTest(migration, pod, pvc, pv)
+
+	if _, err := reconcileOnce(r, ctx, "mig-vol-shadow", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-vol-shadow", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Fatalf("expected ShadowPod with a ReadWriteOnce claim to fail, got %q", got.Status.Phase)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, "Failed")
+	if cond == nil || !strings.Contains(cond.Message, "Sequential") {
+		t.Errorf("expected the failure to point at the Sequential strategy, got %+v", cond)
+	}
+}
+
+func TestReconcile_Volumes_PendingClassifiesVolumes(t *testing.T) {
+	migration := newMigration("mig-vol-classify", migrationv1alpha1.PhasePending)
+	migration.Spec.MigrationStrategy = "Sequential"
+	pod, pvc, pv := volumeFixtures(true)
+
+	r, _, ctx := setupTest(migration, pod, pvc, pv)
+
+	if _, err := reconcileOnce(r, ctx, "mig-vol-classify", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-vol-classify", "default")
+	if len(got.Status.Volumes) != 1 {
+		t.Fatalf("expected 1 volume in status, got %v", got.Status.Volumes)
+	}
+	v := got.Status.Volumes[0]
+	if v.Handling != "Local" || v.Path != "/mnt/disks/data" || v.PersistentVolume != "pv-data" {
+		t.Errorf("expected a Local volume at /mnt/disks/data, got %+v", v)
+	}
+}
+
+func TestReconcile_Volumes_WaitsForDetach(t *testing.T) {
+	migration := sequentialVolumeMigration("mig-vol-detach", "Attachable")
+	pvName := "pv-data"
+	attachment := &storagev1.VolumeAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "csi-abc"},
+		Spec: storagev1.VolumeAttachmentSpec{
+			Attacher: "ebs.csi.aws.com",
+			NodeName: "node-1",
+			Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pvName},
+		},
+	}
+
+	r, _, ctx := setupTest(migration, attachment)
+
+	if _, err := reconcileOnce(r, ctx, "mig-vol-detach", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-vol-detach", "default")
+	if got.Status.VolumeSubPhase != "DetachVolumes" {
+		t.Errorf("expected to wait in DetachVolumes, got %q", got.Status.VolumeSubPhase)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0", Namespace: "default"}, &corev1.Pod{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected no target pod while the volume is attached to the source node, got %v", err)
+	}
+
+	// The attach/detach controller releases the volume.
+	if err := r.Delete(ctx, attachment); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reconcileOnce(r, ctx, "mig-vol-detach", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got = fetchMigration(r, ctx, "mig-vol-detach", "default")
+	if got.Status.VolumeSubPhase != "VolumesReady" || got.Status.Volumes[0].State != "Detached" {
+		t.Errorf("expected volume Detached and VolumesReady, got %q / %+v", got.Status.VolumeSubPhase, got.Status.Volumes[0])
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0", Namespace: "default"}, &corev1.Pod{}); err != nil {
+		t.Errorf("expected target pod once the volume is detached: %v", err)
+	}
+}
+
+func TestReconcile_Volumes_RebindsLocalVolume(t *testing.T) {
+	migration := sequentialVolumeMigration("mig-vol-rebind", "Local")
+	migration.Status.Volumes[0].Path = "/mnt/disks/data"
+	migration.Status.Volumes[0].State = "Copied"
+	migration.Status.VolumeSubPhase = "RebindVolumes"
+	_, pvc, pv := volumeFixtures(true)
+	pvc.Labels = map[string]string{"app": "myapp"}
+	pvc.Annotations = map[string]string{
+		"backup.example.com/schedule":        "daily",
+		"volume.kubernetes.io/selected-node": "node-1",
+	}
+	pvc.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "myapp", UID: "sts-uid"}}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2", Labels: map[string]string{corev1.LabelHostname: "worker-2"}}}
+
+	r, _, ctx := setupTest(migration, pvc, pv, node)
+
+	// First pass deletes the old claim, the second recreates it.
+	for i := 0; i < 2; i++ {
+		if _, err := reconcileOnce(r, ctx, "mig-vol-rebind", "default"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	got := fetchMigration(r, ctx, "mig-vol-rebind", "default")
+	if got.Status.VolumeSubPhase != "VolumesReady" || got.Status.Volumes[0].State != "Rebound" {
+		t.Fatalf("expected volume Rebound and VolumesReady, got %q / %+v", got.Status.VolumeSubPhase, got.Status.Volumes[0])
+	}
+
+	source := &corev1.PersistentVolume{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "pv-data"}, source); err != nil {
+		t.Fatal(err)
+	}
+	if source.Spec.PersistentVolumeReclaimPolicy != corev1.PersistentVolumeReclaimRetain {
+		t.Errorf("expected source volume to be retained, got %q", source.Spec.PersistentVolumeReclaimPolicy)
+	}
+
+	target := &corev1.PersistentVolume{}
+	if err := r.Get(ctx, types.NamespacedName{Name: got.Status.Volumes[0].TargetVolume}, target); err != nil {
+		t.Fatalf("expected target volume %q: %v", got.Status.Volumes[0].TargetVolume, err)
+	}
+	terms := target.Spec.NodeAffinity.Required.NodeSelectorTerms
+	if len(terms) != 1 || terms[0].MatchExpressions[0].Values[0] != "worker-2" {
+		t.Errorf("expected target volume pinned to hostname worker-2, got %+v", target.Spec.NodeAffinity)
+	}
+	if target.Spec.Local == nil || target.Spec.Local.Path != "/mnt/disks/data" {
+		t.Errorf("expected target volume at the same local path, got %+v", target.Spec.Local)
+	}
+
+	claim := &corev1.PersistentVolumeClaim{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "data-myapp-0", Namespace: "default"}, claim); err != nil {
+		t.Fatalf("expected claim to be recreated: %v", err)
+	}
+	if claim.Spec.VolumeName != target.Name {
+		t.Errorf("expected claim bound to %q, got %q", target.Name, claim.Spec.VolumeName)
+	}
+	if claim.Labels["app"] != "myapp" || claim.Annotations["backup.example.com/schedule"] != "daily" {
+		t.Errorf("expected the claim's labels and annotations to be kept, got %v / %v", claim.Labels, claim.Annotations)
+	}
+	if _, ok := claim.Annotations["volume.kubernetes.io/selected-node"]; ok {
+		t.Error("expected the source node's binding annotation to be dropped")
+	}
+	if len(claim.OwnerReferences) != 1 || claim.OwnerReferences[0].Name != "myapp" {
+		t.Errorf("expected the claim's owner to be kept, got %v", claim.OwnerReferences)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0", Namespace: "default"}, &corev1.Pod{}); err != nil {
+		t.Errorf("expected target pod once volumes are ready: %v", err)
+	}
+}
+
+func TestReconcile_Volumes_CopyRequiresAgentToken(t *testing.T) {
+	migration := sequentialVolumeMigration("mig-vol-token", "Local")
+	migration.Status.Volumes[0].Path = "/mnt/disks/data"
+	migration.Status.VolumeSubPhase = "CopyVolumes"
+
+	r, _, ctx := setupTest(migration)
+
+	if _, err := reconcileOnce(r, ctx, "mig-vol-token", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-vol-token", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Fatalf("expected the copy to fail without the agent token Secret, got %q", got.Status.Phase)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, "Failed")
+	if cond == nil || !strings.Contains(cond.Message, "ms2m-agent-token") {
+		t.Errorf("expected the failure to name the agent token Secret, got %+v", cond)
+	}
+}
+
+func TestReconcile_Volumes_AbortDeferredWhileRebinding(t *testing.T) {
+	migration := sequentialVolumeMigration("mig-vol-abort", "Local")
+	// A StatefulSet recreates the source, so only the rebind blocks abort.
+	migration.Status.StatefulSetName = "myapp"
+	migration.Status.VolumeSubPhase = "RebindVolumes"
+	if abortSafe(migration) {
+		t.Error("expected abort to be unsafe while claims are being rebound")
+	}
+	migration.Status.VolumeSubPhase = "CopyVolumes"
+	if !abortSafe(migration) {
+		t.Error("expected abort to be safe while copying volumes")
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Source fence tests
+// ---------------------------------------------------------------------------
+
+// sourceFenceMigration returns a ShadowPod migration in Replaying whose
+// source fence relies on the primary queue's consumer count (no acks).
+func sourceFenceMigration(name string) *migrationv1alpha1.StatefulMigration {
+	migration := newMigration(name, migrationv1alpha1.PhaseReplaying)
+	migration.Spec.MigrationStrategy = "ShadowPod"
+	migration.Spec.ControlProtocol = &migrationv1alpha1.ControlProtocol{AckMode: "None"}
+	migration.Status.SourceNode = "node-1"
+	migration.Status.TargetPod = "myapp-0-shadow"
+	migration.Status.PhaseTimings = map[string]string{
+		"Replaying.start": time.Now().Format(time.RFC3339),
+	}
+	checkpointed := metav1.NewTime(time.Now().Add(-20 * time.Second))
+	migration.Status.SourceFence = &migrationv1alpha1.SourceFenceStatus{CheckpointedAt: &checkpointed}
+	return migration
+}
+
+func TestReconcile_SourceFence_WaitsForStopConsuming(t *testing.T) {
+	migration := sourceFenceMigration("mig-fence")
+	sourcePod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-0", Namespace: "default"},
+		Spec:       corev1.PodSpec{NodeName: "node-1"},
+	}
+
+	r, mockBroker, ctx := setupTest(migration, sourcePod)
+	mockBroker.Connected = true
+	mockBroker.SetQueueConsumers("orders", 1)
+	mockBroker.SetQueueDepth("orders", 4)
+
+	result, err := reconcileOnce(r, ctx, "mig-fence", "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Error("expected a requeue while the source is still consuming")
+	}
+
+	got := fetchMigration(r, ctx, "mig-fence", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseReplaying {
+		t.Fatalf("expected phase %q, got %q", migrationv1alpha1.PhaseReplaying, got.Status.Phase)
+	}
+	if got.Status.SourceFence.RequestedAt == nil || got.Status.SourceFence.FencedAt != nil {
+		t.Errorf("expected fence requested but not confirmed, got %+v", got.Status.SourceFence)
+	}
+	var stop *messaging.MockControlMessage
+	for i, msg := range mockBroker.ControlMessages {
+		if msg.Type == protocol.ControlStopConsuming {
+			stop = &mockBroker.ControlMessages[i]
+		}
+	}
+	if stop == nil || stop.TargetPod != "myapp-0" || stop.Payload["queue"] != "orders" {
+		t.Fatalf("expected STOP_CONSUMING for myapp-0 on orders, got %+v", mockBroker.ControlMessages)
+	}
+
+	// The source cancels its consumer: the fence completes and the
+	// migration runs on through Finalizing.
+	mockBroker.SetQueueConsumers("orders", 0)
+	if _, err := reconcileOnce(r, ctx, "mig-fence", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got = fetchMigration(r, ctx, "mig-fence", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseCompleted {
+		t.Fatalf("expected phase %q, got %q", migrationv1alpha1.PhaseCompleted, got.Status.Phase)
+	}
+	fence := got.Status.SourceFence
+	if fence.Method != fenceStopConsuming || fence.FencedAt == nil {
+		t.Errorf("expected StopConsuming fence, got %+v", fence)
+	}
+	if fence.PrimaryQueueDepthAtFence != 4 {
+		t.Errorf("expected primary depth 4 at fence, got %d", fence.PrimaryQueueDepthAtFence)
+	}
+	if window, err := time.ParseDuration(fence.DuplicateWindow); err != nil || window < 20*time.Second {
+		t.Errorf("expected duplicate window of at least 20s, got %q", fence.DuplicateWindow)
+	}
+	stops := 0
+	for _, msg := range mockBroker.ControlMessages {
+		if msg.Type == protocol.ControlStopConsuming {
+			stops++
+		}
+	}
+	if stops != 1 {
+		t.Errorf("expected STOP_CONSUMING to be sent once, got %d", stops)
+	}
+}
+
+func TestReconcile_SourceFence_DeletesUnresponsiveSource(t *testing.T) {
+	migration := sourceFenceMigration("mig-fence")
+	migration.Spec.Timeouts = &migrationv1alpha1.MigrationTimeouts{OnSourceFenceTimeout: "Delete"}
+	requested := metav1.NewTime(time.Now().Add(-time.Minute))
+	migration.Status.SourceFence.RequestedAt = &requested
+	sourcePod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-0", Namespace: "default"},
+		Spec:       corev1.PodSpec{NodeName: "node-1"},
+	}
+
+	r, mockBroker, ctx := setupTest(migration, sourcePod)
+	mockBroker.Connected = true
+	mockBroker.SetQueueConsumers("orders", 1)
+
+	if _, err := reconcileOnce(r, ctx, "mig-fence", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-fence", "default")
+	if got.Status.SourceFence.Method != fenceDeleted || got.Status.SourceFence.FencedAt == nil {
+		t.Errorf("expected Deleted fence, got %+v", got.Status.SourceFence)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0", Namespace: "default"}, &corev1.Pod{}); !errors.IsNotFound(err) {
+		t.Error("expected unresponsive source pod to be deleted")
+	}
+	for _, msg := range mockBroker.ControlMessages {
+		if msg.Type == protocol.ControlStopConsuming {
+			t.Error("expected STOP_CONSUMING not to be resent")
+		}
+	}
+}
+
+func TestReconcile_SourceFence_FailsWithoutDeletingSource(t *testing.T) {
+	owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "myapp-5d9c", UID: "rs-1"}
+	for _, tc := range []struct {
+		name   string
+		policy string
+		owners []metav1.OwnerReference
+		reason string
+	}{
+		{"default", "", nil, "onSourceFenceTimeout"},
+		{"owned", "Delete", []metav1.OwnerReference{owner}, "would recreate it"},
+	} {
+		migration := sourceFenceMigration("mig-fence-" + tc.name)
+		migration.Spec.Timeouts = &migrationv1alpha1.MigrationTimeouts{OnSourceFenceTimeout: tc.policy}
+		requested := metav1.NewTime(time.Now().Add(-time.Minute))
+		migration.Status.SourceFence.RequestedAt = &requested
+		sourcePod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp-0", Namespace: "default", OwnerReferences: tc.owners},
+			Spec:       corev1.PodSpec{NodeName: "node-1"},
+		}
+
+		r, mockBroker, ctx := setupTest(migration, sourcePod)
+		mockBroker.Connected = true
+		mockBroker.SetQueueConsumers("orders", 1)
+
+		if _, err := reconcileOnce(r, ctx, migration.Name, "default"); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		got := fetchMigration(r, ctx, migration.Name, "default")
+		cond := meta.FindStatusCondition(got.Status.Conditions, "Failed")
+		if got.Status.Phase != migrationv1alpha1.PhaseFailed || cond == nil || !strings.Contains(cond.Message, tc.reason) {
+			t.Errorf("%s: expected the migration to fail with %q, got %q / %+v", tc.name, tc.reason, got.Status.Phase, cond)
+		}
+		if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0", Namespace: "default"}, &corev1.Pod{}); err != nil {
+			t.Errorf("%s: expected the source pod to be kept: %v", tc.name, err)
+		}
+	}
+}
+
+func TestReconcile_SourceFence_RechecksDepthAfterFence(t *testing.T) {
+	migration := sourceFenceMigration("mig-fence")
+	fenced := metav1.Now()
+	migration.Status.SourceFence.RequestedAt = &fenced
+
+	r, mockBroker, ctx := setupTest(migration)
+	mockBroker.Connected = true
+	mockBroker.SetQueueConsumers("orders", 0)
+	mockBroker.SetQueueDepth("orders.ms2m-replay", 0)
+
+	// Messages published just before the fence land on the replay queue
+	// after the first depth read; the depth is read again once fenced.
+	r.MsgClient = &depthAfterFenceBroker{MockBrokerClient: mockBroker}
+
+	if _, err := reconcileOnce(r, ctx, "mig-fence", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-fence", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseReplaying {
+		t.Fatalf("expected phase %q, got %q", migrationv1alpha1.PhaseReplaying, got.Status.Phase)
+	}
+	if got.Status.SourceFence.FencedAt == nil {
+		t.Error("expected source to be fenced")
+	}
+	if got.Status.ReplayQueueDepth != 3 {
+		t.Errorf("expected replay depth 3 after fence, got %d", got.Status.ReplayQueueDepth)
+	}
+}
+
+// depthAfterFenceBroker raises the replay queue depth as soon as the primary
+// queue's consumers are inspected, i.e. while the source is being fenced.
+type depthAfterFenceBroker struct {
+	*messaging.MockBrokerClient
+}
+
+func (b *depthAfterFenceBroker) GetQueueConsumers(ctx context.Context, queueName string) (int, error) {
+	b.SetQueueDepth("orders.ms2m-replay", 3)
+	return b.MockBrokerClient.GetQueueConsumers(ctx, queueName)
+}
+
+func TestAbortSafe_AfterSourceFenceRequested(t *testing.T) {
+	migration := sourceFenceMigration("mig-fence")
+	if !abortSafe(migration) {
+		t.Error("expected abort to be safe before the source is fenced")
+	}
+	requested := metav1.Now()
+	migration.Status.SourceFence.RequestedAt = &requested
+	if abortSafe(migration) {
+		t.Error("expected abort to be unsafe once STOP_CONSUMING was sent")
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Control protocol tests
+// ---------------------------------------------------------------------------
+
+func controlMigration(name string) *migrationv1alpha1.StatefulMigration {
+	migration := newMigration(name, migrationv1alpha1.PhaseReplaying)
+	migration.Status.TargetPod = "myapp-0-shadow"
+	migration.Status.SourceNode = "node-1"
+	migration.Status.PhaseTimings = map[string]string{}
+	return migration
+}
+
+func TestReconcile_Control_WaitsForStartReplayAck(t *testing.T) {
+	migration := controlMigration("mig-ctl")
+	r, mockBroker, ctx := setupTest(migration)
+	mockBroker.Connected = true
+	mockBroker.Unresponsive["myapp-0-shadow"] = true
+
+	result, err := reconcileOnce(r, ctx, "mig-ctl", "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.RequeueAfter != controlReplyPollInterval {
+		t.Errorf("expected requeue after %s while awaiting the ack, got %+v", controlReplyPollInterval, result)
+	}
+
+	got := fetchMigration(r, ctx, "mig-ctl", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseReplaying {
+		t.Fatalf("expected phase %q, got %q", migrationv1alpha1.PhaseReplaying, got.Status.Phase)
+	}
+	if _, ok := got.Status.PhaseTimings["Replaying.start"]; ok {
+		t.Error("expected replay not to start before START_REPLAY is acked")
+	}
+	req := got.Status.ControlRequest
+	if req == nil || req.Step != "Replaying" || req.Type != "START_REPLAY" || req.Pod != "myapp-0-shadow" || req.ID == "" {
+		t.Fatalf("expected pending START_REPLAY request, got %+v", req)
+	}
+	msg := mockBroker.ControlMessages[0].Message
+	if msg.ID != req.ID || msg.ReplyTo != "ms2m.reply.default.mig-ctl" || msg.Migration != "default/mig-ctl" {
+		t.Errorf("unexpected envelope %+v", msg)
+	}
+	if msg.Version != protocol.Version || msg.TTL != defaultControlMessageTTL {
+		t.Errorf("expected version %d and TTL %s, got %d and %s", protocol.Version, defaultControlMessageTTL, msg.Version, msg.TTL)
+	}
+
+	// The target acks: replay starts, the drained queue moves the migration
+	// to Finalizing, which waits for END_REPLAY's ack in turn.
+	mockBroker.Reply("ms2m.reply.default.mig-ctl", protocol.ControlReply{Version: protocol.Version, ID: req.ID, Status: protocol.ReplyAck})
+	if _, err := reconcileOnce(r, ctx, "mig-ctl", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got = fetchMigration(r, ctx, "mig-ctl", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFinalizing {
+		t.Fatalf("expected phase %q, got %q", migrationv1alpha1.PhaseFinalizing, got.Status.Phase)
+	}
+	if reply := controlReplied(got, "Replaying", protocol.ControlStartReplay); reply == nil || reply.Status != "ack" || reply.RoundTrip == "" {
+		t.Errorf("expected recorded START_REPLAY ack, got %+v", got.Status.ControlReplies)
+	}
+	if !controlPending(got, "Finalizing", protocol.ControlEndReplay) {
+		t.Fatalf("expected pending END_REPLAY request, got %+v", got.Status.ControlRequest)
+	}
+
+	delete(mockBroker.Unresponsive, "myapp-0-shadow")
+	mockBroker.Reply("ms2m.reply.default.mig-ctl", protocol.ControlReply{Version: protocol.Version, ID: got.Status.ControlRequest.ID, Status: protocol.ReplyAck})
+	if _, err := reconcileOnce(r, ctx, "mig-ctl", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got = fetchMigration(r, ctx, "mig-ctl", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseCompleted {
+		t.Fatalf("expected phase %q, got %q", migrationv1alpha1.PhaseCompleted, got.Status.Phase)
+	}
+	if len(got.Status.ControlReplies) != 2 {
+		t.Errorf("expected 2 recorded replies, got %+v", got.Status.ControlReplies)
+	}
+	if _, ok := mockBroker.Queues["ms2m.reply.default.mig-ctl"]; ok {
+		t.Error("expected reply queue to be deleted on completion")
+	}
+}
+
+func TestReconcile_Control_NackFailsMigration(t *testing.T) {
+	migration := controlMigration("mig-ctl")
+	r, mockBroker, ctx := setupTest(migration)
+	mockBroker.Connected = true
+	mockBroker.NackReason = "replay queue not found"
+
+	if _, err := reconcileOnce(r, ctx, "mig-ctl", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-ctl", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Fatalf("expected phase %q, got %q", migrationv1alpha1.PhaseFailed, got.Status.Phase)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, "Failed")
+	if cond == nil || cond.Message != "START_REPLAY rejected by pod myapp-0-shadow: replay queue not found" {
+		t.Errorf("unexpected Failed condition %+v", cond)
+	}
+}
+
+func TestReconcile_Control_AckTimeoutResends(t *testing.T) {
+	migration := controlMigration("mig-ctl")
+	sent := metav1.NewTime(time.Now().Add(-time.Minute))
+	migration.Status.ControlRequest = &migrationv1alpha1.ControlRequestStatus{
+		Step: "Replaying", Type: "START_REPLAY", Pod: "myapp-0-shadow", ID: "lost", SentAt: &sent,
+	}
+	r, mockBroker, ctx := setupTest(migration)
+	mockBroker.Connected = true
+	mockBroker.Unresponsive["myapp-0-shadow"] = true
+
+	result, err := reconcileOnce(r, ctx, "mig-ctl", "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Error("expected a retry backoff")
+	}
+	got := fetchMigration(r, ctx, "mig-ctl", "default")
+	if got.Status.RetryAttempts["START_REPLAY ack"] != 1 || got.Status.ControlRequest != nil {
+		t.Fatalf("expected one ack retry and no pending request, got %v / %+v", got.Status.RetryAttempts, got.Status.ControlRequest)
+	}
+
+	// A late reply to the dropped request must not be taken for the
+	// resend's.
+	mockBroker.Reply("ms2m.reply.default.mig-ctl", protocol.ControlReply{Version: protocol.Version, ID: "lost", Status: protocol.ReplyNack})
+	delete(mockBroker.Unresponsive, "myapp-0-shadow")
+	if _, err := reconcileOnce(r, ctx, "mig-ctl", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got = fetchMigration(r, ctx, "mig-ctl", "default")
+	if got.Status.Phase == migrationv1alpha1.PhaseFailed || got.Status.Phase == migrationv1alpha1.PhaseReplaying {
+		t.Fatalf("expected the resent START_REPLAY to be acked and replay to finish, got phase %q", got.Status.Phase)
+	}
+	if len(mockBroker.ControlMessages) < 1 || mockBroker.ControlMessages[0].Message.ID == "lost" {
+		t.Errorf("expected a resend under a new correlation ID, got %+v", mockBroker.ControlMessages)
+	}
+}
+
+func TestReconcile_Control_AckModeNoneDoesNotWait(t *testing.T) {
+	migration := controlMigration("mig-ctl")
+	migration.Spec.ControlProtocol = &migrationv1alpha1.ControlProtocol{AckMode: "None"}
+	r, mockBroker, ctx := setupTest(migration)
+	mockBroker.Connected = true
+	mockBroker.Unresponsive["myapp-0-shadow"] = true
+
+	if _, err := reconcileOnce(r, ctx, "mig-ctl", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-ctl", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseCompleted {
+		t.Fatalf("expected phase %q, got %q", migrationv1alpha1.PhaseCompleted, got.Status.Phase)
+	}
+	for _, msg := range mockBroker.ControlMessages {
+		if msg.Message.ID != "" || msg.Message.ReplyTo != "" {
+			t.Errorf("expected fire-and-forget messages, got %+v", msg.Message)
+		}
+	}
+}
+
+func TestReconcile_Control_SourceFenceAcked(t *testing.T) {
+	migration := sourceFenceMigration("mig-fence")
+	migration.Spec.ControlProtocol = nil
+	migration.Status.PhaseTimings["Replaying.start"] = time.Now().Format(time.RFC3339)
+
+	r, mockBroker, ctx := setupTest(migration)
+	mockBroker.Connected = true
+	// Other replicas keep consuming the primary queue; the source's ack is
+	// what counts.
+	mockBroker.SetQueueConsumers("orders", 2)
+
+	if _, err := reconcileOnce(r, ctx, "mig-fence", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-fence", "default")
+	if got.Status.SourceFence.Method != fenceStopConsuming || got.Status.SourceFence.FencedAt == nil {
+		t.Errorf("expected StopConsuming fence, got %+v", got.Status.SourceFence)
+	}
+	if reply := controlReplied(got, "SourceFence", protocol.ControlStopConsuming); reply == nil || reply.Pod != "myapp-0" {
+		t.Errorf("expected STOP_CONSUMING ack from myapp-0, got %+v", got.Status.ControlReplies)
+	}
+}
+
+func TestReconcile_Control_SourceFenceNackDeletesSource(t *testing.T) {
+	migration := sourceFenceMigration("mig-fence")
+	migration.Spec.ControlProtocol = nil
+	migration.Spec.Timeouts = &migrationv1alpha1.MigrationTimeouts{OnSourceFenceTimeout: "Delete"}
+	sourcePod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-0", Namespace: "default"},
+		Spec:       corev1.PodSpec{NodeName: "node-1"},
+	}
+
+	r, mockBroker, ctx := setupTest(migration, sourcePod)
+	mockBroker.Connected = true
+	mockBroker.NackReason = "consumer busy"
+
+	if _, err := reconcileOnce(r, ctx, "mig-fence", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-fence", "default")
+	if got.Status.SourceFence.Method != fenceDeleted {
+		t.Errorf("expected Deleted fence after a nack, got %+v", got.Status.SourceFence)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0", Namespace: "default"}, &corev1.Pod{}); !errors.IsNotFound(err) {
+		t.Error("expected source pod to be deleted")
+	}
+}
+
+func TestReconcile_Pending_RejectsUnknownAckMode(t *testing.T) {
+	migration := newMigration("mig-ctl", migrationv1alpha1.PhasePending)
+	migration.Spec.ControlProtocol = &migrationv1alpha1.ControlProtocol{AckMode: "Sometimes"}
+
+	r, _, ctx := setupTest(migration)
+
+	if _, err := reconcileOnce(r, ctx, "mig-ctl", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-ctl", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Errorf("expected Failed for an unknown ack mode, got %q", got.Status.Phase)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Restore readiness tests
+// ---------------------------------------------------------------------------
+
+// readinessMigration returns a ShadowPod migration in Restoring whose shadow
+// pod is already Running (but not Ready).
+func readinessMigration(name string) (*migrationv1alpha1.StatefulMigration, *corev1.Pod) {
+	migration := newMigration(name, migrationv1alpha1.PhaseRestoring)
+	migration.Spec.MigrationStrategy = "ShadowPod"
+	migration.Status.SourceNode = "node-1"
+	migration.Status.PhaseTimings = map[string]string{}
+	shadowPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-0-shadow",
+			Namespace: "default",
+			Labels:    map[string]string{"migration.ms2m.io/migration": name},
+		},
+		Spec:   corev1.PodSpec{NodeName: "node-2"},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "127.0.0.1"},
+	}
+	return migration, shadowPod
+}
+
+// restoredPastReadiness reports whether the migration left Restoring through
+// the readiness gate. The mock broker acks START_REPLAY and has an empty
+// replay queue, so the phase chain may run on past Replaying.
+func restoredPastReadiness(m *migrationv1alpha1.StatefulMigration) bool {
+	return m.Status.Phase != migrationv1alpha1.PhaseRestoring && m.Status.Phase != migrationv1alpha1.PhaseFailed &&
+		m.Status.RestoreReadiness != nil && m.Status.RestoreReadiness.ReadyAt != nil
+}
+
+func TestReconcile_Restoring_WaitsForPodReady(t *testing.T) {
+	migration, shadowPod := readinessMigration("mig-ready")
+	r, mockBroker, ctx := setupTest(migration, shadowPod)
+	mockBroker.Connected = true
+
+	result, err := reconcileOnce(r, ctx, "mig-ready", "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.RequeueAfter != readinessPollInterval {
+		t.Errorf("expected requeue after %s while the pod is not Ready, got %+v", readinessPollInterval, result)
+	}
+	got := fetchMigration(r, ctx, "mig-ready", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseRestoring {
+		t.Fatalf("expected to stay in Restoring, got %q", got.Status.Phase)
+	}
+	if got.Status.RestoreReadiness == nil || got.Status.RestoreReadiness.RunningAt == nil || got.Status.RestoreReadiness.Type != readinessPodReady {
+		t.Fatalf("expected runningAt to be recorded for PodReady, got %+v", got.Status.RestoreReadiness)
+	}
+	if len(mockBroker.ControlMessages) != 0 {
+		t.Errorf("expected no control messages before the pod is Ready, got %d", len(mockBroker.ControlMessages))
+	}
+
+	shadowPod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	if err := r.Status().Update(ctx, shadowPod); err != nil {
+		t.Fatalf("update pod status: %v", err)
+	}
+	if _, err := reconcileOnce(r, ctx, "mig-ready", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got = fetchMigration(r, ctx, "mig-ready", "default")
+	if !restoredPastReadiness(got) {
+		t.Errorf("expected to leave Restoring once the pod is Ready, got %q", got.Status.Phase)
+	}
+	if got.Status.RestoreReadiness.ReadyAt == nil || got.Status.RestoreReadiness.RestoreToReady == "" {
+		t.Errorf("expected restore-to-ready latency to be recorded, got %+v", got.Status.RestoreReadiness)
+	}
+}
+
+func TestReconcile_Restoring_RunningReadinessSkipsWait(t *testing.T) {
+	migration, shadowPod := readinessMigration("mig-ready")
+	migration.Spec.RestoreReadiness = &migrationv1alpha1.RestoreReadiness{Type: "Running"}
+	r, mockBroker, ctx := setupTest(migration, shadowPod)
+	mockBroker.Connected = true
+
+	if _, err := reconcileOnce(r, ctx, "mig-ready", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-ready", "default")
+	if !restoredPastReadiness(got) {
+		t.Errorf("expected to leave Restoring for a Running pod, got %q", got.Status.Phase)
+	}
+}
+
+func TestReconcile_Restoring_HTTPReadiness(t *testing.T) {
+	var healthy bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/ready" || !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	_, portStr, _ := net.SplitHostPort(u.Host)
+	var port int32
+	fmt.Sscanf(portStr, "%d", &port)
+
+	migration, shadowPod := readinessMigration("mig-ready")
+	migration.Spec.RestoreReadiness = &migrationv1alpha1.RestoreReadiness{Type: "HTTP", HTTPPath: "/ready", HTTPPort: port}
+	r, mockBroker, ctx := setupTest(migration, shadowPod)
+	mockBroker.Connected = true
+
+	if _, err := reconcileOnce(r, ctx, "mig-ready", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := fetchMigration(r, ctx, "mig-ready", "default"); got.Status.Phase != migrationv1alpha1.PhaseRestoring {
+		t.Fatalf("expected to stay in Restoring while the endpoint returns 503, got %q", got.Status.Phase)
+	}
+
+	healthy = true
+	if _, err := reconcileOnce(r, ctx, "mig-ready", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := fetchMigration(r, ctx, "mig-ready", "default"); !restoredPastReadiness(got) {
+		t.Errorf("expected to leave Restoring once the endpoint returns 200, got %q", got.Status.Phase)
+	}
+}
+
+func TestReconcile_Restoring_PingReadiness(t *testing.T) {
+	migration, shadowPod := readinessMigration("mig-ready")
+	migration.Spec.RestoreReadiness = &migrationv1alpha1.RestoreReadiness{Type: "Ping"}
+	r, mockBroker, ctx := setupTest(migration, shadowPod)
+	mockBroker.Connected = true
+	mockBroker.Unresponsive["myapp-0-shadow"] = true
+
+	if _, err := reconcileOnce(r, ctx, "mig-ready", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-ready", "default")
+	if !controlPending(got, "Restoring", protocol.ControlPing) {
+		t.Fatalf("expected a pending PING, got %+v", got.Status.ControlRequest)
+	}
+
+	// The restored process reconnects and answers.
+	mockBroker.Reply(replyQueue(got), protocol.ControlReply{
+		Version: protocol.Version,
+		ID:      got.Status.ControlRequest.ID,
+		Status:  protocol.ReplyAck,
+	})
+	if _, err := reconcileOnce(r, ctx, "mig-ready", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got = fetchMigration(r, ctx, "mig-ready", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseReplaying {
+		t.Errorf("expected Replaying after the PING ack, got %q", got.Status.Phase)
+	}
+	if got.Status.RestoreReadiness.RestoreToReady == "" {
+		t.Errorf("expected restore-to-ready latency, got %+v", got.Status.RestoreReadiness)
+	}
+}
+
+func TestReconcile_Pending_RejectsInvalidRestoreReadiness(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  migrationv1alpha1.StatefulMigrationSpec
+		match string
+	}{
+		{"unknown type", migrationv1alpha1.StatefulMigrationSpec{
+			RestoreReadiness: &migrationv1alpha1.RestoreReadiness{Type: "Exec"},
+		}, "restoreReadiness.type"},
+		{"HTTP without port", migrationv1alpha1.StatefulMigrationSpec{
+			RestoreReadiness: &migrationv1alpha1.RestoreReadiness{Type: "HTTP"},
+		}, "httpPort"},
+		{"Ping without acks", migrationv1alpha1.StatefulMigrationSpec{
+			RestoreReadiness: &migrationv1alpha1.RestoreReadiness{Type: "Ping"},
+			ControlProtocol:  &migrationv1alpha1.ControlProtocol{AckMode: "None"},
+		}, "ackMode Required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migration := newMigration("mig-ready", migrationv1alpha1.PhasePending)
+			migration.Spec.RestoreReadiness = tt.spec.RestoreReadiness
+			migration.Spec.ControlProtocol = tt.spec.ControlProtocol
+			r, _, ctx := setupTest(migration)
+
+			if _, err := reconcileOnce(r, ctx, "mig-ready", "default"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := fetchMigration(r, ctx, "mig-ready", "default")
+			if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+				t.Fatalf("expected Failed, got %q", got.Status.Phase)
+			}
+			if cond := meta.FindStatusCondition(got.Status.Conditions, "Failed"); cond == nil || !strings.Contains(cond.Message, tt.match) {
+				t.Errorf("expected failure mentioning %q, got %+v", tt.match, cond)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Traffic handover tests
+// ---------------------------------------------------------------------------
+
+// handoverObjects returns a source pod labelled app=myapp,tier=web, a Service
+// selecting app=myapp and an unrelated Service.
+func handoverObjects() (*corev1.Pod, *corev1.Service, *corev1.Service) {
+	sourcePod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-0",
+			Namespace: "default",
+			Labels:    map[string]string{"app": "myapp", "tier": "web"},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:   "node-1",
+			Containers: []corev1.Container{{Name: "app", Image: "myapp:latest"}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "myapp"}},
+	}
+	other := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "other"}},
+	}
+	return sourcePod, svc, other
+}
+
+// endpointSlice lists pods as endpoints of the Service.
+func endpointSlice(service string, pods ...string) *discoveryv1.EndpointSlice {
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      service + "-abc",
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+	}
+	ready := true
+	for _, pod := range pods {
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+			Addresses:  []string{"10.0.0.1"},
+			Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+			TargetRef:  &corev1.ObjectReference{Kind: "Pod", Name: pod, Namespace: "default"},
+		})
+	}
+	return slice
+}
+
+func TestReconcile_Restoring_HoldsServiceLabelsFromShadow(t *testing.T) {
+	migration := newMigration("mig-traffic", migrationv1alpha1.PhaseRestoring)
+	migration.Spec.MigrationStrategy = "ShadowPod"
+	migration.Status.SourceNode = "node-1"
+	migration.Status.PhaseTimings = map[string]string{}
+	sourcePod, svc, other := handoverObjects()
+
+	r, _, ctx := setupTest(migration, sourcePod, svc, other)
+	if _, err := reconcileOnce(r, ctx, "mig-traffic", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	shadow := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0-shadow", Namespace: "default"}, shadow); err != nil {
+		t.Fatalf("expected shadow pod to be created: %v", err)
+	}
+	if _, ok := shadow.Labels["app"]; ok {
+		t.Error("expected the Service-selected label app to be withheld from the shadow pod")
+	}
+	if shadow.Labels["tier"] != "web" || shadow.Labels["migration.ms2m.io/migration"] != "mig-traffic" {
+		t.Errorf("expected other labels to be kept, got %v", shadow.Labels)
+	}
+
+	got := fetchMigration(r, ctx, "mig-traffic", "default")
+	th := got.Status.TrafficHandover
+	if th == nil || len(th.Services) != 1 || th.Services[0] != "myapp" || th.HeldLabels["app"] != "myapp" {
+		t.Errorf("expected Service myapp and held label app=myapp, got %+v", th)
+	}
+}
+
+func TestReconcile_Restoring_HandoverNoneKeepsLabels(t *testing.T) {
+	migration := newMigration("mig-traffic", migrationv1alpha1.PhaseRestoring)
+	migration.Spec.MigrationStrategy = "ShadowPod"
+	migration.Spec.TrafficHandover = &migrationv1alpha1.TrafficHandover{Mode: "None"}
+	migration.Status.SourceNode = "node-1"
+	migration.Status.PhaseTimings = map[string]string{}
+	sourcePod, svc, _ := handoverObjects()
+
+	r, _, ctx := setupTest(migration, sourcePod, svc)
+	if _, err := reconcileOnce(r, ctx, "mig-traffic", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	shadow := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0-shadow", Namespace: "default"}, shadow); err != nil {
+		t.Fatalf("expected shadow pod to be created: %v", err)
+	}
+	if shadow.Labels["app"] != "myapp" {
+		t.Errorf("expected the shadow pod to keep app=myapp with mode None, got %v", shadow.Labels)
+	}
+	if got := fetchMigration(r, ctx, "mig-traffic", "default"); got.Status.TrafficHandover != nil {
+		t.Errorf("expected no traffic handover status, got %+v", got.Status.TrafficHandover)
+	}
+}
+
+// handoverMigration returns a ShadowPod migration in Finalizing whose shadow
+// pod was created with app=myapp held back.
+func handoverMigration() (*migrationv1alpha1.StatefulMigration, *corev1.Pod) {
+	migration := newMigration("mig-traffic", migrationv1alpha1.PhaseFinalizing)
+	migration.Spec.MigrationStrategy = "ShadowPod"
+	migration.Spec.ControlProtocol = &migrationv1alpha1.ControlProtocol{AckMode: "None"}
+	migration.Status.TargetPod = "myapp-0-shadow"
+	migration.Status.SourceNode = "node-1"
+	migration.Status.PhaseTimings = map[string]string{}
+	migration.Status.TrafficHandover = &migrationv1alpha1.TrafficHandoverStatus{
+		Services:   []string{"myapp"},
+		HeldLabels: map[string]string{"app": "myapp"},
+	}
+	shadow := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-0-shadow",
+			Namespace: "default",
+			Labels:    map[string]string{"tier": "web"},
+		},
+		Spec: corev1.PodSpec{NodeName: "node-2"},
+	}
+	return migration, shadow
+}
+
+func TestReconcile_Finalizing_HandsOverTraffic(t *testing.T) {
+	migration, shadow := handoverMigration()
+	sourcePod, svc, _ := handoverObjects()
+
+	r, mockBroker, ctx := setupTest(migration, shadow, sourcePod, svc, endpointSlice("myapp", "myapp-0-shadow"))
+	mockBroker.Connected = true
+
+	if _, err := reconcileOnce(r, ctx, "mig-traffic", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-traffic", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseCompleted {
+		t.Fatalf("expected Completed, got %q", got.Status.Phase)
+	}
+	th := got.Status.TrafficHandover
+	if th.ShadowAddedAt == nil || th.SourceRemovedAt == nil || th.Switchover == "" {
+		t.Errorf("expected the switchover to be recorded, got %+v", th)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0-shadow", Namespace: "default"}, shadow); err != nil {
+		t.Fatal(err)
+	}
+	if shadow.Labels["app"] != "myapp" {
+		t.Errorf("expected the shadow pod to receive app=myapp, got %v", shadow.Labels)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0", Namespace: "default"}, &corev1.Pod{}); !errors.IsNotFound(err) {
+		t.Error("expected source pod to be deleted after the handover")
+	}
+}
+
+func TestReconcile_Finalizing_HandoverWaitsForShadowEndpoint(t *testing.T) {
+	migration, shadow := handoverMigration()
+	sourcePod, svc, _ := handoverObjects()
+
+	// Only the source is an endpoint so far.
+	r, mockBroker, ctx := setupTest(migration, shadow, sourcePod, svc, endpointSlice("myapp", "myapp-0"))
+	mockBroker.Connected = true
+
+	result, err := reconcileOnce(r, ctx, "mig-traffic", "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.RequeueAfter != endpointPollInterval {
+		t.Errorf("expected requeue after %s, got %+v", endpointPollInterval, result)
+	}
+
+	got := fetchMigration(r, ctx, "mig-traffic", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFinalizing || got.Status.TrafficHandover.SourceRemovedAt != nil {
+		t.Fatalf("expected to wait in Finalizing with the source still serving, got %q %+v",
+			got.Status.Phase, got.Status.TrafficHandover)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0", Namespace: "default"}, sourcePod); err != nil {
+		t.Fatalf("expected source pod to remain: %v", err)
+	}
+	if sourcePod.Labels["app"] != "myapp" {
+		t.Errorf("expected the source to keep its Service label, got %v", sourcePod.Labels)
+	}
+}
+
+func TestReconcile_Pending_RejectsUnknownHandoverMode(t *testing.T) {
+	migration := newMigration("mig-traffic", migrationv1alpha1.PhasePending)
+	migration.Spec.TrafficHandover = &migrationv1alpha1.TrafficHandover{Mode: "DNS"}
+
+	r, _, ctx := setupTest(migration)
+	if _, err := reconcileOnce(r, ctx, "mig-traffic", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := fetchMigration(r, ctx, "mig-traffic", "default"); got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Errorf("expected Failed for an unknown handover mode, got %q", got.Status.Phase)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Deployment placement tests
+// ---------------------------------------------------------------------------
+
+// placementObjects returns a Deployment source pod, its shadow and the
+// Deployment, whose template carries user affinity.
+func placementObjects() (*corev1.Pod, *corev1.Pod, *appsv1.Deployment) {
+	sourcePod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-abc12",
+			Namespace: "default",
+			Labels:    map[string]string{"app": "myapp"},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:   "node-1",
+			Containers: []corev1.Container{{Name: "app", Image: "myapp:latest"}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	shadow := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-abc12-shadow",
+			Namespace: "default",
+			Labels:    map[string]string{"app": "myapp"},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: migrationv1alpha1.GroupVersion.String(),
+				Kind:       "StatefulMigration",
+				Name:       "mig-placement",
+				UID:        "mig-uid",
+			}},
+		},
+		Spec: corev1.PodSpec{NodeName: "node-2"},
+	}
+	replicas := int32(2)
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp", Namespace: "default"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "myapp"}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "myapp"}},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app", Image: "myapp:latest"}},
+					Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+						RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+							NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+								MatchExpressions: []corev1.NodeSelectorRequirement{{
+									Key:      "topology.kubernetes.io/zone",
+									Operator: corev1.NodeSelectorOpIn,
+									Values:   []string{"zone-a"},
+								}},
+							}},
+						},
+					}},
+				},
+			},
+		},
+	}
+	return sourcePod, shadow, deploy
+}
+
+func placementMigration(mode string) *migrationv1alpha1.StatefulMigration {
+	migration := newMigration("mig-placement", migrationv1alpha1.PhaseFinalizing)
+	migration.Spec.SourcePod = "myapp-abc12"
+	migration.Spec.MigrationStrategy = "ShadowPod"
+	migration.Spec.DeploymentPlacement = mode
+	migration.Status.TargetPod = "myapp-abc12-shadow"
+	migration.Status.SourceNode = "node-1"
+	migration.Status.DeploymentName = "myapp"
+	migration.Status.PhaseTimings = map[string]string{}
+	return migration
+}
+
+func TestReconcile_Finalizing_Deployment_ReleasesShadowForAdoption(t *testing.T) {
+	sourcePod, shadow, deploy := placementObjects()
+	migration := placementMigration("")
+
+	r, mockBroker, ctx := setupTest(migration, sourcePod, shadow, deploy)
+	mockBroker.Connected = true
+
+	result, err := reconcileOnce(r, ctx, "mig-placement", "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Error("expected a requeue while waiting for the ReplicaSet to adopt the shadow")
+	}
+
+	got := fetchMigration(r, ctx, "mig-placement", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFinalizing {
+		t.Errorf("expected phase Finalizing while waiting for adoption, got %q", got.Status.Phase)
+	}
+	if _, ok := got.Status.PhaseTimings["Finalizing.shadowReleased"]; !ok {
+		t.Error("expected Finalizing.shadowReleased to be recorded")
+	}
+
+	updatedShadow := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-abc12-shadow", Namespace: "default"}, updatedShadow); err != nil {
+		t.Fatalf("failed to get shadow pod: %v", err)
+	}
+	if len(updatedShadow.OwnerReferences) != 0 {
+		t.Errorf("expected the StatefulMigration ownerRef to be removed, got %v", updatedShadow.OwnerReferences)
+	}
+
+	updatedSource := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-abc12", Namespace: "default"}, updatedSource); err != nil {
+		t.Fatalf("source pod should survive until the shadow is adopted: %v", err)
+	}
+	if cost := updatedSource.Annotations[podDeletionCostAnnotation]; cost != "-2147483648" {
+		t.Errorf("expected the source to get the lowest deletion cost, got %q", cost)
+	}
+}
+
+func TestReconcile_Finalizing_Deployment_AdoptedShadowCompletes(t *testing.T) {
+	sourcePod, shadow, deploy := placementObjects()
+	isController := true
+	shadow.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: "apps/v1",
+		Kind:       "ReplicaSet",
+		Name:       "myapp-5d9c",
+		UID:        "rs-uid",
+		Controller: &isController,
+	}}
+	migration := placementMigration("")
+
+	r, mockBroker, ctx := setupTest(migration, sourcePod, shadow, deploy)
+	mockBroker.Connected = true
+
+	if _, err := reconcileOnce(r, ctx, "mig-placement", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-placement", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseCompleted {
+		t.Fatalf("expected Completed, got %q", got.Status.Phase)
+	}
+
+	// The default placement leaves the template, and the user's affinity,
+	// untouched so the Deployment does not roll.
+	updatedDeploy := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp", Namespace: "default"}, updatedDeploy); err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	na := updatedDeploy.Spec.Template.Spec.Affinity.NodeAffinity
+	if len(na.PreferredDuringSchedulingIgnoredDuringExecution) != 0 {
+		t.Errorf("expected no preferred terms, got %v", na.PreferredDuringSchedulingIgnoredDuringExecution)
+	}
+	if exprs := na.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions; len(exprs) != 1 {
+		t.Errorf("expected the user's affinity to be unchanged, got %v", exprs)
+	}
+
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-abc12", Namespace: "default"}, &corev1.Pod{}); !errors.IsNotFound(err) {
+		t.Errorf("expected source pod to be deleted, got %v", err)
+	}
+}
+
+func TestReconcile_Finalizing_Deployment_AdoptionTimeout(t *testing.T) {
+	sourcePod, shadow, deploy := placementObjects()
+	shadow.OwnerReferences = nil
+	migration := placementMigration("")
+	migration.Status.PhaseTimings["Finalizing.shadowReleased"] = time.Now().Add(-time.Minute).Format(time.RFC3339)
+
+	migration.Spec.RetryPolicy = &migrationv1alpha1.RetryPolicy{MaxAttempts: 2}
+
+	r, mockBroker, ctx := setupTest(migration, sourcePod, shadow, deploy)
+	mockBroker.Connected = true
+
+	// The first expiry is retried with the source kept.
+	result, err := reconcileOnce(r, ctx, "mig-placement", "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-placement", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFinalizing || result.RequeueAfter == 0 {
+		t.Fatalf("expected a retry in Finalizing, got phase %q and %+v", got.Status.Phase, result)
+	}
+	if got.Status.RetryAttempts["adopt shadow pod"] != 1 {
+		t.Errorf("expected the adoption attempt to be counted, got %v", got.Status.RetryAttempts)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-abc12", Namespace: "default"}, &corev1.Pod{}); err != nil {
+		t.Errorf("expected the source pod to be kept while the shadow is orphaned: %v", err)
+	}
+
+	// Out of attempts, the migration fails naming the orphaned shadow.
+	if _, err := reconcileOnce(r, ctx, "mig-placement", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got = fetchMigration(r, ctx, "mig-placement", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Fatalf("expected Failed once the retries ran out, got %q", got.Status.Phase)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, "Failed")
+	if cond == nil || !strings.Contains(cond.Message, "shadow pod myapp-abc12-shadow was not adopted") {
+		t.Errorf("expected the failure to name the shadow pod, got %+v", cond)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-abc12", Namespace: "default"}, &corev1.Pod{}); err != nil {
+		t.Errorf("expected the source pod to be kept: %v", err)
+	}
+}
+
+func TestReconcile_Finalizing_Deployment_PreferredKeepsUserAffinity(t *testing.T) {
+	sourcePod, _, deploy := placementObjects()
+	migration := placementMigration("Preferred")
+
+	r, mockBroker, ctx := setupTest(migration, sourcePod, deploy)
+	mockBroker.Connected = true
+
+	if _, err := reconcileOnce(r, ctx, "mig-placement", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	updatedDeploy := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp", Namespace: "default"}, updatedDeploy); err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	na := updatedDeploy.Spec.Template.Spec.Affinity.NodeAffinity
+	if exprs := na.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions; len(exprs) != 1 ||
+		exprs[0].Key != "topology.kubernetes.io/zone" {
+		t.Errorf("expected the user's required affinity to be kept, got %v", exprs)
+	}
+	preferred := na.PreferredDuringSchedulingIgnoredDuringExecution
+	if len(preferred) != 1 {
+		t.Fatalf("expected one preferred term, got %v", preferred)
+	}
+	expr := preferred[0].Preference.MatchExpressions[0]
+	if expr.Key != "kubernetes.io/hostname" || len(expr.Values) != 1 || expr.Values[0] != "node-2" {
+		t.Errorf("expected a preferred term for node-2, got %v", expr)
+	}
+}
+
+func TestReconcile_Finalizing_Deployment_RequiredAndsUserAffinity(t *testing.T) {
+	sourcePod, _, deploy := placementObjects()
+	migration := placementMigration("Required")
+
+	r, mockBroker, ctx := setupTest(migration, sourcePod, deploy)
+	mockBroker.Connected = true
+
+	if _, err := reconcileOnce(r, ctx, "mig-placement", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	updatedDeploy := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp", Namespace: "default"}, updatedDeploy); err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	terms := updatedDeploy.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) != 1 {
+		t.Fatalf("expected the single user term to be kept, got %v", terms)
+	}
+	exprs := terms[0].MatchExpressions
+	if len(exprs) != 2 || exprs[0].Key != "topology.kubernetes.io/zone" || exprs[1].Key != "kubernetes.io/hostname" {
+		t.Errorf("expected the hostname to be ANDed into the user term, got %v", exprs)
+	}
+}
+
+func TestPlaceDeployment_Idempotent(t *testing.T) {
+	for _, mode := range []string{"Preferred", "Required"} {
+		_, _, deploy := placementObjects()
+		if !placeDeployment(deploy, mode, "node-2") {
+			t.Errorf("%s: expected the first call to change the template", mode)
+		}
+		if placeDeployment(deploy, mode, "node-2") {
+			t.Errorf("%s: expected the second call to be a no-op", mode)
+		}
+	}
+	_, _, deploy := placementObjects()
+	if placeDeployment(deploy, "None", "node-2") {
+		t.Error("None: expected no change")
+	}
+}
+
+func TestReconcile_Pending_InvalidDeploymentPlacement(t *testing.T) {
+	migration := newMigration("mig-bad-placement", migrationv1alpha1.PhasePending)
+	migration.Spec.DeploymentPlacement = "Always"
+
+	r, _, ctx := setupTest(migration)
+
+	if _, err := reconcileOnce(r, ctx, "mig-bad-placement", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-bad-placement", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Errorf("expected Failed, got %q", got.Status.Phase)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Ordinal reservation tests
+// ---------------------------------------------------------------------------
+
+// reserveObjects returns a three-replica StatefulSet and its pod with the
+// given name, owned by it and running on node-1.
+func reserveObjects(podName string) (*appsv1.StatefulSet, *corev1.Pod) {
+	replicas := int32(3)
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp", Namespace: "default"},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "myapp"}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "myapp"}},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "myapp:latest"}}},
+			},
+		},
+	}
+	isController := true
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: "default",
+			Labels:    map[string]string{"app": "myapp", "statefulset.kubernetes.io/pod-name": podName},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1",
+				Kind:       "StatefulSet",
+				Name:       "myapp",
+				UID:        "sts-uid",
+				Controller: &isController,
+			}},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:   "node-1",
+			Hostname:   podName,
+			Subdomain:  "myapp",
+			Containers: []corev1.Container{{Name: "app", Image: "myapp:latest"}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	return sts, pod
+}
+
+// reserveMigration returns a ReserveOrdinal migration of pod in the given
+// phase, with the status handlePending would have recorded.
+func reserveMigration(pod *corev1.Pod, phase migrationv1alpha1.Phase) *migrationv1alpha1.StatefulMigration {
+	migration := newMigration("mig-reserve", phase)
+	migration.Spec.SourcePod = pod.Name
+	migration.Spec.MigrationStrategy = "ShadowPod"
+	migration.Spec.IdentitySwapMode = "ReserveOrdinal"
+	migration.Spec.ControlProtocol = &migrationv1alpha1.ControlProtocol{AckMode: "None"}
+	if phase == migrationv1alpha1.PhasePending {
+		return migration
+	}
+	migration.Status.SourceNode = "node-1"
+	migration.Status.ContainerName = "app"
+	migration.Status.StatefulSetName = "myapp"
+	migration.Status.SourcePodLabels = pod.Labels
+	migration.Status.SourcePodSpec = pod.Spec.DeepCopy()
+	migration.Status.CheckpointImage = "registry.example.com/checkpoints/app:ckpt"
+	migration.Status.PhaseTimings = map[string]string{}
+	return migration
+}
+
+func TestHoldMethod(t *testing.T) {
+	five := int32(5)
+	tests := []struct {
+		name        string
+		start       *int32
+		deleteScale bool
+		ordinal     int32
+		want        string
+		wantErr     bool
+	}{
+		{name: "highest", ordinal: 2, want: holdScaleDown},
+		{name: "lowest", ordinal: 0, want: holdShiftStart},
+		{name: "lowest with start", start: &five, ordinal: 5, want: holdShiftStart},
+		{name: "middle", ordinal: 1, want: holdPause},
+		{name: "highest, claims deleted when scaled", deleteScale: true, ordinal: 2, want: holdPause},
+		{name: "lowest, claims deleted when scaled", deleteScale: true, ordinal: 0, want: holdPause},
+		{name: "out of range", ordinal: 7, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sts, _ := reserveObjects("myapp-0")
+			if tt.start != nil {
+				sts.Spec.Ordinals = &appsv1.StatefulSetOrdinals{Start: *tt.start}
+			}
+			if tt.deleteScale {
+				sts.Spec.PersistentVolumeClaimRetentionPolicy = &appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy{
+					WhenDeleted: appsv1.RetainPersistentVolumeClaimRetentionPolicyType,
+					WhenScaled:  appsv1.DeletePersistentVolumeClaimRetentionPolicyType,
+				}
+			}
+			method, err := holdMethod(sts, tt.ordinal)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if method != tt.want {
+				t.Errorf("expected method %q, got %q", tt.want, method)
+			}
+		})
+	}
+}
+
+func TestApplyHold_RevertRestoresStatefulSet(t *testing.T) {
+	partition := int32(1)
+	zero := int32(0)
+	tests := []struct {
+		name string
+		hold migrationv1alpha1.OrdinalReservationStatus
+	}{
+		{name: "scale down", hold: migrationv1alpha1.OrdinalReservationStatus{Ordinal: 2, Method: holdScaleDown}},
+		{name: "shift start", hold: migrationv1alpha1.OrdinalReservationStatus{Ordinal: 0, Method: holdShiftStart, OriginalStart: &zero}},
+		{name: "pause", hold: migrationv1alpha1.OrdinalReservationStatus{Ordinal: 1, Method: holdPause}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sts, _ := reserveObjects("myapp-0")
+			sts.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{
+				Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+				RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: &partition},
+			}
+			original := sts.DeepCopy()
+			hold := tt.hold
+			if hold.Method == holdPause {
+				hold.OriginalUpdateStrategy = sts.Spec.UpdateStrategy.DeepCopy()
+			}
+
+			applyHold(sts, &hold, 3)
+			applyHold(sts, &hold, 3)
+			switch hold.Method {
+			case holdPause:
+				if *sts.Spec.Replicas != 3 || sts.Spec.UpdateStrategy.Type != appsv1.OnDeleteStatefulSetStrategyType {
+					t.Errorf("expected 3 replicas with OnDelete updates, got %d %q", *sts.Spec.Replicas, sts.Spec.UpdateStrategy.Type)
+				}
+				if gates := sts.Spec.Template.Spec.SchedulingGates; len(gates) != 1 || gates[0].Name != ordinalHoldGate {
+					t.Errorf("expected one hold gate, got %v", gates)
+				}
+			default:
+				if *sts.Spec.Replicas != 2 {
+					t.Errorf("expected 2 replicas, got %d", *sts.Spec.Replicas)
+				}
+			}
+
+			revertHold(sts, &hold, 3)
+			if !equality.Semantic.DeepEqual(original.Spec, sts.Spec) {
+				t.Errorf("expected the StatefulSet spec restored exactly, got %+v", sts.Spec)
+			}
+		})
+	}
+}
+
+func TestReconcile_Pending_ReserveOrdinal_RejectsOutOfRangeOrdinal(t *testing.T) {
+	sts, pod := reserveObjects("myapp-5")
+	migration := reserveMigration(pod, migrationv1alpha1.PhasePending)
+
+	r, _, ctx := setupTest(migration, sts, pod)
+
+	if _, err := reconcileOnce(r, ctx, "mig-reserve", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-reserve", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Fatalf("expected Failed, got %q", got.Status.Phase)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, "Failed")
+	if cond == nil || !strings.Contains(cond.Message, "outside StatefulSet") {
+		t.Errorf("expected an out-of-range failure, got %+v", cond)
+	}
+}
+
+func TestReconcile_Restoring_ReserveOrdinal_FencesAndScalesDown(t *testing.T) {
+	sts, pod := reserveObjects("myapp-2")
+	migration := reserveMigration(pod, migrationv1alpha1.PhaseRestoring)
+
+	r, mockBroker, ctx := setupTest(migration, sts, pod)
+	mockBroker.Connected = true
+	mockBroker.SetQueueConsumers("orders", 0)
+
+	if _, err := reconcileOnce(r, ctx, "mig-reserve", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-reserve", "default")
+	if got.Status.SourceFence == nil || got.Status.SourceFence.FencedAt == nil {
+		t.Fatalf("expected the source to be fenced first, got %+v", got.Status.SourceFence)
+	}
+	res := got.Status.OrdinalReservation
+	if res == nil || res.Ordinal != 2 || res.ReservedAt == nil || res.OriginalStart != nil {
+		t.Fatalf("expected ordinal 2 to be reserved, got %+v", res)
+	}
+	if got.Status.OriginalReplicas != 3 {
+		t.Errorf("expected original replicas 3, got %d", got.Status.OriginalReplicas)
+	}
+
+	updatedSts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp", Namespace: "default"}, updatedSts); err != nil {
+		t.Fatalf("failed to get statefulset: %v", err)
+	}
+	if *updatedSts.Spec.Replicas != 2 {
+		t.Errorf("expected StatefulSet scaled to 2, got %d", *updatedSts.Spec.Replicas)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-2", Namespace: "default"}, &corev1.Pod{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected the fenced source pod to be deleted, got %v", err)
+	}
+
+	// The name is free: the target pod is created under it, keeping the
+	// source's StatefulSet identity.
+	if _, err := reconcileOnce(r, ctx, "mig-reserve", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	target := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-2", Namespace: "default"}, target); err != nil {
+		t.Fatalf("expected target pod myapp-2: %v", err)
+	}
+	if target.Labels["migration.ms2m.io/migration"] != "mig-reserve" {
+		t.Errorf("expected the target to carry the migration label, got %v", target.Labels)
+	}
+	if target.Labels["app"] != "myapp" {
+		t.Errorf("expected the target to keep the Service labels, got %v", target.Labels)
+	}
+	if target.Spec.NodeName != "node-2" || target.Spec.Hostname != "myapp-2" || target.Spec.Subdomain != "myapp" {
+		t.Errorf("expected target on node-2 with the source's hostname, got node %q hostname %q subdomain %q",
+			target.Spec.NodeName, target.Spec.Hostname, target.Spec.Subdomain)
+	}
+
+	// Once the target is ready the freeze window is recorded.
+	target.Status.Phase = corev1.PodRunning
+	target.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	if err := r.Status().Update(ctx, target); err != nil {
+		t.Fatalf("failed to update target status: %v", err)
+	}
+	if _, err := reconcileOnce(r, ctx, "mig-reserve", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got = fetchMigration(r, ctx, "mig-reserve", "default")
+	if got.Status.TargetPod != "myapp-2" {
+		t.Errorf("expected target pod myapp-2, got %q", got.Status.TargetPod)
+	}
+	if got.Status.OrdinalReservation.FreezeWindow == "" {
+		t.Error("expected the freeze window to be recorded")
+	}
+}
+
+func TestReconcile_Restoring_ReserveOrdinal_LowestMovesStart(t *testing.T) {
+	sts, pod := reserveObjects("myapp-0")
+	migration := reserveMigration(pod, migrationv1alpha1.PhaseRestoring)
+
+	r, mockBroker, ctx := setupTest(migration, sts, pod)
+	mockBroker.Connected = true
+	mockBroker.SetQueueConsumers("orders", 0)
+
+	if _, err := reconcileOnce(r, ctx, "mig-reserve", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-reserve", "default")
+	res := got.Status.OrdinalReservation
+	if res == nil || res.OriginalStart == nil || *res.OriginalStart != 0 {
+		t.Fatalf("expected the original start to be recorded, got %+v", res)
+	}
+	updatedSts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp", Namespace: "default"}, updatedSts); err != nil {
+		t.Fatalf("failed to get statefulset: %v", err)
+	}
+	if *updatedSts.Spec.Replicas != 2 || updatedSts.Spec.Ordinals == nil || updatedSts.Spec.Ordinals.Start != 1 {
+		t.Errorf("expected 2 replicas starting at ordinal 1, got replicas %d ordinals %+v",
+			*updatedSts.Spec.Replicas, updatedSts.Spec.Ordinals)
+	}
+}
+
+func TestReconcile_Finalizing_ReserveOrdinal_ReleasesOrdinal(t *testing.T) {
+	sts, pod := reserveObjects("myapp-0")
+	two, one := int32(2), int32(1)
+	sts.Spec.Replicas = &two
+	sts.Spec.Ordinals = &appsv1.StatefulSetOrdinals{Start: one}
+
+	migration := reserveMigration(pod, migrationv1alpha1.PhaseFinalizing)
+	reserved := metav1.Now()
+	zero := int32(0)
+	migration.Status.TargetPod = "myapp-0"
+	migration.Status.OriginalReplicas = 3
+	migration.Status.OrdinalReservation = &migrationv1alpha1.OrdinalReservationStatus{
+		Ordinal:       0,
+		Method:        holdShiftStart,
+		OriginalStart: &zero,
+		ReservedAt:    &reserved,
+	}
+	target := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-0",
+			Namespace: "default",
+			Labels:    map[string]string{"app": "myapp", "migration.ms2m.io/migration": "mig-reserve"},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: migrationv1alpha1.GroupVersion.String(),
+				Kind:       "StatefulMigration",
+				Name:       "mig-reserve",
+				UID:        "mig-uid",
+			}},
+		},
+		Spec: corev1.PodSpec{NodeName: "node-2"},
+	}
+
+	r, mockBroker, ctx := setupTest(migration, sts, target)
+	mockBroker.Connected = true
+
+	if _, err := reconcileOnce(r, ctx, "mig-reserve", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-reserve", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseCompleted {
+		t.Fatalf("expected Completed, got %q", got.Status.Phase)
+	}
+	if got.Status.OrdinalReservation.ReleasedAt == nil {
+		t.Error("expected the ordinal release to be recorded")
+	}
+	if got.Status.SwapSubPhase != "" || got.Status.ReplacementPod != "" {
+		t.Errorf("expected no re-checkpoint swap, got subphase %q replacement %q",
+			got.Status.SwapSubPhase, got.Status.ReplacementPod)
+	}
+
+	updatedSts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp", Namespace: "default"}, updatedSts); err != nil {
+		t.Fatalf("failed to get statefulset: %v", err)
+	}
+	if *updatedSts.Spec.Replicas != 3 || updatedSts.Spec.Ordinals != nil {
+		t.Errorf("expected 3 replicas from ordinal 0, got replicas %d ordinals %+v",
+			*updatedSts.Spec.Replicas, updatedSts.Spec.Ordinals)
+	}
+
+	// The target holds the source's name and must survive Finalizing.
+	updatedTarget := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0", Namespace: "default"}, updatedTarget); err != nil {
+		t.Fatalf("expected the target pod to survive: %v", err)
+	}
+	if len(updatedTarget.OwnerReferences) != 0 {
+		t.Errorf("expected the StatefulMigration ownerRef to be removed, got %v", updatedTarget.OwnerReferences)
+	}
+}
+
+// sequentialHoldMigration returns a Sequential migration of pod in the given
+// phase, with the status handlePending would have recorded.
+func sequentialHoldMigration(pod *corev1.Pod, phase migrationv1alpha1.Phase) *migrationv1alpha1.StatefulMigration {
+	migration := reserveMigration(pod, phase)
+	migration.Name = "mig-hold"
+	migration.Spec.MigrationStrategy = "Sequential"
+	migration.Spec.IdentitySwapMode = ""
+	return migration
+}
+
+func TestReconcile_Restoring_Sequential_PausesMiddleOrdinal(t *testing.T) {
+	sts, pod := reserveObjects("myapp-1")
+	partition := int32(0)
+	sts.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{
+		Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: &partition},
+	}
+	migration := sequentialHoldMigration(pod, migrationv1alpha1.PhaseRestoring)
+
+	r, _, ctx := setupTest(migration, sts, pod)
+
+	if _, err := reconcileOnce(r, ctx, "mig-hold", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-hold", "default")
+	hold := got.Status.OrdinalReservation
+	if hold == nil || hold.Ordinal != 1 || hold.Method != holdPause || hold.ReservedAt == nil {
+		t.Fatalf("expected ordinal 1 paused, got %+v", hold)
+	}
+	if hold.OriginalUpdateStrategy == nil || hold.OriginalUpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+		t.Errorf("expected the RollingUpdate strategy to be recorded, got %+v", hold.OriginalUpdateStrategy)
+	}
+
+	// The other two ordinals keep running: replicas are untouched.
+	updatedSts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp", Namespace: "default"}, updatedSts); err != nil {
+		t.Fatalf("failed to get statefulset: %v", err)
+	}
+	if *updatedSts.Spec.Replicas != 3 {
+		t.Errorf("expected 3 replicas, got %d", *updatedSts.Spec.Replicas)
+	}
+	if updatedSts.Spec.UpdateStrategy.Type != appsv1.OnDeleteStatefulSetStrategyType {
+		t.Errorf("expected OnDelete updates while paused, got %q", updatedSts.Spec.UpdateStrategy.Type)
+	}
+	if !hasHoldGate(updatedSts.Spec.Template.Spec.SchedulingGates) {
+		t.Errorf("expected the hold gate on the template, got %v", updatedSts.Spec.Template.Spec.SchedulingGates)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-1", Namespace: "default"}, &corev1.Pod{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected the source pod to be deleted, got %v", err)
+	}
+
+	// The StatefulSet recreates the ordinal behind a scheduling gate; the
+	// placeholder is replaced by the target in the same pass.
+	placeholder := pod.DeepCopy()
+	placeholder.ResourceVersion = ""
+	placeholder.Spec.NodeName = ""
+	placeholder.Spec.SchedulingGates = []corev1.PodSchedulingGate{{Name: ordinalHoldGate}}
+	placeholder.Status = corev1.PodStatus{Phase: corev1.PodPending}
+	if err := r.Create(ctx, placeholder); err != nil {
+		t.Fatalf("failed to create placeholder: %v", err)
+	}
+	if _, err := reconcileOnce(r, ctx, "mig-hold", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	target := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-1", Namespace: "default"}, target); err != nil {
+		t.Fatalf("expected target pod myapp-1: %v", err)
+	}
+	if target.Labels["migration.ms2m.io/migration"] != "mig-hold" || heldPlaceholder(target) {
+		t.Errorf("expected the target in place of the placeholder, got labels %v gates %v",
+			target.Labels, target.Spec.SchedulingGates)
+	}
+}
+
+func TestReconcile_Restoring_Sequential_PausesWhenScaleDeletesClaims(t *testing.T) {
+	sts, pod := reserveObjects("myapp-2")
+	sts.Spec.PersistentVolumeClaimRetentionPolicy = &appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy{
+		WhenDeleted: appsv1.RetainPersistentVolumeClaimRetentionPolicyType,
+		WhenScaled:  appsv1.DeletePersistentVolumeClaimRetentionPolicyType,
+	}
+	migration := sequentialHoldMigration(pod, migrationv1alpha1.PhaseRestoring)
+
+	r, _, ctx := setupTest(migration, sts, pod)
+
+	if _, err := reconcileOnce(r, ctx, "mig-hold", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Scaling down would make the StatefulSet delete myapp-2's claims.
+	got := fetchMigration(r, ctx, "mig-hold", "default")
+	if hold := got.Status.OrdinalReservation; hold == nil || hold.Ordinal != 2 || hold.Method != holdPause {
+		t.Fatalf("expected the highest ordinal paused rather than scaled down, got %+v", hold)
+	}
+	updatedSts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp", Namespace: "default"}, updatedSts); err != nil {
+		t.Fatalf("failed to get statefulset: %v", err)
+	}
+	if *updatedSts.Spec.Replicas != 3 {
+		t.Errorf("expected replicas to stay at 3, got %d", *updatedSts.Spec.Replicas)
+	}
+}
+
+func TestReconcile_Finalizing_Sequential_ReleasesPausedOrdinal(t *testing.T) {
+	sts, pod := reserveObjects("myapp-1")
+	partition := int32(0)
+	original := appsv1.StatefulSetUpdateStrategy{
+		Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: &partition},
+	}
+	sts.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType}
+	sts.Spec.Template.Spec.SchedulingGates = []corev1.PodSchedulingGate{{Name: ordinalHoldGate}}
+	sts.Status.UpdateRevision = "myapp-7d9f"
+
+	migration := sequentialHoldMigration(pod, migrationv1alpha1.PhaseFinalizing)
+	reserved := metav1.Now()
+	migration.Status.TargetPod = "myapp-1"
+	migration.Status.OriginalReplicas = 3
+	migration.Status.OrdinalReservation = &migrationv1alpha1.OrdinalReservationStatus{
+		Ordinal:                1,
+		Method:                 holdPause,
+		OriginalUpdateStrategy: original.DeepCopy(),
+		ReservedAt:             &reserved,
+	}
+	target := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-1",
+			Namespace: "default",
+			Labels: map[string]string{
+				"app":                         "myapp",
+				"controller-revision-hash":    "myapp-gated",
+				"migration.ms2m.io/migration": "mig-hold",
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(migration, migrationv1alpha1.GroupVersion.WithKind("StatefulMigration")),
+			},
+		},
+		Spec:   corev1.PodSpec{NodeName: "node-2"},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+
+	r, mockBroker, ctx := setupTest(migration, sts, target)
+	mockBroker.Connected = true
+
+	// The gate comes off first; the StatefulSet has to observe the restored
+	// template before the pod is relabelled.
+	if _, err := reconcileOnce(r, ctx, "mig-hold", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-hold", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFinalizing || got.Status.OrdinalReservation.ReleasedAt != nil {
+		t.Fatalf("expected the release to wait after removing the gate, got phase %q hold %+v",
+			got.Status.Phase, got.Status.OrdinalReservation)
+	}
+	updatedSts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp", Namespace: "default"}, updatedSts); err != nil {
+		t.Fatalf("failed to get statefulset: %v", err)
+	}
+	if len(updatedSts.Spec.Template.Spec.SchedulingGates) != 0 {
+		t.Errorf("expected the hold gate removed, got %v", updatedSts.Spec.Template.Spec.SchedulingGates)
+	}
+
+	if _, err := reconcileOnce(r, ctx, "mig-hold", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got = fetchMigration(r, ctx, "mig-hold", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseCompleted {
+		t.Fatalf("expected Completed, got %q", got.Status.Phase)
+	}
+	if got.Status.OrdinalReservation.ReleasedAt == nil {
+		t.Error("expected the ordinal release to be recorded")
+	}
+
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp", Namespace: "default"}, updatedSts); err != nil {
+		t.Fatalf("failed to get statefulset: %v", err)
+	}
+	if *updatedSts.Spec.Replicas != 3 {
+		t.Errorf("expected 3 replicas, got %d", *updatedSts.Spec.Replicas)
+	}
+	if !equality.Semantic.DeepEqual(updatedSts.Spec.UpdateStrategy, original) {
+		t.Errorf("expected the original update strategy restored, got %+v", updatedSts.Spec.UpdateStrategy)
+	}
+
+	updatedTarget := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-1", Namespace: "default"}, updatedTarget); err != nil {
+		t.Fatalf("expected the target pod to survive: %v", err)
+	}
+	if rev := updatedTarget.Labels["controller-revision-hash"]; rev != "myapp-7d9f" {
+		t.Errorf("expected the target relabelled to the update revision, got %q", rev)
+	}
+	if ref := metav1.GetControllerOf(updatedTarget); ref != nil {
+		t.Errorf("expected the StatefulMigration ownerRef to be removed, got %v", ref)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// StatefulSet placement tests
+// ---------------------------------------------------------------------------
+
+// pinnedTemplateObjects returns a StatefulSet whose template selects nodes
+// by disk type, a swap migration for myapp-1 targeting node-2, and the
+// replacement pod on node-2 carrying the pre-swap revision.
+func pinnedTemplateObjects() (*appsv1.StatefulSet, *migrationv1alpha1.StatefulMigration, *corev1.Pod) {
+	sts, pod := reserveObjects("myapp-1")
+	sts.Spec.Template.Spec.NodeSelector = map[string]string{"disk": "ssd"}
+	sts.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{Type: appsv1.RollingUpdateStatefulSetStrategyType}
+	sts.Status.UpdateRevision = "myapp-settled"
+
+	migration := reserveMigration(pod, migrationv1alpha1.PhaseFinalizing)
+	migration.Name = "mig-placement"
+	migration.Spec.IdentitySwapMode = "Cutoff"
+
+	replacement := pod.DeepCopy()
+	replacement.OwnerReferences = nil
+	replacement.Labels["controller-revision-hash"] = "myapp-old"
+	replacement.Spec.NodeName = "node-2"
+	return sts, migration, replacement
+}
+
+func TestReconcile_Pending_InvalidStatefulSetPlacement(t *testing.T) {
+	migration := newMigration("mig-bad-sts-placement", migrationv1alpha1.PhasePending)
+	migration.Spec.StatefulSetPlacement = "Always"
+
+	r, _, ctx := setupTest(migration)
+
+	if _, err := reconcileOnce(r, ctx, "mig-bad-sts-placement", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-bad-sts-placement", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Errorf("expected Failed, got %q", got.Status.Phase)
+	}
+}
+
+func TestPinTemplate_RecordsOriginalAndSetsOnDelete(t *testing.T) {
+	sts, migration, _ := pinnedTemplateObjects()
+	sts.Spec.Template.Spec.NodeSelector[hostnameLabel] = "node-1"
+
+	r, _, ctx := setupTest(migration, sts)
+	m := fetchMigration(r, ctx, "mig-placement", "default")
+
+	if err := r.pinTemplate(ctx, m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// A second call is a no-op and keeps the first recording.
+	if err := r.pinTemplate(ctx, m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-placement", "default")
+	tmpl := got.Status.StatefulSetTemplate
+	if tmpl == nil || len(tmpl.Mutations) != 1 {
+		t.Fatalf("expected one recorded mutation, got %+v", tmpl)
+	}
+	want := migrationv1alpha1.TemplateMutationStatus{Field: templateHostnameField, Original: "node-1", Applied: "node-2"}
+	if tmpl.Mutations[0] != want {
+		t.Errorf("expected mutation %+v, got %+v", want, tmpl.Mutations[0])
+	}
+	if tmpl.OriginalUpdateStrategy == nil || tmpl.OriginalUpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+		t.Errorf("expected the RollingUpdate strategy to be recorded, got %+v", tmpl.OriginalUpdateStrategy)
+	}
+
+	updatedSts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp", Namespace: "default"}, updatedSts); err != nil {
+		t.Fatalf("failed to get statefulset: %v", err)
+	}
+	if got := updatedSts.Spec.Template.Spec.NodeSelector[hostnameLabel]; got != "node-2" {
+		t.Errorf("expected the template pinned to node-2, got %q", got)
+	}
+	if updatedSts.Spec.Template.Spec.NodeSelector["disk"] != "ssd" {
+		t.Errorf("expected the user's nodeSelector kept, got %v", updatedSts.Spec.Template.Spec.NodeSelector)
+	}
+	if updatedSts.Spec.UpdateStrategy.Type != appsv1.OnDeleteStatefulSetStrategyType {
+		t.Errorf("expected OnDelete while pinned, got %q", updatedSts.Spec.UpdateStrategy.Type)
+	}
+}
+
+func TestSettleTemplate_Placements(t *testing.T) {
+	tests := []struct {
+		placement     string
+		wantSelector  map[string]string
+		wantPreferred bool
+	}{
+		{"", map[string]string{"disk": "ssd"}, false},
+		{placementPreferred, map[string]string{"disk": "ssd"}, true},
+		{placementRequired, map[string]string{"disk": "ssd", hostnameLabel: "node-2"}, false},
+	}
+	for _, tt := range tests {
+		t.Run("placement="+tt.placement, func(t *testing.T) {
+			sts, migration, replacement := pinnedTemplateObjects()
+			original := sts.Spec.Template.DeepCopy()
+			migration.Spec.StatefulSetPlacement = tt.placement
+
+			r, _, ctx := setupTest(migration, sts, replacement)
+			m := fetchMigration(r, ctx, "mig-placement", "default")
+			if err := r.pinTemplate(ctx, m); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			done := false
+			for i := 0; i < 5 && !done; i++ {
+				var err error
+				if _, done, err = r.settleTemplate(ctx, m, "myapp-1"); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			if !done {
+				t.Fatal("expected the template to settle")
+			}
+
+			got := fetchMigration(r, ctx, "mig-placement", "default")
+			wantPlacement := tt.placement
+			if wantPlacement == "" {
+				wantPlacement = placementNone
+			}
+			if tmpl := got.Status.StatefulSetTemplate; tmpl.SettledAt == nil || tmpl.Placement != wantPlacement {
+				t.Errorf("expected settled with %q, got %+v", wantPlacement, tmpl)
+			}
+
+			updatedSts := &appsv1.StatefulSet{}
+			if err := r.Get(ctx, types.NamespacedName{Name: "myapp", Namespace: "default"}, updatedSts); err != nil {
+				t.Fatalf("failed to get statefulset: %v", err)
+			}
+			if !equality.Semantic.DeepEqual(updatedSts.Spec.Template.Spec.NodeSelector, tt.wantSelector) {
+				t.Errorf("expected nodeSelector %v, got %v", tt.wantSelector, updatedSts.Spec.Template.Spec.NodeSelector)
+			}
+			affinity := updatedSts.Spec.Template.Spec.Affinity
+			hasPreferred := affinity != nil && affinity.NodeAffinity != nil &&
+				len(affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution) > 0
+			if hasPreferred != tt.wantPreferred {
+				t.Errorf("expected preferred affinity %v, got %+v", tt.wantPreferred, affinity)
+			}
+			if tt.placement == "" && !equality.Semantic.DeepEqual(updatedSts.Spec.Template, *original) {
+				t.Errorf("expected the template reverted exactly, got %+v", updatedSts.Spec.Template)
+			}
+			if updatedSts.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+				t.Errorf("expected the original update strategy restored, got %q", updatedSts.Spec.UpdateStrategy.Type)
+			}
+
+			updatedPod := &corev1.Pod{}
+			if err := r.Get(ctx, types.NamespacedName{Name: "myapp-1", Namespace: "default"}, updatedPod); err != nil {
+				t.Fatalf("expected the replacement pod to survive: %v", err)
+			}
+			if rev := updatedPod.Labels["controller-revision-hash"]; rev != "myapp-settled" {
+				t.Errorf("expected the pod relabelled to the update revision, got %q", rev)
+			}
+		})
+	}
+}
+
+func TestRevertTemplate_RestoresTemplateAndStrategy(t *testing.T) {
+	sts, migration, _ := pinnedTemplateObjects()
+	original := sts.Spec.DeepCopy()
+
+	r, _, ctx := setupTest(migration, sts)
+	m := fetchMigration(r, ctx, "mig-placement", "default")
+	if err := r.pinTemplate(ctx, m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !r.revertTemplate(ctx, m) {
+		t.Fatal("expected the StatefulSet to be reverted")
+	}
+	if r.revertTemplate(ctx, m) {
+		t.Error("expected a second revert to change nothing")
+	}
+
+	updatedSts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp", Namespace: "default"}, updatedSts); err != nil {
+		t.Fatalf("failed to get statefulset: %v", err)
+	}
+	if !equality.Semantic.DeepEqual(updatedSts.Spec, *original) {
+		t.Errorf("expected the StatefulSet spec restored, got %+v", updatedSts.Spec)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Strategy tests
+// ---------------------------------------------------------------------------
+
+// blueGreenStrategy is a minimal custom strategy: the target is restored as
+// <source>-green and the source is left alone. Each hook call is counted.
+type blueGreenStrategy struct {
+	restores, finalizes, rollbacks *int
+}
+
+func (blueGreenStrategy) Capabilities(*migrationv1alpha1.StatefulMigration) Capabilities {
+	return Capabilities{SourceRunsAlongside: true, Volumes: VolumesShared}
+}
+
+func (blueGreenStrategy) Validate(context.Context, *StatefulMigrationReconciler, *migrationv1alpha1.StatefulMigration, *corev1.Pod) error {
+	return nil
+}
+
+func (blueGreenStrategy) PredictFinalization(*migrationv1alpha1.StatefulMigration, string) (string, string) {
+	return "None", "None"
+}
+
+func (blueGreenStrategy) TargetPodName(m *migrationv1alpha1.StatefulMigration) string {
+	return m.Spec.SourcePod + "-green"
+}
+
+func (s blueGreenStrategy) Restore(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration) (ctrl.Result, *corev1.Pod, error) {
+	*s.restores++
+	pod, err := r.LookupTarget(ctx, m, s.TargetPodName(m))
+	if err != nil || pod == nil {
+		return ctrl.Result{}, nil, err
+	}
+	return r.RunningTarget(ctx, m, pod)
+}
+
+func (s blueGreenStrategy) Finalize(context.Context, *StatefulMigrationReconciler, *migrationv1alpha1.StatefulMigration, client.Object) (ctrl.Result, bool, error) {
+	*s.finalizes++
+	return ctrl.Result{}, true, nil
+}
+
+func (s blueGreenStrategy) Rollback(_ context.Context, _ *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, record func(string, ...interface{})) {
+	*s.rollbacks++
+	record("kept %s serving", m.Spec.SourcePod)
+}
+
+// registerBlueGreen registers a blueGreenStrategy for the duration of t.
+func registerBlueGreen(t *testing.T) blueGreenStrategy {
+	t.Helper()
+	s := blueGreenStrategy{restores: new(int), finalizes: new(int), rollbacks: new(int)}
+	RegisterStrategy("BlueGreenService", s)
+	t.Cleanup(func() {
+		strategiesMu.Lock()
+		delete(strategies, "BlueGreenService")
+		strategiesMu.Unlock()
+	})
+	return s
+}
+
+// recreateStrategy is a blueGreenStrategy that deletes the source first and
+// moves its volumes, as Sequential does.
+type recreateStrategy struct {
+	blueGreenStrategy
+}
+
+func (recreateStrategy) Capabilities(*migrationv1alpha1.StatefulMigration) Capabilities {
+	return Capabilities{DeletesSource: true, Volumes: VolumesMoved}
+}
+
+func TestStrategyCapabilities_CustomStrategy(t *testing.T) {
+	RegisterStrategy("Recreate", recreateStrategy{})
+	t.Cleanup(func() {
+		strategiesMu.Lock()
+		delete(strategies, "Recreate")
+		strategiesMu.Unlock()
+	})
+
+	m := newMigration("mig-recreate", migrationv1alpha1.PhaseReplaying)
+	m.Spec.MigrationStrategy = "Recreate"
+	if needsSourceFence(m) {
+		t.Error("expected no source fence for a strategy that deletes the source")
+	}
+	if labelFlipEnabled(m) {
+		t.Error("expected no label flip for a strategy that does not share Services")
+	}
+	if !unownedSourceDeleted(m) {
+		t.Error("expected a standalone source to count as deleted in Replaying")
+	}
+	volumes := []migrationv1alpha1.VolumeStatus{{Name: "data", ClaimName: "data-myapp-0", Handling: volumeAttachable}}
+	if err := checkVolumeHandling("Recreate", strategyCapabilities(m), volumes); err != nil {
+		t.Errorf("expected moved volumes to be accepted, got %v", err)
+	}
+
+	m.Spec.MigrationStrategy = "BlueGreenService"
+	registerBlueGreen(t)
+	if !needsSourceFence(m) {
+		t.Error("expected a source fence for a strategy that runs the source alongside")
+	}
+	if unownedSourceDeleted(m) {
+		t.Error("expected the source of a strategy that keeps it to count as running")
+	}
+}
+
+func TestRegisterStrategy_PanicsOnDuplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected registering ShadowPod again to panic")
+		}
+	}()
+	RegisterStrategy(strategyShadowPod, shadowPodStrategy{})
+}
+
+func TestStrategy_TargetPodName(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy Strategy
+		swapMode string
+		want     string
+	}{
+		{"shadow", shadowPodStrategy{}, "", "myapp-0-shadow"},
+		{"shadow swap", shadowPodStrategy{}, "ExchangeFence", "myapp-0-shadow"},
+		{"reserve ordinal", shadowPodStrategy{}, swapReserveOrdinal, "myapp-0"},
+		{"sequential", sequentialStrategy{}, "", "myapp-0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMigration("mig", migrationv1alpha1.PhaseRestoring)
+			m.Spec.MigrationStrategy = strategyShadowPod
+			if _, ok := tt.strategy.(sequentialStrategy); ok {
+				m.Spec.MigrationStrategy = strategySequential
+			}
+			m.Spec.IdentitySwapMode = tt.swapMode
+			m.Status.StatefulSetName = "myapp"
+			if got := tt.strategy.TargetPodName(m); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestReconcile_Pending_UnknownStrategy(t *testing.T) {
+	sourcePod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-0", Namespace: "default"},
+		Spec: corev1.PodSpec{
+			NodeName:   "node-1",
+			Containers: []corev1.Container{{Name: "app", Image: "myapp:latest"}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	migration := newMigration("mig-unknown-strategy", migrationv1alpha1.PhasePending)
+	migration.Spec.MigrationStrategy = "BlueGreenService"
+
+	r, _, ctx := setupTest(migration, sourcePod)
+
+	if _, err := reconcileOnce(r, ctx, "mig-unknown-strategy", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-unknown-strategy", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Fatalf("expected Failed, got %q", got.Status.Phase)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, "Failed")
+	if cond != nil && !strings.Contains(cond.Message, "not registered") {
+		t.Errorf("expected the failure to name the unregistered strategy, got %q", cond.Message)
+	}
+}
+
+func TestReconcile_CustomStrategy_RestoreAndFinalize(t *testing.T) {
+	s := registerBlueGreen(t)
+
+	green := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-0-green",
+			Namespace: "default",
+			Labels:    map[string]string{"migration.ms2m.io/migration": "mig-green"},
+		},
+		Spec:   corev1.PodSpec{NodeName: "node-2"},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	source := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-0", Namespace: "default"},
+		Spec:       corev1.PodSpec{NodeName: "node-1"},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	migration := newMigration("mig-green", migrationv1alpha1.PhaseRestoring)
+	migration.Spec.MigrationStrategy = "BlueGreenService"
+	migration.Spec.RestoreReadiness = &migrationv1alpha1.RestoreReadiness{Type: "Running"}
+	migration.Status.SourceNode = "node-1"
+	migration.Status.ContainerName = "app"
+	migration.Status.PhaseTimings = map[string]string{}
+
+	r, mockBroker, ctx := setupTest(migration, green, source)
+	mockBroker.Connected = true
+
+	// Restoring -> Replaying -> Finalizing -> Completed with the auto-acking
+	// mock broker.
+	for i := 0; i < 5; i++ {
+		if _, err := reconcileOnce(r, ctx, "mig-green", "default"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if fetchMigration(r, ctx, "mig-green", "default").Status.Phase == migrationv1alpha1.PhaseCompleted {
+			break
+		}
+	}
+
+	got := fetchMigration(r, ctx, "mig-green", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseCompleted {
+		t.Fatalf("expected Completed, got %q", got.Status.Phase)
+	}
+	if got.Status.TargetPod != "myapp-0-green" {
+		t.Errorf("expected target pod myapp-0-green, got %q", got.Status.TargetPod)
+	}
+	if *s.restores == 0 || *s.finalizes == 0 {
+		t.Errorf("expected Restore and Finalize to be called, got %d and %d", *s.restores, *s.finalizes)
+	}
+
+	// The strategy left the source alone.
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0", Namespace: "default"}, &corev1.Pod{}); err != nil {
+		t.Errorf("expected the source pod to be kept: %v", err)
+	}
+}
+
+func TestReconcile_CustomStrategy_Rollback(t *testing.T) {
+	s := registerBlueGreen(t)
+
+	migration := newMigration("mig-green", migrationv1alpha1.PhaseRestoring)
+	migration.Spec.MigrationStrategy = "BlueGreenService"
+	migration.Spec.Abort = true
+	migration.Status.SourceNode = "node-1"
+	migration.Status.PhaseTimings = map[string]string{}
+
+	r, _, ctx := setupTest(migration)
+
+	if _, err := reconcileOnce(r, ctx, "mig-green", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-green", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseAborted {
+		t.Fatalf("expected Aborted, got %q", got.Status.Phase)
+	}
+	if *s.rollbacks != 1 {
+		t.Errorf("expected Rollback to be called once, got %d", *s.rollbacks)
+	}
+	found := false
+	for _, step := range got.Status.UndoneSteps {
+		if step == "kept myapp-0 serving" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected the strategy's step to be recorded, got %v", got.Status.UndoneSteps)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Checkpoint backend tests
+// ---------------------------------------------------------------------------
+
+// fakeCheckpointer records checkpoint calls and returns path or err.
+type fakeCheckpointer struct {
+	path  string
+	err   error
+	nodes []string
+	opts  []checkpoint.Options
+}
+
+func (f *fakeCheckpointer) Checkpoint(_ context.Context, nodeName, _, _, _ string, opts checkpoint.Options) (string, error) {
+	f.nodes = append(f.nodes, nodeName)
+	f.opts = append(f.opts, opts)
+	return f.path, f.err
+}
+
+func TestNodeCheckpointBackend(t *testing.T) {
+	tests := []struct {
+		name    string
+		label   string
+		runtime string
+		want    string
+		wantErr bool
+	}{
+		{"cri-o", "", "cri-o://1.30.0", backendKubelet, false},
+		{"containerd", "", "containerd://2.0.0", backendAgent, false},
+		{"label overrides runtime", backendKubelet, "containerd://2.0.0", backendKubelet, false},
+		{"label on cri-o", backendAgent, "cri-o://1.30.0", backendAgent, false},
+		{"invalid label", "Crictl", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+			if tt.label != "" {
+				node.Labels = map[string]string{checkpointBackendLabel: tt.label}
+			}
+			node.Status.NodeInfo.ContainerRuntimeVersion = tt.runtime
+			got, err := nodeCheckpointBackend(node)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("nodeCheckpointBackend() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("nodeCheckpointBackend() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcile_Checkpointing_AgentBackend(t *testing.T) {
+	migration := newMigration("mig-ck-agent", migrationv1alpha1.PhaseCheckpointing)
+	migration.Status.SourceNode = "node-1"
+	migration.Status.ContainerName = "app"
+	migration.Status.PhaseTimings = map[string]string{}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	node.Status.NodeInfo.ContainerRuntimeVersion = "containerd://2.0.0"
+
+	r, _, ctx := setupTest(migration, node)
+	cp := &fakeCheckpointer{path: "/var/lib/ms2m/checkpoints/checkpoint-myapp-0.tar"}
+	r.AgentCheckpointer = cp
+
+	if _, err := reconcileOnce(r, ctx, "mig-ck-agent", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-ck-agent", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseTransferring {
+		t.Fatalf("expected Transferring, got %q", got.Status.Phase)
+	}
+	if got.Status.CheckpointID != cp.path {
+		t.Errorf("expected checkpoint path %q, got %q", cp.path, got.Status.CheckpointID)
+	}
+	if got.Status.CheckpointBackend != backendAgent {
+		t.Errorf("expected backend Agent, got %q", got.Status.CheckpointBackend)
+	}
+	if len(cp.nodes) != 1 || cp.nodes[0] != "node-1" {
+		t.Errorf("expected one checkpoint on node-1, got %v", cp.nodes)
+	}
+}
+
+func TestReconcile_Checkpointing_AgentUnsupported(t *testing.T) {
+	migration := newMigration("mig-ck-501", migrationv1alpha1.PhaseCheckpointing)
+	migration.Status.SourceNode = "node-1"
+	migration.Status.ContainerName = "app"
+	migration.Status.PhaseTimings = map[string]string{}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "node-1",
+		Labels: map[string]string{checkpointBackendLabel: backendAgent},
+	}}
+
+	r, _, ctx := setupTest(migration, node)
+	r.AgentCheckpointer = &fakeCheckpointer{
+		err: retry.MarkPermanent(fmt.Errorf("agent returned 501: rpc error: code = Unimplemented")),
+	}
+
+	if _, err := reconcileOnce(r, ctx, "mig-ck-501", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-ck-501", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Errorf("expected Failed when the runtime cannot checkpoint, got %q", got.Status.Phase)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, "Failed")
+	if cond == nil || !strings.Contains(cond.Message, "agent checkpoint") {
+		t.Errorf("expected the failure to name the agent backend, got %+v", cond)
+	}
+}
+
+func TestReconcile_Transferring_DirectMode_AgentCheckpointMounted(t *testing.T) {
+	migration := newMigration("mig-direct-agent", migrationv1alpha1.PhaseTransferring)
+	migration.Spec.TransferMode = "Direct"
+	migration.Status.SourceNode = "node-1"
+	migration.Status.CheckpointID = agentCheckpointDir + "/checkpoint-myapp-0_default-app.tar"
+	migration.Status.CheckpointBackend = backendAgent
+	migration.Status.ContainerName = "app"
+	migration.Status.PhaseTimings = map[string]string{}
+
+	r, _, ctx := setupTest(migration)
+
+	if _, err := reconcileOnce(r, ctx, "mig-direct-agent", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	job := &batchv1.Job{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "mig-direct-agent-transfer", Namespace: "default"}, job); err != nil {
+		t.Fatalf("expected transfer job to be created: %v", err)
+	}
+	mounted := false
+	for _, vm := range job.Spec.Template.Spec.Containers[0].VolumeMounts {
+		if vm.MountPath == agentCheckpointDir {
+			mounted = true
+		}
+	}
+	if !mounted {
+		t.Errorf("expected %s to be mounted for an Agent checkpoint", agentCheckpointDir)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Checkpoint options tests
+// ---------------------------------------------------------------------------
+
+func TestReconcile_Pending_NegativeCheckpointTimeout(t *testing.T) {
+	migration := newMigration("mig-ckopt", migrationv1alpha1.PhasePending)
+	migration.Spec.CheckpointOptions = &migrationv1alpha1.CheckpointOptions{TimeoutSeconds: -1}
+
+	r, _, ctx := setupTest(migration)
+
+	if _, err := reconcileOnce(r, ctx, "mig-ckopt", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-ckopt", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Errorf("expected Failed for a negative checkpoint timeout, got %q", got.Status.Phase)
+	}
+}
+
+func TestReconcile_Checkpointing_PassesCheckpointTimeout(t *testing.T) {
+	migration := newMigration("mig-ck-timeout", migrationv1alpha1.PhaseCheckpointing)
+	migration.Spec.CheckpointOptions = &migrationv1alpha1.CheckpointOptions{TimeoutSeconds: 90}
+	migration.Status.SourceNode = "node-1"
+	migration.Status.ContainerName = "app"
+	migration.Status.PhaseTimings = map[string]string{}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	node.Status.NodeInfo.ContainerRuntimeVersion = "containerd://2.0.0"
+
+	r, _, ctx := setupTest(migration, node)
+	cp := &fakeCheckpointer{path: "/var/lib/ms2m/checkpoints/checkpoint-myapp-0.tar"}
+	r.AgentCheckpointer = cp
+
+	if _, err := reconcileOnce(r, ctx, "mig-ck-timeout", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cp.opts) != 1 {
+		t.Fatalf("expected one agent checkpoint, got %d", len(cp.opts))
+	}
+	if want := (checkpoint.Options{Timeout: 90 * time.Second}); cp.opts[0] != want {
+		t.Errorf("expected options %+v, got %+v", want, cp.opts[0])
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Checkpoint inspection
+// ---------------------------------------------------------------------------
+
+// fakeInspector returns canned inspection results per node.
+type fakeInspector struct {
+	ins      *checkpoint.Inspection
+	source   checkpoint.NodeInfo
+	nodes    map[string]checkpoint.NodeInfo
+	inspects int
+	err      error
+}
+
+func (f *fakeInspector) Inspect(_ context.Context, _, _ string) (*checkpoint.Inspection, *checkpoint.NodeInfo, error) {
+	f.inspects++
+	if f.err != nil {
+		return nil, nil, f.err
+	}
+	source := f.source
+	return f.ins, &source, nil
+}
+
+func (f *fakeInspector) NodeInfo(_ context.Context, nodeName string) (*checkpoint.NodeInfo, error) {
+	info, ok := f.nodes[nodeName]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", checkpoint.ErrNoAgent, nodeName)
+	}
+	return &info, nil
+}
+
+func inspectionMigration(name string) *migrationv1alpha1.StatefulMigration {
+	migration := newMigration(name, migrationv1alpha1.PhaseTransferring)
+	migration.Status.SourceNode = "node-1"
+	migration.Status.CheckpointID = "/var/lib/kubelet/checkpoints/checkpoint-myapp-0.tar"
+	migration.Status.PhaseTimings = map[string]string{}
+	return migration
+}
+
+func TestReconcile_Transferring_InspectionCompatible(t *testing.T) {
+	migration := inspectionMigration("mig-inspect")
+	r, _, ctx := setupTest(migration)
+	insp := &fakeInspector{
+		ins:    &checkpoint.Inspection{Image: "myapp:1", Runtime: "crun", CRIUVersion: "3.19", RootfsDiffBytes: 2048, DeletedFiles: 1},
+		source: checkpoint.NodeInfo{Kernel: "6.8.0", Architecture: "amd64", CPUFlags: []string{"sse4_2", "avx2"}},
+		nodes: map[string]checkpoint.NodeInfo{"node-2": {
+			Kernel: "6.8.0", Architecture: "amd64", CPUFlags: []string{"avx2", "sse4_2", "avx512f"},
+			Runtimes: map[string]string{"crun": "1.21"}, CRIUVersion: "4.0",
+		}},
+	}
+	r.Inspector = insp
+
+	if _, err := reconcileOnce(r, ctx, "mig-inspect", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := reconcileOnce(r, ctx, "mig-inspect", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-inspect", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseTransferring {
+		t.Fatalf("expected to stay in Transferring, got %q", got.Status.Phase)
+	}
+	s := got.Status.CheckpointInspection
+	if s == nil || s.InspectedAt == nil {
+		t.Fatal("expected status.checkpointInspection to be recorded")
+	}
+	if s.Image != "myapp:1" || s.Runtime != "crun" || s.CRIUVersion != "3.19" || s.RootfsDiffBytes != 2048 || s.DeletedFiles != 1 {
+		t.Errorf("unexpected checkpoint details %+v", s)
+	}
+	if s.TargetRuntimeVersion != "1.21" || s.TargetCRIUVersion != "4.0" || s.SourceKernel != "6.8.0" {
+		t.Errorf("unexpected node details %+v", s)
+	}
+	if len(s.Problems) != 0 {
+		t.Errorf("expected no problems, got %v", s.Problems)
+	}
+	if insp.inspects != 1 {
+		t.Errorf("expected the checkpoint to be inspected once, got %d", insp.inspects)
+	}
+	job := &batchv1.Job{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "mig-inspect-transfer", Namespace: "default"}, job); err != nil {
+		t.Fatalf("expected transfer job to be created: %v", err)
+	}
+}
+
+func TestReconcile_Transferring_InspectionIncompatible(t *testing.T) {
+	migration := inspectionMigration("mig-inspect-bad")
+	target := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-2"},
+		Status:     corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{KernelVersion: "5.15.0", Architecture: "amd64"}},
+	}
+	r, _, ctx := setupTest(migration, target)
+	r.Inspector = &fakeInspector{
+		ins:    &checkpoint.Inspection{Runtime: "crun", CRIUVersion: "3.19"},
+		source: checkpoint.NodeInfo{Kernel: "6.8.0", Architecture: "amd64"},
+		nodes: map[string]checkpoint.NodeInfo{"node-2": {
+			Runtimes: map[string]string{"runc": "1.1.12"}, CRIUVersion: "3.17",
+		}},
+	}
+
+	if _, err := reconcileOnce(r, ctx, "mig-inspect-bad", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-inspect-bad", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Fatalf("expected phase Failed, got %q", got.Status.Phase)
+	}
+	s := got.Status.CheckpointInspection
+	if s == nil || len(s.Problems) != 3 {
+		t.Fatalf("expected kernel, runtime and CRIU problems, got %+v", s)
+	}
+	if s.TargetKernel != "5.15.0" {
+		t.Errorf("expected the target kernel from the Node object, got %q", s.TargetKernel)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, "Failed")
+	if cond == nil || !strings.Contains(cond.Message, "cannot be restored on node node-2") {
+		t.Errorf("expected an incompatibility failure, got %+v", cond)
+	}
+	job := &batchv1.Job{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "mig-inspect-bad-transfer", Namespace: "default"}, job); !errors.IsNotFound(err) {
+		t.Errorf("expected no transfer job, got err=%v", err)
+	}
+}
+
+func TestReconcile_Transferring_InspectionSkippedWithoutAgent(t *testing.T) {
+	migration := inspectionMigration("mig-inspect-skip")
+	r, _, ctx := setupTest(migration)
+
+	if _, err := reconcileOnce(r, ctx, "mig-inspect-skip", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-inspect-skip", "default")
+	s := got.Status.CheckpointInspection
+	if s == nil || s.SkippedReason != "no ms2m-agent on source node node-1" {
+		t.Fatalf("expected inspection to be skipped, got %+v", s)
+	}
+	if got.Status.Phase != migrationv1alpha1.PhaseTransferring {
+		t.Errorf("expected to proceed with the transfer, got %q", got.Status.Phase)
+	}
+}
+
+func TestReconcile_Transferring_InspectionErrorRetries(t *testing.T) {
+	migration := inspectionMigration("mig-inspect-retry")
+	r, _, ctx := setupTest(migration)
+	r.Inspector = &fakeInspector{err: retry.MarkTransient(fmt.Errorf("agent returned 503: busy"))}
+
+	result, err := reconcileOnce(r, ctx, "mig-inspect-retry", "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Error("expected a retry backoff")
+	}
+	got := fetchMigration(r, ctx, "mig-inspect-retry", "default")
+	if got.Status.CheckpointInspection != nil {
+		t.Errorf("expected no inspection recorded, got %+v", got.Status.CheckpointInspection)
+	}
+	if got.Status.RetryAttempts["checkpoint inspection"] != 1 {
+		t.Errorf("expected one retry attempt, got %v", got.Status.RetryAttempts)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Cross-cluster migration
+// ---------------------------------------------------------------------------
+
+// crossClusterMigration returns a migration restoring into namespace "apps"
+// of the cluster whose kubeconfig is in Secret "cluster-b", with that Secret.
+func crossClusterMigration(name string, phase migrationv1alpha1.Phase) (*migrationv1alpha1.StatefulMigration, *corev1.Secret) {
+	migration := newMigration(name, phase)
+	migration.Spec.MigrationStrategy = "CrossCluster"
+	migration.Spec.TargetCluster = &migrationv1alpha1.TargetCluster{
+		KubeconfigSecretRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "cluster-b"},
+			Key:                  "kubeconfig",
+		},
+		Namespace: "apps",
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-b", Namespace: "default"},
+		Data:       map[string][]byte{"kubeconfig": []byte("kubeconfig-b")},
+	}
+	return migration, secret
+}
+
+// withRemoteCluster points r's target clusters at a fake client seeded with
+// objs and returns it with a counter of the clients built.
+func withRemoteCluster(t *testing.T, r *StatefulMigrationReconciler, objs ...client.Object) (client.Client, *int) {
+	t.Helper()
+	remote := fake.NewClientBuilder().WithScheme(testScheme()).WithObjects(objs...).Build()
+	built := 0
+	r.TargetClient = func(kubeconfig []byte) (client.Client, error) {
+		built++
+		if string(kubeconfig) != "kubeconfig-b" {
+			return nil, fmt.Errorf("unexpected kubeconfig %q", kubeconfig)
+		}
+		return remote, nil
+	}
+	return remote, &built
+}
+
+func TestValidateTargetCluster(t *testing.T) {
+	ref := &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "cluster-b"}, Key: "kubeconfig"}
+	tests := []struct {
+		name    string
+		mutate  func(m *migrationv1alpha1.StatefulMigration)
+		wantErr string
+	}{
+		{"no target cluster", func(m *migrationv1alpha1.StatefulMigration) {}, ""},
+		{"other cluster", func(m *migrationv1alpha1.StatefulMigration) {
+			m.Spec.TargetCluster = &migrationv1alpha1.TargetCluster{KubeconfigSecretRef: ref}
+		}, ""},
+		{"other namespace", func(m *migrationv1alpha1.StatefulMigration) {
+			m.Spec.TargetCluster = &migrationv1alpha1.TargetCluster{Namespace: "apps"}
+		}, ""},
+		{"same namespace", func(m *migrationv1alpha1.StatefulMigration) {
+			m.Spec.TargetCluster = &migrationv1alpha1.TargetCluster{Namespace: "default"}
+		}, "kubeconfigSecretRef or a namespace"},
+		{"strategy without target cluster", func(m *migrationv1alpha1.StatefulMigration) {
+			m.Spec.MigrationStrategy = "CrossCluster"
+		}, "needs spec.targetCluster"},
+		{"other strategy", func(m *migrationv1alpha1.StatefulMigration) {
+			m.Spec.TargetCluster = &migrationv1alpha1.TargetCluster{KubeconfigSecretRef: ref}
+			m.Spec.MigrationStrategy = "Sequential"
+		}, "CrossCluster strategy"},
+		{"secret without key", func(m *migrationv1alpha1.StatefulMigration) {
+			m.Spec.TargetCluster = &migrationv1alpha1.TargetCluster{KubeconfigSecretRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "cluster-b"},
+			}}
+		}, "name and a key"},
+		{"direct transfer", func(m *migrationv1alpha1.StatefulMigration) {
+			m.Spec.TargetCluster = &migrationv1alpha1.TargetCluster{KubeconfigSecretRef: ref}
+			m.Spec.TransferMode = "Direct"
+		}, "Registry transfer mode"},
+		{"identity swap", func(m *migrationv1alpha1.StatefulMigration) {
+			m.Spec.TargetCluster = &migrationv1alpha1.TargetCluster{KubeconfigSecretRef: ref}
+			m.Spec.IdentitySwapMode = "ExchangeFence"
+		}, "identitySwapMode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMigration("mig-tc", migrationv1alpha1.PhasePending)
+			tt.mutate(m)
+			err := validateTargetCluster(m)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestReconcile_Pending_DetectsCrossClusterStrategy(t *testing.T) {
+	sourcePod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-0",
+			Namespace: "default",
+		},
+		Spec: corev1.PodSpec{
+			NodeName:   "node-1",
+			Containers: []corev1.Container{{Name: "app", Image: "myapp:latest"}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	migration, secret := crossClusterMigration("mig-cc-detect", migrationv1alpha1.PhasePending)
+	migration.Spec.MigrationStrategy = ""
+
+	r, _, ctx := setupTest(migration, sourcePod, secret)
+
+	if _, err := reconcileOnce(r, ctx, "mig-cc-detect", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fetchMigration(r, ctx, "mig-cc-detect", "default")
+	if got.Spec.MigrationStrategy != "CrossCluster" {
+		t.Errorf("expected strategy CrossCluster, got %q", got.Spec.MigrationStrategy)
+	}
+	if got.Status.Phase == migrationv1alpha1.PhaseFailed {
+		t.Errorf("expected the migration to proceed, got Failed: %+v", meta.FindStatusCondition(got.Status.Conditions, "Failed"))
+	}
+	if got.Status.SourceFence == nil || got.Status.SourceFence.CheckpointedAt == nil {
+		t.Error("expected the source to be tracked for fencing after the checkpoint")
+	}
+}
+
+func TestReconcile_Pending_CrossCluster_RejectsUnmovableSources(t *testing.T) {
+	owned := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-0",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "myapp", UID: "abc-123"},
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:   "node-1",
+			Containers: []corev1.Container{{Name: "app", Image: "myapp:latest"}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	withVolume, pvc, pv := volumeFixtures(true)
+	withVolume.OwnerReferences = nil
+
+	for _, tc := range []struct {
+		name   string
+		objs   []client.Object
+		reason string
+	}{
+		{"owned", []client.Object{owned}, "standalone source pod"},
+		{"volumes", []client.Object{withVolume, pvc, pv}, "does not move persistent volumes"},
+	} {
+		migration, secret := crossClusterMigration("mig-cc-"+tc.name, migrationv1alpha1.PhasePending)
+		r, _, ctx := setupTest(append(tc.objs, migration, secret)...)
+
+		if _, err := reconcileOnce(r, ctx, migration.Name, "default"); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		got := fetchMigration(r, ctx, migration.Name, "default")
+		cond := meta.FindStatusCondition(got.Status.Conditions, "Failed")
+		if got.Status.Phase != migrationv1alpha1.PhaseFailed || cond == nil || !strings.Contains(cond.Message, tc.reason) {
+			t.Errorf("%s: expected Pending to fail with %q, got %q / %+v", tc.name, tc.reason, got.Status.Phase, cond)
+		}
+	}
+}
+
+func TestReconcile_Pending_CrossCluster_TargetNamespaceOptIn(t *testing.T) {
+	sourcePod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-0", Namespace: "default"},
+		Spec: corev1.PodSpec{
+			NodeName:   "node-1",
+			Containers: []corev1.Container{{Name: "app", Image: "myapp:latest"}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+
+	for _, tc := range []struct {
+		name        string
+		annotations map[string]string
+		allowed     bool
+	}{
+		{"none", nil, false},
+		{"other", map[string]string{allowedSourceNamespacesAnnotation: "staging"}, false},
+		{"listed", map[string]string{allowedSourceNamespacesAnnotation: "staging, default"}, true},
+	} {
+		migration := newMigration("mig-cc-ns-"+tc.name, migrationv1alpha1.PhasePending)
+		migration.Spec.MigrationStrategy = "CrossCluster"
+		migration.Spec.TargetCluster = &migrationv1alpha1.TargetCluster{Namespace: "apps"}
+		namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps", Annotations: tc.annotations}}
+
+		r, _, ctx := setupTest(migration, sourcePod, namespace)
+
+		if _, err := reconcileOnce(r, ctx, migration.Name, "default"); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		got := fetchMigration(r, ctx, migration.Name, "default")
+		if failed := got.Status.Phase == migrationv1alpha1.PhaseFailed; failed == tc.allowed {
+			t.Errorf("%s: expected allowed=%v, got phase %q (%+v)", tc.name, tc.allowed, got.Status.Phase, meta.FindStatusCondition(got.Status.Conditions, "Failed"))
+		}
+		if !tc.allowed {
+			if cond := meta.FindStatusCondition(got.Status.Conditions, "Failed"); cond == nil || !strings.Contains(cond.Message, allowedSourceNamespacesAnnotation) {
+				t.Errorf("%s: expected the failure to name the opt-in annotation, got %+v", tc.name, cond)
+			}
+		}
+	}
+}
+
+func TestReconcile_Restoring_CrossCluster_CreatesRemotePod(t *testing.T) {
+	migration, secret := crossClusterMigration("mig-cc-restore", migrationv1alpha1.PhaseRestoring)
+	migration.Status.SourceNode = "node-1"
+	migration.Status.ContainerName = "app"
+	migration.Status.CheckpointImage = "registry.example.com/checkpoints/myapp@sha256:abc"
+	migration.Status.SourcePodLabels = map[string]string{"app": "myapp"}
+	migration.Status.SourcePodSpec = &corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "myapp:latest"}}}
+	migration.Status.PhaseTimings = map[string]string{}
+
+	r, _, ctx := setupTest(migration, secret)
+	remote, built := withRemoteCluster(t, r)
+
+	result, err := reconcileOnce(r, ctx, "mig-cc-restore", "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Error("expected RequeueAfter while waiting for the target pod")
+	}
+
+	pod := &corev1.Pod{}
+	if err := remote.Get(ctx, types.NamespacedName{Name: "myapp-0-shadow", Namespace: "apps"}, pod); err != nil {
+		t.Fatalf("expected target pod in the target cluster: %v", err)
+	}
+	if pod.Labels["migration.ms2m.io/migration"] != "mig-cc-restore" || pod.Labels["app"] != "myapp" {
+		t.Errorf("unexpected labels %v", pod.Labels)
+	}
+	if pod.Annotations[sourcePodAnnotation] != "default/myapp-0" {
+		t.Errorf("expected source annotation default/myapp-0, got %q", pod.Annotations[sourcePodAnnotation])
+	}
+	if len(pod.OwnerReferences) != 0 {
+		t.Errorf("expected no owner references across clusters, got %v", pod.OwnerReferences)
+	}
+	if pod.Spec.NodeName != "node-2" || pod.Spec.Containers[0].Image != migration.Status.CheckpointImage {
+		t.Errorf("expected checkpoint image on node-2, got node %q image %q", pod.Spec.NodeName, pod.Spec.Containers[0].Image)
+	}
+	local := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0-shadow", Namespace: "default"}, local); !errors.IsNotFound(err) {
+		t.Errorf("expected no target pod in the source cluster, got err=%v", err)
+	}
+
+	if _, err := reconcileOnce(r, ctx, "mig-cc-restore", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *built != 1 {
+		t.Errorf("expected the target cluster client to be cached, built %d", *built)
+	}
+}
+
+func TestTargetClient_ReplacedWhenSecretChanges(t *testing.T) {
+	migration, secret := crossClusterMigration("mig-cc-client", migrationv1alpha1.PhaseRestoring)
+	r, _, ctx := setupTest(migration, secret)
+	_, built := withRemoteCluster(t, r)
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := r.targetClient(ctx, migration); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if *built != 1 {
+		t.Fatalf("expected one client for an unchanged Secret, built %d", *built)
+	}
+
+	// A rotated kubeconfig replaces the cached client instead of adding one.
+	if err := r.Get(ctx, types.NamespacedName{Name: "cluster-b", Namespace: "default"}, secret); err != nil {
+		t.Fatal(err)
+	}
+	secret.Annotations = map[string]string{"rotated": "true"}
+	if err := r.Update(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.targetClient(ctx, migration); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *built != 2 {
+		t.Errorf("expected the client to be rebuilt after the Secret changed, built %d", *built)
+	}
+	entries := 0
+	r.targetClients.Range(func(interface{}, interface{}) bool {
+		entries++
+		return true
+	})
+	if entries != 1 {
+		t.Errorf("expected one cached client per Secret, got %d", entries)
+	}
+}
+
+func TestReconcile_Restoring_CrossCluster_RunningTarget(t *testing.T) {
+	migration, secret := crossClusterMigration("mig-cc-ready", migrationv1alpha1.PhaseRestoring)
+	migration.Spec.RestoreReadiness = &migrationv1alpha1.RestoreReadiness{Type: "Running"}
+	migration.Status.SourceNode = "node-1"
+	migration.Status.PhaseTimings = map[string]string{}
+	target := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-0-shadow",
+			Namespace: "apps",
+			Labels:    map[string]string{"migration.ms2m.io/migration": "mig-cc-ready"},
+		},
+		Spec:   corev1.PodSpec{NodeName: "node-2"},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+
+	r, mockBroker, ctx := setupTest(migration, secret)
+	mockBroker.Connected = true
+	withRemoteCluster(t, r, target)
+
+	if _, err := reconcileOnce(r, ctx, "mig-cc-ready", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-cc-ready", "default")
+	if !restoredPastReadiness(got) {
+		t.Fatalf("expected to leave Restoring for the Running remote pod, got %q", got.Status.Phase)
+	}
+	if got.Status.TargetPod != "myapp-0-shadow" {
+		t.Errorf("expected status.targetPod myapp-0-shadow, got %q", got.Status.TargetPod)
+	}
+}
+
+func TestReconcile_Restoring_CrossCluster_MissingSecret(t *testing.T) {
+	migration, _ := crossClusterMigration("mig-cc-nosecret", migrationv1alpha1.PhaseRestoring)
+	migration.Status.PhaseTimings = map[string]string{}
+
+	r, _, ctx := setupTest(migration)
+
+	if _, err := reconcileOnce(r, ctx, "mig-cc-nosecret", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fetchMigration(r, ctx, "mig-cc-nosecret", "default")
+	if got.Status.Phase != migrationv1alpha1.PhaseFailed {
+		t.Fatalf("expected phase Failed, got %q", got.Status.Phase)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, "Failed")
+	if cond == nil || !strings.Contains(cond.Message, `kubeconfig Secret "cluster-b" not found`) {
+		t.Errorf("expected a missing Secret failure, got %+v", cond)
+	}
+}
+
+func TestCrossClusterStrategy_FinalizeAndRollback(t *testing.T) {
+	migration, secret := crossClusterMigration("mig-cc-final", migrationv1alpha1.PhaseFinalizing)
+	source := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "myapp-0", Namespace: "default"}}
+	target := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name: "myapp-0-shadow", Namespace: "apps", Labels: map[string]string{"migration.ms2m.io/migration": "mig-cc-final"},
+	}}
+	r, _, ctx := setupTest(migration, secret, source)
+	remote, _ := withRemoteCluster(t, r, target)
+	s := crossClusterStrategy{}
+
+	_, done, err := s.Finalize(ctx, r, migration, nil)
+	if err != nil || !done {
+		t.Fatalf("expected Finalize to be done, got done=%v err=%v", done, err)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Name: "myapp-0", Namespace: "default"}, &corev1.Pod{}); !errors.IsNotFound(err) {
+		t.Errorf("expected the source pod to be deleted, got err=%v", err)
+	}
+	if err := remote.Get(ctx, types.NamespacedName{Name: "myapp-0-shadow", Namespace: "apps"}, &corev1.Pod{}); err != nil {
+		t.Errorf("expected the target pod to stay, got %v", err)
+	}
+
+	var steps []string
+	s.Rollback(ctx, r, migration, func(format string, args ...interface{}) {
+		steps = append(steps, fmt.Sprintf(format, args...))
+	})
+	if len(steps) != 1 || steps[0] != "deleted target pod apps/myapp-0-shadow" {
+		t.Errorf("unexpected rollback steps %v", steps)
+	}
+	if err := remote.Get(ctx, types.NamespacedName{Name: "myapp-0-shadow", Namespace: "apps"}, &corev1.Pod{}); !errors.IsNotFound(err) {
+		t.Errorf("expected the target pod to be deleted, got err=%v", err)
+	}
+}
+
+func TestReconcile_DryRun_CrossCluster(t *testing.T) {
+	migration, secret := crossClusterMigration("mig-cc-plan", migrationv1alpha1.PhasePending)
+	migration.Spec.MigrationStrategy = ""
+	migration.Spec.DryRun = true
+	sourcePod, _, _ := planFixtures("2")
+	sourcePod.OwnerReferences = nil
+	remoteNode := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-2"},
+		Status: corev1.NodeStatus{
+			Conditions:  []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+			Allocatable: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4"), corev1.ResourceMemory: resource.MustParse("8Gi")},
+		},
+	}
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps"}}
+
+	r, _, ctx := setupTest(migration, sourcePod, secret)
+	withRemoteCluster(t, r, remoteNode, namespace)
+
+	if _, err := reconcileOnce(r, ctx, "mig-cc-plan", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	plan := fetchMigration(r, ctx, "mig-cc-plan", "default").Status.Plan
+	if plan == nil {
+		t.Fatal("expected status.plan to be set")
+	}
+	if plan.Strategy != "CrossCluster" {
+		t.Errorf("expected CrossCluster strategy, got %q", plan.Strategy)
+	}
+	for _, name := range []string{"TargetCluster", "TargetNode", "Ownership"} {
+		if s := planCheckStatus(plan, name); s != "Passed" {
+			t.Errorf("expected check %s Passed, got %q (%+v)", name, s, plan.Checks)
+		}
+	}
+	if plan.PredictedDowntime != "None" {
+		t.Errorf("expected no predicted downtime, got %q", plan.PredictedDowntime)
+	}
+}
+
+func TestIntegration_CrossCluster_RestoresOnSecondAPIServer(t *testing.T) {
+	if cfg == nil {
+		t.Skip("envtest not available, skipping integration test")
+	}
+
+	// A second API server plays the target cluster.
+	targetEnv := &envtest.Environment{}
+	if _, err := targetEnv.Start(); err != nil {
+		t.Fatalf("failed to start target cluster: %v", err)
+	}
+	defer targetEnv.Stop()
+	user, err := targetEnv.AddUser(envtest.User{Name: "ms2m", Groups: []string{"system:masters"}}, nil)
+	if err != nil {
+		t.Fatalf("failed to add target cluster user: %v", err)
+	}
+	kubeconfig, err := user.KubeConfig()
+	if err != nil {
+		t.Fatalf("failed to build target kubeconfig: %v", err)
+	}
+
+	ctx := context.Background()
+	k8sClient, err := client.New(cfg, client.Options{Scheme: testScheme()})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	remote, err := client.New(user.Config(), client.Options{Scheme: testScheme()})
+	if err != nil {
+		t.Fatalf("failed to create target cluster client: %v", err)
+	}
+	if err := remote.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps"}}); err != nil {
+		t.Fatalf("failed to create target namespace: %v", err)
+	}
+
+	migration, secret := crossClusterMigration("integration-cc", migrationv1alpha1.PhaseRestoring)
+	secret.Data["kubeconfig"] = kubeconfig
+	if err := k8sClient.Create(ctx, secret); err != nil {
+		t.Fatalf("failed to create kubeconfig Secret: %v", err)
+	}
+	defer k8sClient.Delete(ctx, secret)
+	if err := k8sClient.Create(ctx, migration); err != nil {
+		t.Fatalf("failed to create migration: %v", err)
+	}
+	defer k8sClient.Delete(ctx, migration)
+	migration.Status = migrationv1alpha1.StatefulMigrationStatus{
+		Phase:           migrationv1alpha1.PhaseRestoring,
+		SourceNode:      "node-1",
+		ContainerName:   "app",
+		CheckpointImage: "registry.example.com/checkpoints/myapp@sha256:abc",
+		SourcePodSpec:   &corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "myapp:latest"}}},
+	}
+	if err := k8sClient.Status().Update(ctx, migration); err != nil {
+		t.Fatalf("failed to set migration status: %v", err)
+	}
+
+	reconciler := &StatefulMigrationReconciler{
+		Client:    k8sClient,
+		Scheme:    testScheme(),
+		MsgClient: messaging.NewMockBrokerClient(),
+	}
+	if _, err := reconciler.Reconcile(ctx, ctrl.Request{
+		NamespacedName: types.NamespacedName{Name: "integration-cc", Namespace: "default"},
+	}); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	pod := &corev1.Pod{}
+	if err := remote.Get(ctx, types.NamespacedName{Name: "myapp-0-shadow", Namespace: "apps"}, pod); err != nil {
+		t.Fatalf("expected target pod on the second API server: %v", err)
+	}
+	if pod.Labels["migration.ms2m.io/migration"] != "integration-cc" {
+		t.Errorf("unexpected target pod labels %v", pod.Labels)
+	}
+	if err := k8sClient.Get(ctx, types.NamespacedName{Name: "myapp-0-shadow", Namespace: "apps"}, &corev1.Pod{}); !errors.IsNotFound(err) {
+		t.Errorf("expected no target pod on the source API server, got err=%v", err)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Delivery on an in-memory broker
+// ---------------------------------------------------------------------------
+
+// driveOnBroker reconciles a migration against sim's broker until it
+// completes or fails. Between passes the simulated pods handle their control
+// messages and random traffic flows; a pod that leaves the cluster is
+// killed in the simulation.
+func driveOnBroker(t *testing.T, r *StatefulMigrationReconciler, ctx context.Context, name string, sim *messaging.Sim, rng *rand.Rand, pods ...string) *migrationv1alpha1.StatefulMigration {
+	t.Helper()
+	present := make(map[string]bool)
+	killed := make(map[string]bool)
+	for pass := 0; pass < 500; pass++ {
+		if _, err := reconcileOnce(r, ctx, name, "default"); err != nil {
+			t.Fatalf("pass %d: unexpected error: %v", pass, err)
+		}
+		got := fetchMigration(r, ctx, name, "default")
+		var running []string
+		for _, pod := range pods {
+			err := r.Get(ctx, types.NamespacedName{Name: pod, Namespace: "default"}, &corev1.Pod{})
+			if err == nil {
+				present[pod] = true
+			} else if errors.IsNotFound(err) && present[pod] && !killed[pod] {
+				killed[pod] = true
+				if err := sim.Run(messaging.SimKill(pod)); err != nil {
+					t.Fatalf("pass %d: %v", pass, err)
+				}
+			}
+			if !killed[pod] {
+				running = append(running, pod)
+			}
+		}
+		if got.Status.Phase == migrationv1alpha1.PhaseCompleted || got.Status.Phase == migrationv1alpha1.PhaseFailed {
+			return got
+		}
+		if err := sim.Run(messaging.SimTraffic(rng, 1, 3, 6, running...)); err != nil {
+			t.Fatalf("pass %d: %v", pass, err)
+		}
+	}
+	got := fetchMigration(r, ctx, name, "default")
+	t.Fatalf("migration %s did not finish: %+v", name, got.Status)
+	return nil
+}
+
+func TestReconcile_ShadowPod_DeliversEveryMessageOnce(t *testing.T) {
+	for seed := uint64(1); seed <= 20; seed++ {
+		rng := rand.New(rand.NewPCG(seed, seed))
+		sim, err := messaging.NewSim("orders.fanout", "orders")
+		if err != nil {
+			t.Fatalf("NewSim() unexpected error: %v", err)
+		}
+		broker := messaging.NewFakeBrokerClient(sim.Broker)
+		ctx := context.Background()
+		_ = broker.Connect(ctx, "amqp://localhost:5672")
+
+		// Checkpointing created the replay queue once the source had caught
+		// up, and the checkpoint was restored as the shadow.
+		_, _ = sim.Start("myapp-0", true)
+		err = sim.Run(
+			messaging.SimTraffic(rng, 5, 3, 6, "myapp-0"),
+			messaging.SimDrain("myapp-0"),
+			messaging.SimDo("create replay queue", func(*messaging.Sim) error {
+				_, err := broker.CreateSecondaryQueue(ctx, "orders", "orders.fanout", "orders.new")
+				return err
+			}),
+			messaging.SimTraffic(rng, 3, 3, 6, "myapp-0"),
+			messaging.SimRestore("myapp-0", "myapp-0-shadow"),
+			messaging.SimTraffic(rng, 3, 3, 6, "myapp-0"),
+		)
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+
+		sourcePod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp-0", Namespace: "default"},
+			Spec:       corev1.PodSpec{NodeName: "node-1"},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+		shadowPod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp-0-shadow", Namespace: "default"},
+			Spec:       corev1.PodSpec{NodeName: "node-2"},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+		migration := newMigration("mig-deliver", migrationv1alpha1.PhaseReplaying)
+		migration.Spec.MigrationStrategy = "ShadowPod"
+		migration.Status.TargetPod = "myapp-0-shadow"
+		migration.Status.SourceNode = "node-1"
+		migration.Status.PhaseTimings = map[string]string{}
+
+		r, _, _ := setupTest(migration, sourcePod, shadowPod)
+		r.MsgClient = broker
+
+		got := driveOnBroker(t, r, ctx, "mig-deliver", sim, rng, "myapp-0", "myapp-0-shadow")
+		if got.Status.Phase != migrationv1alpha1.PhaseCompleted {
+			t.Fatalf("seed %d: expected phase %q, got %q: %v", seed, migrationv1alpha1.PhaseCompleted, got.Status.Phase, got.Status.Conditions)
+		}
+		if err := sim.Run(messaging.SimTraffic(rng, 3, 3, 6, "myapp-0-shadow"), messaging.SimDrain("myapp-0-shadow")); err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		if err := sim.Report("myapp-0-shadow").Err(); err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		if sim.Broker.HasQueue("orders.ms2m-replay") {
+			t.Errorf("seed %d: expected the replay queue to be deleted", seed)
+		}
+	}
+}
+
+func TestReconcile_ExchangeFence_DeliversEveryMessageOnce(t *testing.T) {
+	for seed := uint64(1); seed <= 20; seed++ {
+		rng := rand.New(rand.NewPCG(seed, seed))
+		sim, err := messaging.NewSim("app.fanout", "orders")
+		if err != nil {
+			t.Fatalf("NewSim() unexpected error: %v", err)
+		}
+		broker := messaging.NewFakeBrokerClient(sim.Broker)
+		ctx := context.Background()
+		_ = broker.Connect(ctx, "amqp://localhost:5672")
+
+		// PrepareSwap created the replay queue, the shadow was checkpointed
+		// and restored as the replacement, and PreFenceDrain started its
+		// replay.
+		_, _ = sim.Start("consumer-0-shadow", true)
+		err = sim.Run(
+			messaging.SimTraffic(rng, 5, 3, 6, "consumer-0-shadow"),
+			messaging.SimDrain("consumer-0-shadow"),
+			messaging.SimDo("create replay queue", func(*messaging.Sim) error {
+				_, err := broker.CreateSecondaryQueue(ctx, "orders", "app.fanout", "")
+				return err
+			}),
+			messaging.SimTraffic(rng, 3, 3, 6, "consumer-0-shadow"),
+			messaging.SimRestore("consumer-0-shadow", "consumer-0"),
+			messaging.SimDo("start replay", func(*messaging.Sim) error {
+				return broker.SendControlMessage(ctx, "consumer-0", protocol.ControlMessage{
+					ID:      "prefence",
+					Type:    protocol.ControlStartReplay,
+					Payload: map[string]interface{}{"queue": "orders.ms2m-replay"},
+				})
+			}),
+			messaging.SimTraffic(rng, 3, 3, 6, "consumer-0-shadow", "consumer-0"),
+		)
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+
+		stsReplicas := int32(0)
+		sts := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "consumer", Namespace: "default"},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: &stsReplicas,
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "consumer"}},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "consumer"}},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "consumer:latest"}}},
+				},
+			},
+		}
+		shadowPod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "consumer-0-shadow", Namespace: "default"},
+			Spec:       corev1.PodSpec{NodeName: "node-2"},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+		replacementPod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "consumer-0", Namespace: "default"},
+			Spec:       corev1.PodSpec{NodeName: "node-2"},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+		migration := newExchangeFenceMigration("mig-ef-deliver")
+		migration.Status.SwapSubPhase = "ExchangeFence"
+		migration.Status.ReplacementPod = "consumer-0"
+		migration.Status.OriginalReplicas = 1
+
+		r, _, _ := setupTest(migration, sts, shadowPod, replacementPod)
+		r.MsgClient = broker
+
+		got := driveOnBroker(t, r, ctx, "mig-ef-deliver", sim, rng, "consumer-0-shadow", "consumer-0")
+		if got.Status.Phase != migrationv1alpha1.PhaseCompleted {
+			t.Fatalf("seed %d: expected phase %q, got %q: %v", seed, migrationv1alpha1.PhaseCompleted, got.Status.Phase, got.Status.Conditions)
+		}
+		if err := sim.Run(messaging.SimTraffic(rng, 3, 3, 6, "consumer-0"), messaging.SimDrain("consumer-0")); err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		if err := sim.Report("consumer-0").Err(); err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		if n := len(sim.Broker.Unroutable()); n > 0 {
+			t.Errorf("seed %d: expected no unroutable messages, got %d", seed, n)
+		}
+		for _, q := range []string{"orders.ms2m-replay", "orders.ms2m-fence-buffer"} {
+			if sim.Broker.HasQueue(q) {
+				t.Errorf("seed %d: expected %s to be deleted", seed, q)
+			}
+		}
+	}
+}
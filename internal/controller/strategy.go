@@ -0,0 +1,342 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+)
+
+// Built-in values of spec.migrationStrategy.
+const (
+	strategyShadowPod    = "ShadowPod"
+	strategySequential   = "Sequential"
+	strategyCrossCluster = "CrossCluster"
+)
+
+// Strategy implements the parts of a migration that depend on
+// spec.migrationStrategy. The reconciler runs the phases every strategy
+// shares (Pending, Checkpointing, Transferring, Replaying) and the common
+// steps of Restoring and Finalizing, and calls the strategy for the rest.
+// Where a shared step behaves differently per strategy, it asks the
+// strategy's Capabilities rather than its name.
+//
+// Hooks that return done follow the reconciler's sub-step convention: while
+// done is false the reconcile returns result and err, and the hook is called
+// again on the next pass. Hooks must therefore be idempotent.
+type Strategy interface {
+	// Capabilities describes how the strategy migrates m.
+	Capabilities(m *migrationv1alpha1.StatefulMigration) Capabilities
+
+	// Validate checks in Pending that the strategy can migrate sourcePod,
+	// once status records its owner and volumes. Errors are classified like
+	// any other (see RetryOrFail): transient ones are retried, the rest fail
+	// the migration.
+	Validate(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, sourcePod *corev1.Pod) error
+
+	// PredictFinalization reports for a dry run how Finalize would settle
+	// the pod's identity and the expected downtime class (None, Brief or
+	// Full). owner is "<Kind>/<name>" of the source pod's owner, or empty.
+	PredictFinalization(m *migrationv1alpha1.StatefulMigration, owner string) (swapPath, downtime string)
+
+	// TargetPodName is the name the target pod is restored under.
+	TargetPodName(m *migrationv1alpha1.StatefulMigration) string
+
+	// Restore creates the target pod from the checkpoint image in the
+	// Restoring phase. It returns the target pod once it is Running; the
+	// reconciler then waits for restore readiness and moves to Replaying.
+	Restore(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration) (ctrl.Result, *corev1.Pod, error)
+
+	// Finalize hands the workload over to the target pod in the Finalizing
+	// phase, after END_REPLAY and before the broker connection is closed.
+	// base is the migration as read at the start of the pass. The
+	// migration completes once Finalize returns done.
+	//
+	// A Finalize that runs steps of its own across passes, as the ShadowPod
+	// identity swap does, records the current one in status.swapSubPhase.
+	// While it is set the reconciler does not repeat END_REPLAY or delete
+	// the replay queue, and an abort is deferred unless the step is one the
+	// identity swap can unwind. Finalize clears it before returning done.
+	Finalize(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, base client.Object) (ctrl.Result, bool, error)
+
+	// Rollback undoes the strategy's changes to pods and owners when the
+	// migration is aborted, calling record for each step taken. Jobs,
+	// queues and the checkpoint image are cleaned up by the reconciler.
+	// Failures are logged, not returned: an abort always completes.
+	Rollback(ctx context.Context, r *StatefulMigrationReconciler, m *migrationv1alpha1.StatefulMigration, record func(string, ...interface{}))
+}
+
+// Capabilities describe a strategy to the steps the reconciler shares
+// between strategies.
+type Capabilities struct {
+	// SourceRunsAlongside means the source pod keeps consuming next to the
+	// target through Replaying; it is fenced before END_REPLAY.
+	SourceRunsAlongside bool
+
+	// DeletesSource means the source pod is deleted before the target is
+	// restored. Aborting a standalone pod's migration past that point would
+	// lose the workload, so it is deferred.
+	DeletesSource bool
+
+	// SharesServices means the target runs behind the Services selecting
+	// the source, so spec.trafficHandover withholds their labels from it
+	// until Finalizing.
+	SharesServices bool
+
+	// HoldsOrdinal means a StatefulSet source's ordinal is taken over by
+	// the target; otherwise the target stays outside the StatefulSet.
+	HoldsOrdinal bool
+
+	// Volumes is how the source's persistent volumes reach the target.
+	Volumes VolumeHandling
+
+	// TargetCluster means the target is restored through spec.targetCluster,
+	// which is required for the strategy and rejected for all others.
+	TargetCluster bool
+}
+
+// VolumeHandling is how a strategy carries persistent volumes over.
+type VolumeHandling string
+
+const (
+	// VolumesShared mounts the source's claims in the target while the
+	// source still runs, so ReadWriteOnce claims are rejected.
+	VolumesShared VolumeHandling = "Shared"
+	// VolumesMoved moves every claim to the target after the source is
+	// deleted (see handleVolumes). It needs DeletesSource.
+	VolumesMoved VolumeHandling = "Moved"
+	// VolumesNone does not carry claims over; sources with claims are
+	// rejected.
+	VolumesNone VolumeHandling = "None"
+)
+
+var (
+	strategiesMu sync.RWMutex
+	strategies   = map[string]Strategy{
+		strategyShadowPod:    shadowPodStrategy{},
+		strategySequential:   sequentialStrategy{},
+		strategyCrossCluster: crossClusterStrategy{},
+	}
+)
+
+// RegisterStrategy makes s available as spec.migrationStrategy name. It is
+// meant to be called from an init function and panics if name is empty or
+// already registered.
+func RegisterStrategy(name string, s Strategy) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	if name == "" || s == nil {
+		panic("controller: RegisterStrategy needs a name and a strategy")
+	}
+	if _, dup := strategies[name]; dup {
+		panic(fmt.Sprintf("controller: strategy %q registered twice", name))
+	}
+	strategies[name] = s
+}
+
+// lookupStrategy returns the strategy registered as name.
+func lookupStrategy(name string) (Strategy, bool) {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+	s, ok := strategies[name]
+	return s, ok
+}
+
+// strategyFor returns m's strategy. An unset strategy is ShadowPod, as for
+// migrations that skipped auto-detection in Pending.
+func strategyFor(m *migrationv1alpha1.StatefulMigration) (Strategy, bool) {
+	if m.Spec.MigrationStrategy == "" {
+		return lookupStrategy(strategyShadowPod)
+	}
+	return lookupStrategy(m.Spec.MigrationStrategy)
+}
+
+// capabilitiesOf returns the capabilities of the strategy registered as
+// name, or none for an unknown name.
+func capabilitiesOf(name string, m *migrationv1alpha1.StatefulMigration) Capabilities {
+	s, ok := lookupStrategy(name)
+	if !ok {
+		return Capabilities{}
+	}
+	return s.Capabilities(m)
+}
+
+// strategyCapabilities returns the capabilities of m's strategy.
+func strategyCapabilities(m *migrationv1alpha1.StatefulMigration) Capabilities {
+	s, ok := strategyFor(m)
+	if !ok {
+		return Capabilities{}
+	}
+	return s.Capabilities(m)
+}
+
+// detectStrategy returns the built-in strategy for a migration that does not
+// set spec.migrationStrategy: CrossCluster with spec.targetCluster,
+// Sequential for StatefulSet pods and ShadowPod otherwise. sourcePod may be
+// nil when it is not known.
+func detectStrategy(m *migrationv1alpha1.StatefulMigration, sourcePod *corev1.Pod) string {
+	if m.Spec.TargetCluster != nil {
+		return strategyCrossCluster
+	}
+	if sourcePod != nil {
+		for _, ref := range sourcePod.OwnerReferences {
+			if ref.Kind == "StatefulSet" {
+				return strategySequential
+			}
+		}
+	}
+	return strategyShadowPod
+}
+
+// checkVolumeHandling returns an error when the strategy registered as name
+// cannot carry volumes over.
+func checkVolumeHandling(name string, caps Capabilities, volumes []migrationv1alpha1.VolumeStatus) error {
+	switch caps.Volumes {
+	case VolumesMoved:
+		return nil
+	case VolumesNone:
+		if len(volumes) > 0 {
+			return fmt.Errorf("the %s strategy does not move persistent volumes: claim %q would not be copied to the target", name, volumes[0].ClaimName)
+		}
+		return nil
+	default:
+		if v := unsharedVolume(volumes); v != nil {
+			return fmt.Errorf("%s strategy cannot share volume %q: claim %q is ReadWriteOnce (%s); use the %s strategy",
+				name, v.Name, v.ClaimName, v.Handling, strategySequential)
+		}
+		return nil
+	}
+}
+
+// validateMigrationStrategy rejects a spec.migrationStrategy no strategy is
+// registered for. Called after auto-detection has filled it in.
+func validateMigrationStrategy(m *migrationv1alpha1.StatefulMigration) error {
+	if _, ok := lookupStrategy(m.Spec.MigrationStrategy); ok {
+		return nil
+	}
+	strategiesMu.RLock()
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	strategiesMu.RUnlock()
+	sort.Strings(names)
+	return fmt.Errorf("spec.migrationStrategy %q is not registered; known strategies: %s",
+		m.Spec.MigrationStrategy, strings.Join(names, ", "))
+}
+
+// ---------------------------------------------------------------------------
+// Restoring steps shared by the strategies
+// ---------------------------------------------------------------------------
+
+// LookupTarget returns the pod named name, or nil when it does not exist. A
+// placeholder the StatefulSet recreated for a paused ordinal is deleted and
+// reported as missing, so the target can be created in the same pass.
+func (r *StatefulMigrationReconciler) LookupTarget(ctx context.Context, m *migrationv1alpha1.StatefulMigration, name string) (*corev1.Pod, error) {
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: m.Namespace}, pod); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if heldPlaceholder(pod) {
+		if err := r.deletePlaceholder(ctx, pod); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return pod, nil
+}
+
+// RunningTarget waits for an existing target pod to belong to this
+// migration and be Running, and returns it once it is.
+func (r *StatefulMigrationReconciler) RunningTarget(ctx context.Context, m *migrationv1alpha1.StatefulMigration, pod *corev1.Pod) (ctrl.Result, *corev1.Pod, error) {
+	logger := log.FromContext(ctx)
+
+	// If the pod is being deleted (e.g., leftover from a previous migration)
+	// or is not owned by this migration, wait for it to be gone so we can
+	// create our own.
+	if pod.DeletionTimestamp != nil || pod.Labels["migration.ms2m.io/migration"] != m.Name {
+		logger.Info("Waiting for stale target pod to be removed", "pod", pod.Name,
+			"owner", pod.Labels["migration.ms2m.io/migration"], "deleting", pod.DeletionTimestamp != nil)
+		return ctrl.Result{RequeueAfter: 1 * time.Second}, nil, nil
+	}
+
+	if pod.Status.Phase != corev1.PodRunning {
+		logger.Info("Waiting for target pod to become Running", "pod", pod.Name, "phase", pod.Status.Phase)
+		return ctrl.Result{RequeueAfter: r.pollingBackoff(m, "Restoring.start")}, nil, nil
+	}
+	return ctrl.Result{}, pod, nil
+}
+
+// CreateTarget creates the target pod name on the target node from the
+// checkpoint image, with the spec and labels of the source pod. With
+// keepIdentity the target keeps the source's hostname and subdomain, for a
+// target that takes over the source's name.
+func (r *StatefulMigrationReconciler) CreateTarget(ctx context.Context, m *migrationv1alpha1.StatefulMigration, name string, sourceSpec *corev1.PodSpec, sourceLabels map[string]string, keepIdentity bool) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	var checkpointImage string
+	var pullPolicy corev1.PullPolicy
+	if m.Spec.TransferMode == "Direct" {
+		checkpointImage = fmt.Sprintf("localhost/checkpoint/%s:latest", m.Status.ContainerName)
+		pullPolicy = corev1.PullNever
+	} else {
+		checkpointImage, pullPolicy = registryCheckpointImage(m)
+	}
+
+	// Build labels — migration labels first, then source pod labels
+	labels := map[string]string{
+		"migration.ms2m.io/migration": m.Name,
+		"migration.ms2m.io/role":      "target",
+	}
+	for k, v := range sourceLabels {
+		if _, exists := labels[k]; !exists {
+			labels[k] = v
+		}
+	}
+	// Keep the shadow pod out of Service endpoints until Finalizing.
+	if labelFlipEnabled(m) {
+		if err := r.holdServiceLabels(ctx, m, sourceLabels, labels); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	newPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: m.Namespace,
+			Labels:    labels,
+			Annotations: map[string]string{
+				"migration.ms2m.io/checkpoint-image": checkpointImage,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(m, migrationv1alpha1.GroupVersion.WithKind("StatefulMigration")),
+			},
+		},
+		Spec: restoredPodSpec(m, sourceSpec, checkpointImage, pullPolicy, keepIdentity),
+	}
+
+	if err := r.Create(ctx, newPod); err != nil {
+		if errors.IsAlreadyExists(err) {
+			return ctrl.Result{RequeueAfter: 1 * time.Second}, nil
+		}
+		return r.RetryOrFail(ctx, m, "create target pod", err)
+	}
+
+	logger.Info("Created target pod", "pod", name, "node", m.Spec.TargetNode)
+	return ctrl.Result{RequeueAfter: 1 * time.Second}, nil
+}
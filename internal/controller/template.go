@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+)
+
+// hostnameLabel is the node label the identity swap pins the template to.
+const hostnameLabel = "kubernetes.io/hostname"
+
+// templateHostnameField names the nodeSelector pin in
+// status.statefulSetTemplate.
+const templateHostnameField = "nodeSelector/" + hostnameLabel
+
+// validateStatefulSetPlacement rejects spec.statefulSetPlacement values the
+// controller cannot act on.
+func validateStatefulSetPlacement(m *migrationv1alpha1.StatefulMigration) error {
+	switch mode := m.Spec.StatefulSetPlacement; mode {
+	case "", placementNone, placementPreferred, placementRequired:
+		return nil
+	default:
+		return fmt.Errorf("spec.statefulSetPlacement %q must be None, Preferred or Required", mode)
+	}
+}
+
+// templatePending reports whether the swap changed the StatefulSet's pod
+// template and the change has not been settled yet.
+func templatePending(m *migrationv1alpha1.StatefulMigration) bool {
+	tmpl := m.Status.StatefulSetTemplate
+	return tmpl != nil && tmpl.SettledAt == nil
+}
+
+// pinTemplate pins the StatefulSet's pod template to the target node, so the
+// StatefulSet's update revision matches the replacement pod created there.
+// The change and the original update strategy are recorded in status before
+// the StatefulSet is patched. The strategy is OnDelete while the pin is in
+// place, so no other ordinal is rolled onto the target node.
+func (r *StatefulMigrationReconciler) pinTemplate(ctx context.Context, m *migrationv1alpha1.StatefulMigration) error {
+	logger := log.FromContext(ctx)
+
+	sts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: m.Status.StatefulSetName, Namespace: m.Namespace}, sts); err != nil {
+		return fmt.Errorf("get StatefulSet %q: %w", m.Status.StatefulSetName, err)
+	}
+
+	if m.Status.StatefulSetTemplate == nil {
+		// A paused ordinal already switched the StatefulSet to OnDelete
+		// and recorded the strategy it replaced.
+		original := sts.Spec.UpdateStrategy.DeepCopy()
+		if pausedOrdinal(m) && m.Status.OrdinalReservation.OriginalUpdateStrategy != nil {
+			original = m.Status.OrdinalReservation.OriginalUpdateStrategy.DeepCopy()
+		}
+		patch := client.MergeFrom(m.DeepCopy())
+		m.Status.StatefulSetTemplate = &migrationv1alpha1.StatefulSetTemplateStatus{
+			Mutations: []migrationv1alpha1.TemplateMutationStatus{{
+				Field:    templateHostnameField,
+				Original: sts.Spec.Template.Spec.NodeSelector[hostnameLabel],
+				Applied:  m.Spec.TargetNode,
+			}},
+			OriginalUpdateStrategy: original,
+		}
+		if err := r.Status().Patch(ctx, m, patch); err != nil {
+			return err
+		}
+	}
+
+	if sts.Spec.Template.Spec.NodeSelector[hostnameLabel] == m.Spec.TargetNode &&
+		sts.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		return nil
+	}
+	stsPatch := client.MergeFrom(sts.DeepCopy())
+	sts.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType}
+	if sts.Spec.Template.Spec.NodeSelector == nil {
+		sts.Spec.Template.Spec.NodeSelector = make(map[string]string)
+	}
+	sts.Spec.Template.Spec.NodeSelector[hostnameLabel] = m.Spec.TargetNode
+	if err := r.Patch(ctx, sts, stsPatch); err != nil {
+		return fmt.Errorf("pin StatefulSet %q template: %w", m.Status.StatefulSetName, err)
+	}
+	logger.Info("Pinned StatefulSet template to the target node", "statefulset", m.Status.StatefulSetName,
+		"targetNode", m.Spec.TargetNode)
+	return nil
+}
+
+// settlePodSpec applies placement to the template changes recorded in tmpl:
+// Required keeps the pin, None reverts it, and Preferred reverts it and adds
+// a preferred node affinity term for node instead.
+func settlePodSpec(spec *corev1.PodSpec, tmpl *migrationv1alpha1.StatefulSetTemplateStatus, placement, node string) {
+	if placement == placementRequired {
+		return
+	}
+	for _, mut := range tmpl.Mutations {
+		if mut.Field != templateHostnameField {
+			continue
+		}
+		if mut.Original != "" {
+			spec.NodeSelector[hostnameLabel] = mut.Original
+			continue
+		}
+		delete(spec.NodeSelector, hostnameLabel)
+		if len(spec.NodeSelector) == 0 {
+			spec.NodeSelector = nil
+		}
+	}
+	if placement == placementPreferred {
+		placePodSpec(spec, placementPreferred, node)
+	}
+}
+
+// settleTemplate settles the swap's template changes once the StatefulSet
+// has adopted podName, following spec.statefulSetPlacement. The template is
+// patched first, while the strategy is still OnDelete. Once the StatefulSet
+// has observed it, podName's controller-revision-hash is set to the new
+// update revision and the original update strategy is restored, so the
+// migrated pod is not restarted. Returns done=true once settled.
+func (r *StatefulMigrationReconciler) settleTemplate(ctx context.Context, m *migrationv1alpha1.StatefulMigration, podName string) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+	if !templatePending(m) {
+		return ctrl.Result{}, true, nil
+	}
+	placement := m.Spec.StatefulSetPlacement
+	if placement == "" {
+		placement = placementNone
+	}
+
+	sts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: m.Status.StatefulSetName, Namespace: m.Namespace}, sts); err == nil {
+		settled := sts.DeepCopy()
+		settlePodSpec(&settled.Spec.Template.Spec, m.Status.StatefulSetTemplate, placement, m.Spec.TargetNode)
+		if !equality.Semantic.DeepEqual(settled.Spec.Template, sts.Spec.Template) {
+			if err := r.Patch(ctx, settled, client.MergeFrom(sts)); err != nil {
+				return ctrl.Result{}, false, err
+			}
+			logger.Info("Settled StatefulSet template", "statefulset", m.Status.StatefulSetName, "placement", placement)
+			return ctrl.Result{RequeueAfter: time.Second}, false, nil
+		}
+		if sts.Status.ObservedGeneration < sts.Generation {
+			logger.Info("Waiting for StatefulSet to observe the settled template", "statefulset", m.Status.StatefulSetName)
+			return ctrl.Result{RequeueAfter: time.Second}, false, nil
+		}
+
+		pod := &corev1.Pod{}
+		if err := r.Get(ctx, types.NamespacedName{Name: podName, Namespace: m.Namespace}, pod); err == nil {
+			if err := r.matchUpdateRevision(ctx, pod, sts); err != nil {
+				return ctrl.Result{}, false, err
+			}
+		} else if !errors.IsNotFound(err) {
+			return ctrl.Result{}, false, err
+		}
+
+		// A paused ordinal keeps OnDelete until it is released.
+		if original := m.Status.StatefulSetTemplate.OriginalUpdateStrategy; original != nil && !pausedOrdinal(m) {
+			stsPatch := client.MergeFrom(sts.DeepCopy())
+			sts.Spec.UpdateStrategy = *original
+			if err := r.Patch(ctx, sts, stsPatch); err != nil {
+				return ctrl.Result{}, false, err
+			}
+		}
+	} else if !errors.IsNotFound(err) {
+		return ctrl.Result{}, false, err
+	}
+
+	patch := client.MergeFrom(m.DeepCopy())
+	now := metav1.Now()
+	m.Status.StatefulSetTemplate.Placement = placement
+	m.Status.StatefulSetTemplate.SettledAt = &now
+	if err := r.Status().Patch(ctx, m, patch); err != nil {
+		return ctrl.Result{}, false, err
+	}
+	return ctrl.Result{}, true, nil
+}
+
+// revertTemplate undoes the swap's template changes in one patch and reports
+// whether the StatefulSet changed. Used by abort, where no pod has to be
+// kept; a paused ordinal keeps the StatefulSet at OnDelete.
+func (r *StatefulMigrationReconciler) revertTemplate(ctx context.Context, m *migrationv1alpha1.StatefulMigration) bool {
+	logger := log.FromContext(ctx)
+	if !templatePending(m) {
+		return false
+	}
+
+	sts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: m.Status.StatefulSetName, Namespace: m.Namespace}, sts); err != nil {
+		if !errors.IsNotFound(err) {
+			logger.Error(err, "Abort: failed to look up StatefulSet", "statefulset", m.Status.StatefulSetName)
+		}
+		return false
+	}
+	before := sts.DeepCopy()
+	settlePodSpec(&sts.Spec.Template.Spec, m.Status.StatefulSetTemplate, placementNone, m.Spec.TargetNode)
+	if original := m.Status.StatefulSetTemplate.OriginalUpdateStrategy; original != nil && !pausedOrdinal(m) {
+		sts.Spec.UpdateStrategy = *original
+	}
+	if equality.Semantic.DeepEqual(before.Spec, sts.Spec) {
+		return false
+	}
+	if err := r.Patch(ctx, sts, client.MergeFrom(before)); err != nil {
+		logger.Error(err, "Abort: failed to revert StatefulSet template", "statefulset", m.Status.StatefulSetName)
+		return false
+	}
+	return true
+}
+
+// matchUpdateRevision sets pod's controller-revision-hash to the
+// StatefulSet's update revision, so adopting the pod does not roll it.
+func (r *StatefulMigrationReconciler) matchUpdateRevision(ctx context.Context, pod *corev1.Pod, sts *appsv1.StatefulSet) error {
+	revision := sts.Status.UpdateRevision
+	if revision == "" || pod.Labels["controller-revision-hash"] == revision {
+		return nil
+	}
+	podPatch := client.MergeFrom(pod.DeepCopy())
+	if pod.Labels == nil {
+		pod.Labels = make(map[string]string)
+	}
+	pod.Labels["controller-revision-hash"] = revision
+	return r.Patch(ctx, pod, podPatch)
+}
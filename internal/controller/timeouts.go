@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+)
+
+// Built-in defaults for the timings tunable through spec.timeouts.
+const (
+	defaultReplayStallTimeout        = 30 * time.Second
+	defaultMiniReplayCutoff          = 15 * time.Second
+	defaultPreFenceObservationWindow = 3 * time.Second
+	defaultFenceTimeThreshold        = 60 * time.Second
+	defaultParallelDrainStallTimeout = 30 * time.Second
+	defaultParallelDrainMaxTimeout   = 120 * time.Second
+	defaultParallelDrainPollInterval = 2 * time.Second
+	defaultSourceFenceTimeout        = 10 * time.Second
+)
+
+// swapSubPhases lists every identity swap sub-phase, for validating
+// spec.timeouts.swapSubPhaseSeconds.
+var swapSubPhases = map[string]bool{
+	"PrepareSwap":       true,
+	"ReCheckpoint":      true,
+	"SwapTransfer":      true,
+	"CreateReplacement": true,
+	"MiniReplay":        true,
+	"TrafficSwitch":     true,
+	"PreFenceDrain":     true,
+	"ExchangeFence":     true,
+	"ParallelDrain":     true,
+	"FenceCutover":      true,
+}
+
+// seconds converts a spec value to a duration, using def when it is unset.
+func seconds(v int32, def time.Duration) time.Duration {
+	if v <= 0 {
+		return def
+	}
+	return time.Duration(v) * time.Second
+}
+
+// timeouts returns spec.timeouts, or an empty value when unset.
+func timeouts(m *migrationv1alpha1.StatefulMigration) migrationv1alpha1.MigrationTimeouts {
+	if m.Spec.Timeouts == nil {
+		return migrationv1alpha1.MigrationTimeouts{}
+	}
+	return *m.Spec.Timeouts
+}
+
+// fenceTuning returns spec.timeouts.exchangeFence, or an empty value when unset.
+func fenceTuning(m *migrationv1alpha1.StatefulMigration) migrationv1alpha1.ExchangeFenceTuning {
+	if t := timeouts(m); t.ExchangeFence != nil {
+		return *t.ExchangeFence
+	}
+	return migrationv1alpha1.ExchangeFenceTuning{}
+}
+
+func replayStallTimeout(m *migrationv1alpha1.StatefulMigration) time.Duration {
+	return seconds(timeouts(m).ReplayStallSeconds, defaultReplayStallTimeout)
+}
+
+func miniReplayCutoff(m *migrationv1alpha1.StatefulMigration) time.Duration {
+	return seconds(timeouts(m).MiniReplayCutoffSeconds, defaultMiniReplayCutoff)
+}
+
+func preFenceObservationWindow(m *migrationv1alpha1.StatefulMigration) time.Duration {
+	return seconds(fenceTuning(m).ObservationWindowSeconds, defaultPreFenceObservationWindow)
+}
+
+func fenceTimeThreshold(m *migrationv1alpha1.StatefulMigration) time.Duration {
+	return seconds(fenceTuning(m).FenceTimeThresholdSeconds, defaultFenceTimeThreshold)
+}
+
+func parallelDrainStallTimeout(m *migrationv1alpha1.StatefulMigration) time.Duration {
+	return seconds(fenceTuning(m).ParallelDrainStallSeconds, defaultParallelDrainStallTimeout)
+}
+
+func parallelDrainMaxTimeout(m *migrationv1alpha1.StatefulMigration) time.Duration {
+	return seconds(fenceTuning(m).ParallelDrainMaxSeconds, defaultParallelDrainMaxTimeout)
+}
+
+func parallelDrainPollInterval(m *migrationv1alpha1.StatefulMigration) time.Duration {
+	return seconds(fenceTuning(m).ParallelDrainPollIntervalSeconds, defaultParallelDrainPollInterval)
+}
+
+func sourceFenceTimeout(m *migrationv1alpha1.StatefulMigration) time.Duration {
+	return seconds(timeouts(m).SourceFenceSeconds, defaultSourceFenceTimeout)
+}
+
+// validateTimeouts rejects spec.timeouts values the controller cannot act on.
+func validateTimeouts(m *migrationv1alpha1.StatefulMigration) error {
+	t := timeouts(m)
+	switch t.OnExpiry {
+	case "", "Fail", "Abort":
+	default:
+		return fmt.Errorf("spec.timeouts.onExpiry %q must be Fail or Abort", t.OnExpiry)
+	}
+	switch t.OnSourceFenceTimeout {
+	case "", "Fail", "Delete":
+	default:
+		return fmt.Errorf("spec.timeouts.onSourceFenceTimeout %q must be Fail or Delete", t.OnSourceFenceTimeout)
+	}
+	for name := range t.SwapSubPhaseSeconds {
+		if !swapSubPhases[name] {
+			return fmt.Errorf("spec.timeouts.swapSubPhaseSeconds has unknown sub-phase %q", name)
+		}
+	}
+	return nil
+}
+
+// phaseDeadline returns the configured deadline for a phase, or zero.
+func phaseDeadline(t migrationv1alpha1.MigrationTimeouts, phase migrationv1alpha1.Phase) time.Duration {
+	var v int32
+	switch phase {
+	case migrationv1alpha1.PhasePending:
+		v = t.PendingSeconds
+	case migrationv1alpha1.PhaseCheckpointing:
+		v = t.CheckpointingSeconds
+	case migrationv1alpha1.PhaseTransferring:
+		v = t.TransferringSeconds
+	case migrationv1alpha1.PhaseRestoring:
+		v = t.RestoringSeconds
+	case migrationv1alpha1.PhaseReplaying:
+		v = t.ReplayingSeconds
+	case migrationv1alpha1.PhaseFinalizing:
+		v = t.FinalizingSeconds
+	}
+	return seconds(v, 0)
+}
+
+// checkDeadlines stamps the start of the current phase and swap sub-phase in
+// PhaseTimings (as "Deadline.<name>") the first time they are reconciled and
+// returns a description of the first deadline that has passed, or "" if none
+// has. Stamps are only written when a matching deadline is configured.
+func (r *StatefulMigrationReconciler) checkDeadlines(ctx context.Context, m *migrationv1alpha1.StatefulMigration) string {
+	if m.Spec.Timeouts == nil {
+		return ""
+	}
+	t := *m.Spec.Timeouts
+	now := time.Now()
+
+	if limit := seconds(t.MigrationSeconds, 0); limit > 0 {
+		start := m.CreationTimestamp.Time
+		if m.Status.StartTime != nil {
+			start = m.Status.StartTime.Time
+		}
+		if !start.IsZero() && now.Sub(start) > limit {
+			return fmt.Sprintf("migration deadline of %s exceeded", limit)
+		}
+	}
+
+	type deadline struct {
+		key, name string
+		limit     time.Duration
+	}
+	var deadlines []deadline
+	if limit := phaseDeadline(t, m.Status.Phase); limit > 0 {
+		deadlines = append(deadlines, deadline{"Deadline." + string(m.Status.Phase), string(m.Status.Phase) + " phase", limit})
+	}
+	if sub := m.Status.SwapSubPhase; sub != "" {
+		if limit := seconds(t.SwapSubPhaseSeconds[sub], 0); limit > 0 {
+			deadlines = append(deadlines, deadline{"Deadline.Swap." + sub, sub + " swap sub-phase", limit})
+		}
+	}
+
+	var stamp []string
+	for _, d := range deadlines {
+		startStr, ok := m.Status.PhaseTimings[d.key]
+		if !ok {
+			stamp = append(stamp, d.key)
+			continue
+		}
+		if start, err := time.Parse(time.RFC3339, startStr); err == nil && now.Sub(start) > d.limit {
+			return fmt.Sprintf("%s deadline of %s exceeded", d.name, d.limit)
+		}
+	}
+	if len(stamp) > 0 {
+		patch := client.MergeFrom(m.DeepCopy())
+		ensurePhaseTimings(m)
+		for _, key := range stamp {
+			m.Status.PhaseTimings[key] = now.Format(time.RFC3339)
+		}
+		if err := r.Status().Patch(ctx, m, patch); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to record deadline start")
+		}
+	}
+	return ""
+}
+
+// handleDeadlineExceeded applies spec.timeouts.onExpiry. At a safe point the
+// migration is rolled back either way, so no target pod, Job or replay queue
+// is left behind, and ends Aborted or Failed. Past it, the migration fails
+// as it stands.
+func (r *StatefulMigrationReconciler) handleDeadlineExceeded(ctx context.Context, m *migrationv1alpha1.StatefulMigration, reason string) (ctrl.Result, error) {
+	if !abortSafe(m) {
+		return r.failMigration(ctx, m, reason)
+	}
+	phase := migrationv1alpha1.PhaseFailed
+	if timeouts(m).OnExpiry == "Abort" {
+		phase = migrationv1alpha1.PhaseAborted
+	}
+	return r.rollback(ctx, m, phase, "DeadlineExceeded", reason)
+}
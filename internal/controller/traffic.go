@@ -0,0 +1,235 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+)
+
+// Traffic handover modes, for spec.trafficHandover.mode.
+const (
+	handoverLabelFlip = "LabelFlip"
+	handoverNone      = "None"
+)
+
+const (
+	defaultEndpointTimeout = 10 * time.Second
+
+	// endpointPollInterval is how often EndpointSlices are checked while
+	// waiting for a label change to take effect.
+	endpointPollInterval = 500 * time.Millisecond
+)
+
+// trafficHandover returns spec.trafficHandover, or an empty value when unset.
+func trafficHandover(m *migrationv1alpha1.StatefulMigration) migrationv1alpha1.TrafficHandover {
+	if m.Spec.TrafficHandover == nil {
+		return migrationv1alpha1.TrafficHandover{}
+	}
+	return *m.Spec.TrafficHandover
+}
+
+func endpointTimeout(m *migrationv1alpha1.StatefulMigration) time.Duration {
+	return seconds(trafficHandover(m).EndpointTimeoutSeconds, defaultEndpointTimeout)
+}
+
+// validateTrafficHandover rejects spec.trafficHandover values the controller
+// cannot act on.
+func validateTrafficHandover(m *migrationv1alpha1.StatefulMigration) error {
+	switch mode := trafficHandover(m).Mode; mode {
+	case "", handoverLabelFlip, handoverNone:
+		return nil
+	default:
+		return fmt.Errorf("spec.trafficHandover.mode %q must be LabelFlip or None", mode)
+	}
+}
+
+// labelFlipEnabled reports whether the shadow pod is kept out of Service
+// endpoints until Finalizing, for strategies that run the source and the
+// target side by side behind the same Services.
+func labelFlipEnabled(m *migrationv1alpha1.StatefulMigration) bool {
+	return strategyCapabilities(m).SharesServices && trafficHandover(m).Mode != handoverNone
+}
+
+// holdServiceLabels finds the Services selecting the source pod and removes
+// the labels they select on from the shadow pod's labels, recording them in
+// status.trafficHandover. Migration labels are never withheld.
+func (r *StatefulMigrationReconciler) holdServiceLabels(ctx context.Context, m *migrationv1alpha1.StatefulMigration, sourceLabels, shadowLabels map[string]string) error {
+	services := &corev1.ServiceList{}
+	if err := r.List(ctx, services, client.InNamespace(m.Namespace)); err != nil {
+		return err
+	}
+
+	var names []string
+	held := map[string]string{}
+	for _, svc := range services.Items {
+		if len(svc.Spec.Selector) == 0 || !labels.SelectorFromSet(svc.Spec.Selector).Matches(labels.Set(sourceLabels)) {
+			continue
+		}
+		names = append(names, svc.Name)
+		for k := range svc.Spec.Selector {
+			if !strings.HasPrefix(k, "migration.ms2m.io/") {
+				held[k] = sourceLabels[k]
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	for k := range held {
+		delete(shadowLabels, k)
+	}
+
+	patch := client.MergeFrom(m.DeepCopy())
+	m.Status.TrafficHandover = &migrationv1alpha1.TrafficHandoverStatus{
+		Services:   names,
+		HeldLabels: held,
+	}
+	if err := r.Status().Patch(ctx, m, patch); err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("Holding Service labels back from the shadow pod", "services", names)
+	return nil
+}
+
+// handoverTraffic moves Service traffic from the source pod to the shadow
+// pod: it adds the held labels to the shadow, waits for the shadow to be a
+// ready endpoint of every Service, removes the labels from the source and
+// waits for the source to leave the endpoints. Each wait is bounded by
+// spec.trafficHandover.endpointTimeoutSeconds. Returns done=true once the
+// handover is complete, or when there is nothing to hand over.
+func (r *StatefulMigrationReconciler) handoverTraffic(ctx context.Context, m *migrationv1alpha1.StatefulMigration) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+	th := m.Status.TrafficHandover
+	if th == nil || len(th.HeldLabels) == 0 || th.Switchover != "" {
+		return ctrl.Result{}, true, nil
+	}
+
+	if th.ShadowAddedAt == nil {
+		shadow := &corev1.Pod{}
+		if err := r.Get(ctx, types.NamespacedName{Name: m.Status.TargetPod, Namespace: m.Namespace}, shadow); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		podPatch := client.MergeFrom(shadow.DeepCopy())
+		if shadow.Labels == nil {
+			shadow.Labels = map[string]string{}
+		}
+		for k, v := range th.HeldLabels {
+			shadow.Labels[k] = v
+		}
+		if err := r.Patch(ctx, shadow, podPatch); err != nil {
+			return ctrl.Result{}, false, err
+		}
+
+		patch := client.MergeFrom(m.DeepCopy())
+		now := metav1.Now()
+		m.Status.TrafficHandover.ShadowAddedAt = &now
+		if err := r.Status().Patch(ctx, m, patch); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		// The patch decodes the response into m.
+		th = m.Status.TrafficHandover
+		logger.Info("Added Service labels to shadow pod", "pod", m.Status.TargetPod, "services", th.Services)
+	}
+
+	if th.SourceRemovedAt == nil {
+		inAll, err := r.inEndpoints(ctx, m.Namespace, th.Services, m.Status.TargetPod, true)
+		if err != nil {
+			return ctrl.Result{}, false, err
+		}
+		if !inAll {
+			if time.Since(th.ShadowAddedAt.Time) <= endpointTimeout(m) {
+				logger.Info("Waiting for shadow pod to become a ready Service endpoint", "pod", m.Status.TargetPod)
+				return ctrl.Result{RequeueAfter: endpointPollInterval}, false, nil
+			}
+			logger.Info("Shadow pod not listed in all Service endpoints in time, continuing",
+				"pod", m.Status.TargetPod, "timeout", endpointTimeout(m))
+		}
+
+		source := &corev1.Pod{}
+		err = r.Get(ctx, types.NamespacedName{Name: m.Spec.SourcePod, Namespace: m.Namespace}, source)
+		if err == nil {
+			podPatch := client.MergeFrom(source.DeepCopy())
+			for k := range th.HeldLabels {
+				delete(source.Labels, k)
+			}
+			if err := r.Patch(ctx, source, podPatch); err != nil && !errors.IsNotFound(err) {
+				return ctrl.Result{}, false, err
+			}
+		} else if !errors.IsNotFound(err) {
+			return ctrl.Result{}, false, err
+		}
+
+		patch := client.MergeFrom(m.DeepCopy())
+		now := metav1.Now()
+		m.Status.TrafficHandover.SourceRemovedAt = &now
+		if err := r.Status().Patch(ctx, m, patch); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		th = m.Status.TrafficHandover
+		logger.Info("Removed Service labels from source pod", "pod", m.Spec.SourcePod)
+	}
+
+	inAny, err := r.inEndpoints(ctx, m.Namespace, th.Services, m.Spec.SourcePod, false)
+	if err != nil {
+		return ctrl.Result{}, false, err
+	}
+	if inAny && time.Since(th.SourceRemovedAt.Time) <= endpointTimeout(m) {
+		logger.Info("Waiting for source pod to leave Service endpoints", "pod", m.Spec.SourcePod)
+		return ctrl.Result{RequeueAfter: endpointPollInterval}, false, nil
+	}
+
+	patch := client.MergeFrom(m.DeepCopy())
+	switchover := time.Since(th.ShadowAddedAt.Time).Round(time.Millisecond).String()
+	m.Status.TrafficHandover.Switchover = switchover
+	if err := r.Status().Patch(ctx, m, patch); err != nil {
+		return ctrl.Result{}, false, err
+	}
+	logger.Info("Service traffic handed over to shadow pod", "pod", m.Status.TargetPod, "switchover", switchover)
+	return ctrl.Result{}, true, nil
+}
+
+// inEndpoints reports whether pod is an endpoint of the Services. With all
+// set it must be a ready endpoint of every Service; otherwise it is enough
+// to be listed by any of them.
+func (r *StatefulMigrationReconciler) inEndpoints(ctx context.Context, namespace string, services []string, pod string, all bool) (bool, error) {
+	for _, svc := range services {
+		slices := &discoveryv1.EndpointSliceList{}
+		if err := r.List(ctx, slices, client.InNamespace(namespace),
+			client.MatchingLabels{discoveryv1.LabelServiceName: svc}); err != nil {
+			return false, err
+		}
+		found := false
+		for _, slice := range slices.Items {
+			for _, ep := range slice.Endpoints {
+				if ep.TargetRef == nil || ep.TargetRef.Kind != "Pod" || ep.TargetRef.Name != pod {
+					continue
+				}
+				if !all || ep.Conditions.Ready == nil || *ep.Conditions.Ready {
+					found = true
+				}
+			}
+		}
+		if all && !found {
+			return false, nil
+		}
+		if !all && found {
+			return true, nil
+		}
+	}
+	return all, nil
+}
@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+)
+
+// Built-in transfer Job defaults, used when neither the controller
+// configuration nor the migration sets a value.
+const (
+	defaultTransferImage      = "localhost/checkpoint-transfer:latest"
+	defaultAgentImage         = "localhost/ms2m-agent:latest"
+	defaultCheckpointHostPath = "/var/lib/kubelet/checkpoints"
+)
+
+// LoadTransferJobConfig reads controller-wide transfer Job defaults from a
+// YAML (or JSON) file, typically a mounted ConfigMap key. The file uses the
+// same schema as spec.transferJob.
+func LoadTransferJobConfig(path string) (migrationv1alpha1.TransferJobSpec, error) {
+	var cfg migrationv1alpha1.TransferJobSpec
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("read transfer job config: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse transfer job config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// effectiveTransferJob merges the built-in defaults, the controller-wide
+// TransferJob configuration and the migration's spec.transferJob, in
+// increasing order of precedence.
+func (r *StatefulMigrationReconciler) effectiveTransferJob(m *migrationv1alpha1.StatefulMigration) migrationv1alpha1.TransferJobSpec {
+	spec := migrationv1alpha1.TransferJobSpec{
+		Image:              defaultTransferImage,
+		AgentImage:         defaultAgentImage,
+		ImagePullPolicy:    corev1.PullIfNotPresent,
+		CheckpointHostPath: defaultCheckpointHostPath,
+		InsecureRegistry:   func() *bool { b := true; return &b }(),
+		SecurityContext: &corev1.SecurityContext{
+			RunAsUser:  func() *int64 { uid := int64(0); return &uid }(),
+			RunAsGroup: func() *int64 { gid := int64(0); return &gid }(),
+		},
+	}
+	overlayTransferJob(&spec, r.TransferJob.DeepCopy())
+	overlayTransferJob(&spec, m.Spec.TransferJob.DeepCopy())
+	return spec
+}
+
+// overlayTransferJob copies every field that is set in override onto spec.
+func overlayTransferJob(spec, override *migrationv1alpha1.TransferJobSpec) {
+	if override == nil {
+		return
+	}
+	if override.Image != "" {
+		spec.Image = override.Image
+	}
+	if override.AgentImage != "" {
+		spec.AgentImage = override.AgentImage
+	}
+	if override.ImagePullPolicy != "" {
+		spec.ImagePullPolicy = override.ImagePullPolicy
+	}
+	if len(override.ImagePullSecrets) > 0 {
+		spec.ImagePullSecrets = override.ImagePullSecrets
+	}
+	if override.ServiceAccountName != "" {
+		spec.ServiceAccountName = override.ServiceAccountName
+	}
+	if override.PriorityClassName != "" {
+		spec.PriorityClassName = override.PriorityClassName
+	}
+	if override.Resources != nil {
+		spec.Resources = override.Resources
+	}
+	if len(override.Tolerations) > 0 {
+		spec.Tolerations = override.Tolerations
+	}
+	if override.SecurityContext != nil {
+		spec.SecurityContext = override.SecurityContext
+	}
+	if override.CheckpointHostPath != "" {
+		spec.CheckpointHostPath = override.CheckpointHostPath
+	}
+	if override.InsecureRegistry != nil {
+		spec.InsecureRegistry = override.InsecureRegistry
+	}
+	if override.ActiveDeadlineSeconds != nil {
+		spec.ActiveDeadlineSeconds = override.ActiveDeadlineSeconds
+	}
+	if override.BackoffLimit != nil {
+		spec.BackoffLimit = override.BackoffLimit
+	}
+}
+
+// applyTransferJobSpec applies the pod- and Job-level settings shared by the
+// checkpoint-transfer and local-load Jobs. Container-specific fields (image,
+// security context) are set by the callers.
+func applyTransferJobSpec(job *batchv1.Job, spec migrationv1alpha1.TransferJobSpec) {
+	job.Spec.ActiveDeadlineSeconds = spec.ActiveDeadlineSeconds
+	job.Spec.BackoffLimit = spec.BackoffLimit
+
+	podSpec := &job.Spec.Template.Spec
+	podSpec.ImagePullSecrets = spec.ImagePullSecrets
+	podSpec.ServiceAccountName = spec.ServiceAccountName
+	podSpec.PriorityClassName = spec.PriorityClassName
+	podSpec.Tolerations = spec.Tolerations
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].ImagePullPolicy = spec.ImagePullPolicy
+		if spec.Resources != nil {
+			podSpec.Containers[i].Resources = *spec.Resources
+		}
+	}
+}
+
+// transferEnv renders the environment for the checkpoint-transfer container.
+// The binary treats any non-empty INSECURE_REGISTRY as true, so the variable
+// is omitted entirely for secure registries.
+func transferEnv(spec migrationv1alpha1.TransferJobSpec) []corev1.EnvVar {
+	if spec.InsecureRegistry != nil && !*spec.InsecureRegistry {
+		return nil
+	}
+	return []corev1.EnvVar{{Name: "INSECURE_REGISTRY", Value: "true"}}
+}
+
+// jobFailed reports whether the Job controller has marked the Job as Failed
+// (backoff limit or active deadline exceeded), along with the reason.
+func jobFailed(job *batchv1.Job) (bool, string) {
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			if c.Message != "" {
+				return true, fmt.Sprintf("%s: %s", c.Reason, c.Message)
+			}
+			return true, c.Reason
+		}
+	}
+	return false, ""
+}
@@ -0,0 +1,526 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	migrationv1alpha1 "github.com/haidinhtuan/kubernetes-controller/api/v1alpha1"
+	"github.com/haidinhtuan/kubernetes-controller/internal/retry"
+)
+
+// Volume handling, recorded in status.volumes[].handling.
+const (
+	volumeShared     = "Shared"
+	volumeAttachable = "Attachable"
+	volumeLocal      = "Local"
+)
+
+// agentTokenSecret is the Secret in ms2m-system holding the token the
+// ms2m-agents require on volume copy requests, under the key "token".
+const agentTokenSecret = "ms2m-agent-token"
+
+// volumeCopyPollInterval is how often a running volume copy is polled.
+const volumeCopyPollInterval = 2 * time.Second
+
+// inspectVolumes lists the PersistentVolumeClaims mounted by the source pod
+// and classifies how each can follow the pod to another node.
+func (r *StatefulMigrationReconciler) inspectVolumes(ctx context.Context, pod *corev1.Pod) ([]migrationv1alpha1.VolumeStatus, error) {
+	var volumes []migrationv1alpha1.VolumeStatus
+	for _, v := range pod.Spec.Volumes {
+		if v.PersistentVolumeClaim == nil {
+			continue
+		}
+		pvc := &corev1.PersistentVolumeClaim{}
+		if err := r.Get(ctx, types.NamespacedName{Name: v.PersistentVolumeClaim.ClaimName, Namespace: pod.Namespace}, pvc); err != nil {
+			return nil, fmt.Errorf("get claim %q: %w", v.PersistentVolumeClaim.ClaimName, err)
+		}
+		if pvc.Spec.VolumeName == "" {
+			return nil, fmt.Errorf("claim %q is not bound", pvc.Name)
+		}
+		pv := &corev1.PersistentVolume{}
+		if err := r.Get(ctx, types.NamespacedName{Name: pvc.Spec.VolumeName}, pv); err != nil {
+			return nil, fmt.Errorf("get volume %q: %w", pvc.Spec.VolumeName, err)
+		}
+		vs := migrationv1alpha1.VolumeStatus{
+			Name:             v.Name,
+			ClaimName:        pvc.Name,
+			PersistentVolume: pv.Name,
+			Handling:         classifyVolume(pvc, pv),
+		}
+		if vs.Handling == volumeLocal {
+			vs.Path = localVolumePath(pv)
+		}
+		volumes = append(volumes, vs)
+	}
+	return volumes, nil
+}
+
+// classifyVolume decides how a claim follows the pod: claims that may be
+// mounted from several nodes are shared, local and hostPath volumes have their
+// data copied, and everything else is detached and reattached.
+func classifyVolume(pvc *corev1.PersistentVolumeClaim, pv *corev1.PersistentVolume) string {
+	for _, mode := range pvc.Spec.AccessModes {
+		if mode == corev1.ReadWriteMany || mode == corev1.ReadOnlyMany {
+			return volumeShared
+		}
+	}
+	if localVolumePath(pv) != "" {
+		return volumeLocal
+	}
+	return volumeAttachable
+}
+
+// localVolumePath returns the node directory behind a local or hostPath
+// volume, or "" for other volume types.
+func localVolumePath(pv *corev1.PersistentVolume) string {
+	switch {
+	case pv.Spec.Local != nil:
+		return pv.Spec.Local.Path
+	case pv.Spec.HostPath != nil:
+		return pv.Spec.HostPath.Path
+	}
+	return ""
+}
+
+// unsharedVolume returns the first volume that cannot be mounted from two
+// nodes at once, or nil.
+func unsharedVolume(volumes []migrationv1alpha1.VolumeStatus) *migrationv1alpha1.VolumeStatus {
+	for i := range volumes {
+		if volumes[i].Handling != volumeShared {
+			return &volumes[i]
+		}
+	}
+	return nil
+}
+
+// hasVolumes reports whether any volume needs the given handling.
+func hasVolumes(m *migrationv1alpha1.StatefulMigration, handling string) bool {
+	for _, v := range m.Status.Volumes {
+		if v.Handling == handling {
+			return true
+		}
+	}
+	return false
+}
+
+// handleVolumes moves the source pod's volumes to the target node during a
+// Sequential restore, after the source pod is gone and before the target pod
+// is created. It runs through the volume sub-phases:
+//
+//	DetachVolumes → CopyVolumes → RebindVolumes → VolumesReady
+//
+// Each step only acts on the volumes that need it and is skipped when there
+// are none. It returns true once the target pod may be created.
+func (r *StatefulMigrationReconciler) handleVolumes(ctx context.Context, m *migrationv1alpha1.StatefulMigration) (ctrl.Result, bool, error) {
+	for {
+		var res ctrl.Result
+		var done bool
+		var err error
+		next := ""
+
+		switch m.Status.VolumeSubPhase {
+		case "":
+			next = "DetachVolumes"
+			done = true
+		case "DetachVolumes":
+			next = "CopyVolumes"
+			res, done, err = r.detachVolumes(ctx, m)
+		case "CopyVolumes":
+			next = "RebindVolumes"
+			res, done, err = r.copyVolumes(ctx, m)
+		case "RebindVolumes":
+			next = "VolumesReady"
+			res, done, err = r.rebindVolumes(ctx, m)
+		case "VolumesReady":
+			return ctrl.Result{}, true, nil
+		default:
+			return ctrl.Result{}, false, fmt.Errorf("unknown volume sub-phase %q", m.Status.VolumeSubPhase)
+		}
+		if err != nil || !done {
+			return res, false, err
+		}
+
+		patch := client.MergeFrom(m.DeepCopy())
+		m.Status.VolumeSubPhase = next
+		if err := r.Status().Patch(ctx, m, patch); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		log.FromContext(ctx).Info("Volume sub-phase", "subPhase", next)
+	}
+}
+
+// detachVolumes waits until no Attachable volume is still attached to the
+// source node. The attach/detach controller detaches them once the source pod
+// is gone and reattaches them to the target node when the target pod starts.
+func (r *StatefulMigrationReconciler) detachVolumes(ctx context.Context, m *migrationv1alpha1.StatefulMigration) (ctrl.Result, bool, error) {
+	if !hasVolumes(m, volumeAttachable) {
+		return ctrl.Result{}, true, nil
+	}
+
+	attachments := &storagev1.VolumeAttachmentList{}
+	if err := r.List(ctx, attachments); err != nil {
+		return ctrl.Result{}, false, err
+	}
+	attached := make(map[string]bool)
+	for _, va := range attachments.Items {
+		if va.Spec.NodeName == m.Status.SourceNode && va.Spec.Source.PersistentVolumeName != nil {
+			attached[*va.Spec.Source.PersistentVolumeName] = true
+		}
+	}
+
+	patch := client.MergeFrom(m.DeepCopy())
+	waiting := ""
+	for i := range m.Status.Volumes {
+		v := &m.Status.Volumes[i]
+		if v.Handling != volumeAttachable || v.State == "Detached" {
+			continue
+		}
+		if attached[v.PersistentVolume] {
+			waiting = v.PersistentVolume
+			continue
+		}
+		v.State = "Detached"
+	}
+	if err := r.Status().Patch(ctx, m, patch); err != nil {
+		return ctrl.Result{}, false, err
+	}
+	if waiting != "" {
+		log.FromContext(ctx).Info("Waiting for volume to detach from source node", "volume", waiting, "node", m.Status.SourceNode)
+		return ctrl.Result{RequeueAfter: 2 * time.Second}, false, nil
+	}
+	return ctrl.Result{}, true, nil
+}
+
+// copyVolumes copies the data of every Local volume from the source node to
+// the same path on the target node, streamed from the source ms2m-agent to
+// the target one. The source agent copies in the background; each volume
+// is Copying until the agent reports the copy finished.
+func (r *StatefulMigrationReconciler) copyVolumes(ctx context.Context, m *migrationv1alpha1.StatefulMigration) (ctrl.Result, bool, error) {
+	if !hasVolumes(m, volumeLocal) {
+		return ctrl.Result{}, true, nil
+	}
+	logger := log.FromContext(ctx)
+
+	token, err := r.agentToken(ctx)
+	if err != nil {
+		res, err := r.RetryOrFail(ctx, m, "read agent token", err)
+		return res, false, err
+	}
+	sourceIP, err := r.findAgentPodIP(ctx, m.Status.SourceNode)
+	if err != nil {
+		res, err := r.RetryOrFail(ctx, m, "find agent for volume copy", err)
+		return res, false, err
+	}
+
+	copying := false
+	for i := range m.Status.Volumes {
+		v := &m.Status.Volumes[i]
+		if v.Handling != volumeLocal {
+			continue
+		}
+		switch v.State {
+		case "":
+			targetIP, err := r.findAgentPodIP(ctx, m.Spec.TargetNode)
+			if err != nil {
+				res, err := r.RetryOrFail(ctx, m, "find agent for volume copy", err)
+				return res, false, err
+			}
+			if err := r.callAgentVolumeSend(ctx, sourceIP, targetIP, token, m, v.PersistentVolume); err != nil {
+				res, err := r.RetryOrFail(ctx, m, "copy volume "+v.Name, err)
+				return res, false, err
+			}
+			logger.Info("Copying local volume", "volume", v.PersistentVolume, "path", v.Path)
+			patch := client.MergeFrom(m.DeepCopy())
+			v.State = "Copying"
+			if err := r.Status().Patch(ctx, m, patch); err != nil {
+				return ctrl.Result{}, false, err
+			}
+			copying = true
+		case "Copying":
+			status, err := r.callAgentVolumeStatus(ctx, sourceIP, token, m, v.PersistentVolume)
+			if isAgentNotFound(err) {
+				// The agent restarted and lost the copy; start it again.
+				logger.Info("Volume copy unknown to agent, restarting it", "volume", v.PersistentVolume)
+				status, err = agentVolumeCopy{}, nil
+			}
+			if err != nil {
+				res, err := r.RetryOrFail(ctx, m, "poll volume copy "+v.Name, err)
+				return res, false, err
+			}
+			if err := r.retrySucceeded(ctx, m, "poll volume copy "+v.Name); err != nil {
+				return ctrl.Result{}, false, err
+			}
+			if status.State == "Running" {
+				copying = true
+				continue
+			}
+			patch := client.MergeFrom(m.DeepCopy())
+			v.State = ""
+			if status.State == "Succeeded" {
+				v.State = "Copied"
+				logger.Info("Copied local volume", "volume", v.PersistentVolume, "path", v.Path)
+			}
+			if err := r.Status().Patch(ctx, m, patch); err != nil {
+				return ctrl.Result{}, false, err
+			}
+			if status.State == "Failed" {
+				res, err := r.RetryOrFail(ctx, m, "copy volume "+v.Name, retry.MarkTransient(fmt.Errorf("%s", status.Error)))
+				return res, false, err
+			}
+			copying = copying || v.State == ""
+		}
+	}
+	if copying {
+		return ctrl.Result{RequeueAfter: volumeCopyPollInterval}, false, nil
+	}
+	return ctrl.Result{}, true, nil
+}
+
+// agentToken reads the token the ms2m-agents require on volume copy
+// requests.
+func (r *StatefulMigrationReconciler) agentToken(ctx context.Context) (string, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: agentTokenSecret, Namespace: "ms2m-system"}, secret); err != nil {
+		if errors.IsNotFound(err) {
+			return "", retry.MarkPermanent(fmt.Errorf("copying local volumes requires Secret ms2m-system/%s with the ms2m-agent token", agentTokenSecret))
+		}
+		return "", err
+	}
+	token := string(secret.Data["token"])
+	if token == "" {
+		return "", retry.MarkPermanent(fmt.Errorf("Secret ms2m-system/%s has no token", agentTokenSecret))
+	}
+	return token, nil
+}
+
+// rebindVolumes points the claim of every copied Local volume at a new
+// PersistentVolume on the target node. The source volume is set to Retain
+// before its claim is deleted, so its data stays on the source node until an
+// operator removes it. The new claim is created from the volume's storage
+// class, access modes and size.
+func (r *StatefulMigrationReconciler) rebindVolumes(ctx context.Context, m *migrationv1alpha1.StatefulMigration) (ctrl.Result, bool, error) {
+	if !hasVolumes(m, volumeLocal) {
+		return ctrl.Result{}, true, nil
+	}
+	logger := log.FromContext(ctx)
+
+	for i := range m.Status.Volumes {
+		v := &m.Status.Volumes[i]
+		if v.Handling != volumeLocal || v.State != "Copied" {
+			continue
+		}
+
+		source := &corev1.PersistentVolume{}
+		if err := r.Get(ctx, types.NamespacedName{Name: v.PersistentVolume}, source); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		if source.Spec.PersistentVolumeReclaimPolicy != corev1.PersistentVolumeReclaimRetain {
+			pvPatch := client.MergeFrom(source.DeepCopy())
+			source.Spec.PersistentVolumeReclaimPolicy = corev1.PersistentVolumeReclaimRetain
+			if err := r.Patch(ctx, source, pvPatch); err != nil {
+				return ctrl.Result{}, false, err
+			}
+		}
+
+		target, err := r.targetVolume(ctx, m, source, v.ClaimName)
+		if err != nil {
+			return ctrl.Result{}, false, err
+		}
+		if err := r.Create(ctx, target); err != nil && !errors.IsAlreadyExists(err) {
+			return ctrl.Result{}, false, err
+		}
+
+		claim := &corev1.PersistentVolumeClaim{}
+		err = r.Get(ctx, types.NamespacedName{Name: v.ClaimName, Namespace: m.Namespace}, claim)
+		switch {
+		case err == nil && claim.Spec.VolumeName == target.Name:
+			// Already rebound on an earlier pass.
+		case err == nil && claim.DeletionTimestamp != nil:
+			logger.Info("Waiting for claim to be deleted", "claim", v.ClaimName)
+			return ctrl.Result{RequeueAfter: time.Second}, false, nil
+		case err == nil:
+			// The claim's metadata is recorded first so that the claim
+			// replacing it keeps its labels, annotations and owners.
+			if v.Claim == nil {
+				patch := client.MergeFrom(m.DeepCopy())
+				v.Claim = claimMetadata(claim)
+				if err := r.Status().Patch(ctx, m, patch); err != nil {
+					return ctrl.Result{}, false, err
+				}
+			}
+			if err := r.Delete(ctx, claim); err != nil && !errors.IsNotFound(err) {
+				return ctrl.Result{}, false, err
+			}
+			logger.Info("Deleted claim bound to source volume", "claim", v.ClaimName, "volume", source.Name)
+			return ctrl.Result{RequeueAfter: time.Second}, false, nil
+		case errors.IsNotFound(err):
+			if err := r.Create(ctx, reboundClaim(m, v, source, target)); err != nil && !errors.IsAlreadyExists(err) {
+				return ctrl.Result{}, false, err
+			}
+			logger.Info("Rebound claim to target volume", "claim", v.ClaimName, "volume", target.Name)
+		default:
+			return ctrl.Result{}, false, err
+		}
+
+		patch := client.MergeFrom(m.DeepCopy())
+		v.TargetVolume = target.Name
+		v.State = "Rebound"
+		if err := r.Status().Patch(ctx, m, patch); err != nil {
+			return ctrl.Result{}, false, err
+		}
+	}
+	return ctrl.Result{}, true, nil
+}
+
+// targetVolume builds the PersistentVolume for a copied Local volume: the
+// source volume's spec, pinned to the target node and pre-bound to claimName.
+func (r *StatefulMigrationReconciler) targetVolume(ctx context.Context, m *migrationv1alpha1.StatefulMigration, source *corev1.PersistentVolume, claimName string) (*corev1.PersistentVolume, error) {
+	hostname := m.Spec.TargetNode
+	node := &corev1.Node{}
+	if err := r.Get(ctx, types.NamespacedName{Name: m.Spec.TargetNode}, node); err == nil {
+		if h := node.Labels[corev1.LabelHostname]; h != "" {
+			hostname = h
+		}
+	} else if !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	labels := map[string]string{"migration.ms2m.io/migration": m.Name}
+	for k, v := range source.Labels {
+		if _, exists := labels[k]; !exists {
+			labels[k] = v
+		}
+	}
+
+	spec := *source.Spec.DeepCopy()
+	spec.ClaimRef = &corev1.ObjectReference{
+		Kind:      "PersistentVolumeClaim",
+		Namespace: m.Namespace,
+		Name:      claimName,
+	}
+	spec.PersistentVolumeReclaimPolicy = corev1.PersistentVolumeReclaimRetain
+	spec.NodeAffinity = &corev1.VolumeNodeAffinity{
+		Required: &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+				MatchExpressions: []corev1.NodeSelectorRequirement{{
+					Key:      corev1.LabelHostname,
+					Operator: corev1.NodeSelectorOpIn,
+					Values:   []string{hostname},
+				}},
+			}},
+		},
+	}
+
+	return &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   source.Name + "-" + m.Spec.TargetNode,
+			Labels: labels,
+		},
+		Spec: spec,
+	}, nil
+}
+
+// claimBindingAnnotations are set by the PersistentVolume controller and the
+// scheduler while binding a claim. They describe the source volume and node,
+// so the rebound claim does not keep them.
+var claimBindingAnnotations = []string{
+	"pv.kubernetes.io/bind-completed",
+	"pv.kubernetes.io/bound-by-controller",
+	"volume.kubernetes.io/selected-node",
+	"volume.kubernetes.io/storage-provisioner",
+	"volume.beta.kubernetes.io/storage-provisioner",
+}
+
+// claimMetadata returns the metadata of claim that its replacement keeps.
+func claimMetadata(claim *corev1.PersistentVolumeClaim) *migrationv1alpha1.ClaimMetadata {
+	meta := &migrationv1alpha1.ClaimMetadata{
+		Labels:          claim.Labels,
+		OwnerReferences: claim.OwnerReferences,
+	}
+	for k, v := range claim.Annotations {
+		if !slices.Contains(claimBindingAnnotations, k) {
+			if meta.Annotations == nil {
+				meta.Annotations = make(map[string]string)
+			}
+			meta.Annotations[k] = v
+		}
+	}
+	return meta
+}
+
+// reboundClaim builds the claim that replaces the claim of v, bound to
+// target, with the metadata recorded from the original claim.
+func reboundClaim(m *migrationv1alpha1.StatefulMigration, v *migrationv1alpha1.VolumeStatus, source, target *corev1.PersistentVolume) *corev1.PersistentVolumeClaim {
+	storageClass := source.Spec.StorageClassName
+	objectMeta := metav1.ObjectMeta{
+		Name:      v.ClaimName,
+		Namespace: m.Namespace,
+	}
+	if v.Claim != nil {
+		objectMeta.Labels = v.Claim.Labels
+		objectMeta.Annotations = v.Claim.Annotations
+		objectMeta.OwnerReferences = v.Claim.OwnerReferences
+	}
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: objectMeta,
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      source.Spec.AccessModes,
+			StorageClassName: &storageClass,
+			VolumeMode:       source.Spec.VolumeMode,
+			VolumeName:       target.Name,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: source.Spec.Capacity[corev1.ResourceStorage],
+				},
+			},
+		},
+	}
+}
+
+// agentVolumeCopy is a volume copy as reported by an ms2m-agent.
+type agentVolumeCopy struct {
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+// callAgentVolumeSend asks the ms2m-agent on the source node to start
+// streaming the local volume pv of migration m to the ms2m-agent at
+// targetIP. The agents resolve the volume's path themselves.
+func (r *StatefulMigrationReconciler) callAgentVolumeSend(ctx context.Context, sourceIP, targetIP, token string, m *migrationv1alpha1.StatefulMigration, pv string) error {
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"migration": m.Namespace + "/" + m.Name,
+		"volume":    pv,
+		"target":    targetIP,
+	})
+	_, err := r.callAgentWithToken(ctx, http.MethodPost, sourceIP, "/volume-send", token, reqBody, agentCallTimeout)
+	return err
+}
+
+// callAgentVolumeStatus asks the ms2m-agent on the source node how the copy
+// of the local volume pv of migration m is going.
+func (r *StatefulMigrationReconciler) callAgentVolumeStatus(ctx context.Context, sourceIP, token string, m *migrationv1alpha1.StatefulMigration, pv string) (agentVolumeCopy, error) {
+	query := url.Values{"migration": {m.Namespace + "/" + m.Name}, "volume": {pv}}
+	var status agentVolumeCopy
+	respBody, err := r.callAgentWithToken(ctx, http.MethodGet, sourceIP, "/volume-status?"+query.Encode(), token, nil, agentCallTimeout)
+	if err != nil {
+		return status, err
+	}
+	if err := json.Unmarshal(respBody, &status); err != nil {
+		return status, fmt.Errorf("decode volume copy status: %w", err)
+	}
+	return status, nil
+}
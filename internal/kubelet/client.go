@@ -4,9 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+
+	"github.com/haidinhtuan/kubernetes-controller/internal/checkpoint"
+	"github.com/haidinhtuan/kubernetes-controller/internal/retry"
 )
 
 // CheckpointResponse holds the result of a kubelet checkpoint API call.
@@ -33,30 +39,48 @@ func NewClient(clientset kubernetes.Interface) *Client {
 // through the Kubernetes API server:
 // POST /api/v1/nodes/{node}/proxy/checkpoint/{namespace}/{pod}/{container}
 //
-// It returns the checkpoint response containing the list of checkpoint
-// archive paths on the node filesystem.
-func (c *Client) Checkpoint(ctx context.Context, nodeName, namespace, podName, containerName string) (*CheckpointResponse, error) {
+// It returns the path of the checkpoint archive on the node filesystem, and
+// implements checkpoint.Checkpointer. The API takes opts.Timeout as its
+// timeout parameter.
+func (c *Client) Checkpoint(ctx context.Context, nodeName, namespace, podName, containerName string, opts checkpoint.Options) (string, error) {
+	resp, err := c.checkpoint(ctx, nodeName, namespace, podName, containerName, opts.Timeout)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Items) == 0 {
+		return "", fmt.Errorf("checkpoint of %s/%s/%s on %s returned no archive", namespace, podName, containerName, nodeName)
+	}
+	return resp.Items[0], nil
+}
+
+// checkpoint makes the kubelet checkpoint call and returns the checkpoint
+// response containing the list of checkpoint archive paths. A zero timeout
+// leaves the kubelet's default.
+func (c *Client) checkpoint(ctx context.Context, nodeName, namespace, podName, containerName string, timeout time.Duration) (*CheckpointResponse, error) {
 	if nodeName == "" || namespace == "" || podName == "" || containerName == "" {
 		return nil, fmt.Errorf("all checkpoint parameters are required (node=%q, ns=%q, pod=%q, container=%q)",
 			nodeName, namespace, podName, containerName)
 	}
 
-	result := c.restClient.Post().
+	req := c.restClient.Post().
 		Resource("nodes").
 		Name(nodeName).
-		SubResource("proxy", "checkpoint", namespace, podName, containerName).
-		Do(ctx)
+		SubResource("proxy", "checkpoint", namespace, podName, containerName)
+	if timeout > 0 {
+		req = req.Param("timeout", strconv.Itoa(int(timeout/time.Second)))
+	}
+	result := req.Do(ctx)
 
 	if err := result.Error(); err != nil {
-		return nil, fmt.Errorf("checkpoint request for container %s/%s/%s on node %s failed: %w",
-			namespace, podName, containerName, nodeName, err)
+		return nil, classifyCheckpointError(fmt.Errorf("checkpoint request for container %s/%s/%s on node %s failed: %w",
+			namespace, podName, containerName, nodeName, err))
 	}
 
 	var statusCode int
 	result.StatusCode(&statusCode)
 	if statusCode != 200 {
-		return nil, fmt.Errorf("checkpoint returned unexpected status %d for %s/%s/%s on %s",
-			statusCode, namespace, podName, containerName, nodeName)
+		return nil, retry.Mark(fmt.Errorf("checkpoint returned unexpected status %d for %s/%s/%s on %s",
+			statusCode, namespace, podName, containerName, nodeName), retry.ClassifyStatusCode(statusCode))
 	}
 
 	rawBody, err := result.Raw()
@@ -71,3 +95,21 @@ func (c *Client) Checkpoint(ctx context.Context, nodeName, namespace, podName, c
 
 	return &resp, nil
 }
+
+// unsupportedMarkers are fragments of the errors the kubelet relays when the
+// container runtime cannot checkpoint at all (no CRIU, or a CRI without the
+// CheckpointContainer call). They arrive as 500s but will never succeed.
+var unsupportedMarkers = []string{"Unimplemented", "not supported", "CRIU", "criu"}
+
+// classifyCheckpointError marks a failed checkpoint request: unsupported
+// runtimes are permanent, otherwise the API server status decides (404 pod or
+// node, 401/403 permanent; 5xx and throttling transient).
+func classifyCheckpointError(err error) error {
+	msg := err.Error()
+	for _, marker := range unsupportedMarkers {
+		if strings.Contains(msg, marker) {
+			return retry.MarkPermanent(err)
+		}
+	}
+	return retry.Mark(err, retry.Classify(err))
+}
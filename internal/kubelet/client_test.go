@@ -2,7 +2,21 @@ package kubelet
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+
+	"github.com/haidinhtuan/kubernetes-controller/internal/checkpoint"
+	"github.com/haidinhtuan/kubernetes-controller/internal/retry"
 )
 
 func TestCheckpointResponse_Parse(t *testing.T) {
@@ -61,10 +75,81 @@ func TestCheckpoint_EmptyParams(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := c.Checkpoint(t.Context(), tt.node, tt.ns, tt.pod, tt.container)
+			_, err := c.Checkpoint(t.Context(), tt.node, tt.ns, tt.pod, tt.container, checkpoint.Options{})
 			if err == nil {
 				t.Error("expected error for empty parameter")
 			}
 		})
 	}
 }
+
+func TestClassifyCheckpointError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want retry.Class
+	}{
+		{"pod not found", apierrors.NewNotFound(schema.GroupResource{Resource: "pods"}, "app-0"), retry.Permanent},
+		{"forbidden", apierrors.NewForbidden(schema.GroupResource{Resource: "nodes"}, "node-1", errors.New("rbac")), retry.Permanent},
+		{"proxy unavailable", apierrors.NewServiceUnavailable("kubelet not ready"), retry.Transient},
+		{"runtime error", apierrors.NewInternalError(errors.New("checkpoint write: no space left on device")), retry.Transient},
+		{"criu missing", apierrors.NewInternalError(errors.New("rpc error: code = Unimplemented desc = checkpointing is not supported")), retry.Permanent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyCheckpointError(fmt.Errorf("checkpoint request failed: %w", tt.err))
+			if got := retry.Classify(err); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+// testClient returns a Client whose requests reach handler.
+func testClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	rc, err := rest.RESTClientFor(&rest.Config{
+		Host:    srv.URL,
+		APIPath: "/api",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion:         &corev1.SchemeGroupVersion,
+			NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		},
+	})
+	if err != nil {
+		t.Fatalf("RESTClientFor: %v", err)
+	}
+	return &Client{restClient: rc}
+}
+
+func TestCheckpoint_Timeout(t *testing.T) {
+	var gotPath, gotTimeout string
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotTimeout = r.URL.Path, r.URL.Query().Get("timeout")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"items":["/var/lib/kubelet/checkpoints/checkpoint-app-0.tar"]}`))
+	})
+
+	path, err := c.Checkpoint(t.Context(), "node-1", "default", "app-0", "app", checkpoint.Options{Timeout: 45 * time.Second})
+	if err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	if path != "/var/lib/kubelet/checkpoints/checkpoint-app-0.tar" {
+		t.Errorf("unexpected path %q", path)
+	}
+	if gotPath != "/api/v1/nodes/node-1/proxy/checkpoint/default/app-0/app" {
+		t.Errorf("unexpected request path %q", gotPath)
+	}
+	if gotTimeout != "45" {
+		t.Errorf("expected timeout=45, got %q", gotTimeout)
+	}
+
+	if _, err := c.Checkpoint(t.Context(), "node-1", "default", "app-0", "app", checkpoint.Options{}); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	if gotTimeout != "" {
+		t.Errorf("expected no timeout parameter by default, got %q", gotTimeout)
+	}
+}
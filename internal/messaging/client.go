@@ -1,19 +1,9 @@
 package messaging
 
-import "context"
+import (
+	"context"
 
-// ControlMessageType identifies the type of control message sent to a pod
-// during the MS2M migration process.
-type ControlMessageType string
-
-const (
-	// ControlStartReplay tells the target pod to begin replaying
-	// messages from the secondary queue.
-	ControlStartReplay ControlMessageType = "START_REPLAY"
-
-	// ControlEndReplay tells the target pod to stop replaying and
-	// switch over to consuming from the primary queue.
-	ControlEndReplay ControlMessageType = "END_REPLAY"
+	"github.com/haidinhtuan/kubernetes-controller/pkg/protocol"
 )
 
 // BrokerClient abstracts message broker operations needed by the migration
@@ -45,9 +35,24 @@ type BrokerClient interface {
 	// given queue. Used to monitor replay lag.
 	GetQueueDepth(ctx context.Context, queueName string) (int, error)
 
+	// GetQueueConsumers returns the number of consumers attached to the
+	// given queue. Used to confirm the source pod has stopped consuming.
+	GetQueueConsumers(ctx context.Context, queueName string) (int, error)
+
 	// SendControlMessage publishes a control message to a pod-specific
-	// queue (ms2m.control.<targetPod>).
-	SendControlMessage(ctx context.Context, targetPod string, msgType ControlMessageType, payload map[string]interface{}) error
+	// queue (ms2m.control.<targetPod>). The client fills in the protocol
+	// version and send time; msg.TTL, when set, expires the message if
+	// the pod has not consumed it in time.
+	SendControlMessage(ctx context.Context, targetPod string, msg protocol.ControlMessage) error
+
+	// DeclareReplyQueue creates the queue workloads answer control
+	// messages on. It is idempotent.
+	DeclareReplyQueue(ctx context.Context, replyQueue string) error
+
+	// ReceiveControlReply returns the reply to the control message with
+	// the given correlation ID, or nil if it has not arrived yet. Replies
+	// to other messages found ahead of it are stale and are discarded.
+	ReceiveControlReply(ctx context.Context, replyQueue, correlationID string) (*protocol.ControlReply, error)
 
 	// BindQueue binds a queue to an exchange. Used by Exchange-Fence to
 	// rebind the primary queue after the fence cutover.
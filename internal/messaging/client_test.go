@@ -3,7 +3,13 @@ package messaging
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/haidinhtuan/kubernetes-controller/internal/retry"
+	"github.com/haidinhtuan/kubernetes-controller/pkg/protocol"
 )
 
 func TestMockBrokerClient_ConnectAndClose(t *testing.T) {
@@ -118,6 +124,25 @@ func TestMockBrokerClient_QueueDepth(t *testing.T) {
 	}
 }
 
+func TestMockBrokerClient_QueueConsumers(t *testing.T) {
+	mock := NewMockBrokerClient()
+	ctx := context.Background()
+
+	mock.SetQueueConsumers("orders", 2)
+	consumers, err := mock.GetQueueConsumers(ctx, "orders")
+	if err != nil {
+		t.Fatalf("GetQueueConsumers() unexpected error: %v", err)
+	}
+	if consumers != 2 {
+		t.Errorf("expected 2 consumers, got %d", consumers)
+	}
+
+	// Unknown queue should have no consumers
+	if consumers, _ := mock.GetQueueConsumers(ctx, "nonexistent"); consumers != 0 {
+		t.Errorf("expected 0 consumers for unknown queue, got %d", consumers)
+	}
+}
+
 func TestMockBrokerClient_SendControlMessage(t *testing.T) {
 	mock := NewMockBrokerClient()
 	ctx := context.Background()
@@ -128,7 +153,7 @@ func TestMockBrokerClient_SendControlMessage(t *testing.T) {
 		"queue": "orders.ms2m-replay",
 	}
 
-	if err := mock.SendControlMessage(ctx, "orders-pod-0", ControlStartReplay, payload); err != nil {
+	if err := mock.SendControlMessage(ctx, "orders-pod-0", protocol.ControlMessage{Type: protocol.ControlStartReplay, Payload: payload}); err != nil {
 		t.Fatalf("SendControlMessage() unexpected error: %v", err)
 	}
 
@@ -140,15 +165,15 @@ func TestMockBrokerClient_SendControlMessage(t *testing.T) {
 	if msg.TargetPod != "orders-pod-0" {
 		t.Errorf("expected TargetPod %q, got %q", "orders-pod-0", msg.TargetPod)
 	}
-	if msg.Type != ControlStartReplay {
-		t.Errorf("expected message type %q, got %q", ControlStartReplay, msg.Type)
+	if msg.Type != protocol.ControlStartReplay {
+		t.Errorf("expected message type %q, got %q", protocol.ControlStartReplay, msg.Type)
 	}
 	if msg.Payload["queue"] != "orders.ms2m-replay" {
 		t.Errorf("expected payload queue %q, got %v", "orders.ms2m-replay", msg.Payload["queue"])
 	}
 
 	// Send another message
-	if err := mock.SendControlMessage(ctx, "orders-pod-0", ControlEndReplay, nil); err != nil {
+	if err := mock.SendControlMessage(ctx, "orders-pod-0", protocol.ControlMessage{Type: protocol.ControlEndReplay}); err != nil {
 		t.Fatalf("SendControlMessage() unexpected error: %v", err)
 	}
 	if len(mock.ControlMessages) != 2 {
@@ -157,7 +182,82 @@ func TestMockBrokerClient_SendControlMessage(t *testing.T) {
 
 	// Test error injection
 	mock.SendErr = errors.New("publish failed")
-	if err := mock.SendControlMessage(ctx, "orders-pod-0", ControlEndReplay, nil); err == nil {
+	if err := mock.SendControlMessage(ctx, "orders-pod-0", protocol.ControlMessage{Type: protocol.ControlEndReplay}); err == nil {
 		t.Fatal("expected SendControlMessage() to return error when SendErr is set")
 	}
 }
+
+func TestMockBrokerClient_ControlReplies(t *testing.T) {
+	mock := NewMockBrokerClient()
+	ctx := context.Background()
+	replyQueue := protocol.ReplyQueueName("default", "mig-1")
+
+	if err := mock.DeclareReplyQueue(ctx, replyQueue); err != nil {
+		t.Fatalf("DeclareReplyQueue() unexpected error: %v", err)
+	}
+
+	// A stale reply from an earlier request is discarded on the way to
+	// the one being waited for.
+	mock.Reply(replyQueue, protocol.ControlReply{Version: protocol.Version, ID: "old", Status: protocol.ReplyAck})
+	msg := protocol.ControlMessage{ID: "req-1", Type: protocol.ControlPing, ReplyTo: replyQueue}
+	if err := mock.SendControlMessage(ctx, "orders-pod-0", msg); err != nil {
+		t.Fatalf("SendControlMessage() unexpected error: %v", err)
+	}
+	if mock.ControlMessages[0].Message.Version != protocol.Version {
+		t.Errorf("expected version %d, got %d", protocol.Version, mock.ControlMessages[0].Message.Version)
+	}
+
+	reply, err := mock.ReceiveControlReply(ctx, replyQueue, "req-1")
+	if err != nil {
+		t.Fatalf("ReceiveControlReply() unexpected error: %v", err)
+	}
+	if reply == nil || reply.ID != "req-1" || reply.Status != protocol.ReplyAck {
+		t.Fatalf("expected ack for req-1, got %+v", reply)
+	}
+	if reply, _ := mock.ReceiveControlReply(ctx, replyQueue, "req-1"); reply != nil {
+		t.Errorf("expected no further reply, got %+v", reply)
+	}
+
+	// Unresponsive pods never reply; NackReason turns replies into nacks.
+	mock.Unresponsive["orders-pod-1"] = true
+	_ = mock.SendControlMessage(ctx, "orders-pod-1", protocol.ControlMessage{ID: "req-2", Type: protocol.ControlPing, ReplyTo: replyQueue})
+	if reply, _ := mock.ReceiveControlReply(ctx, replyQueue, "req-2"); reply != nil {
+		t.Errorf("expected no reply from unresponsive pod, got %+v", reply)
+	}
+	mock.NackReason = "not consuming"
+	_ = mock.SendControlMessage(ctx, "orders-pod-0", protocol.ControlMessage{ID: "req-3", Type: protocol.ControlStopConsuming, ReplyTo: replyQueue})
+	if reply, _ := mock.ReceiveControlReply(ctx, replyQueue, "req-3"); reply == nil || reply.Status != protocol.ReplyNack || reply.Reason != "not consuming" {
+		t.Errorf("expected nack, got %+v", reply)
+	}
+}
+
+func TestRabbitMQClient_ClassifiesErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want retry.Class
+	}{
+		{"bad credentials", amqp.ErrCredentials, retry.Permanent},
+		{"missing queue", &amqp.Error{Code: amqp.NotFound, Reason: "NOT_FOUND - no queue 'orders'"}, retry.Permanent},
+		{"connection forced", &amqp.Error{Code: amqp.ConnectionForced, Reason: "CONNECTION_FORCED - broker shutdown"}, retry.Transient},
+		{"channel closed", amqp.ErrClosed, retry.Transient},
+		{"no reply code", errors.New("boom"), retry.Permanent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classify(fmt.Errorf("inspect queue %q: %w", "orders", tt.err))
+			if got := retry.Classify(err); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	// Calls before Connect are retried: the next reconcile reconnects.
+	_, err := NewRabbitMQClient().GetQueueDepth(context.Background(), "orders")
+	if !retry.IsTransient(err) || !IsDisconnected(err) {
+		t.Errorf("expected transient not-connected error, got %v", err)
+	}
+	if !IsDisconnected(classify(fmt.Errorf("publish: %w", amqp.ErrClosed))) {
+		t.Error("expected a closed channel to need a reconnect")
+	}
+}
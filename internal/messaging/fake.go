@@ -0,0 +1,794 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/haidinhtuan/kubernetes-controller/internal/retry"
+	"github.com/haidinhtuan/kubernetes-controller/pkg/protocol"
+)
+
+// Exchange kinds supported by FakeBroker.
+const (
+	ExchangeFanout = "fanout"
+	ExchangeDirect = "direct"
+)
+
+// errFakeConsumerCancelled is returned by FakeBroker.Next once the broker
+// has cancelled the consumer, e.g. because its queue was deleted.
+var errFakeConsumerCancelled = errors.New("consumer cancelled by broker")
+
+// FakeMessage is a message held by FakeBroker.
+type FakeMessage struct {
+	// ID is the publisher-assigned message ID.
+	ID string
+
+	// CorrelationID and ReplyTo carry control protocol metadata.
+	CorrelationID string
+	ReplyTo       string
+
+	// Body is the message body.
+	Body []byte
+
+	// Expires drops the message if it is still queued at that time. Zero
+	// keeps it until consumed.
+	Expires time.Time
+
+	// Redelivered is set once the message has been delivered and put back
+	// on its queue by a nack or a cancelled consumer.
+	Redelivered bool
+}
+
+// FakeDelivery is a message handed to a consumer or returned by Get.
+type FakeDelivery struct {
+	FakeMessage
+
+	// Queue is the queue the message was taken from.
+	Queue string
+
+	// Tag is the delivery tag to Ack or Nack. Zero for auto-acked Gets.
+	Tag uint64
+}
+
+// FakeBroker is an in-memory model of the parts of an AMQP 0-9-1 broker the
+// migration protocol relies on: exchanges and their bindings, per-message
+// routing, queues holding ready and unacknowledged messages, and consumers.
+// Unlike MockBrokerClient it moves real messages, so a test can publish,
+// consume and afterwards check which messages reached which consumer.
+//
+// It behaves like RabbitMQ wherever the controller depends on it. A fanout
+// exchange copies a message to every bound queue and drops it when none is
+// bound. Unbinding stops routing at once and leaves the queue's messages in
+// place. Purging drops ready messages but not unacknowledged ones. Deleting
+// a queue drops its messages and cancels its consumers. Messages nacked
+// with requeue, or held by a cancelled consumer, go back to the head of
+// their queue.
+//
+// FakeBroker is safe for concurrent use. Operations on missing exchanges or
+// queues fail with the AMQP NOT_FOUND error RabbitMQ would return.
+type FakeBroker struct {
+	mu sync.Mutex
+
+	now        func() time.Time
+	exchanges  map[string]*fakeExchange
+	queues     map[string]*fakeQueue
+	consumers  map[string]*fakeConsumer // consumer tag -> consumer
+	lastTag    uint64
+	unroutable []FakeMessage
+}
+
+type fakeExchange struct {
+	kind     string
+	bindings []fakeBinding
+}
+
+type fakeBinding struct {
+	queue string
+	key   string
+}
+
+type fakeQueue struct {
+	ready   []FakeMessage
+	unacked map[uint64]fakeUnacked
+}
+
+type fakeUnacked struct {
+	msg      FakeMessage
+	consumer string // empty for Get
+}
+
+type fakeConsumer struct {
+	queue    string
+	prefetch int
+}
+
+// NewFakeBroker returns an empty FakeBroker.
+func NewFakeBroker() *FakeBroker {
+	return &FakeBroker{
+		now:       time.Now,
+		exchanges: make(map[string]*fakeExchange),
+		queues:    make(map[string]*fakeQueue),
+		consumers: make(map[string]*fakeConsumer),
+	}
+}
+
+// SetClock replaces the clock used to expire messages.
+func (b *FakeBroker) SetClock(now func() time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.now = now
+}
+
+func amqpError(code int, format string, args ...interface{}) *amqp.Error {
+	return &amqp.Error{Code: code, Reason: fmt.Sprintf(format, args...), Server: true}
+}
+
+func (b *FakeBroker) exchange(name string) (*fakeExchange, error) {
+	ex, ok := b.exchanges[name]
+	if !ok {
+		return nil, amqpError(amqp.NotFound, "NOT_FOUND - no exchange '%s'", name)
+	}
+	return ex, nil
+}
+
+func (b *FakeBroker) queue(name string) (*fakeQueue, error) {
+	q, ok := b.queues[name]
+	if !ok {
+		return nil, amqpError(amqp.NotFound, "NOT_FOUND - no queue '%s'", name)
+	}
+	return q, nil
+}
+
+// DeclareExchange creates an exchange of the given kind. Declaring an
+// existing exchange is a no-op unless the kind differs.
+func (b *FakeBroker) DeclareExchange(name, kind string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if kind != ExchangeFanout && kind != ExchangeDirect {
+		return amqpError(amqp.CommandInvalid, "COMMAND_INVALID - unknown exchange type '%s'", kind)
+	}
+	if ex, ok := b.exchanges[name]; ok {
+		if ex.kind != kind {
+			return amqpError(amqp.PreconditionFailed,
+				"PRECONDITION_FAILED - inequivalent arg 'type' for exchange '%s': received '%s' but current is '%s'",
+				name, kind, ex.kind)
+		}
+		return nil
+	}
+	b.exchanges[name] = &fakeExchange{kind: kind}
+	return nil
+}
+
+// DeclareQueue creates a queue. Declaring an existing queue is a no-op.
+func (b *FakeBroker) DeclareQueue(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.queues[name]; !ok {
+		b.queues[name] = &fakeQueue{unacked: make(map[uint64]fakeUnacked)}
+	}
+	return nil
+}
+
+// BindQueue binds queue to exchange with key. The key is ignored by fanout
+// exchanges. Binding twice is a no-op.
+func (b *FakeBroker) BindQueue(queue, exchange, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ex, err := b.exchange(exchange)
+	if err != nil {
+		return err
+	}
+	if _, err := b.queue(queue); err != nil {
+		return err
+	}
+	for _, bnd := range ex.bindings {
+		if bnd.queue == queue && bnd.key == key {
+			return nil
+		}
+	}
+	ex.bindings = append(ex.bindings, fakeBinding{queue: queue, key: key})
+	return nil
+}
+
+// UnbindQueue removes the binding of queue to exchange with key. Removing a
+// binding that does not exist is a no-op.
+func (b *FakeBroker) UnbindQueue(queue, exchange, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ex, err := b.exchange(exchange)
+	if err != nil {
+		return err
+	}
+	if _, err := b.queue(queue); err != nil {
+		return err
+	}
+	kept := ex.bindings[:0]
+	for _, bnd := range ex.bindings {
+		if bnd.queue != queue || bnd.key != key {
+			kept = append(kept, bnd)
+		}
+	}
+	ex.bindings = kept
+	return nil
+}
+
+// DeleteQueue deletes a queue with its bindings and consumers, and returns
+// the number of messages dropped with it. Deleting a missing queue is a
+// no-op, as in RabbitMQ.
+func (b *FakeBroker) DeleteQueue(name string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[name]
+	if !ok {
+		return 0, nil
+	}
+	dropped := len(q.ready) + len(q.unacked)
+	delete(b.queues, name)
+	for _, ex := range b.exchanges {
+		kept := ex.bindings[:0]
+		for _, bnd := range ex.bindings {
+			if bnd.queue != name {
+				kept = append(kept, bnd)
+			}
+		}
+		ex.bindings = kept
+	}
+	for tag, c := range b.consumers {
+		if c.queue == name {
+			delete(b.consumers, tag)
+		}
+	}
+	return dropped, nil
+}
+
+// PurgeQueue drops the ready messages of a queue and returns how many were
+// dropped. Unacknowledged messages are kept.
+func (b *FakeBroker) PurgeQueue(name string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, err := b.queue(name)
+	if err != nil {
+		return 0, err
+	}
+	n := len(q.ready)
+	q.ready = nil
+	return n, nil
+}
+
+// Publish routes msg through exchange with key. The default exchange ""
+// routes to the queue named key. A message no queue is bound for is dropped
+// and recorded, see Unroutable.
+func (b *FakeBroker) Publish(exchange, key string, msg FakeMessage) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	msg.Redelivered = false
+	var targets []string
+	if exchange == "" {
+		if _, ok := b.queues[key]; ok {
+			targets = append(targets, key)
+		}
+	} else {
+		ex, err := b.exchange(exchange)
+		if err != nil {
+			return err
+		}
+		for _, bnd := range ex.bindings {
+			if ex.kind == ExchangeFanout || bnd.key == key {
+				targets = appendUnique(targets, bnd.queue)
+			}
+		}
+	}
+	if len(targets) == 0 {
+		b.unroutable = append(b.unroutable, msg)
+		return nil
+	}
+	for _, name := range targets {
+		q := b.queues[name]
+		copied := msg
+		copied.Body = append([]byte(nil), msg.Body...)
+		q.ready = append(q.ready, copied)
+	}
+	return nil
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// Consume registers a consumer on queue under tag. At most prefetch
+// deliveries are unacknowledged at a time; zero means no limit.
+func (b *FakeBroker) Consume(queue, tag string, prefetch int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := b.queue(queue); err != nil {
+		return err
+	}
+	if _, dup := b.consumers[tag]; dup {
+		return amqpError(amqp.NotAllowed, "NOT_ALLOWED - attempt to reuse consumer tag '%s'", tag)
+	}
+	b.consumers[tag] = &fakeConsumer{queue: queue, prefetch: prefetch}
+	return nil
+}
+
+// Cancel removes the consumer registered under tag and puts the messages
+// it has not acknowledged back at the head of its queue. Cancelling an
+// unknown consumer is a no-op.
+func (b *FakeBroker) Cancel(tag string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.consumers[tag]
+	if !ok {
+		return nil
+	}
+	delete(b.consumers, tag)
+	if q, ok := b.queues[c.queue]; ok {
+		b.requeue(q, func(u fakeUnacked) bool { return u.consumer == tag })
+	}
+	return nil
+}
+
+// requeue puts the unacknowledged messages of q that match back at the
+// head of q, in the order they were delivered.
+func (b *FakeBroker) requeue(q *fakeQueue, match func(fakeUnacked) bool) {
+	var tags []uint64
+	for dt, u := range q.unacked {
+		if match(u) {
+			tags = append(tags, dt)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	back := make([]FakeMessage, 0, len(tags)+len(q.ready))
+	for _, dt := range tags {
+		msg := q.unacked[dt].msg
+		msg.Redelivered = true
+		back = append(back, msg)
+		delete(q.unacked, dt)
+	}
+	q.ready = append(back, q.ready...)
+}
+
+// Next delivers the next ready message to the consumer registered under
+// tag. ok is false when the queue has no ready message or the consumer is
+// at its prefetch limit.
+func (b *FakeBroker) Next(tag string) (FakeDelivery, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.consumers[tag]
+	if !ok {
+		return FakeDelivery{}, false, errFakeConsumerCancelled
+	}
+	q := b.queues[c.queue]
+	if c.prefetch > 0 {
+		held := 0
+		for _, u := range q.unacked {
+			if u.consumer == tag {
+				held++
+			}
+		}
+		if held >= c.prefetch {
+			return FakeDelivery{}, false, nil
+		}
+	}
+	msg, ok := b.pop(q)
+	if !ok {
+		return FakeDelivery{}, false, nil
+	}
+	b.lastTag++
+	q.unacked[b.lastTag] = fakeUnacked{msg: msg, consumer: tag}
+	return FakeDelivery{FakeMessage: msg, Queue: c.queue, Tag: b.lastTag}, true, nil
+}
+
+// Get takes the next ready message from queue without a consumer, like
+// basic.get. With autoAck the message is acknowledged at once and the
+// delivery's Tag is zero.
+func (b *FakeBroker) Get(queue string, autoAck bool) (FakeDelivery, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, err := b.queue(queue)
+	if err != nil {
+		return FakeDelivery{}, false, err
+	}
+	msg, ok := b.pop(q)
+	if !ok {
+		return FakeDelivery{}, false, nil
+	}
+	d := FakeDelivery{FakeMessage: msg, Queue: queue}
+	if !autoAck {
+		b.lastTag++
+		q.unacked[b.lastTag] = fakeUnacked{msg: msg}
+		d.Tag = b.lastTag
+	}
+	return d, true, nil
+}
+
+// pop removes the first unexpired ready message of q.
+func (b *FakeBroker) pop(q *fakeQueue) (FakeMessage, bool) {
+	now := b.now()
+	for len(q.ready) > 0 {
+		msg := q.ready[0]
+		q.ready = q.ready[1:]
+		if !msg.Expires.IsZero() && !now.Before(msg.Expires) {
+			continue
+		}
+		return msg, true
+	}
+	return FakeMessage{}, false
+}
+
+// unackedByTag finds the queue holding the delivery tag.
+func (b *FakeBroker) unackedByTag(deliveryTag uint64) (*fakeQueue, error) {
+	for _, q := range b.queues {
+		if _, ok := q.unacked[deliveryTag]; ok {
+			return q, nil
+		}
+	}
+	return nil, amqpError(amqp.PreconditionFailed, "PRECONDITION_FAILED - unknown delivery tag %d", deliveryTag)
+}
+
+// Ack acknowledges a delivery, removing its message for good.
+func (b *FakeBroker) Ack(deliveryTag uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, err := b.unackedByTag(deliveryTag)
+	if err != nil {
+		return err
+	}
+	delete(q.unacked, deliveryTag)
+	return nil
+}
+
+// Nack rejects a delivery. With requeue its message goes back to the head
+// of its queue; without, it is dropped.
+func (b *FakeBroker) Nack(deliveryTag uint64, requeue bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, err := b.unackedByTag(deliveryTag)
+	if err != nil {
+		return err
+	}
+	if !requeue {
+		delete(q.unacked, deliveryTag)
+		return nil
+	}
+	u := q.unacked[deliveryTag]
+	delete(q.unacked, deliveryTag)
+	u.msg.Redelivered = true
+	q.ready = append([]FakeMessage{u.msg}, q.ready...)
+	return nil
+}
+
+// QueueStats returns the ready and unacknowledged message counts and the
+// consumer count of a queue.
+func (b *FakeBroker) QueueStats(name string) (ready, unacked, consumers int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, err := b.queue(name)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	for _, c := range b.consumers {
+		if c.queue == name {
+			consumers++
+		}
+	}
+	return len(q.ready), len(q.unacked), consumers, nil
+}
+
+// HasQueue reports whether a queue exists.
+func (b *FakeBroker) HasQueue(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, ok := b.queues[name]
+	return ok
+}
+
+// Bindings returns the queues bound to exchange, sorted.
+func (b *FakeBroker) Bindings(exchange string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ex, ok := b.exchanges[exchange]
+	if !ok {
+		return nil
+	}
+	var queues []string
+	for _, bnd := range ex.bindings {
+		queues = appendUnique(queues, bnd.queue)
+	}
+	sort.Strings(queues)
+	return queues
+}
+
+// Ready returns a copy of the ready messages of a queue, head first.
+func (b *FakeBroker) Ready(name string) []FakeMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[name]
+	if !ok {
+		return nil
+	}
+	return append([]FakeMessage(nil), q.ready...)
+}
+
+// Unroutable returns the messages published while no queue was bound to
+// receive them.
+func (b *FakeBroker) Unroutable() []FakeMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]FakeMessage(nil), b.unroutable...)
+}
+
+// ---------------------------------------------------------------------------
+// FakeBrokerClient
+// ---------------------------------------------------------------------------
+
+// FakeBrokerClient implements BrokerClient on a FakeBroker, issuing the
+// same broker operations as RabbitMQClient. Several clients, and the
+// workloads of a Sim, can share one FakeBroker.
+//
+// GetQueueStats reports unacknowledged messages separately, as the
+// management API would; RabbitMQClient reports them as zero.
+type FakeBrokerClient struct {
+	broker *FakeBroker
+
+	mu        sync.Mutex
+	connected bool
+}
+
+// NewFakeBrokerClient returns a client of broker. Call Connect before using
+// any other methods.
+func NewFakeBrokerClient(broker *FakeBroker) *FakeBrokerClient {
+	return &FakeBrokerClient{broker: broker}
+}
+
+// Broker returns the broker the client talks to.
+func (f *FakeBrokerClient) Broker() *FakeBroker {
+	return f.broker
+}
+
+func (f *FakeBrokerClient) check() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.connected {
+		return ErrNotConnected
+	}
+	return nil
+}
+
+func (f *FakeBrokerClient) Connect(_ context.Context, _ string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connected = true
+	return nil
+}
+
+func (f *FakeBrokerClient) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connected = false
+	return nil
+}
+
+func (f *FakeBrokerClient) CreateSecondaryQueue(_ context.Context, primaryQueue, exchangeName, _ string) (string, error) {
+	if err := f.check(); err != nil {
+		return "", err
+	}
+	if err := f.broker.DeclareExchange(exchangeName, ExchangeFanout); err != nil {
+		return "", classify(fmt.Errorf("declare exchange %q: %w", exchangeName, err))
+	}
+	secondaryQueue := primaryQueue + ".ms2m-replay"
+	if err := f.broker.DeclareQueue(secondaryQueue); err != nil {
+		return "", classify(fmt.Errorf("declare queue %q: %w", secondaryQueue, err))
+	}
+	if err := f.broker.BindQueue(primaryQueue, exchangeName, ""); err != nil {
+		return "", classify(fmt.Errorf("bind primary queue %q to %q: %w", primaryQueue, exchangeName, err))
+	}
+	if err := f.broker.BindQueue(secondaryQueue, exchangeName, ""); err != nil {
+		return "", classify(fmt.Errorf("bind secondary queue %q to %q: %w", secondaryQueue, exchangeName, err))
+	}
+	return secondaryQueue, nil
+}
+
+func (f *FakeBrokerClient) UnbindQueue(_ context.Context, queueName, exchangeName string) error {
+	if err := f.check(); err != nil {
+		return err
+	}
+	if err := f.broker.UnbindQueue(queueName, exchangeName, ""); err != nil {
+		return classify(fmt.Errorf("unbind queue %q from %q: %w", queueName, exchangeName, err))
+	}
+	return nil
+}
+
+func (f *FakeBrokerClient) DeleteSecondaryQueue(_ context.Context, secondaryQueue, _, exchangeName string) error {
+	if err := f.check(); err != nil {
+		return err
+	}
+	if err := f.broker.UnbindQueue(secondaryQueue, exchangeName, ""); err != nil {
+		return classify(fmt.Errorf("unbind secondary queue %q from %q: %w", secondaryQueue, exchangeName, err))
+	}
+	if _, err := f.broker.DeleteQueue(secondaryQueue); err != nil {
+		return classify(fmt.Errorf("delete queue %q: %w", secondaryQueue, err))
+	}
+	return nil
+}
+
+func (f *FakeBrokerClient) GetQueueDepth(_ context.Context, queueName string) (int, error) {
+	if err := f.check(); err != nil {
+		return 0, err
+	}
+	ready, _, _, err := f.broker.QueueStats(queueName)
+	if err != nil {
+		return 0, classify(fmt.Errorf("inspect queue %q: %w", queueName, err))
+	}
+	return ready, nil
+}
+
+func (f *FakeBrokerClient) GetQueueConsumers(_ context.Context, queueName string) (int, error) {
+	if err := f.check(); err != nil {
+		return 0, err
+	}
+	_, _, consumers, err := f.broker.QueueStats(queueName)
+	if err != nil {
+		return 0, classify(fmt.Errorf("inspect queue %q: %w", queueName, err))
+	}
+	return consumers, nil
+}
+
+func (f *FakeBrokerClient) SendControlMessage(_ context.Context, targetPod string, msg protocol.ControlMessage) error {
+	if err := f.check(); err != nil {
+		return err
+	}
+	controlQueue := protocol.ControlQueueName(targetPod)
+	if err := f.broker.DeclareQueue(controlQueue); err != nil {
+		return classify(fmt.Errorf("declare control queue %q: %w", controlQueue, err))
+	}
+
+	msg.Version = protocol.Version
+	if msg.SentAt.IsZero() {
+		msg.SentAt = time.Now()
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal control message: %w", err)
+	}
+	published := FakeMessage{
+		ID:            msg.ID,
+		CorrelationID: msg.ID,
+		ReplyTo:       msg.ReplyTo,
+		Body:          body,
+	}
+	if msg.TTL > 0 {
+		published.Expires = msg.SentAt.Add(msg.TTL)
+	}
+	if err := f.broker.Publish("", controlQueue, published); err != nil {
+		return classify(fmt.Errorf("publish control message to %q: %w", controlQueue, err))
+	}
+	return nil
+}
+
+func (f *FakeBrokerClient) DeclareReplyQueue(_ context.Context, replyQueue string) error {
+	if err := f.check(); err != nil {
+		return err
+	}
+	if err := f.broker.DeclareQueue(replyQueue); err != nil {
+		return classify(fmt.Errorf("declare reply queue %q: %w", replyQueue, err))
+	}
+	return nil
+}
+
+func (f *FakeBrokerClient) ReceiveControlReply(_ context.Context, replyQueue, correlationID string) (*protocol.ControlReply, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	for {
+		d, ok, err := f.broker.Get(replyQueue, true)
+		if err != nil {
+			return nil, classify(fmt.Errorf("get from reply queue %q: %w", replyQueue, err))
+		}
+		if !ok {
+			return nil, nil
+		}
+
+		var reply protocol.ControlReply
+		if err := json.Unmarshal(d.Body, &reply); err != nil {
+			continue
+		}
+		if reply.ID == "" {
+			reply.ID = d.CorrelationID
+		}
+		if reply.ID != correlationID {
+			continue
+		}
+		if reply.Version != protocol.Version {
+			return nil, retry.MarkPermanent(fmt.Errorf("reply %s uses control protocol version %d, controller speaks %d",
+				reply.ID, reply.Version, protocol.Version))
+		}
+		return &reply, nil
+	}
+}
+
+func (f *FakeBrokerClient) BindQueue(_ context.Context, queueName, exchangeName, _ string) error {
+	if err := f.check(); err != nil {
+		return err
+	}
+	if err := f.broker.BindQueue(queueName, exchangeName, ""); err != nil {
+		return classify(fmt.Errorf("bind queue %q to %q: %w", queueName, exchangeName, err))
+	}
+	return nil
+}
+
+func (f *FakeBrokerClient) PurgeQueue(_ context.Context, queueName string) error {
+	if err := f.check(); err != nil {
+		return err
+	}
+	if _, err := f.broker.PurgeQueue(queueName); err != nil {
+		return classify(fmt.Errorf("purge queue %q: %w", queueName, err))
+	}
+	return nil
+}
+
+func (f *FakeBrokerClient) GetQueueStats(_ context.Context, queueName string) (int, int, error) {
+	if err := f.check(); err != nil {
+		return 0, 0, err
+	}
+	ready, unacked, _, err := f.broker.QueueStats(queueName)
+	if err != nil {
+		return 0, 0, classify(fmt.Errorf("inspect queue %q: %w", queueName, err))
+	}
+	return ready, unacked, nil
+}
+
+func (f *FakeBrokerClient) DeclareAndBindQueue(_ context.Context, queueName, exchangeName string) error {
+	if err := f.check(); err != nil {
+		return err
+	}
+	if err := f.broker.DeclareQueue(queueName); err != nil {
+		return classify(fmt.Errorf("declare queue %q: %w", queueName, err))
+	}
+	if err := f.broker.BindQueue(queueName, exchangeName, ""); err != nil {
+		return classify(fmt.Errorf("bind queue %q to %q: %w", queueName, exchangeName, err))
+	}
+	return nil
+}
+
+func (f *FakeBrokerClient) DeleteQueue(_ context.Context, queueName string) error {
+	if err := f.check(); err != nil {
+		return err
+	}
+	if _, err := f.broker.DeleteQueue(queueName); err != nil {
+		return classify(fmt.Errorf("delete queue %q: %w", queueName, err))
+	}
+	return nil
+}
+
+// Compile-time check that FakeBrokerClient satisfies BrokerClient.
+var _ BrokerClient = (*FakeBrokerClient)(nil)
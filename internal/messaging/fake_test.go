@@ -0,0 +1,340 @@
+package messaging
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/haidinhtuan/kubernetes-controller/internal/retry"
+	"github.com/haidinhtuan/kubernetes-controller/pkg/protocol"
+)
+
+// newFanout returns a broker with a fanout exchange and the given queues
+// bound to it.
+func newFanout(t *testing.T, exchange string, queues ...string) *FakeBroker {
+	t.Helper()
+	b := NewFakeBroker()
+	if err := b.DeclareExchange(exchange, ExchangeFanout); err != nil {
+		t.Fatalf("DeclareExchange() unexpected error: %v", err)
+	}
+	for _, q := range queues {
+		if err := b.DeclareQueue(q); err != nil {
+			t.Fatalf("DeclareQueue(%s) unexpected error: %v", q, err)
+		}
+		if err := b.BindQueue(q, exchange, ""); err != nil {
+			t.Fatalf("BindQueue(%s) unexpected error: %v", q, err)
+		}
+	}
+	return b
+}
+
+func readyIDs(b *FakeBroker, queue string) []string {
+	var ids []string
+	for _, msg := range b.Ready(queue) {
+		ids = append(ids, msg.ID)
+	}
+	return ids
+}
+
+func TestFakeBroker_FanoutCopiesToEveryBoundQueue(t *testing.T) {
+	b := newFanout(t, "orders.fanout", "orders", "orders.ms2m-replay")
+
+	_ = b.Publish("orders.fanout", "ignored", FakeMessage{ID: "m1"})
+	// Binding twice must not deliver twice.
+	_ = b.BindQueue("orders", "orders.fanout", "")
+	_ = b.Publish("orders.fanout", "", FakeMessage{ID: "m2"})
+
+	for _, q := range []string{"orders", "orders.ms2m-replay"} {
+		if got := readyIDs(b, q); !reflect.DeepEqual(got, []string{"m1", "m2"}) {
+			t.Errorf("%s: expected [m1 m2], got %v", q, got)
+		}
+	}
+}
+
+func TestFakeBroker_DirectRoutesByKey(t *testing.T) {
+	b := NewFakeBroker()
+	_ = b.DeclareExchange("orders.direct", ExchangeDirect)
+	_ = b.DeclareQueue("new")
+	_ = b.DeclareQueue("paid")
+	_ = b.BindQueue("new", "orders.direct", "orders.new")
+	_ = b.BindQueue("paid", "orders.direct", "orders.paid")
+
+	_ = b.Publish("orders.direct", "orders.new", FakeMessage{ID: "m1"})
+	_ = b.Publish("orders.direct", "orders.paid", FakeMessage{ID: "m2"})
+	// The default exchange routes by queue name.
+	_ = b.Publish("", "new", FakeMessage{ID: "m3"})
+
+	if got := readyIDs(b, "new"); !reflect.DeepEqual(got, []string{"m1", "m3"}) {
+		t.Errorf("new: expected [m1 m3], got %v", got)
+	}
+	if got := readyIDs(b, "paid"); !reflect.DeepEqual(got, []string{"m2"}) {
+		t.Errorf("paid: expected [m2], got %v", got)
+	}
+}
+
+func TestFakeBroker_UnbindStopsRoutingAndKeepsMessages(t *testing.T) {
+	b := newFanout(t, "orders.fanout", "orders", "orders.ms2m-replay")
+	_ = b.Publish("orders.fanout", "", FakeMessage{ID: "m1"})
+
+	if err := b.UnbindQueue("orders.ms2m-replay", "orders.fanout", ""); err != nil {
+		t.Fatalf("UnbindQueue() unexpected error: %v", err)
+	}
+	// Unbinding again is a no-op.
+	if err := b.UnbindQueue("orders.ms2m-replay", "orders.fanout", ""); err != nil {
+		t.Fatalf("second UnbindQueue() unexpected error: %v", err)
+	}
+	_ = b.Publish("orders.fanout", "", FakeMessage{ID: "m2"})
+
+	if got := readyIDs(b, "orders.ms2m-replay"); !reflect.DeepEqual(got, []string{"m1"}) {
+		t.Errorf("expected the unbound queue to keep [m1] only, got %v", got)
+	}
+	if got := b.Bindings("orders.fanout"); !reflect.DeepEqual(got, []string{"orders"}) {
+		t.Errorf("expected only orders bound, got %v", got)
+	}
+
+	// With nothing bound, messages are dropped.
+	_ = b.UnbindQueue("orders", "orders.fanout", "")
+	_ = b.Publish("orders.fanout", "", FakeMessage{ID: "m3"})
+	if got := b.Unroutable(); len(got) != 1 || got[0].ID != "m3" {
+		t.Errorf("expected m3 to be unroutable, got %v", got)
+	}
+}
+
+func TestFakeBroker_PurgeKeepsUnacked(t *testing.T) {
+	b := newFanout(t, "orders.fanout", "orders")
+	for _, id := range []string{"m1", "m2", "m3"} {
+		_ = b.Publish("orders.fanout", "", FakeMessage{ID: id})
+	}
+	_ = b.Consume("orders", "c1", 1)
+	d, _, _ := b.Next("c1")
+
+	purged, err := b.PurgeQueue("orders")
+	if err != nil {
+		t.Fatalf("PurgeQueue() unexpected error: %v", err)
+	}
+	if purged != 2 {
+		t.Errorf("expected 2 messages purged, got %d", purged)
+	}
+	ready, unacked, consumers, _ := b.QueueStats("orders")
+	if ready != 0 || unacked != 1 || consumers != 1 {
+		t.Errorf("expected 0 ready, 1 unacked, 1 consumer, got %d, %d, %d", ready, unacked, consumers)
+	}
+
+	// A nack with requeue brings the delivery back, marked redelivered.
+	if err := b.Nack(d.Tag, true); err != nil {
+		t.Fatalf("Nack() unexpected error: %v", err)
+	}
+	if got := b.Ready("orders"); len(got) != 1 || got[0].ID != "m1" || !got[0].Redelivered {
+		t.Errorf("expected m1 requeued as redelivered, got %+v", got)
+	}
+}
+
+func TestFakeBroker_PrefetchAndCancelRequeue(t *testing.T) {
+	b := newFanout(t, "orders.fanout", "orders")
+	for _, id := range []string{"m1", "m2", "m3"} {
+		_ = b.Publish("orders.fanout", "", FakeMessage{ID: id})
+	}
+	_ = b.Consume("orders", "c1", 2)
+
+	var tags []uint64
+	for {
+		d, ok, err := b.Next("c1")
+		if err != nil {
+			t.Fatalf("Next() unexpected error: %v", err)
+		}
+		if !ok {
+			break
+		}
+		tags = append(tags, d.Tag)
+	}
+	if len(tags) != 2 {
+		t.Fatalf("expected prefetch to stop at 2 deliveries, got %d", len(tags))
+	}
+	_ = b.Ack(tags[0])
+	if err := b.Ack(tags[0]); err == nil {
+		t.Error("expected acking a delivery twice to fail")
+	}
+
+	// Cancelling the consumer puts m2 back ahead of m3.
+	if err := b.Cancel("c1"); err != nil {
+		t.Fatalf("Cancel() unexpected error: %v", err)
+	}
+	if got := readyIDs(b, "orders"); !reflect.DeepEqual(got, []string{"m2", "m3"}) {
+		t.Errorf("expected [m2 m3] after cancel, got %v", got)
+	}
+	if _, _, err := b.Next("c1"); err == nil {
+		t.Error("expected Next on a cancelled consumer to fail")
+	}
+}
+
+func TestFakeBroker_DeleteQueueDropsMessagesAndConsumers(t *testing.T) {
+	b := newFanout(t, "orders.fanout", "orders", "orders.ms2m-replay")
+	_ = b.Publish("orders.fanout", "", FakeMessage{ID: "m1"})
+	_ = b.Publish("orders.fanout", "", FakeMessage{ID: "m2"})
+	_ = b.Consume("orders.ms2m-replay", "c1", 1)
+	_, _, _ = b.Next("c1")
+
+	dropped, err := b.DeleteQueue("orders.ms2m-replay")
+	if err != nil {
+		t.Fatalf("DeleteQueue() unexpected error: %v", err)
+	}
+	if dropped != 2 {
+		t.Errorf("expected 2 messages dropped, got %d", dropped)
+	}
+	if b.HasQueue("orders.ms2m-replay") {
+		t.Error("expected the queue to be gone")
+	}
+	if got := b.Bindings("orders.fanout"); !reflect.DeepEqual(got, []string{"orders"}) {
+		t.Errorf("expected the binding to be removed, got %v", got)
+	}
+	if _, _, err := b.Next("c1"); err == nil {
+		t.Error("expected the consumer to be cancelled")
+	}
+	// Deleting a missing queue is a no-op, binding to one is not.
+	if _, err := b.DeleteQueue("orders.ms2m-replay"); err != nil {
+		t.Errorf("expected deleting a missing queue to succeed, got %v", err)
+	}
+	if err := b.BindQueue("orders.ms2m-replay", "orders.fanout", ""); err == nil {
+		t.Error("expected binding a missing queue to fail")
+	}
+}
+
+func TestFakeBroker_ExpiresMessages(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewFakeBroker()
+	b.SetClock(func() time.Time { return now })
+	_ = b.DeclareQueue("ms2m.control.pod-0")
+	_ = b.Publish("", "ms2m.control.pod-0", FakeMessage{ID: "stale", Expires: now.Add(time.Second)})
+	_ = b.Publish("", "ms2m.control.pod-0", FakeMessage{ID: "fresh"})
+
+	now = now.Add(2 * time.Second)
+	d, ok, _ := b.Get("ms2m.control.pod-0", true)
+	if !ok || d.ID != "fresh" {
+		t.Errorf("expected the expired message to be skipped, got %+v", d)
+	}
+}
+
+func TestFakeBroker_ExchangeKindMismatch(t *testing.T) {
+	b := NewFakeBroker()
+	_ = b.DeclareExchange("orders", ExchangeDirect)
+	err := b.DeclareExchange("orders", ExchangeFanout)
+	if err == nil {
+		t.Fatal("expected redeclaring with another kind to fail")
+	}
+	if retry.Classify(classify(err)) != retry.Permanent {
+		t.Errorf("expected a permanent error, got %v", err)
+	}
+}
+
+func TestFakeBrokerClient_SecondaryQueueLifecycle(t *testing.T) {
+	b := NewFakeBroker()
+	_ = b.DeclareQueue("orders")
+	client := NewFakeBrokerClient(b)
+	ctx := context.Background()
+
+	if _, err := client.GetQueueDepth(ctx, "orders"); !retry.IsTransient(err) {
+		t.Errorf("expected transient not-connected error before Connect, got %v", err)
+	}
+	_ = client.Connect(ctx, "amqp://localhost:5672")
+
+	secondary, err := client.CreateSecondaryQueue(ctx, "orders", "orders.fanout", "orders.new")
+	if err != nil {
+		t.Fatalf("CreateSecondaryQueue() unexpected error: %v", err)
+	}
+	if secondary != "orders.ms2m-replay" {
+		t.Errorf("expected orders.ms2m-replay, got %q", secondary)
+	}
+	if got := b.Bindings("orders.fanout"); !reflect.DeepEqual(got, []string{"orders", "orders.ms2m-replay"}) {
+		t.Errorf("expected both queues bound, got %v", got)
+	}
+
+	_ = b.Publish("orders.fanout", "", FakeMessage{ID: "m1"})
+	if depth, _ := client.GetQueueDepth(ctx, secondary); depth != 1 {
+		t.Errorf("expected depth 1, got %d", depth)
+	}
+
+	if err := client.DeleteSecondaryQueue(ctx, secondary, "orders", "orders.fanout"); err != nil {
+		t.Fatalf("DeleteSecondaryQueue() unexpected error: %v", err)
+	}
+	if got := b.Bindings("orders.fanout"); !reflect.DeepEqual(got, []string{"orders"}) {
+		t.Errorf("expected the primary binding to be left, got %v", got)
+	}
+	if _, err := client.GetQueueDepth(ctx, secondary); retry.Classify(err) != retry.Permanent {
+		t.Errorf("expected a permanent not-found error, got %v", err)
+	}
+}
+
+func TestFakeBrokerClient_GetQueueStatsSplitsUnacked(t *testing.T) {
+	b := newFanout(t, "orders.fanout", "orders")
+	client := NewFakeBrokerClient(b)
+	ctx := context.Background()
+	_ = client.Connect(ctx, "amqp://localhost:5672")
+
+	_ = b.Publish("orders.fanout", "", FakeMessage{ID: "m1"})
+	_ = b.Publish("orders.fanout", "", FakeMessage{ID: "m2"})
+	_ = b.Consume("orders", "c1", 1)
+	_, _, _ = b.Next("c1")
+
+	ready, unacked, err := client.GetQueueStats(ctx, "orders")
+	if err != nil {
+		t.Fatalf("GetQueueStats() unexpected error: %v", err)
+	}
+	if ready != 1 || unacked != 1 {
+		t.Errorf("expected 1 ready and 1 unacked, got %d and %d", ready, unacked)
+	}
+	if depth, _ := client.GetQueueDepth(ctx, "orders"); depth != 1 {
+		t.Errorf("expected depth to count ready messages only, got %d", depth)
+	}
+	if consumers, _ := client.GetQueueConsumers(ctx, "orders"); consumers != 1 {
+		t.Errorf("expected 1 consumer, got %d", consumers)
+	}
+}
+
+func TestFakeBrokerClient_ControlRoundTrip(t *testing.T) {
+	b := newFanout(t, "orders.fanout", "orders")
+	client := NewFakeBrokerClient(b)
+	ctx := context.Background()
+	_ = client.Connect(ctx, "amqp://localhost:5672")
+	_ = b.DeclareQueue("orders.ms2m-replay")
+
+	pod, err := NewSimConsumer(b, "orders-0", "orders", true)
+	if err != nil {
+		t.Fatalf("NewSimConsumer() unexpected error: %v", err)
+	}
+	replyQueue := protocol.ReplyQueueName("default", "mig")
+	if err := client.DeclareReplyQueue(ctx, replyQueue); err != nil {
+		t.Fatalf("DeclareReplyQueue() unexpected error: %v", err)
+	}
+
+	send := func(id string, typ protocol.ControlMessageType, payload map[string]interface{}) {
+		t.Helper()
+		if err := client.SendControlMessage(ctx, "orders-0", protocol.ControlMessage{ID: id, Type: typ, ReplyTo: replyQueue, Payload: payload}); err != nil {
+			t.Fatalf("SendControlMessage() unexpected error: %v", err)
+		}
+	}
+	send("req-1", protocol.ControlStartReplay, map[string]interface{}{"queue": "orders.ms2m-replay"})
+	if reply, _ := client.ReceiveControlReply(ctx, replyQueue, "req-1"); reply != nil {
+		t.Fatalf("expected no reply before the pod handled the request, got %+v", reply)
+	}
+	_ = pod.HandleControl()
+	reply, err := client.ReceiveControlReply(ctx, replyQueue, "req-1")
+	if err != nil || reply == nil || reply.Status != protocol.ReplyAck {
+		t.Fatalf("expected an ack, got %+v (err %v)", reply, err)
+	}
+	if pod.Queue() != "orders.ms2m-replay" {
+		t.Errorf("expected the pod to consume the replay queue, got %q", pod.Queue())
+	}
+
+	send("req-2", protocol.ControlStartReplay, nil)
+	send("req-3", protocol.ControlStopConsuming, nil)
+	_ = pod.HandleControl()
+	// The nack to req-2 is ahead of req-3's reply and is discarded.
+	reply, _ = client.ReceiveControlReply(ctx, replyQueue, "req-3")
+	if reply == nil || reply.Status != protocol.ReplyAck {
+		t.Fatalf("expected an ack to STOP_CONSUMING, got %+v", reply)
+	}
+	if consumers, _ := client.GetQueueConsumers(ctx, "orders.ms2m-replay"); consumers != 0 || pod.Queue() != "" {
+		t.Errorf("expected the pod to stop consuming, got %d consumers on %q", consumers, pod.Queue())
+	}
+}
@@ -3,13 +3,16 @@ package messaging
 import (
 	"context"
 	"sync"
+
+	"github.com/haidinhtuan/kubernetes-controller/pkg/protocol"
 )
 
 // MockControlMessage records a control message sent via the mock client.
 type MockControlMessage struct {
 	TargetPod string
-	Type      ControlMessageType
+	Type      protocol.ControlMessageType
 	Payload   map[string]interface{}
+	Message   protocol.ControlMessage
 }
 
 // MockBrokerClient is an in-memory implementation of BrokerClient for use
@@ -20,7 +23,14 @@ type MockBrokerClient struct {
 
 	Connected       bool
 	Queues          map[string]int // queue name -> message depth
+	Consumers       map[string]int // queue name -> consumer count
 	ControlMessages []MockControlMessage
+	Replies         map[string][]protocol.ControlReply // reply queue -> pending replies
+
+	// Control protocol behaviour. By default every control message that
+	// names a reply queue is acked at once, as a compliant workload would.
+	Unresponsive map[string]bool // pods that never reply
+	NackReason   string          // when set, replies are nacks with this reason
 
 	// Error injection fields — set these before calling the method
 	// to simulate broker failures.
@@ -35,7 +45,10 @@ type MockBrokerClient struct {
 // NewMockBrokerClient returns a MockBrokerClient ready for use in tests.
 func NewMockBrokerClient() *MockBrokerClient {
 	return &MockBrokerClient{
-		Queues: make(map[string]int),
+		Queues:       make(map[string]int),
+		Consumers:    make(map[string]int),
+		Replies:      make(map[string][]protocol.ControlReply),
+		Unresponsive: make(map[string]bool),
 	}
 }
 
@@ -101,7 +114,18 @@ func (m *MockBrokerClient) GetQueueDepth(_ context.Context, queueName string) (i
 	return m.Queues[queueName], nil
 }
 
-func (m *MockBrokerClient) SendControlMessage(_ context.Context, targetPod string, msgType ControlMessageType, payload map[string]interface{}) error {
+func (m *MockBrokerClient) GetQueueConsumers(_ context.Context, queueName string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.DepthErr != nil {
+		return 0, m.DepthErr
+	}
+
+	return m.Consumers[queueName], nil
+}
+
+func (m *MockBrokerClient) SendControlMessage(_ context.Context, targetPod string, msg protocol.ControlMessage) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -109,14 +133,56 @@ func (m *MockBrokerClient) SendControlMessage(_ context.Context, targetPod strin
 		return m.SendErr
 	}
 
+	msg.Version = protocol.Version
 	m.ControlMessages = append(m.ControlMessages, MockControlMessage{
 		TargetPod: targetPod,
-		Type:      msgType,
-		Payload:   payload,
+		Type:      msg.Type,
+		Payload:   msg.Payload,
+		Message:   msg,
 	})
+
+	if msg.ReplyTo != "" && !m.Unresponsive[targetPod] {
+		reply := protocol.ControlReply{Version: protocol.Version, ID: msg.ID, Status: protocol.ReplyAck}
+		if m.NackReason != "" {
+			reply.Status = protocol.ReplyNack
+			reply.Reason = m.NackReason
+		}
+		m.Replies[msg.ReplyTo] = append(m.Replies[msg.ReplyTo], reply)
+	}
+	return nil
+}
+
+func (m *MockBrokerClient) DeclareReplyQueue(_ context.Context, replyQueue string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.CreateQueueErr != nil {
+		return m.CreateQueueErr
+	}
+	if _, exists := m.Queues[replyQueue]; !exists {
+		m.Queues[replyQueue] = 0
+	}
 	return nil
 }
 
+func (m *MockBrokerClient) ReceiveControlReply(_ context.Context, replyQueue, correlationID string) (*protocol.ControlReply, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.DepthErr != nil {
+		return nil, m.DepthErr
+	}
+
+	for len(m.Replies[replyQueue]) > 0 {
+		reply := m.Replies[replyQueue][0]
+		m.Replies[replyQueue] = m.Replies[replyQueue][1:]
+		if reply.ID == correlationID {
+			return &reply, nil
+		}
+	}
+	return nil, nil
+}
+
 func (m *MockBrokerClient) BindQueue(_ context.Context, _, _, _ string) error {
 	return nil
 }
@@ -172,5 +238,22 @@ func (m *MockBrokerClient) SetQueueDepth(queue string, depth int) {
 	m.Queues[queue] = depth
 }
 
+// SetQueueConsumers is a test helper that sets the consumer count for a queue.
+func (m *MockBrokerClient) SetQueueConsumers(queue string, consumers int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Consumers[queue] = consumers
+}
+
+// Reply is a test helper that queues a reply on a reply queue, as a
+// workload answering a control message would.
+func (m *MockBrokerClient) Reply(replyQueue string, reply protocol.ControlReply) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Replies[replyQueue] = append(m.Replies[replyQueue], reply)
+}
+
 // Compile-time check that MockBrokerClient satisfies BrokerClient.
 var _ BrokerClient = (*MockBrokerClient)(nil)
@@ -3,11 +3,57 @@ package messaging
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/haidinhtuan/kubernetes-controller/internal/retry"
+	"github.com/haidinhtuan/kubernetes-controller/pkg/protocol"
 )
 
+// ErrNotConnected is returned when a method is called before Connect, after
+// Close, or after the broker closed the channel. It is transient: the caller
+// connects again (see IsDisconnected).
+var ErrNotConnected = retry.MarkTransient(errors.New("broker channel not connected"))
+
+// IsDisconnected reports whether err means the client's connection or
+// channel is gone. Retrying on the same client cannot succeed; it has to
+// Connect again first.
+func IsDisconnected(err error) bool {
+	return errors.Is(err, ErrNotConnected) || errors.Is(err, amqp.ErrClosed)
+}
+
+// permanentAMQPCodes are the AMQP reply codes that will not clear on retry:
+// bad credentials or vhost, missing or mismatched entities, and commands the
+// broker refuses outright. Other codes (connection forced, resource or
+// internal errors, closed channels) are transient.
+var permanentAMQPCodes = map[int]bool{
+	amqp.AccessRefused:      true,
+	amqp.NotFound:           true,
+	amqp.PreconditionFailed: true,
+	amqp.InvalidPath:        true,
+	amqp.NotAllowed:         true,
+	amqp.NotImplemented:     true,
+	amqp.SyntaxError:        true,
+	amqp.CommandInvalid:     true,
+}
+
+// classify marks err with its retry class when it carries an AMQP reply
+// code. Dial failures are left to retry.Classify's network rules.
+func classify(err error) error {
+	var amqpErr *amqp.Error
+	if !errors.As(err, &amqpErr) {
+		return err
+	}
+	if permanentAMQPCodes[amqpErr.Code] {
+		return retry.MarkPermanent(err)
+	}
+	return retry.MarkTransient(err)
+}
+
 // RabbitMQClient implements BrokerClient using AMQP 0-9-1 (RabbitMQ).
 type RabbitMQClient struct {
 	conn *amqp.Connection
@@ -28,13 +74,13 @@ func (r *RabbitMQClient) Connect(_ context.Context, brokerURL string) error {
 
 	conn, err := amqp.Dial(brokerURL)
 	if err != nil {
-		return fmt.Errorf("amqp dial: %w", err)
+		return classify(fmt.Errorf("amqp dial: %w", err))
 	}
 
 	ch, err := conn.Channel()
 	if err != nil {
 		conn.Close()
-		return fmt.Errorf("amqp open channel: %w", err)
+		return classify(fmt.Errorf("amqp open channel: %w", err))
 	}
 
 	r.conn = conn
@@ -42,6 +88,12 @@ func (r *RabbitMQClient) Connect(_ context.Context, brokerURL string) error {
 	return nil
 }
 
+// connected reports whether the channel is open. The broker closes it on a
+// channel error, e.g. inspecting a queue that does not exist.
+func (r *RabbitMQClient) connected() bool {
+	return r.ch != nil && !r.ch.IsClosed()
+}
+
 func (r *RabbitMQClient) Close() error {
 	var firstErr error
 
@@ -68,8 +120,8 @@ func (r *RabbitMQClient) Close() error {
 // then binds both the primary and secondary queues to the exchange so
 // every published message reaches both consumers.
 func (r *RabbitMQClient) CreateSecondaryQueue(_ context.Context, primaryQueue, exchangeName, _ string) (string, error) {
-	if r.ch == nil {
-		return "", fmt.Errorf("broker channel not connected")
+	if !r.connected() {
+		return "", ErrNotConnected
 	}
 
 	// Declare the fanout exchange
@@ -82,7 +134,7 @@ func (r *RabbitMQClient) CreateSecondaryQueue(_ context.Context, primaryQueue, e
 		false, // no-wait
 		nil,
 	); err != nil {
-		return "", fmt.Errorf("declare exchange %q: %w", exchangeName, err)
+		return "", classify(fmt.Errorf("declare exchange %q: %w", exchangeName, err))
 	}
 
 	secondaryQueue := primaryQueue + ".ms2m-replay"
@@ -96,15 +148,15 @@ func (r *RabbitMQClient) CreateSecondaryQueue(_ context.Context, primaryQueue, e
 		false, // no-wait
 		nil,
 	); err != nil {
-		return "", fmt.Errorf("declare queue %q: %w", secondaryQueue, err)
+		return "", classify(fmt.Errorf("declare queue %q: %w", secondaryQueue, err))
 	}
 
 	// Bind both queues to the fanout exchange
 	if err := r.ch.QueueBind(primaryQueue, "", exchangeName, false, nil); err != nil {
-		return "", fmt.Errorf("bind primary queue %q to %q: %w", primaryQueue, exchangeName, err)
+		return "", classify(fmt.Errorf("bind primary queue %q to %q: %w", primaryQueue, exchangeName, err))
 	}
 	if err := r.ch.QueueBind(secondaryQueue, "", exchangeName, false, nil); err != nil {
-		return "", fmt.Errorf("bind secondary queue %q to %q: %w", secondaryQueue, exchangeName, err)
+		return "", classify(fmt.Errorf("bind secondary queue %q to %q: %w", secondaryQueue, exchangeName, err))
 	}
 
 	return secondaryQueue, nil
@@ -113,11 +165,11 @@ func (r *RabbitMQClient) CreateSecondaryQueue(_ context.Context, primaryQueue, e
 // UnbindQueue removes a queue's binding from an exchange. The queue
 // remains intact for draining but receives no new messages.
 func (r *RabbitMQClient) UnbindQueue(_ context.Context, queueName, exchangeName string) error {
-	if r.ch == nil {
-		return fmt.Errorf("broker channel not connected")
+	if !r.connected() {
+		return ErrNotConnected
 	}
 	if err := r.ch.QueueUnbind(queueName, "", exchangeName, nil); err != nil {
-		return fmt.Errorf("unbind queue %q from %q: %w", queueName, exchangeName, err)
+		return classify(fmt.Errorf("unbind queue %q from %q: %w", queueName, exchangeName, err))
 	}
 	return nil
 }
@@ -126,46 +178,51 @@ func (r *RabbitMQClient) UnbindQueue(_ context.Context, queueName, exchangeName
 // the secondary queue. The primary queue binding and the shared exchange
 // are left intact so the producer can continue publishing.
 func (r *RabbitMQClient) DeleteSecondaryQueue(_ context.Context, secondaryQueue, primaryQueue, exchangeName string) error {
-	if r.ch == nil {
-		return fmt.Errorf("broker channel not connected")
+	if !r.connected() {
+		return ErrNotConnected
 	}
 
 	// Unbind only the secondary queue from the fanout exchange
 	if err := r.ch.QueueUnbind(secondaryQueue, "", exchangeName, nil); err != nil {
-		return fmt.Errorf("unbind secondary queue %q from %q: %w", secondaryQueue, exchangeName, err)
+		return classify(fmt.Errorf("unbind secondary queue %q from %q: %w", secondaryQueue, exchangeName, err))
 	}
 
 	// Delete the secondary queue
 	if _, err := r.ch.QueueDelete(secondaryQueue, false, false, false); err != nil {
-		return fmt.Errorf("delete queue %q: %w", secondaryQueue, err)
+		return classify(fmt.Errorf("delete queue %q: %w", secondaryQueue, err))
 	}
 
 	return nil
 }
 
 func (r *RabbitMQClient) GetQueueDepth(_ context.Context, queueName string) (int, error) {
-	if r.ch == nil {
-		return 0, fmt.Errorf("broker channel not connected")
+	if !r.connected() {
+		return 0, ErrNotConnected
 	}
 	q, err := r.ch.QueueInspect(queueName)
 	if err != nil {
-		return 0, fmt.Errorf("inspect queue %q: %w", queueName, err)
+		return 0, classify(fmt.Errorf("inspect queue %q: %w", queueName, err))
 	}
 	return q.Messages, nil
 }
 
-// controlMessage is the JSON envelope sent over the control queue.
-type controlMessage struct {
-	Type    ControlMessageType     `json:"type"`
-	Payload map[string]interface{} `json:"payload,omitempty"`
+func (r *RabbitMQClient) GetQueueConsumers(_ context.Context, queueName string) (int, error) {
+	if !r.connected() {
+		return 0, ErrNotConnected
+	}
+	q, err := r.ch.QueueInspect(queueName)
+	if err != nil {
+		return 0, classify(fmt.Errorf("inspect queue %q: %w", queueName, err))
+	}
+	return q.Consumers, nil
 }
 
-func (r *RabbitMQClient) SendControlMessage(ctx context.Context, targetPod string, msgType ControlMessageType, payload map[string]interface{}) error {
-	if r.ch == nil {
-		return fmt.Errorf("broker channel not connected")
+func (r *RabbitMQClient) SendControlMessage(ctx context.Context, targetPod string, msg protocol.ControlMessage) error {
+	if !r.connected() {
+		return ErrNotConnected
 	}
 
-	controlQueue := "ms2m.control." + targetPod
+	controlQueue := protocol.ControlQueueName(targetPod)
 
 	// Declare the control queue (idempotent)
 	if _, err := r.ch.QueueDeclare(
@@ -176,54 +233,122 @@ func (r *RabbitMQClient) SendControlMessage(ctx context.Context, targetPod strin
 		false, // no-wait
 		nil,
 	); err != nil {
-		return fmt.Errorf("declare control queue %q: %w", controlQueue, err)
+		return classify(fmt.Errorf("declare control queue %q: %w", controlQueue, err))
 	}
 
-	body, err := json.Marshal(controlMessage{
-		Type:    msgType,
-		Payload: payload,
-	})
+	msg.Version = protocol.Version
+	if msg.SentAt.IsZero() {
+		msg.SentAt = time.Now()
+	}
+	body, err := json.Marshal(msg)
 	if err != nil {
 		return fmt.Errorf("marshal control message: %w", err)
 	}
 
+	publishing := amqp.Publishing{
+		ContentType:   "application/json",
+		DeliveryMode:  amqp.Persistent,
+		MessageId:     msg.ID,
+		CorrelationId: msg.ID,
+		ReplyTo:       msg.ReplyTo,
+		Type:          string(msg.Type),
+		Timestamp:     msg.SentAt,
+		Headers:       amqp.Table{"ms2m-protocol-version": int32(protocol.Version)},
+		Body:          body,
+	}
+	if msg.TTL > 0 {
+		publishing.Expiration = strconv.FormatInt(msg.TTL.Milliseconds(), 10)
+	}
 	if err := r.ch.PublishWithContext(ctx,
 		"",           // default exchange
 		controlQueue, // routing key = queue name
 		false,        // mandatory
 		false,        // immediate
-		amqp.Publishing{
-			ContentType:  "application/json",
-			DeliveryMode: amqp.Persistent,
-			Body:         body,
-		},
+		publishing,
 	); err != nil {
-		return fmt.Errorf("publish control message to %q: %w", controlQueue, err)
+		return classify(fmt.Errorf("publish control message to %q: %w", controlQueue, err))
 	}
 
 	return nil
 }
 
+// replyQueueExpiry removes a reply queue nobody has used for this long,
+// e.g. one left behind by a migration that failed.
+const replyQueueExpiry = time.Hour
+
+func (r *RabbitMQClient) DeclareReplyQueue(_ context.Context, replyQueue string) error {
+	if !r.connected() {
+		return ErrNotConnected
+	}
+	if _, err := r.ch.QueueDeclare(
+		replyQueue,
+		true,  // durable: replies must survive a controller restart
+		false, // auto-delete
+		false, // exclusive
+		false, // no-wait
+		amqp.Table{"x-expires": int32(replyQueueExpiry.Milliseconds())},
+	); err != nil {
+		return classify(fmt.Errorf("declare reply queue %q: %w", replyQueue, err))
+	}
+	return nil
+}
+
+func (r *RabbitMQClient) ReceiveControlReply(_ context.Context, replyQueue, correlationID string) (*protocol.ControlReply, error) {
+	if !r.connected() {
+		return nil, ErrNotConnected
+	}
+	for {
+		d, ok, err := r.ch.Get(replyQueue, false)
+		if err != nil {
+			return nil, classify(fmt.Errorf("get from reply queue %q: %w", replyQueue, err))
+		}
+		if !ok {
+			return nil, nil
+		}
+
+		var reply protocol.ControlReply
+		decodeErr := json.Unmarshal(d.Body, &reply)
+		if err := d.Ack(false); err != nil {
+			return nil, classify(fmt.Errorf("ack reply on %q: %w", replyQueue, err))
+		}
+		if decodeErr != nil {
+			// Not a reply we can read; nothing to correlate it with.
+			continue
+		}
+		if reply.ID == "" {
+			reply.ID = d.CorrelationId
+		}
+		if reply.ID != correlationID {
+			continue
+		}
+		if reply.Version != protocol.Version {
+			return nil, retry.MarkPermanent(fmt.Errorf("reply %s uses control protocol version %d, controller speaks %d",
+				reply.ID, reply.Version, protocol.Version))
+		}
+		return &reply, nil
+	}
+}
+
 // BindQueue binds a queue to an exchange with the given routing key.
 // For fanout exchanges the routing key is ignored, but we accept it
 // for interface consistency.
 func (r *RabbitMQClient) BindQueue(_ context.Context, queueName, exchangeName, _ string) error {
-	if r.ch == nil {
-		return fmt.Errorf("broker channel not connected")
+	if !r.connected() {
+		return ErrNotConnected
 	}
 	if err := r.ch.QueueBind(queueName, "", exchangeName, false, nil); err != nil {
-		return fmt.Errorf("bind queue %q to %q: %w", queueName, exchangeName, err)
+		return classify(fmt.Errorf("bind queue %q to %q: %w", queueName, exchangeName, err))
 	}
 	return nil
 }
 
 // PurgeQueue removes all messages from a queue without deleting it.
 func (r *RabbitMQClient) PurgeQueue(_ context.Context, queueName string) error {
-	if r.ch == nil {
-		return fmt.Errorf("broker channel not connected")
+	if !r.connected() {
+		return ErrNotConnected
 	}
 	if _, err := r.ch.QueuePurge(queueName, false); err != nil {
-		return fmt.Errorf("purge queue %q: %w", queueName, err)
+		return classify(fmt.Errorf("purge queue %q: %w", queueName, err))
 	}
 	return nil
 }
@@ -236,12 +361,12 @@ func (r *RabbitMQClient) PurgeQueue(_ context.Context, queueName string) error {
 // return (Messages, 0, nil) here. The controller checks ready+unacked == 0
 // which is equivalent to GetQueueDepth == 0 for the RabbitMQ AMQP client.
 func (r *RabbitMQClient) GetQueueStats(_ context.Context, queueName string) (int, int, error) {
-	if r.ch == nil {
-		return 0, 0, fmt.Errorf("broker channel not connected")
+	if !r.connected() {
+		return 0, 0, ErrNotConnected
 	}
 	q, err := r.ch.QueueInspect(queueName)
 	if err != nil {
-		return 0, 0, fmt.Errorf("inspect queue %q: %w", queueName, err)
+		return 0, 0, classify(fmt.Errorf("inspect queue %q: %w", queueName, err))
 	}
 	// QueueInspect.Messages = messages_ready (AMQP passive declare).
 	// Unacked messages are tracked per-consumer and not exposed via
@@ -253,8 +378,8 @@ func (r *RabbitMQClient) GetQueueStats(_ context.Context, queueName string) (int
 
 // DeclareAndBindQueue creates a durable queue and binds it to the exchange.
 func (r *RabbitMQClient) DeclareAndBindQueue(_ context.Context, queueName, exchangeName string) error {
-	if r.ch == nil {
-		return fmt.Errorf("broker channel not connected")
+	if !r.connected() {
+		return ErrNotConnected
 	}
 	if _, err := r.ch.QueueDeclare(
 		queueName,
@@ -264,21 +389,21 @@ func (r *RabbitMQClient) DeclareAndBindQueue(_ context.Context, queueName, excha
 		false, // no-wait
 		nil,
 	); err != nil {
-		return fmt.Errorf("declare queue %q: %w", queueName, err)
+		return classify(fmt.Errorf("declare queue %q: %w", queueName, err))
 	}
 	if err := r.ch.QueueBind(queueName, "", exchangeName, false, nil); err != nil {
-		return fmt.Errorf("bind queue %q to %q: %w", queueName, exchangeName, err)
+		return classify(fmt.Errorf("bind queue %q to %q: %w", queueName, exchangeName, err))
 	}
 	return nil
 }
 
 // DeleteQueue removes a queue.
 func (r *RabbitMQClient) DeleteQueue(_ context.Context, queueName string) error {
-	if r.ch == nil {
-		return fmt.Errorf("broker channel not connected")
+	if !r.connected() {
+		return ErrNotConnected
 	}
 	if _, err := r.ch.QueueDelete(queueName, false, false, false); err != nil {
-		return fmt.Errorf("delete queue %q: %w", queueName, err)
+		return classify(fmt.Errorf("delete queue %q: %w", queueName, err))
 	}
 	return nil
 }
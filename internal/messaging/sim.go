@@ -0,0 +1,534 @@
+package messaging
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+
+	"github.com/haidinhtuan/kubernetes-controller/pkg/protocol"
+)
+
+// ---------------------------------------------------------------------------
+// Producer
+// ---------------------------------------------------------------------------
+
+// Producer publishes numbered messages through an exchange, standing in for
+// a workload's upstream. IDs sort in publish order.
+type Producer struct {
+	broker     *FakeBroker
+	exchange   string
+	routingKey string
+	published  []string
+}
+
+// NewProducer returns a Producer publishing to exchange with routingKey.
+func NewProducer(broker *FakeBroker, exchange, routingKey string) *Producer {
+	return &Producer{broker: broker, exchange: exchange, routingKey: routingKey}
+}
+
+// Publish publishes the next n messages.
+func (p *Producer) Publish(n int) error {
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("msg-%06d", len(p.published)+1)
+		if err := p.broker.Publish(p.exchange, p.routingKey, FakeMessage{ID: id, Body: []byte(id)}); err != nil {
+			return fmt.Errorf("publish %s: %w", id, err)
+		}
+		p.published = append(p.published, id)
+	}
+	return nil
+}
+
+// Published returns the IDs published so far.
+func (p *Producer) Published() []string {
+	return append([]string(nil), p.published...)
+}
+
+// ---------------------------------------------------------------------------
+// SimConsumer
+// ---------------------------------------------------------------------------
+
+// SimConsumer is a workload pod on a FakeBroker. It follows the control
+// protocol as ms2mclient.Consumer does: START_REPLAY moves it to the queue
+// in the payload, END_REPLAY back to its primary queue, STOP_CONSUMING
+// stops it for good, and requests naming a reply queue are acked once in
+// effect. Each message is applied to the consumer's state and acknowledged
+// in one step, so a checkpoint holds exactly the messages acknowledged.
+//
+// An idempotent consumer skips messages its state already holds, as a
+// workload using the ms2mclient Seen hook does; others apply them again.
+type SimConsumer struct {
+	broker     *FakeBroker
+	pod        string
+	primary    string
+	idempotent bool
+
+	queue   string // queue consumed; empty while idle
+	tag     string
+	tags    int
+	stopped bool
+	killed  bool
+
+	applied []string
+	seen    map[string]bool
+	skipped int
+}
+
+// NewSimConsumer starts a consumer of primary for pod.
+func NewSimConsumer(broker *FakeBroker, pod, primary string, idempotent bool) (*SimConsumer, error) {
+	c := &SimConsumer{
+		broker:     broker,
+		pod:        pod,
+		primary:    primary,
+		idempotent: idempotent,
+		seen:       make(map[string]bool),
+	}
+	if err := broker.DeclareQueue(protocol.ControlQueueName(pod)); err != nil {
+		return nil, err
+	}
+	if err := broker.DeclareQueue(primary); err != nil {
+		return nil, err
+	}
+	if err := c.switchTo(primary); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Restore checkpoints c and restores the checkpoint as pod. The restored
+// consumer holds c's state as of now and, like a pod in restore mode,
+// consumes nothing until START_REPLAY.
+func (c *SimConsumer) Restore(pod string) (*SimConsumer, error) {
+	restored := &SimConsumer{
+		broker:     c.broker,
+		pod:        pod,
+		primary:    c.primary,
+		idempotent: c.idempotent,
+		applied:    append([]string(nil), c.applied...),
+		seen:       make(map[string]bool, len(c.seen)),
+	}
+	for id := range c.seen {
+		restored.seen[id] = true
+	}
+	if err := c.broker.DeclareQueue(protocol.ControlQueueName(pod)); err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// Pod returns the consumer's pod name.
+func (c *SimConsumer) Pod() string { return c.pod }
+
+// Queue returns the queue being consumed, or "" while idle.
+func (c *SimConsumer) Queue() string { return c.queue }
+
+// Applied returns the message IDs applied to the consumer's state, in
+// order.
+func (c *SimConsumer) Applied() []string { return append([]string(nil), c.applied...) }
+
+// Skipped returns how many deliveries an idempotent consumer skipped as
+// already applied.
+func (c *SimConsumer) Skipped() int { return c.skipped }
+
+// switchTo cancels the current consumer and starts consuming queue.
+func (c *SimConsumer) switchTo(queue string) error {
+	if c.tag != "" {
+		if err := c.broker.Cancel(c.tag); err != nil {
+			return err
+		}
+		c.tag, c.queue = "", ""
+	}
+	c.tags++
+	tag := fmt.Sprintf("%s#%d", c.pod, c.tags)
+	if err := c.broker.Consume(queue, tag, 1); err != nil {
+		return err
+	}
+	c.tag, c.queue = tag, queue
+	return nil
+}
+
+// HandleControl applies every message waiting on the pod's control queue.
+// A killed consumer leaves them queued.
+func (c *SimConsumer) HandleControl() error {
+	if c.killed {
+		return nil
+	}
+	for {
+		d, ok, err := c.broker.Get(protocol.ControlQueueName(c.pod), true)
+		if err != nil || !ok {
+			return err
+		}
+		var msg protocol.ControlMessage
+		if err := json.Unmarshal(d.Body, &msg); err != nil {
+			continue
+		}
+		status, reason := protocol.ReplyAck, ""
+		if err := c.apply(msg); err != nil {
+			status, reason = protocol.ReplyNack, err.Error()
+		}
+		if msg.ReplyTo == "" {
+			continue
+		}
+		body, _ := json.Marshal(protocol.ControlReply{Version: protocol.Version, ID: msg.ID, Status: status, Reason: reason})
+		if err := c.broker.Publish("", msg.ReplyTo, FakeMessage{CorrelationID: msg.ID, Body: body}); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *SimConsumer) apply(msg protocol.ControlMessage) error {
+	switch msg.Type {
+	case protocol.ControlStartReplay:
+		queue, _ := msg.Payload["queue"].(string)
+		if queue == "" {
+			return errors.New("START_REPLAY without a queue")
+		}
+		if c.stopped {
+			return errors.New("consumer is stopped")
+		}
+		return c.switchTo(queue)
+	case protocol.ControlEndReplay:
+		if c.stopped {
+			return errors.New("consumer is stopped")
+		}
+		return c.switchTo(c.primary)
+	case protocol.ControlStopConsuming:
+		c.stopped = true
+		if c.tag != "" {
+			if err := c.broker.Cancel(c.tag); err != nil {
+				return err
+			}
+			c.tag, c.queue = "", ""
+		}
+		return nil
+	case protocol.ControlPing, protocol.ControlStatus:
+		return nil
+	default:
+		return fmt.Errorf("unknown control message type %q", msg.Type)
+	}
+}
+
+// Consume applies and acknowledges up to n messages from the queue being
+// consumed, and returns how many it took. A consumer whose queue was
+// deleted goes idle.
+func (c *SimConsumer) Consume(n int) (int, error) {
+	taken := 0
+	for taken < n && c.tag != "" {
+		d, ok, err := c.broker.Next(c.tag)
+		if errors.Is(err, errFakeConsumerCancelled) {
+			c.tag, c.queue = "", ""
+			break
+		}
+		if err != nil {
+			return taken, err
+		}
+		if !ok {
+			break
+		}
+		taken++
+		if c.idempotent && c.seen[d.ID] {
+			c.skipped++
+		} else {
+			c.applied = append(c.applied, d.ID)
+			c.seen[d.ID] = true
+		}
+		if err := c.broker.Ack(d.Tag); err != nil {
+			return taken, err
+		}
+	}
+	return taken, nil
+}
+
+// Kill stops the pod without warning. Unacknowledged messages go back to
+// their queue and control messages are no longer read.
+func (c *SimConsumer) Kill() error {
+	c.killed = true
+	if c.tag == "" {
+		return nil
+	}
+	err := c.broker.Cancel(c.tag)
+	c.tag, c.queue = "", ""
+	return err
+}
+
+// ---------------------------------------------------------------------------
+// Sim
+// ---------------------------------------------------------------------------
+
+// Sim runs a script of publishes, consumer steps and broker operations on
+// a FakeBroker, and afterwards compares a consumer's state with what was
+// published. The producer publishes through a fanout exchange that the
+// primary queue is bound to, as the migration protocol assumes.
+type Sim struct {
+	Broker   *FakeBroker
+	Producer *Producer
+
+	exchange  string
+	primary   string
+	consumers map[string]*SimConsumer
+	trace     []string
+}
+
+// SimStep is one step of a Sim script.
+type SimStep struct {
+	Name string
+	Run  func(s *Sim) error
+}
+
+// NewSim returns a Sim with exchange and primary declared and bound, and
+// no consumers.
+func NewSim(exchange, primary string) (*Sim, error) {
+	broker := NewFakeBroker()
+	if err := broker.DeclareExchange(exchange, ExchangeFanout); err != nil {
+		return nil, err
+	}
+	if err := broker.DeclareQueue(primary); err != nil {
+		return nil, err
+	}
+	if err := broker.BindQueue(primary, exchange, ""); err != nil {
+		return nil, err
+	}
+	return &Sim{
+		Broker:    broker,
+		Producer:  NewProducer(broker, exchange, ""),
+		exchange:  exchange,
+		primary:   primary,
+		consumers: make(map[string]*SimConsumer),
+	}, nil
+}
+
+// Start starts a consumer of the primary queue for pod.
+func (s *Sim) Start(pod string, idempotent bool) (*SimConsumer, error) {
+	c, err := NewSimConsumer(s.Broker, pod, s.primary, idempotent)
+	if err != nil {
+		return nil, err
+	}
+	s.consumers[pod] = c
+	return c, nil
+}
+
+// Consumer returns the consumer for pod, or nil.
+func (s *Sim) Consumer(pod string) *SimConsumer {
+	return s.consumers[pod]
+}
+
+// Run runs steps in order and stops at the first error.
+func (s *Sim) Run(steps ...SimStep) error {
+	for _, step := range steps {
+		s.trace = append(s.trace, step.Name)
+		if err := step.Run(s); err != nil {
+			return fmt.Errorf("step %d (%s): %w", len(s.trace), step.Name, err)
+		}
+	}
+	return nil
+}
+
+// Trace returns the names of the steps run so far.
+func (s *Sim) Trace() []string {
+	return append([]string(nil), s.trace...)
+}
+
+// consumer returns the consumer for pod or an error naming it.
+func (s *Sim) consumer(pod string) (*SimConsumer, error) {
+	c, ok := s.consumers[pod]
+	if !ok {
+		return nil, fmt.Errorf("no consumer %q", pod)
+	}
+	return c, nil
+}
+
+// SimPublish publishes n messages.
+func SimPublish(n int) SimStep {
+	return SimStep{Name: fmt.Sprintf("publish %d", n), Run: func(s *Sim) error {
+		return s.Producer.Publish(n)
+	}}
+}
+
+// SimConsume lets pod handle its control messages and consume up to n
+// messages.
+func SimConsume(pod string, n int) SimStep {
+	return SimStep{Name: fmt.Sprintf("%s consumes %d", pod, n), Run: func(s *Sim) error {
+		c, err := s.consumer(pod)
+		if err != nil {
+			return err
+		}
+		if err := c.HandleControl(); err != nil {
+			return err
+		}
+		_, err = c.Consume(n)
+		return err
+	}}
+}
+
+// SimControl lets each pod handle its control messages.
+func SimControl(pods ...string) SimStep {
+	return SimStep{Name: "control " + strings.Join(pods, ","), Run: func(s *Sim) error {
+		for _, pod := range pods {
+			c, err := s.consumer(pod)
+			if err != nil {
+				return err
+			}
+			if err := c.HandleControl(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}}
+}
+
+// SimDrain lets pod handle its control messages and consume until its
+// queue has no ready message.
+func SimDrain(pod string) SimStep {
+	return SimStep{Name: pod + " drains", Run: func(s *Sim) error {
+		c, err := s.consumer(pod)
+		if err != nil {
+			return err
+		}
+		if err := c.HandleControl(); err != nil {
+			return err
+		}
+		for {
+			n, err := c.Consume(100)
+			if err != nil || n == 0 {
+				return err
+			}
+		}
+	}}
+}
+
+// SimRestore checkpoints from and restores it as pod.
+func SimRestore(from, pod string) SimStep {
+	return SimStep{Name: fmt.Sprintf("checkpoint %s, restore as %s", from, pod), Run: func(s *Sim) error {
+		c, err := s.consumer(from)
+		if err != nil {
+			return err
+		}
+		restored, err := c.Restore(pod)
+		if err != nil {
+			return err
+		}
+		s.consumers[pod] = restored
+		return nil
+	}}
+}
+
+// SimKill kills pod.
+func SimKill(pod string) SimStep {
+	return SimStep{Name: "kill " + pod, Run: func(s *Sim) error {
+		c, err := s.consumer(pod)
+		if err != nil {
+			return err
+		}
+		return c.Kill()
+	}}
+}
+
+// SimDo runs fn as a named step, typically a controller broker operation.
+func SimDo(name string, fn func(s *Sim) error) SimStep {
+	return SimStep{Name: name, Run: fn}
+}
+
+// SimTraffic runs rounds of random traffic: each round publishes up to
+// maxPublish messages and lets each pod handle its control messages and
+// consume up to maxConsume.
+func SimTraffic(rng *rand.Rand, rounds, maxPublish, maxConsume int, pods ...string) SimStep {
+	return SimStep{Name: fmt.Sprintf("traffic x%d", rounds), Run: func(s *Sim) error {
+		for i := 0; i < rounds; i++ {
+			if err := s.Producer.Publish(rng.IntN(maxPublish + 1)); err != nil {
+				return err
+			}
+			for _, pod := range pods {
+				if err := SimConsume(pod, rng.IntN(maxConsume+1)).Run(s); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}}
+}
+
+// ---------------------------------------------------------------------------
+// DeliveryReport
+// ---------------------------------------------------------------------------
+
+// DeliveryReport compares a consumer's state with what was published.
+type DeliveryReport struct {
+	// Published is the number of messages published.
+	Published int
+
+	// Lost are published messages the state does not hold.
+	Lost []string
+
+	// Duplicated are messages applied more than once.
+	Duplicated []string
+
+	// Reordered are messages applied after a message published later.
+	Reordered []string
+
+	// Skipped is the number of redeliveries an idempotent consumer skipped.
+	Skipped int
+}
+
+// Report checks pod's state against every message published.
+func (s *Sim) Report(pod string) DeliveryReport {
+	r := DeliveryReport{Published: len(s.Producer.published)}
+	c, ok := s.consumers[pod]
+	if !ok {
+		r.Lost = s.Producer.Published()
+		return r
+	}
+	r.Skipped = c.skipped
+
+	count := make(map[string]int)
+	latest := ""
+	for _, id := range c.applied {
+		count[id]++
+		if count[id] > 1 {
+			if count[id] == 2 {
+				r.Duplicated = append(r.Duplicated, id)
+			}
+			continue
+		}
+		if id < latest {
+			r.Reordered = append(r.Reordered, id)
+		} else {
+			latest = id
+		}
+	}
+	for _, id := range s.Producer.published {
+		if count[id] == 0 {
+			r.Lost = append(r.Lost, id)
+		}
+	}
+	sort.Strings(r.Duplicated)
+	return r
+}
+
+// Err returns an error describing lost, duplicated and reordered messages,
+// or nil if there are none.
+func (r DeliveryReport) Err() error {
+	var problems []string
+	for _, p := range []struct {
+		what string
+		ids  []string
+	}{{"lost", r.Lost}, {"duplicated", r.Duplicated}, {"reordered", r.Reordered}} {
+		if len(p.ids) > 0 {
+			problems = append(problems, fmt.Sprintf("%d %s (%s)", len(p.ids), p.what, abbreviate(p.ids)))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("of %d messages published: %s", r.Published, strings.Join(problems, ", "))
+}
+
+// abbreviate lists the first few IDs.
+func abbreviate(ids []string) string {
+	const max = 5
+	if len(ids) <= max {
+		return strings.Join(ids, " ")
+	}
+	return strings.Join(ids[:max], " ") + " ..."
+}
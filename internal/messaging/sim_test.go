@@ -0,0 +1,487 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/haidinhtuan/kubernetes-controller/pkg/protocol"
+)
+
+// The tests below script the broker operations each migration path issues,
+// in the controller's order and through a BrokerClient, and interleave
+// random publishes and consumption between them. Each seed is one
+// interleaving; a failure reports the seed and the steps that led to it.
+//
+// The protocol is at-least-once: its guarantees assume an idempotent
+// consumer and a source that keeps up with its queue, so that nothing
+// published before the replay queue is bound is left in the primary queue
+// when the checkpoint is taken. Under those assumptions the restored pod's
+// state must hold every published message exactly once and in order.
+
+const (
+	simSeeds    = 200
+	simExchange = "orders.fanout"
+	simPrimary  = "orders"
+	simReplay   = "orders.ms2m-replay"
+	simBuffer   = "orders.ms2m-fence-buffer"
+	simReplyQ   = "ms2m.reply.default.mig"
+)
+
+// simMigration issues controller broker operations on a Sim.
+type simMigration struct {
+	s    *Sim
+	rng  *rand.Rand
+	ctl  *FakeBrokerClient
+	ctx  context.Context
+	sent int
+
+	// maxPublish bounds the messages published per traffic round; zero
+	// makes a script deterministic.
+	maxPublish int
+}
+
+func newSimMigration(t *testing.T, seed uint64, maxPublish int) *simMigration {
+	t.Helper()
+	s, err := NewSim(simExchange, simPrimary)
+	if err != nil {
+		t.Fatalf("NewSim() unexpected error: %v", err)
+	}
+	ctl := NewFakeBrokerClient(s.Broker)
+	ctx := context.Background()
+	_ = ctl.Connect(ctx, "amqp://localhost:5672")
+	if err := ctl.DeclareReplyQueue(ctx, simReplyQ); err != nil {
+		t.Fatalf("DeclareReplyQueue() unexpected error: %v", err)
+	}
+	return &simMigration{s: s, rng: rand.New(rand.NewPCG(seed, seed)), ctl: ctl, ctx: ctx, maxPublish: maxPublish}
+}
+
+// traffic runs a few rounds of random traffic for those of pods that
+// exist yet. Pods can consume twice as many messages per round as are
+// published, so they keep up.
+func (m *simMigration) traffic(pods ...string) SimStep {
+	return SimDo("traffic", func(s *Sim) error {
+		var running []string
+		for _, pod := range pods {
+			if s.Consumer(pod) != nil {
+				running = append(running, pod)
+			}
+		}
+		return SimTraffic(m.rng, 1+m.rng.IntN(4), m.maxPublish, 2*m.maxPublish+1, running...).Run(s)
+	})
+}
+
+// await sends a control message to pod and runs traffic for pod and pods
+// until pod acks it, as awaitControl does.
+func (m *simMigration) await(pod string, typ protocol.ControlMessageType, payload map[string]interface{}, pods ...string) SimStep {
+	return SimDo(fmt.Sprintf("await %s from %s", typ, pod), func(s *Sim) error {
+		m.sent++
+		id := fmt.Sprintf("req-%d", m.sent)
+		msg := protocol.ControlMessage{ID: id, Type: typ, ReplyTo: simReplyQ, Payload: payload}
+		if err := m.ctl.SendControlMessage(m.ctx, pod, msg); err != nil {
+			return err
+		}
+		for i := 0; i < 100; i++ {
+			if err := m.traffic(append(pods, pod)...).Run(s); err != nil {
+				return err
+			}
+			reply, err := m.ctl.ReceiveControlReply(m.ctx, simReplyQ, id)
+			if err != nil {
+				return err
+			}
+			if reply != nil {
+				if reply.Status != protocol.ReplyAck {
+					return fmt.Errorf("%s nacked: %s", typ, reply.Reason)
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("no reply to %s", typ)
+	})
+}
+
+// notify sends a control message to pod without waiting for a reply.
+func (m *simMigration) notify(pod string, typ protocol.ControlMessageType, payload map[string]interface{}) SimStep {
+	return SimDo(fmt.Sprintf("notify %s to %s", typ, pod), func(*Sim) error {
+		m.sent++
+		return m.ctl.SendControlMessage(m.ctx, pod, protocol.ControlMessage{ID: fmt.Sprintf("req-%d", m.sent), Type: typ, Payload: payload})
+	})
+}
+
+// do runs a broker operation as a step.
+func (m *simMigration) do(name string, fn func(ctx context.Context, c BrokerClient) error) SimStep {
+	return SimDo(name, func(*Sim) error { return fn(m.ctx, m.ctl) })
+}
+
+// pollEmpty runs traffic until queue has nothing ready or unacked. After a
+// while publishing stops, so a pod that keeps up always gets there.
+func (m *simMigration) pollEmpty(queue string, pods ...string) SimStep {
+	return SimDo("poll "+queue, func(s *Sim) error {
+		for i := 0; i < 1000; i++ {
+			ready, unacked, err := m.ctl.GetQueueStats(m.ctx, queue)
+			if err != nil {
+				return err
+			}
+			if ready+unacked == 0 {
+				return nil
+			}
+			step := m.traffic(pods...)
+			if i >= 20 {
+				step = m.consume(pods...)
+			}
+			if err := step.Run(s); err != nil {
+				return err
+			}
+		}
+		return fmt.Errorf("%s never drained", queue)
+	})
+}
+
+// consume lets those of pods that exist consume without publishing.
+func (m *simMigration) consume(pods ...string) SimStep {
+	return SimDo("consume", func(s *Sim) error {
+		for _, pod := range pods {
+			if s.Consumer(pod) == nil {
+				continue
+			}
+			if err := SimConsume(pod, 10).Run(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// createReplayQueue lets the pods catch up with the primary queue and
+// creates the replay queue. Doing both in one step keeps the precondition
+// that nothing published before the replay queue is bound is left for the
+// source to apply after its checkpoint.
+func (m *simMigration) createReplayQueue(pods ...string) SimStep {
+	return SimDo("create replay queue", func(s *Sim) error {
+		for _, pod := range pods {
+			if err := SimDrain(pod).Run(s); err != nil {
+				return err
+			}
+		}
+		_, err := m.ctl.CreateSecondaryQueue(m.ctx, simPrimary, simExchange, "")
+		return err
+	})
+}
+
+// run runs steps, inserting random traffic before each one, and finishes
+// by letting pod drain the primary queue.
+func (m *simMigration) run(pods []string, final string, steps ...SimStep) error {
+	var script []SimStep
+	for _, step := range steps {
+		script = append(script, m.traffic(pods...), step)
+	}
+	script = append(script, m.traffic(final), SimDrain(final))
+	return m.s.Run(script...)
+}
+
+func (m *simMigration) failure(seed uint64, err error) string {
+	trace := m.s.Trace()
+	if len(trace) > 20 {
+		trace = trace[len(trace)-20:]
+	}
+	return fmt.Sprintf("seed %d: %v\nlast steps:\n  %s", seed, err, strings.Join(trace, "\n  "))
+}
+
+// shadowPodSteps scripts a ShadowPod migration of source to target in
+// Cutoff replay mode, ending when the replay queue drains.
+func (m *simMigration) shadowPodSteps(source, target string) []SimStep {
+	replay := map[string]interface{}{"queue": simReplay}
+	return []SimStep{
+		m.createReplayQueue(source),
+		SimRestore(source, target),
+		m.await(target, protocol.ControlStartReplay, replay, source, target),
+		m.pollEmpty(simReplay, source, target),
+		m.await(source, protocol.ControlStopConsuming, nil, source, target),
+		m.pollEmpty(simReplay, source, target),
+		m.await(target, protocol.ControlEndReplay, nil, source, target),
+		m.do("delete replay queue", func(ctx context.Context, c BrokerClient) error {
+			return c.DeleteSecondaryQueue(ctx, simReplay, simPrimary, simExchange)
+		}),
+		SimKill(source),
+	}
+}
+
+func TestSim_ShadowPod_NoLossNoDuplicates(t *testing.T) {
+	for seed := uint64(1); seed <= simSeeds; seed++ {
+		m := newSimMigration(t, seed, 3)
+		if _, err := m.s.Start("myapp-0", true); err != nil {
+			t.Fatalf("Start() unexpected error: %v", err)
+		}
+		pods := []string{"myapp-0", "myapp-0-shadow"}
+		if err := m.run(pods, "myapp-0-shadow", m.shadowPodSteps("myapp-0", "myapp-0-shadow")...); err != nil {
+			t.Fatal(m.failure(seed, err))
+		}
+		if err := m.s.Report("myapp-0-shadow").Err(); err != nil {
+			t.Fatal(m.failure(seed, err))
+		}
+	}
+}
+
+func TestSim_Sequential_NoLossNoDuplicates(t *testing.T) {
+	for _, drain := range []bool{false, true} {
+		for seed := uint64(1); seed <= simSeeds; seed++ {
+			m := newSimMigration(t, seed, 3)
+			if _, err := m.s.Start("myapp-0", true); err != nil {
+				t.Fatalf("Start() unexpected error: %v", err)
+			}
+			pods := []string{"myapp-0", "myapp-0-target"}
+			steps := []SimStep{
+				m.createReplayQueue("myapp-0"),
+				SimRestore("myapp-0", "myapp-0-target"),
+				SimKill("myapp-0"),
+			}
+			if drain {
+				steps = append(steps, m.do("unbind replay queue", func(ctx context.Context, c BrokerClient) error {
+					return c.UnbindQueue(ctx, simReplay, simExchange)
+				}))
+			}
+			steps = append(steps,
+				m.await("myapp-0-target", protocol.ControlStartReplay, map[string]interface{}{"queue": simReplay}, pods...),
+				m.pollEmpty(simReplay, pods...),
+				m.await("myapp-0-target", protocol.ControlEndReplay, nil, pods...),
+				m.do("delete replay queue", func(ctx context.Context, c BrokerClient) error {
+					return c.DeleteSecondaryQueue(ctx, simReplay, simPrimary, simExchange)
+				}),
+			)
+			if err := m.run(pods, "myapp-0-target", steps...); err != nil {
+				t.Fatal(m.failure(seed, err))
+			}
+			if err := m.s.Report("myapp-0-target").Err(); err != nil {
+				t.Fatalf("drain=%v: %s", drain, m.failure(seed, err))
+			}
+		}
+	}
+}
+
+// exchangeFenceSteps scripts an Exchange-Fence identity swap from shadow
+// to replacement, from PrepareSwap through FenceCutover.
+func (m *simMigration) exchangeFenceSteps(shadow, replacement string) []SimStep {
+	pods := []string{shadow, replacement}
+	return []SimStep{
+		m.createReplayQueue(shadow),
+		SimRestore(shadow, replacement),
+		m.await(replacement, protocol.ControlStartReplay, map[string]interface{}{"queue": simReplay}, pods...),
+		m.do("ExchangeFence: bind buffer", func(ctx context.Context, c BrokerClient) error {
+			return c.DeclareAndBindQueue(ctx, simBuffer, simExchange)
+		}),
+		m.traffic(pods...),
+		m.do("ExchangeFence: unbind primary", func(ctx context.Context, c BrokerClient) error {
+			return c.UnbindQueue(ctx, simPrimary, simExchange)
+		}),
+		m.traffic(pods...),
+		m.do("ExchangeFence: unbind replay queue", func(ctx context.Context, c BrokerClient) error {
+			return c.UnbindQueue(ctx, simReplay, simExchange)
+		}),
+		m.pollEmpty(simReplay, pods...),
+		SimKill(shadow),
+		m.do("FenceCutover: rebind primary", func(ctx context.Context, c BrokerClient) error {
+			return c.BindQueue(ctx, simPrimary, simExchange, "")
+		}),
+		m.traffic(replacement),
+		m.do("FenceCutover: unbind buffer", func(ctx context.Context, c BrokerClient) error {
+			return c.UnbindQueue(ctx, simBuffer, simExchange)
+		}),
+		m.traffic(replacement),
+		m.do("FenceCutover: replay buffer", func(ctx context.Context, c BrokerClient) error {
+			ready, unacked, err := c.GetQueueStats(ctx, simBuffer)
+			if err != nil || ready+unacked == 0 {
+				return err
+			}
+			return m.notify(replacement, protocol.ControlStartReplay, map[string]interface{}{"queue": simBuffer}).Run(m.s)
+		}),
+		m.pollEmpty(simBuffer, replacement),
+		m.notify(replacement, protocol.ControlEndReplay, nil),
+		m.do("FenceCutover: delete queues", func(ctx context.Context, c BrokerClient) error {
+			if err := c.DeleteSecondaryQueue(ctx, simReplay, simPrimary, simExchange); err != nil {
+				return err
+			}
+			return c.DeleteQueue(ctx, simBuffer)
+		}),
+	}
+}
+
+func TestSim_ExchangeFence_NoLossNoDuplicates(t *testing.T) {
+	for seed := uint64(1); seed <= simSeeds; seed++ {
+		m := newSimMigration(t, seed, 3)
+		if _, err := m.s.Start("consumer-0", true); err != nil {
+			t.Fatalf("Start() unexpected error: %v", err)
+		}
+		// The shadow takes over from the source first, then swaps back
+		// to the StatefulSet identity.
+		steps := m.shadowPodSteps("consumer-0", "consumer-0-shadow")
+		steps = append(steps, m.exchangeFenceSteps("consumer-0-shadow", "consumer-0-new")...)
+		pods := []string{"consumer-0", "consumer-0-shadow", "consumer-0-new"}
+		if err := m.run(pods, "consumer-0-new", steps...); err != nil {
+			t.Fatal(m.failure(seed, err))
+		}
+		r := m.s.Report("consumer-0-new")
+		if err := r.Err(); err != nil {
+			t.Fatal(m.failure(seed, err))
+		}
+		if unroutable := m.s.Broker.Unroutable(); len(unroutable) > 0 {
+			t.Fatal(m.failure(seed, fmt.Errorf("%d messages unroutable", len(unroutable))))
+		}
+	}
+}
+
+// The remaining tests break one precondition or step and check that the
+// report catches it, so the properties above are not vacuous.
+
+func TestSim_DetectsBufferUnboundBeforePrimaryRebound(t *testing.T) {
+	m := newSimMigration(t, 1, 0)
+	_, _ = m.s.Start("consumer-0-shadow", true)
+	pods := []string{"consumer-0-shadow", "consumer-0-new"}
+	err := m.s.Run(
+		SimPublish(3), SimDrain("consumer-0-shadow"),
+		m.createReplayQueue(),
+		SimRestore("consumer-0-shadow", "consumer-0-new"),
+		m.await("consumer-0-new", protocol.ControlStartReplay, map[string]interface{}{"queue": simReplay}),
+		m.do("bind buffer", func(ctx context.Context, c BrokerClient) error {
+			return c.DeclareAndBindQueue(ctx, simBuffer, simExchange)
+		}),
+		m.do("unbind primary", func(ctx context.Context, c BrokerClient) error {
+			return c.UnbindQueue(ctx, simPrimary, simExchange)
+		}),
+		m.do("unbind replay queue", func(ctx context.Context, c BrokerClient) error {
+			return c.UnbindQueue(ctx, simReplay, simExchange)
+		}),
+		m.pollEmpty(simReplay, pods...),
+		SimKill("consumer-0-shadow"),
+		// Wrong order: nothing is bound between these two steps.
+		m.do("unbind buffer", func(ctx context.Context, c BrokerClient) error {
+			return c.UnbindQueue(ctx, simBuffer, simExchange)
+		}),
+		SimPublish(1),
+		m.do("rebind primary", func(ctx context.Context, c BrokerClient) error {
+			return c.BindQueue(ctx, simPrimary, simExchange, "")
+		}),
+		m.notify("consumer-0-new", protocol.ControlEndReplay, nil),
+		SimPublish(2), SimDrain("consumer-0-new"),
+	)
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	r := m.s.Report("consumer-0-new")
+	if len(r.Lost) != 1 || r.Lost[0] != "msg-000004" {
+		t.Errorf("expected msg-000004 to be lost, got %+v", r)
+	}
+	if got := m.s.Broker.Unroutable(); len(got) != 1 {
+		t.Errorf("expected 1 unroutable message, got %d", len(got))
+	}
+}
+
+func TestSim_DetectsCutoffSwapStateGap(t *testing.T) {
+	// The Cutoff swap unbinds the replay queue while the shadow still
+	// consumes the primary queue; what the shadow consumes after that is
+	// in neither the replacement's checkpoint nor its replay queue.
+	m := newSimMigration(t, 1, 0)
+	_, _ = m.s.Start("consumer-0-shadow", true)
+	err := m.s.Run(
+		SimPublish(2), SimDrain("consumer-0-shadow"),
+		m.createReplayQueue(),
+		SimPublish(2),
+		SimRestore("consumer-0-shadow", "consumer-0-new"),
+		m.do("unbind replay queue", func(ctx context.Context, c BrokerClient) error {
+			return c.UnbindQueue(ctx, simReplay, simExchange)
+		}),
+		SimPublish(2),
+		SimDrain("consumer-0-shadow"),
+		m.await("consumer-0-new", protocol.ControlStartReplay, map[string]interface{}{"queue": simReplay}),
+		m.pollEmpty(simReplay, "consumer-0-new"),
+		m.await("consumer-0-new", protocol.ControlEndReplay, nil),
+		m.do("delete replay queue", func(ctx context.Context, c BrokerClient) error {
+			return c.DeleteSecondaryQueue(ctx, simReplay, simPrimary, simExchange)
+		}),
+		SimKill("consumer-0-shadow"),
+		SimPublish(1), SimDrain("consumer-0-new"),
+	)
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	r := m.s.Report("consumer-0-new")
+	if strings.Join(r.Lost, " ") != "msg-000005 msg-000006" {
+		t.Errorf("expected msg-000005 and msg-000006 to be lost, got %+v", r)
+	}
+}
+
+func TestSim_DetectsReplayCutoffWithQueueNotEmpty(t *testing.T) {
+	m := newSimMigration(t, 1, 0)
+	_, _ = m.s.Start("myapp-0", true)
+	err := m.s.Run(
+		m.createReplayQueue("myapp-0"),
+		SimRestore("myapp-0", "myapp-0-shadow"),
+		SimPublish(4),
+		SimDrain("myapp-0"),
+		m.await("myapp-0-shadow", protocol.ControlStartReplay, map[string]interface{}{"queue": simReplay}),
+		SimConsume("myapp-0-shadow", 1),
+		// The cutoff fires with three messages left to replay.
+		m.await("myapp-0", protocol.ControlStopConsuming, nil),
+		m.await("myapp-0-shadow", protocol.ControlEndReplay, nil),
+		m.do("delete replay queue", func(ctx context.Context, c BrokerClient) error {
+			return c.DeleteSecondaryQueue(ctx, simReplay, simPrimary, simExchange)
+		}),
+		SimKill("myapp-0"),
+		SimPublish(1), SimDrain("myapp-0-shadow"),
+	)
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if r := m.s.Report("myapp-0-shadow"); len(r.Lost) != 3 {
+		t.Errorf("expected 3 lost messages, got %+v", r)
+	}
+}
+
+func TestSim_DetectsBacklogAtReplayQueueCreation(t *testing.T) {
+	m := newSimMigration(t, 1, 0)
+	_, _ = m.s.Start("myapp-0", true)
+	err := m.s.Run(
+		// Two messages are still queued for the source when the replay
+		// queue is bound; the source applies them after the checkpoint.
+		SimPublish(2),
+		m.createReplayQueue(),
+		SimRestore("myapp-0", "myapp-0-shadow"),
+		SimDrain("myapp-0"),
+		m.await("myapp-0-shadow", protocol.ControlStartReplay, map[string]interface{}{"queue": simReplay}),
+		m.await("myapp-0", protocol.ControlStopConsuming, nil),
+		m.pollEmpty(simReplay, "myapp-0-shadow"),
+		m.await("myapp-0-shadow", protocol.ControlEndReplay, nil),
+		SimPublish(1), SimDrain("myapp-0-shadow"),
+	)
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if r := m.s.Report("myapp-0-shadow"); strings.Join(r.Lost, " ") != "msg-000001 msg-000002" {
+		t.Errorf("expected the backlog to be lost, got %+v", r)
+	}
+}
+
+func TestSim_DetectsDuplicatesWithoutIdempotentConsumer(t *testing.T) {
+	// The source applies two messages after the replay queue is bound
+	// and before the checkpoint, so the replay redelivers them.
+	m := newSimMigration(t, 1, 0)
+	_, _ = m.s.Start("myapp-0", false)
+	err := m.s.Run(
+		m.createReplayQueue("myapp-0"),
+		SimPublish(2),
+		SimDrain("myapp-0"),
+		SimRestore("myapp-0", "myapp-0-shadow"),
+		m.await("myapp-0-shadow", protocol.ControlStartReplay, map[string]interface{}{"queue": simReplay}),
+		m.await("myapp-0", protocol.ControlStopConsuming, nil),
+		m.pollEmpty(simReplay, "myapp-0-shadow"),
+		m.await("myapp-0-shadow", protocol.ControlEndReplay, nil),
+	)
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	r := m.s.Report("myapp-0-shadow")
+	if strings.Join(r.Duplicated, " ") != "msg-000001 msg-000002" || len(r.Lost) != 0 {
+		t.Errorf("expected msg-000001 and msg-000002 duplicated and nothing lost, got %+v", r)
+	}
+}
@@ -0,0 +1,109 @@
+// Package retry classifies errors from the broker, kubelet and agent
+// clients as transient (worth retrying) or permanent (fail fast).
+//
+// Clients mark errors where they know best, at the point the error is
+// produced. Classify honours those marks and falls back to a few generic
+// rules for network and Kubernetes API errors. Anything it cannot place is
+// treated as permanent, so an unrecognised error fails the migration just as
+// it did before retries existed.
+package retry
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Class is the retry classification of an error.
+type Class string
+
+const (
+	// Transient errors are expected to clear on their own: dropped
+	// connections, timeouts, 5xx responses, throttling.
+	Transient Class = "Transient"
+	// Permanent errors will not change on retry: missing pods, rejected
+	// credentials, runtimes without checkpoint support.
+	Permanent Class = "Permanent"
+)
+
+// classified attaches a Class to an error without changing its message.
+type classified struct {
+	err   error
+	class Class
+}
+
+func (e *classified) Error() string { return e.err.Error() }
+func (e *classified) Unwrap() error { return e.err }
+
+// Mark attaches class to err. It returns nil for a nil err.
+func Mark(err error, class Class) error {
+	if err == nil {
+		return nil
+	}
+	return &classified{err: err, class: class}
+}
+
+// MarkTransient marks err as transient.
+func MarkTransient(err error) error { return Mark(err, Transient) }
+
+// MarkPermanent marks err as permanent.
+func MarkPermanent(err error) error { return Mark(err, Permanent) }
+
+// Classify returns the class of err. The outermost explicit mark wins;
+// otherwise timeouts, refused or reset connections and retryable API server
+// responses are transient, and everything else is permanent.
+func Classify(err error) Class {
+	var c *classified
+	if errors.As(err, &c) {
+		return c.class
+	}
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) {
+		return Transient
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return Transient
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		return ClassifyStatusCode(int(status.Status().Code))
+	}
+	return Permanent
+}
+
+// IsTransient reports whether err is classified as transient.
+func IsTransient(err error) bool {
+	return err != nil && Classify(err) == Transient
+}
+
+// ClassifyStatusCode classifies an HTTP response status: throttling, request
+// timeouts and server errors other than 501 Not Implemented are transient.
+func ClassifyStatusCode(code int) Class {
+	switch {
+	case code == 408 || code == 429:
+		return Transient
+	case code >= 500 && code != 501:
+		return Transient
+	default:
+		return Permanent
+	}
+}
+
+// Backoff returns the delay before retry number attempt (1-based): initial,
+// doubled for every further attempt and capped at max.
+func Backoff(attempt int32, initial, max time.Duration) time.Duration {
+	d := initial
+	for i := int32(1); i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
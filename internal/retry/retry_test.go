@@ -0,0 +1,68 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestClassify(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+	tests := []struct {
+		name string
+		err  error
+		want Class
+	}{
+		{"unmarked", errors.New("boom"), Permanent},
+		{"marked transient", MarkTransient(errors.New("boom")), Transient},
+		{"mark survives wrapping", fmt.Errorf("outer: %w", MarkTransient(errors.New("boom"))), Transient},
+		{"outer mark wins", MarkPermanent(MarkTransient(errors.New("boom"))), Permanent},
+		{"deadline", fmt.Errorf("call: %w", context.DeadlineExceeded), Transient},
+		{"connection refused", fmt.Errorf("dial: %w", syscall.ECONNREFUSED), Transient},
+		{"api not found", apierrors.NewNotFound(pods, "myapp-0"), Permanent},
+		{"api forbidden", apierrors.NewForbidden(pods, "myapp-0", errors.New("rbac")), Permanent},
+		{"api unavailable", apierrors.NewServiceUnavailable("try later"), Transient},
+		{"api throttled", apierrors.NewTooManyRequests("slow down", 1), Transient},
+		{"api wrapped", fmt.Errorf("get: %w", apierrors.NewInternalError(errors.New("etcd"))), Transient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Errorf("Classify(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMark_KeepsMessageAndChain(t *testing.T) {
+	base := errors.New("boom")
+	err := MarkTransient(base)
+	if err.Error() != "boom" {
+		t.Errorf("expected message to be unchanged, got %q", err.Error())
+	}
+	if !errors.Is(err, base) {
+		t.Error("expected marked error to unwrap to the original")
+	}
+	if Mark(nil, Transient) != nil {
+		t.Error("expected Mark(nil) to be nil")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt, want := range map[int32]time.Duration{
+		1: 2 * time.Second,
+		2: 4 * time.Second,
+		3: 8 * time.Second,
+		5: 10 * time.Second,
+	} {
+		if got := Backoff(attempt, 2*time.Second, 10*time.Second); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
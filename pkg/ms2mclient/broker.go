@@ -0,0 +1,135 @@
+package ms2mclient
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Broker is the part of a message broker the Consumer uses. AMQPBroker
+// implements it over an AMQP 0-9-1 channel; tests can supply an in-memory
+// implementation.
+type Broker interface {
+	// DeclareQueue makes sure the durable queue exists.
+	DeclareQueue(ctx context.Context, queue string) error
+
+	// Get fetches and acknowledges one message from queue. ok is false when
+	// the queue is empty.
+	Get(ctx context.Context, queue string) (body []byte, ok bool, err error)
+
+	// Consume starts delivering messages from queue, with at most prefetch
+	// of them unacknowledged. cancel stops the consumer; the deliveries
+	// channel is closed once the messages already delivered have been read.
+	Consume(ctx context.Context, queue string, prefetch int) (deliveries <-chan Delivery, cancel func() error, err error)
+
+	// Publish sends body to queue through the default exchange.
+	Publish(ctx context.Context, queue, correlationID string, body []byte) error
+}
+
+// Delivery is a message delivered by Broker.Consume.
+type Delivery struct {
+	// ID is the publisher-assigned message ID, if any.
+	ID string
+
+	// Body is the message body.
+	Body []byte
+
+	// Ack acknowledges the message.
+	Ack func() error
+
+	// Nack rejects the message, putting it back on the queue if requeue is
+	// set.
+	Nack func(requeue bool) error
+}
+
+// AMQPBroker implements Broker on an AMQP 0-9-1 channel (RabbitMQ).
+type AMQPBroker struct {
+	ch   *amqp.Channel
+	tags atomic.Int64
+}
+
+// NewAMQPBroker returns a Broker using ch. The caller owns the channel and
+// its connection.
+func NewAMQPBroker(ch *amqp.Channel) *AMQPBroker {
+	return &AMQPBroker{ch: ch}
+}
+
+func (b *AMQPBroker) DeclareQueue(_ context.Context, queue string) error {
+	if _, err := b.ch.QueueDeclare(
+		queue,
+		true,  // durable
+		false, // auto-delete
+		false, // exclusive
+		false, // no-wait
+		nil,
+	); err != nil {
+		return fmt.Errorf("declare queue %q: %w", queue, err)
+	}
+	return nil
+}
+
+func (b *AMQPBroker) Get(_ context.Context, queue string) ([]byte, bool, error) {
+	d, ok, err := b.ch.Get(queue, true)
+	if err != nil {
+		return nil, false, fmt.Errorf("get from %q: %w", queue, err)
+	}
+	return d.Body, ok, nil
+}
+
+func (b *AMQPBroker) Consume(ctx context.Context, queue string, prefetch int) (<-chan Delivery, func() error, error) {
+	if err := b.ch.Qos(prefetch, 0, false); err != nil {
+		return nil, nil, fmt.Errorf("set prefetch: %w", err)
+	}
+	tag := fmt.Sprintf("ms2m-%d", b.tags.Add(1))
+	in, err := b.ch.ConsumeWithContext(ctx,
+		queue,
+		tag,
+		false, // auto-ack
+		false, // exclusive
+		false, // no-local
+		false, // no-wait
+		nil,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("consume from %q: %w", queue, err)
+	}
+
+	out := make(chan Delivery)
+	go func() {
+		defer close(out)
+		for d := range in {
+			out <- Delivery{
+				ID:   d.MessageId,
+				Body: d.Body,
+				Ack:  func() error { return d.Ack(false) },
+				Nack: func(requeue bool) error { return d.Nack(false, requeue) },
+			}
+		}
+	}()
+	cancel := func() error {
+		if err := b.ch.Cancel(tag, false); err != nil {
+			return fmt.Errorf("cancel consumer on %q: %w", queue, err)
+		}
+		return nil
+	}
+	return out, cancel, nil
+}
+
+func (b *AMQPBroker) Publish(ctx context.Context, queue, correlationID string, body []byte) error {
+	if err := b.ch.PublishWithContext(ctx,
+		"",    // default exchange
+		queue, // routing key = queue name
+		false, // mandatory
+		false, // immediate
+		amqp.Publishing{
+			ContentType:   "application/json",
+			CorrelationId: correlationID,
+			Body:          body,
+		},
+	); err != nil {
+		return fmt.Errorf("publish to %q: %w", queue, err)
+	}
+	return nil
+}
@@ -0,0 +1,442 @@
+// Package ms2mclient implements the workload side of the MS2M migration
+// protocol, so a Go consumer can be live-migrated by the controller without
+// reimplementing the replay handshake.
+//
+// A Consumer wraps the application's message handler. It consumes the
+// primary queue, watches the pod's control queue (ms2m.control.<pod>) and
+// follows the controller's instructions:
+//
+//   - START_REPLAY switches consumption to the replay queue named in the
+//     payload. A pod restored from a checkpoint (restore mode) consumes
+//     nothing until it receives START_REPLAY, so it cannot race the source
+//     pod on the primary queue.
+//   - END_REPLAY switches back to the primary queue.
+//   - STOP_CONSUMING cancels consumption for good; sent to the source pod
+//     before it is deleted.
+//   - PING and STATUS are answered directly.
+//
+// Requests are acknowledged on the migration's reply queue once the state
+// change is in effect, as the controller expects with ackMode Required.
+// The Consumer reports itself Ready while it consumes the primary queue.
+// ReadyHandler, the readiness probe endpoint, passes earlier: once the
+// consumer is connected and reading its control queue, so a restored pod
+// becomes ready while it waits for START_REPLAY.
+package ms2mclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/haidinhtuan/kubernetes-controller/pkg/protocol"
+)
+
+// Defaults for Config.
+const (
+	DefaultPrefetch        = 50
+	DefaultControlInterval = time.Second
+)
+
+// RestoreModeEnv is set to "true" in pods restored from a checkpoint.
+const RestoreModeEnv = "MS2M_RESTORE_MODE"
+
+// Message is an application message handed to the Handler.
+type Message struct {
+	// ID is the publisher-assigned message ID, if any.
+	ID string
+
+	// Body is the message body.
+	Body []byte
+
+	// Queue is the queue the message was consumed from.
+	Queue string
+
+	// Replay is true for messages consumed from the replay queue during a
+	// migration. The source pod may have handled the same messages after
+	// the checkpoint was taken.
+	Replay bool
+}
+
+// Handler processes one message. An error nacks the message and puts it
+// back on the queue.
+type Handler func(ctx context.Context, msg Message) error
+
+// Config configures a Consumer.
+type Config struct {
+	// PrimaryQueue is the queue the application consumes outside a
+	// migration. Required.
+	PrimaryQueue string
+
+	// Handler processes messages. Required.
+	Handler Handler
+
+	// Pod is the pod name; the control queue is ms2m.control.<Pod>.
+	// Default PodName().
+	Pod string
+
+	// RestoreMode holds off consuming until START_REPLAY arrives. Set it
+	// with RestoreModeFromEnv() so pods restored from a checkpoint wait.
+	RestoreMode bool
+
+	// Seen is the idempotency hook. When it reports a message as already
+	// handled, the message is acknowledged without calling Handler. Useful
+	// when the replayed messages overlap with what the source processed.
+	Seen func(msg Message) bool
+
+	// OnReady is called whenever readiness changes.
+	OnReady func(ready bool)
+
+	// Status adds application fields to STATUS replies.
+	Status func() map[string]interface{}
+
+	// Prefetch bounds the unacknowledged messages. Default 50.
+	Prefetch int
+
+	// ControlInterval is how often the control queue is polled. Default 1s.
+	ControlInterval time.Duration
+
+	// Logger receives progress messages. Default slog.Default().
+	Logger *slog.Logger
+}
+
+// Consumer runs the application's handler under the MS2M protocol. Its
+// state (restore mode, replay queue, pending acks) survives Run returning,
+// so Run can be called again with a new Broker after a connection loss.
+type Consumer struct {
+	cfg          Config
+	controlQueue string
+
+	// Guarded by mu; read by STATUS replies and Ready.
+	mu          sync.Mutex
+	restoring   bool
+	replayQueue string
+	stopped     bool
+	pendingAcks []protocol.ControlMessage
+
+	// Only touched by Run.
+	consuming  string
+	deliveries <-chan Delivery
+	cancel     func() error
+
+	connected atomic.Bool
+	ready     atomic.Bool
+	processed atomic.Int64
+}
+
+// New returns a Consumer for cfg.
+func New(cfg Config) (*Consumer, error) {
+	if cfg.PrimaryQueue == "" {
+		return nil, errors.New("ms2mclient: PrimaryQueue is required")
+	}
+	if cfg.Handler == nil {
+		return nil, errors.New("ms2mclient: Handler is required")
+	}
+	if cfg.Pod == "" {
+		cfg.Pod = PodName()
+	}
+	if cfg.Prefetch <= 0 {
+		cfg.Prefetch = DefaultPrefetch
+	}
+	if cfg.ControlInterval <= 0 {
+		cfg.ControlInterval = DefaultControlInterval
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	return &Consumer{
+		cfg:          cfg,
+		controlQueue: protocol.ControlQueueName(cfg.Pod),
+		restoring:    cfg.RestoreMode,
+	}, nil
+}
+
+// PodName returns the pod name from /etc/hostname, falling back to
+// os.Hostname. After a checkpoint restore the kernel hostname is still the
+// source pod's; /etc/hostname is bind-mounted by the runtime and is not.
+func PodName() string {
+	if b, err := os.ReadFile("/etc/hostname"); err == nil {
+		if name := strings.TrimSpace(string(b)); name != "" {
+			return name
+		}
+	}
+	name, _ := os.Hostname()
+	return name
+}
+
+// RestoreModeFromEnv reports whether MS2M_RESTORE_MODE is "true".
+func RestoreModeFromEnv() bool {
+	return os.Getenv(RestoreModeEnv) == "true"
+}
+
+// Ready reports whether the consumer is consuming the primary queue.
+func (c *Consumer) Ready() bool {
+	return c.ready.Load()
+}
+
+// Connected reports whether Run is connected to the broker and reading the
+// control queue, whatever it consumes.
+func (c *Consumer) Connected() bool {
+	return c.connected.Load()
+}
+
+// ReadyHandler serves 200 while Connected and 503 otherwise, for use as a
+// readiness probe. It does not wait for the primary queue: the controller's
+// default PodReady gate only sends START_REPLAY to a ready pod.
+func (c *Consumer) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if !c.Connected() {
+			http.Error(w, "not connected to the broker", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok\n"))
+	})
+}
+
+// Processed returns the number of messages handled successfully.
+func (c *Consumer) Processed() int64 {
+	return c.processed.Load()
+}
+
+// Run consumes until ctx is done or the broker fails. It returns ctx.Err()
+// on cancellation and the broker error otherwise.
+func (c *Consumer) Run(ctx context.Context, b Broker) error {
+	defer c.setReady(false)
+	defer c.connected.Store(false)
+	c.consuming, c.deliveries, c.cancel = "", nil, nil
+
+	if err := b.DeclareQueue(ctx, c.controlQueue); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(c.cfg.ControlInterval)
+	defer ticker.Stop()
+
+	if err := c.pollControl(ctx, b); err != nil {
+		return err
+	}
+	c.connected.Store(true)
+	for c.restoreMode() {
+		c.cfg.Logger.Info("MS2M restore mode: waiting for START_REPLAY", "controlQueue", c.controlQueue)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := c.pollControl(ctx, b); err != nil {
+			return err
+		}
+	}
+
+	for {
+		if err := c.sync(ctx, b); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			if c.cancel != nil {
+				_ = c.cancel()
+			}
+			return ctx.Err()
+		case d, ok := <-c.deliveries:
+			if !ok {
+				return fmt.Errorf("consumer on %q cancelled by the broker", c.consuming)
+			}
+			if err := c.handle(ctx, d); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if err := c.pollControl(ctx, b); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sync points the consumer at the queue the protocol state calls for and
+// then acknowledges the control messages that state reflects.
+func (c *Consumer) sync(ctx context.Context, b Broker) error {
+	c.mu.Lock()
+	want := c.cfg.PrimaryQueue
+	if c.replayQueue != "" {
+		want = c.replayQueue
+	}
+	if c.stopped {
+		want = ""
+	}
+	c.mu.Unlock()
+
+	if want != c.consuming {
+		if c.cancel != nil {
+			if err := c.cancel(); err != nil {
+				return err
+			}
+			// Finish the messages already prefetched before switching.
+			for d := range c.deliveries {
+				if err := c.handle(ctx, d); err != nil {
+					return err
+				}
+			}
+			c.cfg.Logger.Info("Stopped consuming", "queue", c.consuming)
+		}
+		c.consuming, c.deliveries, c.cancel = "", nil, nil
+		c.setReady(false)
+
+		if want != "" {
+			if err := b.DeclareQueue(ctx, want); err != nil {
+				return err
+			}
+			deliveries, cancel, err := b.Consume(ctx, want, c.cfg.Prefetch)
+			if err != nil {
+				return err
+			}
+			c.consuming, c.deliveries, c.cancel = want, deliveries, cancel
+			c.setReady(want == c.cfg.PrimaryQueue)
+			c.cfg.Logger.Info("Consuming", "queue", want)
+		}
+	}
+	return c.flushAcks(ctx, b)
+}
+
+// handle passes one delivery to the Handler unless Seen reports it done.
+func (c *Consumer) handle(ctx context.Context, d Delivery) error {
+	msg := Message{
+		ID:     d.ID,
+		Body:   d.Body,
+		Queue:  c.consuming,
+		Replay: c.consuming != c.cfg.PrimaryQueue,
+	}
+	if c.cfg.Seen != nil && c.cfg.Seen(msg) {
+		return d.Ack()
+	}
+	if err := c.cfg.Handler(ctx, msg); err != nil {
+		c.cfg.Logger.Error("Handler failed, requeueing message", "queue", msg.Queue, "id", msg.ID, "error", err)
+		return d.Nack(true)
+	}
+	c.processed.Add(1)
+	return d.Ack()
+}
+
+// pollControl applies every message waiting on the control queue.
+func (c *Consumer) pollControl(ctx context.Context, b Broker) error {
+	for {
+		body, ok, err := b.Get(ctx, c.controlQueue)
+		if err != nil || !ok {
+			return err
+		}
+		var msg protocol.ControlMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			c.cfg.Logger.Error("Ignoring malformed control message", "error", err)
+			continue
+		}
+		if err := c.apply(ctx, b, msg); err != nil {
+			return err
+		}
+	}
+}
+
+// apply updates the protocol state for msg. Requests that change what is
+// consumed are acknowledged by the next sync, once the change is in effect;
+// the rest are answered here.
+func (c *Consumer) apply(ctx context.Context, b Broker, msg protocol.ControlMessage) error {
+	// Messages without a version predate the acknowledged protocol.
+	if msg.Version != 0 && msg.Version != protocol.Version {
+		return c.reply(ctx, b, msg, protocol.ReplyNack, fmt.Sprintf("unsupported protocol version %d", msg.Version), nil)
+	}
+	c.cfg.Logger.Info("MS2M control message", "type", msg.Type, "migration", msg.Migration)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch msg.Type {
+	case protocol.ControlStartReplay:
+		queue, _ := msg.Payload["queue"].(string)
+		if queue == "" {
+			return c.reply(ctx, b, msg, protocol.ReplyNack, "START_REPLAY without a queue", nil)
+		}
+		c.restoring = false
+		c.replayQueue = queue
+	case protocol.ControlEndReplay:
+		c.replayQueue = ""
+	case protocol.ControlStopConsuming:
+		c.stopped = true
+	case protocol.ControlPing:
+		return c.reply(ctx, b, msg, protocol.ReplyAck, "", nil)
+	case protocol.ControlStatus:
+		return c.reply(ctx, b, msg, protocol.ReplyAck, "", c.statusLocked())
+	default:
+		return c.reply(ctx, b, msg, protocol.ReplyNack, fmt.Sprintf("unknown control message type %q", msg.Type), nil)
+	}
+	c.pendingAcks = append(c.pendingAcks, msg)
+	return nil
+}
+
+// statusLocked builds the STATUS reply payload. c.mu must be held.
+func (c *Consumer) statusLocked() map[string]interface{} {
+	status := map[string]interface{}{}
+	if c.cfg.Status != nil {
+		for k, v := range c.cfg.Status() {
+			status[k] = v
+		}
+	}
+	queue := c.cfg.PrimaryQueue
+	if c.replayQueue != "" {
+		queue = c.replayQueue
+	}
+	status["queue"] = queue
+	status["replaying"] = c.replayQueue != ""
+	status["restoring"] = c.restoring
+	status["stopped"] = c.stopped
+	status["ready"] = c.Ready()
+	status["processed"] = c.Processed()
+	return status
+}
+
+// flushAcks acknowledges the requests whose state change is in effect.
+func (c *Consumer) flushAcks(ctx context.Context, b Broker) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.pendingAcks) > 0 {
+		if err := c.reply(ctx, b, c.pendingAcks[0], protocol.ReplyAck, "", nil); err != nil {
+			return err
+		}
+		c.pendingAcks = c.pendingAcks[1:]
+	}
+	return nil
+}
+
+// reply answers msg on its reply queue. Messages sent without a reply queue
+// (ackMode None) are not answered.
+func (c *Consumer) reply(ctx context.Context, b Broker, msg protocol.ControlMessage, status protocol.ReplyStatus, reason string, payload map[string]interface{}) error {
+	if msg.ReplyTo == "" || msg.ID == "" {
+		return nil
+	}
+	body, err := json.Marshal(protocol.ControlReply{
+		Version: protocol.Version,
+		ID:      msg.ID,
+		Status:  status,
+		Reason:  reason,
+		Payload: payload,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal control reply: %w", err)
+	}
+	return b.Publish(ctx, msg.ReplyTo, msg.ID, body)
+}
+
+func (c *Consumer) restoreMode() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.restoring
+}
+
+func (c *Consumer) setReady(ready bool) {
+	if c.ready.Swap(ready) != ready && c.cfg.OnReady != nil {
+		c.cfg.OnReady(ready)
+	}
+}
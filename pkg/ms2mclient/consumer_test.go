@@ -0,0 +1,428 @@
+package ms2mclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/haidinhtuan/kubernetes-controller/pkg/protocol"
+)
+
+// memBroker is an in-memory Broker. Messages are delivered in order to at
+// most one consumer per queue.
+type memBroker struct {
+	mu        sync.Mutex
+	queues    map[string][][]byte
+	consumers map[string]int
+}
+
+func newMemBroker() *memBroker {
+	return &memBroker{queues: map[string][][]byte{}, consumers: map[string]int{}}
+}
+
+func (b *memBroker) DeclareQueue(_ context.Context, queue string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.queues[queue]; !ok {
+		b.queues[queue] = nil
+	}
+	return nil
+}
+
+func (b *memBroker) Get(_ context.Context, queue string) ([]byte, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.popLocked(queue)
+}
+
+func (b *memBroker) popLocked(queue string) ([]byte, bool, error) {
+	msgs := b.queues[queue]
+	if len(msgs) == 0 {
+		return nil, false, nil
+	}
+	b.queues[queue] = msgs[1:]
+	return msgs[0], true, nil
+}
+
+func (b *memBroker) Consume(_ context.Context, queue string, prefetch int) (<-chan Delivery, func() error, error) {
+	b.mu.Lock()
+	b.consumers[queue]++
+	b.mu.Unlock()
+
+	out := make(chan Delivery, prefetch)
+	done := make(chan struct{})
+	var once sync.Once
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+			}
+			b.mu.Lock()
+			for len(out) < cap(out) {
+				body, ok, _ := b.popLocked(queue)
+				if !ok {
+					break
+				}
+				out <- Delivery{
+					Body: body,
+					Ack:  func() error { return nil },
+					Nack: func(requeue bool) error {
+						if requeue {
+							b.Publish(context.Background(), queue, "", body)
+						}
+						return nil
+					},
+				}
+			}
+			b.mu.Unlock()
+		}
+	}()
+	cancel := func() error {
+		once.Do(func() {
+			b.mu.Lock()
+			b.consumers[queue]--
+			b.mu.Unlock()
+			close(done)
+		})
+		return nil
+	}
+	return out, cancel, nil
+}
+
+func (b *memBroker) Publish(_ context.Context, queue, _ string, body []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.queues[queue] = append(b.queues[queue], body)
+	return nil
+}
+
+func (b *memBroker) depth(queue string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.queues[queue])
+}
+
+func (b *memBroker) consumerCount(queue string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.consumers[queue]
+}
+
+// send publishes a control message the way the controller does.
+func (b *memBroker) send(t *testing.T, pod string, msg protocol.ControlMessage) {
+	t.Helper()
+	if msg.Version == 0 {
+		msg.Version = protocol.Version
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = b.Publish(context.Background(), protocol.ControlQueueName(pod), "", body)
+}
+
+// awaitReply waits for the reply to the control message with id.
+func (b *memBroker) awaitReply(t *testing.T, queue, id string) protocol.ControlReply {
+	t.Helper()
+	var reply protocol.ControlReply
+	waitFor(t, "reply to "+id, func() bool {
+		body, ok, _ := b.Get(context.Background(), queue)
+		if !ok {
+			return false
+		}
+		if err := json.Unmarshal(body, &reply); err != nil {
+			t.Fatal(err)
+		}
+		return reply.ID == id
+	})
+	return reply
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// recorder is a Handler that records the messages it is given.
+type recorder struct {
+	mu   sync.Mutex
+	msgs []Message
+}
+
+func (r *recorder) handle(_ context.Context, msg Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = append(r.msgs, msg)
+	return nil
+}
+
+func (r *recorder) received() []Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Message(nil), r.msgs...)
+}
+
+const (
+	testPod     = "consumer-0"
+	primary     = "orders"
+	replay      = "orders.ms2m-replay"
+	testReplyTo = "ms2m.reply.default.mig"
+)
+
+// startConsumer runs a Consumer for cfg against b until the test ends.
+func startConsumer(t *testing.T, b *memBroker, cfg Config) *Consumer {
+	t.Helper()
+	cfg.Pod = testPod
+	cfg.PrimaryQueue = primary
+	cfg.ControlInterval = 5 * time.Millisecond
+	cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.Run(ctx, b) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-errCh; !errors.Is(err, context.Canceled) {
+			t.Errorf("Run() returned %v, want context.Canceled", err)
+		}
+	})
+	return c
+}
+
+func TestNew_RequiresQueueAndHandler(t *testing.T) {
+	if _, err := New(Config{Handler: func(context.Context, Message) error { return nil }}); err == nil {
+		t.Error("expected error without PrimaryQueue")
+	}
+	if _, err := New(Config{PrimaryQueue: primary}); err == nil {
+		t.Error("expected error without Handler")
+	}
+}
+
+func TestConsumer_ConsumesPrimaryQueue(t *testing.T) {
+	b := newMemBroker()
+	for _, body := range []string{"a", "b", "c"} {
+		_ = b.Publish(context.Background(), primary, "", []byte(body))
+	}
+	rec := &recorder{}
+	var readiness []bool
+	var mu sync.Mutex
+	c := startConsumer(t, b, Config{
+		Handler: rec.handle,
+		OnReady: func(ready bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			readiness = append(readiness, ready)
+		},
+	})
+
+	waitFor(t, "3 messages", func() bool { return c.Processed() == 3 })
+	if !c.Ready() {
+		t.Error("expected consumer to be ready while consuming the primary queue")
+	}
+	for i, msg := range rec.received() {
+		if msg.Queue != primary || msg.Replay {
+			t.Errorf("message %d: expected primary, non-replay message, got %+v", i, msg)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(readiness) != 1 || !readiness[0] {
+		t.Errorf("expected OnReady(true) once, got %v", readiness)
+	}
+}
+
+func TestConsumer_RestoreModeWaitsForStartReplay(t *testing.T) {
+	b := newMemBroker()
+	_ = b.Publish(context.Background(), primary, "", []byte("live"))
+	_ = b.Publish(context.Background(), replay, "", []byte("r1"))
+	_ = b.Publish(context.Background(), replay, "", []byte("r2"))
+	rec := &recorder{}
+	c := startConsumer(t, b, Config{Handler: rec.handle, RestoreMode: true})
+
+	// Nothing is consumed until START_REPLAY.
+	time.Sleep(50 * time.Millisecond)
+	if c.Processed() != 0 || c.Ready() {
+		t.Fatalf("expected restore mode to hold off consuming, processed=%d ready=%v", c.Processed(), c.Ready())
+	}
+
+	b.send(t, testPod, protocol.ControlMessage{
+		ID:      "start-1",
+		Type:    protocol.ControlStartReplay,
+		ReplyTo: testReplyTo,
+		Payload: map[string]interface{}{"queue": replay},
+	})
+	if reply := b.awaitReply(t, testReplyTo, "start-1"); reply.Status != protocol.ReplyAck {
+		t.Fatalf("expected START_REPLAY ack, got %+v", reply)
+	}
+	waitFor(t, "replayed messages", func() bool { return c.Processed() == 2 })
+	if c.Ready() {
+		t.Error("expected consumer not to be ready while replaying")
+	}
+	if b.depth(primary) != 1 {
+		t.Errorf("expected the primary queue to be left alone during replay, depth %d", b.depth(primary))
+	}
+
+	b.send(t, testPod, protocol.ControlMessage{ID: "end-1", Type: protocol.ControlEndReplay, ReplyTo: testReplyTo})
+	if reply := b.awaitReply(t, testReplyTo, "end-1"); reply.Status != protocol.ReplyAck {
+		t.Fatalf("expected END_REPLAY ack, got %+v", reply)
+	}
+	waitFor(t, "primary message", func() bool { return c.Processed() == 3 })
+	if !c.Ready() {
+		t.Error("expected consumer to be ready after END_REPLAY")
+	}
+
+	msgs := rec.received()
+	for i, want := range []struct {
+		body   string
+		replay bool
+	}{{"r1", true}, {"r2", true}, {"live", false}} {
+		if string(msgs[i].Body) != want.body || msgs[i].Replay != want.replay {
+			t.Errorf("message %d: expected %q (replay=%v), got %q (replay=%v)",
+				i, want.body, want.replay, msgs[i].Body, msgs[i].Replay)
+		}
+	}
+}
+
+func TestConsumer_StopConsumingAcksAfterCancel(t *testing.T) {
+	b := newMemBroker()
+	c := startConsumer(t, b, Config{Handler: (&recorder{}).handle})
+	waitFor(t, "primary consumer", func() bool { return b.consumerCount(primary) == 1 })
+
+	b.send(t, testPod, protocol.ControlMessage{ID: "stop-1", Type: protocol.ControlStopConsuming, ReplyTo: testReplyTo})
+	if reply := b.awaitReply(t, testReplyTo, "stop-1"); reply.Status != protocol.ReplyAck {
+		t.Fatalf("expected STOP_CONSUMING ack, got %+v", reply)
+	}
+	if n := b.consumerCount(primary); n != 0 {
+		t.Errorf("expected the consumer to be cancelled before the ack, %d left", n)
+	}
+	if c.Ready() {
+		t.Error("expected a fenced consumer not to be ready")
+	}
+
+	_ = b.Publish(context.Background(), primary, "", []byte("late"))
+	time.Sleep(30 * time.Millisecond)
+	if c.Processed() != 0 || b.depth(primary) != 1 {
+		t.Errorf("expected no consumption after STOP_CONSUMING, processed=%d", c.Processed())
+	}
+}
+
+func TestConsumer_AnswersPingAndStatus(t *testing.T) {
+	b := newMemBroker()
+	c := startConsumer(t, b, Config{
+		Handler: (&recorder{}).handle,
+		Status:  func() map[string]interface{} { return map[string]interface{}{"lastSeq": 41} },
+	})
+	waitFor(t, "ready", c.Ready)
+
+	b.send(t, testPod, protocol.ControlMessage{ID: "ping-1", Type: protocol.ControlPing, ReplyTo: testReplyTo})
+	if reply := b.awaitReply(t, testReplyTo, "ping-1"); reply.Status != protocol.ReplyAck {
+		t.Errorf("expected PING ack, got %+v", reply)
+	}
+
+	b.send(t, testPod, protocol.ControlMessage{ID: "status-1", Type: protocol.ControlStatus, ReplyTo: testReplyTo})
+	reply := b.awaitReply(t, testReplyTo, "status-1")
+	if reply.Payload["queue"] != primary || reply.Payload["ready"] != true || reply.Payload["lastSeq"] != float64(41) {
+		t.Errorf("unexpected STATUS payload %v", reply.Payload)
+	}
+}
+
+func TestConsumer_NacksUnsupportedRequests(t *testing.T) {
+	b := newMemBroker()
+	startConsumer(t, b, Config{Handler: (&recorder{}).handle})
+
+	tests := []struct {
+		name string
+		msg  protocol.ControlMessage
+	}{
+		{"unknown type", protocol.ControlMessage{ID: "n1", Type: "REBOOT"}},
+		{"future version", protocol.ControlMessage{ID: "n2", Version: protocol.Version + 1, Type: protocol.ControlPing}},
+		{"replay without queue", protocol.ControlMessage{ID: "n3", Type: protocol.ControlStartReplay}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.msg.ReplyTo = testReplyTo
+			b.send(t, testPod, tt.msg)
+			reply := b.awaitReply(t, testReplyTo, tt.msg.ID)
+			if reply.Status != protocol.ReplyNack || reply.Reason == "" {
+				t.Errorf("expected nack with a reason, got %+v", reply)
+			}
+		})
+	}
+}
+
+func TestConsumer_SeenSkipsHandledMessages(t *testing.T) {
+	b := newMemBroker()
+	_ = b.Publish(context.Background(), primary, "", []byte("dup"))
+	_ = b.Publish(context.Background(), primary, "", []byte("new"))
+	rec := &recorder{}
+	startConsumer(t, b, Config{
+		Handler: rec.handle,
+		Seen:    func(msg Message) bool { return string(msg.Body) == "dup" },
+	})
+
+	waitFor(t, "new message", func() bool { return len(rec.received()) == 1 })
+	time.Sleep(20 * time.Millisecond)
+	if msgs := rec.received(); len(msgs) != 1 || string(msgs[0].Body) != "new" {
+		t.Errorf("expected only the unseen message to be handled, got %v", msgs)
+	}
+	if b.depth(primary) != 0 {
+		t.Errorf("expected the seen message to be acknowledged, depth %d", b.depth(primary))
+	}
+}
+
+func TestConsumer_ReadyHandler(t *testing.T) {
+	b := newMemBroker()
+	c := startConsumer(t, b, Config{Handler: (&recorder{}).handle, RestoreMode: true})
+
+	probe := func() int {
+		rec := httptest.NewRecorder()
+		c.ReadyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		return rec.Code
+	}
+	// A restored pod must pass its probe before the controller sends
+	// START_REPLAY.
+	waitFor(t, "connected", c.Connected)
+	if c.Ready() {
+		t.Error("expected restore mode to hold off consuming")
+	}
+	if code := probe(); code != http.StatusOK {
+		t.Errorf("expected 200 while waiting for START_REPLAY, got %d", code)
+	}
+	b.send(t, testPod, protocol.ControlMessage{Type: protocol.ControlStartReplay, Payload: map[string]interface{}{"queue": replay}})
+	b.send(t, testPod, protocol.ControlMessage{Type: protocol.ControlEndReplay})
+	waitFor(t, "ready", c.Ready)
+	if code := probe(); code != http.StatusOK {
+		t.Errorf("expected 200 once consuming the primary queue, got %d", code)
+	}
+}
+
+func TestConsumer_ReadyHandlerFailsWithoutBroker(t *testing.T) {
+	c, err := New(Config{PrimaryQueue: primary, Pod: testPod, Handler: (&recorder{}).handle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	c.ReadyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 before Run, got %d", rec.Code)
+	}
+}
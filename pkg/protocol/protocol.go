@@ -0,0 +1,110 @@
+// Package protocol defines the MS2M control protocol spoken between the
+// migration controller and the workloads it migrates: the control messages
+// sent to a pod, the replies it sends back, and the queues both travel on.
+package protocol
+
+import "time"
+
+// Version is the version of the control protocol spoken by this
+// controller. It is sent with every control message and checked on every
+// reply; workloads reply with the version they were addressed in.
+const Version = 1
+
+// ControlMessageType identifies the type of control message sent to a pod
+// during the MS2M migration process.
+type ControlMessageType string
+
+const (
+	// ControlStartReplay tells the target pod to begin replaying
+	// messages from the secondary queue.
+	ControlStartReplay ControlMessageType = "START_REPLAY"
+
+	// ControlEndReplay tells the target pod to stop replaying and
+	// switch over to consuming from the primary queue.
+	ControlEndReplay ControlMessageType = "END_REPLAY"
+
+	// ControlStopConsuming tells the source pod to cancel its consumer on
+	// the primary queue before it is deleted. The pod acknowledges once
+	// the consumer is cancelled; without acknowledgements the controller
+	// observes the cancellation through GetQueueConsumers.
+	ControlStopConsuming ControlMessageType = "STOP_CONSUMING"
+
+	// ControlPing asks a pod to acknowledge that it is listening on its
+	// control queue. It carries no payload and changes nothing.
+	ControlPing ControlMessageType = "PING"
+
+	// ControlStatus asks a pod to report its consumer state (e.g. the
+	// queue it consumes and whether it is replaying) in the reply payload.
+	ControlStatus ControlMessageType = "STATUS"
+)
+
+// ControlMessage is the JSON envelope sent over a pod's control queue.
+type ControlMessage struct {
+	// Version is the protocol version. Set by the client.
+	Version int `json:"version"`
+
+	// ID is the correlation ID. A pod answers with a ControlReply carrying
+	// the same ID on the ReplyTo queue. Empty for messages that expect no
+	// reply.
+	ID string `json:"id,omitempty"`
+
+	// Type is the control message type.
+	Type ControlMessageType `json:"type"`
+
+	// Migration identifies the sending migration as namespace/name, so a
+	// pod can ignore messages left over from an earlier migration.
+	Migration string `json:"migration,omitempty"`
+
+	// ReplyTo is the queue to send the ControlReply to.
+	ReplyTo string `json:"replyTo,omitempty"`
+
+	// SentAt is when the message was published. Set by the client.
+	SentAt time.Time `json:"sentAt"`
+
+	// Payload carries type-specific arguments (e.g. the queue to replay).
+	Payload map[string]interface{} `json:"payload,omitempty"`
+
+	// TTL expires the message on the broker if it is not consumed in time.
+	// Zero keeps it until consumed.
+	TTL time.Duration `json:"-"`
+}
+
+// ReplyStatus is the outcome reported in a ControlReply.
+type ReplyStatus string
+
+const (
+	// ReplyAck means the pod carried out the request.
+	ReplyAck ReplyStatus = "ack"
+
+	// ReplyNack means the pod refused or failed the request; Reason says why.
+	ReplyNack ReplyStatus = "nack"
+)
+
+// ControlReply is a pod's answer to a ControlMessage, published to the
+// message's ReplyTo queue.
+type ControlReply struct {
+	// Version is the protocol version the pod replied in.
+	Version int `json:"version"`
+
+	// ID is the correlation ID of the ControlMessage being answered.
+	ID string `json:"id"`
+
+	// Status is ack or nack.
+	Status ReplyStatus `json:"status"`
+
+	// Reason explains a nack.
+	Reason string `json:"reason,omitempty"`
+
+	// Payload carries type-specific results (e.g. STATUS output).
+	Payload map[string]interface{} `json:"payload,omitempty"`
+}
+
+// ControlQueueName returns the control queue a pod consumes from.
+func ControlQueueName(pod string) string {
+	return "ms2m.control." + pod
+}
+
+// ReplyQueueName returns the reply queue for a migration.
+func ReplyQueueName(namespace, migration string) string {
+	return "ms2m.reply." + namespace + "." + migration
+}
@@ -0,0 +1,41 @@
+// Package strategy lets migration strategies be added from outside the
+// controller. A strategy package implements Strategy and calls Register from
+// an init function; the controller binary links it in with a blank import in
+// cmd/main.go:
+//
+//	import _ "example.com/ms2m-bluegreen"
+//
+// The reconciler passed to the hooks exports the steps the built-in
+// strategies share: LookupTarget, RunningTarget, CreateTarget,
+// AbortTargetPod, HoldOrdinal, ReleaseOrdinal and RetryOrFail.
+package strategy
+
+import (
+	"github.com/haidinhtuan/kubernetes-controller/internal/controller"
+)
+
+// Strategy is a migration strategy, selected by spec.migrationStrategy.
+type Strategy = controller.Strategy
+
+// Capabilities describe a strategy to the steps the reconciler shares
+// between strategies.
+type Capabilities = controller.Capabilities
+
+// VolumeHandling is how a strategy carries persistent volumes over.
+type VolumeHandling = controller.VolumeHandling
+
+// Reconciler is the migration reconciler passed to a strategy's hooks.
+type Reconciler = controller.StatefulMigrationReconciler
+
+// Volume handling for Capabilities.Volumes.
+const (
+	VolumesShared = controller.VolumesShared
+	VolumesMoved  = controller.VolumesMoved
+	VolumesNone   = controller.VolumesNone
+)
+
+// Register makes s available as spec.migrationStrategy name. It panics if
+// name is empty or already registered.
+func Register(name string, s Strategy) {
+	controller.RegisterStrategy(name, s)
+}